@@ -128,6 +128,7 @@ func registerConfig(config *gin.RouterGroup) {
 	config.POST("/services", createService)
 	config.PUT("/services/:service", updateService)
 	config.DELETE("/services/:service", deleteService)
+	config.GET("/services/:service/doctor", getServiceDoctor)
 
 	config.POST("/chains", createChain)
 	config.PUT("/chains/:chain", updateChain)
@@ -49,7 +49,11 @@ func createIngress(ctx *gin.Context) {
 		return
 	}
 
-	v := parser.ParseIngress(&req.Data)
+	v, err := parser.ParseIngress(&req.Data)
+	if err != nil {
+		writeError(ctx, NewError(http.StatusBadRequest, ErrCodeInvalid, fmt.Sprintf("create ingress %s failed: %s", name, err.Error())))
+		return
+	}
 
 	if err := registry.IngressRegistry().Register(name, v); err != nil {
 		writeError(ctx, NewError(http.StatusBadRequest, ErrCodeDup, fmt.Sprintf("ingress %s already exists", name)))
@@ -105,7 +109,11 @@ func updateIngress(ctx *gin.Context) {
 
 	req.Data.Name = name
 
-	v := parser.ParseIngress(&req.Data)
+	v, err := parser.ParseIngress(&req.Data)
+	if err != nil {
+		writeError(ctx, NewError(http.StatusBadRequest, ErrCodeInvalid, fmt.Sprintf("create ingress %s failed: %s", name, err.Error())))
+		return
+	}
 
 	registry.IngressRegistry().Unregister(name)
 
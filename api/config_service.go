@@ -1,14 +1,19 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-gost/core/service"
 	"github.com/go-gost/x/config"
 	parser "github.com/go-gost/x/config/parsing/service"
+	mdx "github.com/go-gost/x/metadata"
 	"github.com/go-gost/x/registry"
+	xservice "github.com/go-gost/x/service"
 )
 
 // swagger:parameters createServiceRequest
@@ -110,10 +115,35 @@ func updateService(ctx *gin.Context) {
 		writeError(ctx, NewError(http.StatusBadRequest, ErrCodeNotFound, fmt.Sprintf("service %s not found", name)))
 		return
 	}
-	old.Close()
 
 	req.Data.Name = name
 
+	// the auther, bypass and limiter of the handler are swapped on the running service,
+	// and the reloadable handler metadata is reloaded, so the established connections are kept.
+	var reloadable []string
+	if reloader, ok := old.(xservice.Reloader); ok {
+		reloadable = reloader.ReloadableKeys()
+	}
+	if parser.OnlyHandlerOptionsChanged(serviceConfig(name), &req.Data, reloadable...) &&
+		updateHandler(old, &req.Data, len(reloadable) > 0) == nil {
+		config.OnUpdate(func(c *config.Config) error {
+			for i := range c.Services {
+				if c.Services[i].Name == name {
+					c.Services[i] = &req.Data
+					break
+				}
+			}
+			return nil
+		})
+
+		ctx.JSON(http.StatusOK, Response{
+			Msg: "OK",
+		})
+		return
+	}
+
+	old.Close()
+
 	svc, err := parser.ParseService(&req.Data)
 	if err != nil {
 		writeError(ctx, NewError(http.StatusInternalServerError, ErrCodeFailed, fmt.Sprintf("create service %s failed: %s", name, err.Error())))
@@ -145,11 +175,31 @@ func updateService(ctx *gin.Context) {
 	})
 }
 
+// updateHandler updates the handler of the running service in place,
+// by the options and, if reload is set, the metadata of the service config cfg.
+func updateHandler(svc service.Service, cfg *config.ServiceConfig, reload bool) error {
+	updater, ok := svc.(xservice.OptionsUpdater)
+	if !ok {
+		return xservice.ErrUpdateNotSupported
+	}
+	if err := updater.UpdateOptions(parser.ParseHandlerOptions(cfg)...); err != nil {
+		return err
+	}
+	if reloader, ok := svc.(xservice.Reloader); ok && reload {
+		return reloader.Reload(mdx.NewMetadata(cfg.Handler.Metadata))
+	}
+	return nil
+}
+
 // swagger:parameters deleteServiceRequest
 type deleteServiceRequest struct {
 	// in: path
 	// required: true
 	Service string `uri:"service" json:"service"`
+	// the time the active connections of the service are drained in the background, such as 30s,
+	// the drain timeout of the service config is used if not set.
+	// in: query
+	DrainTimeout string `form:"drainTimeout" json:"drainTimeout"`
 }
 
 // successful operation.
@@ -171,9 +221,20 @@ func deleteService(ctx *gin.Context) {
 
 	var req deleteServiceRequest
 	ctx.ShouldBindUri(&req)
+	ctx.ShouldBindQuery(&req)
 
 	name := strings.TrimSpace(req.Service)
 
+	var drainTimeout time.Duration
+	if req.DrainTimeout != "" {
+		d, err := time.ParseDuration(req.DrainTimeout)
+		if err != nil || d < 0 {
+			writeError(ctx, NewError(http.StatusBadRequest, ErrCodeInvalid, fmt.Sprintf("invalid drain timeout %s", req.DrainTimeout)))
+			return
+		}
+		drainTimeout = d
+	}
+
 	svc := registry.ServiceRegistry().Get(name)
 	if svc == nil {
 		writeError(ctx, NewError(http.StatusBadRequest, ErrCodeNotFound, fmt.Sprintf("service %s not found", name)))
@@ -181,7 +242,16 @@ func deleteService(ctx *gin.Context) {
 	}
 
 	registry.ServiceRegistry().Unregister(name)
-	svc.Close()
+	if drainTimeout > 0 {
+		// the service is drained in the background, the request does not wait for the active connections.
+		go func() {
+			c, cancel := context.WithTimeout(context.Background(), drainTimeout)
+			defer cancel()
+			xservice.Drain(c, svc)
+		}()
+	} else {
+		svc.Close()
+	}
 
 	config.OnUpdate(func(c *config.Config) error {
 		services := c.Services
@@ -199,3 +269,52 @@ func deleteService(ctx *gin.Context) {
 		Msg: "OK",
 	})
 }
+
+// swagger:parameters getServiceDoctorRequest
+type getServiceDoctorRequest struct {
+	// in: path
+	// required: true
+	Service string `uri:"service" json:"service"`
+}
+
+// successful operation.
+// swagger:response getServiceDoctorResponse
+type getServiceDoctorResponse struct {
+	// in: body
+	Report *parser.Report
+}
+
+func getServiceDoctor(ctx *gin.Context) {
+	// swagger:route GET /config/services/{service}/doctor Service getServiceDoctorRequest
+	//
+	// Check the metadata of the listener and the handler of the service against the declared schemas,
+	// and dump the effective metadata and the unknown keys.
+	//
+	//     Security:
+	//       basicAuth: []
+	//
+	//     Responses:
+	//       200: getServiceDoctorResponse
+
+	var req getServiceDoctorRequest
+	ctx.ShouldBindUri(&req)
+
+	name := strings.TrimSpace(req.Service)
+	cfg := serviceConfig(name)
+	if cfg == nil {
+		writeError(ctx, NewError(http.StatusBadRequest, ErrCodeNotFound, fmt.Sprintf("service %s not found", name)))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, parser.Doctor(cfg))
+}
+
+// serviceConfig returns the config of the service name in the global config, nil if not found.
+func serviceConfig(name string) *config.ServiceConfig {
+	for _, svc := range config.Global().Services {
+		if svc.Name == name {
+			return svc
+		}
+	}
+	return nil
+}
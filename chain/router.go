@@ -10,6 +10,7 @@ import (
 	"github.com/go-gost/core/chain"
 	"github.com/go-gost/core/logger"
 	"github.com/go-gost/core/recorder"
+	ctxvalue "github.com/go-gost/x/ctx"
 	xnet "github.com/go-gost/x/internal/net"
 )
 
@@ -94,13 +95,27 @@ func (r *Router) dial(ctx context.Context, network, address string) (conn net.Co
 			defer cancel()
 		}
 
+		// the resolver of the handler overrides the resolver of the router.
+		resolver := r.options.Resolver
+		if v := ctxvalue.ResolverFromContext(ctx); v != nil {
+			resolver = v
+		}
+
 		var ipAddr string
-		ipAddr, err = xnet.Resolve(ctx, "ip", address, r.options.Resolver, r.options.HostMapper, r.options.Logger)
+		ipAddr, err = xnet.Resolve(ctx, "ip", address, resolver, r.options.HostMapper, r.options.Logger)
 		if err != nil {
 			r.options.Logger.Error(err)
 			break
 		}
 
+		// the exit node connects to the resolved address.
+		if f := ctxvalue.ForwardedFromContext(ctx); f != nil && f.Target == address && ipAddr != address {
+			ctx = ctxvalue.ContextWithForwarded(ctx, &ctxvalue.Forwarded{
+				For:    f.For,
+				Target: ipAddr,
+			})
+		}
+
 		var route chain.Route
 		if r.options.Chain != nil {
 			route = r.options.Chain.Route(ctx, network, ipAddr, chain.WithHostRouteOption(address))
@@ -103,6 +103,25 @@ type MetricsConfig struct {
 	Auther string      `yaml:",omitempty" json:"auther,omitempty"`
 }
 
+// TracingConfig is the exporter of the spans of the handlers with the metadata tracing enabled.
+type TracingConfig struct {
+	// Endpoint is the OTLP/HTTP traces endpoint, e.g. http://localhost:4318/v1/traces,
+	// the spans are written to the debug log if it is empty.
+	Endpoint string `yaml:",omitempty" json:"endpoint,omitempty"`
+	// Headers are the extra headers of the export requests, e.g. the authorization.
+	Headers map[string]string `yaml:",omitempty" json:"headers,omitempty"`
+	Timeout time.Duration     `yaml:",omitempty" json:"timeout,omitempty"`
+}
+
+// PrivilegeConfig drops the privileges of the process once all the services are initialized.
+type PrivilegeConfig struct {
+	// the name or the id of the user and the group.
+	User       string `yaml:",omitempty" json:"user,omitempty"`
+	Group      string `yaml:",omitempty" json:"group,omitempty"`
+	NoNewPrivs bool   `yaml:"noNewPrivs,omitempty" json:"noNewPrivs,omitempty"`
+	Seccomp    bool   `yaml:",omitempty" json:"seccomp,omitempty"`
+}
+
 type TLSConfig struct {
 	CertFile   string      `yaml:"certFile,omitempty" json:"certFile,omitempty"`
 	KeyFile    string      `yaml:"keyFile,omitempty" json:"keyFile,omitempty"`
@@ -232,6 +251,14 @@ type HostsConfig struct {
 type IngressRuleConfig struct {
 	Hostname string `json:"hostname"`
 	Endpoint string `json:"endpoint"`
+	// Allow and Deny are the lists of CIDRs of the visitors' source addresses.
+	Allow []string `yaml:",omitempty" json:"allow,omitempty"`
+	Deny  []string `yaml:",omitempty" json:"deny,omitempty"`
+	// Forwarded is the headers set on the HTTP requests of the visitors,
+	// any of X-Forwarded-For, X-Forwarded-Proto, X-Forwarded-Host and X-Real-IP, or all.
+	Forwarded []string `yaml:",omitempty" json:"forwarded,omitempty"`
+	// ForwardedStrip removes all the forwarded headers supplied by the visitors first, including the ones not in Forwarded.
+	ForwardedStrip bool `yaml:"forwardedStrip,omitempty" json:"forwardedStrip,omitempty"`
 }
 
 type IngressConfig struct {
@@ -545,6 +572,8 @@ type Config struct {
 	Profiling  *ProfilingConfig   `yaml:",omitempty" json:"profiling,omitempty"`
 	API        *APIConfig         `yaml:",omitempty" json:"api,omitempty"`
 	Metrics    *MetricsConfig     `yaml:",omitempty" json:"metrics,omitempty"`
+	Tracing    *TracingConfig     `yaml:",omitempty" json:"tracing,omitempty"`
+	Privilege  *PrivilegeConfig   `yaml:",omitempty" json:"privilege,omitempty"`
 }
 
 func (c *Config) Load() error {
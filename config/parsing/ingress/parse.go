@@ -2,6 +2,7 @@ package ingress
 
 import (
 	"crypto/tls"
+	"fmt"
 	"strings"
 
 	"github.com/go-gost/core/ingress"
@@ -13,9 +14,9 @@ import (
 	"github.com/go-gost/x/internal/plugin"
 )
 
-func ParseIngress(cfg *config.IngressConfig) ingress.Ingress {
+func ParseIngress(cfg *config.IngressConfig) (ingress.Ingress, error) {
 	if cfg == nil {
-		return nil
+		return nil, nil
 	}
 
 	if cfg.Plugin != nil {
@@ -32,29 +33,44 @@ func ParseIngress(cfg *config.IngressConfig) ingress.Ingress {
 				cfg.Name, cfg.Plugin.Addr,
 				plugin.TLSConfigOption(tlsCfg),
 				plugin.TimeoutOption(cfg.Plugin.Timeout),
-			)
+			), nil
 		default:
 			return ingress_plugin.NewGRPCPlugin(
 				cfg.Name, cfg.Plugin.Addr,
 				plugin.TokenOption(cfg.Plugin.Token),
 				plugin.TLSConfigOption(tlsCfg),
-			)
+			), nil
 		}
 	}
 
 	var rules []*ingress.Rule
+	acls := make(map[string]*xingress.ACL)
+	forwarded := make(map[string]*xingress.Forwarded)
 	for _, rule := range cfg.Rules {
 		if rule.Hostname == "" || rule.Endpoint == "" {
 			continue
 		}
 
+		acl, err := xingress.NewACL(rule.Allow, rule.Deny)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Hostname, err)
+		}
+
 		rules = append(rules, &ingress.Rule{
 			Hostname: rule.Hostname,
 			Endpoint: rule.Endpoint,
 		})
+		if acl != nil {
+			acls[rule.Hostname] = acl
+		}
+		if f := xingress.NewForwarded(rule.Forwarded, rule.ForwardedStrip); f != nil {
+			forwarded[rule.Hostname] = f
+		}
 	}
 	opts := []xingress.Option{
 		xingress.RulesOption(rules),
+		xingress.ACLsOption(acls),
+		xingress.ForwardedOption(forwarded),
 		xingress.ReloadPeriodOption(cfg.Reload),
 		xingress.LoggerOption(logger.Default().WithFields(map[string]any{
 			"kind":    "ingress",
@@ -88,5 +104,5 @@ func ParseIngress(cfg *config.IngressConfig) ingress.Ingress {
 			loader.TimeoutHTTPLoaderOption(cfg.HTTP.Timeout),
 		)))
 	}
-	return xingress.NewIngress(opts...)
+	return xingress.NewIngress(opts...), nil
 }
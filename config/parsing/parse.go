@@ -11,6 +11,10 @@ const (
 	MDKeyPostDown      = "postDown"
 	MDKeyIgnoreChain   = "ignoreChain"
 	MDKeyEnableStats   = "enableStats"
+	MDKeyEgressProxy   = "egress.proxy"
+	MDKeyStrict        = "strict"
+	// MDKeyDrainTimeout is the time the service waits for the active connections when it is closed.
+	MDKeyDrainTimeout = "drainTimeout"
 
 	MDKeyRecorderDirection       = "direction"
 	MDKeyRecorderTimestampFormat = "timeStampFormat"
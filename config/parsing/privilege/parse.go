@@ -0,0 +1,21 @@
+package privilege
+
+import (
+	"github.com/go-gost/x/config"
+	"github.com/go-gost/x/privilege"
+)
+
+// ParsePrivilege returns the options of privilege.Drop, which is called after all the services are parsed,
+// as the listeners perform the privileged operations in Init.
+// It is called by the program running the services, see the package privilege.
+func ParsePrivilege(cfg *config.PrivilegeConfig) *privilege.Options {
+	if cfg == nil {
+		return nil
+	}
+	return &privilege.Options{
+		User:       cfg.User,
+		Group:      cfg.Group,
+		NoNewPrivs: cfg.NoNewPrivs,
+		Seccomp:    cfg.Seccomp,
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/go-gost/core/logger"
+	"github.com/go-gost/x/config"
+	"github.com/go-gost/x/config/parsing"
+	"github.com/go-gost/x/metadata"
+)
+
+// MetadataReport is the metadata of the listener or the handler of a service checked against the schema of it.
+type MetadataReport struct {
+	Type string `json:"type"`
+	// Schema is the keys declared by the component, it is empty if the component declares none.
+	Schema []string `json:"schema,omitempty"`
+	// Effective is the values of the declared keys set in the config.
+	Effective map[string]any `json:"effective,omitempty"`
+	// Unknown is the keys set in the config but not declared, with the close matches of the schema.
+	Unknown []string `json:"unknown,omitempty"`
+	// Declared reports whether the component declares the schema, the unknown keys are not checked if not.
+	Declared bool `json:"declared"`
+}
+
+// Report is the doctor dump of the effective metadata of a service.
+type Report struct {
+	Service  string         `json:"service"`
+	Listener MetadataReport `json:"listener"`
+	Handler  MetadataReport `json:"handler"`
+}
+
+// Doctor checks the metadata of the listener and the handler of the service against the declared schemas.
+func Doctor(cfg *config.ServiceConfig) *Report {
+	r := &Report{
+		Service: cfg.Name,
+	}
+	if cfg.Listener != nil {
+		r.Listener = metadataReport(metadata.SchemaListener, cfg.Listener.Type, cfg.Listener.Metadata)
+	}
+	if cfg.Handler != nil {
+		r.Handler = metadataReport(metadata.SchemaHandler, cfg.Handler.Type, cfg.Handler.Metadata)
+	}
+	return r
+}
+
+func metadataReport(kind, typ string, m map[string]any) MetadataReport {
+	schema, ok := componentSchema(kind, typ)
+	r := MetadataReport{
+		Type:     typ,
+		Declared: ok,
+	}
+	if !ok {
+		return r
+	}
+	r.Schema = schema
+	r.Effective = schema.Effective(m)
+	r.Unknown = schema.Unknown(m)
+	return r
+}
+
+// componentSchema returns the schema of the component with the keys read by the service parsing from the metadata of it.
+func componentSchema(kind, typ string) (metadata.Schema, bool) {
+	schema, ok := metadata.GetSchema(kind, typ)
+	if !ok {
+		return nil, false
+	}
+	if kind == metadata.SchemaHandler {
+		schema = append(schema[:len(schema):len(schema)], parsing.MDKeyEgressProxy)
+	}
+	return schema, true
+}
+
+// validateMetadata checks the keys of the metadata m are declared by the component in strict mode,
+// the component declaring no schema is not checked.
+func validateMetadata(kind, typ string, m map[string]any, log logger.Logger) error {
+	schema, ok := componentSchema(kind, typ)
+	if !ok {
+		log.Warnf("strict: %s %s declares no metadata schema, the metadata is not checked", kind, typ)
+		return nil
+	}
+	if err := schema.Validate(m); err != nil {
+		return fmt.Errorf("%s %s: %w", kind, typ, err)
+	}
+	return nil
+}
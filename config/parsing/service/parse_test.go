@@ -0,0 +1,68 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/go-gost/x/config"
+)
+
+func TestOnlyHandlerOptionsChanged(t *testing.T) {
+	reloadable := []string{"probeResist", "knock"}
+
+	newConfig := func(auther string, md map[string]any) *config.ServiceConfig {
+		return &config.ServiceConfig{
+			Name: "test",
+			Addr: ":8443",
+			Handler: &config.HandlerConfig{
+				Type:     "http2",
+				Auther:   auther,
+				Metadata: md,
+			},
+			Listener: &config.ListenerConfig{Type: "h2"},
+		}
+	}
+
+	old := newConfig("auther-0", map[string]any{"probeResist": "code:404", "readTimeout": "5s"})
+
+	tests := []struct {
+		name       string
+		cfg        *config.ServiceConfig
+		reloadable []string
+		want       bool
+	}{
+		{
+			name: "auther",
+			cfg:  newConfig("auther-1", map[string]any{"probeResist": "code:404", "readTimeout": "5s"}),
+			want: true,
+		},
+		{
+			name: "reloadable metadata not reloadable",
+			cfg:  newConfig("auther-0", map[string]any{"probeResist": "code:403", "readTimeout": "5s"}),
+		},
+		{
+			name:       "reloadable metadata",
+			cfg:        newConfig("auther-0", map[string]any{"PROBERESIST": "web:example.com", "knock": "www.example.com", "readTimeout": "5s"}),
+			reloadable: reloadable,
+			want:       true,
+		},
+		{
+			name:       "reloadable metadata removed",
+			cfg:        newConfig("auther-1", map[string]any{"readTimeout": "5s"}),
+			reloadable: reloadable,
+			want:       true,
+		},
+		{
+			name:       "other metadata",
+			cfg:        newConfig("auther-0", map[string]any{"probeResist": "code:403", "readTimeout": "10s"}),
+			reloadable: reloadable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OnlyHandlerOptionsChanged(old, tt.cfg, tt.reloadable...); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
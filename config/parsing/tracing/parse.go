@@ -0,0 +1,61 @@
+package tracing
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+
+	"github.com/go-gost/core/logger"
+	"github.com/go-gost/x/config"
+	"github.com/go-gost/x/tracing"
+)
+
+// ParseTracing creates the exporter of the spans, nil is returned if cfg is nil,
+// and the tracers write the spans to the log of the services then.
+func ParseTracing(cfg *config.TracingConfig) tracing.Exporter {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.Endpoint == "" {
+		return tracing.NewLogExporter(logger.Default())
+	}
+
+	header := http.Header{}
+	for k, v := range cfg.Headers {
+		header.Set(k, v)
+	}
+	return tracing.NewOTLPExporter(cfg.Endpoint, tracing.OTLPOptions{
+		Header:  header,
+		Timeout: cfg.Timeout,
+		Logger:  logger.Default(),
+	})
+}
+
+var (
+	current   *config.TracingConfig
+	currentMu sync.Mutex
+)
+
+// Init sets the global exporter of the tracing by cfg.
+// It is called on every service setup, the exporter is replaced only if cfg changes.
+func Init(cfg *config.TracingConfig) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+
+	if reflect.DeepEqual(current, cfg) {
+		return
+	}
+	if cfg != nil {
+		c := *cfg
+		if cfg.Headers != nil {
+			c.Headers = make(map[string]string, len(cfg.Headers))
+			for k, v := range cfg.Headers {
+				c.Headers[k] = v
+			}
+		}
+		current = &c
+	} else {
+		current = nil
+	}
+	tracing.Init(ParseTracing(cfg))
+}
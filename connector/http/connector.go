@@ -14,6 +14,7 @@ import (
 	"github.com/go-gost/core/connector"
 	"github.com/go-gost/core/logger"
 	md "github.com/go-gost/core/metadata"
+	http_util "github.com/go-gost/x/internal/util/http"
 	"github.com/go-gost/x/internal/util/socks"
 	"github.com/go-gost/x/registry"
 )
@@ -57,7 +58,8 @@ func (c *httpConnector) Connect(ctx context.Context, conn net.Conn, network, add
 		Host:       address,
 		ProtoMajor: 1,
 		ProtoMinor: 1,
-		Header:     c.md.header,
+		// the header is cloned, as the per-request headers are added.
+		Header: c.md.header.Clone(),
 	}
 
 	if req.Header == nil {
@@ -71,6 +73,8 @@ func (c *httpConnector) Connect(ctx context.Context, conn net.Conn, network, add
 		req.Header.Set("Proxy-Authorization",
 			"Basic "+base64.StdEncoding.EncodeToString([]byte(u+":"+p)))
 	}
+	// the original client address is only sent by the exit node.
+	http_util.SetForwarded(ctx, req.Header, address)
 
 	switch network {
 	case "tcp", "tcp4", "tcp6":
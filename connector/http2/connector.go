@@ -15,6 +15,7 @@ import (
 	"github.com/go-gost/core/connector"
 	"github.com/go-gost/core/logger"
 	md "github.com/go-gost/core/metadata"
+	http_util "github.com/go-gost/x/internal/util/http"
 	"github.com/go-gost/x/registry"
 )
 
@@ -65,8 +66,9 @@ func (c *http2Connector) Connect(ctx context.Context, conn net.Conn, network, ad
 		Host:       address,
 		ProtoMajor: 2,
 		ProtoMinor: 0,
-		Header:     c.md.header,
-		Body:       pr,
+		// the header is cloned, as the per-request headers are added.
+		Header: c.md.header.Clone(),
+		Body:   pr,
 		// ContentLength: -1,
 	}
 	if req.Header == nil {
@@ -79,6 +81,8 @@ func (c *http2Connector) Connect(ctx context.Context, conn net.Conn, network, ad
 		req.Header.Set("Proxy-Authorization",
 			"Basic "+base64.StdEncoding.EncodeToString([]byte(u+":"+p)))
 	}
+	// the original client address is only sent by the exit node.
+	http_util.SetForwarded(ctx, req.Header, address)
 
 	if log.IsLevelEnabled(logger.TraceLevel) {
 		dump, _ := httputil.DumpRequest(req, false)
@@ -40,7 +40,7 @@ func (c *relayConnector) Bind(ctx context.Context, conn net.Conn, network, addre
 }
 
 func (c *relayConnector) bindTCP(ctx context.Context, conn net.Conn, network, address string, log logger.Logger) (net.Listener, error) {
-	laddr, err := c.bind(conn, relay.CmdBind, network, address)
+	laddr, _, err := c.bind(conn, relay.CmdBind, network, address)
 	if err != nil {
 		return nil, err
 	}
@@ -59,14 +59,14 @@ func (c *relayConnector) bindTCP(ctx context.Context, conn net.Conn, network, ad
 }
 
 func (c *relayConnector) bindUDP(ctx context.Context, conn net.Conn, network, address string, opts *connector.BindOptions, log logger.Logger) (net.Listener, error) {
-	laddr, err := c.bind(conn, relay.FUDP|relay.CmdBind, network, address)
+	laddr, compress, err := c.bind(conn, relay.FUDP|relay.CmdBind, network, address)
 	if err != nil {
 		return nil, err
 	}
-	log.Debugf("bind on %s/%s OK", laddr, laddr.Network())
+	log.Debugf("bind on %s/%s OK, compression: %v", laddr, laddr.Network(), compress)
 
 	ln := udp.NewListener(
-		relay_util.UDPTunClientPacketConn(conn),
+		relay_util.UDPTunClientPacketConn(conn, relay_util.CompressionUDPTunOption(compress)),
 		&udp.ListenConfig{
 			Addr:           laddr,
 			Backlog:        opts.Backlog,
@@ -80,7 +80,12 @@ func (c *relayConnector) bindUDP(ctx context.Context, conn net.Conn, network, ad
 	return ln, nil
 }
 
-func (c *relayConnector) bind(conn net.Conn, cmd relay.CmdType, network, address string) (net.Addr, error) {
+// bind sends the bind request, it reports whether the compression of the UDP datagrams is accepted by the server.
+func (c *relayConnector) bind(conn net.Conn, cmd relay.CmdType, network, address string) (net.Addr, bool, error) {
+	if c.md.udpCompression && (cmd&relay.FUDP) == relay.FUDP {
+		cmd |= relay_util.FCompress
+	}
+
 	req := relay.Request{
 		Version: relay.Version1,
 		Cmd:     cmd,
@@ -105,25 +110,29 @@ func (c *relayConnector) bind(conn net.Conn, cmd relay.CmdType, network, address
 	fa.ParseFrom(address)
 	req.Features = append(req.Features, fa)
 	if _, err := req.WriteTo(conn); err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	// first reply, bind status
 	resp := relay.Response{}
-	if _, err := resp.ReadFrom(conn); err != nil {
-		return nil, err
+	if _, err := relay_util.ReadResponse(conn, &resp); err != nil {
+		return nil, false, err
 	}
 
 	if resp.Status != relay.StatusOK {
-		return nil, fmt.Errorf("bind on %s/%s failed", address, network)
+		return nil, false, fmt.Errorf("bind on %s/%s failed", address, network)
 	}
 
 	var addr string
+	var compress bool
 	for _, f := range resp.Features {
-		if f.Type() == relay.FeatureAddr {
+		switch f.Type() {
+		case relay.FeatureAddr:
 			if fa, ok := f.(*relay.AddrFeature); ok {
 				addr = net.JoinHostPort(fa.Host, strconv.Itoa(int(fa.Port)))
 			}
+		case relay_util.FeatureCompression:
+			compress = (cmd & relay_util.FCompress) == relay_util.FCompress
 		}
 	}
 
@@ -138,8 +147,8 @@ func (c *relayConnector) bind(conn net.Conn, cmd relay.CmdType, network, address
 		err = fmt.Errorf("unknown network %s", network)
 	}
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	return baddr, nil
+	return baddr, compress, nil
 }
@@ -66,13 +66,13 @@ func (c *relayConnector) Connect(ctx context.Context, conn net.Conn, network, ad
 
 		// UDP association
 		if address == "" {
-			baddr, err := c.bind(conn, relay.FUDP|relay.CmdBind, network, address)
+			baddr, compress, err := c.bind(conn, relay.FUDP|relay.CmdBind, network, address)
 			if err != nil {
 				return nil, err
 			}
-			log.Debugf("associate on %s OK", baddr)
+			log.Debugf("associate on %s OK, compression: %v", baddr, compress)
 
-			return relay_util.UDPTunClientConn(conn, nil), nil
+			return relay_util.UDPTunClientConn(conn, nil, relay_util.CompressionUDPTunOption(compress)), nil
 		}
 
 	case "unix":
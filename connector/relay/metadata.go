@@ -12,6 +12,7 @@ type metadata struct {
 	connectTimeout time.Duration
 	noDelay        bool
 	muxCfg         *mux.Config
+	udpCompression bool
 }
 
 func (c *relayConnector) parseMetadata(md mdata.Metadata) (err error) {
@@ -22,6 +23,7 @@ func (c *relayConnector) parseMetadata(md mdata.Metadata) (err error) {
 
 	c.md.connectTimeout = mdutil.GetDuration(md, connectTimeout)
 	c.md.noDelay = mdutil.GetBool(md, noDelay)
+	c.md.udpCompression = mdutil.GetBool(md, "udpCompression")
 
 	c.md.muxCfg = &mux.Config{
 		Version:           mdutil.GetInt(md, "mux.version"),
@@ -31,6 +33,7 @@ func (c *relayConnector) parseMetadata(md mdata.Metadata) (err error) {
 		MaxFrameSize:      mdutil.GetInt(md, "mux.maxFrameSize"),
 		MaxReceiveBuffer:  mdutil.GetInt(md, "mux.maxReceiveBuffer"),
 		MaxStreamBuffer:   mdutil.GetInt(md, "mux.maxStreamBuffer"),
+		Compression:       mdutil.GetBool(md, "mux.compression"),
 	}
 
 	return
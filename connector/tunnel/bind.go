@@ -3,18 +3,33 @@ package tunnel
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"net"
 	"strconv"
+	"time"
 
 	"github.com/go-gost/core/connector"
+	mdata "github.com/go-gost/core/metadata"
 	"github.com/go-gost/relay"
 	"github.com/go-gost/x/internal/util/mux"
+	quic_util "github.com/go-gost/x/internal/util/quic"
+	xrelay "github.com/go-gost/x/internal/util/relay"
 )
 
 // Bind implements connector.Binder.
 func (c *tunnelConnector) Bind(ctx context.Context, conn net.Conn, network, address string, opts ...connector.BindOption) (net.Listener, error) {
+	var ds *quic_util.DatagramSession
+	if network == "udp" && c.md.udpDatagram {
+		if v, ok := conn.(mdata.Metadatable); ok && v.Metadata() != nil {
+			ds, _ = v.Metadata().Get(quic_util.MetadataKeyDatagramSession).(*quic_util.DatagramSession)
+		}
+		if !ds.Supported() {
+			c.options.Logger.Warn("QUIC datagram is not supported by the connection, fallback to stream")
+			ds = nil
+		}
+	}
 
-	addr, cid, err := c.initTunnel(conn, network, address)
+	addr, cid, err := c.initTunnel(ctx, conn, network, address, ds != nil)
 	if err != nil {
 		return nil, err
 	}
@@ -36,14 +51,16 @@ func (c *tunnelConnector) Bind(ctx context.Context, conn net.Conn, network, addr
 	}
 
 	return &bindListener{
-		network: network,
-		addr:    addr,
-		session: session,
-		logger:  log,
+		network:  network,
+		addr:     addr,
+		session:  session,
+		datagram: ds,
+		logger:   log,
 	}, nil
 }
 
-func (c *tunnelConnector) initTunnel(conn net.Conn, network, address string) (addr net.Addr, cid relay.ConnectorID, err error) {
+// initTunnel creates the tunnel, the datagram indicates that the connector supports the QUIC datagrams.
+func (c *tunnelConnector) initTunnel(ctx context.Context, conn net.Conn, network, address string, datagram bool) (addr net.Addr, cid relay.ConnectorID, err error) {
 	req := relay.Request{
 		Version: relay.Version1,
 		Cmd:     relay.CmdBind,
@@ -54,6 +71,9 @@ func (c *tunnelConnector) initTunnel(conn net.Conn, network, address string) (ad
 		req.Features = append(req.Features, &relay.NetworkFeature{
 			Network: relay.NetworkUDP,
 		})
+		if datagram {
+			req.Cmd |= xrelay.FDatagram
+		}
 	}
 
 	if c.options.Auth != nil {
@@ -81,12 +101,20 @@ func (c *tunnelConnector) initTunnel(conn net.Conn, network, address string) (ad
 
 	// first reply, bind status
 	resp := relay.Response{}
-	if _, err = resp.ReadFrom(conn); err != nil {
+	msg, err := xrelay.ReadResponse(conn, &resp)
+	if err != nil {
 		return
 	}
 
+	if resp.Status == xrelay.StatusTemporaryUnavailable {
+		c.backoff(ctx, resp.Features)
+	}
 	if resp.Status != relay.StatusOK {
-		err = fmt.Errorf("%d: create tunnel %s failed", resp.Status, c.md.tunnelID.String())
+		if msg != "" {
+			err = fmt.Errorf("%d: create tunnel %s failed: %s", resp.Status, c.md.tunnelID.String(), msg)
+		} else {
+			err = fmt.Errorf("%d: create tunnel %s failed", resp.Status, c.md.tunnelID.String())
+		}
 		return
 	}
 
@@ -108,3 +136,24 @@ func (c *tunnelConnector) initTunnel(conn net.Conn, network, address string) (ad
 
 	return
 }
+
+// backoff waits for the retry-after hint of the rejected bind plus a random jitter up to the hint,
+// so the connectors rejected together do not retry together.
+func (c *tunnelConnector) backoff(ctx context.Context, features []relay.Feature) {
+	delay := defaultRetryAfter
+	for _, f := range features {
+		if v, _ := f.(*xrelay.RetryAfterFeature); v != nil && v.Delay > 0 {
+			delay = v.Delay
+		}
+	}
+	delay = min(delay, maxRetryAfter)
+	delay += time.Duration(rand.Int63n(int64(delay)))
+	c.options.Logger.Debugf("tunnel %s is temporarily unavailable, retry after %s", c.md.tunnelID, delay)
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
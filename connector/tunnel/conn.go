@@ -11,6 +11,7 @@ import (
 	"github.com/go-gost/core/common/bufpool"
 	mdata "github.com/go-gost/core/metadata"
 	"github.com/go-gost/relay"
+	quic_util "github.com/go-gost/x/internal/util/quic"
 	xrelay "github.com/go-gost/x/internal/util/relay"
 )
 
@@ -57,7 +58,7 @@ func (c *udpConn) Write(b []byte) (n int, err error) {
 
 func readResponse(r io.Reader) (err error) {
 	resp := relay.Response{}
-	_, err = resp.ReadFrom(r)
+	msg, err := xrelay.ReadResponse(r, &resp)
 	if err != nil {
 		return
 	}
@@ -68,7 +69,11 @@ func readResponse(r io.Reader) (err error) {
 	}
 
 	if resp.Status != relay.StatusOK {
-		err = fmt.Errorf("%d %s", resp.Status, xrelay.StatusText(resp.Status))
+		if msg != "" {
+			err = fmt.Errorf("%d %s: %s", resp.Status, xrelay.StatusText(resp.Status), msg)
+		} else {
+			err = fmt.Errorf("%d %s", resp.Status, xrelay.StatusText(resp.Status))
+		}
 		return
 	}
 	return nil
@@ -163,6 +168,66 @@ func (c *bindUDPConn) Metadata() mdata.Metadata {
 	return c.md
 }
 
+// bindDatagramConn is a bindUDPConn with the datagrams relayed over the QUIC datagrams,
+// the datagrams received from the stream are merged into the association.
+type bindDatagramConn struct {
+	*bindUDPConn
+	assoc *quic_util.DatagramAssociation
+}
+
+func newBindDatagramConn(c *bindUDPConn, assoc *quic_util.DatagramAssociation) *bindDatagramConn {
+	conn := &bindDatagramConn{
+		bindUDPConn: c,
+		assoc:       assoc,
+	}
+	go conn.readStream()
+	return conn
+}
+
+func (c *bindDatagramConn) readStream() {
+	defer c.assoc.Close()
+
+	buf := make([]byte, math.MaxUint16)
+	for {
+		n, err := c.bindUDPConn.Read(buf)
+		if err != nil {
+			return
+		}
+		b := make([]byte, n)
+		copy(b, buf[:n])
+		if err := c.assoc.Push(b); err != nil {
+			return
+		}
+	}
+}
+
+func (c *bindDatagramConn) Read(b []byte) (n int, err error) {
+	return c.assoc.Read(b)
+}
+
+func (c *bindDatagramConn) Write(b []byte) (n int, err error) {
+	if n, err = c.assoc.Write(b); err == nil {
+		return
+	}
+	// datagram is unavailable or too large, fallback to the stream.
+	return c.bindUDPConn.Write(b)
+}
+
+func (c *bindDatagramConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	addr = c.remoteAddr
+	n, err = c.Read(b)
+	return
+}
+
+func (c *bindDatagramConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
+	return c.Write(b)
+}
+
+func (c *bindDatagramConn) Close() error {
+	c.assoc.Close()
+	return c.bindUDPConn.Close()
+}
+
 type bindAddr struct {
 	network string
 	addr    string
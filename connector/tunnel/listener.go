@@ -9,14 +9,17 @@ import (
 	mdata "github.com/go-gost/core/metadata"
 	"github.com/go-gost/relay"
 	"github.com/go-gost/x/internal/util/mux"
+	quic_util "github.com/go-gost/x/internal/util/quic"
+	xrelay "github.com/go-gost/x/internal/util/relay"
 	mdx "github.com/go-gost/x/metadata"
 )
 
 type bindListener struct {
-	network string
-	addr    net.Addr
-	session *mux.Session
-	logger  logger.Logger
+	network  string
+	addr     net.Addr
+	session  *mux.Session
+	datagram *quic_util.DatagramSession
+	logger   logger.Logger
 }
 
 func (p *bindListener) Accept() (net.Conn, error) {
@@ -38,7 +41,7 @@ func (p *bindListener) Accept() (net.Conn, error) {
 func (p *bindListener) getPeerConn(conn net.Conn) (net.Conn, error) {
 	// second reply, peer connected
 	resp := relay.Response{}
-	if _, err := resp.ReadFrom(conn); err != nil {
+	if _, err := xrelay.ReadResponse(conn, &resp); err != nil {
 		return nil, err
 	}
 
@@ -48,9 +51,11 @@ func (p *bindListener) getPeerConn(conn net.Conn) (net.Conn, error) {
 	}
 
 	var address, host string
+	var df *xrelay.DatagramFeature
 	// the first addr is the client address, the optional second addr is the target host address.
 	for _, f := range resp.Features {
-		if f.Type() == relay.FeatureAddr {
+		switch f.Type() {
+		case relay.FeatureAddr:
 			if fa, ok := f.(*relay.AddrFeature); ok {
 				v := net.JoinHostPort(fa.Host, strconv.Itoa(int(fa.Port)))
 				if address != "" {
@@ -59,6 +64,8 @@ func (p *bindListener) getPeerConn(conn net.Conn) (net.Conn, error) {
 					address = v
 				}
 			}
+		case xrelay.FeatureDatagram:
+			df, _ = f.(*xrelay.DatagramFeature)
 		}
 	}
 
@@ -73,12 +80,21 @@ func (p *bindListener) getPeerConn(conn net.Conn) (net.Conn, error) {
 	}
 
 	if p.network == "udp" {
-		return &bindUDPConn{
+		uc := &bindUDPConn{
 			Conn:       conn,
 			localAddr:  p.addr,
 			remoteAddr: raddr,
 			md:         md,
-		}, nil
+		}
+		if df != nil && p.datagram != nil {
+			assoc, err := p.datagram.Associate(df.ID)
+			if err != nil {
+				p.logger.Warnf("datagram association %d: %v", df.ID, err)
+				return uc, nil
+			}
+			return newBindDatagramConn(uc, assoc), nil
+		}
+		return uc, nil
 	}
 
 	cn := &bindConn{
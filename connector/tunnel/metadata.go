@@ -11,6 +11,12 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	// the delay before retrying the bind rejected temporarily without the retry-after hint.
+	defaultRetryAfter = 5 * time.Second
+	maxRetryAfter     = 5 * time.Minute
+)
+
 var (
 	ErrInvalidTunnelID = errors.New("tunnel: invalid tunnel ID")
 )
@@ -19,6 +25,8 @@ type metadata struct {
 	connectTimeout time.Duration
 	tunnelID       relay.TunnelID
 	muxCfg         *mux.Config
+	// relay the UDP datagrams over the QUIC datagrams if possible.
+	udpDatagram bool
 }
 
 func (c *tunnelConnector) parseMetadata(md mdata.Metadata) (err error) {
@@ -57,5 +65,7 @@ func (c *tunnelConnector) parseMetadata(md mdata.Metadata) (err error) {
 		c.md.muxCfg.Version = 2
 	}
 
+	c.md.udpDatagram = mdutil.GetBool(md, "tunnel.udp.datagram")
+
 	return
 }
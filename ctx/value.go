@@ -1,6 +1,10 @@
 package ctx
 
-import "context"
+import (
+	"context"
+
+	"github.com/go-gost/core/resolver"
+)
 
 // clientAddrKey saves the client address.
 type clientAddrKey struct{}
@@ -40,6 +44,17 @@ func SidFromContext(ctx context.Context) Sid {
 // hashKey saves the hash source for Selector.
 type hashKey struct{}
 
+// Hash is the source of the hash strategy of the selector.
+// The service sets the client IP as the source by default,
+// and the handlers can override it by the "hash" metadata:
+//
+//	host - the target address.
+//	client - the client ID of the authenticated user.
+//	src - the client IP.
+//	header - the value of the request header specified by the "hash.header" metadata (http2 only).
+//
+// The hash strategy of the router's hop selector maps the same source to the same node,
+// so the connections with the same source have affinity to the same downstream node.
 type Hash struct {
 	Source string
 }
@@ -74,3 +89,62 @@ func ClientIDFromContext(ctx context.Context) ClientID {
 	v, _ := ctx.Value(keyClientID).(ClientID)
 	return v
 }
+
+// sniKey saves the server name sniffed from the TLS ClientHello of the tunneled stream.
+type sniKey struct{}
+type SNI string
+
+var (
+	keySNI = &sniKey{}
+)
+
+func ContextWithSNI(ctx context.Context, sni SNI) context.Context {
+	return context.WithValue(ctx, keySNI, sni)
+}
+
+func SNIFromContext(ctx context.Context) SNI {
+	v, _ := ctx.Value(keySNI).(SNI)
+	return v
+}
+
+// forwardedKey saves the forwarding information of the client.
+type forwardedKey struct{}
+
+// Forwarded is the information of the original client,
+// it is sent by the HTTP connectors in the RFC 7239 Forwarded header of the CONNECT request.
+type Forwarded struct {
+	// For is the address of the original client.
+	For string
+	// Target is the destination address,
+	// the header is only sent in the CONNECT request to it, i.e. by the exit node of the chain.
+	Target string
+}
+
+var (
+	keyForwarded = &forwardedKey{}
+)
+
+func ContextWithForwarded(ctx context.Context, f *Forwarded) context.Context {
+	return context.WithValue(ctx, keyForwarded, f)
+}
+
+func ForwardedFromContext(ctx context.Context) *Forwarded {
+	v, _ := ctx.Value(keyForwarded).(*Forwarded)
+	return v
+}
+
+// resolverKey saves the resolver overriding the resolver of the router.
+type resolverKey struct{}
+
+var (
+	keyResolver = &resolverKey{}
+)
+
+func ContextWithResolver(ctx context.Context, r resolver.Resolver) context.Context {
+	return context.WithValue(ctx, keyResolver, r)
+}
+
+func ResolverFromContext(ctx context.Context) resolver.Resolver {
+	v, _ := ctx.Value(keyResolver).(resolver.Resolver)
+	return v
+}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"net"
 
+	mdata "github.com/go-gost/core/metadata"
+	quic_util "github.com/go-gost/x/internal/util/quic"
+	mdx "github.com/go-gost/x/metadata"
 	"github.com/quic-go/quic-go"
 )
 
 type quicSession struct {
-	session quic.EarlyConnection
+	session  quic.EarlyConnection
+	datagram *quic_util.DatagramSession
 }
 
 func (session *quicSession) GetConn() (*quicConn, error) {
@@ -20,6 +24,9 @@ func (session *quicSession) GetConn() (*quicConn, error) {
 		Stream: stream,
 		laddr:  session.session.LocalAddr(),
 		raddr:  session.session.RemoteAddr(),
+		md: mdx.NewMetadata(map[string]any{
+			quic_util.MetadataKeyDatagramSession: session.datagram,
+		}),
 	}, nil
 }
 
@@ -31,6 +38,7 @@ type quicConn struct {
 	quic.Stream
 	laddr net.Addr
 	raddr net.Addr
+	md    mdata.Metadata
 }
 
 func (c *quicConn) LocalAddr() net.Addr {
@@ -40,3 +48,8 @@ func (c *quicConn) LocalAddr() net.Addr {
 func (c *quicConn) RemoteAddr() net.Addr {
 	return c.raddr
 }
+
+// Metadata implements metadata.Metadatable interface.
+func (c *quicConn) Metadata() mdata.Metadata {
+	return c.md
+}
@@ -111,6 +111,7 @@ func (d *quicDialer) initSession(ctx context.Context, addr net.Addr, conn net.Pa
 			quic.Version2,
 		},
 		MaxIncomingStreams: int64(d.md.maxStreams),
+		EnableDatagrams:    d.md.datagram,
 	}
 
 	tlsCfg := d.options.TLSConfig
@@ -120,7 +121,10 @@ func (d *quicDialer) initSession(ctx context.Context, addr net.Addr, conn net.Pa
 	if err != nil {
 		return nil, err
 	}
-	return &quicSession{session: session}, nil
+	return &quicSession{
+		session:  session,
+		datagram: quic_util.NewDatagramSession(session),
+	}, nil
 }
 
 // Multiplex implements dialer.Multiplexer interface.
@@ -12,6 +12,8 @@ type metadata struct {
 	maxIdleTimeout   time.Duration
 	handshakeTimeout time.Duration
 	maxStreams       int
+	// datagram enables the QUIC datagrams for relaying the UDP datagrams of the tunnel.
+	datagram bool
 
 	cipherKey []byte
 }
@@ -23,6 +25,7 @@ func (d *quicDialer) parseMetadata(md mdata.Metadata) (err error) {
 		handshakeTimeout = "handshakeTimeout"
 		maxIdleTimeout   = "maxIdleTimeout"
 		maxStreams       = "maxStreams"
+		datagram         = "tunnel.udp.datagram"
 
 		cipherKey = "cipherKey"
 	)
@@ -40,6 +43,7 @@ func (d *quicDialer) parseMetadata(md mdata.Metadata) (err error) {
 	d.md.handshakeTimeout = mdutil.GetDuration(md, handshakeTimeout)
 	d.md.maxIdleTimeout = mdutil.GetDuration(md, maxIdleTimeout)
 	d.md.maxStreams = mdutil.GetInt(md, maxStreams)
+	d.md.datagram = mdutil.GetBool(md, datagram)
 
 	return
 }
@@ -9,21 +9,34 @@ import (
 	"github.com/go-gost/core/handler"
 	"github.com/go-gost/core/logger"
 	md "github.com/go-gost/core/metadata"
+	mdutil "github.com/go-gost/core/metadata/util"
 	"github.com/go-gost/gosocks4"
 	"github.com/go-gost/gosocks5"
 	ctxvalue "github.com/go-gost/x/ctx"
 	netpkg "github.com/go-gost/x/internal/net"
+	xlogger "github.com/go-gost/x/logger"
+	mdx "github.com/go-gost/x/metadata"
 	"github.com/go-gost/x/registry"
 )
 
 func init() {
 	registry.HandlerRegistry().Register("auto", NewHandler)
+	// the metadata is passed to the http, socks4 and socks5 handlers as well.
+	mdx.RegisterSchemaFunc(mdx.SchemaHandler, "auto", func() mdx.Schema {
+		keys := append([]string{}, schema...)
+		for _, name := range []string{"http", "socks4", "socks5"} {
+			s, _ := mdx.GetSchema(mdx.SchemaHandler, name)
+			keys = append(keys, s...)
+		}
+		return keys
+	})
 }
 
 type autoHandler struct {
 	httpHandler   handler.Handler
 	socks4Handler handler.Handler
 	socks5Handler handler.Handler
+	maskIP        bool
 	options       handler.Options
 }
 
@@ -57,6 +70,8 @@ func NewHandler(opts ...handler.Option) handler.Handler {
 }
 
 func (h *autoHandler) Init(md md.Metadata) error {
+	h.maskIP = mdutil.GetBool(md, "maskIP")
+
 	if h.httpHandler != nil {
 		if err := h.httpHandler.Init(md); err != nil {
 			return err
@@ -82,6 +97,9 @@ func (h *autoHandler) Handle(ctx context.Context, conn net.Conn, opts ...handler
 		"local":  conn.LocalAddr().String(),
 		"sid":    ctxvalue.SidFromContext(ctx),
 	})
+	if h.maskIP {
+		log = xlogger.MaskIP(log, conn.RemoteAddr())
+	}
 
 	if log.IsLevelEnabled(logger.DebugLevel) {
 		start := time.Now()
@@ -118,3 +136,8 @@ func (h *autoHandler) Handle(ctx context.Context, conn net.Conn, opts ...handler
 	}
 	return nil
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"maskIP",
+}
@@ -17,6 +17,8 @@ import (
 	md "github.com/go-gost/core/metadata"
 	xhop "github.com/go-gost/x/hop"
 	resolver_util "github.com/go-gost/x/internal/util/resolver"
+	xlogger "github.com/go-gost/x/logger"
+	mdx "github.com/go-gost/x/metadata"
 	"github.com/go-gost/x/registry"
 	"github.com/go-gost/x/resolver/exchanger"
 	"github.com/miekg/dns"
@@ -28,6 +30,7 @@ const (
 
 func init() {
 	registry.HandlerRegistry().Register("dns", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "dns", schema...)
 }
 
 type dnsHandler struct {
@@ -124,6 +127,9 @@ func (h *dnsHandler) Handle(ctx context.Context, conn net.Conn, opts ...handler.
 		"remote": conn.RemoteAddr().String(),
 		"local":  conn.LocalAddr().String(),
 	})
+	if h.md.maskIP {
+		log = xlogger.MaskIP(log, conn.RemoteAddr())
+	}
 
 	log.Infof("%s <> %s", conn.RemoteAddr(), conn.LocalAddr())
 	defer func() {
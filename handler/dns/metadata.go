@@ -23,6 +23,7 @@ type metadata struct {
 	dns        []string
 	bufferSize int
 	async      bool
+	maskIP     bool
 }
 
 func (h *dnsHandler) parseMetadata(md mdata.Metadata) (err error) {
@@ -34,6 +35,7 @@ func (h *dnsHandler) parseMetadata(md mdata.Metadata) (err error) {
 		dns         = "dns"
 		bufferSize  = "bufferSize"
 		async       = "async"
+		maskIP      = "maskIP"
 	)
 
 	h.md.readTimeout = mdutil.GetDuration(md, readTimeout)
@@ -60,5 +62,18 @@ func (h *dnsHandler) parseMetadata(md mdata.Metadata) (err error) {
 	}
 	h.md.async = mdutil.GetBool(md, async)
 
+	h.md.maskIP = mdutil.GetBool(md, maskIP)
 	return
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"async",
+	"bufferSize",
+	"clientIP",
+	"dns",
+	"maskIP",
+	"readTimeout",
+	"timeout",
+	"ttl",
+}
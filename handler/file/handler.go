@@ -9,11 +9,13 @@ import (
 
 	"github.com/go-gost/core/handler"
 	md "github.com/go-gost/core/metadata"
+	mdx "github.com/go-gost/x/metadata"
 	"github.com/go-gost/x/registry"
 )
 
 func init() {
 	registry.HandlerRegistry().Register("file", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "file", schema...)
 }
 
 type fileHandler struct {
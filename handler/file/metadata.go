@@ -13,3 +13,9 @@ func (h *fileHandler) parseMetadata(md mdata.Metadata) (err error) {
 	h.md.dir = mdutil.GetString(md, "file.dir", "dir")
 	return
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"dir",
+	"file.dir",
+}
@@ -27,13 +27,18 @@ import (
 	xnet "github.com/go-gost/x/internal/net"
 	"github.com/go-gost/x/internal/util/forward"
 	tls_util "github.com/go-gost/x/internal/util/tls"
+	xlogger "github.com/go-gost/x/logger"
+	mdx "github.com/go-gost/x/metadata"
 	"github.com/go-gost/x/registry"
 )
 
 func init() {
 	registry.HandlerRegistry().Register("tcp", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "tcp", schema...)
 	registry.HandlerRegistry().Register("udp", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "udp", schema...)
 	registry.HandlerRegistry().Register("forward", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "forward", schema...)
 }
 
 type forwardHandler struct {
@@ -74,6 +79,9 @@ func (h *forwardHandler) Handle(ctx context.Context, conn net.Conn, opts ...hand
 		"remote": conn.RemoteAddr().String(),
 		"local":  conn.LocalAddr().String(),
 	})
+	if h.md.maskIP {
+		log = xlogger.MaskIP(log, conn.RemoteAddr())
+	}
 
 	log.Infof("%s <> %s", conn.RemoteAddr(), conn.LocalAddr())
 	defer func() {
@@ -94,7 +102,28 @@ func (h *forwardHandler) Handle(ctx context.Context, conn net.Conn, opts ...hand
 	var rw io.ReadWriter = conn
 	var host string
 	var protocol string
-	if network == "tcp" && h.md.sniffing {
+	// the target requested by the client to the listener, such as by the HTTP CONNECT,
+	// the connection carries the raw traffic to it, and the request is answered by reply.
+	var reply forward.Replier
+	if v, ok := conn.(md.Metadatable); ok && v.Metadata() != nil {
+		if target, _ := v.Metadata().Get(forward.MetadataKeyTarget).(string); target != "" {
+			host = target
+			log = log.WithFields(map[string]any{"target": target})
+			reply = forward.GetReplier(v.Metadata())
+
+			// the target is chosen by the client, it is only honored for the nodes of the hop
+			// or the allowed targets, otherwise the listener is an open proxy.
+			if h.hop == nil && (h.md.targetAllow == nil || !h.md.targetAllow.Match(target)) {
+				err := fmt.Errorf("%w: %s", forward.ErrTargetNotAllowed, target)
+				log.Warn(err)
+				if reply != nil {
+					reply(err)
+				}
+				return err
+			}
+		}
+	}
+	if network == "tcp" && h.md.sniffing && host == "" {
 		if h.md.sniffingTimeout > 0 {
 			conn.SetReadDeadline(time.Now().Add(h.md.sniffingTimeout))
 		}
@@ -129,6 +158,9 @@ func (h *forwardHandler) Handle(ctx context.Context, conn net.Conn, opts ...hand
 	if target == nil {
 		err := errors.New("target not available")
 		log.Error(err)
+		if reply != nil {
+			reply(err)
+		}
 		return err
 	}
 
@@ -160,6 +192,9 @@ func (h *forwardHandler) Handle(ctx context.Context, conn net.Conn, opts ...hand
 		if marker := target.Marker(); marker != nil {
 			marker.Mark()
 		}
+		if reply != nil {
+			reply(err)
+		}
 		return err
 	}
 	defer cc.Close()
@@ -167,6 +202,13 @@ func (h *forwardHandler) Handle(ctx context.Context, conn net.Conn, opts ...hand
 		marker.Reset()
 	}
 
+	if reply != nil {
+		if err := reply(nil); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
 	t := time.Now()
 	log.Infof("%s <-> %s", conn.RemoteAddr(), target.Addr)
 	xnet.Transport(rw, cc)
@@ -0,0 +1,71 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/go-gost/core/handler"
+	mdata "github.com/go-gost/core/metadata"
+	"github.com/go-gost/x/internal/util/forward"
+	xlogger "github.com/go-gost/x/logger"
+	xmd "github.com/go-gost/x/metadata"
+)
+
+type targetConn struct {
+	net.Conn
+	md mdata.Metadata
+}
+
+func (c *targetConn) Metadata() mdata.Metadata {
+	return c.md
+}
+
+func TestHandleTargetNotAllowed(t *testing.T) {
+	tests := []struct {
+		name   string
+		allow  []string
+		target string
+	}{
+		{name: "no allow list", target: "example.com:443"},
+		{name: "host not allowed", allow: []string{"example.org:443"}, target: "example.com:443"},
+		{name: "port not allowed", allow: []string{"example.com:80"}, target: "example.com:443"},
+		{name: "subdomain not allowed", allow: []string{"example.com"}, target: "www.example.com:443"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(handler.LoggerOption(xlogger.Nop()))
+			md := map[string]any{}
+			if tt.allow != nil {
+				md["target.allow"] = tt.allow
+			}
+			if err := h.Init(xmd.NewMetadata(md)); err != nil {
+				t.Fatal(err)
+			}
+
+			var replied error
+			client, server := net.Pipe()
+			defer client.Close()
+			conn := &targetConn{
+				Conn: server,
+				md: xmd.NewMetadata(map[string]any{
+					forward.MetadataKeyTarget: tt.target,
+					forward.MetadataKeyReply: forward.Replier(func(err error) error {
+						replied = err
+						return nil
+					}),
+				}),
+			}
+
+			err := h.Handle(context.Background(), conn)
+			if !errors.Is(err, forward.ErrTargetNotAllowed) {
+				t.Errorf("handle: got %v, want %v", err, forward.ErrTargetNotAllowed)
+			}
+			if !errors.Is(replied, forward.ErrTargetNotAllowed) {
+				t.Errorf("reply: got %v, want %v", replied, forward.ErrTargetNotAllowed)
+			}
+		})
+	}
+}
@@ -5,22 +5,40 @@ import (
 
 	mdata "github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/core/metadata/util"
+	"github.com/go-gost/x/internal/matcher"
 )
 
 type metadata struct {
 	readTimeout     time.Duration
 	sniffing        bool
 	sniffingTimeout time.Duration
+	maskIP          bool
+	// the targets requested by the clients to the listener allowed without the hop, such as by the HTTP CONNECT.
+	targetAllow matcher.Matcher
 }
 
 func (h *forwardHandler) parseMetadata(md mdata.Metadata) (err error) {
 	const (
 		readTimeout = "readTimeout"
 		sniffing    = "sniffing"
+		maskIP      = "maskIP"
 	)
 
 	h.md.readTimeout = mdutil.GetDuration(md, readTimeout)
 	h.md.sniffing = mdutil.GetBool(md, sniffing)
 	h.md.sniffingTimeout = mdutil.GetDuration(md, "sniffing.timeout")
+	h.md.maskIP = mdutil.GetBool(md, maskIP)
+	if v := mdutil.GetStrings(md, "target.allow"); len(v) > 0 {
+		h.md.targetAllow = matcher.AddrMatcher(v)
+	}
 	return
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"maskIP",
+	"readTimeout",
+	"sniffing",
+	"sniffing.timeout",
+	"target.allow",
+}
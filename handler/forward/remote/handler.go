@@ -29,12 +29,16 @@ import (
 	"github.com/go-gost/x/internal/net/proxyproto"
 	"github.com/go-gost/x/internal/util/forward"
 	tls_util "github.com/go-gost/x/internal/util/tls"
+	xlogger "github.com/go-gost/x/logger"
+	mdx "github.com/go-gost/x/metadata"
 	"github.com/go-gost/x/registry"
 )
 
 func init() {
 	registry.HandlerRegistry().Register("rtcp", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "rtcp", schema...)
 	registry.HandlerRegistry().Register("rudp", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "rudp", schema...)
 }
 
 type forwardHandler struct {
@@ -75,6 +79,9 @@ func (h *forwardHandler) Handle(ctx context.Context, conn net.Conn, opts ...hand
 		"remote": conn.RemoteAddr().String(),
 		"local":  conn.LocalAddr().String(),
 	})
+	if h.md.maskIP {
+		log = xlogger.MaskIP(log, conn.RemoteAddr())
+	}
 
 	log.Infof("%s <> %s", conn.RemoteAddr(), conn.LocalAddr())
 	defer func() {
@@ -12,6 +12,7 @@ type metadata struct {
 	sniffing        bool
 	sniffingTimeout time.Duration
 	proxyProtocol   int
+	maskIP          bool
 }
 
 func (h *forwardHandler) parseMetadata(md mdata.Metadata) (err error) {
@@ -19,11 +20,23 @@ func (h *forwardHandler) parseMetadata(md mdata.Metadata) (err error) {
 		readTimeout   = "readTimeout"
 		sniffing      = "sniffing"
 		proxyProtocol = "proxyProtocol"
+		maskIP        = "maskIP"
 	)
 
 	h.md.readTimeout = mdutil.GetDuration(md, readTimeout)
 	h.md.sniffing = mdutil.GetBool(md, sniffing)
 	h.md.sniffingTimeout = mdutil.GetDuration(md, "sniffing.timeout")
 	h.md.proxyProtocol = mdutil.GetInt(md, proxyProtocol)
+	h.md.maskIP = mdutil.GetBool(md, maskIP)
 	return
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"host",
+	"maskIP",
+	"proxyProtocol",
+	"readTimeout",
+	"sniffing",
+	"sniffing.timeout",
+}
@@ -29,13 +29,17 @@ import (
 	netpkg "github.com/go-gost/x/internal/net"
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	stats_util "github.com/go-gost/x/internal/util/stats"
+	tls_util "github.com/go-gost/x/internal/util/tls"
 	traffic_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	xlogger "github.com/go-gost/x/logger"
+	mdx "github.com/go-gost/x/metadata"
 	stats_wrapper "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
 )
 
 func init() {
 	registry.HandlerRegistry().Register("http", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "http", schema...)
 }
 
 type httpHandler struct {
@@ -80,6 +84,10 @@ func (h *httpHandler) Init(md md.Metadata) error {
 func (h *httpHandler) Handle(ctx context.Context, conn net.Conn, opts ...handler.HandleOption) error {
 	defer conn.Close()
 
+	if h.md.resolver != nil {
+		ctx = ctxvalue.ContextWithResolver(ctx, h.md.resolver)
+	}
+
 	// ctx = sx.ContextWithHash(ctx, &sx.Hash{})
 
 	start := time.Now()
@@ -88,6 +96,9 @@ func (h *httpHandler) Handle(ctx context.Context, conn net.Conn, opts ...handler
 		"local":  conn.LocalAddr().String(),
 		"sid":    ctxvalue.SidFromContext(ctx),
 	})
+	if h.md.maskIP {
+		log = xlogger.MaskIP(log, conn.RemoteAddr())
+	}
 	log.Infof("%s <> %s", conn.RemoteAddr(), conn.LocalAddr())
 	defer func() {
 		log.WithFields(map[string]any{
@@ -179,6 +190,10 @@ func (h *httpHandler) handleRequest(ctx context.Context, conn net.Conn, req *htt
 	if !ok {
 		return nil
 	}
+	if clientID == "" {
+		// the client ID from the certificate verified by the TLS listener.
+		clientID = tls_util.ClientID(conn)
+	}
 	ctx = ctxvalue.ContextWithClientID(ctx, ctxvalue.ClientID(clientID))
 
 	if h.options.Bypass != nil && h.options.Bypass.Contains(ctx, network, addr) {
@@ -229,16 +244,20 @@ func (h *httpHandler) handleRequest(ctx context.Context, conn net.Conn, req *htt
 	}
 	defer cc.Close()
 
-	rw := traffic_wrapper.WrapReadWriter(
+	rw := traffic_wrapper.WrapReadWriterScopes(
 		h.limiter,
 		conn,
-		clientID,
-		limiter.ScopeOption(limiter.ScopeClient),
-		limiter.ServiceOption(h.options.Service),
-		limiter.NetworkOption(network),
-		limiter.AddrOption(addr),
-		limiter.ClientOption(clientID),
-		limiter.SrcOption(conn.RemoteAddr().String()),
+		traffic_wrapper.Scope{
+			Key: clientID,
+			Opts: []limiter.Option{
+				limiter.ScopeOption(limiter.ScopeClient),
+				limiter.ServiceOption(h.options.Service),
+				limiter.NetworkOption(network),
+				limiter.AddrOption(addr),
+				limiter.ClientOption(clientID),
+				limiter.SrcOption(conn.RemoteAddr().String()),
+			},
+		},
 	)
 	if h.options.Observer != nil {
 		pstats := h.stats.Stats(clientID)
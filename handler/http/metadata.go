@@ -7,6 +7,8 @@ import (
 
 	mdata "github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/core/metadata/util"
+	"github.com/go-gost/core/resolver"
+	"github.com/go-gost/x/registry"
 )
 
 const (
@@ -22,6 +24,8 @@ type metadata struct {
 	authBasicRealm  string
 	observePeriod   time.Duration
 	proxyAgent      string
+	resolver        resolver.Resolver
+	maskIP          bool
 }
 
 func (h *httpHandler) parseMetadata(md mdata.Metadata) error {
@@ -53,6 +57,9 @@ func (h *httpHandler) parseMetadata(md mdata.Metadata) error {
 		h.md.proxyAgent = defaultProxyAgent
 	}
 
+	h.md.resolver = registry.ResolverRegistry().Get(mdutil.GetString(md, "resolver"))
+
+	h.md.maskIP = mdutil.GetBool(md, "maskIP")
 	return nil
 }
 
@@ -61,3 +68,20 @@ type probeResistance struct {
 	Value string
 	Knock string
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"authBasicRealm",
+	"hash",
+	"header",
+	"http.header",
+	"http.proxyAgent",
+	"knock",
+	"maskIP",
+	"observePeriod",
+	"probe_resist",
+	"probeResist",
+	"proxyAgent",
+	"resolver",
+	"udp",
+}
@@ -0,0 +1,216 @@
+package http2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/logger"
+)
+
+const (
+	defaultExtAuthTimeout = 5 * time.Second
+	// the header in the response of the external auth service carrying the client ID.
+	extAuthClientIDHeader = "X-Gost-Client-Id"
+)
+
+// extAuther authenticates the proxy request by an external HTTP service.
+//
+// The original proxy credentials and the specified headers of the request are passed to the service,
+// the request is allowed only if the service responds with status code 200.
+type extAuther struct {
+	url     string
+	timeout time.Duration
+	headers []string
+	client  *http.Client
+	cache   *authCache
+	log     logger.Logger
+}
+
+// newExtAuther creates an extAuther, the decisions of the service are cached
+// for ttl if allowed, or negativeTTL if denied. Zero TTL disables the caching.
+func newExtAuther(url string, timeout time.Duration, headers []string, ttl, negativeTTL time.Duration, log logger.Logger) *extAuther {
+	if timeout <= 0 {
+		timeout = defaultExtAuthTimeout
+	}
+	p := &extAuther{
+		url:     url,
+		timeout: timeout,
+		headers: headers,
+		client:  &http.Client{Timeout: timeout},
+		log:     log,
+	}
+	if ttl > 0 || negativeTTL > 0 {
+		p.cache = newAuthCache(ttl, negativeTTL)
+	}
+	return p
+}
+
+func (p *extAuther) Authenticate(ctx context.Context, r *http.Request) (id string, ok bool) {
+	if p.cache == nil {
+		id, ok, _ = p.authenticate(ctx, r)
+		return
+	}
+
+	key := p.cacheKey(r)
+	if d, found := p.cache.Load(key); found {
+		p.log.Debugf("external auth cache hit: id=%s, ok=%v", d.id, d.ok)
+		return d.id, d.ok
+	}
+
+	id, ok, err := p.authenticate(ctx, r)
+	if err != nil {
+		// the service is unavailable, do not cache the failure.
+		return
+	}
+	p.cache.Store(key, id, ok)
+	return
+}
+
+// cacheKey generates the cache key from all the inputs of the request passed to the service,
+// so the decision for one client or target is never replayed for another.
+func (p *extAuther) cacheKey(r *http.Request) string {
+	header := p.header(r)
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		for _, v := range header[k] {
+			h.Write([]byte{0})
+			h.Write([]byte(v))
+		}
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// header returns the headers of the request to the service,
+// the credentials, the passthrough headers and the client, target and method of the proxy request.
+func (p *extAuther) header(r *http.Request) http.Header {
+	header := http.Header{}
+	if v := r.Header.Get("Proxy-Authorization"); v != "" {
+		header.Set("Authorization", v)
+	}
+	for _, k := range p.headers {
+		for _, v := range r.Header.Values(k) {
+			header.Add(k, v)
+		}
+	}
+	if host, _, _ := net.SplitHostPort(r.RemoteAddr); host != "" {
+		header.Set("X-Forwarded-For", host)
+	}
+	header.Set("X-Forwarded-Host", r.Host)
+	header.Set("X-Forwarded-Method", r.Method)
+	return header
+}
+
+func (p *extAuther) authenticate(ctx context.Context, r *http.Request) (id string, ok bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		p.log.Error(err)
+		return
+	}
+	req.Header = p.header(r)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		p.log.Errorf("external auth: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		p.log.Debugf("external auth: %s", resp.Status)
+		return
+	}
+
+	return resp.Header.Get(extAuthClientIDHeader), true, nil
+}
+
+type authDecision struct {
+	id      string
+	ok      bool
+	expires time.Time
+}
+
+// authCache caches the decisions of the external auth service.
+type authCache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	m           sync.Map
+	mu          sync.Mutex
+	lastSweep   time.Time
+}
+
+func newAuthCache(ttl, negativeTTL time.Duration) *authCache {
+	return &authCache{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		lastSweep:   time.Now(),
+	}
+}
+
+func (c *authCache) Load(key string) (d *authDecision, ok bool) {
+	v, found := c.m.Load(key)
+	if !found {
+		return
+	}
+	d = v.(*authDecision)
+	if time.Now().After(d.expires) {
+		c.m.CompareAndDelete(key, v)
+		return nil, false
+	}
+	return d, true
+}
+
+func (c *authCache) Store(key string, id string, ok bool) {
+	ttl := c.ttl
+	if !ok {
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+	c.m.Store(key, &authDecision{
+		id:      id,
+		ok:      ok,
+		expires: now.Add(ttl),
+	})
+	c.sweep(now)
+}
+
+// sweep removes the expired decisions periodically,
+// so that the cache does not grow with the rejected credentials.
+func (c *authCache) sweep(now time.Time) {
+	interval := max(c.ttl, c.negativeTTL)
+
+	c.mu.Lock()
+	if now.Sub(c.lastSweep) < interval {
+		c.mu.Unlock()
+		return
+	}
+	c.lastSweep = now
+	c.mu.Unlock()
+
+	c.m.Range(func(key, value any) bool {
+		if now.After(value.(*authDecision).expires) {
+			c.m.CompareAndDelete(key, value)
+		}
+		return true
+	})
+}
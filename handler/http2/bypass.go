@@ -0,0 +1,84 @@
+package http2
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-gost/core/logger"
+	mdata "github.com/go-gost/core/metadata"
+	mdutil "github.com/go-gost/core/metadata/util"
+)
+
+// bypassPage is the page served with the 403 status to the requests denied by the bypass.
+//
+// The page is specified by the metadata bypass.page in the form of type:value, the type can be:
+//
+//	text - the value is an inline plain text body.
+//	html - the value is an inline HTML body.
+//	file - the value is a file path, it is loaded in the same way as the probe resistance file.
+type bypassPage struct {
+	Type  string
+	Value string
+	// Template enables the html/template rendering of the page in file mode.
+	Template bool
+}
+
+func parseBypassPage(md mdata.Metadata) *bypassPage {
+	v := mdutil.GetString(md, "bypass.page")
+	if v == "" {
+		return nil
+	}
+	ss := strings.SplitN(v, ":", 2)
+	if len(ss) != 2 {
+		return nil
+	}
+	return &bypassPage{
+		Type:     ss[0],
+		Value:    ss[1],
+		Template: mdutil.GetBool(md, "bypass.template"),
+	}
+}
+
+// writeForbidden writes the 403 response to the request denied by the bypass,
+// the bare 403 is written if the page is not configured or fails to load.
+func (h *http2Handler) writeForbidden(w http.ResponseWriter, r *http.Request, log logger.Logger) {
+	page := h.md.bypassPage
+	if page == nil {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	resp := &http.Response{
+		Header: http.Header{},
+		Body:   http.NoBody,
+	}
+	switch page.Type {
+	case "text", "html":
+		contentType := "text/plain; charset=utf-8"
+		if page.Type == "html" {
+			contentType = "text/html; charset=utf-8"
+		}
+		resp.Header.Set("Content-Type", contentType)
+		resp.Body = io.NopCloser(strings.NewReader(page.Value))
+	case "file":
+		pr := &probeResistance{
+			Type:     page.Type,
+			Value:    page.Value,
+			Template: page.Template,
+		}
+		if err := pr.serveFile(r, resp); err != nil {
+			log.Errorf("bypass page: %v", err)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		defer resp.Body.Close()
+	default:
+		log.Warnf("bypass page: unknown type %s", page.Type)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	resp.StatusCode = http.StatusForbidden
+
+	h.writeResponse(w, resp)
+}
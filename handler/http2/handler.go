@@ -10,40 +10,87 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"net/http/httputil"
-	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/go-gost/core/auth"
+	"github.com/go-gost/core/bypass"
 	"github.com/go-gost/core/handler"
 	"github.com/go-gost/core/limiter"
 	"github.com/go-gost/core/limiter/traffic"
 	"github.com/go-gost/core/logger"
 	md "github.com/go-gost/core/metadata"
+	"github.com/go-gost/core/metrics"
 	"github.com/go-gost/core/observer/stats"
 	ctxvalue "github.com/go-gost/x/ctx"
+	"github.com/go-gost/x/interceptor"
 	xio "github.com/go-gost/x/internal/io"
 	netpkg "github.com/go-gost/x/internal/net"
-	limiter_util "github.com/go-gost/x/internal/util/limiter"
+	"github.com/go-gost/x/internal/net/proxyproto"
+	"github.com/go-gost/x/internal/util/billing"
+	bypass_util "github.com/go-gost/x/internal/util/bypass"
+	"github.com/go-gost/x/internal/util/connpool"
+	"github.com/go-gost/x/internal/util/conntrack"
+	"github.com/go-gost/x/internal/util/drain"
+	"github.com/go-gost/x/internal/util/forward"
+	"github.com/go-gost/x/internal/util/hotswap"
+	http_util "github.com/go-gost/x/internal/util/http"
+	"github.com/go-gost/x/internal/util/quota"
+	resolver_util "github.com/go-gost/x/internal/util/resolver"
 	stats_util "github.com/go-gost/x/internal/util/stats"
 	traffic_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	xlogger "github.com/go-gost/x/logger"
+	mdx "github.com/go-gost/x/metadata"
+	xmetrics "github.com/go-gost/x/metrics"
+	"github.com/go-gost/x/observer/event"
 	stats_wrapper "github.com/go-gost/x/observer/stats/wrapper"
+	xrecorder "github.com/go-gost/x/recorder"
 	"github.com/go-gost/x/registry"
+	"github.com/go-gost/x/tracing"
+)
+
+var (
+	ErrHostTooLong = errors.New("host too long")
+	ErrInvalidHost = errors.New("invalid host")
+	ErrTooManyHops = errors.New("too many hops")
+	ErrBypass      = errors.New("bypass")
+	// ErrBypassDropped aborts the request matched by the bypass without any response.
+	ErrBypassDropped = errors.New("bypass: dropped")
+)
+
+const (
+	// the maximum number of the names in the target header.
+	maxTargetHops = 16
 )
 
 func init() {
 	registry.HandlerRegistry().Register("http2", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "http2", schema...)
 }
 
 type http2Handler struct {
 	md      metadata
 	options handler.Options
 	stats   *stats_util.HandlerStats
-	limiter traffic.TrafficLimiter
-	cancel  context.CancelFunc
+	extAuth *extAuther
+	// the auther, bypass and limiter swappable by UpdateOptions.
+	live hotswap.Value
+	// probe resistance can be replaced by Reload at runtime.
+	probeResist atomic.Pointer[probeResistance]
+	cancel      context.CancelFunc
+	tracker     drain.Tracker
+	tracer      *tracing.Tracer
+	connPool    *connpool.Pool
+	events      *event.ConnEmitter
+	billing     *billing.Biller
+	// the client fetching the decoy page of the web probe resistance.
+	webClient *http.Client
 }
 
 func NewHandler(opts ...handler.Option) handler.Handler {
@@ -61,6 +108,7 @@ func (h *http2Handler) Init(md md.Metadata) error {
 	if err := h.parseMetadata(md); err != nil {
 		return err
 	}
+	h.probeResist.Store(h.md.probeResistance)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	h.cancel = cancel
@@ -70,21 +118,72 @@ func (h *http2Handler) Init(md md.Metadata) error {
 		go h.observeStats(ctx)
 	}
 
-	if limiter := h.options.Limiter; limiter != nil {
-		h.limiter = limiter_util.NewCachedTrafficLimiter(limiter, 30*time.Second, 60*time.Second)
+	if h.md.tracing {
+		h.tracer = tracing.NewTracer(h.options.Service, h.options.Logger)
+	}
+
+	if h.md.connPool != nil {
+		h.connPool = connpool.New(*h.md.connPool)
+	}
+
+	h.webClient = &http.Client{
+		Transport: h.md.upstreamTLS.Transport(),
+	}
+
+	if h.md.connEvents {
+		h.events = event.NewConnEmitter(h.options.Observer, h.options.Service, h.md.connEventsOpts)
+	}
+
+	if opts := h.options.Router.Options(); opts != nil {
+		for _, ro := range opts.Recorders {
+			if ro.Record == xrecorder.RecorderServiceHandlerBilling {
+				bopts := h.md.billingOpts
+				bopts.Logger = h.options.Logger
+				h.billing = billing.New(h.options.Service, ro.Recorder, bopts)
+				break
+			}
+		}
+	}
+
+	h.live.Store(&h.options)
+
+	if h.md.authURL != "" {
+		h.extAuth = newExtAuther(h.md.authURL, h.md.authTimeout, h.md.authHeaders,
+			h.md.authCacheTTL, h.md.authNegCacheTTL,
+			h.options.Logger.WithFields(map[string]any{
+				"kind": "auther",
+			}))
+	}
+	if h.md.requireAuth && h.extAuth == nil && h.options.Auther == nil {
+		h.options.Logger.Warn("requireAuth is set but no auther, all the requests are refused")
 	}
 
 	return nil
 }
 
-func (h *http2Handler) Handle(ctx context.Context, conn net.Conn, opts ...handler.HandleOption) error {
+func (h *http2Handler) Handle(ctx context.Context, conn net.Conn, opts ...handler.HandleOption) (err error) {
 	defer conn.Close()
 
+	if h.md.resolver != nil {
+		ctx = ctxvalue.ContextWithResolver(ctx, h.md.resolver)
+	}
+	if h.md.dnsCache != nil {
+		ctx = resolver_util.ContextWithLookupCache(ctx, h.md.dnsCache)
+	}
+
+	if !h.tracker.Add(conn) {
+		return drain.ErrDraining
+	}
+	defer h.tracker.Remove(conn)
+
 	start := time.Now()
 	log := h.options.Logger.WithFields(map[string]any{
 		"remote": conn.RemoteAddr().String(),
 		"local":  conn.LocalAddr().String(),
 	})
+	if h.md.maskIP {
+		log = xlogger.MaskIP(log, conn.RemoteAddr())
+	}
 	log.Infof("%s <> %s", conn.RemoteAddr(), conn.LocalAddr())
 	defer func() {
 		log.WithFields(map[string]any{
@@ -92,10 +191,6 @@ func (h *http2Handler) Handle(ctx context.Context, conn net.Conn, opts ...handle
 		}).Infof("%s >< %s", conn.RemoteAddr(), conn.LocalAddr())
 	}()
 
-	if !h.checkRateLimit(conn.RemoteAddr()) {
-		return nil
-	}
-
 	v, ok := conn.(md.Metadatable)
 	if !ok || v == nil {
 		err := errors.New("wrong connection type")
@@ -104,39 +199,130 @@ func (h *http2Handler) Handle(ctx context.Context, conn net.Conn, opts ...handle
 	}
 
 	md := v.Metadata()
-	return h.roundTrip(ctx,
-		md.Get("w").(http.ResponseWriter),
-		md.Get("r").(*http.Request),
-		log,
-	)
+	w := md.Get("w").(http.ResponseWriter)
+	r := md.Get("r").(*http.Request)
+
+	trace := h.events.Trace(conn.RemoteAddr().String())
+	defer func() { trace.Closed(err) }()
+	ctx = event.ContextWithConnTrace(ctx, trace)
+
+	if !h.checkRateLimit(conn.RemoteAddr()) {
+		trace.Denied("rateLimit")
+		log.Debug("rate limiting exceeded")
+		w.Header().Set("Retry-After", strconv.Itoa(h.retryAfter(conn.RemoteAddr())))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return nil
+	}
+
+	if h.md.proxyProtocol > 0 {
+		ctx = context.WithValue(ctx, connAddrsKey{}, connAddrs{
+			src: conn.RemoteAddr(),
+			dst: conn.LocalAddr(),
+		})
+	}
+
+	if h.tracer != nil {
+		// the request may be a part of a trace started by the client.
+		ctx = tracing.Extract(ctx, r.Header)
+		var span *tracing.Span
+		ctx, span = h.tracer.Start(ctx, "http2.request")
+		span.SetAttribute("remote", conn.RemoteAddr().String())
+		span.SetAttribute("method", r.Method)
+		log = log.WithFields(span.Fields())
+
+		err := h.roundTrip(ctx, w, r, log)
+		span.Finish(err)
+		return h.abort(md, err)
+	}
+
+	return h.abort(md, h.roundTrip(ctx, w, r, log))
+}
+
+// abort makes the listener abort the request without any response if err is ErrBypassDropped.
+func (h *http2Handler) abort(m md.Metadata, err error) error {
+	if err != ErrBypassDropped {
+		return err
+	}
+	m.Set("abort", true)
+	return nil
+}
+
+// Reload implements the service.Reloader interface,
+// it updates the probe resistance configuration of the handler without restarting it.
+func (h *http2Handler) Reload(md md.Metadata) error {
+	h.probeResist.Store(parseProbeResistance(md))
+	return nil
+}
+
+// ReloadableKeys implements the service.Reloader interface.
+func (h *http2Handler) ReloadableKeys() []string {
+	return probeResistKeys
+}
+
+// UpdateOptions implements the service.OptionsUpdater interface,
+// it swaps the auther, bypass and limiter used by the new connections,
+// the established connections are not affected.
+func (h *http2Handler) UpdateOptions(opts ...handler.Option) error {
+	h.live.Update(opts...)
+	return nil
+}
+
+// Drain implements the service.Drainer interface,
+// it rejects new connections and waits for the active connections to finish.
+func (h *http2Handler) Drain(ctx context.Context) (forced int, err error) {
+	return h.tracker.Drain(ctx)
 }
 
 func (h *http2Handler) Close() error {
 	if h.cancel != nil {
 		h.cancel()
 	}
+	h.connPool.Close()
+	if h.webClient != nil {
+		h.webClient.CloseIdleConnections()
+	}
+	h.events.Close()
+	h.billing.Close()
 	return nil
 }
 
 // NOTE: there is an issue (golang/go#43989) will cause the client hangs
 // when server returns an non-200 status code,
 // May be fixed in go1.18.
-func (h *http2Handler) roundTrip(ctx context.Context, w http.ResponseWriter, req *http.Request, log logger.Logger) error {
+func (h *http2Handler) roundTrip(ctx context.Context, w http.ResponseWriter, req *http.Request, log logger.Logger) (err error) {
+	// the auther, bypass and limiter of the request are loaded once,
+	// so a swap by UpdateOptions never mixes the old and new options in one request.
+	live := h.live.Load()
+
 	// Try to get the actual host.
 	// Compatible with GOST 2.x.
-	if v := req.Header.Get("Gost-Target"); v != "" {
-		if h, err := h.decodeServerName(v); err == nil {
-			req.Host = h
+	// The target may be a comma-separated list of the encoded names for multi-hop chains,
+	// the first one is the dial target.
+	var hops []string
+	for _, k := range []string{"Gost-Target", "X-Gost-Target"} {
+		if v := req.Header.Values(k); len(v) > 0 {
+			names, err := h.decodeServerNames(v, log)
+			if err != nil {
+				log.Warnf("%s: %v", k, err)
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return err
+			}
+			req.Host = names[0]
+			hops = names
 		}
+		req.Header.Del(k)
+	}
+	if len(hops) > 1 {
+		log = log.WithFields(map[string]any{
+			"hops": strings.Join(hops, ","),
+		})
 	}
-	req.Header.Del("Gost-Target")
 
-	if v := req.Header.Get("X-Gost-Target"); v != "" {
-		if h, err := h.decodeServerName(v); err == nil {
-			req.Host = h
-		}
+	if err := h.checkHost(req.Host); err != nil {
+		log.Warnf("host %.64q: %v", req.Host, err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return err
 	}
-	req.Header.Del("X-Gost-Target")
 
 	addr := req.Host
 	if _, port, _ := net.SplitHostPort(addr); port == "" {
@@ -168,34 +354,127 @@ func (h *http2Handler) roundTrip(ctx context.Context, w http.ResponseWriter, req
 		Body:       io.NopCloser(bytes.NewReader([]byte{})),
 	}
 
-	clientID, ok := h.authenticate(ctx, w, req, resp, log)
+	trace := event.ConnTraceFromContext(ctx)
+	clientID, ok := h.authenticate(ctx, w, req, resp, live.Auther, log)
 	if !ok {
+		trace.Denied("auth")
 		return nil
 	}
+	trace.Authenticated(clientID)
+	if err := h.md.schedule.Check(clientID); err != nil {
+		trace.Denied("schedule")
+		log.Warn(err)
+		h.writeAuthRequired(w, req, resp, log)
+		return err
+	}
 	ctx = ctxvalue.ContextWithClientID(ctx, ctxvalue.ClientID(clientID))
 
-	if h.options.Bypass != nil && h.options.Bypass.Contains(ctx, "tcp", addr) {
-		w.WriteHeader(http.StatusForbidden)
+	ireq := &interceptor.Request{
+		Service:  h.options.Service,
+		Handler:  "http2",
+		Network:  "tcp",
+		Src:      req.RemoteAddr,
+		Dst:      addr,
+		ClientID: clientID,
+	}
+	after, err := h.md.interceptors.Before(ctx, ireq)
+	if err != nil {
+		trace.Denied("interceptor")
+		log.Warn(err)
+		h.writeForbidden(w, req, log)
+		return err
+	}
+	defer func() { after(err) }()
+	if len(ireq.Annotations) > 0 {
+		log = log.WithFields(ireq.Annotations)
+	}
+
+	if err := h.md.ports.Check(addr); err != nil {
+		trace.Denied("ports")
+		log.Warn(err)
+		h.writeForbidden(w, req, log)
+		return err
+	}
+
+	var sinkhole *bypass_util.Action
+	if bp := live.Bypass; bp != nil && bp.Contains(ctx, "tcp", addr) {
+		action := h.md.bypassAction
+		action.Observe(h.options.Service)
+		log = log.WithFields(map[string]any{"bypass": action.Type})
 		log.Debug("bypass: ", addr)
-		return nil
+
+		switch action.Type {
+		case bypass_util.ActionDrop:
+			trace.Denied("bypass")
+			return ErrBypassDropped
+		case bypass_util.ActionSinkhole:
+			sinkhole = action
+		default:
+			trace.Denied("bypass")
+			h.writeForbidden(w, req, log)
+			return nil
+		}
+	}
+
+	if err := h.md.quota.Check(ctx, clientID); err != nil {
+		trace.Denied("quota")
+		log.Warnf("client %s: %v", clientID, err)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return err
 	}
+	trace.Opened(addr)
 
-	// delete the proxy related headers.
-	req.Header.Del("Proxy-Authorization")
-	req.Header.Del("Proxy-Connection")
+	// delete the hop-by-hop headers, the proxy related headers are included.
+	http_util.RemoveHopHeaders(req.Header, h.md.hopHeaders...)
 
 	switch h.md.hash {
 	case "host":
 		ctx = ctxvalue.ContextWithHash(ctx, &ctxvalue.Hash{Source: addr})
+	case "client":
+		if clientID != "" {
+			ctx = ctxvalue.ContextWithHash(ctx, &ctxvalue.Hash{Source: clientID})
+		}
+	case "src":
+		if host, _, _ := net.SplitHostPort(req.RemoteAddr); host != "" {
+			ctx = ctxvalue.ContextWithHash(ctx, &ctxvalue.Hash{Source: host})
+		}
+	case "header":
+		if v := req.Header.Get(h.md.hashHeader); v != "" {
+			ctx = ctxvalue.ContextWithHash(ctx, &ctxvalue.Hash{Source: v})
+		}
 	}
 
-	cc, err := h.options.Router.Dial(ctx, "tcp", addr)
-	if err != nil {
-		log.Error(err)
-		w.WriteHeader(http.StatusServiceUnavailable)
-		return err
+	// the plain HTTP requests reuse the pooled upstream connections.
+	// The anonymous clients are not pooled as they are indistinguishable from each other,
+	// neither with the PROXY protocol, as the header sent on the connection carries the first client.
+	if h.connPool != nil && req.Method != http.MethodConnect && sinkhole == nil &&
+		clientID != "" && h.md.proxyProtocol == 0 {
+		var rt *route
+		rt, log = h.route(addr, log)
+		return h.forwardPooled(ctx, w, req, rt, addr, clientID, live.Limiter, log)
+	}
+
+	// with the SNI sniffing, the CONNECT is established before dialing,
+	// as the ClientHello is sent by the client only after that.
+	sniffing := h.md.sniSniffing && req.Method == http.MethodConnect && sinkhole == nil
+
+	var cc net.Conn
+	if !sniffing {
+		var err error
+		if sinkhole != nil {
+			cc, err = sinkhole.Dial(ctx, "tcp")
+		} else {
+			var rt *route
+			rt, log = h.route(addr, log)
+			cc, err = h.dial(ctx, rt, addr)
+		}
+		if err != nil {
+			log.Error(err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return err
+		}
+		defer cc.Close()
 	}
-	defer cc.Close()
 
 	if req.Method == http.MethodConnect {
 		w.WriteHeader(http.StatusOK)
@@ -214,9 +493,51 @@ func (h *http2Handler) roundTrip(ctx context.Context, w http.ResponseWriter, req
 			}
 			defer conn.Close()
 
+			rw := trace.WrapReadWriter(conn)
+			if sniffing {
+				ctx, rw, addr, err = h.sniffSNI(ctx, rw, conn.SetReadDeadline, addr, live.Bypass, log)
+				if err != nil {
+					return err
+				}
+				if sni := ctxvalue.SNIFromContext(ctx); sni != "" {
+					log = log.WithFields(map[string]any{
+						"dst": addr,
+						"sni": sni,
+					})
+				}
+				var rt *route
+				rt, log = h.route(addr, log)
+				if cc, err = h.dial(ctx, rt, addr); err != nil {
+					log.Error(err)
+					return err
+				}
+				defer cc.Close()
+			}
+
+			rw, done := h.wrapTraffic(rw, live.Limiter, clientID, limitAddr(ctx, addr), req.RemoteAddr)
+			defer done()
+			counter := h.md.quota.Counter(ctx, clientID)
+			defer counter.Close()
+			if counter != nil {
+				rw = traffic_wrapper.WrapQuotaReadWriter(rw, counter)
+			}
+
+			tc := conntrack.Track(h.options.Service, clientID, conn.RemoteAddr().String(), addr, log, conn, cc)
+			defer tc.Untrack()
+
+			defer h.md.schedule.Watch(clientID, conn, cc)()
+
 			start := time.Now()
 			log.Infof("%s <-> %s", conn.RemoteAddr(), addr)
-			netpkg.Transport(conn, cc)
+			_, tspan := h.tracer.Start(ctx, "transfer")
+			err = netpkg.TransportWithIdleTimeout(tc.WrapReadWriter(rw), cc, h.md.idleTimeout)
+			tspan.Finish(err)
+			if err == netpkg.ErrIdleTimeout {
+				log.Debugf("%s >-< %s: %v", conn.RemoteAddr(), addr, err)
+			}
+			if quota.IsExceeded(err) {
+				log.Warnf("%s >-< %s: client %s: %v", conn.RemoteAddr(), addr, clientID, err)
+			}
 			log.WithFields(map[string]any{
 				"duration": time.Since(start),
 			}).Infof("%s >-< %s", conn.RemoteAddr(), addr)
@@ -224,56 +545,277 @@ func (h *http2Handler) roundTrip(ctx context.Context, w http.ResponseWriter, req
 			return nil
 		}
 
-		rw := traffic_wrapper.WrapReadWriter(
-			h.limiter,
-			xio.NewReadWriter(req.Body, flushWriter{w}),
-			clientID,
-			limiter.ScopeOption(limiter.ScopeClient),
-			limiter.ServiceOption(h.options.Service),
-			limiter.NetworkOption("tcp"),
-			limiter.AddrOption(addr),
-			limiter.ClientOption(clientID),
-			limiter.SrcOption(req.RemoteAddr),
-		)
-		if h.options.Observer != nil {
-			pstats := h.stats.Stats(clientID)
-			pstats.Add(stats.KindTotalConns, 1)
-			pstats.Add(stats.KindCurrentConns, 1)
-			defer pstats.Add(stats.KindCurrentConns, -1)
-			rw = stats_wrapper.WrapReadWriter(rw, pstats)
+		fw := http_util.NewFlushWriter(w, h.md.flush)
+		defer fw.Close()
+
+		rw := trace.WrapReadWriter(xio.NewReadWriter(req.Body, fw))
+		if sniffing {
+			var err error
+			ctx, rw, addr, err = h.sniffSNI(ctx, rw, http.NewResponseController(w).SetReadDeadline, addr, live.Bypass, log)
+			if err != nil {
+				return err
+			}
+			if sni := ctxvalue.SNIFromContext(ctx); sni != "" {
+				log = log.WithFields(map[string]any{
+					"dst": addr,
+					"sni": sni,
+				})
+			}
+			var rt *route
+			rt, log = h.route(addr, log)
+			if cc, err = h.dial(ctx, rt, addr); err != nil {
+				log.Error(err)
+				return err
+			}
+			defer cc.Close()
 		}
 
+		rw, done := h.wrapTraffic(rw, live.Limiter, clientID, limitAddr(ctx, addr), req.RemoteAddr)
+		defer done()
+		counter := h.md.quota.Counter(ctx, clientID)
+		defer counter.Close()
+		if counter != nil {
+			rw = traffic_wrapper.WrapQuotaReadWriter(rw, counter)
+		}
+
+		tc := conntrack.Track(h.options.Service, clientID, req.RemoteAddr, addr, log, cc)
+		defer tc.Untrack()
+		rw = tc.WrapReadWriter(rw)
+
+		defer h.md.schedule.Watch(clientID, cc)()
+
 		start := time.Now()
 		log.Infof("%s <-> %s", req.RemoteAddr, addr)
-		netpkg.Transport(rw, cc)
+		_, tspan := h.tracer.Start(ctx, "transfer")
+		err := netpkg.TransportWithIdleTimeout(rw, cc, h.md.idleTimeout)
+		tspan.Finish(err)
+		if err == netpkg.ErrIdleTimeout {
+			log.Debugf("%s >-< %s: %v", req.RemoteAddr, addr, err)
+		}
+		if quota.IsExceeded(err) {
+			log.Warnf("%s >-< %s: client %s: %v", req.RemoteAddr, addr, clientID, err)
+		}
 		log.WithFields(map[string]any{
 			"duration": time.Since(start),
 		}).Infof("%s >-< %s", req.RemoteAddr, addr)
 		return nil
 	}
 
-	// TODO: forward request
-	return nil
+	// the header rules are applied after the hop-by-hop headers are deleted.
+	h.md.headerRules.Apply(req.Header, req.RemoteAddr)
+
+	rw := trace.WrapUpstream(cc)
+	counter := h.md.quota.Counter(ctx, clientID)
+	defer counter.Close()
+	if counter != nil {
+		rw = traffic_wrapper.WrapQuotaReadWriter(rw, counter)
+	}
+
+	w, done := h.wrapClient(w, req, live.Limiter, clientID, addr, cc, log)
+	defer done()
+
+	start := time.Now()
+	log.Infof("%s <-> %s", req.RemoteAddr, addr)
+	_, tspan := h.tracer.Start(ctx, "transfer")
+	err = h.forwardRequest(w, req, rw)
+	tspan.Finish(err)
+	if err != nil {
+		log.Error(err)
+	}
+	log.WithFields(map[string]any{
+		"duration": time.Since(start),
+	}).Infof("%s >-< %s", req.RemoteAddr, addr)
+
+	return err
+}
+
+// dial connects to the target by the router of the route, or the service router if the route is nil.
+// The dial latency is recorded, and the connect is short-circuited if the circuit of the target is open.
+func (h *http2Handler) dial(ctx context.Context, rt *route, addr string) (net.Conn, error) {
+	router := h.options.Router
+	if rt != nil {
+		if err := rt.Err(); err != nil {
+			return nil, err
+		}
+		router = rt.router
+		if v := xmetrics.GetCounter(xmetrics.MetricServiceRouteRequestsCounter,
+			metrics.Labels{"service": h.options.Service, "route": rt.name}); v != nil {
+			v.Inc()
+		}
+	}
+
+	if h.md.forwarded {
+		ctx = ctxvalue.ContextWithForwarded(ctx, &ctxvalue.Forwarded{
+			For:    string(ctxvalue.ClientAddrFromContext(ctx)),
+			Target: addr,
+		})
+	}
+
+	if err := h.md.breaker.Allow(addr); err != nil {
+		return nil, err
+	}
+
+	_, tspan := h.tracer.Start(ctx, "dial")
+	tspan.SetAttribute("dst", addr)
+	span := xmetrics.StartSpan(xmetrics.MetricServiceDialDurationObserver, h.options.Service)
+	cc, err := router.Dial(ctx, "tcp", addr)
+	span.End(err)
+	tspan.Finish(err)
+	h.md.breaker.Done(addr, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.md.proxyProtocol > 0 {
+		src, dst := clientAddrs(ctx)
+		cc = proxyproto.WrapClientConn(h.md.proxyProtocol, src, dst, cc)
+	}
+	return cc, nil
+}
+
+type connAddrsKey struct{}
+
+// connAddrs is the addresses of the client connection sent in the PROXY protocol header.
+type connAddrs struct {
+	src net.Addr
+	dst net.Addr
+}
+
+func clientAddrs(ctx context.Context) (src, dst net.Addr) {
+	v, _ := ctx.Value(connAddrsKey{}).(connAddrs)
+	return v.src, v.dst
+}
+
+// route selects the route of the target address by the routing rules,
+// the route name is added to the log fields.
+func (h *http2Handler) route(addr string, log logger.Logger) (*route, logger.Logger) {
+	rt := h.md.routes.Match(addr)
+	if rt != nil {
+		log = log.WithFields(map[string]any{
+			"route": rt.name,
+		})
+	}
+	return rt, log
+}
+
+// sniffSNI peeks the TLS ClientHello of the tunneled stream within the sniffing timeout,
+// the returned rw replays the peeked data, so the non-TLS traffic is passed through untouched.
+// If the sniRewrite option is enabled, the target address with an IP host is rewritten by the server name.
+func (h *http2Handler) sniffSNI(ctx context.Context, rw io.ReadWriter, setReadDeadline func(time.Time) error, addr string, bp bypass.Bypass, log logger.Logger) (context.Context, io.ReadWriter, string, error) {
+	if err := setReadDeadline(time.Now().Add(h.md.sniffingTimeout)); err != nil {
+		// the peek can not be time-bounded.
+		log.Debugf("sniffing: %v", err)
+		return ctx, rw, addr, nil
+	}
+	rw, sni, err := forward.SniffSNI(ctx, rw)
+	setReadDeadline(time.Time{})
+	if err != nil {
+		log.Debugf("sniffing: %v", err)
+	}
+	if sni == "" {
+		return ctx, rw, addr, nil
+	}
+	ctx = ctxvalue.ContextWithSNI(ctx, ctxvalue.SNI(sni))
+
+	if !h.md.sniRewrite {
+		return ctx, rw, addr, nil
+	}
+	host, port, _ := net.SplitHostPort(addr)
+	if net.ParseIP(host) == nil {
+		return ctx, rw, addr, nil
+	}
+	if err := h.checkHost(sni); err != nil {
+		log.Warnf("sni %.64q: %v", sni, err)
+		return ctx, rw, addr, nil
+	}
+
+	target := net.JoinHostPort(sni, port)
+	log.Debugf("rewrite %s to %s", addr, target)
+	if bp != nil && bp.Contains(ctx, "tcp", target) {
+		log.Debug("bypass: ", target)
+		return ctx, rw, addr, ErrBypass
+	}
+	return ctx, rw, target, nil
+}
+
+// decodeServerNames decodes the comma-separated lists of the encoded names in the values of the header,
+// in order. The empty entries are ignored, and the malformed ones are skipped without affecting the following ones.
+func (h *http2Handler) decodeServerNames(values []string, log logger.Logger) (names []string, err error) {
+	var entries []string
+	for _, v := range values {
+		for _, entry := range strings.Split(v, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+		if len(entries) > maxTargetHops {
+			return nil, ErrTooManyHops
+		}
+	}
+
+	for _, entry := range entries {
+		name, err := h.decodeServerName(entry)
+		if err != nil {
+			log.Warnf("skip target %.64q: %v", entry, err)
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, ErrInvalidHost
+	}
+	return
 }
 
 func (h *http2Handler) decodeServerName(s string) (string, error) {
+	// the name is base64 encoded twice, each encoding expands it by 4/3.
+	if len(s) > 2*h.md.maxHostLength+8 {
+		return "", ErrHostTooLong
+	}
+
 	b, err := base64.RawURLEncoding.DecodeString(s)
 	if err != nil {
 		return "", err
 	}
 	if len(b) < 4 {
-		return "", errors.New("invalid name")
+		return "", ErrInvalidHost
 	}
 	v, err := base64.RawURLEncoding.DecodeString(string(b[4:]))
 	if err != nil {
 		return "", err
 	}
 	if crc32.ChecksumIEEE(v) != binary.BigEndian.Uint32(b[:4]) {
-		return "", errors.New("invalid name")
+		return "", ErrInvalidHost
+	}
+	if err := h.checkHost(string(v)); err != nil {
+		return "", err
 	}
 	return string(v), nil
 }
 
+// checkHost checks whether the host (with optional port) is a plausible target address.
+func (h *http2Handler) checkHost(hostport string) error {
+	if len(hostport) > h.md.maxHostLength {
+		return ErrHostTooLong
+	}
+
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		// no port
+		host, port = hostport, ""
+	}
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > math.MaxUint16 {
+			return ErrInvalidHost
+		}
+	}
+
+	if !forward.ValidHost(host) {
+		return ErrInvalidHost
+	}
+	return nil
+}
+
 func (h *http2Handler) basicProxyAuth(proxyAuth string) (username, password string, ok bool) {
 	if proxyAuth == "" {
 		return
@@ -295,16 +837,25 @@ func (h *http2Handler) basicProxyAuth(proxyAuth string) (username, password stri
 	return cs[:s], cs[s+1:], true
 }
 
-func (h *http2Handler) authenticate(ctx context.Context, w http.ResponseWriter, r *http.Request, resp *http.Response, log logger.Logger) (id string, ok bool) {
+func (h *http2Handler) authenticate(ctx context.Context, w http.ResponseWriter, r *http.Request, resp *http.Response, auther auth.Authenticator, log logger.Logger) (id string, ok bool) {
 	u, p, _ := h.basicProxyAuth(r.Header.Get("Proxy-Authorization"))
-	if h.options.Auther == nil {
-		return "", true
-	}
-	if id, ok = h.options.Auther.Authenticate(ctx, u, p); ok {
-		return
+	switch {
+	case h.extAuth != nil:
+		// the external auth service takes precedence over the local auther.
+		if id, ok = h.extAuth.Authenticate(ctx, r); ok {
+			return
+		}
+	case auther != nil:
+		if id, ok = auther.Authenticate(ctx, u, p); ok {
+			return
+		}
+	default:
+		if !h.md.requireAuth {
+			return "", true
+		}
 	}
 
-	pr := h.md.probeResistance
+	pr := h.probeResist.Load()
 	// probing resistance is enabled, and knocking host is mismatch.
 	if pr != nil && (pr.Knock == "" || !strings.EqualFold(r.URL.Hostname(), pr.Knock)) {
 		resp.StatusCode = http.StatusServiceUnavailable // default status code
@@ -316,7 +867,7 @@ func (h *http2Handler) authenticate(ctx context.Context, w http.ResponseWriter,
 			if !strings.HasPrefix(url, "http") {
 				url = "http://" + url
 			}
-			r, err := http.Get(url)
+			r, err := h.webClient.Get(url)
 			if err != nil {
 				log.Error(err)
 				break
@@ -336,42 +887,28 @@ func (h *http2Handler) authenticate(ctx context.Context, w http.ResponseWriter,
 			}
 			return
 		case "file":
-			f, _ := os.Open(pr.Value)
-			if f != nil {
-				defer f.Close()
-
-				resp.StatusCode = http.StatusOK
-				if finfo, _ := f.Stat(); finfo != nil {
-					resp.ContentLength = finfo.Size()
-				}
-				resp.Header.Set("Content-Type", "text/html")
-				resp.Body = f
+			if err := pr.serveFile(r, resp); err != nil {
+				log.Error(err)
+				break
 			}
+			defer resp.Body.Close()
 		}
 	}
 
 	if resp.StatusCode == 0 {
-		realm := defaultRealm
-		if h.md.authBasicRealm != "" {
-			realm = h.md.authBasicRealm
-		}
-		resp.StatusCode = http.StatusProxyAuthRequired
-		resp.Header.Add("Proxy-Authenticate", fmt.Sprintf("Basic realm=\"%s\"", realm))
-		if strings.ToLower(r.Header.Get("Proxy-Connection")) == "keep-alive" {
-			// XXX libcurl will keep sending auth request in same conn
-			// which we don't supported yet.
-			resp.Header.Set("Connection", "close")
-			resp.Header.Set("Proxy-Connection", "close")
-		}
+		h.writeAuthRequired(w, r, resp, log)
+		return
+	}
 
-		log.Debug("proxy authentication required")
-	} else {
-		resp.Header = http.Header{}
-		// resp.Header.Set("Server", "nginx/1.20.1")
-		// resp.Header.Set("Date", time.Now().Format(http.TimeFormat))
-		if resp.StatusCode == http.StatusOK {
-			resp.Header.Set("Connection", "keep-alive")
-		}
+	contentType := resp.Header.Get("Content-Type")
+	resp.Header = http.Header{}
+	if contentType != "" {
+		resp.Header.Set("Content-Type", contentType)
+	}
+	// resp.Header.Set("Server", "nginx/1.20.1")
+	// resp.Header.Set("Date", time.Now().Format(http.TimeFormat))
+	if resp.StatusCode == http.StatusOK {
+		resp.Header.Set("Connection", "keep-alive")
 	}
 
 	if log.IsLevelEnabled(logger.TraceLevel) {
@@ -383,18 +920,208 @@ func (h *http2Handler) authenticate(ctx context.Context, w http.ResponseWriter,
 
 	return
 }
+
+// writeAuthRequired writes the 407 response, asking the client for the credentials.
+func (h *http2Handler) writeAuthRequired(w http.ResponseWriter, r *http.Request, resp *http.Response, log logger.Logger) {
+	realm := defaultRealm
+	if h.md.authBasicRealm != "" {
+		realm = h.md.authBasicRealm
+	}
+	resp.StatusCode = http.StatusProxyAuthRequired
+	resp.Header.Add("Proxy-Authenticate", fmt.Sprintf("Basic realm=\"%s\"", realm))
+	if strings.ToLower(r.Header.Get("Proxy-Connection")) == "keep-alive" {
+		// XXX libcurl will keep sending auth request in same conn
+		// which we don't supported yet.
+		resp.Header.Set("Connection", "close")
+		resp.Header.Set("Proxy-Connection", "close")
+	}
+
+	log.Debug("proxy authentication required")
+
+	if log.IsLevelEnabled(logger.TraceLevel) {
+		dump, _ := httputil.DumpResponse(resp, false)
+		log.Trace(string(dump))
+	}
+
+	h.writeResponse(w, resp)
+}
+
 func (h *http2Handler) forwardRequest(w http.ResponseWriter, r *http.Request, rw io.ReadWriter) (err error) {
+	_, err = h.forward(w, r, rw)
+	return
+}
+
+// forward sends the request to rw and writes the response back,
+// it reports whether the connection is idle after the response and can be reused.
+func (h *http2Handler) forward(w http.ResponseWriter, r *http.Request, rw io.ReadWriter) (reusable bool, err error) {
 	if err = r.Write(rw); err != nil {
 		return
 	}
 
-	resp, err := http.ReadResponse(bufio.NewReader(rw), r)
+	br := bufio.NewReader(rw)
+	resp, err := http.ReadResponse(br, r)
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
 
-	return h.writeResponse(w, resp)
+	http_util.RemoveHopHeaders(resp.Header, h.md.hopHeaders...)
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		// the upgraded connection is relayed as is, and never reused.
+		return false, h.switchProtocols(w, resp, xio.NewReadWriter(br, rw))
+	}
+	if err = h.writeResponse(w, resp); err != nil {
+		return
+	}
+	return !resp.Close && br.Buffered() == 0, nil
+}
+
+// switchProtocols sends the 101 (Switching Protocols) response of the upstream to the client,
+// and relays the upgraded connection, e.g. the websocket, between them.
+// Only the connections of the HTTP/1.x clients can be upgraded, as they are hijacked.
+func (h *http2Handler) switchProtocols(w http.ResponseWriter, resp *http.Response, upstream io.ReadWriter) error {
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := resp.Write(conn); err != nil {
+		return err
+	}
+	err = netpkg.TransportWithIdleTimeout(xio.NewReadWriter(brw, conn), upstream, h.md.idleTimeout)
+	if err == netpkg.ErrIdleTimeout {
+		return nil
+	}
+	return err
+}
+
+// forwardPooled forwards the plain HTTP request over a pooled connection to the upstream,
+// the connection is returned to the pool after the response if it is reusable.
+func (h *http2Handler) forwardPooled(ctx context.Context, w http.ResponseWriter, req *http.Request, rt *route, addr string, clientID string, lim traffic.TrafficLimiter, log logger.Logger) error {
+	// the connections are never shared across the clients,
+	// as the upstream may authenticate them per user.
+	key := clientID + "@" + addr
+	if rt != nil {
+		key = rt.name + "/" + key
+	}
+
+	cc := h.connPool.Get(key)
+	if cc == nil {
+		var err error
+		if cc, err = h.dial(ctx, rt, addr); err != nil {
+			log.Error(err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return err
+		}
+	}
+
+	h.md.headerRules.Apply(req.Header, req.RemoteAddr)
+	// the Connection header of the client is hop-by-hop, the upstream connection is kept alive.
+	req.Close = false
+
+	rw := event.ConnTraceFromContext(ctx).WrapUpstream(cc)
+	counter := h.md.quota.Counter(ctx, clientID)
+	defer counter.Close()
+	if counter != nil {
+		rw = traffic_wrapper.WrapQuotaReadWriter(rw, counter)
+	}
+
+	w, done := h.wrapClient(w, req, lim, clientID, addr, cc, log)
+	defer done()
+
+	start := time.Now()
+	log.Infof("%s <-> %s", req.RemoteAddr, addr)
+	_, tspan := h.tracer.Start(ctx, "transfer")
+	reusable, err := h.forward(w, req, rw)
+	tspan.Finish(err)
+	if reusable {
+		h.connPool.Put(key, cc)
+	} else {
+		h.connPool.Discard(cc)
+		cc.Close()
+	}
+	if err != nil {
+		log.Error(err)
+	}
+	log.WithFields(map[string]any{
+		"duration": time.Since(start),
+		"reused":   reusable,
+	}).Infof("%s >-< %s", req.RemoteAddr, addr)
+
+	return err
+}
+
+// wrapClient wraps the body of the plain HTTP request and the response writer
+// with the traffic limiter, stats, billing and conntrack of the client, as the CONNECT requests are wrapped.
+// The returned func releases the stats, billing and conntrack after the response is written.
+func (h *http2Handler) wrapClient(w http.ResponseWriter, req *http.Request, lim traffic.TrafficLimiter, clientID string, addr string, cc net.Conn, log logger.Logger) (http.ResponseWriter, func()) {
+	body := req.Body
+	if body == nil {
+		body = http.NoBody
+	}
+
+	rw, done := h.wrapTraffic(xio.NewReadWriter(body, w), lim, clientID, addr, req.RemoteAddr)
+
+	tc := conntrack.Track(h.options.Service, clientID, req.RemoteAddr, addr, log, cc)
+	rw = tc.WrapReadWriter(rw)
+
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &readCloser{Reader: rw, Closer: req.Body}
+	}
+
+	return &responseWriter{ResponseWriter: w, w: rw}, func() {
+		tc.Untrack()
+		done()
+	}
+}
+
+// wrapTraffic applies the traffic limiter of the client, the stats and the billing to the client side of the connection,
+// the returned function ends the accounting.
+func (h *http2Handler) wrapTraffic(rw io.ReadWriter, lim traffic.TrafficLimiter, clientID string, addr string, src string) (io.ReadWriter, func()) {
+	rw = traffic_wrapper.WrapReadWriterScopes(
+		lim,
+		rw,
+		traffic_wrapper.Scope{
+			Key: clientID,
+			Opts: []limiter.Option{
+				limiter.ScopeOption(limiter.ScopeClient),
+				limiter.ServiceOption(h.options.Service),
+				limiter.NetworkOption("tcp"),
+				limiter.AddrOption(addr),
+				limiter.ClientOption(clientID),
+				limiter.SrcOption(src),
+			},
+		},
+	)
+
+	var pstats *stats.Stats
+	if h.options.Observer != nil {
+		pstats = h.stats.Stats(clientID)
+		pstats.Add(stats.KindTotalConns, 1)
+		pstats.Add(stats.KindCurrentConns, 1)
+		rw = stats_wrapper.WrapReadWriter(rw, pstats)
+	}
+	acct := h.billing.Start(clientID)
+	rw = stats_wrapper.WrapReadWriter(rw, acct.Stats())
+
+	return rw, func() {
+		acct.End()
+		if pstats != nil {
+			pstats.Add(stats.KindCurrentConns, -1)
+		}
+	}
+}
+
+// limitAddr is the target address matched by the traffic limiter,
+// the sniffed server name is used instead of the IP address.
+func limitAddr(ctx context.Context, addr string) string {
+	if sni := ctxvalue.SNIFromContext(ctx); sni != "" {
+		if _, port, _ := net.SplitHostPort(addr); port != "" {
+			return net.JoinHostPort(string(sni), port)
+		}
+	}
+	return addr
 }
 
 func (h *http2Handler) writeResponse(w http.ResponseWriter, resp *http.Response) error {
@@ -404,7 +1131,11 @@ func (h *http2Handler) writeResponse(w http.ResponseWriter, resp *http.Response)
 		}
 	}
 	w.WriteHeader(resp.StatusCode)
-	_, err := io.Copy(flushWriter{w}, resp.Body)
+
+	fw := http_util.NewFlushWriter(w, h.md.flush)
+	defer fw.Close()
+
+	_, err := io.Copy(fw, resp.Body)
 	return err
 }
 
@@ -420,6 +1151,25 @@ func (h *http2Handler) checkRateLimit(addr net.Addr) bool {
 	return true
 }
 
+// retryAfter returns the value in seconds of the Retry-After header for the rate limited client.
+func (h *http2Handler) retryAfter(addr net.Addr) int {
+	if h.md.retryAfter > 0 {
+		return int(math.Ceil(h.md.retryAfter.Seconds()))
+	}
+
+	if h.options.RateLimiter != nil {
+		host, _, _ := net.SplitHostPort(addr.String())
+		if limiter := h.options.RateLimiter.Limiter(host); limiter != nil {
+			// the time to wait for the next token.
+			if r := limiter.Limit(); r > 0 {
+				return int(math.Ceil(1 / r))
+			}
+		}
+	}
+
+	return 1
+}
+
 func (h *http2Handler) observeStats(ctx context.Context) {
 	if h.options.Observer == nil {
 		return
@@ -441,3 +1191,28 @@ func (h *http2Handler) observeStats(ctx context.Context) {
 		}
 	}
 }
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// responseWriter is the http.ResponseWriter writing the body by the wrapped writer w.
+type responseWriter struct {
+	http.ResponseWriter
+	w io.Writer
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	return w.w.Write(b)
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
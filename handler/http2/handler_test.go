@@ -0,0 +1,458 @@
+package http2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gost/core/chain"
+	"github.com/go-gost/core/handler"
+	"github.com/go-gost/core/recorder"
+	xchain "github.com/go-gost/x/chain"
+	"github.com/go-gost/x/internal/util/billing"
+	"github.com/go-gost/x/internal/util/conntrack"
+	"github.com/go-gost/x/internal/util/quota"
+	xlogger "github.com/go-gost/x/logger"
+	xmd "github.com/go-gost/x/metadata"
+)
+
+func TestWrapClient(t *testing.T) {
+	h := &http2Handler{
+		options: handler.Options{
+			Service: "test-wrap-client",
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("hello"))
+	rec := httptest.NewRecorder()
+
+	w, done := h.wrapClient(rec, req, nil, "user", "example.com:80", nil, xlogger.Nop())
+
+	conns := conntrack.List(h.options.Service)
+	if len(conns) != 1 {
+		t.Fatalf("tracked connections: got %d, want 1", len(conns))
+	}
+
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Errorf("request body: got %q, want %q", b, "hello")
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(w, "world!"); err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.Body.String(); got != "world!" {
+		t.Errorf("response body: got %q, want %q", got, "world!")
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/plain" {
+		t.Errorf("response header: got %q, want %q", got, "text/plain")
+	}
+
+	conns = conntrack.List(h.options.Service)
+	if len(conns) != 1 {
+		t.Fatalf("tracked connections: got %d, want 1", len(conns))
+	}
+	if conns[0].Client != "user" || conns[0].Dst != "example.com:80" {
+		t.Errorf("tracked connection: got %+v", conns[0])
+	}
+	if conns[0].InputBytes != 5 || conns[0].OutputBytes != 6 {
+		t.Errorf("tracked bytes: got %d/%d, want 5/6", conns[0].InputBytes, conns[0].OutputBytes)
+	}
+
+	done()
+	if conns := conntrack.List(h.options.Service); len(conns) != 0 {
+		t.Errorf("tracked connections after done: got %d, want 0", len(conns))
+	}
+}
+
+func encodeServerName(name string) string {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, crc32.ChecksumIEEE([]byte(name)))
+	buf.WriteString(base64.RawURLEncoding.EncodeToString([]byte(name)))
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes())
+}
+
+func newTestHandler(t *testing.T, md map[string]any) *http2Handler {
+	t.Helper()
+
+	h := NewHandler(
+		handler.RouterOption(xchain.NewRouter(chain.LoggerRouterOption(xlogger.Nop()))),
+		handler.LoggerOption(xlogger.Nop()),
+	).(*http2Handler)
+	if err := h.Init(xmd.NewMetadata(md)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestCheckHost(t *testing.T) {
+	h := newTestHandler(t, map[string]any{"maxHostLength": 64})
+
+	tests := []struct {
+		host string
+		err  error
+	}{
+		{host: "example.com"},
+		{host: "example.com:443"},
+		{host: "example.com."},
+		{host: "_dmarc.example.com"},
+		{host: "192.168.1.1:80"},
+		{host: "[2001:db8::1]:443"},
+		{host: "", err: ErrInvalidHost},
+		{host: strings.Repeat("a", 65), err: ErrHostTooLong},
+		{host: strings.Repeat("a", 64) + ".com", err: ErrHostTooLong},
+		{host: "example.com:0", err: ErrInvalidHost},
+		{host: "example.com:65536", err: ErrInvalidHost},
+		{host: "example.com:http", err: ErrInvalidHost},
+		{host: "example..com", err: ErrInvalidHost},
+		{host: "-example.com", err: ErrInvalidHost},
+		{host: "example-.com", err: ErrInvalidHost},
+		{host: "exa mple.com", err: ErrInvalidHost},
+		{host: "example.com/path", err: ErrInvalidHost},
+		{host: "user@example.com", err: ErrInvalidHost},
+		{host: "example.com\x00", err: ErrInvalidHost},
+	}
+
+	for _, tt := range tests {
+		if err := h.checkHost(tt.host); !errors.Is(err, tt.err) {
+			t.Errorf("%q: got %v, want %v", tt.host, err, tt.err)
+		}
+	}
+}
+
+func TestDecodeServerName(t *testing.T) {
+	h := newTestHandler(t, map[string]any{"maxHostLength": 64})
+
+	badCRC := []byte(base64.RawURLEncoding.EncodeToString([]byte("example.com")))
+	badCRC = append([]byte{0, 0, 0, 0}, badCRC...)
+
+	tests := []struct {
+		name string
+		s    string
+		want string
+		err  bool
+	}{
+		{name: "valid", s: encodeServerName("example.com:443"), want: "example.com:443"},
+		{name: "oversized", s: strings.Repeat("A", 2*64+9), err: true},
+		{name: "oversized host", s: encodeServerName(strings.Repeat("a", 40) + "." + strings.Repeat("b", 40)), err: true},
+		{name: "malformed base64", s: "not base64!", err: true},
+		{name: "short", s: base64.RawURLEncoding.EncodeToString([]byte{1, 2}), err: true},
+		{name: "checksum mismatch", s: base64.RawURLEncoding.EncodeToString(badCRC), err: true},
+		{name: "malformed host", s: encodeServerName("exa mple.com"), err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.decodeServerName(tt.s)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeServerNames(t *testing.T) {
+	h := newTestHandler(t, map[string]any{"maxHostLength": 64})
+
+	a := encodeServerName("a.example.com:443")
+	b := encodeServerName("b.example.com:443")
+	c := encodeServerName("c.example.com:443")
+
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+		err    error
+	}{
+		{name: "single", values: []string{a}, want: []string{"a.example.com:443"}},
+		{
+			name:   "several",
+			values: []string{a + "," + b + "," + c},
+			want:   []string{"a.example.com:443", "b.example.com:443", "c.example.com:443"},
+		},
+		{
+			name:   "malformed between",
+			values: []string{a + ",not base64!," + b},
+			want:   []string{"a.example.com:443", "b.example.com:443"},
+		},
+		{
+			name:   "malformed first",
+			values: []string{encodeServerName("exa mple.com") + "," + b + "," + c},
+			want:   []string{"b.example.com:443", "c.example.com:443"},
+		},
+		{
+			name:   "empty entries",
+			values: []string{" " + a + " ,, " + b + ","},
+			want:   []string{"a.example.com:443", "b.example.com:443"},
+		},
+		{
+			name:   "header values",
+			values: []string{a, b + "," + c},
+			want:   []string{"a.example.com:443", "b.example.com:443", "c.example.com:443"},
+		},
+		{
+			name:   "max hops with empty entries",
+			values: []string{strings.Repeat(a+",,", maxTargetHops)},
+			want: func() (v []string) {
+				for i := 0; i < maxTargetHops; i++ {
+					v = append(v, "a.example.com:443")
+				}
+				return
+			}(),
+		},
+		{name: "too many hops", values: []string{strings.Repeat(a+",", maxTargetHops) + b}, err: ErrTooManyHops},
+		{name: "too many hops in values", values: []string{strings.Repeat(a+",", maxTargetHops-1) + a, b}, err: ErrTooManyHops},
+		{name: "all malformed", values: []string{"not base64!,,x"}, err: ErrInvalidHost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.decodeServerNames(tt.values, xlogger.Nop())
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundTripBadHost(t *testing.T) {
+	h := newTestHandler(t, map[string]any{"maxHostLength": 64})
+
+	tests := []struct {
+		name   string
+		host   string
+		header map[string]string
+	}{
+		{name: "oversized host", host: strings.Repeat("a", 100) + ".com"},
+		{name: "malformed host", host: "exa mple.com"},
+		{name: "oversized target", host: "example.com", header: map[string]string{"Gost-Target": strings.Repeat("A", 1024)}},
+		{name: "malformed target", host: "example.com", header: map[string]string{"X-Gost-Target": "%%%"}},
+		{name: "malformed target host", host: "example.com", header: map[string]string{"Gost-Target": encodeServerName("example.com:99999")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.Host = tt.host
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+
+			if err := h.roundTrip(context.Background(), rec, req, xlogger.Nop()); err == nil {
+				t.Error("the request is not rejected")
+			}
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status: got %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+// serveUpgrade accepts an upgrade request on ln, the upgraded connection echoes the data back.
+func serveUpgrade(t *testing.T, ln net.Listener, header chan<- http.Header) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	header <- req.Header
+	if req.Header.Get("Upgrade") != "echo" {
+		conn.Write([]byte("HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n"))
+		return
+	}
+	conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n"))
+	io.Copy(conn, br)
+}
+
+func TestRoundTripUpgrade(t *testing.T) {
+	h := newTestHandler(t, nil)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	header := make(chan http.Header, 1)
+	go serveUpgrade(t, ln, header)
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.roundTrip(context.Background(), w, r, xlogger.Nop())
+	}))
+	defer proxy.Close()
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "GET http://%s/ HTTP/1.1\r\nHost: %s\r\n"+
+		"Connection: keep-alive, Upgrade\r\nKeep-Alive: timeout=5\r\nUpgrade: echo\r\n\r\n", ln.Addr(), ln.Addr())
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Upgrade") != "echo" {
+		t.Fatalf("got %d, Upgrade %q", resp.StatusCode, resp.Header.Get("Upgrade"))
+	}
+	if hdr := <-header; hdr.Get("Connection") != "Upgrade" || hdr.Get("Keep-Alive") != "" {
+		t.Errorf("upstream request: got Connection %q, Keep-Alive %q", hdr.Get("Connection"), hdr.Get("Keep-Alive"))
+	}
+
+	// the upgraded connection is relayed.
+	for _, msg := range []string{"ping", "pong"} {
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, len(msg))
+		if _, err := io.ReadFull(br, b); err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != msg {
+			t.Errorf("got %q, want %q", b, msg)
+		}
+	}
+}
+
+func TestInitInvalidQuota(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+	}{
+		{key: "quota.conn", value: "10G"},
+		{key: "quota.daily", value: "abc"},
+		{key: "quota.daily", value: "-1GB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			h := NewHandler(
+				handler.RouterOption(xchain.NewRouter(chain.LoggerRouterOption(xlogger.Nop()))),
+				handler.LoggerOption(xlogger.Nop()),
+			)
+			err := h.Init(xmd.NewMetadata(map[string]any{tt.key: tt.value}))
+			if !errors.Is(err, quota.ErrInvalidSize) {
+				t.Errorf("got %v, want %v", err, quota.ErrInvalidSize)
+			}
+		})
+	}
+}
+
+type billingRecorder struct {
+	records chan billing.Record
+}
+
+func (r *billingRecorder) Record(ctx context.Context, b []byte, opts ...recorder.RecordOption) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for {
+		var record billing.Record
+		if err := dec.Decode(&record); err != nil {
+			return nil
+		}
+		r.records <- record
+	}
+}
+
+func TestConnectBilling(t *testing.T) {
+	h := newTestHandler(t, nil)
+	rec := &billingRecorder{records: make(chan billing.Record, 1)}
+	h.billing = billing.New("http2", rec, billing.Options{Logger: xlogger.Nop()})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	done := make(chan struct{})
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		h.roundTrip(context.Background(), w, r, xlogger.Nop())
+	}))
+	defer proxy.Close()
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", ln.Addr(), ln.Addr())
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", resp.StatusCode)
+	}
+
+	// the hijacked HTTP/1.x tunnel is accounted as the HTTP/2 one.
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(br, b); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the tunnel is not closed")
+	}
+	h.billing.Close()
+
+	select {
+	case record := <-rec.records:
+		if record.Up != 4 || record.Down != 4 {
+			t.Errorf("got up %d, down %d, want 4, 4", record.Up, record.Down)
+		}
+	default:
+		t.Fatal("no billing record of the tunnel")
+	}
+}
@@ -1,24 +1,90 @@
 package http2
 
 import (
+	"fmt"
 	"net/http"
-	"strings"
 	"time"
 
 	mdata "github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/core/metadata/util"
+	"github.com/go-gost/core/resolver"
+	"github.com/go-gost/x/interceptor"
+	"github.com/go-gost/x/internal/util/billing"
+	"github.com/go-gost/x/internal/util/breaker"
+	bypass_util "github.com/go-gost/x/internal/util/bypass"
+	"github.com/go-gost/x/internal/util/connpool"
+	http_util "github.com/go-gost/x/internal/util/http"
+	port_util "github.com/go-gost/x/internal/util/port"
+	"github.com/go-gost/x/internal/util/quota"
+	resolver_util "github.com/go-gost/x/internal/util/resolver"
+	"github.com/go-gost/x/internal/util/schedule"
+	tls_util "github.com/go-gost/x/internal/util/tls"
+	"github.com/go-gost/x/observer/event"
+	"github.com/go-gost/x/registry"
 )
 
 const (
-	defaultRealm = "gost"
+	defaultRealm         = "gost"
+	defaultMaxHostLength = 512
+	// the time to wait for the TLS ClientHello of the tunneled stream.
+	defaultSniffingTimeout = 3 * time.Second
 )
 
 type metadata struct {
 	probeResistance *probeResistance
+	bypassPage      *bypassPage
 	header          http.Header
+	// the extra hop-by-hop headers removed from the forwarded requests and responses.
+	hopHeaders []string
+	// the header rules applied to the forwarded requests.
+	headerRules     *http_util.HeaderRules
 	hash            string
+	hashHeader      string
 	authBasicRealm  string
 	observePeriod   time.Duration
+	retryAfter      time.Duration
+	idleTimeout     time.Duration
+	authURL         string
+	authTimeout     time.Duration
+	authHeaders     []string
+	authCacheTTL    time.Duration
+	authNegCacheTTL time.Duration
+	requireAuth     bool
+	maxHostLength   int
+	sniSniffing     bool
+	sniRewrite      bool
+	sniffingTimeout time.Duration
+	routes          *routeTable
+	tracing         bool
+	forwarded       bool
+	resolver        resolver.Resolver
+	dnsCache        *resolver_util.LookupCache
+	bypassAction    *bypass_util.Action
+	// the ports of the targets allowed and denied, nil allows any port.
+	ports *port_util.Policy
+	// the version of the PROXY protocol header sent to the upstream, 0 for none.
+	proxyProtocol int
+	// the per-destination circuit breaker of the connects, nil if disabled.
+	breaker *breaker.Breaker
+	// the traffic quotas of the connections and the clients, nil if disabled.
+	quota *quota.Quota
+	// the time-of-day access policies of the clients, nil if disabled.
+	schedule *schedule.Schedule
+	// the options of the upstream connection pool of the plain HTTP requests, nil if disabled.
+	connPool *connpool.Options
+	maskIP   bool
+	// the interceptors run around the requests, nil if none.
+	interceptors *interceptor.Chain
+	// emits the lifecycle events of the requests through the observer.
+	connEvents     bool
+	connEventsOpts event.ConnEmitterOptions
+	// the batching of the billing records, the records are emitted if the billing recorder is set.
+	billingOpts billing.Options
+	// the SNI and ALPN of the TLS dialed by the handler itself, such as the decoy page of the web probe resistance.
+	upstreamTLS *tls_util.ClientOptions
+	// the coalescing of the flushes of the tunneled and the forwarded response bodies,
+	// the body is flushed on every write by default.
+	flush http_util.FlushOptions
 }
 
 func (h *http2Handler) parseMetadata(md mdata.Metadata) error {
@@ -29,26 +95,234 @@ func (h *http2Handler) parseMetadata(md mdata.Metadata) error {
 		}
 		h.md.header = hd
 	}
+	h.md.hopHeaders = mdutil.GetStrings(md, "http.hopHeaders", "hopHeaders")
+	h.md.flush = http_util.FlushOptions{
+		Threshold: mdutil.GetInt(md, "flush.threshold"),
+		Delay:     mdutil.GetDuration(md, "flush.delay"),
+	}
+	h.md.headerRules = parseHeaderRules(md)
 
-	if pr := mdutil.GetString(md, "probeResist", "probe_resist"); pr != "" {
-		if ss := strings.SplitN(pr, ":", 2); len(ss) == 2 {
-			h.md.probeResistance = &probeResistance{
-				Type:  ss[0],
-				Value: ss[1],
-				Knock: mdutil.GetString(md, "knock"),
-			}
-		}
+	h.md.probeResistance = parseProbeResistance(md)
+	h.md.upstreamTLS = &tls_util.ClientOptions{
+		ServerName: mdutil.GetString(md, "upstream.tls.serverName"),
+		ALPN:       mdutil.GetStrings(md, "upstream.tls.alpn"),
 	}
+	h.md.bypassPage = parseBypassPage(md)
 	h.md.hash = mdutil.GetString(md, "hash")
+	h.md.hashHeader = mdutil.GetString(md, "hash.header")
 	h.md.authBasicRealm = mdutil.GetString(md, "authBasicRealm")
 
 	h.md.observePeriod = mdutil.GetDuration(md, "observePeriod")
+	h.md.retryAfter = mdutil.GetDuration(md, "retryAfter")
+	h.md.idleTimeout = mdutil.GetDuration(md, "idleTimeout")
+
+	h.md.maxHostLength = mdutil.GetInt(md, "maxHostLength")
+	if h.md.maxHostLength <= 0 {
+		h.md.maxHostLength = defaultMaxHostLength
+	}
+
+	h.md.tracing = mdutil.GetBool(md, "tracing")
+	h.md.forwarded = mdutil.GetBool(md, "forwarded")
+
+	h.md.sniSniffing = mdutil.GetBool(md, "sniSniffing")
+	h.md.sniRewrite = mdutil.GetBool(md, "sniRewrite")
+	h.md.sniffingTimeout = mdutil.GetDuration(md, "sniffing.timeout")
+	if h.md.sniffingTimeout <= 0 {
+		h.md.sniffingTimeout = defaultSniffingTimeout
+	}
+
+	var err error
+	if h.md.routes, err = parseRouteTable(md, h.options.Router); err != nil {
+		return err
+	}
+
+	h.md.authURL = mdutil.GetString(md, "auth.url")
+	h.md.authTimeout = mdutil.GetDuration(md, "auth.timeout")
+	h.md.authHeaders = mdutil.GetStrings(md, "auth.header")
+	h.md.authCacheTTL = mdutil.GetDuration(md, "auth.cacheTTL")
+	h.md.authNegCacheTTL = mdutil.GetDuration(md, "auth.negativeCacheTTL")
+	// refuses all the requests if no auther is set, instead of allowing the anonymous access.
+	h.md.requireAuth = mdutil.GetBool(md, "requireAuth")
+
+	h.md.bypassAction = bypass_util.ParseAction(mdutil.GetString(md, "bypass.action"))
+	h.md.proxyProtocol = mdutil.GetInt(md, "proxyProtocol")
+	h.md.breaker = breaker.New(breaker.Options{
+		Threshold: mdutil.GetInt(md, "breaker.threshold"),
+		Window:    mdutil.GetDuration(md, "breaker.window"),
+		Cooldown:  mdutil.GetDuration(md, "breaker.cooldown"),
+		Service:   h.options.Service,
+	})
+	if mdutil.GetBool(md, "connPool.enabled") {
+		h.md.connPool = &connpool.Options{
+			MaxIdle:     mdutil.GetInt(md, "connPool.maxIdle"),
+			MaxLifetime: mdutil.GetDuration(md, "connPool.maxLifetime"),
+			IdleTimeout: mdutil.GetDuration(md, "connPool.idleTimeout"),
+			Service:     h.options.Service,
+		}
+	}
+	quotaConn, err := quota.ParseSize(mdutil.GetString(md, "quota.conn"))
+	if err != nil {
+		return fmt.Errorf("quota.conn: %w", err)
+	}
+	quotaDaily, err := quota.ParseSize(mdutil.GetString(md, "quota.daily"))
+	if err != nil {
+		return fmt.Errorf("quota.daily: %w", err)
+	}
+	h.md.quota = quota.New(quota.Options{
+		Conn:  quotaConn,
+		Daily: quotaDaily,
+		Store: quota.NewStore(
+			mdutil.GetString(md, "quota.file"),
+			mdutil.GetString(md, "quota.redis"),
+			quota.RedisStoreOptions{
+				DB:       mdutil.GetInt(md, "quota.redis.db"),
+				Password: mdutil.GetString(md, "quota.redis.password"),
+				Key:      mdutil.GetString(md, "quota.redis.key"),
+			},
+			h.options.Logger,
+		),
+		Service: h.options.Service,
+	})
+	if h.md.schedule, err = schedule.New(schedule.Options{
+		Policies:  mdutil.GetStringMapString(md, "schedule"),
+		Default:   mdutil.GetString(md, "schedule.default"),
+		Terminate: mdutil.GetBool(md, "schedule.terminate"),
+	}); err != nil {
+		return err
+	}
+	if h.md.ports, err = port_util.NewPolicy(h.options.Service,
+		mdutil.GetStrings(md, "ports.allow"), mdutil.GetStrings(md, "ports.deny")); err != nil {
+		return err
+	}
 
+	h.md.resolver = registry.ResolverRegistry().Get(mdutil.GetString(md, "resolver"))
+	if mdutil.GetBool(md, "dns.cache") {
+		h.md.dnsCache = resolver_util.NewLookupCache(h.options.Service, resolver_util.LookupCacheOptions{
+			TTL:        mdutil.GetDuration(md, "dns.cache.ttl"),
+			MaxEntries: mdutil.GetInt(md, "dns.cache.maxEntries"),
+			Stale:      mdutil.GetDuration(md, "dns.cache.stale"),
+		})
+	}
+
+	h.md.maskIP = mdutil.GetBool(md, "maskIP")
+
+	var interceptors []interceptor.Interceptor
+	for _, name := range mdutil.GetStrings(md, "interceptors") {
+		interceptors = append(interceptors, registry.InterceptorRegistry().Get(name))
+	}
+	h.md.interceptors = interceptor.NewChain(interceptors...)
+
+	h.md.connEvents = mdutil.GetBool(md, "connEvents")
+	h.md.connEventsOpts = event.ConnEmitterOptions{
+		Sample: mdutil.GetFloat(md, "connEvents.sample"),
+		Rate:   mdutil.GetInt(md, "connEvents.rate"),
+	}
+	h.md.billingOpts = billing.Options{
+		BatchSize:     mdutil.GetInt(md, "billing.batchSize"),
+		FlushInterval: mdutil.GetDuration(md, "billing.flushInterval"),
+	}
 	return nil
 }
 
-type probeResistance struct {
-	Type  string
-	Value string
-	Knock string
+// parseHeaderRules parses the header rules of the forwarded requests, for example:
+//
+//	forward.header.remove: [Cookie]
+//	forward.header.set: {User-Agent: gost}
+//	forward.header.add: {Via: gost}
+//	forward.forwardedFor: true
+func parseHeaderRules(md mdata.Metadata) *http_util.HeaderRules {
+	rules := &http_util.HeaderRules{
+		Remove:       mdutil.GetStrings(md, "forward.header.remove"),
+		ForwardedFor: mdutil.GetBool(md, "forward.forwardedFor"),
+	}
+	if m := mdutil.GetStringMapString(md, "forward.header.set"); len(m) > 0 {
+		rules.Set = http.Header{}
+		for k, v := range m {
+			rules.Set.Set(k, v)
+		}
+	}
+	if m := mdutil.GetStringMapString(md, "forward.header.add"); len(m) > 0 {
+		rules.Add = http.Header{}
+		for k, v := range m {
+			rules.Add.Add(k, v)
+		}
+	}
+	if rules.IsEmpty() {
+		return nil
+	}
+	return rules
+}
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"auth.cacheTTL",
+	"auth.header",
+	"auth.negativeCacheTTL",
+	"auth.timeout",
+	"auth.url",
+	"authBasicRealm",
+	"billing.batchSize",
+	"billing.flushInterval",
+	"breaker.cooldown",
+	"breaker.threshold",
+	"breaker.window",
+	"bypass.action",
+	"bypass.page",
+	"bypass.template",
+	"connEvents",
+	"connEvents.rate",
+	"connEvents.sample",
+	"connPool.enabled",
+	"connPool.idleTimeout",
+	"connPool.maxIdle",
+	"connPool.maxLifetime",
+	"dns.cache",
+	"dns.cache.maxEntries",
+	"dns.cache.stale",
+	"dns.cache.ttl",
+	"flush.delay",
+	"flush.threshold",
+	"forward.forwardedFor",
+	"forward.header.add",
+	"forward.header.remove",
+	"forward.header.set",
+	"forwarded",
+	"hash",
+	"hash.header",
+	"header",
+	"hopHeaders",
+	"http.header",
+	"http.hopHeaders",
+	"idleTimeout",
+	"interceptors",
+	"knock",
+	"maskIP",
+	"maxHostLength",
+	"observePeriod",
+	"ports.allow",
+	"ports.deny",
+	"probe_resist",
+	"probeResist",
+	"probeResist.template",
+	"proxyProtocol",
+	"quota.conn",
+	"quota.daily",
+	"quota.file",
+	"quota.redis",
+	"quota.redis.db",
+	"quota.redis.key",
+	"quota.redis.password",
+	"requireAuth",
+	"resolver",
+	"retryAfter",
+	"routes",
+	"schedule",
+	"schedule.default",
+	"schedule.terminate",
+	"sniffing.timeout",
+	"sniRewrite",
+	"sniSniffing",
+	"tracing",
+	"upstream.tls.alpn",
+	"upstream.tls.serverName",
 }
@@ -0,0 +1,116 @@
+package http2
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	mdata "github.com/go-gost/core/metadata"
+	mdutil "github.com/go-gost/core/metadata/util"
+)
+
+type probeResistance struct {
+	Type  string
+	Value string
+	Knock string
+	// Template enables the html/template rendering of the decoy pages in file mode.
+	Template bool
+}
+
+// probeResistKeys is the metadata keys of the probe resistance, they are reloadable.
+var probeResistKeys = []string{"probeResist", "probe_resist", "knock", "probeResist.template"}
+
+func parseProbeResistance(md mdata.Metadata) *probeResistance {
+	pr := mdutil.GetString(md, "probeResist", "probe_resist")
+	if pr == "" {
+		return nil
+	}
+	ss := strings.SplitN(pr, ":", 2)
+	if len(ss) != 2 {
+		return nil
+	}
+	return &probeResistance{
+		Type:     ss[0],
+		Value:    ss[1],
+		Knock:    mdutil.GetString(md, "knock"),
+		Template: mdutil.GetBool(md, "probeResist.template"),
+	}
+}
+
+// probeTemplateData is the data passed to the decoy page template.
+type probeTemplateData struct {
+	Method string
+	Host   string
+	Path   string
+	IP     string
+}
+
+// serveFile fills the resp with the decoy file.
+// If the value of the probe resistance is a directory, the file matching the request path is served.
+func (pr *probeResistance) serveFile(r *http.Request, resp *http.Response) error {
+	name := pr.Value
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		upath := path.Clean("/" + r.URL.Path)
+		name = filepath.Join(pr.Value, filepath.FromSlash(upath))
+		if fi, err = os.Stat(name); err == nil && fi.IsDir() {
+			name = filepath.Join(name, "index.html")
+			fi, err = os.Stat(name)
+		}
+		if err != nil {
+			resp.StatusCode = http.StatusNotFound
+			resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+			resp.Body = io.NopCloser(strings.NewReader("404 page not found\n"))
+			return nil
+		}
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "text/html"
+	}
+
+	if pr.Template && strings.HasPrefix(contentType, "text/html") {
+		tmpl, err := template.ParseFiles(name)
+		if err != nil {
+			return err
+		}
+		data := probeTemplateData{
+			Method: r.Method,
+			Host:   r.Host,
+			Path:   r.URL.Path,
+		}
+		data.IP, _, _ = net.SplitHostPort(r.RemoteAddr)
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return err
+		}
+		resp.StatusCode = http.StatusOK
+		resp.ContentLength = int64(buf.Len())
+		resp.Header.Set("Content-Type", contentType)
+		resp.Body = io.NopCloser(&buf)
+		return nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	resp.StatusCode = http.StatusOK
+	resp.ContentLength = fi.Size()
+	resp.Header.Set("Content-Type", contentType)
+	resp.Body = f
+	return nil
+}
@@ -0,0 +1,167 @@
+package http2
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/go-gost/core/chain"
+	mdata "github.com/go-gost/core/metadata"
+	mdutil "github.com/go-gost/core/metadata/util"
+	xchain "github.com/go-gost/x/chain"
+	"github.com/go-gost/x/registry"
+)
+
+const (
+	// routeDirect is the chain name of the routes connecting to the target directly.
+	routeDirect = "direct"
+	// routeDefault is the name of the route used if no rule matches and no default rule is specified.
+	routeDefault = "default"
+)
+
+var (
+	ErrRouteChain = errors.New("route: chain not found")
+)
+
+type route struct {
+	name   string
+	router chain.Router
+	// chain is the name of the chain the route dials through, empty for the direct and default routes.
+	chain string
+}
+
+// Err returns ErrRouteChain if the chain of the route is not registered, e.g. it is deleted by the web API,
+// so the request is rejected rather than connecting to the target directly.
+func (r *route) Err() error {
+	if r == nil || r.chain == "" || registry.ChainRegistry().IsRegistered(r.chain) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrRouteChain, r.chain)
+}
+
+type wildcardRoute struct {
+	// suffix is the domain suffix with the leading dot, e.g. ".example.com".
+	suffix string
+	route  *route
+}
+
+// routeTable selects the router of the request by the target host,
+// the exact host rules take precedence over the wildcard rules, then the default rule.
+//
+// The rules are specified by the metadata routes, a map of the host pattern to the chain name:
+//
+//	routes:
+//	  "git.corp.example.com": chain-b
+//	  "*.corp.example.com": chain-a
+//	  "*": direct
+//
+// The pattern *.example.com or .example.com matches the subdomains of example.com,
+// the pattern * specifies the default route, and the chain name direct connects to the target without a chain.
+// The service router is the default route if no default rule is specified.
+// The chain of a rule must be registered when the table is parsed.
+type routeTable struct {
+	exact     map[string]*route
+	wildcards []wildcardRoute
+	fallback  *route
+}
+
+func parseRouteTable(md mdata.Metadata, router chain.Router) (*routeTable, error) {
+	rules := mdutil.GetStringMapString(md, "routes")
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	t := &routeTable{
+		exact: make(map[string]*route),
+		fallback: &route{
+			name:   routeDefault,
+			router: router,
+		},
+	}
+	for pattern, name := range rules {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		name = strings.TrimSpace(name)
+		if pattern == "" || name == "" {
+			continue
+		}
+
+		r := &route{
+			name:   name,
+			router: newRouteRouter(router, name),
+		}
+		if name != routeDirect {
+			if !registry.ChainRegistry().IsRegistered(name) {
+				return nil, fmt.Errorf("routes: %s: %w: %s", pattern, ErrRouteChain, name)
+			}
+			r.chain = name
+		}
+		switch {
+		case pattern == "*":
+			t.fallback = r
+		case strings.HasPrefix(pattern, "*."):
+			t.wildcards = append(t.wildcards, wildcardRoute{suffix: pattern[1:], route: r})
+		case strings.HasPrefix(pattern, "."):
+			t.wildcards = append(t.wildcards, wildcardRoute{suffix: pattern, route: r})
+		default:
+			t.exact[pattern] = r
+		}
+	}
+	// the longest suffix is the most specific one.
+	sort.Slice(t.wildcards, func(i, j int) bool {
+		return len(t.wildcards[i].suffix) > len(t.wildcards[j].suffix)
+	})
+
+	return t, nil
+}
+
+// newRouteRouter creates a router with the options of the service router and the named chain.
+func newRouteRouter(router chain.Router, name string) chain.Router {
+	var opts chain.RouterOptions
+	if router != nil {
+		if v := router.Options(); v != nil {
+			opts = *v
+		}
+	}
+	opts.Chain = nil
+	if name != routeDirect {
+		opts.Chain = registry.ChainRegistry().Get(name)
+	}
+
+	return xchain.NewRouter(
+		chain.RetriesRouterOption(opts.Retries),
+		chain.TimeoutRouterOption(opts.Timeout),
+		chain.InterfaceRouterOption(opts.IfceName),
+		chain.NetnsRouterOption(opts.Netns),
+		chain.SockOptsRouterOption(opts.SockOpts),
+		chain.ChainRouterOption(opts.Chain),
+		chain.ResolverRouterOption(opts.Resolver),
+		chain.HostMapperRouterOption(opts.HostMapper),
+		chain.RecordersRouterOption(opts.Recorders...),
+		chain.LoggerRouterOption(opts.Logger),
+	)
+}
+
+// Match returns the route of the target address, it returns nil if the table is nil.
+func (t *routeTable) Match(addr string) *route {
+	if t == nil {
+		return nil
+	}
+
+	host := addr
+	if h, _, _ := net.SplitHostPort(addr); h != "" {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	if r := t.exact[host]; r != nil {
+		return r
+	}
+	for _, w := range t.wildcards {
+		if strings.HasSuffix(host, w.suffix) {
+			return w.route
+		}
+	}
+	return t.fallback
+}
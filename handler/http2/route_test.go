@@ -0,0 +1,65 @@
+package http2
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-gost/core/chain"
+	xchain "github.com/go-gost/x/chain"
+	xlogger "github.com/go-gost/x/logger"
+	xmd "github.com/go-gost/x/metadata"
+	"github.com/go-gost/x/registry"
+)
+
+func TestParseRouteTable(t *testing.T) {
+	registry.ChainRegistry().Register("test-route-chain", xchain.NewChain("test-route-chain"))
+	defer registry.ChainRegistry().Unregister("test-route-chain")
+
+	router := xchain.NewRouter(chain.LoggerRouterOption(xlogger.Nop()))
+
+	tests := []struct {
+		name   string
+		routes map[string]any
+		err    error
+	}{
+		{name: "registered chain", routes: map[string]any{"*.example.com": "test-route-chain"}},
+		{name: "direct", routes: map[string]any{"*": "direct"}},
+		{name: "unknown chain", routes: map[string]any{"example.com": "test-route-unknown"}, err: ErrRouteChain},
+		{name: "unknown default chain", routes: map[string]any{"*": "test-route-unknown"}, err: ErrRouteChain},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRouteTable(xmd.NewMetadata(map[string]any{"routes": tt.routes}), router)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRouteChainUnregistered(t *testing.T) {
+	registry.ChainRegistry().Register("test-route-deleted", xchain.NewChain("test-route-deleted"))
+
+	router := xchain.NewRouter(chain.LoggerRouterOption(xlogger.Nop()))
+	rt, err := parseRouteTable(xmd.NewMetadata(map[string]any{
+		"routes": map[string]any{"example.com": "test-route-deleted"},
+	}), router)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rt.Match("example.com:443")
+	if err := r.Err(); err != nil {
+		t.Fatalf("registered chain: %v", err)
+	}
+
+	// the chain deleted after Init rejects the request instead of the direct dial.
+	registry.ChainRegistry().Unregister("test-route-deleted")
+	if err := r.Err(); !errors.Is(err, ErrRouteChain) {
+		t.Errorf("deleted chain: got %v, want %v", err, ErrRouteChain)
+	}
+	if err := rt.Match("example.org:443").Err(); err != nil {
+		t.Errorf("default route: %v", err)
+	}
+}
@@ -12,6 +12,7 @@ type metadata struct {
 	probeResistance *probeResistance
 	header          http.Header
 	hash            string
+	maskIP          bool
 }
 
 func (h *http3Handler) parseMetadata(md mdata.Metadata) error {
@@ -21,6 +22,7 @@ func (h *http3Handler) parseMetadata(md mdata.Metadata) error {
 		probeResistKeyX = "probe_resist"
 		knock           = "knock"
 		hash            = "hash"
+		maskIP          = "maskIP"
 	)
 
 	if m := mdutil.GetStringMapString(md, header); len(m) > 0 {
@@ -46,6 +48,7 @@ func (h *http3Handler) parseMetadata(md mdata.Metadata) error {
 	}
 	h.md.hash = mdutil.GetString(md, hash)
 
+	h.md.maskIP = mdutil.GetBool(md, maskIP)
 	return nil
 }
 
@@ -54,3 +57,13 @@ type probeResistance struct {
 	Value string
 	Knock string
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"hash",
+	"header",
+	"knock",
+	"maskIP",
+	"probe_resist",
+	"probeResistance",
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/go-gost/core/handler"
 	md "github.com/go-gost/core/metadata"
+	mdx "github.com/go-gost/x/metadata"
 	xmetrics "github.com/go-gost/x/metrics"
 	"github.com/go-gost/x/registry"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -16,6 +17,7 @@ import (
 
 func init() {
 	registry.HandlerRegistry().Register("metrics", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "metrics", schema...)
 }
 
 type metricsHandler struct {
@@ -42,7 +44,10 @@ func (h *metricsHandler) Init(md md.Metadata) (err error) {
 		return
 	}
 
-	xmetrics.Init(xmetrics.NewMetrics())
+	xmetrics.Init(xmetrics.NewMetrics(
+		xmetrics.BucketsOption(xmetrics.MetricServiceDialDurationObserver, h.md.dialBuckets),
+		xmetrics.BucketsOption(xmetrics.MetricServiceHandshakeDurationObserver, h.md.handshakeBuckets),
+	))
 	h.handler = promhttp.Handler()
 
 	mux := http.NewServeMux()
@@ -1,6 +1,10 @@
 package file
 
 import (
+	"sort"
+	"strconv"
+	"strings"
+
 	mdata "github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/core/metadata/util"
 )
@@ -11,6 +15,9 @@ const (
 
 type metadata struct {
 	path string
+	// the buckets (in seconds) of the dial and handshake latency histograms.
+	dialBuckets      []float64
+	handshakeBuckets []float64
 }
 
 func (h *metricsHandler) parseMetadata(md mdata.Metadata) (err error) {
@@ -18,5 +25,35 @@ func (h *metricsHandler) parseMetadata(md mdata.Metadata) (err error) {
 	if h.md.path == "" {
 		h.md.path = DefaultPath
 	}
+
+	h.md.dialBuckets = parseBuckets(mdutil.GetStrings(md, "metrics.dialBuckets"))
+	h.md.handshakeBuckets = parseBuckets(mdutil.GetStrings(md, "metrics.handshakeBuckets"))
 	return
 }
+
+func parseBuckets(ss []string) (buckets []float64) {
+	for _, s := range ss {
+		if v, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil && v > 0 {
+			buckets = append(buckets, v)
+		}
+	}
+	sort.Float64s(buckets)
+
+	// the buckets must be in strictly increasing order.
+	n := 0
+	for i, v := range buckets {
+		if i == 0 || v != buckets[n-1] {
+			buckets[n] = v
+			n++
+		}
+	}
+	return buckets[:n]
+}
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"metrics.dialBuckets",
+	"metrics.handshakeBuckets",
+	"metrics.path",
+	"path",
+}
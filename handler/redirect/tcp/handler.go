@@ -21,13 +21,18 @@ import (
 	dissector "github.com/go-gost/tls-dissector"
 	xio "github.com/go-gost/x/internal/io"
 	netpkg "github.com/go-gost/x/internal/net"
+	xlogger "github.com/go-gost/x/logger"
+	mdx "github.com/go-gost/x/metadata"
 	"github.com/go-gost/x/registry"
 )
 
 func init() {
 	registry.HandlerRegistry().Register("red", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "red", schema...)
 	registry.HandlerRegistry().Register("redir", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "redir", schema...)
 	registry.HandlerRegistry().Register("redirect", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "redirect", schema...)
 }
 
 type redirectHandler struct {
@@ -62,6 +67,9 @@ func (h *redirectHandler) Handle(ctx context.Context, conn net.Conn, opts ...han
 		"remote": conn.RemoteAddr().String(),
 		"local":  conn.LocalAddr().String(),
 	})
+	if h.md.maskIP {
+		log = xlogger.MaskIP(log, conn.RemoteAddr())
+	}
 
 	log.Infof("%s <> %s", conn.RemoteAddr(), conn.LocalAddr())
 	defer func() {
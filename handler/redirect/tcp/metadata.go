@@ -11,11 +11,21 @@ type metadata struct {
 	tproxy          bool
 	sniffing        bool
 	sniffingTimeout time.Duration
+	maskIP          bool
 }
 
 func (h *redirectHandler) parseMetadata(md mdata.Metadata) (err error) {
 	h.md.tproxy = mdutil.GetBool(md, "tproxy")
 	h.md.sniffing = mdutil.GetBool(md, "sniffing")
 	h.md.sniffingTimeout = mdutil.GetDuration(md, "sniffing.timeout")
+	h.md.maskIP = mdutil.GetBool(md, "maskIP")
 	return
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"maskIP",
+	"sniffing",
+	"sniffing.timeout",
+	"tproxy",
+}
@@ -2,10 +2,19 @@ package redirect
 
 import (
 	mdata "github.com/go-gost/core/metadata"
+	mdutil "github.com/go-gost/core/metadata/util"
 )
 
-type metadata struct{}
+type metadata struct {
+	maskIP bool
+}
 
 func (h *redirectHandler) parseMetadata(md mdata.Metadata) (err error) {
+	h.md.maskIP = mdutil.GetBool(md, "maskIP")
 	return
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"maskIP",
+}
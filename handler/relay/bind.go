@@ -2,6 +2,7 @@ package relay
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"time"
@@ -18,7 +19,7 @@ import (
 	xservice "github.com/go-gost/x/service"
 )
 
-func (h *relayHandler) handleBind(ctx context.Context, conn net.Conn, network, address string, log logger.Logger) error {
+func (h *relayHandler) handleBind(ctx context.Context, conn net.Conn, network, address string, compress bool, log logger.Logger) error {
 	log = log.WithFields(map[string]any{
 		"dst": fmt.Sprintf("%s/%s", address, network),
 		"cmd": "bind",
@@ -34,14 +35,14 @@ func (h *relayHandler) handleBind(ctx context.Context, conn net.Conn, network, a
 	if !h.md.enableBind {
 		resp.Status = relay.StatusForbidden
 		log.Error("relay: BIND is disabled")
-		_, err := resp.WriteTo(conn)
+		err := h.writeResponse(conn, &resp)
 		return err
 	}
 
 	if network == "tcp" {
 		return h.bindTCP(ctx, conn, network, address, log)
 	} else {
-		return h.bindUDP(ctx, conn, network, address, log)
+		return h.bindUDP(ctx, conn, network, address, compress, log)
 	}
 }
 
@@ -58,7 +59,7 @@ func (h *relayHandler) bindTCP(ctx context.Context, conn net.Conn, network, addr
 	if err != nil {
 		log.Error(err)
 		resp.Status = relay.StatusServiceUnavailable
-		resp.WriteTo(conn)
+		h.writeResponse(conn, &resp)
 		return err
 	}
 	defer ln.Close()
@@ -76,7 +77,7 @@ func (h *relayHandler) bindTCP(ctx context.Context, conn net.Conn, network, addr
 		log.Warn(err)
 	}
 	resp.Features = append(resp.Features, af)
-	if _, err := resp.WriteTo(conn); err != nil {
+	if err := h.writeResponse(conn, &resp); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -128,16 +129,13 @@ func (h *relayHandler) bindTCP(ctx context.Context, conn net.Conn, network, addr
 	return srv.Serve()
 }
 
-func (h *relayHandler) bindUDP(ctx context.Context, conn net.Conn, network, address string, log logger.Logger) error {
+func (h *relayHandler) bindUDP(ctx context.Context, conn net.Conn, network, address string, compress bool, log logger.Logger) error {
 	resp := relay.Response{
 		Version: relay.Version1,
 		Status:  relay.StatusOK,
 	}
 
-	lc := xnet.ListenConfig{
-		Netns: h.options.Netns,
-	}
-	pc, err := lc.ListenPacket(ctx, network, address)
+	pc, err := h.listenUDP(ctx, network, address, log)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -161,7 +159,10 @@ func (h *relayHandler) bindUDP(ctx context.Context, conn net.Conn, network, addr
 		log.Warn(err)
 	}
 	resp.Features = append(resp.Features, af)
-	if _, err := resp.WriteTo(conn); err != nil {
+	if compress {
+		resp.Features = append(resp.Features, &relay_util.CompressionFeature{})
+	}
+	if err := h.writeResponse(conn, &resp); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -169,9 +170,13 @@ func (h *relayHandler) bindUDP(ctx context.Context, conn net.Conn, network, addr
 	log = log.WithFields(map[string]any{
 		"bind": pc.LocalAddr().String(),
 	})
-	log.Debugf("bind on %s OK", pc.LocalAddr())
+	log.Debugf("bind on %s OK, compression: %v", pc.LocalAddr(), compress)
 
-	r := udp.NewRelay(relay_util.UDPTunServerConn(conn), pc).
+	tc := relay_util.UDPTunServerConn(conn,
+		relay_util.MaxDatagramSizeUDPTunOption(h.md.udpMaxDatagramSize),
+		relay_util.CompressionUDPTunOption(compress),
+	)
+	r := udp.NewRelay(tc, pc).
 		WithBypass(h.options.Bypass).
 		WithLogger(log)
 	r.SetBufferSize(h.md.udpBufferSize)
@@ -184,3 +189,20 @@ func (h *relayHandler) bindUDP(ctx context.Context, conn net.Conn, network, addr
 	}).Debugf("%s >-< %s", conn.RemoteAddr(), pc.LocalAddr())
 	return nil
 }
+
+// listenUDP listens on the address, with the transparent socket if it is enabled,
+// and the normal socket is the fallback if the transparent socket is not permitted,
+// which fails if the address is not local.
+func (h *relayHandler) listenUDP(ctx context.Context, network, address string, log logger.Logger) (net.PacketConn, error) {
+	lc := xnet.ListenConfig{
+		Netns: h.options.Netns,
+	}
+	if h.md.udpTransparent {
+		pc, err := udp.ListenTransparent(ctx, &lc, network, address)
+		if !errors.Is(err, udp.ErrTransparent) {
+			return pc, err
+		}
+		log.Warnf("%v, fallback to the non-transparent socket on %s", err, address)
+	}
+	return lc.ListenPacket(ctx, network, address)
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"math"
 	"net"
+	"sync"
 )
 
 type tcpConn struct {
@@ -32,6 +33,7 @@ func (c *tcpConn) Write(b []byte) (n int, err error) {
 type udpConn struct {
 	net.Conn
 	wbuf bytes.Buffer
+	mu   sync.Mutex
 }
 
 func (c *udpConn) Read(b []byte) (n int, err error) {
@@ -58,6 +60,9 @@ func (c *udpConn) Write(b []byte) (n int, err error) {
 		return
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	n = len(b)
 	if c.wbuf.Len() > 0 {
 		var bb [2]byte
@@ -76,3 +81,18 @@ func (c *udpConn) Write(b []byte) (n int, err error) {
 	}
 	return c.Conn.Write(b)
 }
+
+// abort sends the cached header with the status instead of OK,
+// it reports false if the header has been sent with the datagrams.
+func (c *udpConn) abort(status uint8) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.wbuf.Len() < 2 {
+		return false
+	}
+	// the header is VER(1) STATUS(1) FEATURES...
+	c.wbuf.Bytes()[1] = status
+	c.wbuf.WriteTo(c.Conn)
+	return true
+}
@@ -6,16 +6,23 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"syscall"
 	"time"
 
 	"github.com/go-gost/core/limiter"
 	"github.com/go-gost/core/logger"
+	"github.com/go-gost/core/metrics"
 	"github.com/go-gost/core/observer/stats"
 	"github.com/go-gost/relay"
 	ctxvalue "github.com/go-gost/x/ctx"
 	xnet "github.com/go-gost/x/internal/net"
+	bypass_util "github.com/go-gost/x/internal/util/bypass"
+	"github.com/go-gost/x/internal/util/conntrack"
+	relay_util "github.com/go-gost/x/internal/util/relay"
 	serial "github.com/go-gost/x/internal/util/serial"
 	traffic_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	xmetrics "github.com/go-gost/x/metrics"
+	"github.com/go-gost/x/observer/event"
 	stats_wrapper "github.com/go-gost/x/observer/stats/wrapper"
 )
 
@@ -40,19 +47,40 @@ func (h *relayHandler) handleConnect(ctx context.Context, conn net.Conn, network
 
 	if address == "" {
 		resp.Status = relay.StatusBadRequest
-		resp.WriteTo(conn)
+		h.writeResponse(conn, &resp)
 		err = errors.New("target not specified")
 		log.Error(err)
 		return
 	}
 
-	if h.options.Bypass != nil && h.options.Bypass.Contains(ctx, network, address) {
-		log.Debug("bypass: ", address)
+	if err = h.md.ports.Check(address); err != nil {
+		event.ConnTraceFromContext(ctx).Denied("ports")
+		log.Warn(err)
 		resp.Status = relay.StatusForbidden
-		_, err = resp.WriteTo(conn)
+		h.writeResponse(conn, &resp)
 		return
 	}
 
+	var sinkhole *bypass_util.Action
+	if h.options.Bypass != nil && h.options.Bypass.Contains(ctx, network, address) {
+		action := h.md.bypassAction
+		action.Observe(h.options.Service)
+		log = log.WithFields(map[string]any{"bypass": action.Type})
+		log.Debug("bypass: ", address)
+
+		switch action.Type {
+		case bypass_util.ActionDrop:
+			return
+		case bypass_util.ActionSinkhole:
+			sinkhole = action
+		default:
+			event.ConnTraceFromContext(ctx).Denied("bypass")
+			resp.Status = relay.StatusForbidden
+			err = h.writeResponse(conn, &resp)
+			return
+		}
+	}
+
 	switch h.md.hash {
 	case "host":
 		ctx = ctxvalue.ContextWithHash(ctx, &ctxvalue.Hash{Source: address})
@@ -60,40 +88,45 @@ func (h *relayHandler) handleConnect(ctx context.Context, conn net.Conn, network
 
 	var cc io.ReadWriteCloser
 
-	switch network {
-	case "unix":
+	switch {
+	case sinkhole != nil:
+		cc, err = sinkhole.Dial(ctx, network)
+	case network == "unix":
 		cc, err = (&net.Dialer{}).DialContext(ctx, "unix", address)
-	case "serial":
+	case network == "serial":
 		cc, err = serial.OpenPort(serial.ParseConfigFromAddr(address))
 	default:
+		span := xmetrics.StartSpan(xmetrics.MetricServiceDialDurationObserver, h.options.Service)
 		cc, err = h.options.Router.Dial(ctx, network, address)
+		span.End(err)
 	}
 	if err != nil {
 		resp.Status = relay.StatusNetworkUnreachable
-		resp.WriteTo(conn)
+		h.writeResponse(conn, &resp)
 		return err
 	}
 	defer cc.Close()
 
 	if h.md.noDelay {
-		if _, err := resp.WriteTo(conn); err != nil {
+		if err := h.writeResponse(conn, &resp); err != nil {
 			log.Error(err)
 			return err
 		}
 	}
 
+	var uc *udpConn
 	switch network {
 	case "udp", "udp4", "udp6":
-		rc := &udpConn{
+		uc = &udpConn{
 			Conn: conn,
 		}
 		if !h.md.noDelay {
 			// cache the header
-			if _, err := resp.WriteTo(&rc.wbuf); err != nil {
+			if _, err := resp.WriteTo(&uc.wbuf); err != nil {
 				return err
 			}
 		}
-		conn = rc
+		conn = uc
 	default:
 		if !h.md.noDelay {
 			rc := &tcpConn{
@@ -108,16 +141,20 @@ func (h *relayHandler) handleConnect(ctx context.Context, conn net.Conn, network
 	}
 
 	clientID := ctxvalue.ClientIDFromContext(ctx)
-	rw := traffic_wrapper.WrapReadWriter(
+	rw := traffic_wrapper.WrapReadWriterScopes(
 		h.limiter,
 		conn,
-		string(clientID),
-		limiter.ScopeOption(limiter.ScopeClient),
-		limiter.ServiceOption(h.options.Service),
-		limiter.NetworkOption(network),
-		limiter.AddrOption(address),
-		limiter.ClientOption(string(clientID)),
-		limiter.SrcOption(conn.RemoteAddr().String()),
+		traffic_wrapper.Scope{
+			Key: string(clientID),
+			Opts: []limiter.Option{
+				limiter.ScopeOption(limiter.ScopeClient),
+				limiter.ServiceOption(h.options.Service),
+				limiter.NetworkOption(network),
+				limiter.AddrOption(address),
+				limiter.ClientOption(string(clientID)),
+				limiter.SrcOption(conn.RemoteAddr().String()),
+			},
+		},
 	)
 	if h.options.Observer != nil {
 		pstats := h.stats.Stats(string(clientID))
@@ -127,12 +164,62 @@ func (h *relayHandler) handleConnect(ctx context.Context, conn net.Conn, network
 		rw = stats_wrapper.WrapReadWriter(rw, pstats)
 	}
 
+	tc := conntrack.Track(h.options.Service, string(clientID), conn.RemoteAddr().String(), address, log, conn, cc)
+	defer tc.Untrack()
+	rw = tc.WrapReadWriter(rw)
+
 	t := time.Now()
 	log.Infof("%s <-> %s", conn.RemoteAddr(), address)
-	xnet.Transport(rw, cc)
+	if uc == nil {
+		xnet.Transport(rw, cc)
+	} else if err := xnet.TransportWithIdleTimeout(rw, cc, h.md.udpIdleTimeout); err != nil {
+		h.closeUDP(cc, uc, address, err, log)
+	}
 	log.WithFields(map[string]any{
 		"duration": time.Since(t),
 	}).Infof("%s >-< %s", conn.RemoteAddr(), address)
 
 	return nil
 }
+
+// closeUDP closes the UDP association of CONNECT by the error of the transport.
+// The target dialed directly is a connected UDP socket, so its ICMP errors surface as the errors of the read or write,
+// then the client is sent the status of the error instead of OK if no datagram has been sent to it,
+// otherwise the association is just closed.
+func (h *relayHandler) closeUDP(cc io.Closer, uc *udpConn, address string, err error, log logger.Logger) {
+	if errors.Is(err, xnet.ErrIdleTimeout) {
+		log.Debugf("%s: %v", address, err)
+		return
+	}
+
+	status, reason := unreachable(err)
+	if reason == "" {
+		return
+	}
+	log.Warnf("%s: %v", address, err)
+
+	if v := xmetrics.GetCounter(xmetrics.MetricServiceUDPUnreachableCounter,
+		metrics.Labels{"service": h.options.Service, "reason": reason}); v != nil {
+		v.Inc()
+	}
+
+	cc.Close()
+	if uc.abort(status) {
+		log.Debugf("%s: status %d %s", address, status, relay_util.StatusText(status))
+	}
+}
+
+// unreachable returns the status and the reason of the ICMP error surfaced by the connected UDP socket,
+// the reason is empty if err is not an ICMP error.
+func unreachable(err error) (status uint8, reason string) {
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return relay_util.StatusPortUnreachable, "port"
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return relay.StatusHostUnreachable, "host"
+	case errors.Is(err, syscall.ENETUNREACH):
+		return relay.StatusNetworkUnreachable, "network"
+	default:
+		return
+	}
+}
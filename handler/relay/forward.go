@@ -25,7 +25,7 @@ func (h *relayHandler) handleForward(ctx context.Context, conn net.Conn, network
 	target := h.hop.Select(ctx)
 	if target == nil {
 		resp.Status = relay.StatusServiceUnavailable
-		resp.WriteTo(conn)
+		h.writeResponse(conn, &resp)
 		err := errors.New("target not available")
 		log.Error(err)
 		return err
@@ -47,7 +47,7 @@ func (h *relayHandler) handleForward(ctx context.Context, conn net.Conn, network
 		}
 
 		resp.Status = relay.StatusHostUnreachable
-		resp.WriteTo(conn)
+		h.writeResponse(conn, &resp)
 		log.Error(err)
 
 		return err
@@ -58,7 +58,7 @@ func (h *relayHandler) handleForward(ctx context.Context, conn net.Conn, network
 	}
 
 	if h.md.noDelay {
-		if _, err := resp.WriteTo(conn); err != nil {
+		if err := h.writeResponse(conn, &resp); err != nil {
 			log.Error(err)
 			return err
 		}
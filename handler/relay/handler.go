@@ -13,8 +13,16 @@ import (
 	md "github.com/go-gost/core/metadata"
 	"github.com/go-gost/relay"
 	ctxvalue "github.com/go-gost/x/ctx"
+	"github.com/go-gost/x/internal/util/drain"
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
+	relay_util "github.com/go-gost/x/internal/util/relay"
+	resolver_util "github.com/go-gost/x/internal/util/resolver"
 	stats_util "github.com/go-gost/x/internal/util/stats"
+	tls_util "github.com/go-gost/x/internal/util/tls"
+	xlogger "github.com/go-gost/x/logger"
+	mdx "github.com/go-gost/x/metadata"
+	xmetrics "github.com/go-gost/x/metrics"
+	"github.com/go-gost/x/observer/event"
 	"github.com/go-gost/x/registry"
 )
 
@@ -27,6 +35,7 @@ var (
 
 func init() {
 	registry.HandlerRegistry().Register("relay", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "relay", schema...)
 }
 
 type relayHandler struct {
@@ -36,6 +45,8 @@ type relayHandler struct {
 	stats   *stats_util.HandlerStats
 	limiter traffic.TrafficLimiter
 	cancel  context.CancelFunc
+	tracker drain.Tracker
+	events  *event.ConnEmitter
 }
 
 func NewHandler(opts ...handler.Option) handler.Handler {
@@ -66,6 +77,10 @@ func (h *relayHandler) Init(md md.Metadata) (err error) {
 		h.limiter = limiter_util.NewCachedTrafficLimiter(limiter, 30*time.Second, 60*time.Second)
 	}
 
+	if h.md.connEvents {
+		h.events = event.NewConnEmitter(h.options.Observer, h.options.Service, h.md.connEventsOpts)
+	}
+
 	return nil
 }
 
@@ -75,11 +90,21 @@ func (h *relayHandler) Forward(hop hop.Hop) {
 }
 
 func (h *relayHandler) Handle(ctx context.Context, conn net.Conn, opts ...handler.HandleOption) (err error) {
+	if h.md.resolver != nil {
+		ctx = ctxvalue.ContextWithResolver(ctx, h.md.resolver)
+	}
+	if h.md.dnsCache != nil {
+		ctx = resolver_util.ContextWithLookupCache(ctx, h.md.dnsCache)
+	}
+
 	start := time.Now()
 	log := h.options.Logger.WithFields(map[string]any{
 		"remote": conn.RemoteAddr().String(),
 		"local":  conn.LocalAddr().String(),
 	})
+	if h.md.maskIP {
+		log = xlogger.MaskIP(log, conn.RemoteAddr())
+	}
 
 	log.Infof("%s <> %s", conn.RemoteAddr(), conn.LocalAddr())
 
@@ -92,7 +117,17 @@ func (h *relayHandler) Handle(ctx context.Context, conn net.Conn, opts ...handle
 		}).Infof("%s >< %s", conn.RemoteAddr(), conn.LocalAddr())
 	}()
 
+	if !h.tracker.Add(conn) {
+		return drain.ErrDraining
+	}
+	defer h.tracker.Remove(conn)
+
+	trace := h.events.Trace(conn.RemoteAddr().String())
+	defer func() { trace.Closed(err) }()
+	ctx = event.ContextWithConnTrace(ctx, trace)
+
 	if !h.checkRateLimit(conn.RemoteAddr()) {
+		trace.Denied("rateLimit")
 		return ErrRateLimit
 	}
 
@@ -101,7 +136,18 @@ func (h *relayHandler) Handle(ctx context.Context, conn net.Conn, opts ...handle
 	}
 
 	req := relay.Request{}
-	if _, err := req.ReadFrom(conn); err != nil {
+	span := xmetrics.StartSpan(xmetrics.MetricServiceHandshakeDurationObserver, h.options.Service)
+	err = relay_util.ReadRequest(conn, &req, h.md.requestLimits)
+	span.End(err)
+	if err != nil {
+		if relay_util.IsLimitExceeded(err) {
+			log.Warnf("%s: %v", conn.RemoteAddr(), err)
+			relay_util.ObserveRejected(h.options.Service, err)
+			h.writeResponse(conn, &relay.Response{
+				Version: relay.Version1,
+				Status:  relay.StatusBadRequest,
+			})
+		}
 		return err
 	}
 
@@ -114,7 +160,7 @@ func (h *relayHandler) Handle(ctx context.Context, conn net.Conn, opts ...handle
 
 	if req.Version != relay.Version1 {
 		resp.Status = relay.StatusBadRequest
-		resp.WriteTo(conn)
+		h.writeResponse(conn, &resp)
 		return ErrBadVersion
 	}
 
@@ -145,18 +191,40 @@ func (h *relayHandler) Handle(ctx context.Context, conn net.Conn, opts ...handle
 	if h.options.Auther != nil {
 		clientID, ok := h.options.Auther.Authenticate(ctx, user, pass)
 		if !ok {
+			trace.Denied("auth")
 			resp.Status = relay.StatusUnauthorized
-			resp.WriteTo(conn)
+			h.writeResponse(conn, &resp)
 			return ErrUnauthorized
 		}
 		ctx = ctxvalue.ContextWithClientID(ctx, ctxvalue.ClientID(clientID))
 	}
+	if ctxvalue.ClientIDFromContext(ctx) == "" {
+		// the client ID from the certificate verified by the TLS listener.
+		if clientID := tls_util.ClientID(conn); clientID != "" {
+			ctx = ctxvalue.ContextWithClientID(ctx, ctxvalue.ClientID(clientID))
+		}
+	}
+
+	clientID := string(ctxvalue.ClientIDFromContext(ctx))
+	trace.Authenticated(clientID)
+	conn = trace.WrapConn(conn)
+
+	if err := h.md.schedule.Check(clientID); err != nil {
+		trace.Denied("schedule")
+		log.Warn(err)
+		resp.Status = relay.StatusUnauthorized
+		h.writeResponse(conn, &resp)
+		return ErrUnauthorized
+	}
+	defer h.md.schedule.Watch(clientID, conn)()
 
 	network := networkID.String()
 	if (req.Cmd & relay.FUDP) == relay.FUDP {
 		network = "udp"
 	}
 
+	trace.Opened(address)
+
 	if h.hop != nil {
 		defer conn.Close()
 		// forward mode
@@ -171,19 +239,28 @@ func (h *relayHandler) Handle(ctx context.Context, conn net.Conn, opts ...handle
 	case relay.CmdBind:
 		defer conn.Close()
 
-		return h.handleBind(ctx, conn, network, address, log)
+		// the compression takes effect only if both sides support it.
+		compress := h.md.udpCompression && (req.Cmd&relay_util.FCompress) == relay_util.FCompress
+		return h.handleBind(ctx, conn, network, address, compress, log)
 	default:
 		resp.Status = relay.StatusBadRequest
-		resp.WriteTo(conn)
+		h.writeResponse(conn, &resp)
 		return ErrUnknownCmd
 	}
 }
 
+// Drain implements the service.Drainer interface,
+// it rejects new connections and waits for the active connections to finish.
+func (h *relayHandler) Drain(ctx context.Context) (forced int, err error) {
+	return h.tracker.Drain(ctx)
+}
+
 // Close implements io.Closer interface.
 func (h *relayHandler) Close() error {
 	if h.cancel != nil {
 		h.cancel()
 	}
+	h.events.Close()
 	return nil
 }
 
@@ -220,3 +297,13 @@ func (h *relayHandler) observeStats(ctx context.Context) {
 		}
 	}
 }
+
+// writeResponse writes the response of the handshake to conn, the write is bounded by the writeTimeout.
+func (h *relayHandler) writeResponse(conn net.Conn, resp *relay.Response) error {
+	if h.md.writeTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(h.md.writeTimeout))
+		defer conn.SetWriteDeadline(time.Time{})
+	}
+	_, err := resp.WriteTo(conn)
+	return err
+}
@@ -0,0 +1,76 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-gost/core/chain"
+	"github.com/go-gost/core/handler"
+	"github.com/go-gost/relay"
+	xchain "github.com/go-gost/x/chain"
+	xlogger "github.com/go-gost/x/logger"
+	xmd "github.com/go-gost/x/metadata"
+)
+
+func TestHandleSlowClient(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+
+	// the CONNECT request without the target is answered by the handler.
+	var req bytes.Buffer
+	(&relay.Request{Version: relay.Version1, Cmd: relay.CmdConnect}).WriteTo(&req)
+
+	tests := []struct {
+		name string
+		// the data sent by the client, which never reads.
+		data []byte
+	}{
+		{name: "no request"},
+		// the request is sent partially.
+		{name: "partial request", data: req.Bytes()[:2]},
+		// the response is never read by the client.
+		{name: "slow reader", data: req.Bytes()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(
+				handler.RouterOption(xchain.NewRouter(chain.LoggerRouterOption(xlogger.Nop()))),
+				handler.LoggerOption(xlogger.Nop()),
+			)
+			if err := h.Init(xmd.NewMetadata(map[string]any{
+				"readTimeout": timeout.String(),
+			})); err != nil {
+				t.Fatal(err)
+			}
+
+			client, server := net.Pipe()
+			defer client.Close()
+
+			done := make(chan error, 1)
+			start := time.Now()
+			go func() {
+				done <- h.Handle(context.Background(), server)
+			}()
+			for _, b := range tt.data {
+				if _, err := client.Write([]byte{b}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			select {
+			case err := <-done:
+				if err == nil {
+					t.Error("the slow client is not dropped")
+				}
+				if d := time.Since(start); d < timeout {
+					t.Errorf("dropped after %v, before the timeout %v", d, timeout)
+				}
+			case <-time.After(10 * timeout):
+				t.Fatal("the slow client is not dropped within the timeout")
+			}
+		})
+	}
+}
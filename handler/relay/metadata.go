@@ -6,21 +6,53 @@ import (
 
 	mdata "github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/core/metadata/util"
+	"github.com/go-gost/core/resolver"
+	bypass_util "github.com/go-gost/x/internal/util/bypass"
 	"github.com/go-gost/x/internal/util/mux"
+	port_util "github.com/go-gost/x/internal/util/port"
+	relay_util "github.com/go-gost/x/internal/util/relay"
+	resolver_util "github.com/go-gost/x/internal/util/resolver"
+	"github.com/go-gost/x/internal/util/schedule"
+	"github.com/go-gost/x/observer/event"
+	"github.com/go-gost/x/registry"
 )
 
 type metadata struct {
 	readTimeout   time.Duration
+	writeTimeout  time.Duration
 	enableBind    bool
 	udpBufferSize int
 	noDelay       bool
 	hash          string
 	muxCfg        *mux.Config
 	observePeriod time.Duration
+	// the maximum size of the UDP-over-TCP datagram received from the client.
+	udpMaxDatagramSize int
+	udpCompression     bool
+	// the idle timeout of the UDP associations of CONNECT, 0 for none.
+	udpIdleTimeout time.Duration
+	// binds the UDP socket of BIND with IP_TRANSPARENT, so the bind address can be the non-local original destination.
+	udpTransparent bool
+	resolver       resolver.Resolver
+	dnsCache       *resolver_util.LookupCache
+	bypassAction   *bypass_util.Action
+	requestLimits  *relay_util.RequestLimits
+	// the time-of-day access policies of the clients, nil if disabled.
+	schedule *schedule.Schedule
+	maskIP   bool
+	// emits the lifecycle events of the connections through the observer.
+	connEvents     bool
+	connEventsOpts event.ConnEmitterOptions
+	// the ports of the targets allowed and denied, nil allows any port.
+	ports *port_util.Policy
 }
 
 func (h *relayHandler) parseMetadata(md mdata.Metadata) (err error) {
 	h.md.readTimeout = mdutil.GetDuration(md, "readTimeout")
+	h.md.writeTimeout = mdutil.GetDuration(md, "writeTimeout")
+	if h.md.writeTimeout <= 0 {
+		h.md.writeTimeout = h.md.readTimeout
+	}
 	h.md.enableBind = mdutil.GetBool(md, "bind")
 	h.md.noDelay = mdutil.GetBool(md, "nodelay")
 
@@ -30,8 +62,19 @@ func (h *relayHandler) parseMetadata(md mdata.Metadata) (err error) {
 		h.md.udpBufferSize = 4096
 	}
 
+	h.md.udpMaxDatagramSize = mdutil.GetInt(md, "udpMaxDatagramSize")
+	h.md.udpCompression = mdutil.GetBool(md, "udpCompression")
+	h.md.udpIdleTimeout = mdutil.GetDuration(md, "udp.idleTimeout")
+	h.md.udpTransparent = mdutil.GetBool(md, "udp.transparent")
+
 	h.md.hash = mdutil.GetString(md, "hash")
 
+	h.md.requestLimits = &relay_util.RequestLimits{
+		MaxSize:         mdutil.GetInt(md, "relay.maxRequestSize"),
+		MaxFeatures:     mdutil.GetInt(md, "relay.maxFeatures"),
+		MaxStringLength: mdutil.GetInt(md, "relay.maxStringLength"),
+	}
+
 	h.md.muxCfg = &mux.Config{
 		Version:           mdutil.GetInt(md, "mux.version"),
 		KeepAliveInterval: mdutil.GetDuration(md, "mux.keepaliveInterval"),
@@ -40,9 +83,80 @@ func (h *relayHandler) parseMetadata(md mdata.Metadata) (err error) {
 		MaxFrameSize:      mdutil.GetInt(md, "mux.maxFrameSize"),
 		MaxReceiveBuffer:  mdutil.GetInt(md, "mux.maxReceiveBuffer"),
 		MaxStreamBuffer:   mdutil.GetInt(md, "mux.maxStreamBuffer"),
+		Compression:       mdutil.GetBool(md, "mux.compression"),
 	}
 
 	h.md.observePeriod = mdutil.GetDuration(md, "observePeriod")
 
+	h.md.bypassAction = bypass_util.ParseAction(mdutil.GetString(md, "bypass.action"))
+	if h.md.ports, err = port_util.NewPolicy(h.options.Service,
+		mdutil.GetStrings(md, "ports.allow"), mdutil.GetStrings(md, "ports.deny")); err != nil {
+		return
+	}
+	if h.md.schedule, err = schedule.New(schedule.Options{
+		Policies:  mdutil.GetStringMapString(md, "schedule"),
+		Default:   mdutil.GetString(md, "schedule.default"),
+		Terminate: mdutil.GetBool(md, "schedule.terminate"),
+	}); err != nil {
+		return
+	}
+
+	h.md.resolver = registry.ResolverRegistry().Get(mdutil.GetString(md, "resolver"))
+	if mdutil.GetBool(md, "dns.cache") {
+		h.md.dnsCache = resolver_util.NewLookupCache(h.options.Service, resolver_util.LookupCacheOptions{
+			TTL:        mdutil.GetDuration(md, "dns.cache.ttl"),
+			MaxEntries: mdutil.GetInt(md, "dns.cache.maxEntries"),
+			Stale:      mdutil.GetDuration(md, "dns.cache.stale"),
+		})
+	}
+
+	h.md.maskIP = mdutil.GetBool(md, "maskIP")
+
+	h.md.connEvents = mdutil.GetBool(md, "connEvents")
+	h.md.connEventsOpts = event.ConnEmitterOptions{
+		Sample: mdutil.GetFloat(md, "connEvents.sample"),
+		Rate:   mdutil.GetInt(md, "connEvents.rate"),
+	}
 	return
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"bind",
+	"bypass.action",
+	"connEvents",
+	"connEvents.rate",
+	"connEvents.sample",
+	"dns.cache",
+	"dns.cache.maxEntries",
+	"dns.cache.stale",
+	"dns.cache.ttl",
+	"hash",
+	"maskIP",
+	"mux.compression",
+	"mux.keepaliveDisabled",
+	"mux.keepaliveInterval",
+	"mux.keepaliveTimeout",
+	"mux.maxFrameSize",
+	"mux.maxReceiveBuffer",
+	"mux.maxStreamBuffer",
+	"mux.version",
+	"nodelay",
+	"observePeriod",
+	"ports.allow",
+	"ports.deny",
+	"readTimeout",
+	"relay.maxFeatures",
+	"relay.maxRequestSize",
+	"relay.maxStringLength",
+	"resolver",
+	"schedule",
+	"schedule.default",
+	"schedule.terminate",
+	"udp.idleTimeout",
+	"udp.transparent",
+	"udpBufferSize",
+	"udpCompression",
+	"udpMaxDatagramSize",
+	"writeTimeout",
+}
@@ -15,12 +15,14 @@ import (
 	"github.com/go-gost/core/recorder"
 	xnet "github.com/go-gost/x/internal/net"
 	serial "github.com/go-gost/x/internal/util/serial"
+	mdx "github.com/go-gost/x/metadata"
 	xrecorder "github.com/go-gost/x/recorder"
 	"github.com/go-gost/x/registry"
 )
 
 func init() {
 	registry.HandlerRegistry().Register("serial", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "serial", schema...)
 }
 
 type serialHandler struct {
@@ -20,3 +20,10 @@ func (h *serialHandler) parseMetadata(md mdata.Metadata) (err error) {
 	h.md.timeout = mdutil.GetDuration(md, "timeout", "serial.timeout", "handler.serial.timeout")
 	return
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"handler.serial.timeout",
+	"serial.timeout",
+	"timeout",
+}
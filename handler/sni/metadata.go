@@ -10,15 +10,25 @@ import (
 type metadata struct {
 	readTimeout time.Duration
 	hash        string
+	maskIP      bool
 }
 
 func (h *sniHandler) parseMetadata(md mdata.Metadata) (err error) {
 	const (
 		readTimeout = "readTimeout"
 		hash        = "hash"
+		maskIP      = "maskIP"
 	)
 
 	h.md.readTimeout = mdutil.GetDuration(md, readTimeout)
 	h.md.hash = mdutil.GetString(md, hash)
+	h.md.maskIP = mdutil.GetBool(md, maskIP)
 	return
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"hash",
+	"maskIP",
+	"readTimeout",
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/go-gost/core/handler"
@@ -15,21 +16,36 @@ import (
 	"github.com/go-gost/gosocks4"
 	ctxvalue "github.com/go-gost/x/ctx"
 	netpkg "github.com/go-gost/x/internal/net"
+	bypass_util "github.com/go-gost/x/internal/util/bypass"
+	"github.com/go-gost/x/internal/util/conntrack"
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
+	"github.com/go-gost/x/internal/util/socks"
 	stats_util "github.com/go-gost/x/internal/util/stats"
+	tls_util "github.com/go-gost/x/internal/util/tls"
 	traffic_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	xlogger "github.com/go-gost/x/logger"
+	mdx "github.com/go-gost/x/metadata"
+	xmetrics "github.com/go-gost/x/metrics"
 	stats_wrapper "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
 )
 
+const (
+	// the max length of the userid used as the client key.
+	maxUseridLength = 64
+)
+
 var (
 	ErrUnknownCmd    = errors.New("socks4: unknown command")
 	ErrUnimplemented = errors.New("socks4: unimplemented")
+	ErrCmdNotAllowed = errors.New("socks4: command not allowed")
 )
 
 func init() {
 	registry.HandlerRegistry().Register("socks4", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "socks4", schema...)
 	registry.HandlerRegistry().Register("socks4a", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "socks4a", schema...)
 }
 
 type socks4Handler struct {
@@ -74,12 +90,19 @@ func (h *socks4Handler) Init(md md.Metadata) (err error) {
 func (h *socks4Handler) Handle(ctx context.Context, conn net.Conn, opts ...handler.HandleOption) error {
 	defer conn.Close()
 
+	if h.md.resolver != nil {
+		ctx = ctxvalue.ContextWithResolver(ctx, h.md.resolver)
+	}
+
 	start := time.Now()
 
 	log := h.options.Logger.WithFields(map[string]any{
 		"remote": conn.RemoteAddr().String(),
 		"local":  conn.LocalAddr().String(),
 	})
+	if h.md.maskIP {
+		log = xlogger.MaskIP(log, conn.RemoteAddr())
+	}
 
 	log.Infof("%s <> %s", conn.RemoteAddr(), conn.LocalAddr())
 	defer func() {
@@ -96,7 +119,9 @@ func (h *socks4Handler) Handle(ctx context.Context, conn net.Conn, opts ...handl
 		conn.SetReadDeadline(time.Now().Add(h.md.readTimeout))
 	}
 
+	span := xmetrics.StartSpan(xmetrics.MetricServiceHandshakeDurationObserver, h.options.Service)
 	req, err := gosocks4.ReadRequest(conn)
+	span.End(err)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -105,6 +130,10 @@ func (h *socks4Handler) Handle(ctx context.Context, conn net.Conn, opts ...handl
 
 	conn.SetReadDeadline(time.Time{})
 
+	if user := userid(req.Userid); user != "" {
+		log = log.WithFields(map[string]any{"user": user})
+	}
+
 	if h.options.Auther != nil {
 		id, ok := h.options.Auther.Authenticate(ctx, string(req.Userid), "")
 		if !ok {
@@ -114,12 +143,29 @@ func (h *socks4Handler) Handle(ctx context.Context, conn net.Conn, opts ...handl
 		}
 		ctx = ctxvalue.ContextWithClientID(ctx, ctxvalue.ClientID(id))
 	}
+	if ctxvalue.ClientIDFromContext(ctx) == "" {
+		// the client ID from the certificate verified by the TLS listener.
+		if clientID := tls_util.ClientID(conn); clientID != "" {
+			ctx = ctxvalue.ContextWithClientID(ctx, ctxvalue.ClientID(clientID))
+		}
+	}
+
+	if !h.md.allowedCommands.Allowed(req.Cmd) {
+		err = ErrCmdNotAllowed
+		log.Warnf("%v: %d", err, req.Cmd)
+		resp := gosocks4.NewReply(gosocks4.Rejected, nil)
+		log.Trace(resp)
+		resp.Write(conn)
+		return err
+	}
 
 	switch req.Cmd {
 	case gosocks4.CmdConnect:
 		return h.handleConnect(ctx, conn, req, log)
 	case gosocks4.CmdBind:
 		return h.handleBind(ctx, conn, req)
+	case socks.CmdUDPTun:
+		return h.handleUDPTun(ctx, conn, req, log)
 	default:
 		err = ErrUnknownCmd
 		log.Error(err)
@@ -142,19 +188,61 @@ func (h *socks4Handler) handleConnect(ctx context.Context, conn net.Conn, req *g
 	})
 	log.Debugf("%s >> %s", conn.RemoteAddr(), addr)
 
-	if h.options.Bypass != nil && h.options.Bypass.Contains(ctx, "tcp", addr) {
+	if err := h.md.ports.Check(addr); err != nil {
+		log.Warn(err)
 		resp := gosocks4.NewReply(gosocks4.Rejected, nil)
 		log.Trace(resp)
-		log.Debug("bypass: ", addr)
 		return resp.Write(conn)
 	}
 
+	var sinkhole *bypass_util.Action
+	if h.options.Bypass != nil && h.options.Bypass.Contains(ctx, "tcp", addr) {
+		action := h.md.bypassAction
+		action.Observe(h.options.Service)
+		log = log.WithFields(map[string]any{"bypass": action.Type})
+		log.Debug("bypass: ", addr)
+
+		switch action.Type {
+		case bypass_util.ActionDrop:
+			return nil
+		case bypass_util.ActionSinkhole:
+			sinkhole = action
+		default:
+			resp := gosocks4.NewReply(gosocks4.Rejected, nil)
+			log.Trace(resp)
+			return resp.Write(conn)
+		}
+	}
+
 	switch h.md.hash {
 	case "host":
 		ctx = ctxvalue.ContextWithHash(ctx, &ctxvalue.Hash{Source: addr})
+	case "client":
+		if clientID := ctxvalue.ClientIDFromContext(ctx); clientID != "" {
+			ctx = ctxvalue.ContextWithHash(ctx, &ctxvalue.Hash{Source: string(clientID)})
+		}
+	case "src":
+		if host, _, _ := net.SplitHostPort(conn.RemoteAddr().String()); host != "" {
+			ctx = ctxvalue.ContextWithHash(ctx, &ctxvalue.Hash{Source: host})
+		}
+	}
+
+	if h.md.forwarded {
+		ctx = ctxvalue.ContextWithForwarded(ctx, &ctxvalue.Forwarded{
+			For:    conn.RemoteAddr().String(),
+			Target: addr,
+		})
 	}
 
-	cc, err := h.options.Router.Dial(ctx, "tcp", addr)
+	var cc net.Conn
+	var err error
+	if sinkhole != nil {
+		cc, err = sinkhole.Dial(ctx, "tcp")
+	} else {
+		span := xmetrics.StartSpan(xmetrics.MetricServiceDialDurationObserver, h.options.Service)
+		cc, err = h.options.Router.Dial(ctx, "tcp", addr)
+		span.End(err)
+	}
 	if err != nil {
 		resp := gosocks4.NewReply(gosocks4.Failed, nil)
 		log.Trace(resp)
@@ -172,16 +260,24 @@ func (h *socks4Handler) handleConnect(ctx context.Context, conn net.Conn, req *g
 	}
 
 	clientID := ctxvalue.ClientIDFromContext(ctx)
-	rw := traffic_wrapper.WrapReadWriter(
+	if clientID == "" {
+		// the userid keys the limiter and stats of the clients without authentication.
+		clientID = ctxvalue.ClientID(userid(req.Userid))
+	}
+	rw := traffic_wrapper.WrapReadWriterScopes(
 		h.limiter,
 		conn,
-		string(clientID),
-		limiter.ScopeOption(limiter.ScopeClient),
-		limiter.ServiceOption(h.options.Service),
-		limiter.NetworkOption("tcp"),
-		limiter.AddrOption(addr),
-		limiter.ClientOption(string(clientID)),
-		limiter.SrcOption(conn.RemoteAddr().String()),
+		traffic_wrapper.Scope{
+			Key: string(clientID),
+			Opts: []limiter.Option{
+				limiter.ScopeOption(limiter.ScopeClient),
+				limiter.ServiceOption(h.options.Service),
+				limiter.NetworkOption("tcp"),
+				limiter.AddrOption(addr),
+				limiter.ClientOption(string(clientID)),
+				limiter.SrcOption(conn.RemoteAddr().String()),
+			},
+		},
 	)
 	if h.options.Observer != nil {
 		pstats := h.stats.Stats(string(clientID))
@@ -191,9 +287,15 @@ func (h *socks4Handler) handleConnect(ctx context.Context, conn net.Conn, req *g
 		rw = stats_wrapper.WrapReadWriter(rw, pstats)
 	}
 
+	tc := conntrack.Track(h.options.Service, string(clientID), conn.RemoteAddr().String(), addr, log, conn, cc)
+	defer tc.Untrack()
+	rw = tc.WrapReadWriter(rw)
+
 	t := time.Now()
 	log.Infof("%s <-> %s", conn.RemoteAddr(), addr)
-	netpkg.Transport(rw, cc)
+	if err := netpkg.TransportWithIdleTimeout(rw, cc, h.md.idleTimeout); err == netpkg.ErrIdleTimeout {
+		log.Debugf("%s >-< %s: %v", conn.RemoteAddr(), addr, err)
+	}
 	log.WithFields(map[string]any{
 		"duration": time.Since(t),
 	}).Infof("%s >-< %s", conn.RemoteAddr(), addr)
@@ -239,3 +341,19 @@ func (h *socks4Handler) observeStats(ctx context.Context) {
 		}
 	}
 }
+
+// userid returns the userid of the request for the client key and logs,
+// the spaces and non-printable characters are dropped, and the length is capped.
+func userid(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c <= ' ' || c >= 0x7f {
+			continue
+		}
+		if sb.Len() >= maxUseridLength {
+			break
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
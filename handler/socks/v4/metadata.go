@@ -1,21 +1,73 @@
 package v4
 
 import (
+	"math"
 	"time"
 
 	mdata "github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/core/metadata/util"
+	"github.com/go-gost/core/resolver"
+	bypass_util "github.com/go-gost/x/internal/util/bypass"
+	port_util "github.com/go-gost/x/internal/util/port"
+	"github.com/go-gost/x/internal/util/socks"
+	"github.com/go-gost/x/registry"
 )
 
 type metadata struct {
 	readTimeout   time.Duration
+	idleTimeout   time.Duration
 	hash          string
 	observePeriod time.Duration
+	forwarded     bool
+	resolver      resolver.Resolver
+	bypassAction  *bypass_util.Action
+	// the ports of the targets allowed and denied, nil allows any port.
+	ports *port_util.Policy
+	// the commands allowed by the service (connect, bind and udptun), nil allows all the commands.
+	allowedCommands socks.Commands
+	maskIP          bool
+	// enables the UDP-over-TCP tunnel of the extended command socks.CmdUDPTun.
+	enableUDP     bool
+	udpBufferSize int
 }
 
 func (h *socks4Handler) parseMetadata(md mdata.Metadata) (err error) {
 	h.md.readTimeout = mdutil.GetDuration(md, "readTimeout")
+	h.md.idleTimeout = mdutil.GetDuration(md, "idleTimeout")
 	h.md.hash = mdutil.GetString(md, "hash")
 	h.md.observePeriod = mdutil.GetDuration(md, "observePeriod")
+	h.md.forwarded = mdutil.GetBool(md, "forwarded")
+	h.md.bypassAction = bypass_util.ParseAction(mdutil.GetString(md, "bypass.action"))
+	if h.md.ports, err = port_util.NewPolicy(h.options.Service,
+		mdutil.GetStrings(md, "ports.allow"), mdutil.GetStrings(md, "ports.deny")); err != nil {
+		return
+	}
+	h.md.resolver = registry.ResolverRegistry().Get(mdutil.GetString(md, "resolver"))
+	h.md.allowedCommands, err = socks.ParseCommands(mdutil.GetStrings(md, "allowedCommands"))
+	h.md.maskIP = mdutil.GetBool(md, "maskIP")
+
+	h.md.enableUDP = mdutil.GetBool(md, "udp")
+	if bs := mdutil.GetInt(md, "udpBufferSize"); bs > 0 {
+		h.md.udpBufferSize = int(math.Min(math.Max(float64(bs), 512), 64*1024))
+	} else {
+		h.md.udpBufferSize = 4096
+	}
 	return
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"allowedCommands",
+	"bypass.action",
+	"forwarded",
+	"hash",
+	"idleTimeout",
+	"maskIP",
+	"observePeriod",
+	"ports.allow",
+	"ports.deny",
+	"readTimeout",
+	"resolver",
+	"udp",
+	"udpBufferSize",
+}
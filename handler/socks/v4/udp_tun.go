@@ -0,0 +1,98 @@
+package v4
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/go-gost/core/logger"
+	"github.com/go-gost/core/observer/stats"
+	"github.com/go-gost/gosocks4"
+	ctxvalue "github.com/go-gost/x/ctx"
+	"github.com/go-gost/x/internal/net/udp"
+	"github.com/go-gost/x/internal/util/socks"
+	stats_wrapper "github.com/go-gost/x/observer/stats/wrapper"
+)
+
+// handleUDPTun handles the UDP-over-TCP tunnel request, the extension of the SOCKS5 CmdUDPTun to SOCKS4,
+// the datagrams are framed as the UDPTun of SOCKS5. Only the relay mode is supported, the port of the request must be 0.
+func (h *socks4Handler) handleUDPTun(ctx context.Context, conn net.Conn, req *gosocks4.Request, log logger.Logger) error {
+	log = log.WithFields(map[string]any{
+		"cmd": "udp-tun",
+	})
+
+	if !h.md.enableUDP {
+		resp := gosocks4.NewReply(gosocks4.Rejected, nil)
+		log.Trace(resp)
+		log.Error("socks4: UDP relay is disabled")
+		return resp.Write(conn)
+	}
+	if req.Addr != nil && req.Addr.Port != 0 {
+		resp := gosocks4.NewReply(gosocks4.Rejected, nil)
+		log.Trace(resp)
+		log.Error("socks4: UDP bind is not supported")
+		return resp.Write(conn)
+	}
+
+	// obtain a udp connection
+	c, err := h.options.Router.Dial(ctx, "udp", "") // UDP association
+	if err != nil {
+		log.Error(err)
+		resp := gosocks4.NewReply(gosocks4.Failed, nil)
+		log.Trace(resp)
+		resp.Write(conn)
+		return err
+	}
+	defer c.Close()
+
+	pc, ok := c.(net.PacketConn)
+	if !ok {
+		err := errors.New("socks4: wrong connection type")
+		log.Error(err)
+		return err
+	}
+
+	// the bound address is reported only if it can be carried by SOCKS4.
+	var baddr *gosocks4.Addr
+	if addr, _ := pc.LocalAddr().(*net.UDPAddr); addr != nil && addr.IP.To4() != nil {
+		baddr = &gosocks4.Addr{
+			Type: gosocks4.AddrIPv4,
+			Host: addr.IP.String(),
+			Port: uint16(addr.Port),
+		}
+	}
+	resp := gosocks4.NewReply(gosocks4.Granted, baddr)
+	log.Trace(resp)
+	if err := resp.Write(conn); err != nil {
+		log.Error(err)
+		return err
+	}
+	log.Debugf("bind on %s OK", pc.LocalAddr())
+
+	clientID := ctxvalue.ClientIDFromContext(ctx)
+	if clientID == "" {
+		clientID = ctxvalue.ClientID(userid(req.Userid))
+	}
+	if h.options.Observer != nil {
+		pstats := h.stats.Stats(string(clientID))
+		pstats.Add(stats.KindTotalConns, 1)
+		pstats.Add(stats.KindCurrentConns, 1)
+		defer pstats.Add(stats.KindCurrentConns, -1)
+		conn = stats_wrapper.WrapConn(conn, pstats)
+	}
+
+	r := udp.NewRelay(socks.UDPTunServerConn(conn), pc).
+		WithBypass(h.options.Bypass).
+		WithLogger(log)
+	r.SetBufferSize(h.md.udpBufferSize)
+
+	t := time.Now()
+	log.Debugf("%s <-> %s", conn.RemoteAddr(), pc.LocalAddr())
+	r.Run(ctx)
+	log.WithFields(map[string]any{
+		"duration": time.Since(t),
+	}).Debugf("%s >-< %s", conn.RemoteAddr(), pc.LocalAddr())
+
+	return nil
+}
@@ -24,7 +24,7 @@ func (h *socks5Handler) handleBind(ctx context.Context, conn net.Conn, network,
 		reply := gosocks5.NewReply(gosocks5.NotAllowed, nil)
 		log.Trace(reply)
 		log.Error("socks5: BIND is disabled")
-		return reply.Write(conn)
+		return h.writeReply(conn, reply)
 	}
 
 	// BIND does not support chain.
@@ -39,24 +39,17 @@ func (h *socks5Handler) bindLocal(ctx context.Context, conn net.Conn, network, a
 	if err != nil {
 		log.Error(err)
 		reply := gosocks5.NewReply(gosocks5.Failure, nil)
-		if err := reply.Write(conn); err != nil {
+		if err := h.writeReply(conn, reply); err != nil {
 			log.Error(err)
 		}
 		log.Debug(reply)
 		return err
 	}
 
-	socksAddr := gosocks5.Addr{}
-	if err := socksAddr.ParseFrom(ln.Addr().String()); err != nil {
-		log.Warn(err)
-	}
-
-	// Issue: may not reachable when host has multi-interface
-	socksAddr.Host, _, _ = net.SplitHostPort(conn.LocalAddr().String())
-	socksAddr.Type = 0
-	reply := gosocks5.NewReply(gosocks5.Succeeded, &socksAddr)
+	socksAddr := h.bindAddr(conn, ln, log)
+	reply := gosocks5.NewReply(gosocks5.Succeeded, socksAddr)
 	log.Trace(reply)
-	if err := reply.Write(conn); err != nil {
+	if err := h.writeReply(conn, reply); err != nil {
 		log.Error(err)
 		ln.Close()
 		return err
@@ -66,12 +59,37 @@ func (h *socks5Handler) bindLocal(ctx context.Context, conn net.Conn, network, a
 		"bind": fmt.Sprintf("%s/%s", ln.Addr(), ln.Addr().Network()),
 	})
 
-	log.Debugf("bind on %s OK", ln.Addr())
+	if h.md.bindPublicHost != "" {
+		log.Infof("bind on %s OK, advertised as %s", ln.Addr(), socksAddr)
+	} else {
+		log.Debugf("bind on %s OK", ln.Addr())
+	}
 
 	h.serveBind(ctx, conn, ln, log)
 	return nil
 }
 
+// bindAddr returns the address of the listener ln replied to the client,
+// the public address of bind.publicAddr is advertised instead of the local address of conn if it is set.
+func (h *socks5Handler) bindAddr(conn net.Conn, ln net.Listener, log logger.Logger) *gosocks5.Addr {
+	socksAddr := &gosocks5.Addr{}
+	if err := socksAddr.ParseFrom(ln.Addr().String()); err != nil {
+		log.Warn(err)
+	}
+
+	if h.md.bindPublicHost != "" {
+		socksAddr.Host = h.md.bindPublicHost
+		if h.md.bindPublicPort > 0 {
+			socksAddr.Port = uint16(h.md.bindPublicPort)
+		}
+	} else {
+		// Issue: may not reachable when host has multi-interface
+		socksAddr.Host, _, _ = net.SplitHostPort(conn.LocalAddr().String())
+	}
+	socksAddr.Type = 0
+	return socksAddr
+}
+
 func (h *socks5Handler) serveBind(ctx context.Context, conn net.Conn, ln net.Listener, log logger.Logger) {
 	var rc net.Conn
 	accept := func() <-chan error {
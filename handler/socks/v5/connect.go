@@ -3,67 +3,201 @@ package v5
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"time"
 
+	"github.com/go-gost/core/bypass"
 	"github.com/go-gost/core/limiter"
 	"github.com/go-gost/core/logger"
 	"github.com/go-gost/core/observer/stats"
 	"github.com/go-gost/gosocks5"
 	ctxvalue "github.com/go-gost/x/ctx"
 	netpkg "github.com/go-gost/x/internal/net"
+	"github.com/go-gost/x/internal/net/proxyproto"
+	bypass_util "github.com/go-gost/x/internal/util/bypass"
+	"github.com/go-gost/x/internal/util/conntrack"
+	"github.com/go-gost/x/internal/util/forward"
+	"github.com/go-gost/x/internal/util/hotswap"
+	"github.com/go-gost/x/internal/util/quota"
 	traffic_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	xmetrics "github.com/go-gost/x/metrics"
+	"github.com/go-gost/x/observer/event"
 	stats_wrapper "github.com/go-gost/x/observer/stats/wrapper"
 )
 
-func (h *socks5Handler) handleConnect(ctx context.Context, conn net.Conn, network, address string, log logger.Logger) error {
+func (h *socks5Handler) handleConnect(ctx context.Context, conn net.Conn, network, address string, live *hotswap.Options, log logger.Logger) error {
 	log = log.WithFields(map[string]any{
 		"dst": fmt.Sprintf("%s/%s", address, network),
 		"cmd": "connect",
 	})
 	log.Debugf("%s >> %s", conn.RemoteAddr(), address)
 
-	if h.options.Bypass != nil && h.options.Bypass.Contains(ctx, network, address) {
+	if err := h.md.ports.Check(address); err != nil {
+		event.ConnTraceFromContext(ctx).Denied("ports")
+		log.Warn(err)
 		resp := gosocks5.NewReply(gosocks5.NotAllowed, nil)
 		log.Trace(resp)
+		return h.writeReply(conn, resp)
+	}
+
+	var sinkhole *bypass_util.Action
+	if action := h.bypass(ctx, live.Bypass, network, address); action != nil {
+		log = log.WithFields(map[string]any{"bypass": action.Type})
 		log.Debug("bypass: ", address)
-		return resp.Write(conn)
+
+		switch action.Type {
+		case bypass_util.ActionDrop:
+			return nil
+		case bypass_util.ActionSinkhole:
+			sinkhole = action
+		default:
+			event.ConnTraceFromContext(ctx).Denied("bypass")
+			resp := gosocks5.NewReply(gosocks5.NotAllowed, nil)
+			log.Trace(resp)
+			return h.writeReply(conn, resp)
+		}
 	}
 
 	switch h.md.hash {
 	case "host":
 		ctx = ctxvalue.ContextWithHash(ctx, &ctxvalue.Hash{Source: address})
+	case "client":
+		if clientID := ctxvalue.ClientIDFromContext(ctx); clientID != "" {
+			ctx = ctxvalue.ContextWithHash(ctx, &ctxvalue.Hash{Source: string(clientID)})
+		}
+	case "src":
+		if host, _, _ := net.SplitHostPort(conn.RemoteAddr().String()); host != "" {
+			ctx = ctxvalue.ContextWithHash(ctx, &ctxvalue.Hash{Source: host})
+		}
 	}
 
-	cc, err := h.options.Router.Dial(ctx, network, address)
-	if err != nil {
-		resp := gosocks5.NewReply(gosocks5.NetUnreachable, nil)
+	clientID := ctxvalue.ClientIDFromContext(ctx)
+	if err := h.md.quota.Check(ctx, string(clientID)); err != nil {
+		event.ConnTraceFromContext(ctx).Denied("quota")
+		log.Warnf("client %s: %v", clientID, err)
+		resp := gosocks5.NewReply(gosocks5.NotAllowed, nil)
 		log.Trace(resp)
-		resp.Write(conn)
+		h.writeReply(conn, resp)
 		return err
 	}
 
-	defer cc.Close()
+	var rw io.ReadWriter = conn
+	if h.md.sniSniffing {
+		// the ClientHello is sent by the client only after the CONNECT is established,
+		// so the reply is sent before dialing.
+		resp := gosocks5.NewReply(gosocks5.Succeeded, nil)
+		log.Trace(resp)
+		if err := h.writeReply(conn, resp); err != nil {
+			log.Error(err)
+			return err
+		}
+
+		var sni string
+		rw, sni = h.sniffSNI(ctx, conn, log)
+		if sni != "" {
+			ctx = ctxvalue.ContextWithSNI(ctx, ctxvalue.SNI(sni))
+			log = log.WithFields(map[string]any{
+				"sni": sni,
+			})
+			if h.md.sniRewrite {
+				if !forward.ValidHost(sni) {
+					log.Warnf("sni %.64q: invalid host", sni)
+				} else if addr := rewriteAddr(address, sni); addr != address {
+					log.Debugf("rewrite %s to %s", address, addr)
+					address = addr
+					if action := h.bypass(ctx, live.Bypass, network, address); action != nil {
+						log = log.WithFields(map[string]any{"bypass": action.Type})
+						log.Debug("bypass: ", address)
+
+						// the reply is sent before sniffing, the denied connection is closed instead.
+						switch action.Type {
+						case bypass_util.ActionDrop:
+							return nil
+						case bypass_util.ActionSinkhole:
+							sinkhole = action
+						default:
+							event.ConnTraceFromContext(ctx).Denied("bypass")
+							return nil
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if h.md.forwarded {
+		ctx = ctxvalue.ContextWithForwarded(ctx, &ctxvalue.Forwarded{
+			For:    conn.RemoteAddr().String(),
+			Target: address,
+		})
+	}
 
-	resp := gosocks5.NewReply(gosocks5.Succeeded, nil)
-	log.Trace(resp)
-	if err := resp.Write(conn); err != nil {
-		log.Error(err)
+	_, dspan := h.tracer.Start(ctx, "dial")
+	dspan.SetAttribute("dst", address)
+	var cc net.Conn
+	var err error
+	if sinkhole != nil {
+		cc, err = sinkhole.Dial(ctx, network)
+	} else if err = h.md.breaker.Allow(address); err == nil {
+		span := xmetrics.StartSpan(xmetrics.MetricServiceDialDurationObserver, h.options.Service)
+		cc, err = h.options.Router.Dial(ctx, network, address)
+		span.End(err)
+		h.md.breaker.Done(address, err)
+	}
+	dspan.Finish(err)
+	if err != nil {
+		if !h.md.sniSniffing {
+			resp := gosocks5.NewReply(gosocks5.NetUnreachable, nil)
+			log.Trace(resp)
+			h.writeReply(conn, resp)
+		}
 		return err
 	}
 
-	clientID := ctxvalue.ClientIDFromContext(ctx)
-	rw := traffic_wrapper.WrapReadWriter(
-		h.limiter,
-		conn,
-		string(clientID),
-		limiter.ServiceOption(h.options.Service),
-		limiter.ScopeOption(limiter.ScopeClient),
-		limiter.NetworkOption(network),
-		limiter.AddrOption(address),
-		limiter.ClientOption(string(clientID)),
-		limiter.SrcOption(conn.RemoteAddr().String()),
+	defer cc.Close()
+
+	// the upstream gets the real client address, the sinkhole is a local decoy.
+	if sinkhole == nil {
+		cc = proxyproto.WrapClientConn(h.md.proxyProtocol, conn.RemoteAddr(), conn.LocalAddr(), cc)
+	}
+
+	if !h.md.sniSniffing {
+		resp := gosocks5.NewReply(gosocks5.Succeeded, nil)
+		log.Trace(resp)
+		if err := h.writeReply(conn, resp); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	// the traffic limiter can match the sniffed server name instead of the IP address.
+	limitAddr := address
+	if sni := ctxvalue.SNIFromContext(ctx); sni != "" {
+		if _, port, _ := net.SplitHostPort(address); port != "" {
+			limitAddr = net.JoinHostPort(string(sni), port)
+		}
+	}
+
+	rw = traffic_wrapper.WrapReadWriterScopes(
+		live.Limiter,
+		rw,
+		traffic_wrapper.Scope{
+			Key: string(clientID),
+			Opts: []limiter.Option{
+				limiter.ServiceOption(h.options.Service),
+				limiter.ScopeOption(limiter.ScopeClient),
+				limiter.NetworkOption(network),
+				limiter.AddrOption(limitAddr),
+				limiter.ClientOption(string(clientID)),
+				limiter.SrcOption(conn.RemoteAddr().String()),
+			},
+		},
 	)
+	if counter := h.md.quota.Counter(ctx, string(clientID)); counter != nil {
+		defer counter.Close()
+		rw = traffic_wrapper.WrapQuotaReadWriter(rw, counter)
+	}
 	if h.options.Observer != nil {
 		pstats := h.stats.Stats(string(clientID))
 		pstats.Add(stats.KindTotalConns, 1)
@@ -71,13 +205,59 @@ func (h *socks5Handler) handleConnect(ctx context.Context, conn net.Conn, networ
 		defer pstats.Add(stats.KindCurrentConns, -1)
 		rw = stats_wrapper.WrapReadWriter(rw, pstats)
 	}
+	acct := h.billing.Start(string(clientID))
+	defer acct.End()
+	rw = stats_wrapper.WrapReadWriter(rw, acct.Stats())
+
+	tc := conntrack.Track(h.options.Service, string(clientID), conn.RemoteAddr().String(), address, log, conn, cc)
+	defer tc.Untrack()
+	rw = tc.WrapReadWriter(rw)
 
 	t := time.Now()
 	log.Infof("%s <-> %s", conn.RemoteAddr(), address)
-	netpkg.Transport(rw, cc)
+	_, tspan := h.tracer.Start(ctx, "transfer")
+	err = netpkg.TransportWithIdleTimeout(rw, cc, h.md.idleTimeout)
+	tspan.Finish(err)
+	if err == netpkg.ErrIdleTimeout {
+		log.Debugf("%s >-< %s: %v", conn.RemoteAddr(), address, err)
+	}
+	if quota.IsExceeded(err) {
+		log.Warnf("%s >-< %s: client %s: %v", conn.RemoteAddr(), address, clientID, err)
+	}
 	log.WithFields(map[string]any{
 		"duration": time.Since(t),
 	}).Infof("%s >-< %s", conn.RemoteAddr(), address)
 
 	return nil
 }
+
+// bypass returns the action for the address matched by the bypass, or nil if not matched.
+func (h *socks5Handler) bypass(ctx context.Context, bp bypass.Bypass, network, address string) *bypass_util.Action {
+	if bp == nil || !bp.Contains(ctx, network, address) {
+		return nil
+	}
+	action := h.md.bypassAction
+	action.Observe(h.options.Service)
+	return action
+}
+
+// sniffSNI peeks the TLS ClientHello of the tunneled stream within the sniffing timeout.
+// The returned rw replays the peeked data, the non-TLS traffic is passed through untouched.
+func (h *socks5Handler) sniffSNI(ctx context.Context, conn net.Conn, log logger.Logger) (io.ReadWriter, string) {
+	conn.SetReadDeadline(time.Now().Add(h.md.sniffingTimeout))
+	rw, sni, err := forward.SniffSNI(ctx, conn)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		log.Debugf("sniffing: %v", err)
+	}
+	return rw, sni
+}
+
+// rewriteAddr replaces the host of address with sni if the host is an IP address.
+func rewriteAddr(address, sni string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) == nil {
+		return address
+	}
+	return net.JoinHostPort(sni, port)
+}
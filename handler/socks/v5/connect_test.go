@@ -0,0 +1,127 @@
+package v5
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-gost/core/chain"
+	"github.com/go-gost/core/handler"
+	"github.com/go-gost/gosocks5"
+	xbypass "github.com/go-gost/x/bypass"
+	xchain "github.com/go-gost/x/chain"
+	xlogger "github.com/go-gost/x/logger"
+	xmd "github.com/go-gost/x/metadata"
+)
+
+// acceptOne reports the first connection accepted by the listener.
+func acceptOne(t *testing.T) (net.Listener, <-chan struct{}) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	accepted := make(chan struct{})
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		close(accepted)
+		io.Copy(io.Discard, conn)
+	}()
+	return ln, accepted
+}
+
+func TestConnectSNIRewriteBypass(t *testing.T) {
+	tests := []struct {
+		name string
+		sni  string
+		// the bypass action for the rewritten target.
+		action string
+		// the connection is relayed to the sinkhole instead of the target.
+		sinkhole bool
+		// the connection is relayed to the target.
+		target bool
+	}{
+		{name: "sinkhole", sni: "example.com", action: "sinkhole", sinkhole: true},
+		{name: "reject", sni: "example.com"},
+		{name: "drop", sni: "example.com", action: "drop"},
+		{name: "not matched", sni: "localhost", target: true},
+		// the invalid server name is never used as the target.
+		{name: "invalid sni", sni: "example.com-", target: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, targetAccepted := acceptOne(t)
+			sinkhole, sinkholeAccepted := acceptOne(t)
+
+			action := tt.action
+			if action == "sinkhole" {
+				action = "sinkhole:" + sinkhole.Addr().String()
+			}
+			h := NewHandler(
+				handler.RouterOption(xchain.NewRouter(chain.LoggerRouterOption(xlogger.Nop()))),
+				handler.LoggerOption(xlogger.Nop()),
+				handler.BypassOption(xbypass.NewBypass(
+					xbypass.MatchersOption([]string{"example.com", "example.com-"}),
+					xbypass.LoggerOption(xlogger.Nop()),
+				)),
+			).(*socks5Handler)
+			if err := h.Init(xmd.NewMetadata(map[string]any{
+				"sniSniffing":   true,
+				"sniRewrite":    true,
+				"bypass.action": action,
+			})); err != nil {
+				t.Fatal(err)
+			}
+			defer h.Close()
+
+			client, server := net.Pipe()
+			defer client.Close()
+			go h.Handle(context.Background(), server)
+			client.SetDeadline(time.Now().Add(5 * time.Second))
+
+			if _, err := client.Write([]byte{gosocks5.Ver5, 1, gosocks5.MethodNoAuth}); err != nil {
+				t.Fatal(err)
+			}
+			b := make([]byte, 2)
+			if _, err := io.ReadFull(client, b); err != nil {
+				t.Fatal(err)
+			}
+			addr, _ := gosocks5.NewAddr(target.Addr().String())
+			if err := gosocks5.NewRequest(gosocks5.CmdConnect, addr).Write(client); err != nil {
+				t.Fatal(err)
+			}
+			if reply, err := gosocks5.ReadReply(client); err != nil || reply.Rep != gosocks5.Succeeded {
+				t.Fatalf("got reply %v, error %v", reply, err)
+			}
+
+			// the ClientHello with the server name, the handshake is never finished.
+			go tls.Client(client, &tls.Config{ServerName: tt.sni}).Handshake()
+
+			wait := func(c <-chan struct{}) bool {
+				select {
+				case <-c:
+					return true
+				case <-time.After(300 * time.Millisecond):
+					return false
+				}
+			}
+			if got := wait(sinkholeAccepted); got != tt.sinkhole {
+				t.Errorf("sinkhole connected: got %v, want %v", got, tt.sinkhole)
+			}
+			if got := wait(targetAccepted); got != tt.target {
+				t.Errorf("target connected: got %v, want %v", got, tt.target)
+			}
+		})
+	}
+}
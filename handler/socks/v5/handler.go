@@ -2,37 +2,62 @@ package v5
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"net"
 	"time"
 
 	"github.com/go-gost/core/handler"
-	"github.com/go-gost/core/limiter/traffic"
 	md "github.com/go-gost/core/metadata"
+	"github.com/go-gost/core/metrics"
 	"github.com/go-gost/gosocks5"
 	ctxvalue "github.com/go-gost/x/ctx"
-	limiter_util "github.com/go-gost/x/internal/util/limiter"
+	"github.com/go-gost/x/interceptor"
+	"github.com/go-gost/x/internal/util/billing"
+	"github.com/go-gost/x/internal/util/drain"
+	"github.com/go-gost/x/internal/util/hotswap"
+	resolver_util "github.com/go-gost/x/internal/util/resolver"
 	"github.com/go-gost/x/internal/util/socks"
 	stats_util "github.com/go-gost/x/internal/util/stats"
+	tls_util "github.com/go-gost/x/internal/util/tls"
+	xlogger "github.com/go-gost/x/logger"
+	mdx "github.com/go-gost/x/metadata"
+	xmetrics "github.com/go-gost/x/metrics"
+	"github.com/go-gost/x/observer/event"
+	xrecorder "github.com/go-gost/x/recorder"
 	"github.com/go-gost/x/registry"
+	"github.com/go-gost/x/tracing"
+)
+
+const (
+	// the time to wait for the negotiation if the readTimeout is not set.
+	defaultHandshakeTimeout = 30 * time.Second
 )
 
 var (
-	ErrUnknownCmd = errors.New("socks5: unknown command")
+	ErrUnknownCmd    = errors.New("socks5: unknown command")
+	ErrCmdNotAllowed = errors.New("socks5: command not allowed")
 )
 
 func init() {
 	registry.HandlerRegistry().Register("socks5", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "socks5", schema...)
 	registry.HandlerRegistry().Register("socks", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "socks", schema...)
 }
 
 type socks5Handler struct {
-	selector gosocks5.Selector
+	selector *serverSelector
 	md       metadata
 	options  handler.Options
 	stats    *stats_util.HandlerStats
-	limiter  traffic.TrafficLimiter
 	cancel   context.CancelFunc
+	tracker  drain.Tracker
+	tracer   *tracing.Tracer
+	events   *event.ConnEmitter
+	billing  *billing.Biller
+	// the auther, bypass and limiter swappable by UpdateOptions.
+	live hotswap.Value
 }
 
 func NewHandler(opts ...handler.Option) handler.Handler {
@@ -51,11 +76,33 @@ func (h *socks5Handler) Init(md md.Metadata) (err error) {
 		return
 	}
 
+	tlsConfig := h.options.TLSConfig
+	if tlsConfig != nil {
+		tlsConfig = tlsConfig.Clone()
+		if len(h.md.tlsTicketKeys) > 0 {
+			tlsConfig.SessionTicketsDisabled = false
+			tlsConfig.SetSessionTicketKeys(h.md.tlsTicketKeys)
+		}
+		if h.md.tlsALPN != "" {
+			tlsConfig.NextProtos = []string{h.md.tlsALPN}
+		}
+		if h.md.tlsCertAuth {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
 	h.selector = &serverSelector{
 		Authenticator: h.options.Auther,
-		TLSConfig:     h.options.TLSConfig,
+		TLSConfig:     tlsConfig,
 		logger:        h.options.Logger,
 		noTLS:         h.md.noTLS,
+		alpn:          h.md.tlsALPN,
+		certAuth:      h.md.tlsCertAuth,
+		schedule:      h.md.schedule,
+		requireAuth:   h.md.requireAuth,
+	}
+	if h.md.requireAuth && h.options.Auther == nil {
+		h.options.Logger.Warn("requireAuth is set but no auther, all the clients are refused")
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -66,22 +113,61 @@ func (h *socks5Handler) Init(md md.Metadata) (err error) {
 		go h.observeStats(ctx)
 	}
 
-	if limiter := h.options.Limiter; limiter != nil {
-		h.limiter = limiter_util.NewCachedTrafficLimiter(limiter, 30*time.Second, 60*time.Second)
+	if h.md.tracing {
+		h.tracer = tracing.NewTracer(h.options.Service, h.options.Logger)
 	}
 
+	if h.md.connEvents {
+		h.events = event.NewConnEmitter(h.options.Observer, h.options.Service, h.md.connEventsOpts)
+	}
+
+	if opts := h.options.Router.Options(); opts != nil {
+		for _, ro := range opts.Recorders {
+			if ro.Record == xrecorder.RecorderServiceHandlerBilling {
+				bopts := h.md.billingOpts
+				bopts.Logger = h.options.Logger
+				h.billing = billing.New(h.options.Service, ro.Recorder, bopts)
+				break
+			}
+		}
+	}
+
+	h.live.Store(&h.options)
+
 	return
 }
 
-func (h *socks5Handler) Handle(ctx context.Context, conn net.Conn, opts ...handler.HandleOption) error {
+func (h *socks5Handler) Handle(ctx context.Context, conn net.Conn, opts ...handler.HandleOption) (err error) {
 	defer conn.Close()
 
+	if h.md.resolver != nil {
+		ctx = ctxvalue.ContextWithResolver(ctx, h.md.resolver)
+	}
+	if h.md.dnsCache != nil {
+		ctx = resolver_util.ContextWithLookupCache(ctx, h.md.dnsCache)
+	}
+
+	if !h.tracker.Add(conn) {
+		return drain.ErrDraining
+	}
+	defer h.tracker.Remove(conn)
+
 	start := time.Now()
 
 	log := h.options.Logger.WithFields(map[string]any{
 		"remote": conn.RemoteAddr().String(),
 		"local":  conn.LocalAddr().String(),
 	})
+	if h.md.maskIP {
+		log = xlogger.MaskIP(log, conn.RemoteAddr())
+	}
+
+	ctx, tspan := h.tracer.Start(ctx, "socks5.conn")
+	if tspan != nil {
+		tspan.SetAttribute("remote", conn.RemoteAddr().String())
+		log = log.WithFields(tspan.Fields())
+		defer func() { tspan.Finish(err) }()
+	}
 
 	log.Infof("%s <> %s", conn.RemoteAddr(), conn.LocalAddr())
 	defer func() {
@@ -90,57 +176,163 @@ func (h *socks5Handler) Handle(ctx context.Context, conn net.Conn, opts ...handl
 		}).Infof("%s >< %s", conn.RemoteAddr(), conn.LocalAddr())
 	}()
 
+	trace := h.events.Trace(conn.RemoteAddr().String())
+	defer func() { trace.Closed(err) }()
+	ctx = event.ContextWithConnTrace(ctx, trace)
+
 	if !h.checkRateLimit(conn.RemoteAddr()) {
+		trace.Denied("rateLimit")
 		return nil
 	}
 
-	if h.md.readTimeout > 0 {
-		conn.SetReadDeadline(time.Now().Add(h.md.readTimeout))
+	// the whole negotiation (methods, sub-negotiation and request) is bounded by the readTimeout,
+	// so the stalled clients are not kept in the handshake.
+	readTimeout := h.md.readTimeout
+	if readTimeout <= 0 {
+		readTimeout = defaultHandshakeTimeout
+	}
+	conn.SetReadDeadline(time.Now().Add(readTimeout))
+	// the method negotiation and sub-negotiation are bounded by the writeTimeout.
+	if h.md.writeTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(h.md.writeTimeout))
 	}
 
-	sc := gosocks5.ServerConn(conn, h.selector)
+	// the auther, bypass and limiter of the connection are loaded once,
+	// so a swap by UpdateOptions never mixes the old and new options in one connection.
+	live := h.live.Load()
+
+	// the selector records the per-connection TLS state.
+	selector := *h.selector
+	selector.Authenticator = live.Auther
+	sc := gosocks5.ServerConn(conn, &selector)
+	span := xmetrics.StartSpan(xmetrics.MetricServiceHandshakeDurationObserver, h.options.Service)
 	req, err := gosocks5.ReadRequest(sc)
+	span.End(err)
 	if err != nil {
+		if errors.Is(err, gosocks5.ErrAuthFailure) {
+			trace.Denied("auth")
+		}
+		h.observeProtocolError(err)
 		log.Error(err)
 		return err
 	}
 	log.Trace(req)
 
-	if clientID := sc.ID(); clientID != "" {
+	if cs := selector.tlsState; cs != nil {
+		log = log.WithFields(map[string]any{
+			"tls.version": tls.VersionName(cs.Version),
+			"tls.cipher":  tls.CipherSuiteName(cs.CipherSuite),
+			"tls.resumed": cs.DidResume,
+		})
+	}
+
+	clientID := sc.ID()
+	if clientID == "" {
+		// the client ID from the certificate verified by the TLS listener.
+		clientID = tls_util.ClientID(conn)
+	}
+	if clientID != "" {
 		ctx = ctxvalue.ContextWithClientID(ctx, ctxvalue.ClientID(clientID))
 		log = log.WithFields(map[string]any{"user": clientID})
 	}
+	trace.Authenticated(clientID)
 
-	conn = sc
-	conn.SetReadDeadline(time.Time{})
+	conn = trace.WrapConn(sc)
+
+	// the clients without the username/password authentication, such as by the client certificate.
+	if err := h.md.schedule.Check(clientID); err != nil {
+		trace.Denied("schedule")
+		log.Warn(err)
+		resp := gosocks5.NewReply(gosocks5.NotAllowed, nil)
+		log.Trace(resp)
+		h.writeReply(conn, resp)
+		return err
+	}
+	defer h.md.schedule.Watch(clientID, conn)()
+
+	conn.SetDeadline(time.Time{})
 
 	address := req.Addr.String()
 
+	if !h.md.allowedCommands.Allowed(req.Cmd) {
+		err = ErrCmdNotAllowed
+		trace.Denied("command")
+		log.Warnf("%v: %d", err, req.Cmd)
+		resp := gosocks5.NewReply(gosocks5.CmdUnsupported, nil)
+		log.Trace(resp)
+		h.writeReply(conn, resp)
+		return err
+	}
+
+	network := "tcp"
+	if req.Cmd == gosocks5.CmdUdp || req.Cmd == socks.CmdUDPTun {
+		network = "udp"
+	}
+	ireq := &interceptor.Request{
+		Service:  h.options.Service,
+		Handler:  "socks5",
+		Network:  network,
+		Src:      conn.RemoteAddr().String(),
+		Dst:      address,
+		ClientID: clientID,
+	}
+	after, err := h.md.interceptors.Before(ctx, ireq)
+	if err != nil {
+		trace.Denied("interceptor")
+		log.Warn(err)
+		resp := gosocks5.NewReply(gosocks5.NotAllowed, nil)
+		log.Trace(resp)
+		h.writeReply(conn, resp)
+		return err
+	}
+	defer func() { after(err) }()
+	if len(ireq.Annotations) > 0 {
+		log = log.WithFields(ireq.Annotations)
+	}
+
+	trace.Opened(address)
+
 	switch req.Cmd {
 	case gosocks5.CmdConnect:
-		return h.handleConnect(ctx, conn, "tcp", address, log)
+		return h.handleConnect(ctx, conn, "tcp", address, live, log)
 	case gosocks5.CmdBind:
 		return h.handleBind(ctx, conn, "tcp", address, log)
 	case socks.CmdMuxBind:
 		return h.handleMuxBind(ctx, conn, "tcp", address, log)
 	case gosocks5.CmdUdp:
-		return h.handleUDP(ctx, conn, log)
+		return h.handleUDP(ctx, conn, address, live, log)
 	case socks.CmdUDPTun:
-		return h.handleUDPTun(ctx, conn, "udp", address, log)
+		return h.handleUDPTun(ctx, conn, "udp", address, live, log)
 	default:
 		err = ErrUnknownCmd
 		log.Error(err)
 		resp := gosocks5.NewReply(gosocks5.CmdUnsupported, nil)
 		log.Trace(resp)
-		resp.Write(conn)
+		h.writeReply(conn, resp)
 		return err
 	}
 }
 
+// UpdateOptions implements the service.OptionsUpdater interface,
+// it swaps the auther, bypass and limiter used by the new connections,
+// the established connections are not affected.
+func (h *socks5Handler) UpdateOptions(opts ...handler.Option) error {
+	h.live.Update(opts...)
+	return nil
+}
+
+// Drain implements the service.Drainer interface,
+// it rejects new connections and waits for the active connections to finish.
+func (h *socks5Handler) Drain(ctx context.Context) (forced int, err error) {
+	return h.tracker.Drain(ctx)
+}
+
 func (h *socks5Handler) Close() error {
 	if h.cancel != nil {
 		h.cancel()
 	}
+	h.events.Close()
+	h.billing.Close()
 	return nil
 }
 
@@ -177,3 +369,39 @@ func (h *socks5Handler) observeStats(ctx context.Context) {
 		}
 	}
 }
+
+// observeProtocolError counts the connection failed in the handshake for the violation of the protocol,
+// the connections closed by the clients are not counted.
+func (h *socks5Handler) observeProtocolError(err error) {
+	var reason string
+	var ne net.Error
+	switch {
+	case errors.Is(err, errTooManyMethods):
+		reason = "methods"
+	case errors.Is(err, errCredentialsTooLong):
+		reason = "credentials"
+	case errors.As(err, &ne) && ne.Timeout():
+		reason = "timeout"
+	case errors.Is(err, gosocks5.ErrBadVersion),
+		errors.Is(err, gosocks5.ErrBadFormat),
+		errors.Is(err, gosocks5.ErrBadAddrType),
+		errors.Is(err, gosocks5.ErrBadMethod):
+		reason = "malformed"
+	default:
+		return
+	}
+
+	if v := xmetrics.GetCounter(xmetrics.MetricServiceProtocolErrorsCounter,
+		metrics.Labels{"service": h.options.Service, "reason": reason}); v != nil {
+		v.Inc()
+	}
+}
+
+// writeReply writes the reply of the handshake to conn, the write is bounded by the writeTimeout.
+func (h *socks5Handler) writeReply(conn net.Conn, reply *gosocks5.Reply) error {
+	if h.md.writeTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(h.md.writeTimeout))
+		defer conn.SetWriteDeadline(time.Time{})
+	}
+	return reply.Write(conn)
+}
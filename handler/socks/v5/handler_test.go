@@ -0,0 +1,274 @@
+package v5
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-gost/core/auth"
+	"github.com/go-gost/core/chain"
+	"github.com/go-gost/core/handler"
+	"github.com/go-gost/gosocks5"
+	xauth "github.com/go-gost/x/auth"
+	xchain "github.com/go-gost/x/chain"
+	"github.com/go-gost/x/internal/util/quota"
+	xlogger "github.com/go-gost/x/logger"
+	xmd "github.com/go-gost/x/metadata"
+)
+
+func newAuther(user, pass string) auth.Authenticator {
+	return xauth.NewAuthenticator(xauth.AuthsOption(map[string]string{user: pass}))
+}
+
+// handshake runs the method selection and the username/password sub-negotiation,
+// it reports whether the credentials are accepted.
+func handshake(conn net.Conn, user, pass string) (bool, error) {
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write([]byte{gosocks5.Ver5, 1, gosocks5.MethodUserPass}); err != nil {
+		return false, err
+	}
+	b := make([]byte, 2)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		return false, err
+	}
+	if b[1] != gosocks5.MethodUserPass {
+		return false, nil
+	}
+
+	req := []byte{gosocks5.UserPassVer, byte(len(user))}
+	req = append(req, user...)
+	req = append(req, byte(len(pass)))
+	req = append(req, pass...)
+	if _, err := conn.Write(req); err != nil {
+		return false, err
+	}
+	if _, err := io.ReadFull(conn, b); err != nil {
+		return false, err
+	}
+	return b[1] == gosocks5.Succeeded, nil
+}
+
+func TestUpdateOptionsAutherUnderLoad(t *testing.T) {
+	h := NewHandler(
+		handler.RouterOption(xchain.NewRouter(chain.LoggerRouterOption(xlogger.Nop()))),
+		handler.LoggerOption(xlogger.Nop()),
+		handler.AutherOption(newAuther("a", "1")),
+	).(*socks5Handler)
+	if err := h.Init(xmd.NewMetadata(nil)); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	var stop atomic.Bool
+	var accepted, rejected atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for !stop.Load() {
+				client, server := net.Pipe()
+				go h.Handle(context.Background(), server)
+
+				user, pass := "a", "1"
+				if i%2 == 1 {
+					user, pass = "b", "2"
+				}
+				ok, err := handshake(client, user, pass)
+				client.Close()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if ok {
+					accepted.Add(1)
+				} else {
+					rejected.Add(1)
+				}
+			}
+		}(i)
+	}
+
+	authers := []auth.Authenticator{newAuther("a", "1"), newAuther("b", "2")}
+	for i := 0; i < 1000; i++ {
+		if err := h.UpdateOptions(handler.AutherOption(authers[i%2])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the last swap is to the auther of b.
+	time.Sleep(50 * time.Millisecond)
+	stop.Store(true)
+	wg.Wait()
+
+	if accepted.Load() == 0 {
+		t.Error("no client is accepted")
+	}
+
+	for _, tt := range []struct {
+		user, pass string
+		want       bool
+	}{
+		{"a", "1", false},
+		{"b", "2", true},
+	} {
+		client, server := net.Pipe()
+		go h.Handle(context.Background(), server)
+		ok, err := handshake(client, tt.user, tt.pass)
+		client.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.want {
+			t.Errorf("user %s after the swap: got %v, want %v", tt.user, ok, tt.want)
+		}
+	}
+}
+
+func TestUpdateOptionsKeepsOtherOptions(t *testing.T) {
+	h := NewHandler(
+		handler.RouterOption(xchain.NewRouter(chain.LoggerRouterOption(xlogger.Nop()))),
+		handler.LoggerOption(xlogger.Nop()),
+		handler.AutherOption(newAuther("a", "1")),
+		handler.ServiceOption("socks5"),
+	).(*socks5Handler)
+	if err := h.Init(xmd.NewMetadata(nil)); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	if err := h.UpdateOptions(handler.AutherOption(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if auther := h.live.Load().Auther; auther != nil {
+		t.Errorf("auther: got %v, want nil", auther)
+	}
+	// the options not swappable are never changed.
+	if h.options.Auther == nil || h.options.Service != "socks5" {
+		t.Errorf("options changed: %+v", h.options)
+	}
+}
+
+func TestUpdateOptionsKeepsPreviousSwaps(t *testing.T) {
+	h := NewHandler(
+		handler.RouterOption(xchain.NewRouter(chain.LoggerRouterOption(xlogger.Nop()))),
+		handler.LoggerOption(xlogger.Nop()),
+		handler.AutherOption(newAuther("a", "1")),
+	).(*socks5Handler)
+	if err := h.Init(xmd.NewMetadata(nil)); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	if err := h.UpdateOptions(handler.AutherOption(newAuther("b", "2"))); err != nil {
+		t.Fatal(err)
+	}
+	// the update of the limiter only keeps the auther swapped before.
+	if err := h.UpdateOptions(handler.TrafficLimiterOption(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		user, pass string
+		want       bool
+	}{
+		{"a", "1", false},
+		{"b", "2", true},
+	} {
+		client, server := net.Pipe()
+		go h.Handle(context.Background(), server)
+		ok, err := handshake(client, tt.user, tt.pass)
+		client.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.want {
+			t.Errorf("user %s: got %v, want %v", tt.user, ok, tt.want)
+		}
+	}
+}
+
+func TestHandleSlowClient(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+
+	tests := []struct {
+		name string
+		// the data sent by the client, which never reads.
+		data []byte
+	}{
+		{name: "no request"},
+		// the method selection is sent partially.
+		{name: "partial request", data: []byte{gosocks5.Ver5, 1}},
+		// the selected method is never read by the client.
+		{name: "slow reader", data: []byte{gosocks5.Ver5, 1, gosocks5.MethodNoAuth}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(
+				handler.RouterOption(xchain.NewRouter(chain.LoggerRouterOption(xlogger.Nop()))),
+				handler.LoggerOption(xlogger.Nop()),
+			)
+			if err := h.Init(xmd.NewMetadata(map[string]any{
+				"readTimeout": timeout.String(),
+			})); err != nil {
+				t.Fatal(err)
+			}
+
+			client, server := net.Pipe()
+			defer client.Close()
+
+			done := make(chan error, 1)
+			start := time.Now()
+			go func() {
+				done <- h.Handle(context.Background(), server)
+			}()
+			for _, b := range tt.data {
+				if _, err := client.Write([]byte{b}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			select {
+			case err := <-done:
+				if err == nil {
+					t.Error("the slow client is not dropped")
+				}
+				if d := time.Since(start); d < timeout {
+					t.Errorf("dropped after %v, before the timeout %v", d, timeout)
+				}
+			case <-time.After(10 * timeout):
+				t.Fatal("the slow client is not dropped within the timeout")
+			}
+		})
+	}
+}
+
+func TestInitInvalidQuota(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+	}{
+		{key: "quota.conn", value: "10G"},
+		{key: "quota.daily", value: "abc"},
+		{key: "quota.daily", value: "-1GB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			h := NewHandler(
+				handler.RouterOption(xchain.NewRouter(chain.LoggerRouterOption(xlogger.Nop()))),
+				handler.LoggerOption(xlogger.Nop()),
+			)
+			err := h.Init(xmd.NewMetadata(map[string]any{tt.key: tt.value}))
+			if !errors.Is(err, quota.ErrInvalidSize) {
+				t.Errorf("got %v, want %v", err, quota.ErrInvalidSize)
+			}
+		})
+	}
+}
@@ -24,7 +24,7 @@ func (h *socks5Handler) handleMuxBind(ctx context.Context, conn net.Conn, networ
 		reply := gosocks5.NewReply(gosocks5.NotAllowed, nil)
 		log.Trace(reply)
 		log.Error("socks5: BIND is disabled")
-		return reply.Write(conn)
+		return h.writeReply(conn, reply)
 	}
 
 	return h.muxBindLocal(ctx, conn, network, address, log)
@@ -39,24 +39,16 @@ func (h *socks5Handler) muxBindLocal(ctx context.Context, conn net.Conn, network
 		log.Error(err)
 		reply := gosocks5.NewReply(gosocks5.Failure, nil)
 		log.Trace(reply)
-		if err := reply.Write(conn); err != nil {
+		if err := h.writeReply(conn, reply); err != nil {
 			log.Error(err)
 		}
 		return err
 	}
 
-	socksAddr := gosocks5.Addr{}
-	err = socksAddr.ParseFrom(ln.Addr().String())
-	if err != nil {
-		log.Warn(err)
-	}
-
-	// Issue: may not reachable when host has multi-interface
-	socksAddr.Host, _, _ = net.SplitHostPort(conn.LocalAddr().String())
-	socksAddr.Type = 0
-	reply := gosocks5.NewReply(gosocks5.Succeeded, &socksAddr)
+	socksAddr := h.bindAddr(conn, ln, log)
+	reply := gosocks5.NewReply(gosocks5.Succeeded, socksAddr)
 	log.Trace(reply)
-	if err := reply.Write(conn); err != nil {
+	if err := h.writeReply(conn, reply); err != nil {
 		log.Error(err)
 		ln.Close()
 		return err
@@ -66,7 +58,11 @@ func (h *socks5Handler) muxBindLocal(ctx context.Context, conn net.Conn, network
 		"bind": fmt.Sprintf("%s/%s", ln.Addr(), ln.Addr().Network()),
 	})
 
-	log.Debugf("bind on %s OK", ln.Addr())
+	if h.md.bindPublicHost != "" {
+		log.Infof("bind on %s OK, advertised as %s", ln.Addr(), socksAddr)
+	} else {
+		log.Debugf("bind on %s OK", ln.Addr())
+	}
 
 	return h.serveMuxBind(ctx, conn, ln, log)
 }
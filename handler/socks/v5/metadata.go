@@ -1,31 +1,123 @@
 package v5
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"math"
+	"net"
+	"strconv"
+	"strings"
 	"time"
 
 	mdata "github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/core/metadata/util"
+	"github.com/go-gost/core/resolver"
+	"github.com/go-gost/x/interceptor"
+	"github.com/go-gost/x/internal/util/billing"
+	"github.com/go-gost/x/internal/util/breaker"
+	bypass_util "github.com/go-gost/x/internal/util/bypass"
 	"github.com/go-gost/x/internal/util/mux"
+	port_util "github.com/go-gost/x/internal/util/port"
+	"github.com/go-gost/x/internal/util/quota"
+	resolver_util "github.com/go-gost/x/internal/util/resolver"
+	"github.com/go-gost/x/internal/util/schedule"
+	"github.com/go-gost/x/internal/util/socks"
+	"github.com/go-gost/x/observer/event"
+	"github.com/go-gost/x/registry"
+)
+
+const (
+	// the time to wait for the TLS ClientHello of the tunneled stream.
+	defaultSniffingTimeout = 3 * time.Second
 )
 
 type metadata struct {
 	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
 	noTLS             bool
+	tlsALPN           string
+	tlsCertAuth       bool
+	tlsTicketKeys     [][32]byte
 	enableBind        bool
 	enableUDP         bool
 	udpBufferSize     int
+	udpStrictPeer     bool
 	compatibilityMode bool
 	hash              string
+	sniSniffing       bool
+	sniRewrite        bool
+	sniffingTimeout   time.Duration
 	muxCfg            *mux.Config
 	observePeriod     time.Duration
+	tracing           bool
+	forwarded         bool
+	resolver          resolver.Resolver
+	dnsCache          *resolver_util.LookupCache
+	bypassAction      *bypass_util.Action
+	// the ports of the targets allowed and denied, nil allows any port.
+	ports *port_util.Policy
+	// the version of the PROXY protocol header sent to the upstream, 0 for none.
+	proxyProtocol int
+	// the per-destination circuit breaker of the connects, nil if disabled.
+	breaker *breaker.Breaker
+	// the traffic quotas of the connections and the clients, nil if disabled.
+	quota *quota.Quota
+	// the time-of-day access policies of the clients, nil if disabled.
+	schedule *schedule.Schedule
+	// refuses all the clients if no auther is set, instead of allowing the anonymous access.
+	requireAuth bool
+	// the commands allowed by the service, nil allows all the commands.
+	allowedCommands socks.Commands
+	// masks the client IP in the logs.
+	maskIP bool
+	// binds the socket of the association to the original destination of the connection redirected by TPROXY
+	// with IP_TRANSPARENT, so the client sees the replies of the association from it.
+	udpTransparent bool
+	// the interceptors run around the requests, nil if none.
+	interceptors *interceptor.Chain
+	// emits the lifecycle events of the connections through the observer.
+	connEvents     bool
+	connEventsOpts event.ConnEmitterOptions
+	// the batching of the billing records, the records are emitted if the billing recorder is set.
+	billingOpts billing.Options
+	// the address advertised in the first reply of BIND, such as the public address of the NAT,
+	// the port of the listener is advertised if the port is 0.
+	bindPublicHost string
+	bindPublicPort int
 }
 
 func (h *socks5Handler) parseMetadata(md mdata.Metadata) (err error) {
 	h.md.readTimeout = mdutil.GetDuration(md, "readTimeout")
+	h.md.writeTimeout = mdutil.GetDuration(md, "writeTimeout")
+	if h.md.writeTimeout <= 0 {
+		h.md.writeTimeout = h.md.readTimeout
+	}
+	h.md.idleTimeout = mdutil.GetDuration(md, "idleTimeout")
+	h.md.requireAuth = mdutil.GetBool(md, "requireAuth")
 	h.md.noTLS = mdutil.GetBool(md, "notls")
+	h.md.tlsALPN = mdutil.GetString(md, "tls.alpn")
+	h.md.tlsCertAuth = mdutil.GetBool(md, "tls.certAuth")
+	// the session ticket keys are shared among the nodes (and restarts),
+	// so the TLS sessions can be resumed.
+	for _, s := range mdutil.GetStrings(md, "tls.ticketKeys") {
+		h.md.tlsTicketKeys = append(h.md.tlsTicketKeys, sha256.Sum256([]byte(s)))
+	}
 	h.md.enableBind = mdutil.GetBool(md, "bind")
+	if v := mdutil.GetString(md, "bind.publicAddr"); v != "" {
+		if h.md.bindPublicHost, h.md.bindPublicPort, err = parsePublicAddr(v); err != nil {
+			return err
+		}
+	}
 	h.md.enableUDP = mdutil.GetBool(md, "udp")
+	h.md.udpTransparent = mdutil.GetBool(md, "udp.transparent")
+	if h.md.allowedCommands, err = socks.ParseCommands(mdutil.GetStrings(md, "allowedCommands")); err != nil {
+		return err
+	}
+	// the UDP datagrams are only accepted from the peer of the UDP ASSOCIATE request by default.
+	if md == nil || !md.IsExists("udp.strictPeer") || mdutil.GetBool(md, "udp.strictPeer") {
+		h.md.udpStrictPeer = true
+	}
 
 	if bs := mdutil.GetInt(md, "udpBufferSize"); bs > 0 {
 		h.md.udpBufferSize = int(math.Min(math.Max(float64(bs), 512), 64*1024))
@@ -36,6 +128,16 @@ func (h *socks5Handler) parseMetadata(md mdata.Metadata) (err error) {
 	h.md.compatibilityMode = mdutil.GetBool(md, "comp")
 	h.md.hash = mdutil.GetString(md, "hash")
 
+	h.md.tracing = mdutil.GetBool(md, "tracing")
+	h.md.forwarded = mdutil.GetBool(md, "forwarded")
+
+	h.md.sniSniffing = mdutil.GetBool(md, "sniSniffing")
+	h.md.sniRewrite = mdutil.GetBool(md, "sniRewrite")
+	h.md.sniffingTimeout = mdutil.GetDuration(md, "sniffing.timeout")
+	if h.md.sniffingTimeout <= 0 {
+		h.md.sniffingTimeout = defaultSniffingTimeout
+	}
+
 	h.md.muxCfg = &mux.Config{
 		Version:           mdutil.GetInt(md, "mux.version"),
 		KeepAliveInterval: mdutil.GetDuration(md, "mux.keepaliveInterval"),
@@ -48,5 +150,152 @@ func (h *socks5Handler) parseMetadata(md mdata.Metadata) (err error) {
 
 	h.md.observePeriod = mdutil.GetDuration(md, "observePeriod")
 
+	h.md.bypassAction = bypass_util.ParseAction(mdutil.GetString(md, "bypass.action"))
+	if h.md.ports, err = port_util.NewPolicy(h.options.Service,
+		mdutil.GetStrings(md, "ports.allow"), mdutil.GetStrings(md, "ports.deny")); err != nil {
+		return
+	}
+	h.md.proxyProtocol = mdutil.GetInt(md, "proxyProtocol")
+	h.md.breaker = breaker.New(breaker.Options{
+		Threshold: mdutil.GetInt(md, "breaker.threshold"),
+		Window:    mdutil.GetDuration(md, "breaker.window"),
+		Cooldown:  mdutil.GetDuration(md, "breaker.cooldown"),
+		Service:   h.options.Service,
+	})
+	quotaConn, err := quota.ParseSize(mdutil.GetString(md, "quota.conn"))
+	if err != nil {
+		return fmt.Errorf("quota.conn: %w", err)
+	}
+	quotaDaily, err := quota.ParseSize(mdutil.GetString(md, "quota.daily"))
+	if err != nil {
+		return fmt.Errorf("quota.daily: %w", err)
+	}
+	h.md.quota = quota.New(quota.Options{
+		Conn:  quotaConn,
+		Daily: quotaDaily,
+		Store: quota.NewStore(
+			mdutil.GetString(md, "quota.file"),
+			mdutil.GetString(md, "quota.redis"),
+			quota.RedisStoreOptions{
+				DB:       mdutil.GetInt(md, "quota.redis.db"),
+				Password: mdutil.GetString(md, "quota.redis.password"),
+				Key:      mdutil.GetString(md, "quota.redis.key"),
+			},
+			h.options.Logger,
+		),
+		Service: h.options.Service,
+	})
+	if h.md.schedule, err = schedule.New(schedule.Options{
+		Policies:  mdutil.GetStringMapString(md, "schedule"),
+		Default:   mdutil.GetString(md, "schedule.default"),
+		Terminate: mdutil.GetBool(md, "schedule.terminate"),
+	}); err != nil {
+		return err
+	}
+
+	h.md.resolver = registry.ResolverRegistry().Get(mdutil.GetString(md, "resolver"))
+	if mdutil.GetBool(md, "dns.cache") {
+		h.md.dnsCache = resolver_util.NewLookupCache(h.options.Service, resolver_util.LookupCacheOptions{
+			TTL:        mdutil.GetDuration(md, "dns.cache.ttl"),
+			MaxEntries: mdutil.GetInt(md, "dns.cache.maxEntries"),
+			Stale:      mdutil.GetDuration(md, "dns.cache.stale"),
+		})
+	}
+
+	h.md.maskIP = mdutil.GetBool(md, "maskIP")
+
+	var interceptors []interceptor.Interceptor
+	for _, name := range mdutil.GetStrings(md, "interceptors") {
+		interceptors = append(interceptors, registry.InterceptorRegistry().Get(name))
+	}
+	h.md.interceptors = interceptor.NewChain(interceptors...)
+
+	h.md.connEvents = mdutil.GetBool(md, "connEvents")
+	h.md.connEventsOpts = event.ConnEmitterOptions{
+		Sample: mdutil.GetFloat(md, "connEvents.sample"),
+		Rate:   mdutil.GetInt(md, "connEvents.rate"),
+	}
+	h.md.billingOpts = billing.Options{
+		BatchSize:     mdutil.GetInt(md, "billing.batchSize"),
+		FlushInterval: mdutil.GetDuration(md, "billing.flushInterval"),
+	}
 	return nil
 }
+
+// parsePublicAddr parses the public address of BIND, host or host:port.
+func parsePublicAddr(s string) (host string, port int, err error) {
+	host, sp, err := net.SplitHostPort(s)
+	if err != nil {
+		// no port, such as example.com, 1.2.3.4, [::1] or ::1.
+		host, err = strings.Trim(s, "[]"), nil
+	} else if port, err = strconv.Atoi(sp); err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("bind.publicAddr %s: invalid port", s)
+	}
+	if host == "" || len(host) > 255 {
+		return "", 0, fmt.Errorf("bind.publicAddr %s: invalid host", s)
+	}
+	return
+}
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"allowedCommands",
+	"billing.batchSize",
+	"billing.flushInterval",
+	"bind",
+	"bind.publicAddr",
+	"breaker.cooldown",
+	"breaker.threshold",
+	"breaker.window",
+	"bypass.action",
+	"comp",
+	"connEvents",
+	"connEvents.rate",
+	"connEvents.sample",
+	"dns.cache",
+	"dns.cache.maxEntries",
+	"dns.cache.stale",
+	"dns.cache.ttl",
+	"forwarded",
+	"hash",
+	"idleTimeout",
+	"interceptors",
+	"maskIP",
+	"mux.keepaliveDisabled",
+	"mux.keepaliveInterval",
+	"mux.keepaliveTimeout",
+	"mux.maxFrameSize",
+	"mux.maxReceiveBuffer",
+	"mux.maxStreamBuffer",
+	"mux.version",
+	"notls",
+	"observePeriod",
+	"ports.allow",
+	"ports.deny",
+	"proxyProtocol",
+	"quota.conn",
+	"quota.daily",
+	"quota.file",
+	"quota.redis",
+	"quota.redis.db",
+	"quota.redis.key",
+	"quota.redis.password",
+	"readTimeout",
+	"requireAuth",
+	"resolver",
+	"schedule",
+	"schedule.default",
+	"schedule.terminate",
+	"sniffing.timeout",
+	"sniRewrite",
+	"sniSniffing",
+	"tls.alpn",
+	"tls.certAuth",
+	"tls.ticketKeys",
+	"tracing",
+	"udp",
+	"udp.strictPeer",
+	"udp.transparent",
+	"udpBufferSize",
+	"writeTimeout",
+}
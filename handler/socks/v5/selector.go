@@ -3,21 +3,53 @@ package v5
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 
 	"github.com/go-gost/core/auth"
 	"github.com/go-gost/core/logger"
 	"github.com/go-gost/gosocks5"
 	ctxvalue "github.com/go-gost/x/ctx"
+	"github.com/go-gost/x/internal/util/schedule"
 	"github.com/go-gost/x/internal/util/socks"
 )
 
+const (
+	// the max number of the methods advertised by the client, it is far more than the known methods.
+	maxMethods = 16
+	// the max lengths of the username and password of the RFC 1929 sub-negotiation.
+	maxUsernameLength = 128
+	maxPasswordLength = 128
+)
+
+var (
+	errTooManyMethods     = errors.New("socks5: too many methods")
+	errCredentialsTooLong = errors.New("socks5: username or password too long")
+	errNoAuther           = errors.New("socks5: authentication is required but no auther is set")
+	errTLSRequired        = errors.New("socks5: the client certificate is required but no TLS method is offered")
+)
+
 type serverSelector struct {
 	methods       []uint8
 	Authenticator auth.Authenticator
 	TLSConfig     *tls.Config
 	logger        logger.Logger
 	noTLS         bool
+	// alpn is the required application protocol for the TLS methods.
+	alpn string
+	// certAuth uses the verified client certificate CN as the client ID.
+	certAuth bool
+	// schedule rejects the authenticated clients out of their time windows.
+	schedule *schedule.Schedule
+	// requireAuth refuses all the clients if Authenticator is not set.
+	requireAuth bool
+	// tlsState is the state of the negotiated TLS connection,
+	// it is only available when the selector is used for a single connection.
+	tlsState *tls.ConnectionState
+	// err is the violation of the protocol found in the method selection.
+	err error
 }
 
 func (selector *serverSelector) Methods() []uint8 {
@@ -26,6 +58,18 @@ func (selector *serverSelector) Methods() []uint8 {
 
 func (s *serverSelector) Select(methods ...uint8) (method uint8) {
 	s.logger.Debugf("%d %d %v", gosocks5.Ver5, len(methods), methods)
+	if len(methods) > maxMethods {
+		s.err = fmt.Errorf("%w: %d", errTooManyMethods, len(methods))
+		return gosocks5.MethodNoAcceptable
+	}
+	if s.requireAuth && s.Authenticator == nil {
+		s.err = errNoAuther
+		return gosocks5.MethodNoAcceptable
+	}
+	if s.certAuth {
+		return s.selectTLS(methods)
+	}
+
 	method = gosocks5.MethodNoAuth
 	for _, m := range methods {
 		if m == socks.MethodTLS && !s.noTLS {
@@ -47,20 +91,58 @@ func (s *serverSelector) Select(methods ...uint8) (method uint8) {
 	return
 }
 
+// selectTLS selects the method when the client certificate is required,
+// only the TLS methods are acceptable, as the other ones never verify the certificate.
+func (s *serverSelector) selectTLS(methods []uint8) uint8 {
+	var tlsOffered, tlsAuthOffered bool
+	for _, m := range methods {
+		switch m {
+		case socks.MethodTLS:
+			tlsOffered = true
+		case socks.MethodTLSAuth:
+			tlsAuthOffered = true
+		}
+	}
+
+	switch {
+	case s.noTLS || !(tlsOffered || tlsAuthOffered):
+		s.err = errTLSRequired
+		return gosocks5.MethodNoAcceptable
+	// when Authenticator is set, auth is mandatory
+	case s.Authenticator != nil || !tlsOffered:
+		return socks.MethodTLSAuth
+	default:
+		return socks.MethodTLS
+	}
+}
+
 func (s *serverSelector) OnSelected(method uint8, conn net.Conn) (string, net.Conn, error) {
 	s.logger.Debugf("%d %d", gosocks5.Ver5, method)
 	switch method {
 	case gosocks5.MethodNoAuth:
 
 	case socks.MethodTLS:
-		conn = tls.Server(conn, s.TLSConfig)
+		tc, id, err := s.serverTLS(conn)
+		if err != nil {
+			return "", nil, err
+		}
+		return id, tc, nil
 
 	case gosocks5.MethodUserPass, socks.MethodTLSAuth:
+		var certID string
 		if method == socks.MethodTLSAuth {
-			conn = tls.Server(conn, s.TLSConfig)
+			tc, id, err := s.serverTLS(conn)
+			if err != nil {
+				return "", nil, err
+			}
+			conn, certID = tc, id
 		}
 
-		req, err := gosocks5.ReadUserPassRequest(conn)
+		req, err := readUserPassRequest(conn)
+		if errors.Is(err, errCredentialsTooLong) {
+			resp := gosocks5.NewUserPassResponse(gosocks5.UserPassVer, gosocks5.Failure)
+			resp.Write(conn)
+		}
 		if err != nil {
 			s.logger.Error(err)
 			return "", nil, err
@@ -83,6 +165,21 @@ func (s *serverSelector) OnSelected(method uint8, conn net.Conn) (string, net.Co
 				return "", nil, gosocks5.ErrAuthFailure
 			}
 		}
+		if id == "" {
+			id = certID
+		}
+
+		if err := s.schedule.Check(id); err != nil {
+			s.logger.Warn(err)
+			resp := gosocks5.NewUserPassResponse(gosocks5.UserPassVer, gosocks5.Failure)
+			if err := resp.Write(conn); err != nil {
+				s.logger.Error(err)
+				return "", nil, err
+			}
+			s.logger.Info(resp)
+
+			return "", nil, gosocks5.ErrAuthFailure
+		}
 
 		resp := gosocks5.NewUserPassResponse(gosocks5.UserPassVer, gosocks5.Succeeded)
 		s.logger.Trace(resp)
@@ -93,9 +190,80 @@ func (s *serverSelector) OnSelected(method uint8, conn net.Conn) (string, net.Co
 		return id, conn, nil
 
 	case gosocks5.MethodNoAcceptable:
+		if s.err != nil {
+			return "", nil, s.err
+		}
 		return "", nil, gosocks5.ErrBadMethod
 	default:
 		return "", nil, gosocks5.ErrBadFormat
 	}
 	return "", conn, nil
 }
+
+// serverTLS performs the TLS handshake for the TLS methods,
+// and returns the verified client certificate CN as the client ID if certAuth is enabled.
+func (s *serverSelector) serverTLS(conn net.Conn) (net.Conn, string, error) {
+	tc := tls.Server(conn, s.TLSConfig)
+	if err := tc.Handshake(); err != nil {
+		s.logger.Error(err)
+		return nil, "", err
+	}
+
+	cs := tc.ConnectionState()
+	s.tlsState = &cs
+
+	if s.alpn != "" && cs.NegotiatedProtocol != s.alpn {
+		err := fmt.Errorf("tls: ALPN mismatch, expected %q, got %q", s.alpn, cs.NegotiatedProtocol)
+		s.logger.Error(err)
+		return nil, "", err
+	}
+
+	var id string
+	if s.certAuth {
+		if len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+			err := errors.New("tls: no verified client certificate")
+			s.logger.Error(err)
+			return nil, "", err
+		}
+		id = cs.VerifiedChains[0][0].Subject.CommonName
+	}
+
+	return tc, id, nil
+}
+
+// readUserPassRequest reads the RFC 1929 username/password request,
+// the lengths are checked before the username and password are read.
+func readUserPassRequest(r io.Reader) (*gosocks5.UserPassRequest, error) {
+	var b [255]byte
+
+	if _, err := io.ReadFull(r, b[:2]); err != nil {
+		return nil, err
+	}
+	if b[0] != gosocks5.UserPassVer {
+		return nil, gosocks5.ErrBadVersion
+	}
+
+	req := &gosocks5.UserPassRequest{
+		Version: b[0],
+	}
+
+	ulen := int(b[1])
+	if ulen > maxUsernameLength {
+		return nil, fmt.Errorf("%w: username %d", errCredentialsTooLong, ulen)
+	}
+	if _, err := io.ReadFull(r, b[:ulen+1]); err != nil {
+		return nil, err
+	}
+	req.Username = string(b[:ulen])
+
+	plen := int(b[ulen])
+	if plen > maxPasswordLength {
+		return nil, fmt.Errorf("%w: password %d", errCredentialsTooLong, plen)
+	}
+	if _, err := io.ReadFull(r, b[:plen]); err != nil {
+		return nil, err
+	}
+	req.Password = string(b[:plen])
+
+	return req, nil
+}
@@ -0,0 +1,48 @@
+package v5
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-gost/gosocks5"
+	"github.com/go-gost/x/internal/util/socks"
+	xlogger "github.com/go-gost/x/logger"
+)
+
+func TestSelectCertAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		methods []uint8
+		auther  bool
+		noTLS   bool
+		want    uint8
+		err     error
+	}{
+		{name: "no auth", methods: []uint8{gosocks5.MethodNoAuth}, want: gosocks5.MethodNoAcceptable, err: errTLSRequired},
+		{name: "user pass", methods: []uint8{gosocks5.MethodUserPass}, auther: true, want: gosocks5.MethodNoAcceptable, err: errTLSRequired},
+		{name: "no methods", want: gosocks5.MethodNoAcceptable, err: errTLSRequired},
+		{name: "tls", methods: []uint8{gosocks5.MethodNoAuth, socks.MethodTLS}, want: socks.MethodTLS},
+		{name: "tls auth", methods: []uint8{gosocks5.MethodNoAuth, socks.MethodTLSAuth}, want: socks.MethodTLSAuth},
+		{name: "tls with auther", methods: []uint8{socks.MethodTLS}, auther: true, want: socks.MethodTLSAuth},
+		{name: "tls disabled", methods: []uint8{socks.MethodTLS, socks.MethodTLSAuth}, noTLS: true, want: gosocks5.MethodNoAcceptable, err: errTLSRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &serverSelector{
+				logger:   xlogger.Nop(),
+				certAuth: true,
+				noTLS:    tt.noTLS,
+			}
+			if tt.auther {
+				s.Authenticator = newAuther("a", "1")
+			}
+			if got := s.Select(tt.methods...); got != tt.want {
+				t.Errorf("got method %d, want %d", got, tt.want)
+			}
+			if !errors.Is(s.err, tt.err) {
+				t.Errorf("got error %v, want %v", s.err, tt.err)
+			}
+		})
+	}
+}
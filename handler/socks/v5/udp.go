@@ -6,19 +6,25 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"time"
 
 	"github.com/go-gost/core/logger"
+	"github.com/go-gost/core/metrics"
 	"github.com/go-gost/core/observer/stats"
 	"github.com/go-gost/gosocks5"
 	ctxvalue "github.com/go-gost/x/ctx"
 	xnet "github.com/go-gost/x/internal/net"
 	"github.com/go-gost/x/internal/net/udp"
+	"github.com/go-gost/x/internal/util/hotswap"
 	"github.com/go-gost/x/internal/util/socks"
+	xmetrics "github.com/go-gost/x/metrics"
 	stats_wrapper "github.com/go-gost/x/observer/stats/wrapper"
 )
 
-func (h *socks5Handler) handleUDP(ctx context.Context, conn net.Conn, log logger.Logger) error {
+// handleUDP handles the UDP ASSOCIATE request,
+// the address is the hint of the address from which the client sends the datagrams.
+func (h *socks5Handler) handleUDP(ctx context.Context, conn net.Conn, address string, live *hotswap.Options, log logger.Logger) error {
 	log = log.WithFields(map[string]any{
 		"cmd": "udp",
 	})
@@ -27,19 +33,18 @@ func (h *socks5Handler) handleUDP(ctx context.Context, conn net.Conn, log logger
 		reply := gosocks5.NewReply(gosocks5.NotAllowed, nil)
 		log.Trace(reply)
 		log.Error("socks5: UDP relay is disabled")
-		return reply.Write(conn)
+		return h.writeReply(conn, reply)
 	}
 
-	lc := xnet.ListenConfig{
-		Netns: h.options.Netns,
-	}
-	laddr := &net.UDPAddr{IP: conn.LocalAddr().(*net.TCPAddr).IP, Port: 0} // use out-going interface's IP
-	cc, err := lc.ListenPacket(ctx, "udp", laddr.String())
+	// use out-going interface's IP,
+	// it is the original destination if the connection is redirected by TPROXY.
+	laddr := &net.UDPAddr{IP: conn.LocalAddr().(*net.TCPAddr).IP, Port: 0}
+	cc, err := h.listenUDP(ctx, laddr.String(), log)
 	if err != nil {
 		log.Error(err)
 		reply := gosocks5.NewReply(gosocks5.Failure, nil)
 		log.Trace(reply)
-		reply.Write(conn)
+		h.writeReply(conn, reply)
 		return err
 	}
 	defer cc.Close()
@@ -48,7 +53,7 @@ func (h *socks5Handler) handleUDP(ctx context.Context, conn net.Conn, log logger
 	saddr.ParseFrom(cc.LocalAddr().String())
 	reply := gosocks5.NewReply(gosocks5.Succeeded, &saddr)
 	log.Trace(reply)
-	if err := reply.Write(conn); err != nil {
+	if err := h.writeReply(conn, reply); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -73,6 +78,10 @@ func (h *socks5Handler) handleUDP(ctx context.Context, conn net.Conn, log logger
 		return err
 	}
 
+	if h.md.udpStrictPeer {
+		cc = h.peerPacketConn(cc, conn.RemoteAddr(), address, log)
+	}
+
 	clientID := ctxvalue.ClientIDFromContext(ctx)
 	if h.options.Observer != nil {
 		pstats := h.stats.Stats(string(clientID))
@@ -81,9 +90,12 @@ func (h *socks5Handler) handleUDP(ctx context.Context, conn net.Conn, log logger
 		defer pstats.Add(stats.KindCurrentConns, -1)
 		cc = stats_wrapper.WrapPacketConn(cc, pstats)
 	}
+	acct := h.billing.Start(string(clientID))
+	defer acct.End()
+	cc = stats_wrapper.WrapPacketConn(cc, acct.Stats())
 
 	r := udp.NewRelay(socks.UDPConn(cc, h.md.udpBufferSize), pc).
-		WithBypass(h.options.Bypass).
+		WithBypass(live.Bypass).
 		WithLogger(log)
 	r.SetBufferSize(h.md.udpBufferSize)
 
@@ -97,3 +109,86 @@ func (h *socks5Handler) handleUDP(ctx context.Context, conn net.Conn, log logger
 
 	return nil
 }
+
+// listenUDP opens the socket of the association, which the datagrams are replied from.
+// The transparent socket is tried first if it is enabled, it is one per association bound to the address.
+// If it is not permitted, the socket falls back to the unspecified address,
+// as the non-local original destination can not be bound without IP_TRANSPARENT.
+func (h *socks5Handler) listenUDP(ctx context.Context, address string, log logger.Logger) (net.PacketConn, error) {
+	lc := xnet.ListenConfig{
+		Netns: h.options.Netns,
+	}
+	if h.md.udpTransparent {
+		pc, err := udp.ListenTransparent(ctx, &lc, "udp", address)
+		if !errors.Is(err, udp.ErrTransparent) {
+			return pc, err
+		}
+		log.Warnf("%v, the datagrams are replied from the local address instead of %s", err, address)
+		address = ":0"
+	}
+	return lc.ListenPacket(ctx, "udp", address)
+}
+
+// peerPacketConn restricts the datagrams of the association to the peer.
+// The non-zero IP and port of the hint must be matched,
+// and the IP of the client is required if the hint has no IP.
+func (h *socks5Handler) peerPacketConn(pc net.PacketConn, client net.Addr, hint string, log logger.Logger) net.PacketConn {
+	var ip net.IP
+	var port int
+	if host, sp, _ := net.SplitHostPort(hint); host != "" {
+		ip = net.ParseIP(host)
+		port, _ = strconv.Atoi(sp)
+	}
+	if ip == nil || ip.IsUnspecified() {
+		ip = nil
+		if addr, _ := client.(*net.TCPAddr); addr != nil {
+			ip = addr.IP
+		}
+	}
+	if ip == nil && port == 0 {
+		return pc
+	}
+
+	log.Debugf("udp peer: %s", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+	return &peerPacketConn{
+		PacketConn: pc,
+		ip:         ip,
+		port:       port,
+		service:    h.options.Service,
+		log:        log,
+	}
+}
+
+type peerPacketConn struct {
+	net.PacketConn
+	ip      net.IP
+	port    int
+	service string
+	log     logger.Logger
+}
+
+func (c *peerPacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	for {
+		n, addr, err = c.PacketConn.ReadFrom(b)
+		if err != nil || c.match(addr) {
+			return
+		}
+
+		c.log.Debugf("udp peer mismatch: datagram from %s is dropped", addr)
+		if v := xmetrics.GetCounter(xmetrics.MetricServiceUDPDroppedCounter,
+			metrics.Labels{"service": c.service, "reason": "peer"}); v != nil {
+			v.Inc()
+		}
+	}
+}
+
+func (c *peerPacketConn) match(addr net.Addr) bool {
+	ua, _ := addr.(*net.UDPAddr)
+	if ua == nil {
+		return false
+	}
+	if c.ip != nil && !c.ip.Equal(ua.IP) {
+		return false
+	}
+	return c.port == 0 || c.port == ua.Port
+}
@@ -12,11 +12,12 @@ import (
 	ctxvalue "github.com/go-gost/x/ctx"
 	xnet "github.com/go-gost/x/internal/net"
 	"github.com/go-gost/x/internal/net/udp"
+	"github.com/go-gost/x/internal/util/hotswap"
 	"github.com/go-gost/x/internal/util/socks"
 	stats_wrapper "github.com/go-gost/x/observer/stats/wrapper"
 )
 
-func (h *socks5Handler) handleUDPTun(ctx context.Context, conn net.Conn, network, address string, log logger.Logger) error {
+func (h *socks5Handler) handleUDPTun(ctx context.Context, conn net.Conn, network, address string, live *hotswap.Options, log logger.Logger) error {
 	log = log.WithFields(map[string]any{
 		"cmd": "udp-tun",
 	})
@@ -33,7 +34,7 @@ func (h *socks5Handler) handleUDPTun(ctx context.Context, conn net.Conn, network
 			reply := gosocks5.NewReply(gosocks5.NotAllowed, nil)
 			log.Trace(reply)
 			log.Error("socks5: UDP relay is disabled")
-			return reply.Write(conn)
+			return h.writeReply(conn, reply)
 		}
 
 		// obtain a udp connection
@@ -57,7 +58,7 @@ func (h *socks5Handler) handleUDPTun(ctx context.Context, conn net.Conn, network
 			reply := gosocks5.NewReply(gosocks5.NotAllowed, nil)
 			log.Trace(reply)
 			log.Error("socks5: BIND is disabled")
-			return reply.Write(conn)
+			return h.writeReply(conn, reply)
 		}
 
 		lc := xnet.ListenConfig{
@@ -69,7 +70,7 @@ func (h *socks5Handler) handleUDPTun(ctx context.Context, conn net.Conn, network
 			log.Error(err)
 			reply := gosocks5.NewReply(gosocks5.Failure, nil)
 			log.Trace(reply)
-			reply.Write(conn)
+			h.writeReply(conn, reply)
 			return err
 		}
 	}
@@ -79,7 +80,7 @@ func (h *socks5Handler) handleUDPTun(ctx context.Context, conn net.Conn, network
 	saddr.ParseFrom(pc.LocalAddr().String())
 	reply := gosocks5.NewReply(gosocks5.Succeeded, &saddr)
 	log.Trace(reply)
-	if err := reply.Write(conn); err != nil {
+	if err := h.writeReply(conn, reply); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -93,9 +94,12 @@ func (h *socks5Handler) handleUDPTun(ctx context.Context, conn net.Conn, network
 		defer pstats.Add(stats.KindCurrentConns, -1)
 		conn = stats_wrapper.WrapConn(conn, pstats)
 	}
+	acct := h.billing.Start(string(clientID))
+	defer acct.End()
+	conn = stats_wrapper.WrapConn(conn, acct.Stats())
 
 	r := udp.NewRelay(socks.UDPTunServerConn(conn), pc).
-		WithBypass(h.options.Bypass).
+		WithBypass(live.Bypass).
 		WithLogger(log)
 	r.SetBufferSize(h.md.udpBufferSize)
 
@@ -11,6 +11,7 @@ type metadata struct {
 	key         string
 	readTimeout time.Duration
 	hash        string
+	maskIP      bool
 }
 
 func (h *ssHandler) parseMetadata(md mdata.Metadata) (err error) {
@@ -18,11 +19,21 @@ func (h *ssHandler) parseMetadata(md mdata.Metadata) (err error) {
 		key         = "key"
 		readTimeout = "readTimeout"
 		hash        = "hash"
+		maskIP      = "maskIP"
 	)
 
 	h.md.key = mdutil.GetString(md, key)
 	h.md.readTimeout = mdutil.GetDuration(md, readTimeout)
 	h.md.hash = mdutil.GetString(md, hash)
 
+	h.md.maskIP = mdutil.GetBool(md, maskIP)
 	return
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"hash",
+	"key",
+	"maskIP",
+	"readTimeout",
+}
@@ -12,6 +12,7 @@ type metadata struct {
 	key         string
 	readTimeout time.Duration
 	bufferSize  int
+	maskIP      bool
 }
 
 func (h *ssuHandler) parseMetadata(md mdata.Metadata) (err error) {
@@ -19,6 +20,7 @@ func (h *ssuHandler) parseMetadata(md mdata.Metadata) (err error) {
 		key         = "key"
 		readTimeout = "readTimeout"
 		bufferSize  = "bufferSize"
+		maskIP      = "maskIP"
 	)
 
 	h.md.key = mdutil.GetString(md, key)
@@ -29,5 +31,14 @@ func (h *ssuHandler) parseMetadata(md mdata.Metadata) (err error) {
 	} else {
 		h.md.bufferSize = 4096
 	}
+	h.md.maskIP = mdutil.GetBool(md, maskIP)
 	return
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"bufferSize",
+	"key",
+	"maskIP",
+	"readTimeout",
+}
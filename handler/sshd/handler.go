@@ -14,6 +14,8 @@ import (
 	md "github.com/go-gost/core/metadata"
 	netpkg "github.com/go-gost/x/internal/net"
 	sshd_util "github.com/go-gost/x/internal/util/sshd"
+	xlogger "github.com/go-gost/x/logger"
+	mdx "github.com/go-gost/x/metadata"
 	"github.com/go-gost/x/registry"
 	"golang.org/x/crypto/ssh"
 )
@@ -25,6 +27,7 @@ const (
 
 func init() {
 	registry.HandlerRegistry().Register("sshd", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "sshd", schema...)
 }
 
 type forwardHandler struct {
@@ -58,6 +61,9 @@ func (h *forwardHandler) Handle(ctx context.Context, conn net.Conn, opts ...hand
 		"remote": conn.RemoteAddr().String(),
 		"local":  conn.LocalAddr().String(),
 	})
+	if h.md.maskIP {
+		log = xlogger.MaskIP(log, conn.RemoteAddr())
+	}
 
 	if !h.checkRateLimit(conn.RemoteAddr()) {
 		return nil
@@ -98,7 +104,9 @@ func (h *forwardHandler) handleDirectForward(ctx context.Context, conn *sshd_uti
 
 	t := time.Now()
 	log.Infof("%s <-> %s", cc.LocalAddr(), targetAddr)
-	netpkg.Transport(conn, cc)
+	if err := netpkg.TransportWithIdleTimeout(conn, cc, conn.IdleTimeout()); err == netpkg.ErrIdleTimeout {
+		log.Debugf("%s >-< %s: %v", cc.LocalAddr(), targetAddr, err)
+	}
 	log.WithFields(map[string]any{
 		"duration": time.Since(t),
 	}).Infof("%s >-< %s", cc.LocalAddr(), targetAddr)
@@ -158,6 +166,7 @@ func (h *forwardHandler) handleRemoteForward(ctx context.Context, conn *sshd_uti
 	}
 
 	sshConn := conn.Conn()
+	idleTimeout := conn.IdleTimeout()
 
 	go func() {
 		for {
@@ -196,7 +205,9 @@ func (h *forwardHandler) handleRemoteForward(ctx context.Context, conn *sshd_uti
 
 				t := time.Now()
 				log.Debugf("%s <-> %s", conn.LocalAddr(), conn.RemoteAddr())
-				netpkg.Transport(ch, conn)
+				if err := netpkg.TransportWithIdleTimeout(ch, conn, idleTimeout); err == netpkg.ErrIdleTimeout {
+					log.Debugf("%s >-< %s: %v", conn.LocalAddr(), conn.RemoteAddr(), err)
+				}
 				log.WithFields(map[string]any{
 					"duration": time.Since(t),
 				}).Debugf("%s >-< %s", conn.LocalAddr(), conn.RemoteAddr())
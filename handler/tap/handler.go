@@ -18,6 +18,7 @@ import (
 	md "github.com/go-gost/core/metadata"
 	"github.com/go-gost/x/internal/util/ss"
 	tap_util "github.com/go-gost/x/internal/util/tap"
+	mdx "github.com/go-gost/x/metadata"
 	"github.com/go-gost/x/registry"
 	"github.com/shadowsocks/go-shadowsocks2/core"
 	"github.com/shadowsocks/go-shadowsocks2/shadowaead"
@@ -26,6 +27,7 @@ import (
 
 func init() {
 	registry.HandlerRegistry().Register("tap", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "tap", schema...)
 }
 
 type tapHandler struct {
@@ -23,3 +23,9 @@ func (h *tapHandler) parseMetadata(md mdata.Metadata) (err error) {
 	}
 	return
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"bufferSize",
+	"key",
+}
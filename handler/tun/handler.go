@@ -13,6 +13,7 @@ import (
 	"github.com/go-gost/core/hop"
 	md "github.com/go-gost/core/metadata"
 	tun_util "github.com/go-gost/x/internal/util/tun"
+	mdx "github.com/go-gost/x/metadata"
 	"github.com/go-gost/x/registry"
 	"github.com/songgao/water/waterutil"
 )
@@ -24,6 +25,7 @@ var (
 
 func init() {
 	registry.HandlerRegistry().Register("tun", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "tun", schema...)
 }
 
 type tunHandler struct {
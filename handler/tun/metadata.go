@@ -36,3 +36,19 @@ func (h *tunHandler) parseMetadata(md mdata.Metadata) (err error) {
 	h.md.p2p = mdutil.GetBool(md, "tun.p2p", "p2p")
 	return
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"buffersize",
+	"bufsize",
+	"keepalive",
+	"p2p",
+	"passphrase",
+	"token",
+	"ttl",
+	"tun.bufsize",
+	"tun.keepalive",
+	"tun.p2p",
+	"tun.token",
+	"tun.ttl",
+}
@@ -0,0 +1,108 @@
+package tunnel
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-gost/relay"
+)
+
+const (
+	defaultAffinityTTL        = 10 * time.Minute
+	defaultAffinityMaxEntries = 65536
+)
+
+type affinityKey struct {
+	tid    string
+	client string
+}
+
+type affinityEntry struct {
+	cid     relay.ConnectorID
+	expires time.Time
+}
+
+// clientAffinity pins the external clients of the entrypoint to the connectors of the tunnels by the client IP,
+// so the stateful backends see the same client through the same connector as long as the connector is alive.
+// The pin expires after the client is inactive for the TTL, and the connector is selected by the weights
+// (then pinned again) if the pinned one is closed, draining or failed.
+type clientAffinity struct {
+	ttl        time.Duration
+	maxEntries int
+	entries    map[affinityKey]*affinityEntry
+	swept      time.Time
+	mu         sync.Mutex
+}
+
+func newClientAffinity(ttl time.Duration, maxEntries int) *clientAffinity {
+	if ttl <= 0 {
+		ttl = defaultAffinityTTL
+	}
+	if maxEntries <= 0 {
+		maxEntries = defaultAffinityMaxEntries
+	}
+	return &clientAffinity{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[affinityKey]*affinityEntry),
+		swept:      time.Now(),
+	}
+}
+
+// get returns the connector the client is pinned to for the tunnel tid.
+func (a *clientAffinity) get(tid, client string) (relay.ConnectorID, bool) {
+	if a == nil || client == "" {
+		return relay.ConnectorID{}, false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e := a.entries[affinityKey{tid: tid, client: client}]
+	if e == nil || time.Now().After(e.expires) {
+		return relay.ConnectorID{}, false
+	}
+	return e.cid, true
+}
+
+// set pins the client to the connector cid for the tunnel tid, or refreshes the pin.
+// The client is not pinned if the table is full of the active pins.
+func (a *clientAffinity) set(tid, client string, cid relay.ConnectorID) {
+	if a == nil || client == "" {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(a.swept) >= a.ttl {
+		for k, e := range a.entries {
+			if now.After(e.expires) {
+				delete(a.entries, k)
+			}
+		}
+		a.swept = now
+	}
+
+	key := affinityKey{tid: tid, client: client}
+	e := a.entries[key]
+	if e == nil {
+		if len(a.entries) >= a.maxEntries {
+			return
+		}
+		e = &affinityEntry{}
+		a.entries[key] = e
+	}
+	e.cid = cid
+	e.expires = now.Add(a.ttl)
+}
+
+// affinityClient returns the client IP of the address (host:port) the affinity is keyed by.
+func affinityClient(addr string) string {
+	if host, _, _ := net.SplitHostPort(addr); host != "" {
+		return host
+	}
+	return addr
+}
@@ -8,14 +8,16 @@ import (
 
 	"github.com/go-gost/core/ingress"
 	"github.com/go-gost/core/logger"
+	mdata "github.com/go-gost/core/metadata"
 	"github.com/go-gost/core/observer/stats"
 	"github.com/go-gost/core/sd"
 	"github.com/go-gost/relay"
 	"github.com/go-gost/x/internal/util/mux"
+	quic_util "github.com/go-gost/x/internal/util/quic"
 	"github.com/google/uuid"
 )
 
-func (h *tunnelHandler) handleBind(ctx context.Context, conn net.Conn, network, address string, tunnelID relay.TunnelID, log logger.Logger) (err error) {
+func (h *tunnelHandler) handleBind(ctx context.Context, conn net.Conn, network, address string, tunnelID relay.TunnelID, datagram bool, log logger.Logger) (err error) {
 	resp := relay.Response{
 		Version: relay.Version1,
 		Status:  relay.StatusOK,
@@ -24,7 +26,7 @@ func (h *tunnelHandler) handleBind(ctx context.Context, conn net.Conn, network,
 	uuid, err := uuid.NewRandom()
 	if err != nil {
 		resp.Status = relay.StatusInternalServerError
-		resp.WriteTo(conn)
+		h.writeResponse(conn, &resp)
 		return
 	}
 	connectorID := relay.NewConnectorID(uuid[:])
@@ -53,7 +55,7 @@ func (h *tunnelHandler) handleBind(ctx context.Context, conn net.Conn, network,
 			ID: connectorID,
 		},
 	)
-	resp.WriteTo(conn)
+	h.writeResponse(conn, &resp)
 
 	// Upgrade connection to multiplex session.
 	session, err := mux.ClientSession(conn, h.md.muxCfg)
@@ -66,11 +68,25 @@ func (h *tunnelHandler) handleBind(ctx context.Context, conn net.Conn, network,
 		stats = h.stats.Stats(tunnelID.String())
 	}
 
+	// the connector requests relaying the UDP datagrams over the QUIC datagrams.
+	var ds *quic_util.DatagramSession
+	if datagram && network == "udp" {
+		if v, ok := conn.(mdata.Metadatable); ok && v.Metadata() != nil {
+			ds, _ = v.Metadata().Get(quic_util.MetadataKeyDatagramSession).(*quic_util.DatagramSession)
+		}
+		if !ds.Supported() {
+			ds = nil
+		}
+	}
+
 	c := NewConnector(connectorID, tunnelID, h.id, session, &ConnectorOptions{
-		service: h.options.Service,
-		sd:      h.md.sd,
-		stats:   stats,
-		limiter: h.limiter,
+		service:       h.options.Service,
+		sd:            h.md.sd,
+		stats:         stats,
+		limiter:       h.trafficLimiter,
+		datagram:      ds,
+		acceptRetries: h.md.tunnelAcceptRetries,
+		acceptBackoff: h.md.tunnelAcceptBackoff,
 	})
 
 	h.pool.Add(tunnelID, c, h.md.tunnelTTL)
@@ -99,7 +115,7 @@ func (h *tunnelHandler) handleBind(ctx context.Context, conn net.Conn, network,
 		}
 	}
 
-	log.Debugf("%s/%s: tunnel=%s, connector=%s, weight=%d established", addr, network, tunnelID, connectorID, connectorID.Weight())
+	log.Debugf("%s/%s: tunnel=%s, connector=%s, weight=%d, datagram=%v, session=%s established", addr, network, tunnelID, connectorID, connectorID.Weight(), ds != nil, c.SessionInfo())
 
 	return
 }
@@ -2,16 +2,22 @@ package tunnel
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"time"
 
 	"github.com/go-gost/core/logger"
 	"github.com/go-gost/relay"
+	ctxvalue "github.com/go-gost/x/ctx"
 	xnet "github.com/go-gost/x/internal/net"
+	"github.com/go-gost/x/internal/util/conntrack"
+	"github.com/go-gost/x/internal/util/hotswap"
+	xrelay "github.com/go-gost/x/internal/util/relay"
+	stats_wrapper "github.com/go-gost/x/observer/stats/wrapper"
 )
 
-func (h *tunnelHandler) handleConnect(ctx context.Context, req *relay.Request, conn net.Conn, network, srcAddr string, dstAddr string, tunnelID relay.TunnelID, log logger.Logger) error {
+func (h *tunnelHandler) handleConnect(ctx context.Context, req *relay.Request, conn net.Conn, network, srcAddr string, dstAddr string, tunnelID relay.TunnelID, live *hotswap.Options, log logger.Logger) error {
 	log = log.WithFields(map[string]any{
 		"dst":    fmt.Sprintf("%s/%s", dstAddr, network),
 		"cmd":    "connect",
@@ -23,10 +29,11 @@ func (h *tunnelHandler) handleConnect(ctx context.Context, req *relay.Request, c
 		Status:  relay.StatusOK,
 	}
 
-	if h.options.Bypass != nil && h.options.Bypass.Contains(ctx, network, dstAddr) {
+	if bp := live.Bypass; bp != nil && bp.Contains(ctx, network, dstAddr) {
 		log.Debug("bypass: ", dstAddr)
 		resp.Status = relay.StatusForbidden
-		_, err := resp.WriteTo(conn)
+		h.setMessage(&resp, "access to %s is not allowed", dstAddr)
+		err := h.writeResponse(conn, &resp)
 		return err
 	}
 
@@ -34,7 +41,7 @@ func (h *tunnelHandler) handleConnect(ctx context.Context, req *relay.Request, c
 
 	// client is a public entrypoint.
 	if tunnelID.Equal(h.md.entryPointID) {
-		resp.WriteTo(conn)
+		h.writeResponse(conn, &resp)
 		return h.ep.handle(ctx, conn)
 	}
 
@@ -42,39 +49,72 @@ func (h *tunnelHandler) handleConnect(ctx context.Context, req *relay.Request, c
 		var tid relay.TunnelID
 		if ingress := h.md.ingress; ingress != nil && host != "" {
 			if rule := ingress.GetRule(ctx, host); rule != nil {
+				// the source address is the one from proxy protocol if enabled,
+				// the denied visitor is closed without a response.
+				if !checkAccess(ctx, ingress, rule, conn.RemoteAddr(), log) {
+					return ErrAccessDenied
+				}
 				tid = parseTunnelID(rule.Endpoint)
 			}
 		}
 		if !tid.Equal(tunnelID) {
 			resp.Status = relay.StatusHostUnreachable
-			resp.WriteTo(conn)
+			h.setMessage(&resp, "no route to host %s", host)
+			h.writeResponse(conn, &resp)
 			err := fmt.Errorf("no route to host %s", host)
 			log.Error(err)
 			return err
 		}
 	}
 
+	if t := h.pool.Tunnel(tunnelID.String()); t != nil {
+		if !t.AcquireConn(h.md.tunnelMaxConns) {
+			resp.Status = relay.StatusServiceUnavailable
+			h.setMessage(&resp, "tunnel %s: too many connections", tunnelID)
+			h.writeResponse(conn, &resp)
+			log.Error(ErrTooManyConns)
+			return ErrTooManyConns
+		}
+		defer t.ReleaseConn()
+	}
+
+	// the connectors failed to open the stream (such as the session just died) are skipped in the retries.
 	d := Dialer{
 		node:    h.id,
 		pool:    h.pool,
 		sd:      h.md.sd,
-		retry:   3,
+		retry:   1 + h.md.connectRetries,
 		timeout: 15 * time.Second,
+		wait:    h.md.waitTimeout,
 		log:     log,
 	}
 	cc, node, cid, err := d.Dial(ctx, network, tunnelID.String())
 	if err != nil {
 		log.Error(err)
 		resp.Status = relay.StatusServiceUnavailable
-		resp.WriteTo(conn)
+		if errors.Is(err, ErrTunnelNotAvailable) {
+			h.setMessage(&resp, "tunnel %s not registered", tunnelID)
+		} else {
+			h.setMessage(&resp, "tunnel %s not available", tunnelID)
+		}
+		h.writeResponse(conn, &resp)
 		return err
 	}
-	defer cc.Close()
+	// the stream is replaced on failover.
+	defer func() {
+		if cc != nil {
+			cc.Close()
+		}
+	}()
 
 	log.Debugf("new connection to tunnel: %s, connector: %s", tunnelID, cid)
 
+	// the UDP association over the QUIC datagrams.
+	var assoc *datagramAssociation
+	// the data read in the probe of the stream.
+	var fromConn, fromCC []byte
 	if node == h.id {
-		if _, err := resp.WriteTo(conn); err != nil {
+		if err := h.writeResponse(conn, &resp); err != nil {
 			log.Error(err)
 			return err
 		}
@@ -92,14 +132,51 @@ func (h *tunnelHandler) handleConnect(ctx context.Context, req *relay.Request, c
 		af.ParseFrom(dstAddr)
 		resp.Features = append(resp.Features, af) // dst address
 
-		resp.WriteTo(cc)
+		if dc, ok := cc.(*datagramConn); ok && network == "udp" {
+			if a, err := dc.associate(); err != nil {
+				log.Warnf("datagram: %v, fallback to stream", err)
+			} else {
+				assoc = a
+				defer assoc.Close()
+				resp.Features = append(resp.Features, &xrelay.DatagramFeature{ID: assoc.ID()})
+			}
+		}
+
+		if assoc == nil && h.md.failoverRetries > 0 {
+			cc, cid, fromConn, fromCC, err = h.connectStream(ctx, &d, cc, cid, &resp, conn, network, tunnelID.String(), log)
+			if err != nil {
+				log.Error(err)
+				return err
+			}
+		} else {
+			resp.WriteTo(cc)
+		}
 	} else {
 		req.WriteTo(cc)
 	}
 
+	clientID := ctxvalue.ClientIDFromContext(ctx)
+	acct := h.billing.Start(string(clientID))
+	defer acct.End()
+	conn = stats_wrapper.WrapConn(conn, acct.Stats())
+
+	tc := conntrack.Track(h.options.Service, string(clientID), conn.RemoteAddr().String(), dstAddr, log, conn, cc)
+	defer tc.Untrack()
+
 	t := time.Now()
 	log.Debugf("%s <-> %s", conn.RemoteAddr(), cc.RemoteAddr())
-	xnet.Transport(conn, cc)
+	if assoc != nil {
+		if err := transportDatagram(tc.WrapReadWriter(conn), cc, assoc); err != nil {
+			log.Debugf("datagram: %v", err)
+		}
+	} else {
+		rw := tc.WrapReadWriter(conn)
+		if err := writeProbed(rw, cc, fromConn, fromCC); err != nil {
+			log.Error(err)
+			return err
+		}
+		xnet.Transport(rw, cc)
+	}
 	log.WithFields(map[string]any{
 		"duration": time.Since(t),
 	}).Debugf("%s >-< %s", conn.RemoteAddr(), cc.RemoteAddr())
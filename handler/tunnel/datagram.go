@@ -0,0 +1,200 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"sync"
+
+	"github.com/go-gost/core/common/bufpool"
+	"github.com/go-gost/core/limiter"
+	"github.com/go-gost/core/limiter/traffic"
+	"github.com/go-gost/core/metrics"
+	"github.com/go-gost/core/observer/stats"
+	quic_util "github.com/go-gost/x/internal/util/quic"
+	xtraffic "github.com/go-gost/x/limiter/traffic"
+	xmetrics "github.com/go-gost/x/metrics"
+)
+
+// datagramConn is a connection of the UDP connector,
+// the UDP datagrams can be relayed over the QUIC datagrams of the connector session.
+type datagramConn struct {
+	net.Conn
+	session *quic_util.DatagramSession
+	c       *Connector
+	// client is the visitor client of the client scoped limiter.
+	client string
+	// the traffic limiter of the handler when the connection is opened.
+	limiter traffic.TrafficLimiter
+}
+
+// associate creates a new association on the datagram session.
+func (c *datagramConn) associate() (*datagramAssociation, error) {
+	assoc, err := c.session.NewAssociation()
+	if err != nil {
+		return nil, err
+	}
+	return &datagramAssociation{
+		DatagramAssociation: assoc,
+		c:                   c.c,
+		client:              c.client,
+		limiter:             c.limiter,
+	}, nil
+}
+
+// datagramAssociation applies the stats and traffic limiters of the connector to each datagram,
+// along with the service scoped limiter and metrics, as the datagrams bypass the wrappers of the streams.
+type datagramAssociation struct {
+	*quic_util.DatagramAssociation
+	c       *Connector
+	client  string
+	limiter traffic.TrafficLimiter
+}
+
+func (a *datagramAssociation) Read(b []byte) (n int, err error) {
+	n, err = a.DatagramAssociation.Read(b)
+	if n > 0 {
+		a.wait(true, n)
+		if pstats := a.c.opts.stats; pstats != nil {
+			pstats.Add(stats.KindInputBytes, int64(n))
+		}
+		a.observe(xmetrics.MetricServiceTransferInputBytesCounter, n)
+	}
+	return
+}
+
+func (a *datagramAssociation) Write(b []byte) (n int, err error) {
+	a.wait(false, len(b))
+	n, err = a.DatagramAssociation.Write(b)
+	if n > 0 {
+		if pstats := a.c.opts.stats; pstats != nil {
+			pstats.Add(stats.KindOutputBytes, int64(n))
+		}
+		a.observe(xmetrics.MetricServiceTransferOutputBytesCounter, n)
+	}
+	return
+}
+
+func (a *datagramAssociation) observe(name metrics.MetricName, n int) {
+	if counter := xmetrics.GetCounter(name, metrics.Labels{
+		"service": a.c.opts.service,
+	}); counter != nil {
+		counter.Add(float64(n))
+	}
+}
+
+func (a *datagramAssociation) wait(in bool, n int) {
+	tl := a.limiter
+	if tl == nil {
+		return
+	}
+
+	wait := func(key string, scope string) {
+		opts := []limiter.Option{
+			limiter.ScopeOption(scope),
+			limiter.ServiceOption(a.c.opts.service),
+			limiter.ClientOption(key),
+			limiter.NetworkOption("udp"),
+		}
+		l := tl.Out(context.Background(), key, opts...)
+		if in {
+			l = tl.In(context.Background(), key, opts...)
+		}
+		if l != nil && l.Limit() > 0 {
+			l.Wait(context.Background(), n)
+		}
+	}
+
+	wait(a.c.tid.String(), xtraffic.ScopeTunnel)
+	if a.client != "" {
+		wait(a.client, limiter.ScopeClient)
+	}
+	// the service scope shared by all the connections of the service.
+	wait("", limiter.ScopeService)
+}
+
+// transportDatagram relays the UDP datagrams between the visitor conn and the connector.
+// The datagrams are framed by a 2-byte length header on the streams,
+// the datagrams to the connector are sent over the association if possible, or over the stream cc otherwise.
+func transportDatagram(conn io.ReadWriter, cc io.ReadWriter, assoc io.ReadWriter) error {
+	errc := make(chan error, 3)
+	// serializes the frames written to conn.
+	var mu sync.Mutex
+
+	go func() {
+		buf := bufpool.Get(math.MaxUint16)
+		defer bufpool.Put(buf)
+
+		for {
+			n, err := readDatagramFrame(conn, buf)
+			if err != nil {
+				errc <- err
+				return
+			}
+			if _, err := assoc.Write(buf[:n]); err == nil {
+				continue
+			}
+			// datagram is unavailable or too large, fallback to the stream.
+			if err := writeDatagramFrame(cc, buf[:n]); err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	for _, r := range []io.Reader{cc, assoc} {
+		go func(r io.Reader, framed bool) {
+			buf := bufpool.Get(math.MaxUint16)
+			defer bufpool.Put(buf)
+
+			for {
+				var n int
+				var err error
+				if framed {
+					n, err = readDatagramFrame(r, buf)
+				} else {
+					n, err = r.Read(buf)
+				}
+				if err != nil {
+					errc <- err
+					return
+				}
+
+				mu.Lock()
+				err = writeDatagramFrame(conn, buf[:n])
+				mu.Unlock()
+				if err != nil {
+					errc <- err
+					return
+				}
+			}
+		}(r, r == cc)
+	}
+
+	err := <-errc
+	if err == io.EOF {
+		err = nil
+	}
+	return err
+}
+
+func readDatagramFrame(r io.Reader, b []byte) (n int, err error) {
+	var bh [2]byte
+	if _, err = io.ReadFull(r, bh[:]); err != nil {
+		return
+	}
+	dlen := int(binary.BigEndian.Uint16(bh[:]))
+	return io.ReadFull(r, b[:dlen])
+}
+
+func writeDatagramFrame(w io.Writer, b []byte) error {
+	buf := bufpool.Get(2 + len(b))
+	defer bufpool.Put(buf)
+
+	binary.BigEndian.PutUint16(buf, uint16(len(b)))
+	copy(buf[2:], b)
+	_, err := w.Write(buf)
+	return err
+}
@@ -0,0 +1,146 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-gost/core/limiter"
+	"github.com/go-gost/core/limiter/traffic"
+	"github.com/go-gost/relay"
+	xtraffic "github.com/go-gost/x/limiter/traffic"
+	"github.com/google/uuid"
+	"github.com/quic-go/quic-go"
+)
+
+// scopeLimiter records the scopes of the limits looked up.
+type scopeLimiter struct {
+	mu     sync.Mutex
+	scopes map[string]string
+}
+
+func (l *scopeLimiter) record(key string, opts []limiter.Option) traffic.Limiter {
+	var options limiter.Options
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.scopes[options.Scope] = options.Service
+	return nil
+}
+
+func (l *scopeLimiter) In(ctx context.Context, key string, opts ...limiter.Option) traffic.Limiter {
+	return l.record(key, opts)
+}
+
+func (l *scopeLimiter) Out(ctx context.Context, key string, opts ...limiter.Option) traffic.Limiter {
+	return l.record(key, opts)
+}
+
+func TestDatagramAssociationScopes(t *testing.T) {
+	tid := uuid.New()
+
+	tests := []struct {
+		name   string
+		client string
+		want   []string
+	}{
+		{name: "anonymous", want: []string{xtraffic.ScopeTunnel, limiter.ScopeService}},
+		{name: "client", client: "user", want: []string{xtraffic.ScopeTunnel, limiter.ScopeClient, limiter.ScopeService}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lim := &scopeLimiter{scopes: map[string]string{}}
+			a := &datagramAssociation{
+				c: &Connector{
+					tid:  relay.NewTunnelID(tid[:]),
+					opts: &ConnectorOptions{service: "tunnel"},
+				},
+				client:  tt.client,
+				limiter: lim,
+			}
+			a.wait(true, 100)
+
+			if len(lim.scopes) != len(tt.want) {
+				t.Errorf("got scopes %v, want %v", lim.scopes, tt.want)
+			}
+			for _, scope := range tt.want {
+				if service, ok := lim.scopes[scope]; !ok || service != "tunnel" {
+					t.Errorf("scope %s: got service %q, found %v", scope, service, ok)
+				}
+			}
+		})
+	}
+}
+
+// sizedAssociation accepts the datagrams up to max bytes.
+type sizedAssociation struct {
+	max    int
+	wch    chan []byte
+	closed chan struct{}
+}
+
+func (a *sizedAssociation) Read(b []byte) (int, error) {
+	<-a.closed
+	return 0, net.ErrClosed
+}
+
+func (a *sizedAssociation) Write(b []byte) (int, error) {
+	if len(b) > a.max {
+		return 0, &quic.DatagramTooLargeError{MaxDatagramPayloadSize: int64(a.max)}
+	}
+	a.wch <- append([]byte(nil), b...)
+	return len(b), nil
+}
+
+func TestTransportDatagramFallback(t *testing.T) {
+	conn, visitor := net.Pipe()
+	cc, connector := net.Pipe()
+	assoc := &sizedAssociation{
+		max:    16,
+		wch:    make(chan []byte, 1),
+		closed: make(chan struct{}),
+	}
+	defer close(assoc.closed)
+	defer visitor.Close()
+	defer connector.Close()
+
+	go transportDatagram(conn, cc, assoc)
+
+	small := []byte("small")
+	large := bytes.Repeat([]byte("large"), 10)
+
+	visitor.SetDeadline(time.Now().Add(3 * time.Second))
+	connector.SetDeadline(time.Now().Add(3 * time.Second))
+
+	if err := writeDatagramFrame(visitor, small); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case b := <-assoc.wch:
+		if !bytes.Equal(b, small) {
+			t.Errorf("datagram: got %q, want %q", b, small)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("datagram: timeout")
+	}
+
+	// the datagram too large for the association falls back to the stream.
+	if err := writeDatagramFrame(visitor, large); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	n, err := readDatagramFrame(connector, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:n], large) {
+		t.Errorf("stream: got %q, want %q", buf[:n], large)
+	}
+}
@@ -7,6 +7,11 @@ import (
 
 	"github.com/go-gost/core/logger"
 	"github.com/go-gost/core/sd"
+	"github.com/go-gost/relay"
+)
+
+const (
+	waitInterval = 100 * time.Millisecond
 )
 
 type Dialer struct {
@@ -15,32 +20,26 @@ type Dialer struct {
 	sd      sd.SD
 	retry   int
 	timeout time.Duration
-	log     logger.Logger
+	// wait is the maximum time to wait for a connector to be available.
+	wait time.Duration
+	// the connectors skipped in the selection, such as the failed ones.
+	excluded []relay.ConnectorID
+	// the connector selected by the last dial.
+	selected relay.ConnectorID
+	log      logger.Logger
+	// the client is dialed to the connector it is pinned to by the affinity, if any.
+	affinity *clientAffinity
+	client   string
 }
 
 func (d *Dialer) Dial(ctx context.Context, network string, tid string) (conn net.Conn, node string, cid string, err error) {
-	retry := d.retry
-	if retry <= 0 {
-		retry = 1
-	}
-
-	for i := 0; i < retry; i++ {
-		c := d.pool.Get(network, tid)
-		if c == nil {
-			break
-		}
-
-		conn, err = c.GetConn()
-		if err != nil {
-			d.log.Error(err)
-			continue
-		}
+	conn, c, err := d.dialConnector(ctx, network, tid)
+	if conn != nil {
 		node = d.node
 		cid = c.id.String()
-
-		break
+		return
 	}
-	if conn != nil || err != nil {
+	if err != nil {
 		return
 	}
 
@@ -76,3 +75,101 @@ func (d *Dialer) Dial(ctx context.Context, network string, tid string) (conn net
 	conn, err = dialer.DialContext(ctx, network, service.Address)
 	return
 }
+
+// dialConnector opens a connection to a connector of the tunnel on this node,
+// the connectors failed to open the connection and the ones in excluded are skipped.
+func (d *Dialer) dialConnector(ctx context.Context, network string, tid string) (conn net.Conn, c *Connector, err error) {
+	retry := d.retry
+	if retry <= 0 {
+		retry = 1
+	}
+
+	for i := 0; i < retry; i++ {
+		c = d.pinnedConnector(network, tid)
+		if c == nil {
+			c = d.pool.Get(ctx, network, tid, d.excluded...)
+		}
+		if c == nil && i == 0 && d.wait > 0 {
+			c = d.waitConnector(ctx, network, tid)
+		}
+		if c == nil {
+			break
+		}
+
+		conn, err = c.GetConn(ctx)
+		if err != nil {
+			d.log.Errorf("tunnel %s: connector %s: %v", tid, c.id, err)
+			d.excluded = append(d.excluded, c.id)
+			continue
+		}
+		d.log.Debugf("tunnel %s: connector %s selected, session: %s", tid, c.id, c.SessionInfo())
+		d.selected = c.id
+		d.affinity.set(tid, d.client, c.id)
+		return conn, c, nil
+	}
+	return nil, nil, err
+}
+
+// pinnedConnector returns the connector the client is pinned to by the affinity,
+// nil if the client is not pinned or the connector is unavailable or excluded.
+func (d *Dialer) pinnedConnector(network string, tid string) *Connector {
+	cid, ok := d.affinity.get(tid, d.client)
+	if !ok || isExcluded(cid, d.excluded) {
+		return nil
+	}
+	t := d.pool.Tunnel(tid)
+	if t == nil {
+		return nil
+	}
+	c := t.connector(network, cid)
+	if c != nil {
+		d.log.Debugf("tunnel %s: client %s is pinned to connector %s", tid, d.client, cid)
+	}
+	return c
+}
+
+// Failover opens a connection to another connector of the tunnel on this node,
+// after the stream of the connector selected by the last dial failed.
+func (d *Dialer) Failover(ctx context.Context, network string, tid string) (net.Conn, string, error) {
+	failed := d.selected
+	d.excluded = append(d.excluded, failed)
+
+	conn, c, err := d.dialConnector(ctx, network, tid)
+	if conn == nil {
+		if err == nil {
+			err = ErrTunnelNotAvailable
+		}
+		return nil, "", err
+	}
+
+	failovers := d.pool.Failover(tid, failed)
+	d.log.Infof("tunnel %s: connector %s failed, failover to connector %s (failovers=%d)", tid, failed, c.id, failovers)
+	return conn, c.id.String(), nil
+}
+
+// waitConnector polls the pool for an available connector of the tunnel until the wait timeout.
+func (d *Dialer) waitConnector(ctx context.Context, network string, tid string) *Connector {
+	ctx, cancel := context.WithTimeout(ctx, d.wait)
+	defer cancel()
+
+	ticker := time.NewTicker(waitInterval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			if c := d.pool.Get(ctx, network, tid, d.excluded...); c != nil {
+				saved := d.pool.waitSaved.Add(1)
+				d.log.Debugf("tunnel %s: connector %s is available after %s (saved=%d, timeout=%d)",
+					tid, c.id, time.Since(start), saved, d.pool.waitTimeout.Load())
+				return c
+			}
+		case <-ctx.Done():
+			timeout := d.pool.waitTimeout.Add(1)
+			d.log.Debugf("tunnel %s: no connector is available after %s (saved=%d, timeout=%d)",
+				tid, time.Since(start), d.pool.waitSaved.Load(), timeout)
+			return nil
+		}
+	}
+}
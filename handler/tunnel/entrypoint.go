@@ -1,8 +1,8 @@
 package tunnel
 
 import (
-	"bufio"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
@@ -17,22 +17,45 @@ import (
 	"github.com/go-gost/core/listener"
 	"github.com/go-gost/core/logger"
 	md "github.com/go-gost/core/metadata"
+	core_metrics "github.com/go-gost/core/metrics"
+	"github.com/go-gost/core/recorder"
 	"github.com/go-gost/core/sd"
 	"github.com/go-gost/relay"
 	admission "github.com/go-gost/x/admission/wrapper"
+	xingress "github.com/go-gost/x/ingress"
 	xio "github.com/go-gost/x/internal/io"
 	xnet "github.com/go-gost/x/internal/net"
 	"github.com/go-gost/x/internal/net/proxyproto"
+	"github.com/go-gost/x/internal/util/billing"
+	"github.com/go-gost/x/internal/util/drain"
+	http_util "github.com/go-gost/x/internal/util/http"
 	climiter "github.com/go-gost/x/limiter/conn/wrapper"
+	xlogger "github.com/go-gost/x/logger"
+	xmetrics "github.com/go-gost/x/metrics"
 	metrics "github.com/go-gost/x/metrics/wrapper"
+	stats_wrapper "github.com/go-gost/x/observer/stats/wrapper"
 )
 
 type entrypoint struct {
-	node    string
-	pool    *ConnectorPool
-	ingress ingress.Ingress
-	sd      sd.SD
-	log     logger.Logger
+	node        string
+	pool        *ConnectorPool
+	ingress     ingress.Ingress
+	sd          sd.SD
+	waitTimeout time.Duration
+	denyStatus  int
+	// the limits of the requests of the visitors.
+	requestLimits *http_util.RequestLimits
+	maskIP        bool
+	log           logger.Logger
+	// the time to wait for the 100 Continue of the server, 0 answers it by the entrypoint at once.
+	continueTimeout time.Duration
+	// pins the clients to the connectors by the client IP, nil if disabled.
+	affinity *clientAffinity
+	// records the visitor connections dialed to the tunnels, nil if disabled.
+	recorder recorder.Recorder
+	service  string
+	// the visitors of the entrypoint are anonymous, their traffic is billed to the tunnel.
+	billing *billing.Biller
 }
 
 func (ep *entrypoint) handle(ctx context.Context, conn net.Conn) error {
@@ -43,6 +66,9 @@ func (ep *entrypoint) handle(ctx context.Context, conn net.Conn) error {
 		"remote": conn.RemoteAddr().String(),
 		"local":  conn.LocalAddr().String(),
 	})
+	if ep.maskIP {
+		log = xlogger.MaskIP(log, conn.RemoteAddr())
+	}
 
 	log.Infof("%s <> %s", conn.RemoteAddr(), conn.LocalAddr())
 	defer func() {
@@ -51,9 +77,10 @@ func (ep *entrypoint) handle(ctx context.Context, conn net.Conn) error {
 		}).Infof("%s >< %s", conn.RemoteAddr(), conn.LocalAddr())
 	}()
 
-	br := bufio.NewReader(conn)
+	rr := http_util.NewRequestReader(conn, ep.requestLimits)
+	br := rr.Reader()
 
-	v, err := br.Peek(1)
+	v, err := rr.Peek(1)
 	if err != nil {
 		return err
 	}
@@ -61,179 +88,267 @@ func (ep *entrypoint) handle(ctx context.Context, conn net.Conn) error {
 		return ep.handleConnect(ctx, xnet.NewBufferReaderConn(conn, br), log)
 	}
 
-	var cc net.Conn
+	// the tunnel stream bound to the connection for the keep-alive session.
+	var stream *httpStream
+	defer func() {
+		if stream != nil {
+			stream.close()
+		}
+	}()
+
 	for {
+		req, err := rr.ReadRequest()
+		if err != nil {
+			// log.Errorf("read http request: %v", err)
+			if code := http_util.StatusCode(err); code > 0 {
+				log.Warn(err)
+				if stream != nil {
+					stream.wait()
+				}
+				resp := &http.Response{
+					ProtoMajor: 1,
+					ProtoMinor: 1,
+					Header:     http.Header{},
+					StatusCode: code,
+					Close:      true,
+				}
+				resp.Write(conn)
+			}
+			return nil
+		}
+
+		if log.IsLevelEnabled(logger.TraceLevel) {
+			dump, _ := httputil.DumpRequest(req, false)
+			log.Trace(string(dump))
+		}
+
 		resp := &http.Response{
-			ProtoMajor: 1,
-			ProtoMinor: 1,
+			ProtoMajor: req.ProtoMajor,
+			ProtoMinor: req.ProtoMinor,
 			Header:     http.Header{},
 			StatusCode: http.StatusServiceUnavailable,
 		}
-
-		err := func() error {
-			req, err := http.ReadRequest(br)
-			if err != nil {
-				// log.Errorf("read http request: %v", err)
-				return err
-			}
-
-			if log.IsLevelEnabled(logger.TraceLevel) {
-				dump, _ := httputil.DumpRequest(req, false)
-				log.Trace(string(dump))
+		// reply writes the response generated by the entrypoint,
+		// after the responses of the previous requests.
+		reply := func(resp *http.Response) error {
+			if stream != nil {
+				stream.wait()
 			}
+			return resp.Write(conn)
+		}
 
-			resp.ProtoMajor = req.ProtoMajor
-			resp.ProtoMinor = req.ProtoMinor
-
-			var tunnelID relay.TunnelID
-			if ep.ingress != nil {
-				if rule := ep.ingress.GetRule(ctx, req.Host); rule != nil {
-					tunnelID = parseTunnelID(rule.Endpoint)
+		var tunnelID relay.TunnelID
+		var forwarded *xingress.Forwarded
+		if ep.ingress != nil {
+			if rule := ep.ingress.GetRule(ctx, req.Host); rule != nil {
+				// the source address is the one from proxy protocol if enabled,
+				// the forwarded headers can not be trusted.
+				if !checkAccess(ctx, ep.ingress, rule, conn.RemoteAddr(), log) {
+					resp.StatusCode = ep.denyStatus
+					if err := reply(resp); err != nil {
+						return nil
+					}
+					continue
+				}
+				tunnelID = parseTunnelID(rule.Endpoint)
+				if fc, ok := ep.ingress.(xingress.ForwardedController); ok {
+					forwarded = fc.Forwarded(ctx, rule)
 				}
 			}
-			if tunnelID.IsZero() {
-				err := fmt.Errorf("no route to host %s", req.Host)
-				log.Error(err)
-				resp.StatusCode = http.StatusBadGateway
-				return resp.Write(conn)
+		}
+		if tunnelID.IsZero() {
+			err := fmt.Errorf("no route to host %s", req.Host)
+			log.Error(err)
+			resp.StatusCode = http.StatusBadGateway
+			if err := reply(resp); err != nil {
+				return nil
 			}
-			if tunnelID.IsPrivate() {
-				err := fmt.Errorf("access denied: tunnel %s is private for host %s", tunnelID, req.Host)
-				log.Error(err)
-				resp.StatusCode = http.StatusBadGateway
-				return resp.Write(conn)
+			continue
+		}
+		if tunnelID.IsPrivate() {
+			err := fmt.Errorf("access denied: tunnel %s is private for host %s", tunnelID, req.Host)
+			log.Error(err)
+			resp.StatusCode = http.StatusBadGateway
+			if err := reply(resp); err != nil {
+				return nil
 			}
+			continue
+		}
 
-			log = log.WithFields(map[string]any{
-				"host":   req.Host,
-				"tunnel": tunnelID.String(),
-			})
-
-			remoteAddr := conn.RemoteAddr()
-			if addr := ep.getRealClientAddr(req, remoteAddr); addr != remoteAddr {
-				log = log.WithFields(map[string]any{
-					"src": addr.String(),
-				})
-				remoteAddr = addr
-			}
+		rlog := log.WithFields(map[string]any{
+			"host":   req.Host,
+			"tunnel": tunnelID.String(),
+		})
 
-			d := &Dialer{
-				node:    ep.node,
-				pool:    ep.pool,
-				sd:      ep.sd,
-				retry:   3,
-				timeout: 15 * time.Second,
-				log:     log,
-			}
-			c, node, cid, err := d.Dial(ctx, "tcp", tunnelID.String())
-			if err != nil {
-				log.Error(err)
-				return resp.Write(conn)
-			}
-			log.Debugf("new connection to tunnel: %s, connector: %s", tunnelID, cid)
+		remoteAddr := conn.RemoteAddr()
+		// the forwarded headers supplied by the visitor are not trusted if they are stripped.
+		if addr := ep.getRealClientAddr(req, remoteAddr); addr != remoteAddr && !forwarded.Strip() {
+			rlog = rlog.WithFields(map[string]any{
+				"src": addr.String(),
+			})
+			remoteAddr = addr
+		}
+		forwarded.Apply(req, conn.RemoteAddr(), isTLS(conn))
 
-			cc = c
+		upgrade := req.Header.Get("Upgrade") == "websocket"
 
-			host := req.Host
-			if h, _, _ := net.SplitHostPort(host); h == "" {
-				host = net.JoinHostPort(strings.Trim(host, "[]"), "80")
-			}
+		// the bound stream is only reused for the same ingress host and client,
+		// the upgraded connection always takes a dedicated stream.
+		if stream != nil && (upgrade || !stream.reusable(tunnelID, req.Host, remoteAddr.String())) {
+			stream.close()
+			stream = nil
+		}
 
-			if node == ep.node {
-				var features []relay.Feature
-				af := &relay.AddrFeature{}
-				af.ParseFrom(remoteAddr.String())
-				features = append(features, af) // src address
-
-				af = &relay.AddrFeature{}
-				af.ParseFrom(host)
-				features = append(features, af) // dst address
-
-				(&relay.Response{
-					Version:  relay.Version1,
-					Status:   relay.StatusOK,
-					Features: features,
-				}).WriteTo(c)
-			}
+		host := req.Host
+		if h, _, _ := net.SplitHostPort(host); h == "" {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), "80")
+		}
 
-			// HTTP/1.0
-			if req.ProtoMajor == 1 && req.ProtoMinor == 0 {
-				if strings.ToLower(req.Header.Get("Connection")) == "keep-alive" {
-					req.Header.Del("Connection")
-				} else {
-					req.Header.Set("Connection", "close")
+		if stream == nil {
+			c, cid, err := ep.dialStream(ctx, tunnelID, remoteAddr, host, rlog)
+			if err != nil {
+				rlog.Error(err)
+				if err := reply(resp); err != nil {
+					return nil
 				}
+				continue
 			}
 
-			if err := req.Write(c); err != nil {
-				c.Close()
-				log.Errorf("send request: %v", err)
-				return resp.Write(conn)
+			r := &connRecord{
+				Tunnel:    tunnelID.String(),
+				Connector: cid,
+				Network:   "tcp",
+				Host:      req.Host,
+				Client:    conn.RemoteAddr().String(),
+				Peer:      proxyproto.PeerAddr(conn),
 			}
-
-			if req.Header.Get("Upgrade") == "websocket" {
-				err := xnet.Transport(c, xio.NewReadWriter(br, conn))
-				if err == nil {
-					err = io.EOF
-				}
-				return err
+			if remoteAddr != conn.RemoteAddr() {
+				r.Src = remoteAddr.String()
 			}
+			ep.record(ctx, r)
 
-			go func() {
-				defer c.Close()
+			c = ep.billing.Start(tunnelID.String()).WrapUpstream(c)
 
-				t := time.Now()
-				log.Debugf("%s <-> %s", remoteAddr, host)
-
-				defer func() {
-					log.WithFields(map[string]any{
-						"duration": time.Since(t),
-					}).Debugf("%s >-< %s", remoteAddr, host)
-				}()
+			if upgrade {
+				defer c.Close()
 
-				res, err := http.ReadResponse(bufio.NewReader(c), req)
-				if err != nil {
-					log.Errorf("read response: %v", err)
+				if err := req.Write(c); err != nil {
+					rlog.Errorf("send request: %v", err)
 					resp.Write(conn)
-					return
-				}
-
-				if log.IsLevelEnabled(logger.TraceLevel) {
-					dump, _ := httputil.DumpResponse(res, false)
-					log.Trace(string(dump))
+					return nil
 				}
+				xnet.Transport(c, xio.NewReadWriter(br, conn))
+				return nil
+			}
 
-				if res.Close {
-					defer conn.Close()
-				}
+			stream = newHTTPStream(c, conn, tunnelID, req.Host, remoteAddr.String(), ep.continueTimeout, rlog)
+		}
 
-				// HTTP/1.0
-				if req.ProtoMajor == 1 && req.ProtoMinor == 0 {
-					if !res.Close {
-						res.Header.Set("Connection", "keep-alive")
-					}
-					res.ProtoMajor = req.ProtoMajor
-					res.ProtoMinor = req.ProtoMinor
-				}
+		// HTTP/1.0
+		if req.ProtoMajor == 1 && req.ProtoMinor == 0 {
+			if strings.ToLower(req.Header.Get("Connection")) == "keep-alive" {
+				req.Header.Del("Connection")
+			} else {
+				req.Header.Set("Connection", "close")
+			}
+		}
 
-				if err = res.Write(conn); err != nil {
-					conn.Close()
-					log.Errorf("write response: %v", err)
+		// the body is not sent by the visitor until it receives 100 Continue.
+		var body *continueBody
+		if req.ProtoAtLeast(1, 1) && strings.EqualFold(req.Header.Get("Expect"), "100-continue") {
+			if ep.continueTimeout <= 0 {
+				// answered here instead of by the server.
+				req.Header.Del("Expect")
+				if err := reply(&http.Response{
+					ProtoMajor: req.ProtoMajor,
+					ProtoMinor: req.ProtoMinor,
+					Header:     http.Header{},
+					StatusCode: http.StatusContinue,
+				}); err != nil {
+					return nil
 				}
-			}()
+			} else if req.ContentLength != 0 {
+				// the expectation is forwarded to the server, and the body is held until it is answered,
+				// the responses of the previous requests go first, so the 100 Continue is not mixed into them.
+				stream.wait()
+				body = newContinueBody(req.Body)
+				req.Body = body
+			}
+		}
 
+		err = stream.send(req)
+		if body.rejected() {
+			// the server answers with the final response before the body is sent,
+			// the body is discarded, and the stream is dropped as the server is left in the middle of the request.
+			rlog.Debugf("expectation of %s %s is rejected, the body is not sent", req.Method, req.URL)
+			stream.close()
+			stream = nil
+			if req.Close || req.ContentLength <= 0 {
+				return nil
+			}
+			// the visitor may send the body anyway, it is read and discarded,
+			// so it is not parsed as the next request.
+			if _, err := io.Copy(io.Discard, body.ReadCloser); err != nil {
+				rlog.Debugf("discard body: %v", err)
+				return nil
+			}
+			continue
+		}
+		if err != nil {
+			rlog.Errorf("send request: %v", err)
+			stream.abort()
+			stream = nil
+			resp.Write(conn)
 			return nil
-		}()
+		}
 
-		if err != nil {
-			if cc != nil {
-				cc.Close()
-			}
-			break
+		if req.Close {
+			// no more requests from the visitor, wait for the response before closing.
+			stream.close()
+			stream = nil
+			return nil
 		}
 	}
+}
 
-	return nil
+// dialStream dials a new stream to the tunnel for the HTTP requests from src to the host,
+// the connector of the stream is returned.
+func (ep *entrypoint) dialStream(ctx context.Context, tunnelID relay.TunnelID, src net.Addr, host string, log logger.Logger) (net.Conn, string, error) {
+	d := &Dialer{
+		node:     ep.node,
+		pool:     ep.pool,
+		sd:       ep.sd,
+		retry:    3,
+		timeout:  15 * time.Second,
+		wait:     ep.waitTimeout,
+		log:      log,
+		affinity: ep.affinity,
+		client:   affinityClient(src.String()),
+	}
+	c, node, cid, err := d.Dial(ctx, "tcp", tunnelID.String())
+	if err != nil {
+		return nil, "", err
+	}
+	log.Debugf("new connection to tunnel: %s, connector: %s", tunnelID, cid)
+
+	if node == ep.node {
+		var features []relay.Feature
+		af := &relay.AddrFeature{}
+		af.ParseFrom(src.String())
+		features = append(features, af) // src address
+
+		af = &relay.AddrFeature{}
+		af.ParseFrom(host)
+		features = append(features, af) // dst address
+
+		(&relay.Response{
+			Version:  relay.Version1,
+			Status:   relay.StatusOK,
+			Features: features,
+		}).WriteTo(c)
+	}
+
+	return c, cid, nil
 }
 
 func (ep *entrypoint) handleConnect(ctx context.Context, conn net.Conn, log logger.Logger) error {
@@ -278,11 +393,18 @@ func (ep *entrypoint) handleConnect(ctx context.Context, conn net.Conn, log logg
 		return ErrTunnelID
 	}
 
+	client := srcAddr
+	if client == "" {
+		client = conn.RemoteAddr().String()
+	}
 	d := Dialer{
-		pool:    ep.pool,
-		retry:   3,
-		timeout: 15 * time.Second,
-		log:     log,
+		pool:     ep.pool,
+		retry:    3,
+		timeout:  15 * time.Second,
+		wait:     ep.waitTimeout,
+		log:      log,
+		affinity: ep.affinity,
+		client:   affinityClient(client),
 	}
 	cc, _, cid, err := d.Dial(ctx, network, tunnelID.String())
 	if err != nil {
@@ -295,6 +417,19 @@ func (ep *entrypoint) handleConnect(ctx context.Context, conn net.Conn, log logg
 
 	log.Debugf("new connection to tunnel: %s, connector: %s", tunnelID, cid)
 
+	r := &connRecord{
+		Tunnel:    tunnelID.String(),
+		Connector: cid,
+		Network:   network,
+		Host:      dstAddr,
+		Client:    conn.RemoteAddr().String(),
+		Peer:      proxyproto.PeerAddr(conn),
+	}
+	if srcAddr != r.Client {
+		r.Src = srcAddr
+	}
+	ep.record(ctx, r)
+
 	if _, err := resp.WriteTo(conn); err != nil {
 		log.Error(err)
 		return err
@@ -310,6 +445,10 @@ func (ep *entrypoint) handleConnect(ctx context.Context, conn net.Conn, log logg
 
 	resp.WriteTo(cc)
 
+	acct := ep.billing.Start(tunnelID.String())
+	defer acct.End()
+	conn = stats_wrapper.WrapConn(conn, acct.Stats())
+
 	t := time.Now()
 	log.Debugf("%s <-> %s", conn.RemoteAddr(), cc.RemoteAddr())
 	xnet.Transport(conn, cc)
@@ -320,6 +459,41 @@ func (ep *entrypoint) handleConnect(ctx context.Context, conn net.Conn, log logg
 	return nil
 }
 
+// checkAccess evaluates the access control list of the ingress rule against the visitor's source address.
+func checkAccess(ctx context.Context, ing ingress.Ingress, rule *ingress.Rule, addr net.Addr, log logger.Logger) bool {
+	ac, ok := ing.(xingress.AccessController)
+	if !ok {
+		return true
+	}
+	allowed, matched := ac.Allowed(ctx, rule, addr)
+	if !matched {
+		return true
+	}
+
+	action := "allow"
+	if !allowed {
+		action = "deny"
+	}
+	if counter := xmetrics.GetCounter(
+		xmetrics.MetricIngressRuleAccessCounter,
+		core_metrics.Labels{
+			"rule":   rule.Hostname,
+			"action": action,
+		}); counter != nil {
+		counter.Inc()
+	}
+
+	log = log.WithFields(map[string]any{
+		"rule": rule.Hostname,
+	})
+	if !allowed {
+		log.Warnf("access denied: %s is not allowed by rule %s", addr, rule.Hostname)
+		return false
+	}
+	log.Debugf("access allowed: %s by rule %s", addr, rule.Hostname)
+	return true
+}
+
 func (ep *entrypoint) getRealClientAddr(req *http.Request, raddr net.Addr) net.Addr {
 	if req == nil {
 		return nil
@@ -371,6 +545,8 @@ func (l *tcpListener) Init(md md.Metadata) (err error) {
 	// l.logger.Debugf("pp: %d", l.options.ProxyProtocol)
 	ln := l.ln
 	ln = proxyproto.WrapListener(l.options.ProxyProtocol, ln, 10*time.Second)
+	// the address of the load balancer is kept for the records of the visitors.
+	ln = proxyproto.WrapPeerListener(ln)
 	ln = metrics.WrapListener(l.options.Service, ln)
 	ln = admission.WrapListener(l.options.Admission, ln)
 	ln = climiter.WrapListener(l.options.ConnLimiter, ln)
@@ -391,8 +567,18 @@ func (l *tcpListener) Close() error {
 	return l.ln.Close()
 }
 
+// isTLS reports whether the visitor connected over TLS, to the entrypoint
+// or to the load balancer sending the PROXY protocol header with the SSL TLV.
+func isTLS(conn net.Conn) bool {
+	if _, ok := conn.(interface{ ConnectionState() tls.ConnectionState }); ok {
+		return true
+	}
+	return proxyproto.ClientSSL(conn)
+}
+
 type entrypointHandler struct {
-	ep *entrypoint
+	ep      *entrypoint
+	tracker drain.Tracker
 }
 
 func (h *entrypointHandler) Init(md md.Metadata) (err error) {
@@ -400,5 +586,16 @@ func (h *entrypointHandler) Init(md md.Metadata) (err error) {
 }
 
 func (h *entrypointHandler) Handle(ctx context.Context, conn net.Conn, opts ...handler.HandleOption) error {
+	if !h.tracker.Add(conn) {
+		conn.Close()
+		return drain.ErrDraining
+	}
+	defer h.tracker.Remove(conn)
+
 	return h.ep.handle(ctx, conn)
 }
+
+// Drain implements the service.Drainer interface.
+func (h *entrypointHandler) Drain(ctx context.Context) (forced int, err error) {
+	return h.tracker.Drain(ctx)
+}
@@ -0,0 +1,208 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-gost/core/ingress"
+	"github.com/go-gost/core/logger"
+	"github.com/go-gost/relay"
+	xingress "github.com/go-gost/x/ingress"
+	"github.com/go-gost/x/internal/util/mux"
+	xlogger "github.com/go-gost/x/logger"
+	"github.com/google/uuid"
+)
+
+func init() {
+	// the connectors log the closed sessions to the default logger.
+	logger.SetDefault(xlogger.Nop())
+}
+
+// newTestEntrypoint creates the entrypoint routing the host to a tunnel with one connector,
+// the streams opened to the connector, one per GetConn call, are counted by streams.
+func newTestEntrypoint(t *testing.T, host string) (ep *entrypoint, streams *atomic.Int64) {
+	t.Helper()
+
+	tid := uuid.New()
+	cid := uuid.New()
+	tunnelID := relay.NewTunnelID(tid[:])
+
+	sc, cc := net.Pipe()
+	server, err := mux.ServerSession(sc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := mux.ClientSession(cc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	streams = &atomic.Int64{}
+	go func() {
+		for {
+			conn, err := client.Accept()
+			if err != nil {
+				return
+			}
+			streams.Add(1)
+			go serveStream(conn)
+		}
+	}()
+
+	pool := NewConnectorPool("node", nil)
+	t.Cleanup(func() { pool.Close() })
+	pool.Add(tunnelID, NewConnector(relay.NewConnectorID(cid[:]), tunnelID, "node", server, nil), 0)
+
+	ep = &entrypoint{
+		node: "node",
+		pool: pool,
+		ingress: xingress.NewIngress(
+			xingress.RulesOption([]*ingress.Rule{
+				{Hostname: host, Endpoint: tid.String()},
+			}),
+			xingress.LoggerOption(xlogger.Nop()),
+		),
+		log: xlogger.Nop(),
+	}
+	return
+}
+
+// serveStream serves the HTTP requests forwarded over the tunnel stream,
+// each response carries the path of the request.
+func serveStream(conn net.Conn) {
+	defer conn.Close()
+
+	if _, err := (&relay.Response{}).ReadFrom(conn); err != nil {
+		return
+	}
+	br := bufio.NewReader(conn)
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, req.Body)
+		body := req.URL.Path
+		resp := &http.Response{
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Close:         req.Close,
+		}
+		if err := resp.Write(conn); err != nil || req.Close {
+			return
+		}
+	}
+}
+
+// loadPage fetches the assets of a page from the entrypoint, pipelined over one visitor connection
+// if keepAlive is set, or one connection per asset otherwise.
+func loadPage(t *testing.T, ep *entrypoint, host string, assets []string, keepAlive bool) {
+	t.Helper()
+
+	visit := func(paths []string) {
+		client, server := net.Pipe()
+		defer client.Close()
+		go ep.handle(context.Background(), server)
+
+		client.SetDeadline(time.Now().Add(5 * time.Second))
+		go func() {
+			for i, path := range paths {
+				conn := ""
+				if i == len(paths)-1 {
+					conn = "Connection: close\r\n"
+				}
+				fmt.Fprintf(client, "GET %s HTTP/1.1\r\nHost: %s\r\n%s\r\n", path, host, conn)
+			}
+		}()
+
+		br := bufio.NewReader(client)
+		for _, path := range paths {
+			resp, err := http.ReadResponse(br, nil)
+			if err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || string(b) != path {
+				t.Fatalf("%s: got %d %q", path, resp.StatusCode, b)
+			}
+		}
+	}
+
+	if keepAlive {
+		visit(assets)
+		return
+	}
+	for _, path := range assets {
+		visit([]string{path})
+	}
+}
+
+func TestEntrypointKeepAlive(t *testing.T) {
+	const host = "example.com"
+
+	var assets []string
+	for i := 0; i < 20; i++ {
+		assets = append(assets, fmt.Sprintf("/asset/%d", i))
+	}
+
+	var calls [2]int64
+	for i, keepAlive := range []bool{false, true} {
+		ep, streams := newTestEntrypoint(t, host)
+		loadPage(t, ep, host, assets, keepAlive)
+		calls[i] = streams.Load()
+	}
+
+	t.Logf("GetConn calls per page load of %d assets: %d per request, %d with keep-alive",
+		len(assets), calls[0], calls[1])
+	if calls[0] != int64(len(assets)) {
+		t.Errorf("GetConn calls per request: got %d, want %d", calls[0], len(assets))
+	}
+	if calls[1] != 1 {
+		t.Errorf("GetConn calls with keep-alive: got %d, want 1", calls[1])
+	}
+}
+
+func TestEntrypointHostChange(t *testing.T) {
+	ep, streams := newTestEntrypoint(t, "*.example.com")
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go ep.handle(context.Background(), server)
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	br := bufio.NewReader(client)
+	// the stream is reused for the same host only.
+	for _, host := range []string{"a.example.com", "a.example.com", "b.example.com", "b.example.com", "a.example.com"} {
+		fmt.Fprintf(client, "GET /%s HTTP/1.1\r\nHost: %s\r\n\r\n", host, host)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: got status %d", host, resp.StatusCode)
+		}
+	}
+
+	if n := streams.Load(); n != 3 {
+		t.Errorf("GetConn calls: got %d, want 3", n)
+	}
+}
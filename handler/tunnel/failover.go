@@ -0,0 +1,127 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/go-gost/core/logger"
+	"github.com/go-gost/relay"
+)
+
+const (
+	defaultFailoverWindow = 3 * time.Second
+	probeBufferSize       = 16 * 1024
+)
+
+type probeResult struct {
+	b   []byte
+	err error
+}
+
+// connectStream writes the header to the stream cc of the connector, and probes the stream for the immediate failure,
+// such as the connector died between the selection and the use.
+// The failed stream is retried on another connector of the tunnel at most failoverRetries times,
+// but never after any payload is sent to the stream, so the idempotency is left to the visitor.
+// It returns the stream in use, the data of the visitor read in the probes to be sent to the stream,
+// and the data read from the stream to be sent to the visitor.
+func (h *tunnelHandler) connectStream(ctx context.Context, d *Dialer, cc net.Conn, cid string, header *relay.Response,
+	conn net.Conn, network string, tid string, log logger.Logger) (_ net.Conn, _ string, fromConn []byte, fromCC []byte, err error) {
+	for i := 0; ; i++ {
+		if _, err = header.WriteTo(cc); err == nil {
+			var b []byte
+			var connErr error
+			b, fromCC, err, connErr = probe(conn, cc, h.md.failoverWindow)
+			fromConn = append(fromConn, b...)
+			if connErr != nil {
+				cc.Close()
+				return nil, "", nil, nil, connErr
+			}
+			if err == nil {
+				return cc, cid, fromConn, fromCC, nil
+			}
+		}
+
+		cc.Close()
+		if i >= h.md.failoverRetries {
+			return nil, "", nil, nil, err
+		}
+		log.Debugf("tunnel %s: connector %s: %v", tid, cid, err)
+
+		if cc, cid, err = d.Failover(ctx, network, tid); err != nil {
+			return nil, "", nil, nil, err
+		}
+	}
+}
+
+// probe waits for the first data of the stream cc or the visitor conn within the window,
+// the probe ends once either of them is read, so the payload is not delayed.
+// The error of the stream is reported only if nothing is read from it,
+// and the error of the visitor only if nothing is read from the visitor.
+// The probe is skipped if the deadlines are not supported by the connections.
+func probe(conn, cc net.Conn, window time.Duration) (fromConn, fromCC []byte, ccErr, connErr error) {
+	now := time.Now()
+	if err := cc.SetReadDeadline(now.Add(window)); err != nil {
+		return
+	}
+	defer cc.SetReadDeadline(time.Time{})
+	if err := conn.SetReadDeadline(now.Add(window)); err != nil {
+		return
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	ccCh := make(chan probeResult, 1)
+	connCh := make(chan probeResult, 1)
+	go probeRead(cc, ccCh)
+	go probeRead(conn, connCh)
+
+	var rc, rv probeResult
+	select {
+	case rc = <-ccCh:
+		conn.SetReadDeadline(time.Now())
+		rv = <-connCh
+	case rv = <-connCh:
+		cc.SetReadDeadline(time.Now())
+		rc = <-ccCh
+	}
+
+	if len(rv.b) == 0 && isReadError(rv.err) {
+		connErr = rv.err
+	}
+	if len(rc.b) == 0 && isReadError(rc.err) {
+		ccErr = rc.err
+	}
+	return rv.b, rc.b, ccErr, connErr
+}
+
+// writeProbed sends the data read in the probe to the peers.
+func writeProbed(conn io.Writer, cc io.Writer, fromConn, fromCC []byte) error {
+	if len(fromConn) > 0 {
+		if _, err := cc.Write(fromConn); err != nil {
+			return err
+		}
+	}
+	if len(fromCC) > 0 {
+		if _, err := conn.Write(fromCC); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func probeRead(conn net.Conn, ch chan<- probeResult) {
+	b := make([]byte, probeBufferSize)
+	n, err := conn.Read(b)
+	ch <- probeResult{b: b[:n], err: err}
+}
+
+// isReadError reports whether the read failed, the timeout of the probe is not a failure.
+func isReadError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var ne net.Error
+	return !errors.As(err, &ne) || !ne.Timeout()
+}
@@ -0,0 +1,158 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-gost/core/metrics"
+	"github.com/go-gost/core/observer"
+	"github.com/go-gost/relay"
+	"github.com/go-gost/x/internal/util/mux"
+	xlogger "github.com/go-gost/x/logger"
+	xmetrics "github.com/go-gost/x/metrics"
+	"github.com/go-gost/x/observer/event"
+	"github.com/google/uuid"
+)
+
+type testCounter struct {
+	v  float64
+	mu sync.Mutex
+}
+
+func (c *testCounter) Inc() { c.Add(1) }
+
+func (c *testCounter) Add(v float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.v += v
+}
+
+// testMetrics records the counters of the failovers by service.
+type testMetrics struct {
+	metrics.Metrics
+	failovers map[string]*testCounter
+	mu        sync.Mutex
+}
+
+func (m *testMetrics) Counter(name metrics.MetricName, labels metrics.Labels) metrics.Counter {
+	if name != xmetrics.MetricServiceTunnelFailoversCounter {
+		return m.Metrics.Counter(name, labels)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.failovers[labels["service"]]
+	if c == nil {
+		c = &testCounter{}
+		m.failovers[labels["service"]] = c
+	}
+	return c
+}
+
+type testObserver chan observer.Event
+
+func (o testObserver) Observe(ctx context.Context, events []observer.Event, opts ...observer.Option) error {
+	for _, ev := range events {
+		o <- ev
+	}
+	return nil
+}
+
+// addTestConnector adds a connector of the tunnel to the pool, the streams opened to it are closed at once.
+func addTestConnector(t *testing.T, pool *ConnectorPool, tunnelID relay.TunnelID) relay.ConnectorID {
+	t.Helper()
+
+	sc, cc := net.Pipe()
+	server, err := mux.ServerSession(sc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := mux.ClientSession(cc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	go func() {
+		for {
+			conn, err := client.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	cid := uuid.New()
+	connectorID := relay.NewConnectorID(cid[:])
+	pool.Add(tunnelID, NewConnector(connectorID, tunnelID, "node", server, nil), 0)
+	return connectorID
+}
+
+func TestDialerFailover(t *testing.T) {
+	m := &testMetrics{Metrics: xmetrics.Noop(), failovers: map[string]*testCounter{}}
+	xmetrics.Init(m)
+	defer xmetrics.Init(nil)
+
+	events := make(testObserver, 16)
+	pool := NewConnectorPool("node", nil)
+	defer pool.Close()
+	pool.WithObserver(events, "test")
+
+	tid := uuid.New()
+	tunnelID := relay.NewTunnelID(tid[:])
+	for i := 0; i < 2; i++ {
+		addTestConnector(t, pool, tunnelID)
+	}
+
+	d := &Dialer{node: "node", pool: pool, log: xlogger.Nop()}
+	ctx := context.Background()
+	conn, _, cid, err := d.Dial(ctx, "tcp", tunnelID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	failed := d.selected
+
+	conn, fcid, err := d.Failover(ctx, "tcp", tunnelID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if fcid == cid {
+		t.Errorf("failover to the failed connector %s", cid)
+	}
+
+	if n := pool.Failovers(); n != 1 {
+		t.Errorf("pool failovers: got %d, want 1", n)
+	}
+	if n := pool.Tunnel(tunnelID.String()).Failovers(); n != 1 {
+		t.Errorf("tunnel failovers: got %d, want 1", n)
+	}
+	if c := m.failovers["test"]; c == nil || c.v != 1 {
+		t.Errorf("failovers metric of the service: got %+v, want 1", c)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			tev, ok := ev.(event.TunnelEvent)
+			if !ok || tev.Action != event.ConnectorFailover {
+				continue
+			}
+			if tev.Service != "test" || tev.Tunnel != tunnelID.String() ||
+				tev.Connector != failed.String() || tev.Failovers != 1 {
+				t.Errorf("failover event: got %+v", tev)
+			}
+			return
+		case <-timeout:
+			t.Fatal("no failover event")
+		}
+	}
+}
@@ -13,13 +13,21 @@ import (
 	"github.com/go-gost/core/listener"
 	"github.com/go-gost/core/logger"
 	md "github.com/go-gost/core/metadata"
+	core_metrics "github.com/go-gost/core/metrics"
 	"github.com/go-gost/core/recorder"
 	"github.com/go-gost/core/service"
 	"github.com/go-gost/relay"
 	ctxvalue "github.com/go-gost/x/ctx"
 	xnet "github.com/go-gost/x/internal/net"
-	limiter_util "github.com/go-gost/x/internal/util/limiter"
+	"github.com/go-gost/x/internal/util/billing"
+	"github.com/go-gost/x/internal/util/drain"
+	"github.com/go-gost/x/internal/util/hotswap"
+	xrelay "github.com/go-gost/x/internal/util/relay"
 	stats_util "github.com/go-gost/x/internal/util/stats"
+	xlogger "github.com/go-gost/x/logger"
+	mdx "github.com/go-gost/x/metadata"
+	xmetrics "github.com/go-gost/x/metrics"
+	"github.com/go-gost/x/observer/event"
 	xrecorder "github.com/go-gost/x/recorder"
 	"github.com/go-gost/x/registry"
 	xservice "github.com/go-gost/x/service"
@@ -33,10 +41,16 @@ var (
 	ErrTunnelNotAvailable = errors.New("tunnel not available")
 	ErrUnauthorized       = errors.New("unauthorized")
 	ErrRateLimit          = errors.New("rate limiting exceeded")
+	ErrTooManyConns       = errors.New("too many connections")
+	ErrTunnelNotFound     = errors.New("tunnel not found")
+	ErrConnectorNotFound  = errors.New("connector not found")
+	ErrBindThrottled      = errors.New("too many binds")
+	ErrAccessDenied       = errors.New("access denied")
 )
 
 func init() {
 	registry.HandlerRegistry().Register("tunnel", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "tunnel", schema...)
 }
 
 type tunnelHandler struct {
@@ -49,8 +63,13 @@ type tunnelHandler struct {
 	md       metadata
 	log      logger.Logger
 	stats    *stats_util.HandlerStats
-	limiter  traffic.TrafficLimiter
 	cancel   context.CancelFunc
+	tracker  drain.Tracker
+	throttle *bindThrottle
+	events   *event.ConnEmitter
+	billing  *billing.Biller
+	// the auther, bypass and limiter swappable by UpdateOptions.
+	live hotswap.Value
 }
 
 func NewHandler(opts ...handler.Option) handler.Handler {
@@ -81,23 +100,47 @@ func (h *tunnelHandler) Init(md md.Metadata) (err error) {
 
 	if opts := h.options.Router.Options(); opts != nil {
 		for _, ro := range opts.Recorders {
-			if ro.Record == xrecorder.RecorderServiceHandlerTunnel {
+			switch {
+			case ro.Record == xrecorder.RecorderServiceHandlerTunnel && h.recorder == nil:
 				h.recorder = ro.Recorder
-				break
+			case ro.Record == xrecorder.RecorderServiceHandlerBilling && h.billing == nil:
+				bopts := h.md.billingOpts
+				bopts.Logger = h.log
+				h.billing = billing.New(h.options.Service, ro.Recorder, bopts)
 			}
 		}
 	}
 
+	h.throttle = newBindThrottle(h.md.bindRate, h.md.bindWindow, h.md.bindRetryAfter)
+
 	h.pool = NewConnectorPool(h.id, h.md.sd)
+	h.pool.WithMaxAge(h.md.tunnelMaxAge, h.md.tunnelDrainTimeout)
+	h.pool.WithSeed(h.md.tunnelSeed, h.md.tunnelSeedByClient)
+	h.pool.WithDecay(h.md.tunnelWeightDecay)
+	h.pool.WithObserver(h.options.Observer, h.options.Service)
+	if h.md.connEvents {
+		h.events = event.NewConnEmitter(h.options.Observer, h.options.Service, h.md.connEventsOpts)
+	}
 
 	h.ep = &entrypoint{
-		node:    h.id,
-		pool:    h.pool,
-		ingress: h.md.ingress,
-		sd:      h.md.sd,
+		node:          h.id,
+		pool:          h.pool,
+		ingress:       h.md.ingress,
+		sd:            h.md.sd,
+		waitTimeout:   h.md.waitTimeout,
+		denyStatus:    h.md.entryPointDenyStatus,
+		requestLimits: h.md.entryPointRequestLimits,
+		maskIP:        h.md.maskIP,
 		log: h.log.WithFields(map[string]any{
 			"kind": "entrypoint",
 		}),
+		continueTimeout: h.md.entryPointContinueTimeout,
+		recorder:        h.recorder,
+		service:         h.options.Service,
+		billing:         h.billing,
+	}
+	if h.md.entryPointAffinity {
+		h.ep.affinity = newClientAffinity(h.md.entryPointAffinityTTL, h.md.entryPointAffinityMaxEntries)
 	}
 	if err = h.initEntrypoint(); err != nil {
 		return
@@ -111,9 +154,7 @@ func (h *tunnelHandler) Init(md md.Metadata) (err error) {
 		go h.observeStats(ctx)
 	}
 
-	if limiter := h.options.Limiter; limiter != nil {
-		h.limiter = limiter_util.NewCachedTrafficLimiter(limiter, 30*time.Second, 60*time.Second)
-	}
+	h.live.Store(&h.options)
 
 	return nil
 }
@@ -128,7 +169,11 @@ func (h *tunnelHandler) initEntrypoint() (err error) {
 		network = "tcp4"
 	}
 
-	ln, err := net.Listen(network, h.md.entryPoint)
+	// the entrypoint is bound in the network namespace of the handler.
+	lc := xnet.ListenConfig{
+		Netns: h.options.Netns,
+	}
+	ln, err := lc.Listen(context.Background(), network, h.md.entryPoint)
 	if err != nil {
 		h.log.Error(err)
 		return
@@ -175,6 +220,9 @@ func (h *tunnelHandler) Handle(ctx context.Context, conn net.Conn, opts ...handl
 		"remote": conn.RemoteAddr().String(),
 		"local":  conn.LocalAddr().String(),
 	})
+	if h.md.maskIP {
+		log = xlogger.MaskIP(log, conn.RemoteAddr())
+	}
 
 	log.Infof("%s <> %s", conn.RemoteAddr(), conn.LocalAddr())
 
@@ -187,7 +235,16 @@ func (h *tunnelHandler) Handle(ctx context.Context, conn net.Conn, opts ...handl
 		}).Infof("%s >< %s", conn.RemoteAddr(), conn.LocalAddr())
 	}()
 
+	if !h.tracker.Add(conn) {
+		return drain.ErrDraining
+	}
+	defer h.tracker.Remove(conn)
+
+	trace := h.events.Trace(conn.RemoteAddr().String())
+	defer func() { trace.Closed(err) }()
+
 	if !h.checkRateLimit(conn.RemoteAddr()) {
+		trace.Denied("rateLimit")
 		return ErrRateLimit
 	}
 
@@ -196,7 +253,17 @@ func (h *tunnelHandler) Handle(ctx context.Context, conn net.Conn, opts ...handl
 	}
 
 	req := relay.Request{}
-	if _, err := req.ReadFrom(conn); err != nil {
+	if err := xrelay.ReadRequest(conn, &req, h.md.requestLimits); err != nil {
+		if xrelay.IsLimitExceeded(err) {
+			log.Warnf("%s: %v", conn.RemoteAddr(), err)
+			xrelay.ObserveRejected(h.options.Service, err)
+			resp := relay.Response{
+				Version: relay.Version1,
+				Status:  relay.StatusBadRequest,
+			}
+			h.setMessage(&resp, "%v", err)
+			h.writeResponse(conn, &resp)
+		}
 		return err
 	}
 
@@ -209,7 +276,7 @@ func (h *tunnelHandler) Handle(ctx context.Context, conn net.Conn, opts ...handl
 
 	if req.Version != relay.Version1 {
 		resp.Status = relay.StatusBadRequest
-		resp.WriteTo(conn)
+		h.writeResponse(conn, &resp)
 		return ErrBadVersion
 	}
 
@@ -245,7 +312,8 @@ func (h *tunnelHandler) Handle(ctx context.Context, conn net.Conn, opts ...handl
 
 	if tunnelID.IsZero() {
 		resp.Status = relay.StatusBadRequest
-		resp.WriteTo(conn)
+		h.setMessage(&resp, "tunnel ID is required")
+		h.writeResponse(conn, &resp)
 		return ErrTunnelID
 	}
 
@@ -253,33 +321,100 @@ func (h *tunnelHandler) Handle(ctx context.Context, conn net.Conn, opts ...handl
 		log = log.WithFields(map[string]any{"user": user})
 	}
 
-	if h.options.Auther != nil {
-		clientID, ok := h.options.Auther.Authenticate(ctx, user, pass)
+	// the auther and bypass of the connection are loaded once,
+	// so a swap by UpdateOptions never mixes the old and new options in one connection.
+	live := h.live.Load()
+
+	if auther := live.Auther; auther != nil {
+		clientID, ok := auther.Authenticate(ctx, user, pass)
 		if !ok {
+			trace.Denied("auth")
 			resp.Status = relay.StatusUnauthorized
-			resp.WriteTo(conn)
+			h.setMessage(&resp, "authentication failed for tunnel %s", tunnelID)
+			h.writeResponse(conn, &resp)
 			return ErrUnauthorized
 		}
 		ctx = ctxvalue.ContextWithClientID(ctx, ctxvalue.ClientID(clientID))
 	}
 
+	clientID := string(ctxvalue.ClientIDFromContext(ctx))
+	trace.Authenticated(clientID)
+	if err := h.md.schedule.Check(clientID); err != nil {
+		trace.Denied("schedule")
+		log.Warn(err)
+		resp.Status = relay.StatusUnauthorized
+		h.setMessage(&resp, "access to tunnel %s is not allowed at this time", tunnelID)
+		h.writeResponse(conn, &resp)
+		return ErrUnauthorized
+	}
+	// the connector is closed along with its session once the window closes,
+	// the watch of it is not stopped as the session outlives the handling.
+	stop := h.md.schedule.Watch(clientID, conn)
+
 	switch req.Cmd & relay.CmdMask {
 	case relay.CmdConnect:
 		defer conn.Close()
+		defer stop()
 
 		log.Debugf("connect: %s >> %s/%s", srcAddr, dstAddr, network)
-		return h.handleConnect(ctx, &req, conn, network, srcAddr, dstAddr, tunnelID, log)
+		trace.Opened(dstAddr)
+		return h.handleConnect(ctx, &req, trace.WrapConn(conn), network, srcAddr, dstAddr, tunnelID, live, log)
 
 	case relay.CmdBind:
+		// the connectors outlive the handling, they are observed by the tunnel events instead.
+		trace = nil
 		log.Debugf("bind: %s >> %s/%s", srcAddr, dstAddr, network)
-		return h.handleBind(ctx, conn, network, dstAddr, tunnelID, log)
+		if !h.throttle.allow() {
+			stop()
+			log.Debugf("bind: %v, retry after %s", ErrBindThrottled, h.throttle.retryAfter)
+			h.observeBindThrottled()
+			resp.Status = xrelay.StatusTemporaryUnavailable
+			resp.Features = append(resp.Features, &xrelay.RetryAfterFeature{
+				Delay: h.throttle.retryAfter,
+			})
+			h.setMessage(&resp, "too many binds, retry after %s", h.throttle.retryAfter)
+			h.writeResponse(conn, &resp)
+			return ErrBindThrottled
+		}
+		datagram := (req.Cmd & xrelay.FDatagram) == xrelay.FDatagram
+		return h.handleBind(ctx, conn, network, dstAddr, tunnelID, datagram, log)
 	default:
+		stop()
 		resp.Status = relay.StatusBadRequest
-		resp.WriteTo(conn)
+		h.setMessage(&resp, "unknown command %d", req.Cmd&relay.CmdMask)
+		h.writeResponse(conn, &resp)
 		return ErrUnknownCmd
 	}
 }
 
+// UpdateOptions implements the service.OptionsUpdater interface,
+// it swaps the auther, bypass and limiter used by the new connections,
+// the established connections are not affected.
+func (h *tunnelHandler) UpdateOptions(opts ...handler.Option) error {
+	h.live.Update(opts...)
+	return nil
+}
+
+// trafficLimiter returns the current traffic limiter, which is swappable by UpdateOptions.
+func (h *tunnelHandler) trafficLimiter() traffic.TrafficLimiter {
+	return h.live.Load().Limiter
+}
+
+// Drain implements the service.Drainer interface,
+// it rejects new connections and waits for the active connections to finish.
+func (h *tunnelHandler) Drain(ctx context.Context) (forced int, err error) {
+	// the visitors of the entrypoint are drained along with the tunnel handler.
+	if h.epSvc != nil {
+		forced, err = xservice.Drain(ctx, h.epSvc)
+	}
+	n, e := h.tracker.Drain(ctx)
+	forced += n
+	if err == nil {
+		err = e
+	}
+	return
+}
+
 // Close implements io.Closer interface.
 func (h *tunnelHandler) Close() error {
 	if h.epSvc != nil {
@@ -290,10 +425,30 @@ func (h *tunnelHandler) Close() error {
 	if h.cancel != nil {
 		h.cancel()
 	}
+	h.events.Close()
+	h.billing.Close()
 
 	return nil
 }
 
+func (h *tunnelHandler) observeBindThrottled() {
+	if v := xmetrics.GetCounter(xmetrics.MetricRelayRequestsRejectedCounter,
+		core_metrics.Labels{"service": h.options.Service, "reason": "bind_rate"}); v != nil {
+		v.Inc()
+	}
+}
+
+// setMessage attaches a human-readable reason to the response,
+// it does nothing unless the verbose mode is enabled.
+func (h *tunnelHandler) setMessage(resp *relay.Response, format string, args ...any) {
+	if !h.md.verbose {
+		return
+	}
+	resp.Features = append(resp.Features, &xrelay.MessageFeature{
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
 func (h *tunnelHandler) checkRateLimit(addr net.Addr) bool {
 	if h.options.RateLimiter == nil {
 		return true
@@ -327,3 +482,13 @@ func (h *tunnelHandler) observeStats(ctx context.Context) {
 		}
 	}
 }
+
+// writeResponse writes the response of the handshake to conn, the write is bounded by the writeTimeout.
+func (h *tunnelHandler) writeResponse(conn net.Conn, resp *relay.Response) error {
+	if h.md.writeTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(h.md.writeTimeout))
+		defer conn.SetWriteDeadline(time.Time{})
+	}
+	_, err := resp.WriteTo(conn)
+	return err
+}
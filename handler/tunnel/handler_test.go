@@ -0,0 +1,246 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-gost/core/chain"
+	"github.com/go-gost/core/handler"
+	"github.com/go-gost/core/ingress"
+	"github.com/go-gost/core/limiter"
+	"github.com/go-gost/core/limiter/traffic"
+	"github.com/go-gost/relay"
+	xchain "github.com/go-gost/x/chain"
+	xingress "github.com/go-gost/x/ingress"
+	"github.com/go-gost/x/internal/util/mux"
+	xlogger "github.com/go-gost/x/logger"
+	xmd "github.com/go-gost/x/metadata"
+	"github.com/google/uuid"
+)
+
+func TestHandleSlowClient(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+
+	// the CONNECT request without the tunnel is answered by the handler.
+	var req bytes.Buffer
+	(&relay.Request{Version: relay.Version1, Cmd: relay.CmdConnect}).WriteTo(&req)
+
+	tests := []struct {
+		name string
+		// the data sent by the client, which never reads.
+		data []byte
+	}{
+		{name: "no request"},
+		// the request is sent partially.
+		{name: "partial request", data: req.Bytes()[:2]},
+		// the response is never read by the client.
+		{name: "slow reader", data: req.Bytes()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(
+				handler.RouterOption(xchain.NewRouter(chain.LoggerRouterOption(xlogger.Nop()))),
+				handler.LoggerOption(xlogger.Nop()),
+			)
+			if err := h.Init(xmd.NewMetadata(map[string]any{
+				"readTimeout": timeout.String(),
+			})); err != nil {
+				t.Fatal(err)
+			}
+
+			client, server := net.Pipe()
+			defer client.Close()
+
+			done := make(chan error, 1)
+			start := time.Now()
+			go func() {
+				done <- h.Handle(context.Background(), server)
+			}()
+			for _, b := range tt.data {
+				if _, err := client.Write([]byte{b}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			select {
+			case err := <-done:
+				if err == nil {
+					t.Error("the slow client is not dropped")
+				}
+				if d := time.Since(start); d < timeout {
+					t.Errorf("dropped after %v, before the timeout %v", d, timeout)
+				}
+			case <-time.After(10 * timeout):
+				t.Fatal("the slow client is not dropped within the timeout")
+			}
+		})
+	}
+}
+
+// addrConn is the connection with the remote address of the visitor.
+type addrConn struct {
+	net.Conn
+	raddr net.Addr
+}
+
+func (c *addrConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+func TestHandleConnectAccess(t *testing.T) {
+	tid := uuid.New()
+	tunnelID := relay.NewTunnelID(tid[:])
+
+	tests := []struct {
+		name  string
+		allow []string
+		// whether the visitor is answered, or closed without a response.
+		answered bool
+	}{
+		{name: "no acl", answered: true},
+		{name: "allowed", allow: []string{"192.168.0.0/16"}, answered: true},
+		{name: "denied", allow: []string{"10.0.0.0/8"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(
+				handler.RouterOption(xchain.NewRouter(chain.LoggerRouterOption(xlogger.Nop()))),
+				handler.LoggerOption(xlogger.Nop()),
+			).(*tunnelHandler)
+			if err := h.Init(xmd.NewMetadata(nil)); err != nil {
+				t.Fatal(err)
+			}
+			defer h.Close()
+
+			acl, err := xingress.NewACL(tt.allow, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.md.ingress = xingress.NewIngress(
+				xingress.RulesOption([]*ingress.Rule{
+					{Hostname: "example.com", Endpoint: tid.String()},
+				}),
+				xingress.ACLsOption(map[string]*xingress.ACL{"example.com": acl}),
+				xingress.LoggerOption(xlogger.Nop()),
+			)
+
+			client, server := net.Pipe()
+			defer client.Close()
+
+			done := make(chan error, 1)
+			go func() {
+				done <- h.Handle(context.Background(), &addrConn{
+					Conn:  server,
+					raddr: &net.TCPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 1234},
+				})
+			}()
+
+			req := relay.Request{Version: relay.Version1, Cmd: relay.CmdConnect}
+			src := &relay.AddrFeature{}
+			src.ParseFrom("192.168.1.1:1234")
+			dst := &relay.AddrFeature{}
+			dst.ParseFrom("example.com:80")
+			req.Features = append(req.Features, src, dst, &relay.TunnelFeature{ID: tunnelID})
+			if _, err := req.WriteTo(client); err != nil {
+				t.Fatal(err)
+			}
+
+			var resp relay.Response
+			_, err = resp.ReadFrom(client)
+			if tt.answered {
+				if err != nil {
+					t.Fatalf("read response: %v", err)
+				}
+				if resp.Status == relay.StatusOK {
+					t.Errorf("got status %d for the unavailable tunnel", resp.Status)
+				}
+				return
+			}
+			if !errors.Is(err, io.EOF) {
+				t.Errorf("got response %d, error %v, want closed", resp.Status, err)
+			}
+			if err := <-done; !errors.Is(err, ErrAccessDenied) {
+				t.Errorf("got error %v, want %v", err, ErrAccessDenied)
+			}
+		})
+	}
+}
+
+// countLimiter counts the lookups of the limits, no limit is applied.
+type countLimiter struct {
+	n atomic.Int64
+}
+
+func (l *countLimiter) In(ctx context.Context, key string, opts ...limiter.Option) traffic.Limiter {
+	l.n.Add(1)
+	return nil
+}
+
+func (l *countLimiter) Out(ctx context.Context, key string, opts ...limiter.Option) traffic.Limiter {
+	l.n.Add(1)
+	return nil
+}
+
+func TestConnectorLimiterSwap(t *testing.T) {
+	h := NewHandler(
+		handler.RouterOption(xchain.NewRouter(chain.LoggerRouterOption(xlogger.Nop()))),
+		handler.LoggerOption(xlogger.Nop()),
+	).(*tunnelHandler)
+	if err := h.Init(xmd.NewMetadata(nil)); err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	sc, cc := net.Pipe()
+	server, err := mux.ServerSession(sc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client, err := mux.ClientSession(cc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	go func() {
+		for {
+			conn, err := client.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+
+	tid := uuid.New()
+	cid := uuid.New()
+	// the connector is established before the limiter is swapped.
+	c := NewConnector(relay.NewConnectorID(cid[:]), relay.NewTunnelID(tid[:]), "node", server, &ConnectorOptions{
+		limiter: h.trafficLimiter,
+	})
+
+	lim := &countLimiter{}
+	if err := h.UpdateOptions(handler.TrafficLimiterOption(lim)); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := c.GetConn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if lim.n.Load() == 0 {
+		t.Error("the swapped limiter is not applied to the new visitor of the connector")
+	}
+}
@@ -1,6 +1,7 @@
 package tunnel
 
 import (
+	"net/http"
 	"strings"
 	"time"
 
@@ -11,38 +12,151 @@ import (
 	"github.com/go-gost/core/sd"
 	"github.com/go-gost/relay"
 	xingress "github.com/go-gost/x/ingress"
+	"github.com/go-gost/x/internal/util/billing"
+	http_util "github.com/go-gost/x/internal/util/http"
 	"github.com/go-gost/x/internal/util/mux"
+	xrelay "github.com/go-gost/x/internal/util/relay"
+	"github.com/go-gost/x/internal/util/schedule"
+	"github.com/go-gost/x/observer/event"
 	"github.com/go-gost/x/registry"
 )
 
 const (
-	defaultTTL = 15 * time.Second
+	defaultTTL          = 15 * time.Second
+	defaultDrainTimeout = 60 * time.Second
+	// the connect is retried on the other connectors twice if the stream of the connector can not be opened.
+	defaultConnectRetries = 2
+	// the time to read the request header of the visitor to the entrypoint,
+	// it also bounds the idle time between the requests of the keep-alive connection.
+	defaultEntryPointHeaderTimeout = 30 * time.Second
+	// the time to wait for the 100 Continue of the server before it is answered by the entrypoint.
+	defaultEntryPointContinueTimeout = time.Second
 )
 
 type metadata struct {
 	readTimeout             time.Duration
+	writeTimeout            time.Duration
 	entryPoint              string
 	entryPointID            relay.TunnelID
 	entryPointProxyProtocol int
+	entryPointDenyStatus    int
+	entryPointRequestLimits *http_util.RequestLimits
 	directTunnel            bool
 	tunnelTTL               time.Duration
+	tunnelMaxConns          int
+	tunnelMaxAge            time.Duration
+	tunnelDrainTimeout      time.Duration
+	tunnelSeed              int64
+	tunnelSeedByClient      bool
+	tunnelWeightDecay       float64
+	tunnelAcceptRetries     int
+	tunnelAcceptBackoff     time.Duration
+	waitTimeout             time.Duration
+	failoverRetries         int
+	failoverWindow          time.Duration
+	bindRate                int
+	bindWindow              time.Duration
+	bindRetryAfter          time.Duration
 	ingress                 ingress.Ingress
 	sd                      sd.SD
 	muxCfg                  *mux.Config
 	observePeriod           time.Duration
+	verbose                 bool
+	requestLimits           *xrelay.RequestLimits
+	// the time-of-day access policies of the clients, nil if disabled.
+	schedule *schedule.Schedule
+	maskIP   bool
+	// emits the lifecycle events of the visitor connections through the observer.
+	connEvents     bool
+	connEventsOpts event.ConnEmitterOptions
+	// the time to wait for the 100 Continue of the server before it is answered by the entrypoint,
+	// 0 answers it at once without asking the server, for the servers which do not care about the body.
+	entryPointContinueTimeout time.Duration
+	// the batching of the billing records, the records are emitted if the billing recorder is set.
+	billingOpts billing.Options
+	// pins the clients of the entrypoint to the connectors by the client IP,
+	// the pin expires after the client is inactive for the TTL.
+	entryPointAffinity           bool
+	entryPointAffinityTTL        time.Duration
+	entryPointAffinityMaxEntries int
+	// the times the connect is retried on another connector, after the stream of the selected one failed to open.
+	connectRetries int
 }
 
 func (h *tunnelHandler) parseMetadata(md mdata.Metadata) (err error) {
 	h.md.readTimeout = mdutil.GetDuration(md, "readTimeout")
+	h.md.writeTimeout = mdutil.GetDuration(md, "writeTimeout")
+	if h.md.writeTimeout <= 0 {
+		h.md.writeTimeout = h.md.readTimeout
+	}
+
+	h.md.requestLimits = &xrelay.RequestLimits{
+		MaxSize:         mdutil.GetInt(md, "relay.maxRequestSize"),
+		MaxFeatures:     mdutil.GetInt(md, "relay.maxFeatures"),
+		MaxStringLength: mdutil.GetInt(md, "relay.maxStringLength"),
+	}
 
 	h.md.tunnelTTL = mdutil.GetDuration(md, "tunnel.ttl")
 	if h.md.tunnelTTL <= 0 {
 		h.md.tunnelTTL = defaultTTL
 	}
+	h.md.tunnelMaxConns = mdutil.GetInt(md, "tunnel.maxConns")
+	// the connectors are closed after the max age, so the clients reconnect.
+	h.md.tunnelMaxAge = mdutil.GetDuration(md, "tunnel.maxAge")
+	h.md.tunnelSeed = int64(mdutil.GetInt(md, "tunnel.seed"))
+	h.md.tunnelSeedByClient = mdutil.GetBool(md, "tunnel.seedByClient")
+	// the weights of the connectors decay by the active connections, 0 for the static weights.
+	h.md.tunnelWeightDecay = mdutil.GetFloat(md, "tunnel.weightDecay")
+	// the failed accept of the connector is retried with the exponential backoff before the connector is dropped.
+	h.md.tunnelAcceptRetries = mdutil.GetInt(md, "tunnel.acceptRetries")
+	h.md.tunnelAcceptBackoff = mdutil.GetDuration(md, "tunnel.acceptBackoff")
+	h.md.tunnelDrainTimeout = mdutil.GetDuration(md, "tunnel.drainTimeout")
+	if h.md.tunnelDrainTimeout <= 0 {
+		h.md.tunnelDrainTimeout = defaultDrainTimeout
+	}
+	h.md.waitTimeout = mdutil.GetDuration(md, "tunnel.waitTimeout")
+	// the connection is retried on another connector once by default if the stream fails immediately.
+	h.md.failoverRetries = 1
+	if md != nil && md.IsExists("tunnel.failover.retries") {
+		h.md.failoverRetries = mdutil.GetInt(md, "tunnel.failover.retries")
+	}
+	h.md.connectRetries = defaultConnectRetries
+	if md != nil && md.IsExists("tunnel.connect.retries") {
+		h.md.connectRetries = max(mdutil.GetInt(md, "tunnel.connect.retries"), 0)
+	}
+	h.md.failoverWindow = mdutil.GetDuration(md, "tunnel.failover.window")
+	if h.md.failoverWindow <= 0 {
+		h.md.failoverWindow = defaultFailoverWindow
+	}
+	// the max binds of the connectors in the window, the binds over it are rejected with the retry-after hint.
+	h.md.bindRate = mdutil.GetInt(md, "tunnel.bind.rate")
+	h.md.bindWindow = mdutil.GetDuration(md, "tunnel.bind.window")
+	h.md.bindRetryAfter = mdutil.GetDuration(md, "tunnel.bind.retryAfter")
 	h.md.directTunnel = mdutil.GetBool(md, "tunnel.direct")
 	h.md.entryPoint = mdutil.GetString(md, "entrypoint")
 	h.md.entryPointID = parseTunnelID(mdutil.GetString(md, "entrypoint.id"))
 	h.md.entryPointProxyProtocol = mdutil.GetInt(md, "entrypoint.ProxyProtocol")
+	// the HTTP status code for the visitors denied by the access control of the ingress rule.
+	h.md.entryPointDenyStatus = mdutil.GetInt(md, "entrypoint.denyStatus")
+	if h.md.entryPointDenyStatus <= 0 {
+		h.md.entryPointDenyStatus = http.StatusForbidden
+	}
+	h.md.entryPointRequestLimits = &http_util.RequestLimits{
+		MaxHeaderBytes: mdutil.GetInt(md, "entrypoint.maxHeaderBytes"),
+		MaxRequestLine: mdutil.GetInt(md, "entrypoint.maxRequestLine"),
+		MaxHeaders:     mdutil.GetInt(md, "entrypoint.maxHeaders"),
+		Timeout:        mdutil.GetDuration(md, "entrypoint.headerTimeout"),
+	}
+	if h.md.entryPointRequestLimits.Timeout <= 0 {
+		h.md.entryPointRequestLimits.Timeout = defaultEntryPointHeaderTimeout
+	}
+	h.md.entryPointAffinity = mdutil.GetBool(md, "entrypoint.affinity")
+	h.md.entryPointAffinityTTL = mdutil.GetDuration(md, "entrypoint.affinity.ttl")
+	h.md.entryPointAffinityMaxEntries = mdutil.GetInt(md, "entrypoint.affinity.maxEntries")
+	h.md.entryPointContinueTimeout = defaultEntryPointContinueTimeout
+	if md != nil && md.IsExists("entrypoint.continueTimeout") {
+		h.md.entryPointContinueTimeout = mdutil.GetDuration(md, "entrypoint.continueTimeout")
+	}
 
 	h.md.ingress = registry.IngressRegistry().Get(mdutil.GetString(md, "ingress"))
 	if h.md.ingress == nil {
@@ -68,6 +182,18 @@ func (h *tunnelHandler) parseMetadata(md mdata.Metadata) (err error) {
 		}
 	}
 	h.md.sd = registry.SDRegistry().Get(mdutil.GetString(md, "sd"))
+	if h.md.sd != nil {
+		h.md.sd = newCachedSD(h.md.sd,
+			mdutil.GetString(md, "sd.cache"),
+			mdutil.GetDuration(md, "sd.cache.maxAge"),
+			logger.Default().WithFields(map[string]any{
+				"kind": "sd",
+				"sd":   mdutil.GetString(md, "sd"),
+			}),
+		)
+		// a negative delay deregisters the connectors immediately.
+		h.md.sd = newDelayedSD(h.md.sd, mdutil.GetDuration(md, "sd.deregisterDelay"))
+	}
 
 	h.md.muxCfg = &mux.Config{
 		Version:           mdutil.GetInt(md, "mux.version"),
@@ -82,7 +208,92 @@ func (h *tunnelHandler) parseMetadata(md mdata.Metadata) (err error) {
 		h.md.muxCfg.Version = 2
 	}
 
+	if h.md.schedule, err = schedule.New(schedule.Options{
+		Policies:  mdutil.GetStringMapString(md, "schedule"),
+		Default:   mdutil.GetString(md, "schedule.default"),
+		Terminate: mdutil.GetBool(md, "schedule.terminate"),
+	}); err != nil {
+		return
+	}
+
 	h.md.observePeriod = mdutil.GetDuration(md, "observePeriod")
 
+	// NOTE: the message feature is not recognized by old clients,
+	// and it may leak information about the tunnels, so it is disabled by default.
+	h.md.verbose = mdutil.GetBool(md, "verbose")
+
+	h.md.maskIP = mdutil.GetBool(md, "maskIP")
+
+	h.md.connEvents = mdutil.GetBool(md, "connEvents")
+	h.md.connEventsOpts = event.ConnEmitterOptions{
+		Sample: mdutil.GetFloat(md, "connEvents.sample"),
+		Rate:   mdutil.GetInt(md, "connEvents.rate"),
+	}
+	h.md.billingOpts = billing.Options{
+		BatchSize:     mdutil.GetInt(md, "billing.batchSize"),
+		FlushInterval: mdutil.GetDuration(md, "billing.flushInterval"),
+	}
 	return
 }
+
+// schema is the metadata keys of the handler.
+var schema = []string{
+	"billing.batchSize",
+	"billing.flushInterval",
+	"connEvents",
+	"connEvents.rate",
+	"connEvents.sample",
+	"entrypoint",
+	"entrypoint.affinity",
+	"entrypoint.affinity.maxEntries",
+	"entrypoint.affinity.ttl",
+	"entrypoint.continueTimeout",
+	"entrypoint.denyStatus",
+	"entrypoint.headerTimeout",
+	"entrypoint.id",
+	"entrypoint.maxHeaderBytes",
+	"entrypoint.maxHeaders",
+	"entrypoint.maxRequestLine",
+	"entrypoint.ProxyProtocol",
+	"ingress",
+	"maskIP",
+	"mux.keepaliveDisabled",
+	"mux.keepaliveInterval",
+	"mux.keepaliveTimeout",
+	"mux.maxFrameSize",
+	"mux.maxReceiveBuffer",
+	"mux.maxStreamBuffer",
+	"mux.version",
+	"observePeriod",
+	"readTimeout",
+	"relay.maxFeatures",
+	"relay.maxRequestSize",
+	"relay.maxStringLength",
+	"schedule",
+	"schedule.default",
+	"schedule.terminate",
+	"sd",
+	"sd.cache",
+	"sd.cache.maxAge",
+	"sd.deregisterDelay",
+	"tunnel",
+	"tunnel.acceptBackoff",
+	"tunnel.acceptRetries",
+	"tunnel.bind.rate",
+	"tunnel.bind.retryAfter",
+	"tunnel.bind.window",
+	"tunnel.connect.retries",
+	"tunnel.direct",
+	"tunnel.drainTimeout",
+	"tunnel.failover.retries",
+	"tunnel.failover.window",
+	"tunnel.maxAge",
+	"tunnel.maxConns",
+	"tunnel.seed",
+	"tunnel.seedByClient",
+	"tunnel.ttl",
+	"tunnel.waitTimeout",
+	"tunnel.weightDecay",
+	"verbose",
+	"writeTimeout",
+}
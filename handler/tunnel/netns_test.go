@@ -0,0 +1,141 @@
+package tunnel
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-gost/core/chain"
+	"github.com/go-gost/core/handler"
+	xchain "github.com/go-gost/x/chain"
+	xlogger "github.com/go-gost/x/logger"
+	xmd "github.com/go-gost/x/metadata"
+	"github.com/vishvananda/netns"
+)
+
+// newNetns creates an unshared network namespace, the test is skipped if it is not permitted.
+// The returned path refers to the namespace while the handle is open.
+func newNetns(t *testing.T) (netns.NsHandle, string) {
+	t.Helper()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("network namespaces are only supported on Linux")
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origin, err := netns.Get()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer origin.Close()
+
+	// New switches the thread into the namespace created.
+	ns, err := netns.New()
+	if err != nil {
+		t.Skipf("unshare the network namespace: %v", err)
+	}
+	if err := netns.Set(origin); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ns.Close() })
+
+	return ns, fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), int(ns))
+}
+
+// listening reports whether a TCP socket listens on the port in the network namespace ns.
+func listening(t *testing.T, ns netns.NsHandle, port int) bool {
+	t.Helper()
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origin, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer origin.Close()
+	if err := netns.Set(ns); err != nil {
+		t.Fatal(err)
+	}
+	defer netns.Set(origin)
+
+	// the sockets of the namespace of the current thread.
+	for _, name := range []string{"/proc/thread-self/net/tcp", "/proc/thread-self/net/tcp6"} {
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			// sl local_address rem_address st ...
+			fields := strings.Fields(s.Text())
+			if len(fields) < 4 || fields[3] != "0A" { // TCP_LISTEN
+				continue
+			}
+			i := strings.LastIndexByte(fields[1], ':')
+			if p, err := strconv.ParseUint(fields[1][i+1:], 16, 16); err == nil && int(p) == port {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newNetnsHandler(t *testing.T, ns string) (*tunnelHandler, error) {
+	h := NewHandler(
+		handler.RouterOption(xchain.NewRouter(chain.LoggerRouterOption(xlogger.Nop()))),
+		handler.LoggerOption(xlogger.Nop()),
+		handler.ServiceOption("test"),
+		handler.NetnsOption(ns),
+	).(*tunnelHandler)
+	err := h.Init(xmd.NewMetadata(map[string]any{
+		"entrypoint": ":0",
+	}))
+	if err == nil {
+		t.Cleanup(func() { h.Close() })
+	}
+	return h, err
+}
+
+func TestEntrypointNetns(t *testing.T) {
+	ns, path := newNetns(t)
+
+	origin, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer origin.Close()
+
+	h, err := newNetnsHandler(t, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.epSvc == nil {
+		t.Fatal("no entrypoint")
+	}
+	port := h.epSvc.Addr().(*net.TCPAddr).Port
+
+	if !listening(t, ns, port) {
+		t.Errorf("the entrypoint port %d is not bound in the namespace of the handler", port)
+	}
+	if listening(t, origin, port) {
+		t.Errorf("the entrypoint port %d is bound in the original namespace", port)
+	}
+}
+
+func TestEntrypointNetnsNotFound(t *testing.T) {
+	newNetns(t)
+
+	if _, err := newNetnsHandler(t, "/proc/self/ns/no-such-netns"); err == nil {
+		t.Error("Init succeeds with the nonexistent namespace")
+	}
+}
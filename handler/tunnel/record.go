@@ -0,0 +1,45 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// connRecord is the record of the visitor connection of the entrypoint dialed to the tunnel,
+// emitted to the tunnel recorder (recorder.service.handler.tunnel) as a JSON object.
+type connRecord struct {
+	Service   string `json:"service"`
+	Tunnel    string `json:"tunnel"`
+	Connector string `json:"connector,omitempty"`
+	Node      string `json:"node,omitempty"`
+	Network   string `json:"network"`
+	Host      string `json:"host,omitempty"`
+	// Client is the address of the client, the source address of the PROXY protocol header
+	// if the entrypoint is behind the load balancer.
+	Client string `json:"client"`
+	// Peer is the address of the load balancer sending the PROXY protocol header, empty if not enabled.
+	Peer string `json:"peer,omitempty"`
+	// Src is the address of the client claimed by the request, such as the X-Forwarded-For header,
+	// empty if it is the same as the Client.
+	Src  string    `json:"src,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// record emits the record of the visitor connection to the tunnel recorder, if any.
+func (ep *entrypoint) record(ctx context.Context, r *connRecord) {
+	if ep.recorder == nil {
+		return
+	}
+
+	r.Service = ep.service
+	r.Time = time.Now()
+	b, err := json.Marshal(r)
+	if err != nil {
+		ep.log.Error(err)
+		return
+	}
+	if err := ep.recorder.Record(ctx, b); err != nil {
+		ep.log.Errorf("record: %v", err)
+	}
+}
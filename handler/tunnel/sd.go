@@ -0,0 +1,280 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/logger"
+	"github.com/go-gost/core/sd"
+)
+
+const (
+	defaultSDDeregisterDelay = 5 * time.Second
+	defaultSDCacheMaxAge     = 10 * time.Minute
+	// the time the missing tunnel is remembered, the lookups of it in the period are not sent to the sd.
+	sdNegativeTTL = time.Second
+	// the timeout of the live lookup of the tunnel.
+	sdLookupTimeout = 10 * time.Second
+	// the number of the entries triggering the sweep of the stale ones.
+	sdSweepThreshold = 1024
+)
+
+type sdCacheEntry struct {
+	Services []*sd.Service `json:"services"`
+	Updated  time.Time     `json:"updated"`
+	// the entry is loaded from the cache file and not refreshed by a live lookup yet.
+	loaded bool
+	// the time of the last live lookup finding no service.
+	missed time.Time
+}
+
+type sdCall struct {
+	done     chan struct{}
+	services []*sd.Service
+	err      error
+}
+
+// cachedSD deduplicates the concurrent lookups of the same tunnel,
+// and keeps the last known services of the tunnels, optionally persisted in a file.
+// The services loaded from the file are used while the first live lookup of the tunnel is in flight,
+// and the cached services are the fallback if the lookup fails, as long as they are not older than maxAge.
+type cachedSD struct {
+	sd.SD
+	file    string
+	maxAge  time.Duration
+	entries map[string]*sdCacheEntry
+	calls   map[string]*sdCall
+	// the number of the entries triggering the next sweep.
+	nextSweep int
+	mu        sync.Mutex
+	writeMu   sync.Mutex
+	log       logger.Logger
+}
+
+func newCachedSD(s sd.SD, file string, maxAge time.Duration, log logger.Logger) *cachedSD {
+	if maxAge <= 0 {
+		maxAge = defaultSDCacheMaxAge
+	}
+	c := &cachedSD{
+		SD:        s,
+		file:      file,
+		maxAge:    maxAge,
+		entries:   make(map[string]*sdCacheEntry),
+		calls:     make(map[string]*sdCall),
+		nextSweep: sdSweepThreshold,
+		log:       log,
+	}
+	if err := c.load(); err != nil {
+		log.Warnf("load sd cache %s: %v", file, err)
+	}
+	return c
+}
+
+func (c *cachedSD) Get(ctx context.Context, name string) ([]*sd.Service, error) {
+	c.mu.Lock()
+	entry := c.entries[name]
+	if entry != nil && !entry.missed.IsZero() && time.Since(entry.missed) < sdNegativeTTL {
+		c.mu.Unlock()
+		return nil, nil
+	}
+	call := c.calls[name]
+	if call == nil {
+		call = &sdCall{done: make(chan struct{})}
+		c.calls[name] = call
+		go c.lookup(name, call)
+	}
+	// the services from the cache file are served without waiting for the live lookup.
+	if entry != nil && entry.loaded && c.fresh(entry) {
+		services := entry.Services
+		c.mu.Unlock()
+		return services, nil
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.services, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// lookup queries the sd for the tunnel and updates the cache.
+// It is detached from the context of the caller, as the result is shared by all the waiters,
+// and bounded by sdLookupTimeout instead.
+func (c *cachedSD) lookup(name string, call *sdCall) {
+	ctx, cancel := context.WithTimeout(context.Background(), sdLookupTimeout)
+	services, err := c.SD.Get(ctx, name)
+	cancel()
+
+	c.mu.Lock()
+	entry := c.entries[name]
+	changed := false
+	switch {
+	case err == nil && len(services) > 0:
+		if entry == nil || !reflect.DeepEqual(entry.Services, services) {
+			changed = true
+		}
+		c.add(name, &sdCacheEntry{
+			Services: services,
+			Updated:  time.Now(),
+		})
+	case err == nil:
+		if entry == nil {
+			entry = &sdCacheEntry{}
+			c.add(name, entry)
+		}
+		entry.missed = time.Now()
+		if len(entry.Services) > 0 {
+			// the tunnel has gone.
+			entry.Services = nil
+			changed = true
+		}
+	default:
+		if entry != nil && c.fresh(entry) {
+			c.log.Debugf("sd lookup of %s: %v, the cached services are used", name, err)
+			services, err = entry.Services, nil
+		}
+	}
+	call.services, call.err = services, err
+	delete(c.calls, name)
+	c.mu.Unlock()
+
+	close(call.done)
+
+	if changed {
+		if err := c.save(); err != nil {
+			c.log.Warnf("save sd cache %s: %v", c.file, err)
+		}
+	}
+}
+
+// add puts the entry of the tunnel in the cache, sweeping the stale entries as the cache grows.
+// The caller must hold c.mu.
+func (c *cachedSD) add(name string, entry *sdCacheEntry) {
+	if _, ok := c.entries[name]; !ok && len(c.entries) >= c.nextSweep {
+		c.sweep()
+	}
+	c.entries[name] = entry
+}
+
+// sweep deletes the entries neither serving the services nor remembering a recent miss.
+func (c *cachedSD) sweep() {
+	for name, entry := range c.entries {
+		if !c.fresh(entry) && time.Since(entry.missed) >= sdNegativeTTL {
+			delete(c.entries, name)
+		}
+	}
+	// the sweeps are amortized over the entries added since the last one.
+	c.nextSweep = max(sdSweepThreshold, 2*len(c.entries))
+}
+
+func (c *cachedSD) fresh(entry *sdCacheEntry) bool {
+	return len(entry.Services) > 0 && time.Since(entry.Updated) <= c.maxAge
+}
+
+func (c *cachedSD) load() error {
+	if c.file == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(c.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	entries := map[string]*sdCacheEntry{}
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return err
+	}
+	for name, entry := range entries {
+		if entry == nil || !c.fresh(entry) {
+			continue
+		}
+		entry.loaded = true
+		c.entries[name] = entry
+	}
+	return nil
+}
+
+// save writes the services of the tunnels to the cache file, the file is replaced atomically.
+func (c *cachedSD) save() error {
+	if c.file == "" {
+		return nil
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.mu.Lock()
+	entries := make(map[string]*sdCacheEntry, len(c.entries))
+	for name, entry := range c.entries {
+		if len(entry.Services) > 0 {
+			entries[name] = entry
+		}
+	}
+	b, err := json.Marshal(entries)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(c.file), filepath.Base(c.file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.file)
+}
+
+// delayedSD defers the deregistration of the connectors for a grace period,
+// as the sd consumers may still route to the connector by the cached services,
+// the other connectors of the tunnel on this node serve them in the meantime.
+type delayedSD struct {
+	sd.SD
+	delay time.Duration
+}
+
+func newDelayedSD(s sd.SD, delay time.Duration) sd.SD {
+	if delay < 0 {
+		return s
+	}
+	if delay == 0 {
+		delay = defaultSDDeregisterDelay
+	}
+	return &delayedSD{
+		SD:    s,
+		delay: delay,
+	}
+}
+
+func (d *delayedSD) Deregister(ctx context.Context, service *sd.Service) error {
+	time.AfterFunc(d.delay, func() {
+		d.SD.Deregister(context.Background(), service)
+	})
+	return nil
+}
+
+// deregisterNow deregisters the service without the delay of delayedSD,
+// for the connectors closed on purpose which should not be routed to any more.
+func deregisterNow(s sd.SD, service *sd.Service) error {
+	if d, ok := s.(*delayedSD); ok {
+		s = d.SD
+	}
+	return s.Deregister(context.Background(), service)
+}
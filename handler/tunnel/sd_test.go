@@ -0,0 +1,149 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-gost/core/sd"
+	"github.com/go-gost/relay"
+	"github.com/go-gost/x/internal/util/mux"
+	xlogger "github.com/go-gost/x/logger"
+	"github.com/google/uuid"
+)
+
+// testSD finds the services of the tunnel named "live" only.
+type testSD struct {
+	sd.SD
+	deadline chan bool
+}
+
+func (s *testSD) Get(ctx context.Context, name string) ([]*sd.Service, error) {
+	_, ok := ctx.Deadline()
+	select {
+	case s.deadline <- ok:
+	default:
+	}
+	if name == "live" {
+		return []*sd.Service{{Name: name, Node: "node", Address: "127.0.0.1:8421"}}, nil
+	}
+	return nil, nil
+}
+
+func TestCachedSDLookupDeadline(t *testing.T) {
+	s := &testSD{deadline: make(chan bool, 1)}
+	c := newCachedSD(s, "", 0, xlogger.Nop())
+
+	if _, err := c.Get(context.Background(), "live"); err != nil {
+		t.Fatal(err)
+	}
+	if !<-s.deadline {
+		t.Error("the sd lookup has no deadline")
+	}
+}
+
+func TestCachedSDSweep(t *testing.T) {
+	c := newCachedSD(&testSD{}, "", 0, xlogger.Nop())
+
+	ctx := context.Background()
+	if services, err := c.Get(ctx, "live"); err != nil || len(services) != 1 {
+		t.Fatalf("live: got %v, %v", services, err)
+	}
+	for i := 0; i < sdSweepThreshold-1; i++ {
+		if _, err := c.Get(ctx, fmt.Sprintf("missing-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the misses are forgotten after sdNegativeTTL, the live tunnel is kept.
+	time.Sleep(sdNegativeTTL)
+	if _, err := c.Get(ctx, "missing"); err != nil {
+		t.Fatal(err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := len(c.entries); n != 2 {
+		t.Errorf("entries: got %d, want 2", n)
+	}
+	if c.entries["live"] == nil {
+		t.Error("the entry of the live tunnel is swept")
+	}
+}
+
+// slowSD blocks the deregistrations until release is closed.
+type slowSD struct {
+	sd.SD
+	deregister chan string
+	release    chan struct{}
+}
+
+func (s *slowSD) Deregister(ctx context.Context, service *sd.Service) error {
+	s.deregister <- service.ID
+	<-s.release
+	return nil
+}
+
+func TestCloseConnectorSlowSD(t *testing.T) {
+	s := &slowSD{
+		deregister: make(chan string, 1),
+		release:    make(chan struct{}),
+	}
+
+	tid := uuid.New()
+	tunnel := NewTunnel("node", relay.NewTunnelID(tid[:]), 0)
+	defer tunnel.Close()
+	defer close(s.release)
+	tunnel.WithSD(newDelayedSD(s, 0))
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		sc, cc := net.Pipe()
+		defer cc.Close()
+		session, err := mux.ServerSession(sc, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cid := uuid.New()
+		c := NewConnector(relay.NewConnectorID(cid[:]), tunnel.ID(), "node", session, nil)
+		tunnel.AddConnector(c)
+		ids = append(ids, c.ID().String())
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- tunnel.CloseConnector(ids[0])
+	}()
+	select {
+	case id := <-s.deregister:
+		if id != ids[0] {
+			t.Errorf("deregistered %s, want %s", id, ids[0])
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("the connector is not deregistered")
+	}
+
+	// the tunnel is not locked while the sd is deregistering.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tunnel.GetConnector(context.Background(), "tcp")
+		tunnel.Connectors()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the tunnel is blocked by the sd")
+	}
+
+	if n := len(tunnel.Connectors()); n != 1 {
+		t.Errorf("got %d connectors, want 1", n)
+	}
+	select {
+	case err := <-errc:
+		t.Fatalf("close returned %v before the deregistration", err)
+	default:
+	}
+}
@@ -0,0 +1,266 @@
+package tunnel
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/logger"
+	"github.com/go-gost/relay"
+)
+
+const (
+	// the max number of the pipelined requests waiting for the responses on a stream.
+	maxPipelinedRequests = 16
+)
+
+// httpStream is a tunnel stream bound to a visitor connection for the keep-alive session.
+// The requests of the visitor are written to the stream in order,
+// and the responses are read from the stream and written back to the visitor in the same order,
+// so the pipelined requests are also served by the single stream.
+type httpStream struct {
+	conn     net.Conn
+	visitor  net.Conn
+	tunnelID relay.TunnelID
+	host     string
+	src      string
+	reqs     chan *http.Request
+	pending  sync.WaitGroup
+	done     chan struct{}
+	requests int
+	// the time to wait for the 100 Continue of the server before it is answered by the stream.
+	continueTimeout time.Duration
+	// serializes the writes to the visitor, the 100 Continue answered on the timeout is written outside the serving goroutine.
+	wmu sync.Mutex
+	log logger.Logger
+}
+
+func newHTTPStream(conn, visitor net.Conn, tunnelID relay.TunnelID, host, src string, continueTimeout time.Duration, log logger.Logger) *httpStream {
+	s := &httpStream{
+		conn:            conn,
+		visitor:         visitor,
+		tunnelID:        tunnelID,
+		host:            host,
+		src:             src,
+		reqs:            make(chan *http.Request, maxPipelinedRequests),
+		done:            make(chan struct{}),
+		continueTimeout: continueTimeout,
+		log:             log,
+	}
+	go s.serve()
+	return s
+}
+
+// reusable reports whether the request to the host of the tunnel from src can be sent over the stream.
+func (s *httpStream) reusable(tunnelID relay.TunnelID, host, src string) bool {
+	return s.tunnelID.Equal(tunnelID) && s.host == host && s.src == src
+}
+
+// send writes the request to the stream, the response is written back to the visitor by the serving goroutine.
+// The body held by the expectation is written once the server answers 100 Continue or the continue timeout elapses.
+func (s *httpStream) send(req *http.Request) error {
+	s.requests++
+	s.pending.Add(1)
+	s.reqs <- req
+
+	if body, ok := req.Body.(*continueBody); ok {
+		timer := time.AfterFunc(s.continueTimeout, func() {
+			body.resolve(true, func() {
+				s.write(&http.Response{
+					ProtoMajor: req.ProtoMajor,
+					ProtoMinor: req.ProtoMinor,
+					Header:     http.Header{},
+					StatusCode: http.StatusContinue,
+				})
+			})
+		})
+		defer timer.Stop()
+	}
+	return req.Write(s.conn)
+}
+
+// write writes the response to the visitor.
+func (s *httpStream) write(res *http.Response) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return res.Write(s.visitor)
+}
+
+// wait waits for the responses of all the sent requests to be written back to the visitor.
+func (s *httpStream) wait() {
+	s.pending.Wait()
+}
+
+// close closes the stream after the responses of all the sent requests are written back.
+func (s *httpStream) close() {
+	close(s.reqs)
+	<-s.done
+	s.conn.Close()
+
+	s.log.Debugf("stream to tunnel %s closed, %d requests served", s.tunnelID, s.requests)
+}
+
+// abort closes the stream without waiting for the pending responses.
+func (s *httpStream) abort() {
+	s.conn.Close()
+	close(s.reqs)
+	<-s.done
+
+	s.log.Debugf("stream to tunnel %s aborted, %d requests served", s.tunnelID, s.requests)
+}
+
+func (s *httpStream) serve() {
+	defer close(s.done)
+
+	br := bufio.NewReader(s.conn)
+	failed := false
+	for req := range s.reqs {
+		if !failed {
+			if err := s.roundTrip(br, req); err != nil {
+				failed = true
+				// the order of the responses can not be kept any more.
+				s.visitor.Close()
+			}
+		}
+		// the held body is never sent once the request fails.
+		if body, ok := req.Body.(*continueBody); ok {
+			body.resolve(false, nil)
+		}
+		s.pending.Done()
+	}
+}
+
+func (s *httpStream) roundTrip(br *bufio.Reader, req *http.Request) error {
+	res, err := s.readResponse(br, req)
+	if err != nil {
+		s.log.Errorf("read response: %v", err)
+		s.write(&http.Response{
+			ProtoMajor: req.ProtoMajor,
+			ProtoMinor: req.ProtoMinor,
+			Header:     http.Header{},
+			StatusCode: http.StatusServiceUnavailable,
+		})
+		return err
+	}
+	defer res.Body.Close()
+
+	body, _ := req.Body.(*continueBody)
+	// the final response comes before the body is sent.
+	body.resolve(false, nil)
+	if body.rejected() {
+		// the stream is dropped by the entrypoint. The visitor connection is kept only if the body
+		// the visitor may still send can be discarded, that is, the length of it is known.
+		if req.ContentLength > 0 {
+			res.Close = false
+			res.Header.Del("Connection")
+		} else {
+			res.Close = true
+			res.Header.Set("Connection", "close")
+		}
+	}
+
+	if s.log.IsLevelEnabled(logger.TraceLevel) {
+		dump, _ := httputil.DumpResponse(res, false)
+		s.log.Trace(string(dump))
+	}
+
+	// HTTP/1.0
+	if req.ProtoMajor == 1 && req.ProtoMinor == 0 {
+		if !res.Close {
+			res.Header.Set("Connection", "keep-alive")
+		}
+		res.ProtoMajor = req.ProtoMajor
+		res.ProtoMinor = req.ProtoMinor
+	}
+
+	if err = s.write(res); err != nil {
+		s.log.Errorf("write response: %v", err)
+		return err
+	}
+
+	if res.Close {
+		// the server closes the stream after the response.
+		return io.EOF
+	}
+	return nil
+}
+
+// readResponse reads the final response of the request, the interim responses are forwarded to the visitor.
+// The 100 Continue is forwarded only if the request holds the body for it and it is not answered yet.
+func (s *httpStream) readResponse(br *bufio.Reader, req *http.Request) (*http.Response, error) {
+	body, _ := req.Body.(*continueBody)
+	for {
+		res, err := http.ReadResponse(br, req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode < 100 || res.StatusCode >= 200 ||
+			res.StatusCode == http.StatusSwitchingProtocols {
+			return res, nil
+		}
+		if res.StatusCode == http.StatusContinue {
+			body.resolve(true, func() { err = s.write(res) })
+		} else {
+			err = s.write(res)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// continueBody holds the body of the request expecting 100-continue,
+// until the server answers 100 Continue, the continue timeout elapses,
+// or the server rejects it with the final response, in which case the body is never read.
+type continueBody struct {
+	io.ReadCloser
+	ready   chan struct{}
+	allowed bool
+	once    sync.Once
+}
+
+func newContinueBody(body io.ReadCloser) *continueBody {
+	return &continueBody{
+		ReadCloser: body,
+		ready:      make(chan struct{}),
+	}
+}
+
+// resolve allows or discards the body, only the first call takes effect, and f is called before the body is released.
+func (b *continueBody) resolve(allowed bool, f func()) {
+	if b == nil {
+		return
+	}
+	b.once.Do(func() {
+		if f != nil {
+			f()
+		}
+		b.allowed = allowed
+		close(b.ready)
+	})
+}
+
+// rejected reports whether the body is discarded.
+func (b *continueBody) rejected() bool {
+	if b == nil {
+		return false
+	}
+	select {
+	case <-b.ready:
+		return !b.allowed
+	default:
+		return false
+	}
+}
+
+func (b *continueBody) Read(p []byte) (int, error) {
+	<-b.ready
+	if !b.allowed {
+		return 0, io.EOF
+	}
+	return b.ReadCloser.Read(p)
+}
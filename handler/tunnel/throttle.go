@@ -0,0 +1,63 @@
+package tunnel
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultBindWindow     = time.Second
+	defaultBindRetryAfter = 5 * time.Second
+)
+
+// bindThrottle limits the rate of the binds of the connectors, such as the storm of the re-registrations
+// after the server restarts. The binds over the limit are rejected with the retry-after hint,
+// the clients ignoring the hint are served once the rate drops.
+type bindThrottle struct {
+	limit      int
+	window     time.Duration
+	retryAfter time.Duration
+	start      time.Time
+	n          int
+	mu         sync.Mutex
+}
+
+// newBindThrottle creates a bindThrottle allowing limit binds in the window, nil is returned if limit is not set,
+// and the nil bindThrottle allows all the binds.
+func newBindThrottle(limit int, window, retryAfter time.Duration) *bindThrottle {
+	if limit <= 0 {
+		return nil
+	}
+	if window <= 0 {
+		window = defaultBindWindow
+	}
+	if retryAfter <= 0 {
+		retryAfter = defaultBindRetryAfter
+	}
+	return &bindThrottle{
+		limit:      limit,
+		window:     window,
+		retryAfter: retryAfter,
+	}
+}
+
+// allow reports whether the bind is allowed, the rejected binds are not counted.
+func (t *bindThrottle) allow() bool {
+	if t == nil {
+		return true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(t.start) >= t.window {
+		t.start = now
+		t.n = 0
+	}
+	if t.n >= t.limit {
+		return false
+	}
+	t.n++
+	return true
+}
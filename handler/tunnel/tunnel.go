@@ -2,18 +2,28 @@ package tunnel
 
 import (
 	"context"
+	"errors"
+	"math/rand"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-gost/core/limiter"
 	"github.com/go-gost/core/limiter/traffic"
 	"github.com/go-gost/core/logger"
+	"github.com/go-gost/core/metrics"
+	"github.com/go-gost/core/observer"
 	"github.com/go-gost/core/sd"
 	"github.com/go-gost/relay"
+	ctxvalue "github.com/go-gost/x/ctx"
 	"github.com/go-gost/x/internal/util/mux"
+	quic_util "github.com/go-gost/x/internal/util/quic"
+	xmetrics "github.com/go-gost/x/metrics"
+	"github.com/go-gost/x/observer/event"
 
 	"github.com/go-gost/core/observer/stats"
+	xtraffic "github.com/go-gost/x/limiter/traffic"
 	traffic_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
 	stats_wrapper "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/selector"
@@ -24,11 +34,25 @@ const (
 	MaxWeight uint8 = 0xff
 )
 
+const (
+	defaultAcceptBackoff = 100 * time.Millisecond
+	maxAcceptBackoff     = 10 * time.Second
+)
+
 type ConnectorOptions struct {
 	service string
 	sd      sd.SD
 	stats   *stats.Stats
-	limiter traffic.TrafficLimiter
+	// limiter returns the current traffic limiter of the handler,
+	// so the limiter swapped by UpdateOptions applies to the new visitors of the established connectors.
+	limiter func() traffic.TrafficLimiter
+	// datagram is the QUIC datagram session of the UDP connector,
+	// it is nil if the connector does not support datagrams.
+	datagram *quic_util.DatagramSession
+	// the retries of the failed accept before the connector is closed, none if not set,
+	// the backoff starts from acceptBackoff (100ms if not set) and doubles each retry.
+	acceptRetries int
+	acceptBackoff time.Duration
 }
 
 type Connector struct {
@@ -38,6 +62,12 @@ type Connector struct {
 	s    *mux.Session
 	t    time.Time
 	opts *ConnectorOptions
+	// drained is the time when the connector exceeds the max age,
+	// the draining connector is not selected for the new connections if possible.
+	drained atomic.Pointer[time.Time]
+	// backoff is set while the failed accept waits for the retry,
+	// the connector is not selected for the new connections then.
+	backoff atomic.Bool
 }
 
 func NewConnector(id relay.ConnectorID, tid relay.TunnelID, node string, s *mux.Session, opts *ConnectorOptions) *Connector {
@@ -58,9 +88,15 @@ func NewConnector(id relay.ConnectorID, tid relay.TunnelID, node string, s *mux.
 }
 
 func (c *Connector) accept() {
+	retries := 0
 	for {
 		conn, err := c.s.Accept()
 		if err != nil {
+			if c.retryAccept(err, retries) {
+				retries++
+				continue
+			}
+
 			logger.Default().Errorf("connector %s: %v", c.id, err)
 			c.s.Close()
 			if c.opts.sd != nil {
@@ -72,15 +108,55 @@ func (c *Connector) accept() {
 			}
 			return
 		}
+		retries = 0
 		conn.Close()
 	}
 }
 
+// retryAccept waits for the backoff of the failed accept, and reports whether the accept is retried.
+// Only the timeout and temporary errors are retried, the closed session can not recover.
+func (c *Connector) retryAccept(err error, retries int) bool {
+	var ne net.Error
+	if retries >= c.opts.acceptRetries || !errors.As(err, &ne) || !(ne.Timeout() || ne.Temporary()) || c.s.IsClosed() {
+		return false
+	}
+
+	backoff := c.acceptBackoff(retries)
+	logger.Default().Warnf("connector %s: %v, retry %d/%d in %v", c.id, err, retries+1, c.opts.acceptRetries, backoff)
+
+	c.backoff.Store(true)
+	defer c.backoff.Store(false)
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.s.CloseChan():
+		return false
+	}
+}
+
+func (c *Connector) acceptBackoff(retries int) time.Duration {
+	backoff := c.opts.acceptBackoff
+	if backoff <= 0 {
+		backoff = defaultAcceptBackoff
+	}
+	// the shift is bounded, so the backoff never overflows.
+	if retries > 16 {
+		return maxAcceptBackoff
+	}
+	return min(backoff<<retries, maxAcceptBackoff)
+}
+
 func (c *Connector) ID() relay.ConnectorID {
 	return c.id
 }
 
-func (c *Connector) GetConn() (net.Conn, error) {
+// GetConn opens a connection to the connector for a visitor.
+// The connection is limited by both the tunnel scoped limiter shared by all the visitors of the tunnel,
+// and the client scoped limiter of the visitor.
+func (c *Connector) GetConn(ctx context.Context) (net.Conn, error) {
 	if c == nil || c.s == nil {
 		return nil, nil
 	}
@@ -96,19 +172,67 @@ func (c *Connector) GetConn() (net.Conn, error) {
 	if c.id.IsUDP() {
 		network = "udp"
 	}
-	conn = traffic_wrapper.WrapConn(
-		conn,
-		c.opts.limiter,
-		c.tid.String(),
-		limiter.ScopeOption(limiter.ScopeClient),
-		limiter.ServiceOption(c.opts.service),
-		limiter.ClientOption(c.tid.String()),
-		limiter.NetworkOption(network),
-		limiter.SrcOption(conn.RemoteAddr().String()),
-	)
+	// the limiters of the tunnel and the visitor client apply together,
+	// the service limiter is applied by the listener of the service.
+	scopes := []traffic_wrapper.Scope{
+		{
+			Key: c.tid.String(),
+			Opts: []limiter.Option{
+				limiter.ScopeOption(xtraffic.ScopeTunnel),
+				limiter.ServiceOption(c.opts.service),
+				limiter.ClientOption(c.tid.String()),
+				limiter.NetworkOption(network),
+				limiter.SrcOption(conn.RemoteAddr().String()),
+			},
+		},
+	}
+	client := visitorClient(ctx)
+	if client != "" {
+		scopes = append(scopes, traffic_wrapper.Scope{
+			Key: client,
+			Opts: []limiter.Option{
+				limiter.ScopeOption(limiter.ScopeClient),
+				limiter.ServiceOption(c.opts.service),
+				limiter.ClientOption(client),
+				limiter.NetworkOption(network),
+				limiter.SrcOption(conn.RemoteAddr().String()),
+			},
+		})
+	}
+	tl := c.limiter()
+	conn = traffic_wrapper.WrapConnScopes(conn, tl, scopes...)
+
+	if c.opts.datagram != nil && c.id.IsUDP() {
+		conn = &datagramConn{
+			Conn:    conn,
+			session: c.opts.datagram,
+			c:       c,
+			client:  client,
+			limiter: tl,
+		}
+	}
 	return conn, nil
 }
 
+func (c *Connector) limiter() traffic.TrafficLimiter {
+	if c.opts.limiter == nil {
+		return nil
+	}
+	return c.opts.limiter()
+}
+
+// visitorClient returns the client ID of the visitor, or the visitor IP if not authenticated.
+func visitorClient(ctx context.Context) string {
+	if clientID := ctxvalue.ClientIDFromContext(ctx); clientID != "" {
+		return string(clientID)
+	}
+	addr := string(ctxvalue.ClientAddrFromContext(ctx))
+	if host, _, _ := net.SplitHostPort(addr); host != "" {
+		return host
+	}
+	return addr
+}
+
 func (c *Connector) Close() error {
 	if c == nil || c.s == nil {
 		return nil
@@ -125,6 +249,35 @@ func (c *Connector) IsClosed() bool {
 	return c.s.IsClosed()
 }
 
+// SessionInfo returns the parameters of the mux session of the connector,
+// the negotiated ones are read from the session as they are known only after the peer sends the frames.
+func (c *Connector) SessionInfo() mux.SessionInfo {
+	return c.s.Info()
+}
+
+// CreatedAt returns the time when the connector is bound.
+func (c *Connector) CreatedAt() time.Time {
+	return c.t
+}
+
+// NumConns returns the number of the active connections of the connector.
+func (c *Connector) NumConns() int {
+	if c == nil || c.s == nil {
+		return 0
+	}
+	return c.s.NumStreams()
+}
+
+// IsDraining reports whether the connector exceeds the max age and is waiting to be closed.
+func (c *Connector) IsDraining() bool {
+	return c != nil && c.drained.Load() != nil
+}
+
+// IsBackingOff reports whether the connector is waiting for the retry of the failed accept.
+func (c *Connector) IsBackingOff() bool {
+	return c != nil && c.backoff.Load()
+}
+
 type Tunnel struct {
 	node       string
 	id         relay.TunnelID
@@ -134,6 +287,21 @@ type Tunnel struct {
 	mu         sync.RWMutex
 	sd         sd.SD
 	ttl        time.Duration
+	// the max lifetime of the connectors, zero means no limit.
+	maxAge       time.Duration
+	drainTimeout time.Duration
+	conns        atomic.Int64
+	// the number of the connections retried on another connector, see ConnectorPool.Failover.
+	failovers atomic.Uint64
+	observer  observer.Observer
+	service   string
+	// the seed of the connector selection, see Tunnel.WithSeed.
+	seed         int64
+	seedByClient bool
+	rand         *rand.Rand
+	randMu       sync.Mutex
+	// the decay factor of the connector weights by the active connections, see Tunnel.WithDecay.
+	decay float64
 }
 
 func NewTunnel(node string, tid relay.TunnelID, ttl time.Duration) *Tunnel {
@@ -155,6 +323,92 @@ func (t *Tunnel) WithSD(sd sd.SD) {
 	t.sd = sd
 }
 
+// WithObserver sets the observer receiving the lifecycle events of the tunnel.
+func (t *Tunnel) WithObserver(observer observer.Observer, service string) {
+	t.observer = observer
+	t.service = service
+}
+
+// observe emits the lifecycle event of the tunnel asynchronously,
+// so the observer does not block the tunnel.
+func (t *Tunnel) observe(action event.TunnelAction, c *Connector) {
+	if t.observer == nil {
+		return
+	}
+	ev := t.event(action)
+	if c != nil {
+		ev.Connector = c.id.String()
+		info := c.SessionInfo()
+		ev.Session = &info
+	}
+	go t.observer.Observe(context.Background(), []observer.Event{ev})
+}
+
+func (t *Tunnel) event(action event.TunnelAction) event.TunnelEvent {
+	return event.TunnelEvent{
+		Kind:    "tunnel",
+		Service: t.service,
+		Action:  action,
+		Tunnel:  t.id.String(),
+		Node:    t.node,
+		Time:    time.Now(),
+	}
+}
+
+// failover counts the connection retried on another connector after the stream of the failed one failed.
+func (t *Tunnel) failover(failed relay.ConnectorID) {
+	n := t.failovers.Add(1)
+	if t.observer == nil {
+		return
+	}
+	ev := t.event(event.ConnectorFailover)
+	ev.Connector = failed.String()
+	ev.Failovers = n
+	go t.observer.Observe(context.Background(), []observer.Event{ev})
+}
+
+// Failovers returns the number of the connections of the tunnel retried on another connector
+// after the stream failed immediately.
+func (t *Tunnel) Failovers() uint64 {
+	return t.failovers.Load()
+}
+
+// WithMaxAge sets the max lifetime of the connectors.
+// The connector exceeding the max age is deregistered and drained,
+// then closed once it has no streams or the drain timeout is reached,
+// so the client is expected to reconnect.
+func (t *Tunnel) WithMaxAge(maxAge, drainTimeout time.Duration) {
+	t.maxAge = maxAge
+	t.drainTimeout = drainTimeout
+}
+
+// WithSeed makes the weighted random selection of the connectors reproducible.
+// With a non-zero seed, the selections are drawn from a random source with the seed.
+// If byClient is true, the source of each selection is seeded by the client address (and the seed),
+// so a client sticks to the same connector as long as the connectors are unchanged,
+// while the clients are still distributed by the weights.
+// By default the selection is fully random.
+func (t *Tunnel) WithSeed(seed int64, byClient bool) {
+	t.randMu.Lock()
+	defer t.randMu.Unlock()
+
+	t.seed = seed
+	t.seedByClient = byClient
+	t.rand = nil
+	if seed != 0 {
+		t.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithDecay makes the weights of the connectors decay as they accumulate the active connections,
+// so the hot connectors receive fewer new connections, see selector.RandomWeighted.WithDecay.
+func (t *Tunnel) WithDecay(decay float64) {
+	t.randMu.Lock()
+	defer t.randMu.Unlock()
+
+	t.decay = decay
+}
+
 func (t *Tunnel) ID() relay.TunnelID {
 	return t.id
 }
@@ -168,21 +422,78 @@ func (t *Tunnel) AddConnector(c *Connector) {
 	defer t.mu.Unlock()
 
 	t.connectors = append(t.connectors, c)
+	t.observe(event.ConnectorAdded, c)
 }
 
-func (t *Tunnel) GetConnector(network string) *Connector {
+// Connectors returns the connectors of the tunnel, including the closed ones not removed yet.
+func (t *Tunnel) Connectors() []*Connector {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 
-	if len(t.connectors) == 1 {
+	return append([]*Connector(nil), t.connectors...)
+}
+
+// CloseConnector forcibly closes the connector cid of the tunnel, the streams of the connector are aborted.
+// The connector is removed from the tunnel and deregistered from the sd immediately,
+// bypassing the deregistration delay.
+func (t *Tunnel) CloseConnector(cid string) error {
+	c := t.removeConnector(cid)
+	if c == nil {
+		return ErrConnectorNotFound
+	}
+
+	c.Close()
+	// the connector is deregistered out of the lock, a slow SD must not block the tunnel.
+	if t.sd != nil {
+		deregisterNow(t.sd, &sd.Service{
+			ID:   c.id.String(),
+			Name: t.id.String(),
+			Node: t.node,
+		})
+	}
+	logger.Default().Infof("tunnel: %s, connector: %s closed", t.id, c.id)
+	t.observe(event.ConnectorEvicted, c)
+	return nil
+}
+
+func (t *Tunnel) removeConnector(cid string) *Connector {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, c := range t.connectors {
+		if c.id.String() != cid {
+			continue
+		}
+		// the slice may be held by the readers, so it is not modified in place.
+		t.connectors = append(t.connectors[:i:i], t.connectors[i+1:]...)
+		return c
+	}
+	return nil
+}
+
+// GetConnector selects a connector of the tunnel for the network, the connectors in exclude are skipped.
+func (t *Tunnel) GetConnector(ctx context.Context, network string, exclude ...relay.ConnectorID) *Connector {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if len(t.connectors) == 1 && len(exclude) == 0 && !t.connectors[0].IsBackingOff() {
 		return t.connectors[0]
 	}
 
-	rw := selector.NewRandomWeighted[*Connector]()
+	// the draining connectors are used only if there is no other one.
+	draining := true
+	for _, c := range t.connectors {
+		if !c.IsClosed() && !c.IsDraining() && !c.IsBackingOff() {
+			draining = false
+			break
+		}
+	}
+
+	rw := t.newRandomWeighted(ctx)
 
 	found := false
 	for _, c := range t.connectors {
-		if c.IsClosed() {
+		if c.IsClosed() || c.IsBackingOff() || (!draining && c.IsDraining()) || isExcluded(c.id, exclude) {
 			continue
 		}
 
@@ -199,14 +510,108 @@ func (t *Tunnel) GetConnector(network string) *Connector {
 			}
 
 			if weight == MaxWeight || !found {
-				rw.Add(c, int(weight))
+				rw.AddWithLoad(c, int(weight), c.NumConns())
 			}
 		}
 	}
 
+	t.randMu.Lock()
+	defer t.randMu.Unlock()
+
 	return rw.Next()
 }
 
+// connector returns the connector cid of the tunnel for the network,
+// nil if it is not found, closed, draining or backing off.
+func (t *Tunnel) connector(network string, cid relay.ConnectorID) *Connector {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, c := range t.connectors {
+		if !c.id.Equal(cid) {
+			continue
+		}
+		if c.IsClosed() || c.IsDraining() || c.IsBackingOff() || (network == "udp") != c.id.IsUDP() {
+			return nil
+		}
+		return c
+	}
+	return nil
+}
+
+func isExcluded(cid relay.ConnectorID, exclude []relay.ConnectorID) bool {
+	for _, id := range exclude {
+		if id.Equal(cid) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Tunnel) newRandomWeighted(ctx context.Context) *selector.RandomWeighted[*Connector] {
+	t.randMu.Lock()
+	defer t.randMu.Unlock()
+
+	return t.newRandomWeightedLocked(ctx).WithDecay(t.decay)
+}
+
+func (t *Tunnel) newRandomWeightedLocked(ctx context.Context) *selector.RandomWeighted[*Connector] {
+	if t.seedByClient {
+		addr := string(ctxvalue.ClientAddrFromContext(ctx))
+		if host, _, _ := net.SplitHostPort(addr); host != "" {
+			addr = host
+		}
+		if addr != "" {
+			return selector.NewRandomWeightedWithHash[*Connector](clientHash(t.seed, addr))
+		}
+	}
+	if t.rand != nil {
+		return selector.NewRandomWeightedWithSource[*Connector](t.rand)
+	}
+	return selector.NewRandomWeighted[*Connector]()
+}
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// clientHash returns the FNV-1a hash of the seed and the client address,
+// it is computed in place as it runs on every connector selection.
+func clientHash(seed int64, addr string) uint64 {
+	h := uint64(fnvOffset64)
+	for i := 0; i < 8; i++ {
+		h ^= uint64(byte(seed >> (8 * i)))
+		h *= fnvPrime64
+	}
+	for i := 0; i < len(addr); i++ {
+		h ^= uint64(addr[i])
+		h *= fnvPrime64
+	}
+	return h
+}
+
+// AcquireConn reserves a slot for a relayed connection,
+// it returns false if the number of concurrent connections reaches the limit.
+// A limit less than or equal to zero means no limit.
+func (t *Tunnel) AcquireConn(limit int) bool {
+	if n := t.conns.Add(1); limit > 0 && n > int64(limit) {
+		t.conns.Add(-1)
+		return false
+	}
+	return true
+}
+
+// ReleaseConn releases the slot reserved by AcquireConn.
+func (t *Tunnel) ReleaseConn() {
+	t.conns.Add(-1)
+}
+
+// Conns returns the number of current relayed connections.
+func (t *Tunnel) Conns() int64 {
+	return t.conns.Load()
+}
+
 func (t *Tunnel) Close() error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -252,8 +657,12 @@ func (t *Tunnel) clean() {
 			}
 			var connectors []*Connector
 			for _, c := range t.connectors {
+				if t.expire(c) {
+					c.Close()
+				}
 				if c.IsClosed() {
 					logger.Default().Debugf("remove tunnel: %s, connector: %s", t.id, c.id)
+					t.observe(event.ConnectorEvicted, c)
 					if t.sd != nil {
 						t.sd.Deregister(context.Background(), &sd.Service{
 							ID:   c.id.String(),
@@ -265,7 +674,7 @@ func (t *Tunnel) clean() {
 				}
 
 				connectors = append(connectors, c)
-				if t.sd != nil {
+				if t.sd != nil && !c.IsDraining() {
 					t.sd.Renew(context.Background(), &sd.Service{
 						ID:   c.id.String(),
 						Name: t.id.String(),
@@ -283,11 +692,52 @@ func (t *Tunnel) clean() {
 	}
 }
 
+// expire checks the age of the connector, it reports whether the draining connector should be closed.
+func (t *Tunnel) expire(c *Connector) bool {
+	if t.maxAge <= 0 || c.IsClosed() {
+		return false
+	}
+
+	now := time.Now()
+	if drained := c.drained.Load(); drained != nil {
+		return c.s.NumStreams() == 0 || now.Sub(*drained) >= t.drainTimeout
+	}
+	if now.Sub(c.t) < t.maxAge {
+		return false
+	}
+
+	c.drained.Store(&now)
+	logger.Default().Debugf("tunnel: %s, connector: %s exceeds the max age %s, draining", t.id, c.id, t.maxAge)
+	if t.sd != nil {
+		t.sd.Deregister(context.Background(), &sd.Service{
+			ID:   c.id.String(),
+			Name: t.id.String(),
+			Node: t.node,
+		})
+	}
+	return c.s.NumStreams() == 0
+}
+
 type ConnectorPool struct {
 	node    string
 	sd      sd.SD
 	tunnels map[string]*Tunnel
 	mu      sync.RWMutex
+	// the max lifetime of the connectors, see Tunnel.WithMaxAge.
+	maxAge       time.Duration
+	drainTimeout time.Duration
+	observer     observer.Observer
+	service      string
+	// the seed of the connector selection, see Tunnel.WithSeed.
+	seed         int64
+	seedByClient bool
+	// the decay factor of the connector weights, see Tunnel.WithDecay.
+	decay float64
+	// the number of requests that got a connector by waiting, or timed out.
+	waitSaved   atomic.Uint64
+	waitTimeout atomic.Uint64
+	// the number of connections retried on another connector after the stream failed immediately.
+	failovers atomic.Uint64
 }
 
 func NewConnectorPool(node string, sd sd.SD) *ConnectorPool {
@@ -310,13 +760,41 @@ func (p *ConnectorPool) Add(tid relay.TunnelID, c *Connector, ttl time.Duration)
 	if t == nil {
 		t = NewTunnel(p.node, tid, ttl)
 		t.WithSD(p.sd)
+		t.WithMaxAge(p.maxAge, p.drainTimeout)
+		t.WithObserver(p.observer, p.service)
+		t.WithSeed(p.seed, p.seedByClient)
+		t.WithDecay(p.decay)
+		t.observe(event.TunnelCreated, nil)
 
 		p.tunnels[s] = t
 	}
 	t.AddConnector(c)
 }
 
-func (p *ConnectorPool) Get(network string, tid string) *Connector {
+// WithObserver sets the observer receiving the lifecycle events of the tunnels added afterwards.
+func (p *ConnectorPool) WithObserver(observer observer.Observer, service string) {
+	p.observer = observer
+	p.service = service
+}
+
+// WithMaxAge sets the max lifetime of the connectors of the tunnels added afterwards.
+func (p *ConnectorPool) WithMaxAge(maxAge, drainTimeout time.Duration) {
+	p.maxAge = maxAge
+	p.drainTimeout = drainTimeout
+}
+
+// WithSeed sets the seed of the connector selection of the tunnels added afterwards.
+func (p *ConnectorPool) WithSeed(seed int64, byClient bool) {
+	p.seed = seed
+	p.seedByClient = byClient
+}
+
+// WithDecay sets the decay factor of the connector weights of the tunnels added afterwards.
+func (p *ConnectorPool) WithDecay(decay float64) {
+	p.decay = decay
+}
+
+func (p *ConnectorPool) Get(ctx context.Context, network string, tid string, exclude ...relay.ConnectorID) *Connector {
 	if p == nil {
 		return nil
 	}
@@ -329,7 +807,97 @@ func (p *ConnectorPool) Get(network string, tid string) *Connector {
 		return nil
 	}
 
-	return t.GetConnector(network)
+	return t.GetConnector(ctx, network, exclude...)
+}
+
+// Tunnel returns the tunnel for the tunnel ID tid,
+// nil is returned if the tunnel is not registered on this node.
+func (p *ConnectorPool) Tunnel(tid string) *Tunnel {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.tunnels[tid]
+}
+
+// Failovers returns the number of the connections retried on another connector
+// after the stream failed immediately.
+func (p *ConnectorPool) Failovers() uint64 {
+	if p == nil {
+		return 0
+	}
+	return p.failovers.Load()
+}
+
+// Failover counts the connection to the tunnel retried on another connector after the stream of the failed one failed,
+// in the pool, the tunnel and the metrics, it returns the number of the failovers of the pool.
+func (p *ConnectorPool) Failover(tid string, failed relay.ConnectorID) uint64 {
+	if p == nil {
+		return 0
+	}
+
+	if t := p.Tunnel(tid); t != nil {
+		t.failover(failed)
+	}
+	if v := xmetrics.GetCounter(xmetrics.MetricServiceTunnelFailoversCounter,
+		metrics.Labels{"service": p.service}); v != nil {
+		v.Inc()
+	}
+	return p.failovers.Add(1)
+}
+
+// Tunnels returns the tunnels registered on this node.
+func (p *ConnectorPool) Tunnels() []*Tunnel {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	tunnels := make([]*Tunnel, 0, len(p.tunnels))
+	for _, t := range p.tunnels {
+		tunnels = append(tunnels, t)
+	}
+	return tunnels
+}
+
+// CloseConnector forcibly closes the connector cid of the tunnel tid, see Tunnel.CloseConnector.
+func (p *ConnectorPool) CloseConnector(tid string, cid string) error {
+	t := p.Tunnel(tid)
+	if t == nil {
+		return ErrTunnelNotFound
+	}
+	return t.CloseConnector(cid)
+}
+
+// CloseTunnel forcibly closes the tunnel tid with all its connectors and removes it from the pool,
+// the connectors are deregistered from the sd immediately.
+// The client may bind the tunnel again, which is rejected by the admission or auth rather than here.
+func (p *ConnectorPool) CloseTunnel(tid string) error {
+	if p == nil {
+		return ErrTunnelNotFound
+	}
+
+	p.mu.Lock()
+	t := p.tunnels[tid]
+	delete(p.tunnels, tid)
+	p.mu.Unlock()
+
+	if t == nil {
+		return ErrTunnelNotFound
+	}
+
+	for _, c := range t.Connectors() {
+		t.CloseConnector(c.id.String())
+	}
+	t.Close()
+	t.observe(event.TunnelRemoved, nil)
+
+	return nil
 }
 
 func (p *ConnectorPool) Close() error {
@@ -358,6 +926,7 @@ func (p *ConnectorPool) closeIdles() {
 			if v.CloseOnIdle() {
 				delete(p.tunnels, k)
 				logger.Default().Debugf("remove idle tunnel: %s", k)
+				v.observe(event.TunnelRemoved, nil)
 			}
 		}
 		p.mu.Unlock()
@@ -0,0 +1,79 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/go-gost/relay"
+	ctxvalue "github.com/go-gost/x/ctx"
+	"github.com/go-gost/x/internal/util/mux"
+	"github.com/google/uuid"
+)
+
+func TestClientHash(t *testing.T) {
+	tests := []struct {
+		seed int64
+		addr string
+	}{
+		{seed: 0, addr: "192.168.1.1"},
+		{seed: 1, addr: "192.168.1.1"},
+		{seed: -42, addr: "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		h := fnv.New64a()
+		binary.Write(h, binary.LittleEndian, tt.seed)
+		h.Write([]byte(tt.addr))
+		if got, want := clientHash(tt.seed, tt.addr), h.Sum64(); got != want {
+			t.Errorf("clientHash(%d, %s): got %x, want %x", tt.seed, tt.addr, got, want)
+		}
+	}
+
+	if n := testing.AllocsPerRun(100, func() { clientHash(1, "192.168.1.1") }); n != 0 {
+		t.Errorf("clientHash allocates %v times", n)
+	}
+}
+
+func TestGetConnectorSeedByClient(t *testing.T) {
+	tid := uuid.New()
+	tunnel := NewTunnel("node", relay.NewTunnelID(tid[:]), 0)
+	defer tunnel.Close()
+	tunnel.WithSeed(42, true)
+
+	for i := 0; i < 4; i++ {
+		sc, cc := net.Pipe()
+		defer cc.Close()
+		session, err := mux.ServerSession(sc, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cid := uuid.New()
+		tunnel.AddConnector(NewConnector(relay.NewConnectorID(cid[:]), tunnel.ID(), "node", session, nil))
+	}
+
+	picked := map[string]bool{}
+	for i := 0; i < 32; i++ {
+		client := net.IPv4(10, 0, 0, byte(i)).String()
+		ctx := ctxvalue.ContextWithClientAddr(context.Background(), ctxvalue.ClientAddr(client+":1234"))
+
+		c := tunnel.GetConnector(ctx, "tcp")
+		if c == nil {
+			t.Fatalf("client %s: no connector", client)
+		}
+		// the client sticks to the connector regardless of the port.
+		for port := 0; port < 4; port++ {
+			ctx := ctxvalue.ContextWithClientAddr(context.Background(), ctxvalue.ClientAddr(net.JoinHostPort(client, strconv.Itoa(2000+port))))
+			if cc := tunnel.GetConnector(ctx, "tcp"); cc != c {
+				t.Fatalf("client %s: picked %s, then %s", client, c.ID(), cc.ID())
+			}
+		}
+		picked[c.ID().String()] = true
+	}
+	if len(picked) < 2 {
+		t.Errorf("the clients are routed to %d connectors only", len(picked))
+	}
+}
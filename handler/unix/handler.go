@@ -13,11 +13,13 @@ import (
 	"github.com/go-gost/core/logger"
 	md "github.com/go-gost/core/metadata"
 	xnet "github.com/go-gost/x/internal/net"
+	mdx "github.com/go-gost/x/metadata"
 	"github.com/go-gost/x/registry"
 )
 
 func init() {
 	registry.HandlerRegistry().Register("unix", NewHandler)
+	mdx.RegisterSchema(mdx.SchemaHandler, "unix")
 }
 
 type unixHandler struct {
@@ -0,0 +1,117 @@
+package ingress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/go-gost/core/ingress"
+)
+
+// AccessController is an optional interface of the Ingress,
+// it controls the access to the rules by the visitor's source address.
+type AccessController interface {
+	// Allowed reports whether the visitor with the source address addr can access the rule.
+	// The second return value reports whether the rule has an access control list.
+	Allowed(ctx context.Context, rule *ingress.Rule, addr net.Addr) (allowed bool, matched bool)
+}
+
+var (
+	ErrInvalidCIDR = errors.New("invalid CIDR or IP address")
+)
+
+// ACL is the access control list of an ingress rule.
+// The deny list is evaluated first, then the visitor is allowed
+// if the allow list is empty or contains the source address.
+type ACL struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// NewACL creates an ACL from the lists of CIDRs or IP addresses.
+// Any invalid entry fails the whole ACL, as dropping it could leave
+// an empty allow list which admits every visitor.
+// It returns nil if both lists are empty.
+func NewACL(allow, deny []string) (*ACL, error) {
+	allowNets, err := parseCIDRs(allow)
+	if err != nil {
+		return nil, fmt.Errorf("allow: %w", err)
+	}
+	denyNets, err := parseCIDRs(deny)
+	if err != nil {
+		return nil, fmt.Errorf("deny: %w", err)
+	}
+	if len(allowNets) == 0 && len(denyNets) == 0 {
+		return nil, nil
+	}
+	return &ACL{
+		allow: allowNets,
+		deny:  denyNets,
+	}, nil
+}
+
+func (acl *ACL) Allowed(ip net.IP) bool {
+	if acl == nil {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range acl.deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(acl.allow) == 0 {
+		return true
+	}
+	for _, n := range acl.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCIDRs(ss []string) (nets []*net.IPNet, err error) {
+	for _, s := range ss {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if _, n, err := net.ParseCIDR(s); err == nil {
+			nets = append(nets, n)
+			continue
+		}
+		if ip := net.ParseIP(s); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		return nil, fmt.Errorf("%w: %q", ErrInvalidCIDR, s)
+	}
+	return
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch v := addr.(type) {
+	case *net.TCPAddr:
+		return v.IP
+	case *net.UDPAddr:
+		return v.IP
+	}
+	if addr == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
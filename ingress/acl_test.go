@@ -0,0 +1,74 @@
+package ingress
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	xlogger "github.com/go-gost/x/logger"
+)
+
+func TestNewACL(t *testing.T) {
+	tests := []struct {
+		name    string
+		allow   []string
+		deny    []string
+		nilACL  bool
+		err     error
+		allowed map[string]bool
+	}{
+		{name: "empty", nilACL: true},
+		{name: "blank entries", allow: []string{" ", ""}, nilACL: true},
+		{
+			name:    "allow",
+			allow:   []string{"10.0.0.0/8", "192.168.1.1"},
+			allowed: map[string]bool{"10.1.2.3": true, "192.168.1.1": true, "192.168.1.2": false},
+		},
+		{
+			name:    "deny first",
+			allow:   []string{"10.0.0.0/8"},
+			deny:    []string{"10.0.0.1"},
+			allowed: map[string]bool{"10.0.0.1": false, "10.0.0.2": true},
+		},
+		{name: "invalid allow", allow: []string{"10.0.0.0/33"}, err: ErrInvalidCIDR},
+		{name: "all allow invalid", allow: []string{"10.0.0.O/8", "localhost"}, err: ErrInvalidCIDR},
+		{name: "one allow invalid", allow: []string{"10.0.0.0/8", "10.0.0.256"}, err: ErrInvalidCIDR},
+		{name: "invalid deny", deny: []string{"example.com"}, err: ErrInvalidCIDR},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acl, err := NewACL(tt.allow, tt.deny)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if acl != nil {
+					t.Error("got an ACL with the error")
+				}
+				return
+			}
+			if (acl == nil) != tt.nilACL {
+				t.Fatalf("got ACL %v, want nil %v", acl, tt.nilACL)
+			}
+			for ip, want := range tt.allowed {
+				if got := acl.Allowed(net.ParseIP(ip)); got != want {
+					t.Errorf("%s: got allowed %v, want %v", ip, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseLineInvalidACL(t *testing.T) {
+	ing := NewIngress(LoggerOption(xlogger.Nop())).(*localIngress)
+	defer ing.Close()
+
+	if e := ing.parseLine("example.com 192.168.1.1:80 allow=10.0.0.O/8"); e != nil {
+		t.Errorf("got rule %v, want rejected", e.rule)
+	}
+	e := ing.parseLine("example.com 192.168.1.1:80 allow=10.0.0.0/8")
+	if e == nil || e.acl == nil {
+		t.Fatal("got no rule or ACL")
+	}
+}
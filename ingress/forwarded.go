@@ -0,0 +1,114 @@
+package ingress
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-gost/core/ingress"
+)
+
+const (
+	HeaderXForwardedFor   = "X-Forwarded-For"
+	HeaderXForwardedProto = "X-Forwarded-Proto"
+	HeaderXForwardedHost  = "X-Forwarded-Host"
+	HeaderXRealIP         = "X-Real-Ip"
+)
+
+// ForwardedController is an optional interface of the Ingress,
+// it returns the forwarded headers of the HTTP requests of the visitors to the rule.
+type ForwardedController interface {
+	// Forwarded returns the forwarded headers of the rule, nil if none.
+	Forwarded(ctx context.Context, rule *ingress.Rule) *Forwarded
+}
+
+// Forwarded is the reverse proxy style headers set on the HTTP requests of the visitors
+// forwarded into the tunnel of an ingress rule, so the applications behind the tunnel
+// see the visitor's IP and scheme.
+//
+// X-Forwarded-For is appended with the visitor's IP, and the other headers are set
+// unless they are supplied by the visitor. With Strip, all the four headers supplied by the visitor
+// are removed first, including the ones not set by the rule, as the entrypoint is the trust boundary.
+type Forwarded struct {
+	headers []string
+	strip   bool
+}
+
+// NewForwarded creates the forwarded headers from the header names,
+// any of X-Forwarded-For, X-Forwarded-Proto, X-Forwarded-Host and X-Real-IP, or all for all of them.
+// The unknown names are ignored. It returns nil if there is no header.
+func NewForwarded(headers []string, strip bool) *Forwarded {
+	f := &Forwarded{
+		strip: strip,
+	}
+	for _, s := range headers {
+		s = http.CanonicalHeaderKey(strings.TrimSpace(s))
+		switch s {
+		case "All":
+			f.headers = []string{HeaderXForwardedFor, HeaderXForwardedProto, HeaderXForwardedHost, HeaderXRealIP}
+			return f
+		case HeaderXForwardedFor, HeaderXForwardedProto, HeaderXForwardedHost, HeaderXRealIP:
+			f.headers = append(f.headers, s)
+		}
+	}
+	if len(f.headers) == 0 {
+		return nil
+	}
+	return f
+}
+
+// Strip reports whether the values supplied by the visitor are removed.
+func (f *Forwarded) Strip() bool {
+	return f != nil && f.strip
+}
+
+// Apply sets the headers of the request from the visitor with the address clientAddr,
+// the visitor's address is the source of the PROXY protocol if it is enabled on the entrypoint.
+// The request read from the connection carries no TLS state, secure reports whether the visitor
+// connected over TLS, to the entrypoint or to the load balancer in front of it.
+func (f *Forwarded) Apply(req *http.Request, clientAddr net.Addr, secure bool) {
+	if f == nil || req == nil {
+		return
+	}
+
+	ip := addrIP(clientAddr)
+	proto := "http"
+	if secure || req.TLS != nil {
+		proto = "https"
+	}
+
+	if f.strip {
+		for _, k := range []string{HeaderXForwardedFor, HeaderXForwardedProto, HeaderXForwardedHost, HeaderXRealIP} {
+			req.Header.Del(k)
+		}
+	}
+
+	for _, k := range f.headers {
+		switch k {
+		case HeaderXForwardedFor:
+			if ip == nil {
+				continue
+			}
+			v := ip.String()
+			if prior := req.Header.Values(k); len(prior) > 0 {
+				v = strings.Join(prior, ", ") + ", " + v
+			}
+			req.Header.Set(k, v)
+		case HeaderXForwardedProto:
+			setDefault(req.Header, k, proto)
+		case HeaderXForwardedHost:
+			setDefault(req.Header, k, req.Host)
+		case HeaderXRealIP:
+			if ip != nil {
+				setDefault(req.Header, k, ip.String())
+			}
+		}
+	}
+}
+
+func setDefault(header http.Header, key, value string) {
+	if value != "" && header.Get(key) == "" {
+		header.Set(key, value)
+	}
+}
@@ -0,0 +1,201 @@
+package ingress
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gost/x/internal/net/proxyproto"
+	pp "github.com/pires/go-proxyproto"
+	"github.com/pires/go-proxyproto/tlvparse"
+)
+
+const testRequest = "GET / HTTP/1.1\r\n" +
+	"Host: example.com\r\n" +
+	"X-Forwarded-For: 10.0.0.1\r\n" +
+	"X-Forwarded-Proto: https\r\n" +
+	"X-Forwarded-Host: evil.com\r\n" +
+	"X-Real-Ip: 10.0.0.1\r\n" +
+	"\r\n"
+
+// accept reads the request of the visitor through the listener of the entrypoint,
+// with the PROXY protocol header sent first if header is not nil.
+func accept(t *testing.T, header *pp.Header) (*http.Request, net.Conn) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	ppv := 0
+	if header != nil {
+		ppv = int(header.Version)
+	}
+	ln = proxyproto.WrapPeerListener(proxyproto.WrapListener(ppv, ln, 5*time.Second))
+
+	go func() {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		if header != nil {
+			if _, err := header.WriteTo(c); err != nil {
+				return
+			}
+		}
+		c.Write([]byte(testRequest))
+		c.Read(make([]byte, 1))
+	}()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req, conn
+}
+
+func sslHeader(t *testing.T, src, dst net.Addr, ssl bool) *pp.Header {
+	t.Helper()
+
+	h := pp.HeaderProxyFromAddrs(2, src, dst)
+	if ssl {
+		tlv, err := tlvparse.PP2SSL{
+			Client: tlvparse.PP2_BITFIELD_CLIENT_SSL,
+			TLV:    []pp.TLV{{Type: pp.PP2_SUBTYPE_SSL_VERSION, Value: []byte("TLSv1.3")}},
+		}.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := h.SetTLVs([]pp.TLV{tlv}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return h
+}
+
+func TestForwardedApply(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 40000}
+	dst := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 80}
+
+	tests := []struct {
+		name    string
+		headers []string
+		strip   bool
+		header  *pp.Header
+		want    map[string]string
+	}{
+		{
+			name:    "direct",
+			headers: []string{"all"},
+			want: map[string]string{
+				HeaderXForwardedFor:   "10.0.0.1, 127.0.0.1",
+				HeaderXForwardedProto: "https",
+				HeaderXForwardedHost:  "evil.com",
+				HeaderXRealIP:         "10.0.0.1",
+			},
+		},
+		{
+			name:    "direct strip",
+			headers: []string{"all"},
+			strip:   true,
+			want: map[string]string{
+				HeaderXForwardedFor:   "127.0.0.1",
+				HeaderXForwardedProto: "http",
+				HeaderXForwardedHost:  "example.com",
+				HeaderXRealIP:         "127.0.0.1",
+			},
+		},
+		{
+			// the headers not set by the rule are stripped too.
+			name:    "direct strip partial",
+			headers: []string{"X-Forwarded-For"},
+			strip:   true,
+			want: map[string]string{
+				HeaderXForwardedFor: "127.0.0.1",
+			},
+		},
+		{
+			name:    "proxy protocol strip",
+			headers: []string{"all"},
+			strip:   true,
+			header:  sslHeader(t, src, dst, false),
+			want: map[string]string{
+				HeaderXForwardedFor:   "203.0.113.7",
+				HeaderXForwardedProto: "http",
+				HeaderXForwardedHost:  "example.com",
+				HeaderXRealIP:         "203.0.113.7",
+			},
+		},
+		{
+			name:    "proxy protocol ssl strip",
+			headers: []string{"all"},
+			strip:   true,
+			header:  sslHeader(t, src, dst, true),
+			want: map[string]string{
+				HeaderXForwardedFor:   "203.0.113.7",
+				HeaderXForwardedProto: "https",
+				HeaderXForwardedHost:  "example.com",
+				HeaderXRealIP:         "203.0.113.7",
+			},
+		},
+		{
+			name:    "proxy protocol v1",
+			headers: []string{"X-Forwarded-For", "X-Real-IP"},
+			header:  pp.HeaderProxyFromAddrs(1, src, dst),
+			want: map[string]string{
+				HeaderXForwardedFor:   "10.0.0.1, 203.0.113.7",
+				HeaderXForwardedProto: "https",
+				HeaderXForwardedHost:  "evil.com",
+				HeaderXRealIP:         "10.0.0.1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewForwarded(tt.headers, tt.strip)
+			if f == nil {
+				t.Fatal("no forwarded headers")
+			}
+
+			req, conn := accept(t, tt.header)
+			f.Apply(req, conn.RemoteAddr(), proxyproto.ClientSSL(conn))
+
+			for _, k := range []string{HeaderXForwardedFor, HeaderXForwardedProto, HeaderXForwardedHost, HeaderXRealIP} {
+				if got := strings.Join(req.Header.Values(k), ", "); got != tt.want[k] {
+					t.Errorf("%s: got %q, want %q", k, got, tt.want[k])
+				}
+			}
+		})
+	}
+}
+
+func TestForwardedApplySecure(t *testing.T) {
+	f := NewForwarded([]string{"X-Forwarded-Proto"}, false)
+
+	for _, secure := range []bool{false, true} {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		f.Apply(req, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}, secure)
+
+		want := "http"
+		if secure {
+			want = "https"
+		}
+		if got := req.Header.Get(HeaderXForwardedProto); got != want {
+			t.Errorf("secure %v: got %q, want %q", secure, got, want)
+		}
+	}
+}
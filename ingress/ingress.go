@@ -5,6 +5,7 @@ import (
 	"context"
 	"io"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -16,6 +17,8 @@ import (
 
 type options struct {
 	rules       []*ingress.Rule
+	acls        map[string]*ACL
+	forwarded   map[string]*Forwarded
 	fileLoader  loader.Loader
 	redisLoader loader.Loader
 	httpLoader  loader.Loader
@@ -31,6 +34,20 @@ func RulesOption(rules []*ingress.Rule) Option {
 	}
 }
 
+// ACLsOption sets the access control lists of the rules, keyed by the hostname of the rule.
+func ACLsOption(acls map[string]*ACL) Option {
+	return func(opts *options) {
+		opts.acls = acls
+	}
+}
+
+// ForwardedOption sets the forwarded headers of the rules, keyed by the hostname of the rule.
+func ForwardedOption(forwarded map[string]*Forwarded) Option {
+	return func(opts *options) {
+		opts.forwarded = forwarded
+	}
+}
+
 func ReloadPeriodOption(period time.Duration) Option {
 	return func(opts *options) {
 		opts.period = period
@@ -61,8 +78,14 @@ func LoggerOption(logger logger.Logger) Option {
 	}
 }
 
+type ruleEntry struct {
+	rule      *ingress.Rule
+	acl       *ACL
+	forwarded *Forwarded
+}
+
 type localIngress struct {
-	rules      map[string]*ingress.Rule
+	rules      map[string]*ruleEntry
 	cancelFunc context.CancelFunc
 	options    options
 	mu         sync.RWMutex
@@ -114,29 +137,30 @@ func (ing *localIngress) periodReload(ctx context.Context) error {
 }
 
 func (ing *localIngress) reload(ctx context.Context) error {
-	rules := make(map[string]*ingress.Rule)
+	rules := make(map[string]*ruleEntry)
 
-	fn := func(rule *ingress.Rule) {
-		if rule.Hostname == "" || rule.Endpoint == "" {
+	fn := func(e *ruleEntry) {
+		if e == nil || e.rule == nil ||
+			e.rule.Hostname == "" || e.rule.Endpoint == "" {
 			return
 		}
-		host := rule.Hostname
-		if host[0] == '*' {
-			host = host[1:]
-		}
-		rules[host] = rule
+		rules[ruleKey(e.rule.Hostname)] = e
 	}
 
 	for _, rule := range ing.options.rules {
-		fn(rule)
+		fn(&ruleEntry{
+			rule:      rule,
+			acl:       ing.options.acls[rule.Hostname],
+			forwarded: ing.options.forwarded[rule.Hostname],
+		})
 	}
 
 	v, err := ing.load(ctx)
 	if err != nil {
 		return err
 	}
-	for _, rule := range v {
-		fn(rule)
+	for _, e := range v {
+		fn(e)
 	}
 
 	ing.options.logger.Debugf("load items %d", len(rules))
@@ -149,7 +173,7 @@ func (ing *localIngress) reload(ctx context.Context) error {
 	return nil
 }
 
-func (ing *localIngress) load(ctx context.Context) (rules []*ingress.Rule, err error) {
+func (ing *localIngress) load(ctx context.Context) (rules []*ruleEntry, err error) {
 	if ing.options.fileLoader != nil {
 		if lister, ok := ing.options.fileLoader.(loader.Lister); ok {
 			list, er := lister.List(ctx)
@@ -199,15 +223,15 @@ func (ing *localIngress) load(ctx context.Context) (rules []*ingress.Rule, err e
 	return
 }
 
-func (ing *localIngress) parseRules(r io.Reader) (rules []*ingress.Rule, err error) {
+func (ing *localIngress) parseRules(r io.Reader) (rules []*ruleEntry, err error) {
 	if r == nil {
 		return
 	}
 
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
-		if rule := ing.parseLine(scanner.Text()); rule.Hostname != "" {
-			rules = append(rules, rule)
+		if e := ing.parseLine(scanner.Text()); e != nil {
+			rules = append(rules, e)
 		}
 	}
 
@@ -244,18 +268,44 @@ func (ing *localIngress) GetRule(ctx context.Context, host string, opts ...ingre
 		}
 	}
 
-	if ep != nil {
-		ing.options.logger.Debugf("ingress: %s -> %s:%s", host, ep.Hostname, ep.Endpoint)
+	if ep == nil {
+		return nil
 	}
+	ing.options.logger.Debugf("ingress: %s -> %s:%s", host, ep.rule.Hostname, ep.rule.Endpoint)
 
-	return ep
+	return ep.rule
+}
+
+// Allowed implements AccessController.
+func (ing *localIngress) Allowed(ctx context.Context, rule *ingress.Rule, addr net.Addr) (allowed bool, matched bool) {
+	if ing == nil || rule == nil {
+		return true, false
+	}
+
+	e := ing.lookup(ruleKey(rule.Hostname))
+	if e == nil || e.acl == nil {
+		return true, false
+	}
+	return e.acl.Allowed(addrIP(addr)), true
+}
+
+// Forwarded implements ForwardedController.
+func (ing *localIngress) Forwarded(ctx context.Context, rule *ingress.Rule) *Forwarded {
+	if ing == nil || rule == nil {
+		return nil
+	}
+
+	if e := ing.lookup(ruleKey(rule.Hostname)); e != nil {
+		return e.forwarded
+	}
+	return nil
 }
 
 func (ing *localIngress) SetRule(ctx context.Context, rule *ingress.Rule, opts ...ingress.Option) bool {
 	return false
 }
 
-func (ing *localIngress) lookup(host string) *ingress.Rule {
+func (ing *localIngress) lookup(host string) *ruleEntry {
 	if ing == nil {
 		return nil
 	}
@@ -266,7 +316,10 @@ func (ing *localIngress) lookup(host string) *ingress.Rule {
 	return ing.rules[host]
 }
 
-func (ing *localIngress) parseLine(s string) (rule *ingress.Rule) {
+// parseLine parses a rule in the format:
+//
+//	hostname endpoint [allow=cidr[,cidr...]] [deny=cidr[,cidr...]] [forwarded=header[,header...]] [forwarded.strip=true]
+func (ing *localIngress) parseLine(s string) *ruleEntry {
 	line := strings.Replace(s, "\t", " ", -1)
 	line = strings.TrimSpace(line)
 	if n := strings.IndexByte(line, '#'); n >= 0 {
@@ -279,13 +332,47 @@ func (ing *localIngress) parseLine(s string) (rule *ingress.Rule) {
 		}
 	}
 	if len(sp) < 2 {
-		return // invalid lines are ignored
+		return nil // invalid lines are ignored
+	}
+
+	var allow, deny, forwarded []string
+	var strip bool
+	for _, s := range sp[2:] {
+		k, v, _ := strings.Cut(s, "=")
+		switch k {
+		case "allow":
+			allow = append(allow, strings.Split(v, ",")...)
+		case "deny":
+			deny = append(deny, strings.Split(v, ",")...)
+		case "forwarded":
+			forwarded = append(forwarded, strings.Split(v, ",")...)
+		case "forwarded.strip":
+			strip, _ = strconv.ParseBool(v)
+		}
+	}
+
+	acl, err := NewACL(allow, deny)
+	if err != nil {
+		// the rule is rejected rather than loaded without its access control.
+		ing.options.logger.Warnf("rule %s: %v", sp[0], err)
+		return nil
+	}
+
+	return &ruleEntry{
+		rule: &ingress.Rule{
+			Hostname: sp[0],
+			Endpoint: sp[1],
+		},
+		acl:       acl,
+		forwarded: NewForwarded(forwarded, strip),
 	}
+}
 
-	return &ingress.Rule{
-		Hostname: sp[0],
-		Endpoint: sp[1],
+func ruleKey(hostname string) string {
+	if hostname != "" && hostname[0] == '*' {
+		return hostname[1:]
 	}
+	return hostname
 }
 
 func (ing *localIngress) Close() error {
@@ -0,0 +1,91 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrVetoed = errors.New("interceptor: request vetoed")
+)
+
+// Request is the request of the connection seen by the interceptors.
+type Request struct {
+	Service string
+	// Handler is the type of the handler, such as socks5 or http2.
+	Handler  string
+	Network  string
+	Src      string
+	Dst      string
+	ClientID string
+	// Annotations are the fields added by the interceptors, they are attached to the log of the request.
+	Annotations map[string]any
+}
+
+// Annotate adds the field to the annotations of the request.
+func (r *Request) Annotate(key string, value any) {
+	if r.Annotations == nil {
+		r.Annotations = make(map[string]any)
+	}
+	r.Annotations[key] = value
+}
+
+// Interceptor runs around the handling of the request.
+type Interceptor interface {
+	// Before is called before the request is handled, the request is vetoed if an error is returned.
+	Before(ctx context.Context, req *Request) error
+	// After is called after the request is handled, err is the error of the handling or the veto.
+	After(ctx context.Context, req *Request, err error)
+}
+
+// Chain is the ordered interceptors, the nil Chain intercepts nothing.
+type Chain struct {
+	interceptors []Interceptor
+}
+
+func NewChain(interceptors ...Interceptor) *Chain {
+	var c Chain
+	for _, v := range interceptors {
+		if v != nil {
+			c.interceptors = append(c.interceptors, v)
+		}
+	}
+	if len(c.interceptors) == 0 {
+		return nil
+	}
+	return &c
+}
+
+// Before calls Before of the interceptors in order, and stops at the first veto.
+// The returned function calls After of the interceptors passed in reverse order,
+// it must be called once the request is handled, with the error of the handling.
+func (c *Chain) Before(ctx context.Context, req *Request) (after func(err error), err error) {
+	after = func(error) {}
+	if c == nil {
+		return
+	}
+
+	n := 0
+	for _, v := range c.interceptors {
+		if err = v.Before(ctx, req); err != nil {
+			break
+		}
+		n++
+	}
+
+	passed := c.interceptors[:n]
+	after = func(err error) {
+		for i := len(passed) - 1; i >= 0; i-- {
+			passed[i].After(ctx, req, err)
+		}
+	}
+	if err != nil {
+		after(err)
+		after = func(error) {}
+		if !errors.Is(err, ErrVetoed) {
+			err = fmt.Errorf("%w: %w", ErrVetoed, err)
+		}
+	}
+	return
+}
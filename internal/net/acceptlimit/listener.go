@@ -0,0 +1,68 @@
+package acceptlimit
+
+import (
+	"math"
+	"net"
+	"time"
+
+	"github.com/go-gost/core/metrics"
+	xmetrics "github.com/go-gost/x/metrics"
+	"golang.org/x/time/rate"
+)
+
+type Options struct {
+	// Rate is the max connections accepted per second, zero means no limit.
+	Rate float64
+	// Burst is the max connections accepted at once, it is the rate (at least 1) if not set.
+	Burst int
+	// Service is the name of the service for the metrics.
+	Service string
+}
+
+type listener struct {
+	net.Listener
+	limiter *rate.Limiter
+	service string
+}
+
+// WrapListener limits the rate of the connections accepted by ln with a token bucket,
+// the connections over the rate are closed immediately, before they are handed to the handler.
+// It is a global cap of the listener, unlike the per-IP limiting of the connection limiter.
+func WrapListener(ln net.Listener, opts Options) net.Listener {
+	if ln == nil || opts.Rate <= 0 {
+		return ln
+	}
+
+	burst := opts.Burst
+	if burst <= 0 {
+		burst = max(int(math.Ceil(opts.Rate)), 1)
+	}
+	return &listener{
+		Listener: ln,
+		limiter:  rate.NewLimiter(rate.Limit(opts.Rate), burst),
+		service:  opts.Service,
+	}
+}
+
+// Unwrap returns the underlying listener.
+func (ln *listener) Unwrap() net.Listener {
+	return ln.Listener
+}
+
+func (ln *listener) Accept() (net.Conn, error) {
+	for {
+		c, err := ln.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if ln.limiter.AllowN(time.Now(), 1) {
+			return c, nil
+		}
+
+		c.Close()
+		if v := xmetrics.GetCounter(xmetrics.MetricServiceAcceptThrottledCounter,
+			metrics.Labels{"service": ln.service}); v != nil {
+			v.Inc()
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package net
+
+import (
+	"errors"
+	"syscall"
+)
+
+var (
+	ErrBindDevice = errors.New("binding to the network interface requires Linux")
+)
+
+// BindDeviceControl returns the Control of the ListenConfig binding the socket to the network interface device (SO_BINDTODEVICE),
+// so the listener only accepts the connections arriving on it. nil is returned if the device is empty.
+// The Control fails with ErrBindDevice on the platforms other than Linux.
+func BindDeviceControl(device string) func(network, address string, c syscall.RawConn) error {
+	if device == "" {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		return bindDevice(c, device)
+	}
+}
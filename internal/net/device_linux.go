@@ -0,0 +1,21 @@
+package net
+
+import (
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func bindDevice(c syscall.RawConn, device string) error {
+	var serr error
+	if err := c.Control(func(fd uintptr) {
+		serr = unix.BindToDevice(int(fd), device)
+	}); err != nil {
+		return err
+	}
+	if serr != nil {
+		return fmt.Errorf("bind to device %s: %w", device, serr)
+	}
+	return nil
+}
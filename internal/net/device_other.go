@@ -0,0 +1,11 @@
+//go:build !linux
+
+package net
+
+import (
+	"syscall"
+)
+
+func bindDevice(c syscall.RawConn, device string) error {
+	return ErrBindDevice
+}
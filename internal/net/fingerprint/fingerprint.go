@@ -0,0 +1,200 @@
+// Package fingerprint captures the passive fingerprints of the accepted connections,
+// the JA4T fingerprint of the TCP SYN and the JA4 fingerprint of the TLS ClientHello.
+package fingerprint
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/go-gost/core/logger"
+	"github.com/go-gost/core/metadata"
+	xmetadata "github.com/go-gost/x/metadata"
+	proxyproto "github.com/pires/go-proxyproto"
+)
+
+const (
+	// MetadataTCP is the connection metadata key of the JA4T fingerprint.
+	MetadataTCP = "fingerprint.tcp"
+	// MetadataTCPInfo is the connection metadata key of the TCP_INFO summary,
+	// it is set when the SYN packet is not available.
+	MetadataTCPInfo = "fingerprint.tcpinfo"
+	// MetadataTLS is the connection metadata key of the JA4 fingerprint.
+	MetadataTLS = "fingerprint.tls"
+)
+
+// Rules is the admission rule set of the fingerprints.
+// A fingerprint in the deny list is rejected,
+// and if the allow list is not empty, only the fingerprints in it are admitted.
+type Rules struct {
+	allow map[string]struct{}
+	deny  map[string]struct{}
+}
+
+// NewRules creates the rule set, nil is returned if both lists are empty.
+func NewRules(allow, deny []string) *Rules {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil
+	}
+	return &Rules{
+		allow: toSet(allow),
+		deny:  toSet(deny),
+	}
+}
+
+func toSet(ss []string) map[string]struct{} {
+	m := make(map[string]struct{})
+	for _, s := range ss {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			m[s] = struct{}{}
+		}
+	}
+	return m
+}
+
+// Admit reports whether the connection with the fingerprint is admitted.
+// The unknown (empty) fingerprint is only rejected by a non-empty allow list.
+func (r *Rules) Admit(fp string) bool {
+	if r == nil {
+		return true
+	}
+	fp = strings.ToLower(fp)
+	if _, ok := r.deny[fp]; ok && fp != "" {
+		return false
+	}
+	if len(r.allow) > 0 {
+		_, ok := r.allow[fp]
+		return ok
+	}
+	return true
+}
+
+type Options struct {
+	// TCP enables the JA4T fingerprint capturing.
+	TCP bool
+	// TCPRules is the admission rule set of the JA4T fingerprints.
+	TCPRules *Rules
+	// TLS enables the ClientHello recording for the JA4 fingerprint, see TLSConfig.
+	TLS    bool
+	Logger logger.Logger
+}
+
+type listener struct {
+	net.Listener
+	options Options
+}
+
+// WrapListener captures the fingerprints of the connections accepted by ln.
+// It wraps the PROXY protocol listener, if any, so the ClientHello is recorded after the PROXY protocol header
+// and the metadata of the fingerprints is not hidden by the PROXY protocol connection,
+// while the TCP fingerprint is of the raw connection from the peer.
+// The listener is returned untouched if the capturing is disabled, so no extra syscall is made.
+func WrapListener(ln net.Listener, opts Options) net.Listener {
+	if !opts.TCP && !opts.TLS {
+		return ln
+	}
+	if opts.Logger == nil {
+		opts.Logger = logger.Default()
+	}
+	if opts.TCP {
+		if err := saveSYN(rawListener(ln)); err != nil {
+			opts.Logger.Warnf("fingerprint: save syn: %v", err)
+		}
+	}
+	return &listener{
+		Listener: ln,
+		options:  opts,
+	}
+}
+
+func (ln *listener) Accept() (net.Conn, error) {
+	for {
+		c, err := ln.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		fc := &Conn{
+			Conn:       c,
+			captureTLS: ln.options.TLS,
+		}
+		if ln.options.TCP {
+			rc := rawConn(c)
+			fc.tcp, fc.tcpInfo = captureTCP(rc)
+			if !ln.options.TCPRules.Admit(fc.tcp) {
+				// the remote address of the raw connection, as the PROXY protocol header is not read by the accepting goroutine.
+				ln.options.Logger.Debugf("fingerprint: %s rejected by tcp fingerprint %q", rc.RemoteAddr(), fc.tcp)
+				c.Close()
+				continue
+			}
+		}
+		return fc, nil
+	}
+}
+
+// rawListener returns the listening socket under the PROXY protocol listener and the other wrappers.
+func rawListener(ln net.Listener) net.Listener {
+	for {
+		switch v := ln.(type) {
+		case *proxyproto.Listener:
+			ln = v.Listener
+		case interface{ Unwrap() net.Listener }:
+			ln = v.Unwrap()
+		default:
+			return ln
+		}
+	}
+}
+
+// rawConn returns the raw connection of the connection accepted by the PROXY protocol listener.
+func rawConn(c net.Conn) net.Conn {
+	if v, ok := c.(interface{ Raw() net.Conn }); ok {
+		return v.Raw()
+	}
+	return c
+}
+
+// Conn is the accepted connection with the fingerprints,
+// which are exposed through the connection metadata.
+type Conn struct {
+	net.Conn
+	tcp     string
+	tcpInfo string
+
+	captureTLS bool
+	mu         sync.Mutex
+	hello      []byte
+	helloDone  bool
+	tls        string
+}
+
+func (c *Conn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+	if n > 0 && c.captureTLS {
+		c.record(b[:n])
+	}
+	return
+}
+
+func (c *Conn) SyscallConn() (rc syscall.RawConn, err error) {
+	if sc, ok := rawConn(c.Conn).(syscall.Conn); ok {
+		return sc.SyscallConn()
+	}
+	return nil, syscall.EINVAL
+}
+
+// Metadata implements metadata.Metadatable interface.
+func (c *Conn) Metadata() metadata.Metadata {
+	m := map[string]any{}
+	if c.tcp != "" {
+		m[MetadataTCP] = c.tcp
+	}
+	if c.tcpInfo != "" {
+		m[MetadataTCPInfo] = c.tcpInfo
+	}
+	if fp := c.TLS(); fp != "" {
+		m[MetadataTLS] = fp
+	}
+	return xmetadata.NewMetadata(m)
+}
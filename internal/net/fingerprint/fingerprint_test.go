@@ -0,0 +1,77 @@
+package fingerprint
+
+import (
+	"crypto/tls"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	xproxyproto "github.com/go-gost/x/internal/net/proxyproto"
+	xlogger "github.com/go-gost/x/logger"
+	proxyproto "github.com/pires/go-proxyproto"
+)
+
+func TestWrapListenerProxyProtocol(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 40000}
+	dst := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 443}
+
+	for _, ppv := range []int{0, 1, 2} {
+		t.Run(map[int]string{0: "no proxy protocol", 1: "v1", 2: "v2"}[ppv], func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+
+			// the order of the wrappers of the listeners.
+			ln = xproxyproto.WrapListener(ppv, ln, 5*time.Second)
+			ln = WrapListener(ln, Options{TCP: true, TLS: true, Logger: xlogger.Nop()})
+
+			go func() {
+				c, err := net.Dial("tcp", ln.Addr().String())
+				if err != nil {
+					return
+				}
+				defer c.Close()
+				if ppv > 0 {
+					if _, err := proxyproto.HeaderProxyFromAddrs(byte(ppv), src, dst).WriteTo(c); err != nil {
+						return
+					}
+				}
+				// the handshake fails as the server never responds.
+				c.SetDeadline(time.Now().Add(5 * time.Second))
+				tls.Client(c, &tls.Config{ServerName: "example.com"}).Handshake()
+			}()
+
+			c, err := ln.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			c.SetDeadline(time.Now().Add(5 * time.Second))
+
+			fc, ok := c.(*Conn)
+			if !ok {
+				t.Fatalf("got %T, want %T", c, fc)
+			}
+			b := make([]byte, 4096)
+			for fc.TLS() == "" {
+				if _, err := fc.Read(b); err != nil {
+					t.Fatalf("no tls fingerprint: %v", err)
+				}
+			}
+
+			md := fc.Metadata()
+			if md.Get(MetadataTLS) == nil {
+				t.Error("no tls fingerprint in the metadata")
+			}
+			if runtime.GOOS == "linux" && md.Get(MetadataTCP) == nil && md.Get(MetadataTCPInfo) == nil {
+				t.Error("no tcp fingerprint in the metadata")
+			}
+			if ppv > 0 && fc.RemoteAddr().String() != src.String() {
+				t.Errorf("remote address: got %s, want %s", fc.RemoteAddr(), src)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package fingerprint
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// the bits of tcpi_options in struct tcp_info.
+const (
+	tcpiOptTimestamps = 1
+	tcpiOptSack       = 2
+	tcpiOptWscale     = 4
+	tcpiOptECN        = 8
+)
+
+// saveSYN enables TCP_SAVE_SYN on the listening socket,
+// the kernel keeps the SYN packet of the accepted connections for captureTCP.
+func saveSYN(ln net.Listener) error {
+	sc, ok := ln.(syscall.Conn)
+	if !ok {
+		return fmt.Errorf("%T is not a syscall.Conn", ln)
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_SAVE_SYN, 1)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+// captureTCP returns the JA4T fingerprint from the saved SYN packet,
+// or the TCP_INFO summary if the SYN packet is not available.
+func captureTCP(c net.Conn) (fp string, info string) {
+	sc, ok := c.(syscall.Conn)
+	if !ok {
+		return
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return
+	}
+	rc.Control(func(fd uintptr) {
+		var b [512]byte
+		n := uint32(len(b))
+		_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, fd, unix.IPPROTO_TCP, unix.TCP_SAVED_SYN,
+			uintptr(unsafe.Pointer(&b[0])), uintptr(unsafe.Pointer(&n)), 0)
+		if errno == 0 && n > 0 {
+			if fp = parseSYN(b[:n]); fp != "" {
+				return
+			}
+		}
+
+		if ti, err := unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO); err == nil {
+			info = tcpInfo(ti)
+		}
+	})
+	return
+}
+
+// parseSYN computes the JA4T fingerprint of the SYN packet including the IP header,
+// in the format of window_options_mss_wscale.
+func parseSYN(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+
+	switch b[0] >> 4 {
+	case 4:
+		ihl := int(b[0]&0x0f) * 4
+		if ihl < 20 || len(b) < ihl || b[9] != unix.IPPROTO_TCP {
+			return ""
+		}
+		b = b[ihl:]
+	case 6:
+		// the extension headers are not supported.
+		if len(b) < 40 || b[6] != unix.IPPROTO_TCP {
+			return ""
+		}
+		b = b[40:]
+	default:
+		return ""
+	}
+
+	if len(b) < 20 {
+		return ""
+	}
+	window := binary.BigEndian.Uint16(b[14:16])
+	doff := int(b[12]>>4) * 4
+	if doff < 20 || len(b) < doff {
+		return ""
+	}
+
+	var kinds []string
+	mss, wscale := 0, 0
+	for opts := b[20:doff]; len(opts) > 0; {
+		kind := opts[0]
+		kinds = append(kinds, strconv.Itoa(int(kind)))
+		if kind == 0 {
+			break
+		}
+		if kind == 1 {
+			opts = opts[1:]
+			continue
+		}
+		if len(opts) < 2 || int(opts[1]) < 2 || len(opts) < int(opts[1]) {
+			break
+		}
+		switch {
+		case kind == 2 && opts[1] == 4:
+			mss = int(binary.BigEndian.Uint16(opts[2:4]))
+		case kind == 3 && opts[1] == 3:
+			wscale = int(opts[2])
+		}
+		opts = opts[opts[1]:]
+	}
+
+	opts := "00"
+	if len(kinds) > 0 {
+		opts = strings.Join(kinds, "-")
+	}
+	return fmt.Sprintf("%d_%s_%d_%d", window, opts, mss, wscale)
+}
+
+func tcpInfo(ti *unix.TCPInfo) string {
+	var opts []string
+	if ti.Options&tcpiOptTimestamps != 0 {
+		opts = append(opts, "ts")
+	}
+	if ti.Options&tcpiOptSack != 0 {
+		opts = append(opts, "sack")
+	}
+	if ti.Options&tcpiOptWscale != 0 {
+		opts = append(opts, "wscale")
+	}
+	if ti.Options&tcpiOptECN != 0 {
+		opts = append(opts, "ecn")
+	}
+	return fmt.Sprintf("mss=%d,options=%s", ti.Snd_mss, strings.Join(opts, "-"))
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package fingerprint
+
+import (
+	"errors"
+	"net"
+)
+
+func saveSYN(ln net.Listener) error {
+	return errors.New("not supported")
+}
+
+func captureTCP(c net.Conn) (fp string, info string) {
+	return
+}
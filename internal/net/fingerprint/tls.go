@@ -0,0 +1,292 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/go-gost/core/metadata"
+)
+
+const (
+	recordHeaderLen       = 5
+	recordTypeHandshake   = 22
+	handshakeClientHello  = 1
+	maxClientHelloLen     = 16384 + recordHeaderLen
+	extServerName         = 0x0000
+	extSignatureAlgorithm = 0x000d
+	extALPN               = 0x0010
+	extSupportedVersions  = 0x002b
+)
+
+var (
+	ErrTLSRejected = errors.New("fingerprint: rejected by tls fingerprint")
+)
+
+// record keeps the first TLS record read from the connection, which carries the ClientHello.
+func (c *Conn) record(b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.helloDone {
+		return
+	}
+	c.hello = append(c.hello, b...)
+	if len(c.hello) < recordHeaderLen {
+		return
+	}
+	n := recordHeaderLen + int(binary.BigEndian.Uint16(c.hello[3:5]))
+	if c.hello[0] != recordTypeHandshake || n > maxClientHelloLen {
+		c.hello, c.helloDone = nil, true
+		return
+	}
+	if len(c.hello) >= n {
+		c.tls = ja4(c.hello[recordHeaderLen:n])
+		c.hello, c.helloDone = nil, true
+	}
+}
+
+// TLS returns the JA4 fingerprint of the ClientHello, it is available after the ClientHello is read.
+func (c *Conn) TLS() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.tls
+}
+
+// TLSConfig returns the config checking the JA4 fingerprint of the ClientHello against the rules,
+// the connection is rejected during the handshake.
+// The connections must be accepted by the listener from WrapListener with the TLS option.
+func TLSConfig(cfg *tls.Config, rules *Rules) *tls.Config {
+	if cfg == nil || rules == nil {
+		return cfg
+	}
+
+	cfg = cfg.Clone()
+	getConfigForClient := cfg.GetConfigForClient
+	cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		var fp string
+		if md, ok := hello.Conn.(metadata.Metadatable); ok {
+			if v, _ := md.Metadata().Get(MetadataTLS).(string); v != "" {
+				fp = v
+			}
+		}
+		if !rules.Admit(fp) {
+			return nil, fmt.Errorf("%w %q", ErrTLSRejected, fp)
+		}
+		if getConfigForClient != nil {
+			return getConfigForClient(hello)
+		}
+		return nil, nil
+	}
+	return cfg
+}
+
+type tlsConn struct {
+	*tls.Conn
+}
+
+// WrapTLSConn exposes the fingerprints of the underlying connection through the metadata of the TLS connection.
+func WrapTLSConn(c net.Conn) net.Conn {
+	tc, ok := c.(*tls.Conn)
+	if !ok {
+		return c
+	}
+	return &tlsConn{Conn: tc}
+}
+
+// Metadata implements metadata.Metadatable interface.
+func (c *tlsConn) Metadata() metadata.Metadata {
+	if md, ok := c.Conn.NetConn().(metadata.Metadatable); ok {
+		return md.Metadata()
+	}
+	return nil
+}
+
+type clientHello struct {
+	version    uint16
+	ciphers    []uint16
+	extensions []uint16
+	sni        bool
+	alpn       string
+	sigAlgs    []uint16
+	versions   []uint16
+}
+
+// ja4 computes the JA4 fingerprint of the handshake message, empty if it is not a valid ClientHello.
+func ja4(b []byte) string {
+	hello, ok := parseClientHello(b)
+	if !ok {
+		return ""
+	}
+
+	version := hello.version
+	for _, v := range hello.versions {
+		if !isGREASE(v) && v > version {
+			version = v
+		}
+	}
+	var ver string
+	switch version {
+	case tls.VersionTLS13:
+		ver = "13"
+	case tls.VersionTLS12:
+		ver = "12"
+	case tls.VersionTLS11:
+		ver = "11"
+	case tls.VersionTLS10:
+		ver = "10"
+	case 0x0300:
+		ver = "s3"
+	default:
+		ver = "00"
+	}
+
+	sni := "i"
+	if hello.sni {
+		sni = "d"
+	}
+
+	alpn := "00"
+	if s := hello.alpn; s != "" {
+		alpn = s[:1] + s[len(s)-1:]
+	}
+
+	ciphers := hexList(hello.ciphers, nil)
+	exts := hexList(hello.extensions, func(v uint16) bool {
+		return v == extServerName || v == extALPN
+	})
+	sort.Strings(ciphers)
+	sort.Strings(exts)
+
+	extsHash := strings.Join(exts, ",")
+	if sigAlgs := hexList(hello.sigAlgs, nil); len(sigAlgs) > 0 {
+		extsHash += "_" + strings.Join(sigAlgs, ",")
+	}
+
+	return fmt.Sprintf("t%s%s%02d%02d%s_%s_%s",
+		ver, sni,
+		min(len(ciphers), 99), min(len(hexList(hello.extensions, nil)), 99),
+		alpn,
+		hash12(strings.Join(ciphers, ",")),
+		hash12(extsHash),
+	)
+}
+
+func parseClientHello(b []byte) (hello clientHello, ok bool) {
+	if len(b) < 4 || b[0] != handshakeClientHello {
+		return
+	}
+	n := int(b[1])<<16 | int(b[2])<<8 | int(b[3])
+	if len(b) < 4+n {
+		return
+	}
+	b = b[4 : 4+n]
+
+	// version(2) + random(32)
+	if len(b) < 34 {
+		return
+	}
+	hello.version = binary.BigEndian.Uint16(b)
+	b = b[34:]
+
+	// session id
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return
+	}
+	b = b[1+int(b[0]):]
+
+	// cipher suites
+	if len(b) < 2 {
+		return
+	}
+	n = int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return
+	}
+	hello.ciphers = uint16s(b[2 : 2+n])
+	b = b[2+n:]
+
+	// compression methods
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return
+	}
+	b = b[1+int(b[0]):]
+
+	if len(b) < 2 {
+		return hello, true
+	}
+	n = int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return
+	}
+	for b = b[2 : 2+n]; len(b) >= 4; {
+		typ := binary.BigEndian.Uint16(b)
+		n := int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < 4+n {
+			return
+		}
+		data := b[4 : 4+n]
+		b = b[4+n:]
+
+		hello.extensions = append(hello.extensions, typ)
+		switch typ {
+		case extServerName:
+			hello.sni = true
+		case extALPN:
+			// protocol_name_list(2) + name length(1) + name
+			if len(data) >= 3 && len(data) >= 3+int(data[2]) {
+				hello.alpn = string(data[3 : 3+int(data[2])])
+			}
+		case extSignatureAlgorithm:
+			if len(data) >= 2 {
+				hello.sigAlgs = uint16s(data[2:])
+			}
+		case extSupportedVersions:
+			if len(data) >= 1 {
+				hello.versions = uint16s(data[1:])
+			}
+		}
+	}
+
+	return hello, true
+}
+
+func uint16s(b []byte) []uint16 {
+	v := make([]uint16, 0, len(b)/2)
+	for ; len(b) >= 2; b = b[2:] {
+		v = append(v, binary.BigEndian.Uint16(b))
+	}
+	return v
+}
+
+// isGREASE reports whether v is a GREASE value defined in RFC 8701.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// hexList formats the non-GREASE values as 4-digit hex, the values matching skip are excluded.
+func hexList(vs []uint16, skip func(uint16) bool) []string {
+	var ss []string
+	for _, v := range vs {
+		if isGREASE(v) || (skip != nil && skip(v)) {
+			continue
+		}
+		ss = append(ss, fmt.Sprintf("%04x", v))
+	}
+	return ss
+}
+
+func hash12(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:6])
+}
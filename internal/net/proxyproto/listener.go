@@ -2,9 +2,23 @@ package proxyproto
 
 import (
 	"net"
+	"strings"
+	"sync"
 	"time"
 
+	mdata "github.com/go-gost/core/metadata"
+	mdx "github.com/go-gost/x/metadata"
 	proxyproto "github.com/pires/go-proxyproto"
+	"github.com/pires/go-proxyproto/tlvparse"
+)
+
+const (
+	// MetadataKeyPeer is the metadata key of the address of the peer sending the PROXY protocol header,
+	// such as the load balancer, of the connection accepted by the listener wrapped by WrapPeerListener.
+	MetadataKeyPeer = "proxyproto.peer"
+	// MetadataKeyClientSSL is the metadata key reporting whether the client connected to the peer over SSL/TLS,
+	// by the PP2_TYPE_SSL TLV of the PROXY protocol v2 header.
+	MetadataKeyClientSSL = "proxyproto.clientSSL"
 )
 
 func WrapListener(ppv int, ln net.Listener, readHeaderTimeout time.Duration) net.Listener {
@@ -17,3 +31,88 @@ func WrapListener(ppv int, ln net.Listener, readHeaderTimeout time.Duration) net
 		ReadHeaderTimeout: readHeaderTimeout,
 	}
 }
+
+// IsHeaderError reports whether err is caused by the invalid or missing PROXY protocol header
+// of the connection accepted by the listener wrapped by WrapListener.
+func IsHeaderError(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "proxyproto:")
+}
+
+// WrapPeerListener makes the connections accepted by the listener wrapped by WrapListener
+// carry the address of the peer in the metadata, while the remote address of the connection
+// is the source address of the PROXY protocol header.
+func WrapPeerListener(ln net.Listener) net.Listener {
+	if _, ok := ln.(*proxyproto.Listener); !ok {
+		return ln
+	}
+	return &peerListener{
+		Listener: ln,
+	}
+}
+
+type peerListener struct {
+	net.Listener
+}
+
+func (l *peerListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if pc, ok := c.(*proxyproto.Conn); ok {
+		return &peerConn{
+			Conn: pc,
+		}, nil
+	}
+	return c, nil
+}
+
+type peerConn struct {
+	net.Conn
+	once sync.Once
+	md   mdata.Metadata
+}
+
+// Metadata implements metadata.Metadatable interface.
+// The header is read on the first call if it is not yet, so it is not called by the accepting goroutine.
+func (c *peerConn) Metadata() mdata.Metadata {
+	c.once.Do(func() {
+		pc := c.Conn.(*proxyproto.Conn)
+		md := map[string]any{
+			MetadataKeyPeer: pc.Raw().RemoteAddr().String(),
+		}
+		if h := pc.ProxyHeader(); h != nil {
+			if tlvs, err := h.TLVs(); err == nil {
+				if ssl, ok := tlvparse.FindSSL(tlvs); ok {
+					md[MetadataKeyClientSSL] = ssl.ClientSSL()
+				}
+			}
+		}
+		c.md = mdx.NewMetadata(md)
+	})
+	return c.md
+}
+
+// PeerAddr returns the address of the peer sending the PROXY protocol header of the connection,
+// empty if the connection is not accepted by the listener wrapped by WrapPeerListener.
+func PeerAddr(c net.Conn) string {
+	if v, ok := c.(mdata.Metadatable); ok {
+		if md := v.Metadata(); md != nil {
+			s, _ := md.Get(MetadataKeyPeer).(string)
+			return s
+		}
+	}
+	return ""
+}
+
+// ClientSSL reports whether the client connected to the peer sending the PROXY protocol header over SSL/TLS,
+// false if the connection is not accepted by the listener wrapped by WrapPeerListener or the header carries no SSL TLV.
+func ClientSSL(c net.Conn) bool {
+	if v, ok := c.(mdata.Metadatable); ok {
+		if md := v.Metadata(); md != nil {
+			b, _ := md.Get(MetadataKeyClientSSL).(bool)
+			return b
+		}
+	}
+	return false
+}
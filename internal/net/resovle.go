@@ -8,6 +8,7 @@ import (
 	"github.com/go-gost/core/hosts"
 	"github.com/go-gost/core/logger"
 	"github.com/go-gost/core/resolver"
+	resolver_util "github.com/go-gost/x/internal/util/resolver"
 )
 
 func Resolve(ctx context.Context, network, addr string, r resolver.Resolver, hosts hosts.HostMapper, log logger.Logger) (string, error) {
@@ -28,7 +29,8 @@ func Resolve(ctx context.Context, network, addr string, r resolver.Resolver, hos
 	}
 
 	if r != nil {
-		ips, err := r.Resolve(ctx, network, host)
+		// the cache of the handler, if any.
+		ips, err := resolver_util.LookupCacheFromContext(ctx).Lookup(ctx, network, host, r)
 		if err != nil {
 			if err == resolver.ErrInvalid {
 				return addr, nil
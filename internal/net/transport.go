@@ -2,8 +2,11 @@ package net
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"net"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-gost/core/common/bufpool"
 )
@@ -12,6 +15,10 @@ const (
 	bufferSize = 64 * 1024
 )
 
+var (
+	ErrIdleTimeout = errors.New("idle timeout")
+)
+
 func Transport(rw1, rw2 io.ReadWriter) error {
 	errc := make(chan error, 1)
 	go func() {
@@ -29,6 +36,82 @@ func Transport(rw1, rw2 io.ReadWriter) error {
 	return nil
 }
 
+// TransportWithIdleTimeout is like Transport, but closes rw1 and rw2 (if they are io.Closer)
+// when no data is transferred in either direction within the idle timeout.
+// A timeout less than or equal to zero means no idle timeout.
+func TransportWithIdleTimeout(rw1, rw2 io.ReadWriter, timeout time.Duration) error {
+	if timeout <= 0 {
+		return Transport(rw1, rw2)
+	}
+
+	t := &idleTracker{}
+	t.touch()
+
+	var idle atomic.Bool
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		d := timeout / 2
+		if d < 100*time.Millisecond {
+			d = 100 * time.Millisecond
+		}
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if t.idle() >= timeout {
+					idle.Store(true)
+					if c, ok := rw1.(io.Closer); ok {
+						c.Close()
+					}
+					if c, ok := rw2.(io.Closer); ok {
+						c.Close()
+					}
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := Transport(&idleReadWriter{ReadWriter: rw1, t: t}, &idleReadWriter{ReadWriter: rw2, t: t})
+	if idle.Load() {
+		return ErrIdleTimeout
+	}
+	return err
+}
+
+type idleTracker struct {
+	last atomic.Int64
+}
+
+func (t *idleTracker) touch() {
+	t.last.Store(time.Now().UnixNano())
+}
+
+func (t *idleTracker) idle() time.Duration {
+	return time.Since(time.Unix(0, t.last.Load()))
+}
+
+// idleReadWriter records the activity on read,
+// as the data read from one side is always written to the other side.
+type idleReadWriter struct {
+	io.ReadWriter
+	t *idleTracker
+}
+
+func (rw *idleReadWriter) Read(b []byte) (n int, err error) {
+	n, err = rw.ReadWriter.Read(b)
+	if n > 0 {
+		rw.t.touch()
+	}
+	return
+}
+
 func CopyBuffer(dst io.Writer, src io.Reader, bufSize int) error {
 	buf := bufpool.Get(bufSize)
 	defer bufpool.Put(buf)
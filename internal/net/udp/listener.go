@@ -3,6 +3,7 @@ package udp
 import (
 	"errors"
 	"net"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -137,16 +138,19 @@ type conn struct {
 	closed     chan struct{}
 	closeMutex sync.Mutex
 	keepalive  bool
+	// the read deadline of the flow, the deadlines of the shared socket are never changed.
+	readDeadline deadline
 }
 
 func newConn(c net.PacketConn, laddr, remoteAddr net.Addr, queueSize int, keepalive bool) *conn {
 	return &conn{
-		PacketConn: c,
-		localAddr:  laddr,
-		remoteAddr: remoteAddr,
-		rc:         make(chan []byte, queueSize),
-		closed:     make(chan struct{}),
-		keepalive:  keepalive,
+		PacketConn:   c,
+		localAddr:    laddr,
+		remoteAddr:   remoteAddr,
+		rc:           make(chan []byte, queueSize),
+		closed:       make(chan struct{}),
+		keepalive:    keepalive,
+		readDeadline: makeDeadline(),
 	}
 }
 
@@ -160,6 +164,10 @@ func (c *conn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
 	case <-c.closed:
 		err = net.ErrClosed
 		return
+
+	case <-c.readDeadline.wait():
+		err = os.ErrDeadlineExceeded
+		return
 	}
 
 	addr = c.remoteAddr
@@ -204,6 +212,21 @@ func (c *conn) isClosed() bool {
 	}
 }
 
+// SetDeadline sets the read deadline of the flow, see SetWriteDeadline for the writes.
+func (c *conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline is a no-op, the writes of the flows go to the shared socket without blocking.
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
 func (c *conn) LocalAddr() net.Addr {
 	return c.localAddr
 }
@@ -236,3 +259,64 @@ func (c *conn) WriteQueue(b []byte) error {
 		return errors.New("recv queue is full")
 	}
 }
+
+// deadline is a virtual deadline, the channel from wait is closed once the deadline is exceeded.
+type deadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+func makeDeadline() deadline {
+	return deadline{cancel: make(chan struct{})}
+}
+
+// set sets the deadline, the zero value of t means no deadline.
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		// the timer is fired, wait for the channel to be closed.
+		<-d.cancel
+	}
+	d.timer = nil
+
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() {
+			close(cancel)
+		})
+		return
+	}
+
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+func (d *deadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,25 @@
+package udp
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	xnet "github.com/go-gost/x/internal/net"
+)
+
+var (
+	ErrTransparent = errors.New("udp: transparent socket requires Linux and the CAP_NET_ADMIN capability")
+)
+
+// ListenTransparent listens on the address with the IP_TRANSPARENT (IPV6_TRANSPARENT) socket,
+// so the address can be non-local, such as the original destination of the connection redirected by TPROXY,
+// and the datagrams written to the peer have it as the source.
+// The socket is bound to the single address, the Relay writes all the datagrams from it,
+// the source is not switched per destination of the datagrams.
+// The error wraps ErrTransparent if the option is not permitted.
+func ListenTransparent(ctx context.Context, lc *xnet.ListenConfig, network, address string) (net.PacketConn, error) {
+	tlc := *lc
+	tlc.Control = transparentControl
+	return tlc.ListenPacket(ctx, network, address)
+}
@@ -0,0 +1,27 @@
+package udp
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func transparentControl(network, address string, c syscall.RawConn) error {
+	var serr error
+	if err := c.Control(func(fd uintptr) {
+		level, opt := unix.SOL_IP, unix.IP_TRANSPARENT
+		if domain, _ := unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_DOMAIN); domain == unix.AF_INET6 {
+			level, opt = unix.SOL_IPV6, unix.IPV6_TRANSPARENT
+		}
+		serr = unix.SetsockoptInt(int(fd), level, opt, 1)
+	}); err != nil {
+		return err
+	}
+
+	if errors.Is(serr, unix.EPERM) {
+		return fmt.Errorf("%w: %v", ErrTransparent, serr)
+	}
+	return serr
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package udp
+
+import (
+	"syscall"
+)
+
+func transparentControl(network, address string, c syscall.RawConn) error {
+	return ErrTransparent
+}
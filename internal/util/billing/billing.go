@@ -0,0 +1,238 @@
+package billing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/logger"
+	"github.com/go-gost/core/observer/stats"
+	"github.com/go-gost/core/recorder"
+)
+
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = 5 * time.Second
+	// the records queued to the flusher, the records beyond it are dropped, so a slow sink never stalls the connections.
+	queueSize = 4096
+)
+
+// Record is the billing record of a connection, the bytes are counted on the client side.
+type Record struct {
+	Service string    `json:"service"`
+	Client  string    `json:"client,omitempty"`
+	Up      int64     `json:"up"`
+	Down    int64     `json:"down"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+}
+
+type Options struct {
+	// BatchSize is the max number of the records flushed at once, 100 if not set.
+	BatchSize int
+	// FlushInterval is the max time a record is held before it is flushed, 5 seconds if not set.
+	FlushInterval time.Duration
+	Logger        logger.Logger
+}
+
+// Biller emits the billing records of the connections to the recorder at the connection close.
+// The records are batched and flushed as the JSON lines in one record of the recorder,
+// once the batch is full or the flush interval elapses.
+type Biller struct {
+	service  string
+	recorder recorder.Recorder
+	opts     Options
+	records  chan *Record
+	done     chan struct{}
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// New creates a Biller of the service, nil is returned if the recorder is nil,
+// and the nil Biller records nothing.
+func New(service string, r recorder.Recorder, opts Options) *Biller {
+	if r == nil {
+		return nil
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	if opts.Logger == nil {
+		opts.Logger = logger.Default()
+	}
+
+	b := &Biller{
+		service:  service,
+		recorder: r,
+		opts:     opts,
+		records:  make(chan *Record, queueSize),
+		done:     make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Start starts the accounting of a connection of the client.
+func (b *Biller) Start(client string) *Account {
+	if b == nil {
+		return nil
+	}
+	return &Account{
+		biller: b,
+		client: client,
+		start:  time.Now(),
+		stats:  &stats.Stats{},
+	}
+}
+
+// Close flushes the queued records and stops the Biller.
+func (b *Biller) Close() error {
+	if b == nil {
+		return nil
+	}
+	b.once.Do(func() {
+		close(b.done)
+		<-b.closed
+	})
+	return nil
+}
+
+func (b *Biller) emit(r *Record) {
+	select {
+	case <-b.done:
+		return
+	default:
+	}
+
+	select {
+	case b.records <- r:
+	default:
+		b.opts.Logger.Warnf("billing: queue is full, record of client %q dropped", r.Client)
+	}
+}
+
+func (b *Biller) run() {
+	defer close(b.closed)
+
+	ticker := time.NewTicker(b.opts.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []*Record
+	for {
+		select {
+		case r := <-b.records:
+			if batch = append(batch, r); len(batch) >= b.opts.BatchSize {
+				b.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			b.flush(batch)
+			batch = batch[:0]
+		case <-b.done:
+			for {
+				select {
+				case r := <-b.records:
+					if batch = append(batch, r); len(batch) >= b.opts.BatchSize {
+						b.flush(batch)
+						batch = batch[:0]
+					}
+				default:
+					b.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *Biller) flush(batch []*Record) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range batch {
+		enc.Encode(r)
+	}
+	if err := b.recorder.Record(context.Background(), buf.Bytes()); err != nil {
+		b.opts.Logger.Errorf("billing: %d records: %v", len(batch), err)
+	}
+}
+
+// Account is the accounting of a connection.
+type Account struct {
+	biller *Biller
+	client string
+	start  time.Time
+	stats  *stats.Stats
+	once   sync.Once
+}
+
+// Stats returns the stats counting the bytes of the connection, it is fed by the stats wrappers.
+// The input bytes are the bytes up from the client, and the output bytes are the bytes down to the client.
+func (a *Account) Stats() *stats.Stats {
+	if a == nil {
+		return nil
+	}
+	return a.stats
+}
+
+// End ends the accounting and emits the record of the connection, the record is emitted once.
+func (a *Account) End() {
+	if a == nil {
+		return
+	}
+	a.once.Do(func() {
+		a.biller.emit(&Record{
+			Service: a.biller.service,
+			Client:  a.client,
+			Up:      int64(a.stats.Get(stats.KindInputBytes)),
+			Down:    int64(a.stats.Get(stats.KindOutputBytes)),
+			Start:   a.start,
+			End:     time.Now(),
+		})
+	})
+}
+
+// WrapUpstream wraps the connection to the upstream for the paths where the client side is not wrapped,
+// the bytes written to the upstream are counted up and the bytes read from it down.
+// The accounting ends when the connection is closed.
+func (a *Account) WrapUpstream(c net.Conn) net.Conn {
+	if a == nil {
+		return c
+	}
+	return &upstreamConn{
+		Conn: c,
+		acct: a,
+	}
+}
+
+type upstreamConn struct {
+	net.Conn
+	acct *Account
+}
+
+func (c *upstreamConn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+	c.acct.stats.Add(stats.KindOutputBytes, int64(n))
+	return
+}
+
+func (c *upstreamConn) Write(b []byte) (n int, err error) {
+	n, err = c.Conn.Write(b)
+	c.acct.stats.Add(stats.KindInputBytes, int64(n))
+	return
+}
+
+func (c *upstreamConn) Close() error {
+	defer c.acct.End()
+	return c.Conn.Close()
+}
@@ -0,0 +1,181 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/metrics"
+	xmetrics "github.com/go-gost/x/metrics"
+)
+
+const (
+	defaultWindow   = 30 * time.Second
+	defaultCooldown = 10 * time.Second
+	// the number of the states triggering the sweep of the stale ones.
+	sweepThreshold = 1024
+	// the maximum number of the states, the failures of the other destinations are not tracked.
+	maxStates = 64 * sweepThreshold
+)
+
+var (
+	ErrOpen = errors.New("circuit breaker is open")
+)
+
+type Options struct {
+	// Threshold is the number of the consecutive failures opening the circuit.
+	Threshold int
+	// Window is the period in which the failures are counted.
+	Window time.Duration
+	// Cooldown is the time the circuit stays open before a probe is allowed.
+	Cooldown time.Duration
+	// Service is the name of the service for the metrics.
+	Service string
+}
+
+type state struct {
+	failures int
+	// the time of the first failure in the window.
+	since time.Time
+	// the circuit is open until the time.
+	openUntil time.Time
+	// a half-open probe is in flight.
+	probing bool
+}
+
+// Breaker is the circuit breaker of the destinations.
+// After Threshold consecutive dial failures to a destination within Window,
+// the circuit of the destination is opened and the connects are short-circuited with ErrOpen.
+// When Cooldown elapses, a single probe is allowed (half-open),
+// its success closes the circuit, and its failure opens it again.
+type Breaker struct {
+	options Options
+	states  map[string]*state
+	// the number of the states triggering the next sweep.
+	nextSweep int
+	mu        sync.Mutex
+}
+
+// New creates a Breaker, nil is returned if the threshold is not positive,
+// and the nil Breaker allows all the connects.
+func New(opts Options) *Breaker {
+	if opts.Threshold <= 0 {
+		return nil
+	}
+	if opts.Window <= 0 {
+		opts.Window = defaultWindow
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = defaultCooldown
+	}
+	return &Breaker{
+		options:   opts,
+		states:    make(map[string]*state),
+		nextSweep: sweepThreshold,
+	}
+}
+
+// Allow reports whether a connect to the destination is allowed, ErrOpen is returned if not.
+// Every allowed connect must be followed by a call of Done with the result.
+func (b *Breaker) Allow(addr string) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := b.states[addr]
+	if st == nil || st.openUntil.IsZero() {
+		return nil
+	}
+	if st.probing || time.Now().Before(st.openUntil) {
+		b.observe("reject")
+		return ErrOpen
+	}
+
+	// half-open
+	st.probing = true
+	return nil
+}
+
+// Done records the result of the connect to the destination.
+func (b *Breaker) Done(addr string, err error) {
+	if b == nil {
+		return
+	}
+	// the connects canceled by the client say nothing about the destination.
+	if errors.Is(err, context.Canceled) {
+		b.mu.Lock()
+		if st := b.states[addr]; st != nil {
+			st.probing = false
+		}
+		b.mu.Unlock()
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := b.states[addr]
+	if err == nil {
+		if st != nil {
+			if !st.openUntil.IsZero() {
+				b.observe("close")
+			}
+			delete(b.states, addr)
+		}
+		return
+	}
+
+	now := time.Now()
+	if st == nil {
+		if len(b.states) >= b.nextSweep {
+			b.sweep(now)
+		}
+		if len(b.states) >= maxStates {
+			return
+		}
+		st = &state{}
+		b.states[addr] = st
+	}
+	if st.probing {
+		st.probing = false
+		st.openUntil = now.Add(b.options.Cooldown)
+		b.observe("open")
+		return
+	}
+	if st.failures == 0 || now.Sub(st.since) > b.options.Window {
+		st.failures = 0
+		st.since = now
+	}
+	st.failures++
+	if st.failures >= b.options.Threshold && st.openUntil.IsZero() {
+		st.openUntil = now.Add(b.options.Cooldown)
+		b.observe("open")
+	}
+}
+
+// sweep deletes the states of the closed circuits whose window has expired,
+// and of the open circuits not probed within the window after the cooldown.
+func (b *Breaker) sweep(now time.Time) {
+	for k, st := range b.states {
+		if st.probing {
+			continue
+		}
+		if st.openUntil.IsZero() && now.Sub(st.since) > b.options.Window ||
+			!st.openUntil.IsZero() && now.Sub(st.openUntil) > b.options.Window {
+			delete(b.states, k)
+		}
+	}
+	// the sweeps are amortized over the states added since the last one.
+	b.nextSweep = max(sweepThreshold, 2*len(b.states))
+}
+
+func (b *Breaker) observe(event string) {
+	if v := xmetrics.GetCounter(xmetrics.MetricServiceCircuitBreakerCounter,
+		metrics.Labels{"service": b.options.Service, "event": event}); v != nil {
+		v.Inc()
+	}
+}
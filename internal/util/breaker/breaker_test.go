@@ -0,0 +1,79 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var errDial = errors.New("dial failed")
+
+func TestBreakerOpen(t *testing.T) {
+	b := New(Options{Threshold: 2, Window: time.Minute, Cooldown: 50 * time.Millisecond})
+
+	const addr = "example.com:443"
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(addr); err != nil {
+			t.Fatalf("failure %d: %v", i, err)
+		}
+		b.Done(addr, errDial)
+	}
+	if err := b.Allow(addr); !errors.Is(err, ErrOpen) {
+		t.Fatalf("open: got %v, want %v", err, ErrOpen)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := b.Allow(addr); err != nil {
+		t.Fatalf("half-open: %v", err)
+	}
+	if err := b.Allow(addr); !errors.Is(err, ErrOpen) {
+		t.Fatalf("probing: got %v, want %v", err, ErrOpen)
+	}
+	b.Done(addr, nil)
+	if err := b.Allow(addr); err != nil {
+		t.Fatalf("closed: %v", err)
+	}
+	if n := len(b.states); n != 0 {
+		t.Errorf("states of the closed circuits: got %d, want 0", n)
+	}
+}
+
+func TestBreakerSweep(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+	}{
+		{name: "closed", threshold: 100},
+		{name: "open", threshold: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New(Options{Threshold: tt.threshold, Window: 20 * time.Millisecond, Cooldown: 10 * time.Millisecond})
+			for i := 0; i < sweepThreshold; i++ {
+				b.Done(fmt.Sprintf("10.0.%d.%d:80", i/256, i%256), errDial)
+			}
+			if n := len(b.states); n != sweepThreshold {
+				t.Fatalf("states: got %d, want %d", n, sweepThreshold)
+			}
+
+			// the stale states are swept on the next failure.
+			time.Sleep(50 * time.Millisecond)
+			b.Done("example.com:443", errDial)
+			if n := len(b.states); n != 1 {
+				t.Errorf("states after the sweep: got %d, want 1", n)
+			}
+		})
+	}
+}
+
+func TestBreakerMaxStates(t *testing.T) {
+	b := New(Options{Threshold: 100, Window: time.Minute})
+	for i := 0; i < maxStates+100; i++ {
+		b.Done(fmt.Sprintf("10.%d.%d.%d:80", i>>16&0xff, i>>8&0xff, i&0xff), errDial)
+	}
+	if n := len(b.states); n != maxStates {
+		t.Errorf("states: got %d, want %d", n, maxStates)
+	}
+}
@@ -0,0 +1,66 @@
+package bypass
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-gost/core/metrics"
+	xmetrics "github.com/go-gost/x/metrics"
+)
+
+type ActionType string
+
+const (
+	// ActionReject replies to the client that the request is not allowed.
+	ActionReject ActionType = "reject"
+	// ActionDrop closes the connection without any reply.
+	ActionDrop ActionType = "drop"
+	// ActionSinkhole connects the client to a decoy service instead of the target.
+	ActionSinkhole ActionType = "sinkhole"
+
+	defaultSinkholeTimeout = 5 * time.Second
+)
+
+// Action is the action taken on the requests matched by the bypass.
+// It is specified by the metadata bypass.action:
+//
+//	reject - reply with the forbidden status, the default action.
+//	drop - close the connection without any reply.
+//	sinkhole:<addr> - dial the decoy service at addr and bridge the client to it.
+type Action struct {
+	Type ActionType
+	Addr string
+}
+
+// ParseAction parses the action, the invalid action falls back to reject.
+func ParseAction(s string) *Action {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == string(ActionDrop):
+		return &Action{Type: ActionDrop}
+	case strings.HasPrefix(s, string(ActionSinkhole)+":"):
+		if addr := strings.TrimPrefix(s, string(ActionSinkhole)+":"); addr != "" {
+			return &Action{Type: ActionSinkhole, Addr: addr}
+		}
+	}
+	return &Action{Type: ActionReject}
+}
+
+// Observe counts the request matched by the bypass of the service.
+func (a *Action) Observe(service string) {
+	if v := xmetrics.GetCounter(xmetrics.MetricServiceBypassCounter,
+		metrics.Labels{"service": service, "action": string(a.Type)}); v != nil {
+		v.Inc()
+	}
+}
+
+// Dial connects to the decoy service of the sinkhole action with the network of the request.
+// The decoy is a local service, so it is dialed directly instead of through the router.
+func (a *Action) Dial(ctx context.Context, network string) (net.Conn, error) {
+	dialer := net.Dialer{
+		Timeout: defaultSinkholeTimeout,
+	}
+	return dialer.DialContext(ctx, network, a.Addr)
+}
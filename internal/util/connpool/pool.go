@@ -0,0 +1,251 @@
+package connpool
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/metrics"
+	xmetrics "github.com/go-gost/x/metrics"
+)
+
+const (
+	defaultMaxIdle     = 8
+	defaultMaxLifetime = 5 * time.Minute
+	defaultIdleTimeout = 90 * time.Second
+	// the time to wait for the readiness of the idle connection in the health check.
+	healthCheckTimeout = time.Millisecond
+)
+
+type Options struct {
+	// MaxIdle is the max number of the idle connections of a key.
+	MaxIdle int
+	// MaxLifetime is the max time a connection is reused since it is dialed.
+	MaxLifetime time.Duration
+	// IdleTimeout is the max time a connection stays idle in the pool.
+	IdleTimeout time.Duration
+	// Service is the name of the service for the metrics.
+	Service string
+}
+
+type idleConn struct {
+	net.Conn
+	created time.Time
+	idle    time.Time
+}
+
+// Pool keeps the idle upstream connections by key, such as the target address,
+// so the forwarded requests to the same upstream reuse the connections instead of dialing.
+type Pool struct {
+	options Options
+	idles   map[string][]*idleConn
+	// the creation time of the connections out of the pool.
+	created map[net.Conn]time.Time
+	mu      sync.Mutex
+	closed  chan struct{}
+}
+
+func New(opts Options) *Pool {
+	if opts.MaxIdle <= 0 {
+		opts.MaxIdle = defaultMaxIdle
+	}
+	if opts.MaxLifetime <= 0 {
+		opts.MaxLifetime = defaultMaxLifetime
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = defaultIdleTimeout
+	}
+	p := &Pool{
+		options: opts,
+		idles:   make(map[string][]*idleConn),
+		created: make(map[net.Conn]time.Time),
+		closed:  make(chan struct{}),
+	}
+	go p.evictLoop()
+	return p
+}
+
+// Get returns an idle connection of the key, or nil if none is available.
+// The connection is health-checked before it is returned.
+func (p *Pool) Get(key string) net.Conn {
+	if p == nil {
+		return nil
+	}
+
+	for {
+		p.mu.Lock()
+		idles := p.idles[key]
+		if len(idles) == 0 {
+			p.mu.Unlock()
+			p.observe("miss")
+			return nil
+		}
+		// the most recently used one is taken.
+		ic := idles[len(idles)-1]
+		idles = idles[:len(idles)-1]
+		if len(idles) == 0 {
+			delete(p.idles, key)
+		} else {
+			p.idles[key] = idles
+		}
+		p.mu.Unlock()
+
+		if p.expired(ic, time.Now()) || !healthy(ic.Conn) {
+			ic.Close()
+			p.observe("evict")
+			continue
+		}
+
+		p.mu.Lock()
+		p.created[ic.Conn] = ic.created
+		p.mu.Unlock()
+
+		p.observe("hit")
+		return ic.Conn
+	}
+}
+
+// Put returns the connection of the key to the pool,
+// the connection is closed if the pool of the key is full or it exceeds the max lifetime.
+// The connection must be in the idle state, with no pending request or response.
+func (p *Pool) Put(key string, c net.Conn) {
+	if p == nil || c == nil {
+		return
+	}
+
+	now := time.Now()
+
+	p.mu.Lock()
+	created, ok := p.created[c]
+	delete(p.created, c)
+	if !ok {
+		created = now
+	}
+	ic := &idleConn{
+		Conn:    c,
+		created: created,
+		idle:    now,
+	}
+
+	select {
+	case <-p.closed:
+		p.mu.Unlock()
+		c.Close()
+		return
+	default:
+	}
+
+	if len(p.idles[key]) >= p.options.MaxIdle || p.expired(ic, now) {
+		p.mu.Unlock()
+		c.Close()
+		p.observe("evict")
+		return
+	}
+	p.idles[key] = append(p.idles[key], ic)
+	p.mu.Unlock()
+
+	p.observe("put")
+}
+
+// Discard forgets the connection got from the pool, which is closed by the caller.
+func (p *Pool) Discard(c net.Conn) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.created, c)
+}
+
+// Close closes all the idle connections, the connections put afterwards are closed.
+func (p *Pool) Close() error {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	select {
+	case <-p.closed:
+		return nil
+	default:
+		close(p.closed)
+	}
+
+	for key, idles := range p.idles {
+		for _, ic := range idles {
+			ic.Close()
+		}
+		delete(p.idles, key)
+	}
+	return nil
+}
+
+func (p *Pool) expired(ic *idleConn, now time.Time) bool {
+	return now.Sub(ic.created) >= p.options.MaxLifetime ||
+		now.Sub(ic.idle) >= p.options.IdleTimeout
+}
+
+func (p *Pool) evictLoop() {
+	ticker := time.NewTicker(p.options.IdleTimeout)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.evict()
+		case <-p.closed:
+			return
+		}
+	}
+}
+
+func (p *Pool) evict() {
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, idles := range p.idles {
+		var alive []*idleConn
+		for _, ic := range idles {
+			if p.expired(ic, now) {
+				ic.Close()
+				p.observe("evict")
+				continue
+			}
+			alive = append(alive, ic)
+		}
+		if len(alive) == 0 {
+			delete(p.idles, key)
+		} else {
+			p.idles[key] = alive
+		}
+	}
+}
+
+func (p *Pool) observe(event string) {
+	if v := xmetrics.GetCounter(xmetrics.MetricServiceConnPoolCounter,
+		metrics.Labels{"service": p.options.Service, "event": event}); v != nil {
+		v.Inc()
+	}
+}
+
+// healthy checks the idle connection by a read with a short deadline,
+// the connection closed by the peer or with unexpected data is not healthy.
+func healthy(c net.Conn) bool {
+	if err := c.SetReadDeadline(time.Now().Add(healthCheckTimeout)); err != nil {
+		return false
+	}
+	var b [1]byte
+	_, err := c.Read(b[:])
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		return false
+	}
+	return c.SetReadDeadline(time.Time{}) == nil
+}
@@ -0,0 +1,240 @@
+package conntrack
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-gost/core/logger"
+)
+
+const (
+	// DefaultMaxConns is the maximum number of the tracked connections,
+	// the connections beyond the limit are not tracked.
+	DefaultMaxConns = 65536
+)
+
+var (
+	defaultTracker = NewTracker(DefaultMaxConns)
+)
+
+// DefaultTracker returns the global connection tracker used by the handlers.
+func DefaultTracker() *Tracker {
+	return defaultTracker
+}
+
+// Conn is an established proxied connection.
+type Conn struct {
+	id       string
+	service  string
+	clientID string
+	src      string
+	dst      string
+	start    time.Time
+	inBytes  atomic.Uint64
+	outBytes atomic.Uint64
+	closers  []io.Closer
+	killed   atomic.Bool
+	log      logger.Logger
+	tracker  *Tracker
+	// the mirror sessions matching the connection when it is tracked.
+	mirrors []*MirrorSession
+}
+
+// ID returns the ID of the connection.
+func (c *Conn) ID() string {
+	if c == nil {
+		return ""
+	}
+	return c.id
+}
+
+// WrapReadWriter wraps rw to count the bytes transferred by the connection,
+// and to mirror them if the connection matches any mirror session.
+func (c *Conn) WrapReadWriter(rw io.ReadWriter) io.ReadWriter {
+	if c == nil {
+		return rw
+	}
+	if len(c.mirrors) > 0 {
+		rw = &mirrorReadWriter{
+			ReadWriter: rw,
+			conn:       c.id,
+			sessions:   c.mirrors,
+		}
+	}
+	return &readWriter{
+		ReadWriter: rw,
+		c:          c,
+	}
+}
+
+// Killed reports whether the connection is killed by Kill.
+func (c *Conn) Killed() bool {
+	if c == nil {
+		return false
+	}
+	return c.killed.Load()
+}
+
+// Untrack removes the connection from the tracker, it should be called when the connection is closed.
+func (c *Conn) Untrack() {
+	if c == nil {
+		return
+	}
+	c.tracker.remove(c)
+}
+
+func (c *Conn) kill() {
+	if !c.killed.CompareAndSwap(false, true) {
+		return
+	}
+	for _, closer := range c.closers {
+		closer.Close()
+	}
+	if c.log != nil {
+		c.log.Warnf("%s >-< %s: killed by admin", c.src, c.dst)
+	}
+}
+
+// ConnInfo is the snapshot of a tracked connection.
+type ConnInfo struct {
+	ID          string        `json:"id"`
+	Service     string        `json:"service"`
+	Client      string        `json:"client,omitempty"`
+	Src         string        `json:"src"`
+	Dst         string        `json:"dst"`
+	InputBytes  uint64        `json:"inputBytes"`
+	OutputBytes uint64        `json:"outputBytes"`
+	Age         time.Duration `json:"age"`
+}
+
+// Tracker tracks the established proxied connections.
+type Tracker struct {
+	conns    sync.Map
+	n        atomic.Int64
+	seq      atomic.Uint64
+	maxConns int64
+	mirrors  map[string]*MirrorSession
+	nmirrors atomic.Int32
+	mu       sync.Mutex
+}
+
+func NewTracker(maxConns int) *Tracker {
+	return &Tracker{
+		maxConns: int64(maxConns),
+	}
+}
+
+// Track registers an established connection, the closers will be closed when the connection is killed.
+// It returns nil if the number of the tracked connections reaches the limit.
+// The methods of the returned Conn can be safely called on nil.
+func (t *Tracker) Track(service, clientID, src, dst string, log logger.Logger, closers ...io.Closer) *Conn {
+	if t == nil {
+		return nil
+	}
+
+	if n := t.n.Add(1); t.maxConns > 0 && n > t.maxConns {
+		t.n.Add(-1)
+		return nil
+	}
+
+	c := &Conn{
+		id:       strconv.FormatUint(t.seq.Add(1), 10),
+		service:  service,
+		clientID: clientID,
+		src:      src,
+		dst:      dst,
+		start:    time.Now(),
+		closers:  closers,
+		log:      log,
+		tracker:  t,
+		mirrors:  t.matchMirrors(clientID, dst),
+	}
+	t.conns.Store(c.id, c)
+	return c
+}
+
+func (t *Tracker) remove(c *Conn) {
+	if _, loaded := t.conns.LoadAndDelete(c.id); loaded {
+		t.n.Add(-1)
+	}
+}
+
+// List returns the tracked connections of the service, or all the connections if service is empty.
+func (t *Tracker) List(service string) (conns []ConnInfo) {
+	if t == nil {
+		return
+	}
+
+	now := time.Now()
+	t.conns.Range(func(key, value any) bool {
+		c := value.(*Conn)
+		if service != "" && c.service != service {
+			return true
+		}
+		conns = append(conns, ConnInfo{
+			ID:          c.id,
+			Service:     c.service,
+			Client:      c.clientID,
+			Src:         c.src,
+			Dst:         c.dst,
+			InputBytes:  c.inBytes.Load(),
+			OutputBytes: c.outBytes.Load(),
+			Age:         now.Sub(c.start),
+		})
+		return true
+	})
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].Age > conns[j].Age
+	})
+	return
+}
+
+// Kill closes the connection with the id, it returns false if the connection is not found.
+func (t *Tracker) Kill(id string) bool {
+	if t == nil {
+		return false
+	}
+
+	v, ok := t.conns.Load(id)
+	if !ok {
+		return false
+	}
+	v.(*Conn).kill()
+	return true
+}
+
+// Track registers an established connection to the default tracker.
+func Track(service, clientID, src, dst string, log logger.Logger, closers ...io.Closer) *Conn {
+	return defaultTracker.Track(service, clientID, src, dst, log, closers...)
+}
+
+// List returns the connections of the service in the default tracker.
+func List(service string) []ConnInfo {
+	return defaultTracker.List(service)
+}
+
+// Kill closes the connection with the id in the default tracker.
+func Kill(id string) bool {
+	return defaultTracker.Kill(id)
+}
+
+type readWriter struct {
+	io.ReadWriter
+	c *Conn
+}
+
+func (rw *readWriter) Read(p []byte) (n int, err error) {
+	n, err = rw.ReadWriter.Read(p)
+	rw.c.inBytes.Add(uint64(n))
+	return
+}
+
+func (rw *readWriter) Write(p []byte) (n int, err error) {
+	n, err = rw.ReadWriter.Write(p)
+	rw.c.outBytes.Add(uint64(n))
+	return
+}
@@ -0,0 +1,333 @@
+package conntrack
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-gost/core/recorder"
+)
+
+const (
+	defaultMirrorMaxBytes = 16 * 1024 * 1024
+	defaultMirrorTTL      = 10 * time.Minute
+	// the max time a mirror session lasts, so it can not be left on accidentally.
+	maxMirrorTTL = 24 * time.Hour
+	// the chunks queued to the recorder, the chunks beyond it are dropped, so a slow recorder never stalls the traffic.
+	mirrorQueueSize = 256
+
+	// MirrorDirIn is the direction of the data read from the client.
+	MirrorDirIn = 0
+	// MirrorDirOut is the direction of the data written to the client.
+	MirrorDirOut = 1
+)
+
+var (
+	ErrMirrorRecorder = errors.New("conntrack: recorder is required for the mirror")
+	ErrMirrorFilter   = errors.New("conntrack: client ID or host is required for the mirror")
+)
+
+// MirrorOptions is the options of a mirror session.
+type MirrorOptions struct {
+	// ClientID matches the connections of the client, empty matches any client.
+	ClientID string
+	// Host matches the connections to the destination host (or host:port), empty matches any destination.
+	Host string
+	// Recorder receives the mirrored chunks.
+	Recorder recorder.Recorder
+	// MaxBytes is the total bytes mirrored before the session is stopped, 16MB if not set.
+	MaxBytes int64
+	// TTL is the duration before the session is stopped, 10 minutes if not set, and 24 hours at most.
+	TTL time.Duration
+}
+
+// MirrorInfo is the snapshot of a mirror session.
+type MirrorInfo struct {
+	ID       string    `json:"id"`
+	ClientID string    `json:"clientID,omitempty"`
+	Host     string    `json:"host,omitempty"`
+	Bytes    int64     `json:"bytes"`
+	Dropped  int64     `json:"dropped"`
+	Expires  time.Time `json:"expires"`
+}
+
+type mirrorChunk struct {
+	conn string
+	dir  uint8
+	t    time.Time
+	data []byte
+}
+
+// MirrorSession mirrors the byte streams of the matched connections to the recorder
+// as the timestamped and direction-tagged chunks, each chunk is a record framed as:
+//
+//	+-----------+-----+----------+---------+--------+------+
+//	| TIMESTAMP | DIR | CONN LEN | CONN ID | LENGTH | DATA |
+//	+-----------+-----+----------+---------+--------+------+
+//	|     8     |  1  |    1     |    N    |   4    |  L   |
+//	+-----------+-----+----------+---------+--------+------+
+//
+//	TIMESTAMP - Unix time in nanoseconds, 8 bytes.
+//	DIR - 0 for the data read from the client, 1 for the data written to the client.
+//	CONN ID - the ID of the tracked connection.
+//
+// The session is stopped once the bytes or the TTL is reached.
+type MirrorSession struct {
+	id      string
+	opts    MirrorOptions
+	expires time.Time
+	bytes   atomic.Int64
+	dropped atomic.Int64
+	chunks  chan *mirrorChunk
+	closed  chan struct{}
+	once    sync.Once
+	tracker *Tracker
+}
+
+// ID returns the ID of the session.
+func (s *MirrorSession) ID() string {
+	return s.id
+}
+
+// Stop stops the session, the queued chunks are still recorded.
+func (s *MirrorSession) Stop() {
+	s.once.Do(func() {
+		close(s.closed)
+		s.tracker.removeMirror(s)
+	})
+}
+
+func (s *MirrorSession) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *MirrorSession) match(clientID, dst string) bool {
+	if s.opts.ClientID != "" && s.opts.ClientID != clientID {
+		return false
+	}
+	if s.opts.Host != "" && !strings.EqualFold(s.opts.Host, dst) {
+		host, _, _ := net.SplitHostPort(dst)
+		if !strings.EqualFold(s.opts.Host, host) {
+			return false
+		}
+	}
+	return true
+}
+
+// mirror queues the chunk of the connection, the chunk is truncated at the cap of the session.
+func (s *MirrorSession) mirror(conn string, dir uint8, b []byte) {
+	if len(b) == 0 || s.isClosed() {
+		return
+	}
+
+	n := s.bytes.Add(int64(len(b)))
+	if over := n - s.opts.MaxBytes; over > 0 {
+		if over >= int64(len(b)) {
+			s.Stop()
+			return
+		}
+		b = b[:int64(len(b))-over]
+		defer s.Stop()
+	}
+
+	chunk := &mirrorChunk{
+		conn: conn,
+		dir:  dir,
+		t:    time.Now(),
+		data: append([]byte(nil), b...),
+	}
+	select {
+	case s.chunks <- chunk:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+func (s *MirrorSession) run() {
+	ttl := time.NewTimer(time.Until(s.expires))
+	defer ttl.Stop()
+
+	for {
+		select {
+		case chunk := <-s.chunks:
+			s.record(chunk)
+		case <-ttl.C:
+			s.Stop()
+		case <-s.closed:
+			for {
+				select {
+				case chunk := <-s.chunks:
+					s.record(chunk)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *MirrorSession) record(chunk *mirrorChunk) {
+	conn := chunk.conn
+	if len(conn) > 0xff {
+		conn = conn[:0xff]
+	}
+
+	b := make([]byte, 0, 8+1+1+len(conn)+4+len(chunk.data))
+	b = binary.BigEndian.AppendUint64(b, uint64(chunk.t.UnixNano()))
+	b = append(b, chunk.dir, byte(len(conn)))
+	b = append(b, conn...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(chunk.data)))
+	b = append(b, chunk.data...)
+
+	s.opts.Recorder.Record(context.Background(), b,
+		recorder.MetadataRecordOption(map[string]any{
+			"mirror": s.id,
+			"conn":   chunk.conn,
+			"dir":    chunk.dir,
+		}))
+}
+
+// StartMirror starts a mirror session of the connections tracked from now on,
+// the connections tracked before are not mirrored.
+func (t *Tracker) StartMirror(opts MirrorOptions) (*MirrorSession, error) {
+	if opts.Recorder == nil {
+		return nil, ErrMirrorRecorder
+	}
+	if opts.ClientID == "" && opts.Host == "" {
+		return nil, ErrMirrorFilter
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultMirrorMaxBytes
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = defaultMirrorTTL
+	}
+	opts.TTL = min(opts.TTL, maxMirrorTTL)
+
+	s := &MirrorSession{
+		id:      strconv.FormatUint(t.seq.Add(1), 10),
+		opts:    opts,
+		expires: time.Now().Add(opts.TTL),
+		chunks:  make(chan *mirrorChunk, mirrorQueueSize),
+		closed:  make(chan struct{}),
+		tracker: t,
+	}
+
+	t.mu.Lock()
+	if t.mirrors == nil {
+		t.mirrors = make(map[string]*MirrorSession)
+	}
+	t.mirrors[s.id] = s
+	t.nmirrors.Store(int32(len(t.mirrors)))
+	t.mu.Unlock()
+
+	go s.run()
+
+	return s, nil
+}
+
+// StopMirror stops the mirror session with the id, it returns false if the session is not found.
+func (t *Tracker) StopMirror(id string) bool {
+	t.mu.Lock()
+	s := t.mirrors[id]
+	t.mu.Unlock()
+
+	if s == nil {
+		return false
+	}
+	s.Stop()
+	return true
+}
+
+// Mirrors returns the active mirror sessions.
+func (t *Tracker) Mirrors() (mirrors []MirrorInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, s := range t.mirrors {
+		mirrors = append(mirrors, MirrorInfo{
+			ID:       s.id,
+			ClientID: s.opts.ClientID,
+			Host:     s.opts.Host,
+			Bytes:    min(s.bytes.Load(), s.opts.MaxBytes),
+			Dropped:  s.dropped.Load(),
+			Expires:  s.expires,
+		})
+	}
+	return
+}
+
+func (t *Tracker) removeMirror(s *MirrorSession) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.mirrors, s.id)
+	t.nmirrors.Store(int32(len(t.mirrors)))
+}
+
+// matchMirrors returns the active sessions matching the connection,
+// it costs nothing but an atomic load if there is no session.
+func (t *Tracker) matchMirrors(clientID, dst string) (sessions []*MirrorSession) {
+	if t.nmirrors.Load() == 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, s := range t.mirrors {
+		if s.match(clientID, dst) {
+			sessions = append(sessions, s)
+		}
+	}
+	return
+}
+
+// StartMirror starts a mirror session in the default tracker.
+func StartMirror(opts MirrorOptions) (*MirrorSession, error) {
+	return defaultTracker.StartMirror(opts)
+}
+
+// StopMirror stops the mirror session with the id in the default tracker.
+func StopMirror(id string) bool {
+	return defaultTracker.StopMirror(id)
+}
+
+// Mirrors returns the active mirror sessions in the default tracker.
+func Mirrors() []MirrorInfo {
+	return defaultTracker.Mirrors()
+}
+
+type mirrorReadWriter struct {
+	io.ReadWriter
+	conn     string
+	sessions []*MirrorSession
+}
+
+func (rw *mirrorReadWriter) Read(p []byte) (n int, err error) {
+	n, err = rw.ReadWriter.Read(p)
+	for _, s := range rw.sessions {
+		s.mirror(rw.conn, MirrorDirIn, p[:n])
+	}
+	return
+}
+
+func (rw *mirrorReadWriter) Write(p []byte) (n int, err error) {
+	n, err = rw.ReadWriter.Write(p)
+	for _, s := range rw.sessions {
+		s.mirror(rw.conn, MirrorDirOut, p[:n])
+	}
+	return
+}
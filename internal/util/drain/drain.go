@@ -0,0 +1,98 @@
+package drain
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+var (
+	ErrDraining = errors.New("handler is draining")
+)
+
+// Tracker tracks the active connections of a handler, so that the handler can be drained.
+// The zero value is ready to use.
+type Tracker struct {
+	conns    map[net.Conn]struct{}
+	draining bool
+	// done is closed when the last connection is removed during draining.
+	done chan struct{}
+	mu   sync.Mutex
+}
+
+// Add tracks the connection.
+// It returns false if the tracker is draining, the connection should be rejected.
+func (t *Tracker) Add(conn net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.draining {
+		return false
+	}
+	if t.conns == nil {
+		t.conns = make(map[net.Conn]struct{})
+	}
+	t.conns[conn] = struct{}{}
+	return true
+}
+
+// Remove stops tracking the connection.
+func (t *Tracker) Remove(conn net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.conns, conn)
+	if t.draining && len(t.conns) == 0 && t.done != nil {
+		close(t.done)
+		t.done = nil
+	}
+}
+
+// Active returns the number of the active connections.
+func (t *Tracker) Active() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.conns)
+}
+
+// IsDraining reports whether the tracker is draining.
+func (t *Tracker) IsDraining() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.draining
+}
+
+// Drain stops accepting new connections and waits for the active connections to finish.
+// When ctx is done, the remaining connections are closed,
+// it returns the number of the force-closed connections and the error of ctx.
+func (t *Tracker) Drain(ctx context.Context) (forced int, err error) {
+	t.mu.Lock()
+	t.draining = true
+	if len(t.conns) == 0 {
+		t.mu.Unlock()
+		return
+	}
+	if t.done == nil {
+		t.done = make(chan struct{})
+	}
+	done := t.done
+	t.mu.Unlock()
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for conn := range t.conns {
+		conn.Close()
+		forced++
+	}
+	return forced, ctx.Err()
+}
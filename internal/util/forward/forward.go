@@ -6,10 +6,13 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/binary"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"strings"
 
+	"github.com/go-gost/core/metadata"
 	dissector "github.com/go-gost/tls-dissector"
 	xio "github.com/go-gost/x/internal/io"
 )
@@ -48,6 +51,25 @@ func Sniffing(ctx context.Context, rdw io.ReadWriter) (rw io.ReadWriter, host st
 	return
 }
 
+// SniffSNI peeks the TLS ClientHello from rdw and returns the server name.
+// The returned rw replays the peeked data, so the non-TLS traffic is passed through untouched.
+func SniffSNI(ctx context.Context, rdw io.ReadWriter) (rw io.ReadWriter, host string, err error) {
+	rw = rdw
+
+	var hdr [dissector.RecordHeaderLen]byte
+	n, err := io.ReadFull(rw, hdr[:])
+	rw = xio.NewReadWriter(io.MultiReader(bytes.NewReader(hdr[:n]), rw), rw)
+	if err != nil {
+		return
+	}
+	tlsVersion := binary.BigEndian.Uint16(hdr[1:3])
+	if hdr[0] != dissector.Handshake ||
+		tlsVersion < tls.VersionTLS10 || tlsVersion > tls.VersionTLS13 {
+		return
+	}
+	return sniffSNI(ctx, rw)
+}
+
 func sniffSNI(ctx context.Context, rw io.ReadWriter) (io.ReadWriter, string, error) {
 	buf := new(bytes.Buffer)
 	host, err := getServerName(ctx, io.TeeReader(rw, buf))
@@ -77,6 +99,32 @@ func getServerName(ctx context.Context, r io.Reader) (host string, err error) {
 	return
 }
 
+// ValidHost reports whether the host is an IP address or a plausible domain name,
+// such as the server name sniffed from the client.
+func ValidHost(host string) bool {
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 ||
+			label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+				c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func isHTTP(s string) bool {
 	return strings.HasPrefix(http.MethodGet, s[:3]) ||
 		strings.HasPrefix(http.MethodPost, s[:4]) ||
@@ -93,8 +141,32 @@ const (
 	ProtoHTTP  = "http"
 	ProtoTLS   = "tls"
 	ProtoSSHv2 = "SSH-2"
+
+	// MetadataKeyTarget is the key of the connection metadata holding the target host:port
+	// requested by the client before the connection is handed over, such as by the HTTP CONNECT.
+	MetadataKeyTarget = "forward.target"
+	// MetadataKeyReply is the key of the connection metadata holding the Replier of the request
+	// the connection is handed over by, the client is answered once the target is dialed.
+	MetadataKeyReply = "forward.reply"
 )
 
+var (
+	ErrTargetNotAllowed = errors.New("target not allowed")
+)
+
+// Replier answers the request the connection is handed over by, such as the HTTP CONNECT,
+// with the result of dialing the target, nil err for success.
+type Replier func(err error) error
+
+// GetReplier returns the Replier in the metadata of the connection, nil if none.
+func GetReplier(md metadata.Metadata) Replier {
+	if md == nil {
+		return nil
+	}
+	r, _ := md.Get(MetadataKeyReply).(Replier)
+	return r
+}
+
 func sniffProtocol(hdr []byte) string {
 	if string(hdr) == ProtoSSHv2 {
 		return "ssh"
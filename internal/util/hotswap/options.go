@@ -0,0 +1,76 @@
+package hotswap
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-gost/core/auth"
+	"github.com/go-gost/core/bypass"
+	"github.com/go-gost/core/handler"
+	"github.com/go-gost/core/limiter/traffic"
+	limiter_util "github.com/go-gost/x/internal/util/limiter"
+)
+
+// Options is the options of the running handler swappable by the UpdateOptions of the handler.
+type Options struct {
+	Auther auth.Authenticator
+	Bypass bypass.Bypass
+	// Limiter is the traffic limiter of the handler, cached as the handlers do.
+	Limiter traffic.TrafficLimiter
+	// the handler options the options are created from, the base of the next Update.
+	src handler.Options
+}
+
+// Value holds the current Options of the handler, it is safe for the concurrent use.
+// The new connections use the options loaded when they are handled,
+// and the established connections keep the auther, bypass and limiter wrappers they started with.
+type Value struct {
+	v atomic.Pointer[Options]
+	// serializes the updates, so a concurrent one is never lost.
+	mu sync.Mutex
+}
+
+// Store replaces the current options with the auther, bypass and limiter of opts.
+func (v *Value) Store(opts *handler.Options) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.store(opts)
+}
+
+// Update applies opts to the handler options of the current options and stores the result,
+// so the options not passed keep their current values, including the ones set by the previous updates.
+func (v *Value) Update(opts ...handler.Option) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var options handler.Options
+	if o := v.v.Load(); o != nil {
+		options = o.src
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	v.store(&options)
+}
+
+func (v *Value) store(opts *handler.Options) {
+	o := &Options{
+		Auther: opts.Auther,
+		Bypass: opts.Bypass,
+		src:    *opts,
+	}
+	if opts.Limiter != nil {
+		o.Limiter = limiter_util.NewCachedTrafficLimiter(opts.Limiter, 30*time.Second, 60*time.Second)
+	}
+	v.v.Store(o)
+}
+
+// Load returns the current options, the zero Options if none is stored.
+func (v *Value) Load() *Options {
+	if o := v.v.Load(); o != nil {
+		return o
+	}
+	return &Options{}
+}
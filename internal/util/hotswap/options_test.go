@@ -0,0 +1,79 @@
+package hotswap
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/go-gost/core/auth"
+	"github.com/go-gost/core/handler"
+	xauth "github.com/go-gost/x/auth"
+	xbypass "github.com/go-gost/x/bypass"
+	xlogger "github.com/go-gost/x/logger"
+)
+
+func TestValueLoadZero(t *testing.T) {
+	var v Value
+	o := v.Load()
+	if o == nil {
+		t.Fatal("Load returns nil")
+	}
+	if o.Auther != nil || o.Bypass != nil || o.Limiter != nil {
+		t.Errorf("got %+v, want the zero Options", o)
+	}
+}
+
+func TestValueSwapUnderLoad(t *testing.T) {
+	authers := []auth.Authenticator{
+		xauth.NewAuthenticator(xauth.AuthsOption(map[string]string{"a": "1"})),
+		xauth.NewAuthenticator(xauth.AuthsOption(map[string]string{"b": "2"})),
+	}
+
+	var v Value
+	v.Store(&handler.Options{Auther: authers[0]})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10000; j++ {
+				o := v.Load()
+				_, okA := o.Auther.Authenticate(context.Background(), "a", "1")
+				_, okB := o.Auther.Authenticate(context.Background(), "b", "2")
+				// a snapshot is always one of the authers, never a mix of them.
+				if okA == okB {
+					t.Errorf("inconsistent auther: a=%v, b=%v", okA, okB)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 1000; i++ {
+		v.Store(&handler.Options{Auther: authers[i%2]})
+	}
+	wg.Wait()
+}
+
+func TestValueUpdate(t *testing.T) {
+	autherA := xauth.NewAuthenticator(xauth.AuthsOption(map[string]string{"a": "1"}))
+	autherB := xauth.NewAuthenticator(xauth.AuthsOption(map[string]string{"b": "2"}))
+	bp := xbypass.NewBypass(xbypass.LoggerOption(xlogger.Nop()))
+
+	var v Value
+	v.Store(&handler.Options{Auther: autherA})
+
+	// the options not passed keep the values of the previous updates.
+	v.Update(handler.BypassOption(bp))
+	if o := v.Load(); o.Auther != autherA || o.Bypass != bp {
+		t.Fatalf("got %+v, want the auther of Store and the bypass of Update", o)
+	}
+	v.Update(handler.AutherOption(autherB))
+	if o := v.Load(); o.Auther != autherB || o.Bypass != bp {
+		t.Fatalf("got %+v, want the auther and bypass of the updates", o)
+	}
+	v.Update(handler.BypassOption(nil))
+	if o := v.Load(); o.Auther != autherB || o.Bypass != nil {
+		t.Fatalf("got %+v, want the bypass removed", o)
+	}
+}
@@ -0,0 +1,145 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// the max time the coalesced bytes wait for the flush if flush.delay is not set.
+	defaultFlushDelay = 2 * time.Millisecond
+)
+
+// FlushOptions is the coalescing of the flushes of the streamed response body.
+type FlushOptions struct {
+	// Threshold is the bytes written before the body is flushed immediately,
+	// 0 flushes the body on every write.
+	Threshold int
+	// Delay is the max time the written bytes below the threshold wait for the flush,
+	// 2ms if not set, so the interactive traffic is still flushed promptly.
+	Delay time.Duration
+}
+
+// FlushWriter writes the streamed response body, and flushes it on every write
+// or after the writes are coalesced by the options.
+// Close must be called before the handler of the response returns.
+type FlushWriter struct {
+	w       io.Writer
+	f       http.Flusher
+	opts    FlushOptions
+	pending int
+	timer   *time.Timer
+	closed  bool
+	mu      sync.Mutex
+}
+
+func NewFlushWriter(w io.Writer, opts FlushOptions) *FlushWriter {
+	if opts.Threshold < 0 {
+		opts.Threshold = 0
+	}
+	if opts.Threshold > 0 && opts.Delay <= 0 {
+		opts.Delay = defaultFlushDelay
+	}
+	fw := &FlushWriter{
+		w:    w,
+		opts: opts,
+	}
+	fw.f, _ = w.(http.Flusher)
+	return fw
+}
+
+func (fw *FlushWriter) Write(p []byte) (n int, err error) {
+	// the writes after the stream is closed by the peer panic in the http2 server.
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoverError(r)
+		}
+	}()
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if fw.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	n, err = fw.w.Write(p)
+	if err != nil || fw.f == nil {
+		return
+	}
+
+	fw.pending += n
+	if fw.pending >= fw.opts.Threshold {
+		fw.flush()
+		return
+	}
+	if fw.timer == nil {
+		fw.timer = time.AfterFunc(fw.opts.Delay, fw.flushDelayed)
+	} else if fw.pending == n {
+		// the first write since the last flush starts the delay.
+		fw.timer.Reset(fw.opts.Delay)
+	}
+	return
+}
+
+// flush flushes the written bytes, the lock must be held.
+func (fw *FlushWriter) flush() {
+	if fw.timer != nil {
+		fw.timer.Stop()
+	}
+	fw.pending = 0
+	fw.f.Flush()
+}
+
+func (fw *FlushWriter) flushDelayed() {
+	defer func() {
+		recover()
+	}()
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if fw.closed || fw.pending == 0 {
+		return
+	}
+	fw.pending = 0
+	fw.f.Flush()
+}
+
+// Close flushes the pending bytes and stops the delayed flush, the underlying writer is not closed.
+func (fw *FlushWriter) Close() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoverError(r)
+		}
+	}()
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if fw.closed {
+		return nil
+	}
+	fw.closed = true
+	if fw.pending > 0 {
+		fw.flush()
+	} else if fw.timer != nil {
+		fw.timer.Stop()
+	}
+	return nil
+}
+
+func recoverError(r any) error {
+	switch v := r.(type) {
+	case error:
+		return v
+	case string:
+		return errors.New(v)
+	default:
+		return fmt.Errorf("%v", v)
+	}
+}
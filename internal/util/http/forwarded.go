@@ -0,0 +1,43 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	ctxvalue "github.com/go-gost/x/ctx"
+)
+
+const (
+	HeaderForwarded = "Forwarded"
+)
+
+// SetForwarded sets the RFC 7239 Forwarded header of the CONNECT request to the address,
+// if the forwarding information in ctx targets the address.
+func SetForwarded(ctx context.Context, header http.Header, address string) {
+	f := ctxvalue.ForwardedFromContext(ctx)
+	if f == nil || f.For == "" || f.Target != address {
+		return
+	}
+	header.Set(HeaderForwarded, "for="+forwardedNode(f.For))
+}
+
+// forwardedNode formats the node of the Forwarded header,
+// the IPv6 address is enclosed in brackets, and the node with port or brackets is quoted.
+func forwardedNode(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port == "" && !strings.HasPrefix(host, "[") {
+		return host
+	}
+	if port != "" {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+	return `"` + host + `"`
+}
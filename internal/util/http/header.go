@@ -0,0 +1,63 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	HeaderXForwardedFor = "X-Forwarded-For"
+)
+
+// HeaderRules modifies the header of the request forwarded to the upstream.
+// The rules are applied in the order of Remove, Set, Add and ForwardedFor.
+type HeaderRules struct {
+	// Remove deletes the headers.
+	Remove []string
+	// Set overrides the headers.
+	Set http.Header
+	// Add appends the values to the headers.
+	Add http.Header
+	// ForwardedFor appends the client IP to the X-Forwarded-For header.
+	ForwardedFor bool
+}
+
+// IsEmpty reports whether the rules make no change to the header.
+func (r *HeaderRules) IsEmpty() bool {
+	return r == nil ||
+		(len(r.Remove) == 0 && len(r.Set) == 0 && len(r.Add) == 0 && !r.ForwardedFor)
+}
+
+// Apply applies the rules to the header of the request from the client address.
+func (r *HeaderRules) Apply(header http.Header, clientAddr string) {
+	if r.IsEmpty() {
+		return
+	}
+
+	for _, k := range r.Remove {
+		header.Del(k)
+	}
+	for k, v := range r.Set {
+		header[http.CanonicalHeaderKey(k)] = append([]string(nil), v...)
+	}
+	for k, v := range r.Add {
+		for _, vv := range v {
+			header.Add(k, vv)
+		}
+	}
+
+	if r.ForwardedFor {
+		ip, _, err := net.SplitHostPort(clientAddr)
+		if err != nil {
+			ip = clientAddr
+		}
+		if ip == "" {
+			return
+		}
+		if prior := header.Values(HeaderXForwardedFor); len(prior) > 0 {
+			ip = strings.Join(prior, ", ") + ", " + ip
+		}
+		header.Set(HeaderXForwardedFor, ip)
+	}
+}
@@ -0,0 +1,128 @@
+package http
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestHeaderRulesApply(t *testing.T) {
+	tests := []struct {
+		name       string
+		rules      *HeaderRules
+		header     http.Header
+		clientAddr string
+		want       http.Header
+	}{
+		{
+			name:   "nil rules",
+			header: http.Header{"Cookie": {"a=1"}},
+			want:   http.Header{"Cookie": {"a=1"}},
+		},
+		{
+			name:   "add",
+			rules:  &HeaderRules{Add: http.Header{"X-Env": {"prod"}}},
+			header: http.Header{"X-Env": {"dev"}},
+			want:   http.Header{"X-Env": {"dev", "prod"}},
+		},
+		{
+			name:   "add new",
+			rules:  &HeaderRules{Add: http.Header{"X-Env": {"prod"}}},
+			header: http.Header{},
+			want:   http.Header{"X-Env": {"prod"}},
+		},
+		{
+			name:   "override",
+			rules:  &HeaderRules{Set: http.Header{"User-Agent": {"gost"}}},
+			header: http.Header{"User-Agent": {"curl", "wget"}},
+			want:   http.Header{"User-Agent": {"gost"}},
+		},
+		{
+			name:   "override lowercase key",
+			rules:  &HeaderRules{Set: http.Header{"user-agent": {"gost"}}},
+			header: http.Header{"User-Agent": {"curl"}},
+			want:   http.Header{"User-Agent": {"gost"}},
+		},
+		{
+			name:   "remove",
+			rules:  &HeaderRules{Remove: []string{"cookie", "X-Absent"}},
+			header: http.Header{"Cookie": {"a=1", "b=2"}, "Accept": {"*/*"}},
+			want:   http.Header{"Accept": {"*/*"}},
+		},
+		{
+			name: "remove then set",
+			rules: &HeaderRules{
+				Remove: []string{"X-Token"},
+				Set:    http.Header{"X-Token": {"server"}},
+			},
+			header: http.Header{"X-Token": {"client"}},
+			want:   http.Header{"X-Token": {"server"}},
+		},
+		{
+			name:       "forwarded for",
+			rules:      &HeaderRules{ForwardedFor: true},
+			header:     http.Header{},
+			clientAddr: "192.0.2.1:1234",
+			want:       http.Header{"X-Forwarded-For": {"192.0.2.1"}},
+		},
+		{
+			name:       "forwarded for appended",
+			rules:      &HeaderRules{ForwardedFor: true},
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1", "198.51.100.2"}},
+			clientAddr: "[2001:db8::1]:1234",
+			want:       http.Header{"X-Forwarded-For": {"198.51.100.1, 198.51.100.2, 2001:db8::1"}},
+		},
+		{
+			name:       "forwarded for without port",
+			rules:      &HeaderRules{ForwardedFor: true},
+			header:     http.Header{},
+			clientAddr: "192.0.2.1",
+			want:       http.Header{"X-Forwarded-For": {"192.0.2.1"}},
+		},
+		{
+			name:   "forwarded for without client",
+			rules:  &HeaderRules{ForwardedFor: true},
+			header: http.Header{},
+			want:   http.Header{},
+		},
+		{
+			name:       "forwarded for after set",
+			rules:      &HeaderRules{Set: http.Header{"X-Forwarded-For": {"10.0.0.1"}}, ForwardedFor: true},
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.9"}},
+			clientAddr: "192.0.2.1:1234",
+			want:       http.Header{"X-Forwarded-For": {"10.0.0.1, 192.0.2.1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rules.Apply(tt.header, tt.clientAddr)
+			if !reflect.DeepEqual(tt.header, tt.want) {
+				t.Errorf("got %v, want %v", tt.header, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeaderRulesIsEmpty(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules *HeaderRules
+		want  bool
+	}{
+		{name: "nil", want: true},
+		{name: "zero", rules: &HeaderRules{}, want: true},
+		{name: "remove", rules: &HeaderRules{Remove: []string{"Cookie"}}},
+		{name: "set", rules: &HeaderRules{Set: http.Header{"A": {"1"}}}},
+		{name: "add", rules: &HeaderRules{Add: http.Header{"A": {"1"}}}},
+		{name: "forwarded for", rules: &HeaderRules{ForwardedFor: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rules.IsEmpty(); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package http
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// hopHeaders are the hop-by-hop headers defined in RFC 7230 section 6.1,
+// and the proxy related headers which are only meaningful to this proxy.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// RemoveHopHeaders removes the hop-by-hop headers from the header before it is forwarded,
+// including the headers listed in the Connection header and the extra headers.
+// The Upgrade header of an upgrade, e.g. of the websocket, is kept along with the Connection: Upgrade,
+// as the protocol switch is negotiated end to end through the proxy.
+func RemoveHopHeaders(header http.Header, extra ...string) {
+	upgrade := IsUpgrade(header)
+	keep := func(name string) bool {
+		return upgrade && (strings.EqualFold(name, "Connection") || strings.EqualFold(name, "Upgrade"))
+	}
+
+	// the headers listed in Connection must be collected before Connection itself is removed.
+	for _, v := range header.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			if name = textproto.TrimString(name); name != "" && !keep(name) {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		if !keep(name) {
+			header.Del(name)
+		}
+	}
+	if upgrade {
+		// the other options of the connection, e.g. keep-alive, are not forwarded.
+		header.Set("Connection", "Upgrade")
+	}
+	for _, name := range extra {
+		header.Del(name)
+	}
+}
+
+// IsUpgrade reports whether the header requests or accepts a protocol upgrade,
+// it has the Upgrade header and the upgrade option in the Connection header.
+func IsUpgrade(header http.Header) bool {
+	return header.Get("Upgrade") != "" &&
+		httpguts.HeaderValuesContainsToken(header.Values("Connection"), "upgrade")
+}
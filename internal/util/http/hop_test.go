@@ -0,0 +1,81 @@
+package http
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRemoveHopHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		extra  []string
+		want   http.Header
+	}{
+		{
+			name: "hop-by-hop",
+			header: http.Header{
+				"Connection":          {"keep-alive, X-Hop"},
+				"Keep-Alive":          {"timeout=5"},
+				"Proxy-Authorization": {"Basic dXNlcjpwYXNz"},
+				"X-Hop":               {"1"},
+				"Cookie":              {"a=1"},
+			},
+			want: http.Header{"Cookie": {"a=1"}},
+		},
+		{
+			name: "extra",
+			header: http.Header{
+				"X-Secret": {"1"},
+				"Cookie":   {"a=1"},
+			},
+			extra: []string{"X-Secret"},
+			want:  http.Header{"Cookie": {"a=1"}},
+		},
+		{
+			name: "upgrade",
+			header: http.Header{
+				"Connection":            {"keep-alive, Upgrade"},
+				"Keep-Alive":            {"timeout=5"},
+				"Upgrade":               {"websocket"},
+				"Sec-Websocket-Key":     {"dGhlIHNhbXBsZSBub25jZQ=="},
+				"Sec-Websocket-Version": {"13"},
+			},
+			want: http.Header{
+				"Connection":            {"Upgrade"},
+				"Upgrade":               {"websocket"},
+				"Sec-Websocket-Key":     {"dGhlIHNhbXBsZSBub25jZQ=="},
+				"Sec-Websocket-Version": {"13"},
+			},
+		},
+		{
+			name: "upgrade response",
+			header: http.Header{
+				"Connection":           {"upgrade"},
+				"Upgrade":              {"websocket"},
+				"Sec-Websocket-Accept": {"s3pPLMBiTxaQ9kYGzzhZRbK+xOo="},
+			},
+			want: http.Header{
+				"Connection":           {"Upgrade"},
+				"Upgrade":              {"websocket"},
+				"Sec-Websocket-Accept": {"s3pPLMBiTxaQ9kYGzzhZRbK+xOo="},
+			},
+		},
+		{
+			// the Upgrade header not listed in Connection is not an upgrade.
+			name:   "upgrade without connection",
+			header: http.Header{"Upgrade": {"websocket"}},
+			want:   http.Header{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			RemoveHopHeaders(tt.header, tt.extra...)
+			if !reflect.DeepEqual(tt.header, tt.want) {
+				t.Errorf("got %v, want %v", tt.header, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultMaxRequestLine = 8 * 1024
+	defaultMaxHeaders     = 100
+)
+
+var (
+	ErrHeaderTooLarge     = errors.New("http: request header too large")
+	ErrRequestLineTooLong = errors.New("http: request line too long")
+	ErrTooManyHeaders     = errors.New("http: too many header fields")
+)
+
+// RequestLimits limits the request line and the header of the HTTP/1.x requests read by RequestReader.
+type RequestLimits struct {
+	// MaxHeaderBytes is the max bytes of the request line and the header, 1MB if not set.
+	MaxHeaderBytes int
+	// MaxRequestLine is the max length of the request line, 8KB if not set.
+	MaxRequestLine int
+	// MaxHeaders is the max number of the header fields, 100 if not set.
+	MaxHeaders int
+	// Timeout is the time to read the request line and the header, none if not set.
+	Timeout time.Duration
+}
+
+// StatusCode returns the status code of the response to the request violating the limits,
+// 0 is returned if err is not a violation.
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrRequestLineTooLong):
+		return http.StatusRequestURITooLong
+	case errors.Is(err, ErrHeaderTooLarge), errors.Is(err, ErrTooManyHeaders):
+		return http.StatusRequestHeaderFieldsTooLarge
+	default:
+		return 0
+	}
+}
+
+// RequestReader reads the HTTP/1.x requests from the connection with the limits,
+// so a hostile client can not hold the memory with the unbounded header.
+type RequestReader struct {
+	conn   net.Conn
+	lr     *headerLimitReader
+	br     *bufio.Reader
+	limits RequestLimits
+}
+
+func NewRequestReader(conn net.Conn, limits *RequestLimits) *RequestReader {
+	r := &RequestReader{
+		conn: conn,
+		lr:   &headerLimitReader{r: conn, n: -1},
+	}
+	if limits != nil {
+		r.limits = *limits
+	}
+	if r.limits.MaxHeaderBytes <= 0 {
+		r.limits.MaxHeaderBytes = http.DefaultMaxHeaderBytes
+	}
+	if r.limits.MaxRequestLine <= 0 {
+		r.limits.MaxRequestLine = defaultMaxRequestLine
+	}
+	if r.limits.MaxHeaders <= 0 {
+		r.limits.MaxHeaders = defaultMaxHeaders
+	}
+	r.br = bufio.NewReader(r.lr)
+	return r
+}
+
+// Reader returns the buffered reader of the connection, the body of the request is read from it.
+func (r *RequestReader) Reader() *bufio.Reader {
+	return r.br
+}
+
+// Peek peeks the first n bytes of the next request within the timeout.
+func (r *RequestReader) Peek(n int) ([]byte, error) {
+	if r.limits.Timeout > 0 {
+		r.conn.SetReadDeadline(time.Now().Add(r.limits.Timeout))
+		defer r.conn.SetReadDeadline(time.Time{})
+	}
+	return r.br.Peek(n)
+}
+
+// ReadRequest reads the next request, the request line and the header must be read within the timeout.
+// The bytes of the header are limited roughly, as the data buffered ahead is counted as well.
+func (r *RequestReader) ReadRequest() (*http.Request, error) {
+	if r.limits.Timeout > 0 {
+		r.conn.SetReadDeadline(time.Now().Add(r.limits.Timeout))
+		defer r.conn.SetReadDeadline(time.Time{})
+	}
+
+	// the slack of the buffer, as net/http does.
+	r.lr.n = int64(r.limits.MaxHeaderBytes) + 4096
+	req, err := http.ReadRequest(r.br)
+	exceeded := r.lr.n == 0
+	r.lr.n = -1
+
+	if err != nil {
+		if exceeded {
+			return nil, ErrHeaderTooLarge
+		}
+		return nil, err
+	}
+
+	if len(req.Method)+len(req.RequestURI)+len(req.Proto)+2 > r.limits.MaxRequestLine {
+		return nil, ErrRequestLineTooLong
+	}
+	n := 0
+	for _, v := range req.Header {
+		n += len(v)
+	}
+	if n > r.limits.MaxHeaders {
+		return nil, ErrTooManyHeaders
+	}
+	return req, nil
+}
+
+// headerLimitReader limits the bytes read to n, the negative n is no limit.
+type headerLimitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *headerLimitReader) Read(p []byte) (n int, err error) {
+	if r.n < 0 {
+		return r.r.Read(p)
+	}
+	if r.n == 0 {
+		return 0, ErrHeaderTooLarge
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	n, err = r.r.Read(p)
+	r.n -= int64(n)
+	return
+}
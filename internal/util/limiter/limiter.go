@@ -34,7 +34,8 @@ func (p *cachedTrafficLimiter) In(ctx context.Context, key string, opts ...limit
 		return nil
 	}
 
-	item := p.inLimits.Get(key)
+	ckey := cacheKey(key, opts)
+	item := p.inLimits.Get(ckey)
 	lim, _ := item.Value().(traffic.Limiter)
 	if !item.Expired() {
 		return lim
@@ -45,11 +46,11 @@ func (p *cachedTrafficLimiter) In(ctx context.Context, key string, opts ...limit
 		limNew = lim
 	}
 	if item == nil || !p.equal(lim, limNew) {
-		p.inLimits.Set(key, NewItem(limNew, p.ttl))
+		p.inLimits.Set(ckey, NewItem(limNew, p.ttl))
 		return limNew
 	}
 
-	p.inLimits.Set(key, NewItem(lim, p.ttl))
+	p.inLimits.Set(ckey, NewItem(lim, p.ttl))
 
 	return lim
 }
@@ -59,7 +60,8 @@ func (p *cachedTrafficLimiter) Out(ctx context.Context, key string, opts ...limi
 		return nil
 	}
 
-	item := p.outLimits.Get(key)
+	ckey := cacheKey(key, opts)
+	item := p.outLimits.Get(ckey)
 	lim, _ := item.Value().(traffic.Limiter)
 	if !item.Expired() {
 		return lim
@@ -70,11 +72,11 @@ func (p *cachedTrafficLimiter) Out(ctx context.Context, key string, opts ...limi
 		limNew = lim
 	}
 	if item == nil || !p.equal(lim, limNew) {
-		p.outLimits.Set(key, NewItem(limNew, p.ttl))
+		p.outLimits.Set(ckey, NewItem(limNew, p.ttl))
 		return limNew
 	}
 
-	p.outLimits.Set(key, NewItem(lim, p.ttl))
+	p.outLimits.Set(ckey, NewItem(lim, p.ttl))
 
 	return lim
 }
@@ -90,3 +92,16 @@ func (p *cachedTrafficLimiter) equal(lim1, lim2 traffic.Limiter) bool {
 
 	return lim1.Limit() == lim2.Limit()
 }
+
+// cacheKey qualifies the key with the scope,
+// so the limiters of the same key in different scopes (e.g. client and tunnel) are cached separately.
+func cacheKey(key string, opts []limiter.Option) string {
+	var options limiter.Options
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.Scope == "" {
+		return key
+	}
+	return options.Scope + "/" + key
+}
@@ -0,0 +1,147 @@
+package mux
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/golang/snappy"
+)
+
+var (
+	// compressionMagic is sent by the client to request the compression of the session,
+	// and echoed by the server to accept it.
+	// The first byte is not a valid smux version, so a peer without compression fails on it.
+	compressionMagic = [4]byte{0xC0, 'S', 'Z', 0x01}
+
+	ErrCompressionRejected = errors.New("mux: compression is not accepted by the peer")
+	ErrCompressionInvalid  = errors.New("mux: invalid compression preamble")
+)
+
+// clientCompressConn requests the compression of the session and waits for the server to accept it.
+func clientCompressConn(conn net.Conn) (net.Conn, error) {
+	if _, err := conn.Write(compressionMagic[:]); err != nil {
+		return nil, err
+	}
+
+	var b [len(compressionMagic)]byte
+	if _, err := io.ReadFull(conn, b[:]); err != nil {
+		// the peer without compression closes the connection on the preamble.
+		return nil, ErrCompressionRejected
+	}
+	if b != compressionMagic {
+		return nil, ErrCompressionRejected
+	}
+	return newCompressConn(conn), nil
+}
+
+// serverCompressConn accepts the compression if requested by the client.
+// The preamble is detected on the first read, the clients without compression are served as is.
+type serverCompressConn struct {
+	net.Conn
+	once  sync.Once
+	ready chan struct{}
+	rw    io.ReadWriter
+	err   error
+}
+
+func newServerCompressConn(conn net.Conn) net.Conn {
+	return &serverCompressConn{
+		Conn:  conn,
+		ready: make(chan struct{}),
+	}
+}
+
+func (c *serverCompressConn) negotiate() {
+	defer close(c.ready)
+
+	var b [len(compressionMagic)]byte
+	if _, c.err = io.ReadFull(c.Conn, b[:1]); c.err != nil {
+		return
+	}
+	if b[0] != compressionMagic[0] {
+		c.rw = &readWriter{
+			Reader: io.MultiReader(bytes.NewReader(b[:1]), c.Conn),
+			Writer: c.Conn,
+		}
+		return
+	}
+
+	if _, c.err = io.ReadFull(c.Conn, b[1:]); c.err != nil {
+		return
+	}
+	if b != compressionMagic {
+		c.err = ErrCompressionInvalid
+		return
+	}
+	if _, c.err = c.Conn.Write(compressionMagic[:]); c.err != nil {
+		return
+	}
+	c.rw = newCompressConn(c.Conn)
+}
+
+// compressed reports whether the compression is accepted, it does not wait for the negotiation.
+func (c *serverCompressConn) compressed() bool {
+	select {
+	case <-c.ready:
+		_, ok := c.rw.(*compressConn)
+		return ok
+	default:
+		return false
+	}
+}
+
+func (c *serverCompressConn) Read(b []byte) (n int, err error) {
+	c.once.Do(c.negotiate)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.rw.Read(b)
+}
+
+// Write waits for the negotiation, the server does not send anything before the client.
+func (c *serverCompressConn) Write(b []byte) (n int, err error) {
+	<-c.ready
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.rw.Write(b)
+}
+
+type compressConn struct {
+	net.Conn
+	w  *snappy.Writer
+	r  *snappy.Reader
+	mu sync.Mutex
+}
+
+func newCompressConn(conn net.Conn) *compressConn {
+	return &compressConn{
+		Conn: conn,
+		w:    snappy.NewBufferedWriter(conn),
+		r:    snappy.NewReader(conn),
+	}
+}
+
+func (c *compressConn) Read(b []byte) (n int, err error) {
+	return c.r.Read(b)
+}
+
+func (c *compressConn) Write(b []byte) (n int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, err = c.w.Write(b)
+	if err != nil {
+		return
+	}
+	err = c.w.Flush()
+	return n, err
+}
+
+type readWriter struct {
+	io.Reader
+	io.Writer
+}
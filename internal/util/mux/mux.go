@@ -1,7 +1,11 @@
 package mux
 
 import (
+	"encoding/binary"
+	"fmt"
+	"io"
 	"net"
+	"sync/atomic"
 	"time"
 
 	smux "github.com/xtaci/smux"
@@ -36,6 +40,11 @@ type Config struct {
 	// MaxStreamBuffer is used to control the maximum
 	// number of data per stream
 	MaxStreamBuffer int
+
+	// Compression enables the snappy compression of the session.
+	// The client requests it and fails if the server does not accept,
+	// the server accepts it only if requested by the client.
+	Compression bool
 }
 
 func convertConfig(cfg *Config) *smux.Config {
@@ -69,30 +78,92 @@ func convertConfig(cfg *Config) *smux.Config {
 	return smuxCfg
 }
 
+// SessionInfo describes the parameters in effect of a session, for debugging.
+// The version, the peer stream window and the compression are the ones negotiated with the peer,
+// the others are the local settings.
+type SessionInfo struct {
+	// Library is the multiplexing library of the session.
+	Library string `json:"library"`
+	// Version is the protocol version of the frames received from the peer,
+	// it is the local one until the first frame is received.
+	Version           int           `json:"version"`
+	KeepAliveDisabled bool          `json:"keepAliveDisabled,omitempty"`
+	KeepAliveInterval time.Duration `json:"keepAliveInterval"`
+	KeepAliveTimeout  time.Duration `json:"keepAliveTimeout"`
+	MaxFrameSize      int           `json:"maxFrameSize"`
+	// SessionWindow is the receive buffer shared by the streams of the session.
+	SessionWindow int `json:"sessionWindow"`
+	// StreamWindow is the receive window of a stream, it is used by the version 2 only.
+	StreamWindow int `json:"streamWindow"`
+	// PeerStreamWindow is the receive window of a stream advertised by the peer, which limits the sending,
+	// it is zero until the first window update of the version 2 is received.
+	PeerStreamWindow int  `json:"peerStreamWindow,omitempty"`
+	Compression      bool `json:"compression"`
+}
+
+func (info SessionInfo) String() string {
+	keepalive := "off"
+	if !info.KeepAliveDisabled {
+		keepalive = info.KeepAliveInterval.String() + "/" + info.KeepAliveTimeout.String()
+	}
+	return fmt.Sprintf("%s/v%d window=%d/%d peer-window=%d frame=%d keepalive=%s compression=%v",
+		info.Library, info.Version, info.SessionWindow, info.StreamWindow, info.PeerStreamWindow,
+		info.MaxFrameSize, keepalive, info.Compression)
+}
+
 type Session struct {
 	conn    net.Conn
 	session *smux.Session
+	cfg     *smux.Config
+	// rwc is the underlying stream of the session, it is the compressed one if the compression is used.
+	rwc io.ReadWriteCloser
+	// peer observes the frames received from the peer.
+	peer *peerFrames
 }
 
 func ClientSession(conn net.Conn, cfg *Config) (*Session, error) {
-	s, err := smux.Client(conn, convertConfig(cfg))
+	rwc := io.ReadWriteCloser(conn)
+	if cfg != nil && cfg.Compression {
+		cc, err := clientCompressConn(conn)
+		if err != nil {
+			return nil, err
+		}
+		rwc = cc
+	}
+
+	smuxCfg := convertConfig(cfg)
+	peer := &peerFrames{ReadWriteCloser: rwc}
+	s, err := smux.Client(peer, smuxCfg)
 	if err != nil {
 		return nil, err
 	}
 	return &Session{
 		conn:    conn,
 		session: s,
+		cfg:     smuxCfg,
+		rwc:     rwc,
+		peer:    peer,
 	}, nil
 }
 
 func ServerSession(conn net.Conn, cfg *Config) (*Session, error) {
-	s, err := smux.Server(conn, convertConfig(cfg))
+	rwc := io.ReadWriteCloser(conn)
+	if cfg != nil && cfg.Compression {
+		rwc = newServerCompressConn(conn)
+	}
+
+	smuxCfg := convertConfig(cfg)
+	peer := &peerFrames{ReadWriteCloser: rwc}
+	s, err := smux.Server(peer, smuxCfg)
 	if err != nil {
 		return nil, err
 	}
 	return &Session{
 		conn:    conn,
 		session: s,
+		cfg:     smuxCfg,
+		rwc:     rwc,
+		peer:    peer,
 	}, nil
 }
 
@@ -119,6 +190,11 @@ func (session *Session) Close() error {
 	return session.session.Close()
 }
 
+// CloseChan returns the channel closed once the session is closed.
+func (session *Session) CloseChan() <-chan struct{} {
+	return session.session.CloseChan()
+}
+
 func (session *Session) IsClosed() bool {
 	if session.session == nil {
 		return true
@@ -126,10 +202,106 @@ func (session *Session) IsClosed() bool {
 	return session.session.IsClosed()
 }
 
+// Info returns the parameters of the session.
+// The negotiated ones are reported once the frames of the peer are received,
+// and for the server session, the compression once it is negotiated with the first read.
+func (session *Session) Info() SessionInfo {
+	if session == nil || session.cfg == nil {
+		return SessionInfo{}
+	}
+
+	info := SessionInfo{
+		Library:           "smux",
+		Version:           session.cfg.Version,
+		KeepAliveDisabled: session.cfg.KeepAliveDisabled,
+		KeepAliveInterval: session.cfg.KeepAliveInterval,
+		KeepAliveTimeout:  session.cfg.KeepAliveTimeout,
+		MaxFrameSize:      session.cfg.MaxFrameSize,
+		SessionWindow:     session.cfg.MaxReceiveBuffer,
+		StreamWindow:      session.cfg.MaxStreamBuffer,
+	}
+	if session.peer != nil {
+		if v := session.peer.version.Load(); v > 0 {
+			info.Version = int(v)
+		}
+		info.PeerStreamWindow = int(session.peer.window.Load())
+	}
+	switch rwc := session.rwc.(type) {
+	case *compressConn:
+		info.Compression = true
+	case *serverCompressConn:
+		info.Compression = rwc.compressed()
+	}
+	return info
+}
+
 func (session *Session) NumStreams() int {
 	return session.session.NumStreams()
 }
 
+const (
+	// the smux frame header: version(1) cmd(1) length(2) sid(4), the integers are little-endian.
+	frameHeaderLen = 8
+	// the window update of the version 2: consumed(4) window(4).
+	frameCmdUPD = 4
+	frameUPDLen = 8
+	frameCmdPSH = 2
+)
+
+// peerFrames observes the frames received from the peer for the negotiated parameters of the session,
+// the version of the frames and the stream window advertised by the window updates.
+// It is read by the receiving goroutine of the session only.
+type peerFrames struct {
+	io.ReadWriteCloser
+	hdr     [frameHeaderLen]byte
+	upd     [frameUPDLen]byte
+	nhdr    int
+	nupd    int
+	payload int
+	version atomic.Int32
+	window  atomic.Int64
+}
+
+func (p *peerFrames) Read(b []byte) (n int, err error) {
+	n, err = p.ReadWriteCloser.Read(b)
+	p.observe(b[:n])
+	return
+}
+
+func (p *peerFrames) observe(b []byte) {
+	for len(b) > 0 {
+		switch {
+		case p.payload > 0:
+			// the data of the PSH frames is skipped.
+			m := min(p.payload, len(b))
+			p.payload -= m
+			b = b[m:]
+		case p.nupd > 0:
+			m := copy(p.upd[frameUPDLen-p.nupd:], b)
+			p.nupd -= m
+			b = b[m:]
+			if p.nupd == 0 {
+				p.window.Store(int64(binary.LittleEndian.Uint32(p.upd[4:])))
+			}
+		default:
+			m := copy(p.hdr[p.nhdr:], b)
+			p.nhdr += m
+			b = b[m:]
+			if p.nhdr < frameHeaderLen {
+				return
+			}
+			p.nhdr = 0
+			p.version.Store(int32(p.hdr[0]))
+			switch p.hdr[1] {
+			case frameCmdPSH:
+				p.payload = int(binary.LittleEndian.Uint16(p.hdr[2:]))
+			case frameCmdUPD:
+				p.nupd = frameUPDLen
+			}
+		}
+	}
+}
+
 type streamConn struct {
 	net.Conn
 	stream *smux.Stream
@@ -0,0 +1,85 @@
+package mux
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSessionInfoNegotiated(t *testing.T) {
+	const clientWindow, serverWindow = 64 * 1024, 128 * 1024
+
+	tests := []struct {
+		version     int
+		compression bool
+		// the peer stream window of the client after the data is sent.
+		peerWindow int
+	}{
+		{version: 1},
+		{version: 2, peerWindow: serverWindow},
+		{version: 2, compression: true, peerWindow: serverWindow},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("v%d compression=%v", tt.version, tt.compression), func(t *testing.T) {
+			sc, cc := net.Pipe()
+			errc := make(chan error, 1)
+			var server *Session
+			go func() {
+				s, err := ServerSession(sc, &Config{Version: tt.version, MaxStreamBuffer: serverWindow, Compression: true})
+				server = s
+				errc <- err
+			}()
+			client, err := ClientSession(cc, &Config{Version: tt.version, MaxStreamBuffer: clientWindow, Compression: tt.compression})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			if err := <-errc; err != nil {
+				t.Fatal(err)
+			}
+			defer server.Close()
+
+			// the server stream window is advertised as the data is consumed.
+			data := bytes.Repeat([]byte("0123456789abcdef"), serverWindow/8)
+			go func() {
+				conn, err := client.GetConn()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				conn.Write(data)
+			}()
+			conn, err := server.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.CopyN(io.Discard, conn, int64(len(data))); err != nil {
+				t.Fatal(err)
+			}
+			conn.Close()
+
+			var info SessionInfo
+			for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+				if info = client.Info(); info.PeerStreamWindow == tt.peerWindow {
+					break
+				}
+			}
+			if info.Version != tt.version {
+				t.Errorf("version: got %d, want %d", info.Version, tt.version)
+			}
+			if info.StreamWindow != clientWindow || info.PeerStreamWindow != tt.peerWindow {
+				t.Errorf("stream window: got %d/%d, want %d/%d", info.StreamWindow, info.PeerStreamWindow, clientWindow, tt.peerWindow)
+			}
+			if info.Compression != tt.compression {
+				t.Errorf("client compression: got %v, want %v", info.Compression, tt.compression)
+			}
+			if sinfo := server.Info(); sinfo.Version != tt.version || sinfo.Compression != tt.compression {
+				t.Errorf("server: got version %d compression %v, want %d %v", sinfo.Version, sinfo.Compression, tt.version, tt.compression)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package port
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/go-gost/core/metrics"
+	xmetrics "github.com/go-gost/x/metrics"
+)
+
+var (
+	ErrInvalidPort = errors.New("port: invalid port")
+	ErrPortDenied  = errors.New("port: not allowed")
+)
+
+type portRange struct {
+	min, max int
+}
+
+func (r portRange) contains(port int) bool {
+	return port >= r.min && port <= r.max
+}
+
+// Policy restricts the ports of the targets the handler connects to.
+// The ports are specified by the metadata ports.allow and ports.deny, each entry is one of:
+//
+//	443 - a single port.
+//	1024-65535 - the ports in the range, inclusive.
+//	* - any port.
+//
+// The denied ports take precedence over the allowed ports,
+// and only the allowed ports are permitted if ports.allow is not empty.
+type Policy struct {
+	service string
+	allow   []portRange
+	deny    []portRange
+}
+
+// NewPolicy creates the policy of the service, nil is returned if both of the lists are empty,
+// and the nil policy permits any port.
+func NewPolicy(service string, allow, deny []string) (*Policy, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+
+	p := &Policy{
+		service: service,
+	}
+	var err error
+	if p.allow, err = parseRanges(allow); err != nil {
+		return nil, err
+	}
+	if p.deny, err = parseRanges(deny); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func parseRanges(ss []string) (ranges []portRange, err error) {
+	for _, s := range ss {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if s == "*" {
+			ranges = append(ranges, portRange{min: 0, max: 65535})
+			continue
+		}
+
+		lo, hi, found := strings.Cut(s, "-")
+		r := portRange{}
+		if r.min, err = parsePort(lo); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPort, s)
+		}
+		r.max = r.min
+		if found {
+			if r.max, err = parsePort(hi); err != nil || r.max < r.min {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidPort, s)
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return
+}
+
+func parsePort(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > 65535 {
+		return 0, ErrInvalidPort
+	}
+	return n, nil
+}
+
+// Check checks the port of the target address (host:port) is permitted, the denied port is reported in the error.
+// The address without a valid port is denied by the non-nil policy,
+// and the denials are counted for the service.
+func (p *Policy) Check(addr string) error {
+	if p == nil {
+		return nil
+	}
+
+	_, sp, err := net.SplitHostPort(addr)
+	if err == nil {
+		var port int
+		if port, err = parsePort(sp); err == nil && p.allowed(port) {
+			return nil
+		}
+	}
+
+	if v := xmetrics.GetCounter(xmetrics.MetricServicePortDeniedCounter,
+		metrics.Labels{"service": p.service}); v != nil {
+		v.Inc()
+	}
+	return fmt.Errorf("%w: %q", ErrPortDenied, sp)
+}
+
+func (p *Policy) allowed(port int) bool {
+	for _, r := range p.deny {
+		if r.contains(port) {
+			return false
+		}
+	}
+	if len(p.allow) == 0 {
+		return true
+	}
+	for _, r := range p.allow {
+		if r.contains(port) {
+			return true
+		}
+	}
+	return false
+}
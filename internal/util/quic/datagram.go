@@ -0,0 +1,169 @@
+package quic
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	// MetadataKeyDatagramSession is the metadata key of the connection carrying the *DatagramSession.
+	MetadataKeyDatagramSession = "quic.datagramSession"
+
+	datagramHeaderLen = 4
+	datagramQueueSize = 128
+)
+
+var (
+	ErrDatagramUnsupported = errors.New("quic: datagram is not supported")
+	ErrAssociationExists   = errors.New("quic: association already exists")
+)
+
+// DatagramSession dispatches the QUIC datagrams of a connection to the associations.
+//
+// Datagram format:
+//
+//	+----------+----------+
+//	| ASSOC ID |  PAYLOAD |
+//	+----------+----------+
+//	|    4     | Variable |
+//	+----------+----------+
+//
+//	ASSOC ID - association ID, 4 bytes, allocated by the side creating the association.
+//	PAYLOAD - UDP payload, variable length.
+type DatagramSession struct {
+	conn   quic.Connection
+	assocs sync.Map
+	seq    atomic.Uint32
+	once   sync.Once
+}
+
+func NewDatagramSession(conn quic.Connection) *DatagramSession {
+	return &DatagramSession{
+		conn: conn,
+	}
+}
+
+// Supported reports whether the QUIC datagram extension is negotiated by both sides.
+func (s *DatagramSession) Supported() bool {
+	return s != nil && s.conn.ConnectionState().SupportsDatagrams
+}
+
+// NewAssociation creates an association with a new ID.
+func (s *DatagramSession) NewAssociation() (*DatagramAssociation, error) {
+	return s.Associate(s.seq.Add(1))
+}
+
+// Associate creates an association with the ID allocated by the peer.
+func (s *DatagramSession) Associate(id uint32) (*DatagramAssociation, error) {
+	if !s.Supported() {
+		return nil, ErrDatagramUnsupported
+	}
+
+	assoc := &DatagramAssociation{
+		id:     id,
+		s:      s,
+		rch:    make(chan []byte, datagramQueueSize),
+		closed: make(chan struct{}),
+	}
+	if _, loaded := s.assocs.LoadOrStore(id, assoc); loaded {
+		return nil, ErrAssociationExists
+	}
+	s.once.Do(func() {
+		go s.receive()
+	})
+	return assoc, nil
+}
+
+func (s *DatagramSession) receive() {
+	ctx := s.conn.Context()
+	for {
+		b, err := s.conn.ReceiveDatagram(ctx)
+		if err != nil {
+			s.assocs.Range(func(key, value any) bool {
+				value.(*DatagramAssociation).Close()
+				return true
+			})
+			return
+		}
+		if len(b) < datagramHeaderLen {
+			continue
+		}
+		if v, ok := s.assocs.Load(binary.BigEndian.Uint32(b)); ok {
+			v.(*DatagramAssociation).Deliver(b[datagramHeaderLen:])
+		}
+	}
+}
+
+// DatagramAssociation is a UDP association carried by the QUIC datagrams.
+// Each Read or Write handles one UDP datagram.
+type DatagramAssociation struct {
+	id        uint32
+	s         *DatagramSession
+	rch       chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (a *DatagramAssociation) ID() uint32 {
+	return a.id
+}
+
+func (a *DatagramAssociation) Read(b []byte) (n int, err error) {
+	select {
+	case data := <-a.rch:
+		return copy(b, data), nil
+	case <-a.closed:
+		return 0, io.EOF
+	}
+}
+
+// Write sends b in a QUIC datagram.
+// It returns a *quic.DatagramTooLargeError if b exceeds the maximum datagram size.
+func (a *DatagramAssociation) Write(b []byte) (n int, err error) {
+	select {
+	case <-a.closed:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+
+	buf := make([]byte, datagramHeaderLen+len(b))
+	binary.BigEndian.PutUint32(buf, a.id)
+	copy(buf[datagramHeaderLen:], b)
+	if err = a.s.conn.SendDatagram(buf); err != nil {
+		return
+	}
+	return len(b), nil
+}
+
+// Deliver queues a datagram to be read, the datagram is dropped if the queue is full.
+func (a *DatagramAssociation) Deliver(b []byte) {
+	select {
+	case a.rch <- b:
+	case <-a.closed:
+	default:
+	}
+}
+
+// Push queues a datagram received from other path (e.g. the fallback stream) to be read,
+// it blocks until the datagram is queued or the association is closed.
+func (a *DatagramAssociation) Push(b []byte) error {
+	select {
+	case a.rch <- b:
+		return nil
+	case <-a.closed:
+		return io.ErrClosedPipe
+	}
+}
+
+func (a *DatagramAssociation) Close() error {
+	a.closeOnce.Do(func() {
+		a.s.assocs.Delete(a.id)
+		close(a.closed)
+	})
+	return nil
+}
@@ -0,0 +1,231 @@
+package quic
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// datagramPair returns the client and server sides of a loopback QUIC connection.
+func datagramPair(t *testing.T, datagram bool) (quic.Connection, quic.Connection) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qc := &quic.Config{EnableDatagrams: datagram}
+	ln, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{"test"},
+	}, qc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cc, err := quic.DialAddr(ctx, ln.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"test"},
+	}, qc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.CloseWithError(0, "") })
+
+	sc, err := ln.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sc.CloseWithError(0, "") })
+
+	return cc, sc
+}
+
+func readTimeout(t *testing.T, a *DatagramAssociation) []byte {
+	t.Helper()
+
+	type result struct {
+		b   []byte
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		b := make([]byte, 1500)
+		n, err := a.Read(b)
+		ch <- result{b[:n], err}
+	}()
+
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			t.Fatalf("read: %v", r.err)
+		}
+		return r.b
+	case <-time.After(3 * time.Second):
+		t.Fatal("read: timeout")
+	}
+	return nil
+}
+
+func TestDatagramAssociation(t *testing.T) {
+	cc, sc := datagramPair(t, true)
+
+	cs := NewDatagramSession(cc)
+	ss := NewDatagramSession(sc)
+	if !cs.Supported() || !ss.Supported() {
+		t.Fatal("datagram is not negotiated")
+	}
+
+	ca1, err := cs.NewAssociation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca2, err := cs.NewAssociation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca1.ID() == ca2.ID() {
+		t.Fatalf("duplicate association ID %d", ca1.ID())
+	}
+
+	sa1, err := ss.Associate(ca1.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sa2, err := ss.Associate(ca2.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ss.Associate(ca1.ID()); !errors.Is(err, ErrAssociationExists) {
+		t.Errorf("associate again: got %v, want %v", err, ErrAssociationExists)
+	}
+
+	// the datagrams are dispatched by the association ID.
+	if _, err := ca2.Write([]byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca1.Write([]byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if b := readTimeout(t, sa1); string(b) != "one" {
+		t.Errorf("association 1: got %q, want %q", b, "one")
+	}
+	if b := readTimeout(t, sa2); string(b) != "two" {
+		t.Errorf("association 2: got %q, want %q", b, "two")
+	}
+
+	if _, err := sa1.Write([]byte("reply")); err != nil {
+		t.Fatal(err)
+	}
+	if b := readTimeout(t, ca1); string(b) != "reply" {
+		t.Errorf("reply: got %q, want %q", b, "reply")
+	}
+
+	// the raw datagram carries the 4-byte big-endian association ID.
+	if err := sc.SendDatagram(append(binary.BigEndian.AppendUint32(nil, ca2.ID()), "raw"...)); err != nil {
+		t.Fatal(err)
+	}
+	if b := readTimeout(t, ca2); string(b) != "raw" {
+		t.Errorf("raw: got %q, want %q", b, "raw")
+	}
+
+	// the datagram exceeding the maximum datagram size is rejected.
+	_, err = ca1.Write(make([]byte, 64*1024))
+	var tooLarge *quic.DatagramTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Errorf("large datagram: got %v, want %T", err, tooLarge)
+	}
+
+	sa1.Close()
+	if _, err := sa1.Write([]byte("closed")); err == nil {
+		t.Error("write to closed association: got nil error")
+	}
+	if _, err := ss.Associate(ca1.ID()); err != nil {
+		t.Errorf("associate after close: %v", err)
+	}
+}
+
+func TestDatagramAssociationQueue(t *testing.T) {
+	cc, _ := datagramPair(t, true)
+
+	a, err := NewDatagramSession(cc).NewAssociation()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deliver drops the datagrams once the queue is full.
+	for i := 0; i < datagramQueueSize+10; i++ {
+		a.Deliver([]byte{byte(i)})
+	}
+	if n := len(a.rch); n != datagramQueueSize {
+		t.Errorf("queued %d datagrams, want %d", n, datagramQueueSize)
+	}
+	for i := 0; i < datagramQueueSize; i++ {
+		if b := readTimeout(t, a); !bytes.Equal(b, []byte{byte(i)}) {
+			t.Fatalf("datagram %d: got %v", i, b)
+		}
+	}
+
+	// Push blocks until the datagram is queued.
+	for i := 0; i < datagramQueueSize; i++ {
+		a.Deliver([]byte{0})
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- a.Push([]byte("pushed"))
+	}()
+	select {
+	case err := <-errc:
+		t.Fatalf("push to full queue returned %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	readTimeout(t, a)
+	if err := <-errc; err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	a.Close()
+	if err := a.Push([]byte("closed")); err == nil {
+		t.Error("push to closed association: got nil error")
+	}
+}
+
+func TestDatagramUnsupported(t *testing.T) {
+	cc, _ := datagramPair(t, false)
+
+	s := NewDatagramSession(cc)
+	if s.Supported() {
+		t.Error("datagram is negotiated")
+	}
+	if _, err := s.NewAssociation(); !errors.Is(err, ErrDatagramUnsupported) {
+		t.Errorf("got %v, want %v", err, ErrDatagramUnsupported)
+	}
+}
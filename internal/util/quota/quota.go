@@ -0,0 +1,197 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/units"
+	"github.com/go-gost/core/metrics"
+	xmetrics "github.com/go-gost/x/metrics"
+)
+
+const (
+	// the traffic counted by a connection locally before it is added to the store.
+	countBatch = 64 * 1024
+	dayLayout  = "2006-01-02"
+)
+
+var (
+	ErrConnExceeded  = errors.New("quota: connection traffic exceeded")
+	ErrDailyExceeded = errors.New("quota: daily traffic exceeded")
+	ErrInvalidSize   = errors.New("quota: invalid size")
+)
+
+// IsExceeded reports whether the err is caused by a quota.
+func IsExceeded(err error) bool {
+	return errors.Is(err, ErrConnExceeded) || errors.Is(err, ErrDailyExceeded)
+}
+
+// ParseSize parses the size in bytes, such as 10GB, 512MB or 1024, the empty size is zero.
+// ErrInvalidSize is returned for the malformed or negative size.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		var b units.Base2Bytes
+		if b, err = units.ParseBase2Bytes(strings.ToUpper(s)); err != nil {
+			return 0, fmt.Errorf("%w %q: %v", ErrInvalidSize, s, err)
+		}
+		v = int64(b)
+	}
+	if v < 0 {
+		return 0, fmt.Errorf("%w %q", ErrInvalidSize, s)
+	}
+	return v, nil
+}
+
+type Options struct {
+	// Conn is the max traffic of a connection in bytes, zero means no limit.
+	Conn int64
+	// Daily is the max traffic of a client per day (UTC) in bytes, zero means no limit.
+	Daily int64
+	// Store keeps the daily traffic of the clients, the in-memory store is used if nil.
+	Store Store
+	// Service is the name of the service for the metrics.
+	Service string
+}
+
+// Quota caps the traffic of the connections and the daily traffic of the clients.
+// The traffic of both directions is counted.
+type Quota struct {
+	options Options
+}
+
+// New creates a Quota, nil is returned if no quota is set,
+// and the nil Quota does not limit anything.
+func New(opts Options) *Quota {
+	if opts.Conn <= 0 && opts.Daily <= 0 {
+		return nil
+	}
+	if opts.Daily > 0 && opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	return &Quota{
+		options: opts,
+	}
+}
+
+// Check checks the daily quota of the client at connect time.
+// The client without ID is not limited by the daily quota.
+func (q *Quota) Check(ctx context.Context, client string) error {
+	if q == nil || q.options.Daily <= 0 || client == "" {
+		return nil
+	}
+
+	n, err := q.options.Store.Get(ctx, client, today())
+	if err != nil {
+		// the store failure does not block the clients.
+		return nil
+	}
+	if n >= q.options.Daily {
+		q.observe("daily")
+		return ErrDailyExceeded
+	}
+	return nil
+}
+
+// Counter creates the counter of a connection of the client.
+func (q *Quota) Counter(ctx context.Context, client string) *Counter {
+	if q == nil {
+		return nil
+	}
+	return &Counter{
+		q:      q,
+		ctx:    context.WithoutCancel(ctx),
+		client: client,
+	}
+}
+
+func (q *Quota) observe(quota string) {
+	if v := xmetrics.GetCounter(xmetrics.MetricServiceQuotaExceededCounter,
+		metrics.Labels{"service": q.options.Service, "quota": quota}); v != nil {
+		v.Inc()
+	}
+}
+
+// Counter counts the traffic of a connection against the quotas.
+// Close must be called when the connection is closed, so the remaining traffic is added to the store.
+type Counter struct {
+	q       *Quota
+	ctx     context.Context
+	client  string
+	total   int64
+	pending int64
+	// the quota exceeded, the following counts fail with it.
+	err error
+	mu  sync.Mutex
+}
+
+// Count counts n bytes, an error is returned once a quota is exceeded.
+func (c *Counter) Count(n int) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+
+	c.total += int64(n)
+	if conn := c.q.options.Conn; conn > 0 && c.total > conn {
+		c.exceed(ErrConnExceeded, "conn")
+		return c.err
+	}
+
+	c.pending += int64(n)
+	if c.pending >= countBatch {
+		c.flush()
+	}
+	return c.err
+}
+
+// Close adds the remaining traffic to the store.
+func (c *Counter) Close() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.flush()
+	return nil
+}
+
+func (c *Counter) flush() {
+	if c.pending == 0 || c.q.options.Daily <= 0 || c.client == "" {
+		c.pending = 0
+		return
+	}
+
+	n, err := c.q.options.Store.Add(c.ctx, c.client, today(), c.pending)
+	c.pending = 0
+	if err == nil && n > c.q.options.Daily && c.err == nil {
+		c.exceed(ErrDailyExceeded, "daily")
+	}
+}
+
+func (c *Counter) exceed(err error, quota string) {
+	c.err = err
+	c.q.observe(quota)
+}
+
+func today() string {
+	return time.Now().UTC().Format(dayLayout)
+}
@@ -0,0 +1,38 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+		err  error
+	}{
+		{s: ""},
+		{s: "0"},
+		{s: "1024", want: 1024},
+		{s: " 512MB ", want: 512 << 20},
+		{s: "10gb", want: 10 << 30},
+		{s: "1.5GB", want: 3 << 29},
+		{s: "10G", err: ErrInvalidSize},
+		{s: "10 GB", err: ErrInvalidSize},
+		{s: "abc", err: ErrInvalidSize},
+		{s: "-1", err: ErrInvalidSize},
+		{s: "-1GB", err: ErrInvalidSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			v, err := ParseSize(tt.s)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if v != tt.want {
+				t.Errorf("got %d, want %d", v, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/logger"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	defaultFileFlushInterval = 10 * time.Second
+	// the daily counters in redis are kept for a while after the day for inspection.
+	redisKeyTTL = 48 * time.Hour
+)
+
+// Store keeps the daily traffic of the clients.
+type Store interface {
+	// Add adds n bytes to the traffic of the client on the day, and returns the total.
+	Add(ctx context.Context, client string, day string, n int64) (int64, error)
+	// Get returns the traffic of the client on the day.
+	Get(ctx context.Context, client string, day string) (int64, error)
+}
+
+// memoryStore keeps the traffic of the current day in memory,
+// the counters of the previous days are dropped.
+type memoryStore struct {
+	Day     string           `json:"day"`
+	Clients map[string]int64 `json:"clients"`
+	mu      sync.Mutex
+}
+
+func NewMemoryStore() Store {
+	return newMemoryStore()
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		Clients: make(map[string]int64),
+	}
+}
+
+func (s *memoryStore) Add(ctx context.Context, client string, day string, n int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rotate(day)
+	s.Clients[client] += n
+	return s.Clients[client], nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, client string, day string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rotate(day)
+	return s.Clients[client], nil
+}
+
+func (s *memoryStore) rotate(day string) {
+	if s.Day == day {
+		return
+	}
+	s.Day = day
+	s.Clients = make(map[string]int64)
+}
+
+var (
+	fileStores   = map[string]*fileStore{}
+	fileStoresMu sync.Mutex
+)
+
+// fileStore is the memory store persisted in a file periodically,
+// so the counters survive the reload of the handlers and the restart of the process.
+type fileStore struct {
+	*memoryStore
+	file  string
+	dirty bool
+	log   logger.Logger
+}
+
+// NewFileStore returns the store persisted in the file.
+// The store of a file is shared by the handlers, and kept across the reloads of them.
+func NewFileStore(file string, log logger.Logger) Store {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+
+	fileStoresMu.Lock()
+	defer fileStoresMu.Unlock()
+
+	if s := fileStores[file]; s != nil {
+		return s
+	}
+
+	s := &fileStore{
+		memoryStore: newMemoryStore(),
+		file:        file,
+		log:         log,
+	}
+	if err := s.load(); err != nil {
+		log.Warnf("load quota %s: %v", file, err)
+	}
+	fileStores[file] = s
+	go s.run()
+
+	return s
+}
+
+func (s *fileStore) Add(ctx context.Context, client string, day string, n int64) (int64, error) {
+	v, err := s.memoryStore.Add(ctx, client, day, n)
+
+	s.mu.Lock()
+	s.dirty = true
+	s.mu.Unlock()
+
+	return v, err
+}
+
+func (s *fileStore) run() {
+	ticker := time.NewTicker(defaultFileFlushInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.save(); err != nil {
+			s.log.Warnf("save quota %s: %v", s.file, err)
+		}
+	}
+}
+
+func (s *fileStore) load() error {
+	b, err := os.ReadFile(s.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	ms := newMemoryStore()
+	if err := json.Unmarshal(b, ms); err != nil {
+		return err
+	}
+	if ms.Clients == nil {
+		ms.Clients = make(map[string]int64)
+	}
+	s.memoryStore = ms
+	return nil
+}
+
+// save writes the counters to the file if changed, the file is replaced atomically.
+func (s *fileStore) save() error {
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	s.dirty = false
+	b, err := json.Marshal(s.memoryStore)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.file), filepath.Base(s.file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.file)
+}
+
+type RedisStoreOptions struct {
+	DB       int
+	Password string
+	// Key is the prefix of the keys of the counters, the key of a counter is <prefix>:<day>:<client>.
+	Key string
+}
+
+// redisStore keeps the counters in redis, so they are shared by the nodes.
+type redisStore struct {
+	client *redis.Client
+	key    string
+}
+
+func NewRedisStore(addr string, opts RedisStoreOptions) Store {
+	if opts.Key == "" {
+		opts.Key = "gost:quota"
+	}
+	return &redisStore{
+		client: redis.NewClient(&redis.Options{
+			Addr:     addr,
+			Password: opts.Password,
+			DB:       opts.DB,
+		}),
+		key: opts.Key,
+	}
+}
+
+func (s *redisStore) Add(ctx context.Context, client string, day string, n int64) (int64, error) {
+	key := s.key + ":" + day + ":" + client
+
+	pipe := s.client.TxPipeline()
+	v := pipe.IncrBy(ctx, key, n)
+	pipe.Expire(ctx, key, redisKeyTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return v.Val(), nil
+}
+
+func (s *redisStore) Get(ctx context.Context, client string, day string) (int64, error) {
+	v, err := s.client.Get(ctx, s.key+":"+day+":"+client).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return v, err
+}
+
+// NewStore creates the store of the daily counters, the redis store is preferred if the address is set,
+// then the file store. nil is returned if neither is set.
+func NewStore(file string, redisAddr string, redisOpts RedisStoreOptions, log logger.Logger) Store {
+	switch {
+	case redisAddr != "":
+		return NewRedisStore(redisAddr, redisOpts)
+	case file != "":
+		return NewFileStore(file, log)
+	}
+	return nil
+}
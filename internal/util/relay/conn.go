@@ -2,11 +2,42 @@ package relay
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"math"
 	"net"
+	"sync"
 
 	"github.com/go-gost/core/common/bufpool"
 	"github.com/go-gost/gosocks5"
 	"github.com/go-gost/relay"
+	"github.com/golang/snappy"
+)
+
+const (
+	// DefaultMaxDatagramSize is the default maximum size of the UDP-over-TCP datagram.
+	DefaultMaxDatagramSize = math.MaxUint16
+
+	// UDP tun relay flag, used by shadowsocks
+	fragTun = 0xff
+	// the datagram is compressed by snappy.
+	fragCompressed = 0xfe
+	// the max length of the header of the datagram: RSV(2) FRAG(1) ATYP(1) LEN(1) DOMAIN(255) PORT(2).
+	maxHeaderLen = 262
+)
+
+var (
+	ErrDatagramTooLarge = errors.New("datagram too large")
+	ErrCompression      = errors.New("compression is not negotiated")
+)
+
+const (
+	// StatusTemporaryUnavailable is a non-standard status, the server rejects the request temporarily,
+	// such as it is overloaded, the client should retry later, after the delay of RetryAfterFeature if present.
+	StatusTemporaryUnavailable uint8 = 0x80
+	// StatusPortUnreachable is a non-standard status, the UDP port of the target is unreachable,
+	// it is reported by the ICMP error of the target after the association is established.
+	StatusPortUnreachable uint8 = 0x81
 )
 
 func StatusText(code uint8) string {
@@ -27,33 +58,71 @@ func StatusText(code uint8) string {
 		return "Timeout"
 	case relay.StatusUnauthorized:
 		return "Unauthorized"
+	case StatusTemporaryUnavailable:
+		return "Temporarily Unavailable"
+	case StatusPortUnreachable:
+		return "Port Unreachable"
 	default:
 		return ""
 	}
 }
 
+type udpTunOptions struct {
+	maxDatagramSize int
+	compression     bool
+}
+
+type UDPTunOption func(opts *udpTunOptions)
+
+// MaxDatagramSizeUDPTunOption sets the maximum size of the received datagram,
+// the connection is closed if a datagram exceeds it.
+func MaxDatagramSizeUDPTunOption(n int) UDPTunOption {
+	return func(opts *udpTunOptions) {
+		opts.maxDatagramSize = n
+	}
+}
+
+// CompressionUDPTunOption enables the snappy compression of the datagrams,
+// it should be used only if both sides have negotiated it.
+func CompressionUDPTunOption(b bool) UDPTunOption {
+	return func(opts *udpTunOptions) {
+		opts.compression = b
+	}
+}
+
 type udpTunConn struct {
 	net.Conn
-	taddr net.Addr
+	taddr   net.Addr
+	options udpTunOptions
+	// the datagrams of an association are written by the concurrent senders,
+	// each datagram is written in one write under the lock, so the frames never interleave on the stream.
+	wmu sync.Mutex
 }
 
-func UDPTunClientConn(c net.Conn, targetAddr net.Addr) net.Conn {
-	return &udpTunConn{
+func newUDPTunConn(c net.Conn, targetAddr net.Addr, opts []UDPTunOption) *udpTunConn {
+	conn := &udpTunConn{
 		Conn:  c,
 		taddr: targetAddr,
 	}
+	for _, opt := range opts {
+		opt(&conn.options)
+	}
+	if conn.options.maxDatagramSize <= 0 || conn.options.maxDatagramSize > DefaultMaxDatagramSize {
+		conn.options.maxDatagramSize = DefaultMaxDatagramSize
+	}
+	return conn
 }
 
-func UDPTunClientPacketConn(c net.Conn) net.PacketConn {
-	return &udpTunConn{
-		Conn: c,
-	}
+func UDPTunClientConn(c net.Conn, targetAddr net.Addr, opts ...UDPTunOption) net.Conn {
+	return newUDPTunConn(c, targetAddr, opts)
 }
 
-func UDPTunServerConn(c net.Conn) net.PacketConn {
-	return &udpTunConn{
-		Conn: c,
-	}
+func UDPTunClientPacketConn(c net.Conn, opts ...UDPTunOption) net.PacketConn {
+	return newUDPTunConn(c, nil, opts)
+}
+
+func UDPTunServerConn(c net.Conn, opts ...UDPTunOption) net.PacketConn {
+	return newUDPTunConn(c, nil, opts)
 }
 
 func (c *udpTunConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
@@ -61,24 +130,63 @@ func (c *udpTunConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
 	header := gosocks5.UDPHeader{
 		Addr: &socksAddr,
 	}
-	dgram := gosocks5.UDPDatagram{
-		Header: &header,
-		Data:   b,
+	if _, err = header.ReadFrom(c.Conn); err != nil {
+		return
 	}
-	_, err = dgram.ReadFrom(c.Conn)
-	if err != nil {
+
+	// the reserved field is used as the data length,
+	// never trust it beyond the limit, as the stream can not be resynchronized.
+	dlen := int(header.Rsv)
+	if dlen > c.options.maxDatagramSize {
+		c.Conn.Close()
+		err = ErrDatagramTooLarge
+		return
+	}
+
+	compressed := header.Frag == fragCompressed
+	if compressed && !c.options.compression {
+		c.Conn.Close()
+		err = ErrCompression
 		return
 	}
 
-	n = len(dgram.Data)
-	if n > len(b) {
-		n = copy(b, dgram.Data)
+	if !compressed && dlen <= len(b) {
+		if n, err = io.ReadFull(c.Conn, b[:dlen]); err != nil {
+			return
+		}
+	} else {
+		buf := bufpool.Get(dlen)
+		defer bufpool.Put(buf)
+
+		if _, err = io.ReadFull(c.Conn, buf[:dlen]); err != nil {
+			return
+		}
+		data := buf[:dlen]
+		if compressed {
+			if data, err = c.decode(data); err != nil {
+				c.Conn.Close()
+				return
+			}
+		}
+		n = copy(b, data)
 	}
+
 	addr, err = net.ResolveUDPAddr("udp", socksAddr.String())
 
 	return
 }
 
+func (c *udpTunConn) decode(b []byte) ([]byte, error) {
+	dlen, err := snappy.DecodedLen(b)
+	if err != nil {
+		return nil, err
+	}
+	if dlen > c.options.maxDatagramSize {
+		return nil, ErrDatagramTooLarge
+	}
+	return snappy.Decode(nil, b)
+}
+
 func (c *udpTunConn) Read(b []byte) (n int, err error) {
 	n, _, err = c.ReadFrom(b)
 	return
@@ -97,9 +205,31 @@ func (c *udpTunConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
 		Header: &header,
 		Data:   b,
 	}
+	dgram.Header.Frag = fragTun
+	if c.options.compression {
+		// send the datagram as is if the compression does not help.
+		if v := snappy.Encode(nil, b); len(v) < len(b) {
+			dgram.Data = v
+			dgram.Header.Frag = fragCompressed
+		}
+	}
+	if len(dgram.Data) > math.MaxUint16 {
+		err = ErrDatagramTooLarge
+		return
+	}
 	dgram.Header.Rsv = uint16(len(dgram.Data))
-	dgram.Header.Frag = 0xff // UDP tun relay flag, used by shadowsocks
-	_, err = dgram.WriteTo(c.Conn)
+
+	wbuf := bufpool.Get(maxHeaderLen + len(dgram.Data))
+	defer bufpool.Put(wbuf)
+
+	buf := bytes.NewBuffer(wbuf[:0])
+	if _, err = dgram.WriteTo(buf); err != nil {
+		return
+	}
+
+	c.wmu.Lock()
+	_, err = c.Conn.Write(buf.Bytes())
+	c.wmu.Unlock()
 	n = len(b)
 
 	return
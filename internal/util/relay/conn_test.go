@@ -0,0 +1,106 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// chunkConn writes the data in small chunks, yielding between them,
+// so the writes not serialized by the caller interleave on the stream.
+type chunkConn struct {
+	net.Conn
+}
+
+func (c *chunkConn) Write(b []byte) (n int, err error) {
+	for len(b) > 0 {
+		m := 7
+		if m > len(b) {
+			m = len(b)
+		}
+		nn, err := c.Conn.Write(b[:m])
+		n += nn
+		if err != nil {
+			return n, err
+		}
+		b = b[m:]
+		runtime.Gosched()
+	}
+	return
+}
+
+func TestUDPTunConnConcurrentWriteTo(t *testing.T) {
+	for _, compression := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compression=%v", compression), func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+
+			cc, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cc.Close()
+			sc, err := ln.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sc.Close()
+
+			const senders = 16
+			const count = 200
+
+			client := UDPTunClientPacketConn(&chunkConn{Conn: cc}, CompressionUDPTunOption(compression))
+			server := UDPTunServerConn(sc, CompressionUDPTunOption(compression))
+
+			var wg sync.WaitGroup
+			for i := 0; i < senders; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					addr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, byte(i+1)), Port: 1000 + i}
+					for seq := 0; seq < count; seq++ {
+						// the compressible and the incompressible datagrams of various sizes.
+						b := []byte(fmt.Sprintf("%d:%d:", i, seq))
+						b = append(b, bytes.Repeat([]byte{byte(seq)}, (seq*37)%1500)...)
+						if _, err := client.WriteTo(b, addr); err != nil {
+							t.Error(err)
+							return
+						}
+					}
+				}(i)
+			}
+
+			sc.SetReadDeadline(time.Now().Add(30 * time.Second))
+			next := make([]int, senders)
+			buf := make([]byte, DefaultMaxDatagramSize)
+			for n := 0; n < senders*count; n++ {
+				nn, addr, err := server.ReadFrom(buf)
+				if err != nil {
+					t.Fatalf("datagram %d: %v", n, err)
+				}
+				var i, seq int
+				if _, err := fmt.Sscanf(string(buf[:nn]), "%d:%d:", &i, &seq); err != nil || i < 0 || i >= senders {
+					t.Fatalf("datagram %d: corrupted %q", n, buf[:min(nn, 16)])
+				}
+				if want := fmt.Sprintf("10.0.0.%d:%d", i+1, 1000+i); addr.String() != want {
+					t.Errorf("sender %d: got address %s, want %s", i, addr, want)
+				}
+				if seq != next[i] {
+					t.Fatalf("sender %d: got datagram %d, want %d", i, seq, next[i])
+				}
+				next[i]++
+				if want := len(fmt.Sprintf("%d:%d:", i, seq)) + (seq*37)%1500; nn != want {
+					t.Fatalf("sender %d datagram %d: got %d bytes, want %d", i, seq, nn, want)
+				}
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/go-gost/relay"
+)
+
+const (
+	// FeatureMessage is a non-standard feature carrying a short human-readable message,
+	// it is used by the server to explain why a request was rejected.
+	FeatureMessage relay.FeatureType = 0x80
+	// FeatureCompression is a non-standard feature,
+	// it is used by the server to accept the compression of the UDP datagrams requested by FCompress.
+	FeatureCompression relay.FeatureType = 0x81
+	// FeatureDatagram is a non-standard feature,
+	// it is used by the tunnel server to carry the UDP association over the QUIC datagrams.
+	FeatureDatagram relay.FeatureType = 0x82
+	// FeatureRetryAfter is a non-standard feature,
+	// it is used by the server to hint the client when to retry the request rejected temporarily.
+	FeatureRetryAfter relay.FeatureType = 0x83
+
+	// FCompress is a non-standard command flag indicating that
+	// the client supports the compression of the UDP-over-TCP datagrams.
+	FCompress relay.CmdType = 0x40
+	// FDatagram is a non-standard command flag indicating that
+	// the tunnel connector supports relaying the UDP datagrams over the QUIC datagrams.
+	FDatagram relay.CmdType = 0x20
+
+	maxMessageLen = 0xFF
+)
+
+// MessageFeature is a relay feature,
+// it contains a short message describing the response status.
+//
+// Protocol spec:
+//
+//	+------+----------+
+//	| MLEN |  MESSAGE |
+//	+------+----------+
+//	|  1   | 0 to 255 |
+//	+------+----------+
+//
+//	MLEN - length of message field, 1 byte.
+//	MESSAGE - message, variable length, 0 to 255 bytes.
+type MessageFeature struct {
+	Message string
+}
+
+func (f *MessageFeature) Type() relay.FeatureType {
+	return FeatureMessage
+}
+
+func (f *MessageFeature) Encode() ([]byte, error) {
+	msg := f.Message
+	if len(msg) > maxMessageLen {
+		msg = msg[:maxMessageLen]
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(uint8(len(msg)))
+	buf.WriteString(msg)
+	return buf.Bytes(), nil
+}
+
+func (f *MessageFeature) Decode(b []byte) error {
+	if len(b) < 1 {
+		return relay.ErrShortBuffer
+	}
+	mlen := int(b[0])
+	if len(b) < 1+mlen {
+		return relay.ErrShortBuffer
+	}
+	f.Message = string(b[1 : 1+mlen])
+	return nil
+}
+
+// CompressionFeature is a relay feature without data,
+// it indicates that the UDP-over-TCP datagrams can be compressed.
+type CompressionFeature struct{}
+
+func (f *CompressionFeature) Type() relay.FeatureType {
+	return FeatureCompression
+}
+
+func (f *CompressionFeature) Encode() ([]byte, error) {
+	return nil, nil
+}
+
+func (f *CompressionFeature) Decode(b []byte) error {
+	return nil
+}
+
+// DatagramFeature is a relay feature,
+// it contains the ID of the UDP association carried by the QUIC datagrams.
+//
+// Protocol spec:
+//
+//	+----------+
+//	| ASSOC ID |
+//	+----------+
+//	|    4     |
+//	+----------+
+//
+//	ASSOC ID - association ID, 4 bytes.
+type DatagramFeature struct {
+	ID uint32
+}
+
+func (f *DatagramFeature) Type() relay.FeatureType {
+	return FeatureDatagram
+}
+
+func (f *DatagramFeature) Encode() ([]byte, error) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], f.ID)
+	return b[:], nil
+}
+
+func (f *DatagramFeature) Decode(b []byte) error {
+	if len(b) < 4 {
+		return relay.ErrShortBuffer
+	}
+	f.ID = binary.BigEndian.Uint32(b)
+	return nil
+}
+
+// RetryAfterFeature is a relay feature,
+// it contains the delay the client should wait before retrying the request.
+//
+// Protocol spec:
+//
+//	+-------+
+//	| DELAY |
+//	+-------+
+//	|   4   |
+//	+-------+
+//
+//	DELAY - delay in milliseconds, 4 bytes.
+type RetryAfterFeature struct {
+	Delay time.Duration
+}
+
+func (f *RetryAfterFeature) Type() relay.FeatureType {
+	return FeatureRetryAfter
+}
+
+func (f *RetryAfterFeature) Encode() ([]byte, error) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(f.Delay.Milliseconds()))
+	return b[:], nil
+}
+
+func (f *RetryAfterFeature) Decode(b []byte) error {
+	if len(b) < 4 {
+		return relay.ErrShortBuffer
+	}
+	f.Delay = time.Duration(binary.BigEndian.Uint32(b)) * time.Millisecond
+	return nil
+}
+
+// ReadResponse reads a relay response from r.
+// Unlike relay.Response.ReadFrom, it recognizes the extension features defined in this package,
+// so that a response carrying a message feature can still be decoded.
+func ReadResponse(r io.Reader, resp *relay.Response) (msg string, err error) {
+	var header [4]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return
+	}
+
+	if header[0] != relay.Version1 {
+		err = relay.ErrBadVersion
+		return
+	}
+	resp.Version = header[0]
+	resp.Status = header[1]
+
+	flen := int(binary.BigEndian.Uint16(header[2:]))
+	if flen == 0 {
+		return
+	}
+	b := make([]byte, flen)
+	if _, err = io.ReadFull(r, b); err != nil {
+		return
+	}
+
+	br := bytes.NewReader(b)
+	for br.Len() > 0 {
+		var fh [3]byte
+		if _, err = io.ReadFull(br, fh[:]); err != nil {
+			return
+		}
+		data := make([]byte, int(binary.BigEndian.Uint16(fh[1:3])))
+		if _, err = io.ReadFull(br, data); err != nil {
+			return
+		}
+
+		switch relay.FeatureType(fh[0]) {
+		case FeatureMessage:
+			f := &MessageFeature{}
+			if err = f.Decode(data); err != nil {
+				return
+			}
+			msg = f.Message
+			resp.Features = append(resp.Features, f)
+			continue
+		case FeatureCompression:
+			resp.Features = append(resp.Features, &CompressionFeature{})
+			continue
+		case FeatureDatagram:
+			f := &DatagramFeature{}
+			if err = f.Decode(data); err != nil {
+				return
+			}
+			resp.Features = append(resp.Features, f)
+			continue
+		case FeatureRetryAfter:
+			f := &RetryAfterFeature{}
+			if err = f.Decode(data); err != nil {
+				return
+			}
+			resp.Features = append(resp.Features, f)
+			continue
+		}
+
+		var f relay.Feature
+		if f, err = relay.NewFeature(relay.FeatureType(fh[0]), data); err != nil {
+			return
+		}
+		resp.Features = append(resp.Features, f)
+	}
+
+	return
+}
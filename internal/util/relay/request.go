@@ -0,0 +1,126 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/go-gost/core/metrics"
+	"github.com/go-gost/relay"
+	xmetrics "github.com/go-gost/x/metrics"
+)
+
+const (
+	DefaultMaxRequestSize  = 4096
+	DefaultMaxFeatures     = 16
+	DefaultMaxStringLength = 255
+
+	requestHeaderLen = 4
+	featureHeaderLen = 3
+)
+
+var (
+	ErrRequestTooLarge = errors.New("relay: request too large")
+	ErrTooManyFeatures = errors.New("relay: too many features")
+	ErrStringTooLong   = errors.New("relay: string too long")
+)
+
+// RequestLimits limits the relay requests read by ReadRequest,
+// the default limit is used for the zero or negative value.
+type RequestLimits struct {
+	// MaxSize is the max size of the request in bytes, including the header.
+	MaxSize int
+	// MaxFeatures is the max number of the features.
+	MaxFeatures int
+	// MaxStringLength is the max length of the strings in the features, such as the host and username.
+	MaxStringLength int
+}
+
+// ReadRequest reads a relay request from r within the limits.
+// Unlike relay.Request.ReadFrom, the features are counted before they are decoded,
+// so an oversized request is rejected without allocating the features.
+func ReadRequest(r io.Reader, req *relay.Request, limits *RequestLimits) error {
+	var lim RequestLimits
+	if limits != nil {
+		lim = *limits
+	}
+	if lim.MaxSize <= 0 {
+		lim.MaxSize = DefaultMaxRequestSize
+	}
+	if lim.MaxFeatures <= 0 {
+		lim.MaxFeatures = DefaultMaxFeatures
+	}
+	if lim.MaxStringLength <= 0 {
+		lim.MaxStringLength = DefaultMaxStringLength
+	}
+
+	var header [requestHeaderLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+	flen := int(binary.BigEndian.Uint16(header[2:]))
+	if requestHeaderLen+flen > lim.MaxSize {
+		return ErrRequestTooLarge
+	}
+
+	b := make([]byte, requestHeaderLen+flen)
+	copy(b, header[:])
+	if _, err := io.ReadFull(r, b[requestHeaderLen:]); err != nil {
+		return err
+	}
+
+	n := 0
+	for fb := b[requestHeaderLen:]; len(fb) >= featureHeaderLen; n++ {
+		if n >= lim.MaxFeatures {
+			return ErrTooManyFeatures
+		}
+		flen := featureHeaderLen + int(binary.BigEndian.Uint16(fb[1:3]))
+		if flen > len(fb) {
+			// the malformed feature is reported by the decoder.
+			break
+		}
+		fb = fb[flen:]
+	}
+
+	if _, err := req.ReadFrom(bytes.NewReader(b)); err != nil {
+		return err
+	}
+
+	for _, f := range req.Features {
+		switch v := f.(type) {
+		case *relay.UserAuthFeature:
+			if len(v.Username) > lim.MaxStringLength || len(v.Password) > lim.MaxStringLength {
+				return ErrStringTooLong
+			}
+		case *relay.AddrFeature:
+			if len(v.Host) > lim.MaxStringLength {
+				return ErrStringTooLong
+			}
+		}
+	}
+
+	return nil
+}
+
+// IsLimitExceeded reports whether the err is caused by the request exceeding the limits.
+func IsLimitExceeded(err error) bool {
+	return errors.Is(err, ErrRequestTooLarge) ||
+		errors.Is(err, ErrTooManyFeatures) ||
+		errors.Is(err, ErrStringTooLong)
+}
+
+// ObserveRejected counts the request of the service rejected by the limits.
+func ObserveRejected(service string, err error) {
+	reason := "size"
+	switch err {
+	case ErrTooManyFeatures:
+		reason = "features"
+	case ErrStringTooLong:
+		reason = "string"
+	}
+	if v := xmetrics.GetCounter(xmetrics.MetricRelayRequestsRejectedCounter,
+		metrics.Labels{"service": service, "reason": reason}); v != nil {
+		v.Inc()
+	}
+}
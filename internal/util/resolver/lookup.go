@@ -0,0 +1,200 @@
+package resolver
+
+import (
+	"container/list"
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/metrics"
+	"github.com/go-gost/core/resolver"
+	xmetrics "github.com/go-gost/x/metrics"
+)
+
+const (
+	defaultLookupTTL        = 60 * time.Second
+	defaultLookupMaxEntries = 1024
+	// the time to refresh the stale entry in background.
+	lookupRefreshTimeout = 10 * time.Second
+)
+
+type LookupCacheOptions struct {
+	// TTL is the max time the resolved addresses are fresh, 60 seconds if not set.
+	// The entry resolved by the TTLResolver is fresh for the TTL of the records if it is shorter.
+	TTL time.Duration
+	// MaxEntries is the max number of the cached names, the least recently used ones are evicted, 1024 if not set.
+	MaxEntries int
+	// Stale is the max time the expired entry is served while it is refreshed in background,
+	// 0 resolves the expired entry before the dial.
+	Stale time.Duration
+}
+
+// TTLResolver is the resolver reporting the TTL of the records it resolves, 0 if unknown.
+type TTLResolver interface {
+	ResolveTTL(ctx context.Context, network, host string) ([]net.IP, time.Duration, error)
+}
+
+// lookupKey identifies the entry by the resolver as well, the nodes and the router of the chain
+// resolve the same name by the different resolvers sharing the cache of the handler.
+type lookupKey struct {
+	resolver resolver.Resolver
+	network  string
+	host     string
+}
+
+type lookupEntry struct {
+	key        lookupKey
+	ips        []net.IP
+	expires    time.Time
+	refreshing bool
+	elem       *list.Element
+}
+
+// LookupCache caches the addresses the handler dials resolved by the resolvers, keyed by the resolver, the network (ip, ip4 or ip6) and the name.
+// The expired entry is served within the staleness cap while it is refreshed in background (stale-while-revalidate),
+// and the lookups are counted by the result of hit, stale or miss.
+type LookupCache struct {
+	service string
+	opts    LookupCacheOptions
+	entries map[lookupKey]*lookupEntry
+	lru     *list.List
+	mu      sync.Mutex
+}
+
+func NewLookupCache(service string, opts LookupCacheOptions) *LookupCache {
+	if opts.TTL <= 0 {
+		opts.TTL = defaultLookupTTL
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultLookupMaxEntries
+	}
+	return &LookupCache{
+		service: service,
+		opts:    opts,
+		entries: make(map[lookupKey]*lookupEntry),
+		lru:     list.New(),
+	}
+}
+
+// Lookup resolves the host by the resolver through the cache, the failed lookups are not cached.
+// The nil cache resolves the host by the resolver directly, so does the resolver not comparable as the key.
+func (c *LookupCache) Lookup(ctx context.Context, network, host string, r resolver.Resolver) ([]net.IP, error) {
+	if c == nil || !reflect.TypeOf(r).Comparable() {
+		return r.Resolve(ctx, network, host)
+	}
+
+	key := lookupKey{resolver: r, network: network, host: host}
+	now := time.Now()
+
+	c.mu.Lock()
+	if e := c.entries[key]; e != nil {
+		c.lru.MoveToFront(e.elem)
+		ips := e.ips
+		switch {
+		case now.Before(e.expires):
+			c.mu.Unlock()
+			c.observe("hit")
+			return ips, nil
+		case now.Before(e.expires.Add(c.opts.Stale)):
+			refresh := !e.refreshing
+			e.refreshing = true
+			c.mu.Unlock()
+			c.observe("stale")
+			if refresh {
+				go c.refresh(key, network, host, r)
+			}
+			return ips, nil
+		}
+	}
+	c.mu.Unlock()
+
+	c.observe("miss")
+	ips, ttl, err := resolve(ctx, network, host, r)
+	if err == nil && len(ips) > 0 {
+		c.store(key, ips, ttl)
+	}
+	return ips, err
+}
+
+func (c *LookupCache) refresh(key lookupKey, network, host string, r resolver.Resolver) {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupRefreshTimeout)
+	defer cancel()
+
+	ips, ttl, err := resolve(ctx, network, host, r)
+	if err == nil && len(ips) > 0 {
+		c.store(key, ips, ttl)
+		return
+	}
+
+	// the stale entry is kept until the staleness cap, and retried by the next lookup.
+	c.mu.Lock()
+	if e := c.entries[key]; e != nil {
+		e.refreshing = false
+	}
+	c.mu.Unlock()
+}
+
+func resolve(ctx context.Context, network, host string, r resolver.Resolver) ([]net.IP, time.Duration, error) {
+	if v, ok := r.(TTLResolver); ok {
+		return v.ResolveTTL(ctx, network, host)
+	}
+	ips, err := r.Resolve(ctx, network, host)
+	return ips, 0, err
+}
+
+// store caches the addresses for the TTL of the records capped by the TTL of the cache, ttl is 0 if unknown.
+func (c *LookupCache) store(key lookupKey, ips []net.IP, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ttl <= 0 || ttl > c.opts.TTL {
+		ttl = c.opts.TTL
+	}
+	expires := time.Now().Add(ttl)
+	if e := c.entries[key]; e != nil {
+		e.ips = ips
+		e.expires = expires
+		e.refreshing = false
+		c.lru.MoveToFront(e.elem)
+		return
+	}
+
+	for len(c.entries) >= c.opts.MaxEntries {
+		back := c.lru.Back()
+		if back == nil {
+			break
+		}
+		delete(c.entries, back.Value.(*lookupEntry).key)
+		c.lru.Remove(back)
+	}
+
+	e := &lookupEntry{
+		key:     key,
+		ips:     ips,
+		expires: expires,
+	}
+	e.elem = c.lru.PushFront(e)
+	c.entries[key] = e
+}
+
+func (c *LookupCache) observe(result string) {
+	if v := xmetrics.GetCounter(xmetrics.MetricServiceDNSCacheCounter,
+		metrics.Labels{"service": c.service, "result": result}); v != nil {
+		v.Inc()
+	}
+}
+
+type lookupCacheKey struct{}
+
+// ContextWithLookupCache returns the context carrying the cache used by the dials of the handler.
+func ContextWithLookupCache(ctx context.Context, c *LookupCache) context.Context {
+	return context.WithValue(ctx, lookupCacheKey{}, c)
+}
+
+// LookupCacheFromContext returns the cache carried by the context, nil if none.
+func LookupCacheFromContext(ctx context.Context) *LookupCache {
+	c, _ := ctx.Value(lookupCacheKey{}).(*LookupCache)
+	return c
+}
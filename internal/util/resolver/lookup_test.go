@@ -0,0 +1,83 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-gost/core/resolver"
+)
+
+type testResolver struct {
+	ip    net.IP
+	ttl   time.Duration
+	calls int
+}
+
+func (r *testResolver) Resolve(ctx context.Context, network, host string, opts ...resolver.Option) ([]net.IP, error) {
+	ips, _, err := r.ResolveTTL(ctx, network, host)
+	return ips, err
+}
+
+func (r *testResolver) ResolveTTL(ctx context.Context, network, host string) ([]net.IP, time.Duration, error) {
+	r.calls++
+	return []net.IP{r.ip}, r.ttl, nil
+}
+
+func TestLookupCacheKeyedByResolver(t *testing.T) {
+	c := NewLookupCache("test", LookupCacheOptions{})
+
+	r1 := &testResolver{ip: net.ParseIP("192.0.2.1")}
+	r2 := &testResolver{ip: net.ParseIP("192.0.2.2")}
+
+	for _, tt := range []struct {
+		r    *testResolver
+		want string
+	}{
+		{r1, "192.0.2.1"},
+		{r2, "192.0.2.2"},
+		{r1, "192.0.2.1"},
+		{r2, "192.0.2.2"},
+	} {
+		ips, err := c.Lookup(context.Background(), "ip", "example.com", tt.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ips) != 1 || ips[0].String() != tt.want {
+			t.Errorf("got %v, want %s", ips, tt.want)
+		}
+	}
+	if r1.calls != 1 || r2.calls != 1 {
+		t.Errorf("resolver calls: got %d/%d, want 1/1", r1.calls, r2.calls)
+	}
+}
+
+func TestLookupCacheRecordTTL(t *testing.T) {
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		calls int
+	}{
+		{name: "unknown", ttl: 0, calls: 1},
+		{name: "longer than the cache", ttl: time.Hour, calls: 1},
+		{name: "expired record", ttl: time.Millisecond, calls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewLookupCache("test", LookupCacheOptions{TTL: time.Minute})
+			r := &testResolver{ip: net.ParseIP("192.0.2.1"), ttl: tt.ttl}
+
+			for i := 0; i < 2; i++ {
+				if _, err := c.Lookup(context.Background(), "ip", "example.com", r); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if r.calls != tt.calls {
+				t.Errorf("resolver calls: got %d, want %d", r.calls, tt.calls)
+			}
+		})
+	}
+}
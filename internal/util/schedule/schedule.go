@@ -0,0 +1,290 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	minutesPerDay = 24 * 60
+	// the max number of the adjacent windows followed to find the end of the access.
+	maxAdjacentWindows = 8
+)
+
+var (
+	ErrOutOfWindow = errors.New("schedule: access is not allowed at this time")
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// window is the time of the day on the days of the week,
+// the window ending before (or at) its start lasts overnight into the next day.
+type window struct {
+	// the bitmask of the days of the week the window starts on.
+	days uint8
+	// the minutes of the day.
+	start int
+	end   int
+}
+
+// Policy is the time windows a client is allowed in, evaluated in the time zone of the policy.
+type Policy struct {
+	windows []window
+	loc     *time.Location
+}
+
+// ParsePolicy parses the policy, it is the windows separated by semicolons and an optional time zone, such as
+//
+//	Mon-Fri 08:00-18:00; Sat,Sun 10:00-14:00; tz=Europe/Berlin
+//
+// The days are optional for the window on every day, and the time zone is the local time zone if not set.
+func ParsePolicy(s string) (*Policy, error) {
+	p := &Policy{
+		loc: time.Local,
+	}
+	for _, seg := range strings.Split(s, ";") {
+		if seg = strings.TrimSpace(seg); seg == "" {
+			continue
+		}
+		if tz, ok := strings.CutPrefix(seg, "tz="); ok {
+			loc, err := time.LoadLocation(strings.TrimSpace(tz))
+			if err != nil {
+				return nil, fmt.Errorf("schedule: %w", err)
+			}
+			p.loc = loc
+			continue
+		}
+
+		w, err := parseWindow(seg)
+		if err != nil {
+			return nil, err
+		}
+		p.windows = append(p.windows, w)
+	}
+	if len(p.windows) == 0 {
+		return nil, fmt.Errorf("schedule: no window in policy %q", s)
+	}
+	return p, nil
+}
+
+// parseWindow parses the window such as "Mon-Fri,Sun 22:00-06:00".
+func parseWindow(s string) (w window, err error) {
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+		w.days = 0x7f
+	case 2:
+		if w.days, err = parseDays(fields[0]); err != nil {
+			return
+		}
+	default:
+		return w, fmt.Errorf("schedule: invalid window %q", s)
+	}
+
+	start, end, ok := strings.Cut(fields[len(fields)-1], "-")
+	if !ok {
+		return w, fmt.Errorf("schedule: invalid window %q", s)
+	}
+	if w.start, err = parseClock(start); err != nil {
+		return
+	}
+	if w.end, err = parseClock(end); err != nil {
+		return
+	}
+	if w.start == minutesPerDay {
+		return w, fmt.Errorf("schedule: invalid window %q", s)
+	}
+	return
+}
+
+func parseDays(s string) (days uint8, err error) {
+	for _, v := range strings.Split(strings.ToLower(s), ",") {
+		from, to, _ := strings.Cut(v, "-")
+		d1, ok := weekdays[strings.TrimSpace(from)]
+		if !ok {
+			return 0, fmt.Errorf("schedule: invalid day %q", from)
+		}
+		d2 := d1
+		if to != "" {
+			if d2, ok = weekdays[strings.TrimSpace(to)]; !ok {
+				return 0, fmt.Errorf("schedule: invalid day %q", to)
+			}
+		}
+		// the range wraps around the week, such as Fri-Mon.
+		for d := d1; ; d = (d + 1) % 7 {
+			days |= 1 << d
+			if d == d2 {
+				break
+			}
+		}
+	}
+	return
+}
+
+// parseClock parses the time of the day in HH:MM to the minutes of the day, 24:00 is the end of the day.
+func parseClock(s string) (int, error) {
+	hh, mm, ok := strings.Cut(strings.TrimSpace(s), ":")
+	h, err1 := strconv.Atoi(hh)
+	m, err2 := strconv.Atoi(mm)
+	if !ok || err1 != nil || err2 != nil || h < 0 || m < 0 || m > 59 || h*60+m > minutesPerDay {
+		return 0, fmt.Errorf("schedule: invalid time %q", s)
+	}
+	return h*60 + m, nil
+}
+
+// Allowed reports whether the time t is in a window of the policy,
+// and the end of the window if it is in.
+func (p *Policy) Allowed(t time.Time) (bool, time.Time) {
+	t = t.In(p.loc)
+	for _, w := range p.windows {
+		if end, ok := w.contains(t); ok {
+			return true, end
+		}
+	}
+	return false, time.Time{}
+}
+
+// contains reports whether t is in the window, and the end of the window.
+func (w window) contains(t time.Time) (time.Time, bool) {
+	m := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	y, mo, d := t.Date()
+
+	if w.start < w.end {
+		if w.days&(1<<day) != 0 && m >= w.start && m < w.end {
+			return time.Date(y, mo, d, 0, w.end, 0, 0, t.Location()), true
+		}
+		return time.Time{}, false
+	}
+
+	// overnight, started today or yesterday.
+	if w.days&(1<<day) != 0 && m >= w.start {
+		return time.Date(y, mo, d+1, 0, w.end, 0, 0, t.Location()), true
+	}
+	if w.days&(1<<((day+6)%7)) != 0 && m < w.end {
+		return time.Date(y, mo, d, 0, w.end, 0, 0, t.Location()), true
+	}
+	return time.Time{}, false
+}
+
+// End returns the time the access allowed at t ends, the adjacent windows are joined,
+// zero time is returned if it is not allowed at t or it never ends.
+func (p *Policy) End(t time.Time) time.Time {
+	ok, end := p.Allowed(t)
+	if !ok {
+		return time.Time{}
+	}
+	for i := 0; i < maxAdjacentWindows; i++ {
+		next, e := p.Allowed(end)
+		if !next {
+			return end
+		}
+		end = e
+	}
+	return time.Time{}
+}
+
+type Options struct {
+	// Policies is the policy of each client ID.
+	Policies map[string]string
+	// Default is the policy of the clients without their own policy,
+	// including the clients without ID, empty allows them at any time.
+	Default string
+	// Terminate closes the open connections once their windows close.
+	Terminate bool
+}
+
+// Schedule is the time-of-day and day-of-week access policies of the clients.
+type Schedule struct {
+	policies  map[string]*Policy
+	def       *Policy
+	terminate bool
+}
+
+// New creates a Schedule, nil is returned if no policy is set,
+// and the nil Schedule allows all the clients at any time.
+func New(opts Options) (*Schedule, error) {
+	if len(opts.Policies) == 0 && opts.Default == "" {
+		return nil, nil
+	}
+
+	s := &Schedule{
+		policies:  make(map[string]*Policy),
+		terminate: opts.Terminate,
+	}
+	for client, v := range opts.Policies {
+		p, err := ParsePolicy(v)
+		if err != nil {
+			return nil, fmt.Errorf("client %s: %w", client, err)
+		}
+		s.policies[client] = p
+	}
+	if opts.Default != "" {
+		p, err := ParsePolicy(opts.Default)
+		if err != nil {
+			return nil, err
+		}
+		s.def = p
+	}
+	return s, nil
+}
+
+func (s *Schedule) policy(client string) *Policy {
+	if p, ok := s.policies[client]; ok {
+		return p
+	}
+	return s.def
+}
+
+// Check checks the access of the client at connect time.
+func (s *Schedule) Check(client string) error {
+	if s == nil {
+		return nil
+	}
+	p := s.policy(client)
+	if p == nil {
+		return nil
+	}
+	if ok, _ := p.Allowed(time.Now()); !ok {
+		return fmt.Errorf("%w: client %q", ErrOutOfWindow, client)
+	}
+	return nil
+}
+
+// Watch closes the closers once the window of the client closes, if the termination is enabled.
+// The returned function stops the watch, it must be called when the connection is done.
+func (s *Schedule) Watch(client string, closers ...io.Closer) (stop func()) {
+	stop = func() {}
+	if s == nil || !s.terminate {
+		return
+	}
+	p := s.policy(client)
+	if p == nil {
+		return
+	}
+	end := p.End(time.Now())
+	if end.IsZero() {
+		return
+	}
+
+	timer := time.AfterFunc(time.Until(end), func() {
+		for _, c := range closers {
+			if c != nil {
+				c.Close()
+			}
+		}
+	})
+	return func() { timer.Stop() }
+}
@@ -1,5 +1,10 @@
 package socks
 
+import (
+	"fmt"
+	"strings"
+)
+
 const (
 	// MethodTLS is an extended SOCKS5 method with tls encryption support.
 	MethodTLS uint8 = 0x80
@@ -16,3 +21,39 @@ const (
 	// CmdUDPTun is an extended SOCKS5 request CMD for UDP over TCP.
 	CmdUDPTun uint8 = 0xF3
 )
+
+var commands = map[string]uint8{
+	"connect":   0x01,
+	"bind":      0x02,
+	"udp":       0x03,
+	"associate": 0x03,
+	"muxbind":   CmdMuxBind,
+	"udptun":    CmdUDPTun,
+}
+
+// Commands is the set of the request commands allowed by the service,
+// the nil Commands allows all the commands.
+type Commands map[uint8]bool
+
+// ParseCommands parses the names of the commands: connect, bind, udp (or associate), muxbind and udptun,
+// nil is returned if no command is set.
+func ParseCommands(names []string) (Commands, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	cmds := Commands{}
+	for _, name := range names {
+		cmd, ok := commands[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("socks: unknown command %s", name)
+		}
+		cmds[cmd] = true
+	}
+	return cmds, nil
+}
+
+// Allowed reports whether the command cmd is allowed.
+func (c Commands) Allowed(cmd uint8) bool {
+	return c == nil || c[cmd]
+}
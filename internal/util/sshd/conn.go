@@ -10,16 +10,20 @@ import (
 )
 
 type DirectForwardConn struct {
-	conn    ssh.Conn
-	channel ssh.Channel
-	dstAddr string
+	conn        ssh.Conn
+	channel     ssh.Channel
+	dstAddr     string
+	idleTimeout time.Duration
 }
 
-func NewDirectForwardConn(conn ssh.Conn, channel ssh.Channel, dstAddr string) net.Conn {
+// NewDirectForwardConn creates a direct forwarded connection,
+// the forwarding is torn down if it is idle for idleTimeout, zero means no timeout.
+func NewDirectForwardConn(conn ssh.Conn, channel ssh.Channel, dstAddr string, idleTimeout time.Duration) net.Conn {
 	return &DirectForwardConn{
-		conn:    conn,
-		channel: channel,
-		dstAddr: dstAddr,
+		conn:        conn,
+		channel:     channel,
+		dstAddr:     dstAddr,
+		idleTimeout: idleTimeout,
 	}
 }
 
@@ -59,17 +63,25 @@ func (c *DirectForwardConn) DstAddr() string {
 	return c.dstAddr
 }
 
+func (c *DirectForwardConn) IdleTimeout() time.Duration {
+	return c.idleTimeout
+}
+
 type RemoteForwardConn struct {
-	ctx  context.Context
-	conn ssh.Conn
-	req  *ssh.Request
+	ctx         context.Context
+	conn        ssh.Conn
+	req         *ssh.Request
+	idleTimeout time.Duration
 }
 
-func NewRemoteForwardConn(ctx context.Context, conn ssh.Conn, req *ssh.Request) net.Conn {
+// NewRemoteForwardConn creates a remote forwarding request,
+// each forwarded connection is torn down if it is idle for idleTimeout, zero means no timeout.
+func NewRemoteForwardConn(ctx context.Context, conn ssh.Conn, req *ssh.Request, idleTimeout time.Duration) net.Conn {
 	return &RemoteForwardConn{
-		ctx:  ctx,
-		conn: conn,
-		req:  req,
+		ctx:         ctx,
+		conn:        conn,
+		req:         req,
+		idleTimeout: idleTimeout,
 	}
 }
 
@@ -116,3 +128,7 @@ func (c *RemoteForwardConn) SetWriteDeadline(t time.Time) error {
 func (c *RemoteForwardConn) Done() <-chan struct{} {
 	return c.ctx.Done()
 }
+
+func (c *RemoteForwardConn) IdleTimeout() time.Duration {
+	return c.idleTimeout
+}
@@ -0,0 +1,122 @@
+package sshd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrTargetNotAllowed = errors.New("target not allowed")
+)
+
+type rewriteTarget struct {
+	host string
+	// the port of the rewritten target, 0 keeps the requested port.
+	port int
+}
+
+// Rewriter rewrites the targets of the direct-tcpip channels requested by the clients,
+// the clients are not aware of the rewriting. The rules map the requested hosts to the targets:
+//
+//	db.internal: 10.1.2.3 - the exact host, the requested port is kept.
+//	*.corp.internal: 10.1.2.4:8080 - the subdomains of corp.internal, the port is rewritten as well.
+//
+// The exact host takes precedence over the wildcard hosts, and the longest wildcard domain wins.
+type Rewriter struct {
+	rules map[string]rewriteTarget
+	// only the targets matched by the rules are allowed.
+	strict bool
+}
+
+// NewRewriter creates the rewriter of the rules, nil is returned if there is no rule and strict is false,
+// and the nil Rewriter returns the targets as is.
+func NewRewriter(rules map[string]string, strict bool) (*Rewriter, error) {
+	if len(rules) == 0 && !strict {
+		return nil, nil
+	}
+
+	rw := &Rewriter{
+		rules:  make(map[string]rewriteTarget, len(rules)),
+		strict: strict,
+	}
+	for k, v := range rules {
+		host := strings.ToLower(strings.TrimSpace(k))
+		if host == "" {
+			continue
+		}
+		// *.example.com and .example.com both match the subdomains of example.com, as the ingress does.
+		if host[0] == '*' {
+			host = host[1:]
+		}
+
+		target, err := parseRewriteTarget(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("rewrite %s: %w", k, err)
+		}
+		rw.rules[host] = target
+	}
+	return rw, nil
+}
+
+func parseRewriteTarget(s string) (target rewriteTarget, err error) {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		// no port, the requested port is kept.
+		target.host = strings.Trim(s, "[]")
+		err = nil
+	} else {
+		target.host = host
+		if target.port, err = strconv.Atoi(port); err != nil || target.port <= 0 || target.port > 65535 {
+			return target, fmt.Errorf("invalid port %q", port)
+		}
+	}
+	if target.host == "" {
+		err = errors.New("empty target")
+	}
+	return
+}
+
+// Rewrite returns the target of the requested host and port,
+// ErrTargetNotAllowed is returned if the host is not matched in the strict mode.
+func (rw *Rewriter) Rewrite(host string, port int) (string, error) {
+	if rw == nil {
+		return net.JoinHostPort(host, strconv.Itoa(port)), nil
+	}
+
+	target, ok := rw.lookup(strings.ToLower(host))
+	if !ok {
+		if rw.strict {
+			return "", ErrTargetNotAllowed
+		}
+		return net.JoinHostPort(host, strconv.Itoa(port)), nil
+	}
+
+	if target.port > 0 {
+		port = target.port
+	}
+	return net.JoinHostPort(target.host, strconv.Itoa(port)), nil
+}
+
+func (rw *Rewriter) lookup(host string) (rewriteTarget, bool) {
+	if host == "" {
+		return rewriteTarget{}, false
+	}
+	if target, ok := rw.rules[host]; ok {
+		return target, true
+	}
+
+	for s := host; ; {
+		index := strings.IndexByte(s, '.')
+		if index < 0 {
+			break
+		}
+		if target, ok := rw.rules[s[index:]]; ok {
+			return target, true
+		}
+		s = s[index+1:]
+	}
+	return rewriteTarget{}, false
+}
@@ -0,0 +1,73 @@
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ClientOptions customizes the ClientHello of the outbound TLS dials made by the handlers themselves,
+// such as fetching the decoy page of the probe resistance. The TLS tunneled end-to-end from the clients is never touched.
+type ClientOptions struct {
+	// ServerName overrides the SNI, the certificate of the server is verified against it.
+	// The host of the dialed address is used if not set.
+	ServerName string
+	// ALPN is the protocols advertised in the ClientHello, none if not set.
+	ALPN []string
+}
+
+// Config returns the config of the dial to the server at addr (host or host:port).
+func (o *ClientOptions) Config(addr string) *tls.Config {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	cfg := &tls.Config{
+		ServerName: host,
+	}
+	if o != nil {
+		if o.ServerName != "" {
+			cfg.ServerName = o.ServerName
+		}
+		cfg.NextProtos = o.ALPN
+	}
+	return cfg
+}
+
+// Handshake performs the client handshake on conn to the server at addr, conn is not closed on error.
+func (o *ClientOptions) Handshake(ctx context.Context, conn net.Conn, addr string) (net.Conn, error) {
+	tc := tls.Client(conn, o.Config(addr))
+	if err := tc.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// Transport returns the HTTP transport of the default settings,
+// and the HTTPS connections of it are established with the options.
+func (o *ClientOptions) Transport() *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if o == nil {
+		return tr
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	tr.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		tc, err := o.Handshake(ctx, conn, addr)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tc, nil
+	}
+	return tr
+}
@@ -0,0 +1,183 @@
+package tls
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/go-gost/core/metadata"
+)
+
+// MetadataKeyClientID is the key of the client ID from the verified client certificate in the connection metadata.
+const MetadataKeyClientID = "tls.clientID"
+
+// ClientIDMode is the field of the verified client certificate used as the client ID.
+type ClientIDMode string
+
+const (
+	ClientIDNone    ClientIDMode = ""
+	ClientIDCN      ClientIDMode = "cn"
+	ClientIDSubject ClientIDMode = "subject"
+	// ClientIDDNS is the first DNS name of the subject alternative names.
+	ClientIDDNS ClientIDMode = "dns"
+	// ClientIDEmail is the first email address of the subject alternative names.
+	ClientIDEmail ClientIDMode = "email"
+)
+
+// ParseClientIDMode parses the client ID mode, it is cn, subject, dns or email, empty for none.
+func ParseClientIDMode(s string) (ClientIDMode, error) {
+	switch mode := ClientIDMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case ClientIDNone, ClientIDCN, ClientIDSubject, ClientIDDNS, ClientIDEmail:
+		return mode, nil
+	}
+	return ClientIDNone, fmt.Errorf("unknown client ID mode %q", s)
+}
+
+// ClientID returns the client ID from the verified client certificate of the connection state,
+// empty if the certificate is not verified.
+func (m ClientIDMode) ClientID(cs *tls.ConnectionState) string {
+	if cs == nil || len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	cert := cs.VerifiedChains[0][0]
+	switch m {
+	case ClientIDCN:
+		return cert.Subject.CommonName
+	case ClientIDSubject:
+		return cert.Subject.String()
+	case ClientIDDNS:
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	case ClientIDEmail:
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	}
+	return ""
+}
+
+// ClientID returns the client ID attached to the metadata of the connection by the TLS listeners.
+func ClientID(conn net.Conn) string {
+	if md, ok := conn.(metadata.Metadatable); ok && md.Metadata() != nil {
+		id, _ := md.Metadata().Get(MetadataKeyClientID).(string)
+		return id
+	}
+	return ""
+}
+
+type handshaker interface {
+	Handshake() error
+	ConnectionState() tls.ConnectionState
+}
+
+// WrapClientIDConn attaches the client ID from the verified client certificate to the metadata of the TLS connection.
+// The ID is resolved once the handshake is completed, the handshake is performed if it is not yet done
+// when the ID is queried, so the listener never blocks on the handshakes.
+func WrapClientIDConn(c net.Conn, mode ClientIDMode) net.Conn {
+	tc, ok := c.(handshaker)
+	if !ok || mode == ClientIDNone {
+		return c
+	}
+
+	return &clientIDConn{
+		Conn: c,
+		clientID: func() string {
+			if err := tc.Handshake(); err != nil {
+				return ""
+			}
+			cs := tc.ConnectionState()
+			return mode.ClientID(&cs)
+		},
+	}
+}
+
+// WithClientID attaches the resolved client ID to the metadata of the connection,
+// such as the streams multiplexed over a TLS connection.
+func WithClientID(c net.Conn, id string) net.Conn {
+	if id == "" {
+		return c
+	}
+
+	return &clientIDConn{
+		Conn:     c,
+		clientID: func() string { return id },
+	}
+}
+
+type clientIDConn struct {
+	net.Conn
+	clientID func() string
+	once     sync.Once
+	id       string
+	md       map[string]any
+	mu       sync.Mutex
+}
+
+// Metadata implements metadata.Metadatable interface,
+// the metadata of the underlying connection is kept.
+func (c *clientIDConn) Metadata() metadata.Metadata {
+	return c
+}
+
+func (c *clientIDConn) IsExists(key string) bool {
+	if key == MetadataKeyClientID {
+		return c.ID() != ""
+	}
+
+	c.mu.Lock()
+	_, ok := c.md[key]
+	c.mu.Unlock()
+	if ok {
+		return true
+	}
+	if md := c.metadata(); md != nil {
+		return md.IsExists(key)
+	}
+	return false
+}
+
+func (c *clientIDConn) Set(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.md == nil {
+		c.md = make(map[string]any)
+	}
+	c.md[key] = value
+}
+
+func (c *clientIDConn) Get(key string) any {
+	if key == MetadataKeyClientID {
+		return c.ID()
+	}
+
+	c.mu.Lock()
+	v, ok := c.md[key]
+	c.mu.Unlock()
+	if ok {
+		return v
+	}
+	if md := c.metadata(); md != nil {
+		return md.Get(key)
+	}
+	return nil
+}
+
+// ID returns the client ID of the connection, empty if the client certificate is not verified.
+func (c *clientIDConn) ID() string {
+	c.once.Do(func() {
+		c.id = c.clientID()
+	})
+	return c.id
+}
+
+func (c *clientIDConn) metadata() metadata.Metadata {
+	if md, ok := c.Conn.(metadata.Metadatable); ok {
+		return md.Metadata()
+	}
+	return nil
+}
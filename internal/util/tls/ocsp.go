@@ -0,0 +1,242 @@
+package tls
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/logger"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	defaultOCSPTTL = time.Hour
+	// the time to wait before retrying the failed fetch of the OCSP response.
+	ocspRetryInterval = time.Minute
+	ocspTimeout       = 10 * time.Second
+	// the max size of the OCSP response.
+	maxOCSPResponseSize = 1 << 20
+)
+
+var (
+	errNoOCSPResponder = errors.New("no OCSP responder in certificate")
+)
+
+type ocspEntry struct {
+	staple []byte
+	// the staple is not valid after the time.
+	expires time.Time
+	// the staple is refreshed after the time.
+	refresh  time.Time
+	fetching bool
+}
+
+// OCSPStapler fetches and caches the OCSP responses of the server certificates,
+// and staples them in the TLS handshakes.
+// The responses are fetched in the background from the responder in the certificate,
+// the handshakes are never blocked by the responder, they go without the staple
+// until the first response is fetched, or when the cached response is expired.
+type OCSPStapler struct {
+	ttl     time.Duration
+	client  *http.Client
+	entries map[string]*ocspEntry
+	mu      sync.Mutex
+	log     logger.Logger
+}
+
+// NewOCSPStapler creates an OCSPStapler, the responses are refreshed after ttl,
+// or at the half of the validity period of the response if it is earlier.
+func NewOCSPStapler(ttl time.Duration, log logger.Logger) *OCSPStapler {
+	if ttl <= 0 {
+		ttl = defaultOCSPTTL
+	}
+	return &OCSPStapler{
+		ttl: ttl,
+		client: &http.Client{
+			Timeout: ocspTimeout,
+		},
+		entries: make(map[string]*ocspEntry),
+		log:     log,
+	}
+}
+
+// Config returns a copy of cfg stapling the OCSP responses of its certificates.
+func (s *OCSPStapler) Config(cfg *tls.Config) *tls.Config {
+	if s == nil || cfg == nil {
+		return cfg
+	}
+
+	cfg = cfg.Clone()
+	certs := cfg.Certificates
+	getCertificate := cfg.GetCertificate
+	// all the certificates are selected by GetCertificate, so they can be stapled.
+	cfg.Certificates = nil
+	cfg.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		var cert *tls.Certificate
+		if getCertificate != nil {
+			var err error
+			if cert, err = getCertificate(hello); err != nil {
+				return nil, err
+			}
+		}
+		if cert == nil {
+			cert = selectCertificate(hello, certs)
+		}
+		if cert == nil {
+			return nil, fmt.Errorf("tls: no certificate")
+		}
+		return s.staple(cert), nil
+	}
+
+	for i := range certs {
+		s.staple(&certs[i])
+	}
+	return cfg
+}
+
+func selectCertificate(hello *tls.ClientHelloInfo, certs []tls.Certificate) *tls.Certificate {
+	if len(certs) == 0 {
+		return nil
+	}
+	for i := range certs {
+		if hello.SupportsCertificate(&certs[i]) == nil {
+			return &certs[i]
+		}
+	}
+	return &certs[0]
+}
+
+// staple returns a copy of cert with the cached OCSP response,
+// and starts the fetch of the response if it is missing or to be refreshed.
+func (s *OCSPStapler) staple(cert *tls.Certificate) *tls.Certificate {
+	if len(cert.Certificate) < 2 || len(cert.OCSPStaple) > 0 {
+		// the issuer is required for the OCSP request.
+		return cert
+	}
+
+	key := string(cert.Certificate[0])
+	now := time.Now()
+
+	s.mu.Lock()
+	entry := s.entries[key]
+	if entry == nil {
+		entry = &ocspEntry{}
+		s.entries[key] = entry
+	}
+	if !entry.fetching && !now.Before(entry.refresh) {
+		entry.fetching = true
+		go s.fetch(key, cert)
+	}
+	var staple []byte
+	if now.Before(entry.expires) {
+		staple = entry.staple
+	}
+	s.mu.Unlock()
+
+	if staple == nil {
+		return cert
+	}
+	c := *cert
+	c.OCSPStaple = staple
+	return &c
+}
+
+func (s *OCSPStapler) fetch(key string, cert *tls.Certificate) {
+	resp, raw, err := s.request(cert)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.entries[key]
+	entry.fetching = false
+	now := time.Now()
+	if errors.Is(err, errNoOCSPResponder) {
+		// the certificate is never stapled.
+		entry.refresh = now.Add(100 * 365 * 24 * time.Hour)
+		s.log.Debugf("ocsp: %v", err)
+		return
+	}
+	if err != nil {
+		// the cached response is kept until it is expired.
+		entry.refresh = now.Add(ocspRetryInterval)
+		s.log.Warnf("ocsp: %v", err)
+		return
+	}
+	if resp.Status == ocsp.Revoked {
+		s.log.Warnf("ocsp: certificate %x is revoked at %s", resp.SerialNumber, resp.RevokedAt)
+	}
+
+	entry.staple = raw
+	entry.expires = resp.NextUpdate
+	if entry.expires.IsZero() {
+		entry.expires = now.Add(s.ttl)
+	}
+	entry.refresh = now.Add(s.ttl)
+	if half := resp.ThisUpdate.Add(entry.expires.Sub(resp.ThisUpdate) / 2); half.Before(entry.refresh) {
+		entry.refresh = half
+	}
+	s.log.Debugf("ocsp: certificate %x stapled, status %d, next update %s", resp.SerialNumber, resp.Status, resp.NextUpdate)
+}
+
+func (s *OCSPStapler) request(cert *tls.Certificate) (*ocsp.Response, []byte, error) {
+	leaf := cert.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, nil, err
+		}
+	}
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return queryOCSP(s.client, leaf, issuer)
+}
+
+// queryOCSP queries the OCSP responder in the certificate for the status of it.
+func queryOCSP(client *http.Client, leaf, issuer *x509.Certificate) (*ocsp.Response, []byte, error) {
+	if len(leaf.OCSPServer) == 0 {
+		return nil, nil, fmt.Errorf("%w %x", errNoOCSPResponder, leaf.SerialNumber)
+	}
+
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ocspTimeout)
+	defer cancel()
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, leaf.OCSPServer[0], bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, err
+	}
+	r.Header.Set("Content-Type", "application/ocsp-request")
+	r.Header.Set("Accept", "application/ocsp-response")
+
+	res, err := client.Do(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("responder %s: %s", leaf.OCSPServer[0], res.Status)
+	}
+	raw, err := io.ReadAll(io.LimitReader(res.Body, maxOCSPResponseSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, raw, nil
+}
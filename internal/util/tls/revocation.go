@@ -0,0 +1,338 @@
+package tls
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/logger"
+	"github.com/go-gost/core/metrics"
+	xmetrics "github.com/go-gost/x/metrics"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// the interval of checking the modification of the CRL files.
+	crlReloadInterval = time.Minute
+	// the time the OCSP status is cached if the response has no next update.
+	defaultOCSPStatusTTL = time.Hour
+)
+
+var (
+	ErrCertRevoked = errors.New("tls: certificate is revoked")
+)
+
+type OCSPMode string
+
+const (
+	// OCSPModeOff disables the OCSP checking.
+	OCSPModeOff OCSPMode = ""
+	// OCSPModeSoft rejects the revoked certificates, and accepts the certificates
+	// if the status is not available, such as the responder is unreachable.
+	OCSPModeSoft OCSPMode = "soft"
+	// OCSPModeHard accepts only the certificates with the good status.
+	OCSPModeHard OCSPMode = "hard"
+)
+
+// the reasons of the rejected certificates.
+const (
+	reasonCRL         = "crl"
+	reasonOCSP        = "ocsp"
+	reasonUnavailable = "unavailable"
+)
+
+// ParseOCSPMode parses the OCSP mode, it is off, soft or hard.
+func ParseOCSPMode(s string) (OCSPMode, error) {
+	switch mode := OCSPMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case OCSPModeOff, OCSPModeSoft, OCSPModeHard:
+		return mode, nil
+	case "off":
+		return OCSPModeOff, nil
+	}
+	return OCSPModeOff, fmt.Errorf("unknown OCSP mode %q", s)
+}
+
+type crlFile struct {
+	file    string
+	modTime time.Time
+	lists   []*x509.RevocationList
+}
+
+type ocspStatus struct {
+	revoked bool
+	// the status is not available.
+	err     error
+	expires time.Time
+}
+
+// RevocationChecker checks the revocation of the client certificates presented in the TLS handshakes,
+// by the CRL files and (or) the OCSP responders of the certificates.
+// The CRLs are matched by the issuer and their signatures are verified by the issuer in the verified chain,
+// the files are reloaded once they are modified. The rejected certificates are logged and counted by the reason.
+type RevocationChecker struct {
+	service  string
+	crls     []*crlFile
+	crlCheck time.Time
+	ocspMode OCSPMode
+	client   *http.Client
+	statuses map[string]*ocspStatus
+	mu       sync.Mutex
+	log      logger.Logger
+}
+
+// NewRevocationChecker creates a RevocationChecker with the CRL files and the OCSP mode,
+// nil is returned if neither is set. The CRL files must be loaded successfully.
+func NewRevocationChecker(service string, crlFiles []string, ocspMode OCSPMode, log logger.Logger) (*RevocationChecker, error) {
+	if len(crlFiles) == 0 && ocspMode == OCSPModeOff {
+		return nil, nil
+	}
+
+	c := &RevocationChecker{
+		service:  service,
+		ocspMode: ocspMode,
+		client: &http.Client{
+			Timeout: ocspTimeout,
+		},
+		statuses: make(map[string]*ocspStatus),
+		log:      log,
+	}
+	for _, file := range crlFiles {
+		f := &crlFile{file: file}
+		if err := f.load(); err != nil {
+			return nil, err
+		}
+		c.crls = append(c.crls, f)
+	}
+	c.crlCheck = time.Now()
+	return c, nil
+}
+
+// Config returns a copy of cfg checking the revocation of the verified client certificates.
+// The certificates are verified only if the config requires the client certificates to be verified.
+func (c *RevocationChecker) Config(cfg *tls.Config) *tls.Config {
+	if c == nil || cfg == nil {
+		return cfg
+	}
+
+	cfg = cfg.Clone()
+	verifyPeerCertificate := cfg.VerifyPeerCertificate
+	cfg.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if verifyPeerCertificate != nil {
+			if err := verifyPeerCertificate(rawCerts, verifiedChains); err != nil {
+				return err
+			}
+		}
+		for _, chain := range verifiedChains {
+			if err := c.Check(chain); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return cfg
+}
+
+// Check checks the revocation of the certificates of the verified chain except the root.
+func (c *RevocationChecker) Check(chain []*x509.Certificate) error {
+	if c == nil {
+		return nil
+	}
+
+	c.reloadCRLs()
+
+	for i := 0; i+1 < len(chain); i++ {
+		cert, issuer := chain[i], chain[i+1]
+		if c.revokedByCRL(cert, issuer) {
+			c.reject(reasonCRL)
+			c.log.Warnf("certificate %x (%s) is revoked by CRL", cert.SerialNumber, cert.Subject)
+			return ErrCertRevoked
+		}
+		if c.ocspMode != OCSPModeOff && i == 0 {
+			if err := c.checkOCSP(cert, issuer); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *RevocationChecker) reject(reason string) {
+	if v := xmetrics.GetCounter(xmetrics.MetricServiceTLSRevokedCounter,
+		metrics.Labels{"service": c.service, "reason": reason}); v != nil {
+		v.Inc()
+	}
+}
+
+func (c *RevocationChecker) revokedByCRL(cert, issuer *x509.Certificate) bool {
+	c.mu.Lock()
+	crls := c.crls
+	c.mu.Unlock()
+
+	for _, f := range crls {
+		for _, crl := range f.lists {
+			if !bytes.Equal(crl.RawIssuer, cert.RawIssuer) {
+				continue
+			}
+			if err := crl.CheckSignatureFrom(issuer); err != nil {
+				continue
+			}
+			for _, entry := range crl.RevokedCertificateEntries {
+				if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// reloadCRLs reloads the modified CRL files, the failed file keeps the last loaded lists.
+func (c *RevocationChecker) reloadCRLs() {
+	c.mu.Lock()
+	if len(c.crls) == 0 || time.Since(c.crlCheck) < crlReloadInterval {
+		c.mu.Unlock()
+		return
+	}
+	c.crlCheck = time.Now()
+	crls := c.crls
+	c.mu.Unlock()
+
+	changed := false
+	var reloaded []*crlFile
+	for _, f := range crls {
+		info, err := os.Stat(f.file)
+		if err != nil || info.ModTime().Equal(f.modTime) {
+			reloaded = append(reloaded, f)
+			continue
+		}
+		nf := &crlFile{file: f.file}
+		if err := nf.load(); err != nil {
+			c.log.Warnf("reload CRL %s: %v", f.file, err)
+			reloaded = append(reloaded, f)
+			continue
+		}
+		c.log.Debugf("CRL %s reloaded", f.file)
+		reloaded = append(reloaded, nf)
+		changed = true
+	}
+
+	if changed {
+		c.mu.Lock()
+		c.crls = reloaded
+		c.mu.Unlock()
+	}
+}
+
+func (c *RevocationChecker) checkOCSP(cert, issuer *x509.Certificate) error {
+	key := string(issuer.RawSubjectPublicKeyInfo) + cert.SerialNumber.String()
+	now := time.Now()
+
+	c.mu.Lock()
+	status := c.statuses[key]
+	c.mu.Unlock()
+
+	if status == nil || !now.Before(status.expires) {
+		status = c.queryStatus(cert, issuer)
+
+		c.mu.Lock()
+		// the expired statuses are swept on the way.
+		for k, v := range c.statuses {
+			if !now.Before(v.expires) {
+				delete(c.statuses, k)
+			}
+		}
+		c.statuses[key] = status
+		c.mu.Unlock()
+	}
+
+	if status.revoked {
+		c.reject(reasonOCSP)
+		c.log.Warnf("certificate %x (%s) is revoked by OCSP", cert.SerialNumber, cert.Subject)
+		return ErrCertRevoked
+	}
+	if status.err != nil {
+		if c.ocspMode == OCSPModeHard {
+			c.reject(reasonUnavailable)
+			c.log.Warnf("certificate %x (%s) is rejected, OCSP status is not available: %v", cert.SerialNumber, cert.Subject, status.err)
+			return fmt.Errorf("tls: certificate %x: %w", cert.SerialNumber, status.err)
+		}
+		c.log.Debugf("ocsp: certificate %x: %v", cert.SerialNumber, status.err)
+	}
+	return nil
+}
+
+// queryStatus queries the OCSP status of the certificate,
+// the unavailable status is cached for a while, so the handshakes are not blocked by the responder each time.
+func (c *RevocationChecker) queryStatus(cert, issuer *x509.Certificate) *ocspStatus {
+	resp, _, err := queryOCSP(c.client, cert, issuer)
+	if err == nil && resp.Status == ocsp.Unknown {
+		err = errors.New("unknown OCSP status")
+	}
+	if err != nil {
+		return &ocspStatus{
+			err:     err,
+			expires: time.Now().Add(ocspRetryInterval),
+		}
+	}
+
+	status := &ocspStatus{
+		revoked: resp.Status == ocsp.Revoked,
+		expires: resp.NextUpdate,
+	}
+	if status.expires.IsZero() {
+		status.expires = time.Now().Add(defaultOCSPStatusTTL)
+	}
+	return status
+}
+
+// load loads the CRLs in the file, the file is in PEM (one or more X509 CRL blocks) or DER.
+func (f *crlFile) load() error {
+	info, err := os.Stat(f.file)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(f.file)
+	if err != nil {
+		return err
+	}
+
+	var lists []*x509.RevocationList
+	if bytes.Contains(data, []byte("-----BEGIN")) {
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			if block.Type != "X509 CRL" {
+				continue
+			}
+			crl, err := x509.ParseRevocationList(block.Bytes)
+			if err != nil {
+				return fmt.Errorf("CRL %s: %w", f.file, err)
+			}
+			lists = append(lists, crl)
+		}
+	} else {
+		crl, err := x509.ParseRevocationList(data)
+		if err != nil {
+			return fmt.Errorf("CRL %s: %w", f.file, err)
+		}
+		lists = append(lists, crl)
+	}
+	if len(lists) == 0 {
+		return fmt.Errorf("CRL %s: no CRL found", f.file)
+	}
+
+	f.modTime = info.ModTime()
+	f.lists = lists
+	return nil
+}
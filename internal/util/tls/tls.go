@@ -224,6 +224,43 @@ func SetTLSOptions(cfg *tls.Config, opts *config.TLSOptions) {
 	}
 }
 
+// ParseVersion parses the TLS version name, such as VersionTLS13 (case-insensitive).
+func ParseVersion(s string) (uint16, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case strings.ToLower(VersionTLS10):
+		return tls.VersionTLS10, nil
+	case strings.ToLower(VersionTLS11):
+		return tls.VersionTLS11, nil
+	case strings.ToLower(VersionTLS12):
+		return tls.VersionTLS12, nil
+	case strings.ToLower(VersionTLS13):
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q", s)
+}
+
+// ParseCipherSuites parses the cipher suite names, such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (case-insensitive).
+// Unlike SetTLSOptions, an unknown name is an error.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	suites := map[string]uint16{}
+	for _, cs := range tls.CipherSuites() {
+		suites[strings.ToLower(cs.Name)] = cs.ID
+	}
+	for _, cs := range tls.InsecureCipherSuites() {
+		suites[strings.ToLower(cs.Name)] = cs.ID
+	}
+
+	var ids []uint16
+	for _, name := range names {
+		id, ok := suites[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 func loadCA(caFile string) (cp *x509.CertPool, err error) {
 	if caFile == "" {
 		return
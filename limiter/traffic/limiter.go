@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"time"
 
 	limiter "github.com/go-gost/core/limiter/traffic"
 	"golang.org/x/time/rate"
@@ -28,6 +29,14 @@ func (l *llimiter) Wait(ctx context.Context, n int) int {
 	return n
 }
 
+func (l *llimiter) burst(n int) int {
+	return min(n, l.limiter.Burst())
+}
+
+func (l *llimiter) reserve(now time.Time, n int) []*rate.Reservation {
+	return []*rate.Reservation{l.limiter.ReserveN(now, n)}
+}
+
 func (l *llimiter) Limit() int {
 	return int(l.limiter.Limit())
 }
@@ -41,6 +50,14 @@ func (l *llimiter) String() string {
 	return strconv.Itoa(int(l.limiter.Limit()))
 }
 
+// reserver is the limiter reserving the tokens without waiting,
+// so the waits of the limiters in a group are merged into one.
+type reserver interface {
+	// burst caps n to the tokens reserved at once.
+	burst(n int) int
+	reserve(now time.Time, n int) []*rate.Reservation
+}
+
 type limiterGroup struct {
 	limiters []limiter.Limiter
 }
@@ -52,7 +69,60 @@ func newLimiterGroup(limiters ...limiter.Limiter) *limiterGroup {
 	return &limiterGroup{limiters: limiters}
 }
 
+// Chain chains the limiters, such as the limiters of the service and the client,
+// the same tokens are taken from all of them, so the most restrictive one wins.
+// The nil and unlimited limiters are skipped, nil is returned if no limiter is left.
+func Chain(limiters ...limiter.Limiter) limiter.Limiter {
+	var lims []limiter.Limiter
+	for _, lim := range limiters {
+		if lim != nil && lim.Limit() > 0 {
+			lims = append(lims, lim)
+		}
+	}
+
+	switch len(lims) {
+	case 0:
+		return nil
+	case 1:
+		return lims[0]
+	default:
+		return newLimiterGroup(lims...)
+	}
+}
+
+// Wait takes the same tokens from all the limiters, and waits once for the longest delay of them,
+// instead of waiting for each limiter in sequence.
 func (l *limiterGroup) Wait(ctx context.Context, n int) int {
+	if !canReserve(l) {
+		return l.waitEach(ctx, n)
+	}
+
+	n = l.burst(n)
+	now := time.Now()
+	rs := l.reserve(now, n)
+
+	var delay time.Duration
+	for _, r := range rs {
+		delay = max(delay, r.DelayFrom(now))
+	}
+	if delay <= 0 {
+		return n
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+		for _, r := range rs {
+			r.Cancel()
+		}
+	}
+	return n
+}
+
+// waitEach waits for each limiter in sequence, for the limiters not reserving the tokens.
+func (l *limiterGroup) waitEach(ctx context.Context, n int) int {
 	for i := range l.limiters {
 		if v := l.limiters[i].Wait(ctx, n); v < n {
 			n = v
@@ -61,6 +131,40 @@ func (l *limiterGroup) Wait(ctx context.Context, n int) int {
 	return n
 }
 
+func canReserve(lim limiter.Limiter) bool {
+	switch v := lim.(type) {
+	case *limiterGroup:
+		for _, lim := range v.limiters {
+			if !canReserve(lim) {
+				return false
+			}
+		}
+		return true
+	case reserver:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *limiterGroup) burst(n int) int {
+	for _, lim := range l.limiters {
+		if r, ok := lim.(reserver); ok {
+			n = r.burst(n)
+		}
+	}
+	return n
+}
+
+func (l *limiterGroup) reserve(now time.Time, n int) (rs []*rate.Reservation) {
+	for _, lim := range l.limiters {
+		if r, ok := lim.(reserver); ok {
+			rs = append(rs, r.reserve(now, n)...)
+		}
+	}
+	return
+}
+
 func (l *limiterGroup) Limit() int {
 	if len(l.limiters) == 0 {
 		return 0
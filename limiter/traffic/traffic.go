@@ -23,6 +23,12 @@ const (
 	ConnLimitKey   = "$$"
 )
 
+const (
+	// ScopeTunnel is the scope of the limiters shared by all the connections of a tunnel,
+	// the key is the tunnel ID.
+	ScopeTunnel = "tunnel"
+)
+
 const (
 	defaultExpiration = 15 * time.Second
 	cleanupInterval   = 30 * time.Second
@@ -138,6 +144,13 @@ func (l *trafficLimiter) In(ctx context.Context, key string, opts ...limiter.Opt
 	case limiter.ScopeClient:
 		return nil
 
+	case ScopeTunnel:
+		// the tunnel ID is matched by the named limits.
+		if lim, ok := l.inLimits.Get(key); ok && lim != nil {
+			return lim.(traffic.Limiter)
+		}
+		return nil
+
 	case limiter.ScopeConn:
 		fallthrough
 	default:
@@ -217,6 +230,13 @@ func (l *trafficLimiter) Out(ctx context.Context, key string, opts ...limiter.Op
 	case limiter.ScopeClient:
 		return nil
 
+	case ScopeTunnel:
+		// the tunnel ID is matched by the named limits.
+		if lim, ok := l.outLimits.Get(key); ok && lim != nil {
+			return lim.(traffic.Limiter)
+		}
+		return nil
+
 	case limiter.ScopeConn:
 		fallthrough
 	default:
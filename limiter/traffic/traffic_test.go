@@ -0,0 +1,51 @@
+package traffic
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-gost/core/limiter"
+	xlogger "github.com/go-gost/x/logger"
+)
+
+func TestTrafficLimiterScope(t *testing.T) {
+	const tid = "8a8ee6ab-ec04-4e0c-b3a4-1b14bb9f0bb4"
+
+	lim := NewTrafficLimiter(
+		LimitsOption(
+			"$ 100KB 200KB",
+			tid+" 10KB 20KB",
+			"user1 30KB 40KB",
+		),
+		LoggerOption(xlogger.Nop()),
+	)
+
+	tests := []struct {
+		name    string
+		key     string
+		scope   string
+		in, out int
+	}{
+		{name: "service", key: "", scope: limiter.ScopeService, in: 100 * 1024, out: 200 * 1024},
+		{name: "tunnel", key: tid, scope: ScopeTunnel, in: 10 * 1024, out: 20 * 1024},
+		{name: "tunnel not limited", key: "e8f2a3c1-9b1d-4a6f-8d2e-5c7b9a0f1e23", scope: ScopeTunnel},
+		// the client scope is left to the plugins, the named limits are not matched by the client ID.
+		{name: "client", key: "user1", scope: limiter.ScopeClient},
+		{name: "client of the tunnel ID", key: tid, scope: limiter.ScopeClient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var in, out int
+			if v := lim.In(context.Background(), tt.key, limiter.ScopeOption(tt.scope)); v != nil {
+				in = v.Limit()
+			}
+			if v := lim.Out(context.Background(), tt.key, limiter.ScopeOption(tt.scope)); v != nil {
+				out = v.Limit()
+			}
+			if in != tt.in || out != tt.out {
+				t.Errorf("limits: got %d/%d, want %d/%d", in, out, tt.in, tt.out)
+			}
+		})
+	}
+}
@@ -24,25 +24,30 @@ type limitConn struct {
 	net.Conn
 	rbuf    bytes.Buffer
 	limiter traffic.TrafficLimiter
-	opts    []limiter.Option
-	key     string
+	scopes  []Scope
+	// the tokens taken but not written by the partial write, they are used by the next write.
+	wcredit int
 }
 
 func WrapConn(c net.Conn, tlimiter traffic.TrafficLimiter, key string, opts ...limiter.Option) net.Conn {
-	if tlimiter == nil {
+	return WrapConnScopes(c, tlimiter, Scope{Key: key, Opts: opts})
+}
+
+// WrapConnScopes is like WrapConn, but the limiters of all the scopes apply together, see WrapReadWriterScopes.
+func WrapConnScopes(c net.Conn, tlimiter traffic.TrafficLimiter, scopes ...Scope) net.Conn {
+	if tlimiter == nil || len(scopes) == 0 {
 		return c
 	}
 
 	return &limitConn{
 		Conn:    c,
 		limiter: tlimiter,
-		opts:    opts,
-		key:     key,
+		scopes:  scopes,
 	}
 }
 
 func (c *limitConn) Read(b []byte) (n int, err error) {
-	limiter := c.limiter.In(context.Background(), c.key, c.opts...)
+	limiter := in(c.limiter, c.scopes)
 	if limiter == nil || limiter.Limit() <= 0 {
 		return c.Conn.Read(b)
 	}
@@ -72,14 +77,18 @@ func (c *limitConn) Read(b []byte) (n int, err error) {
 }
 
 func (c *limitConn) Write(b []byte) (n int, err error) {
-	limiter := c.limiter.Out(context.Background(), c.key, c.opts...)
+	limiter := out(c.limiter, c.scopes)
 	if limiter == nil || limiter.Limit() <= 0 {
 		return c.Conn.Write(b)
 	}
 
 	nn := 0
 	for len(b) > 0 {
-		nn, err = c.Conn.Write(b[:limiter.Wait(context.Background(), len(b))])
+		if c.wcredit <= 0 {
+			c.wcredit = limiter.Wait(context.Background(), len(b))
+		}
+		nn, err = c.Conn.Write(b[:min(c.wcredit, len(b))])
+		c.wcredit -= nn
 		n += nn
 		if err != nil {
 			return
@@ -14,25 +14,31 @@ type readWriter struct {
 	io.ReadWriter
 	rbuf    bytes.Buffer
 	limiter traffic.TrafficLimiter
-	opts    []limiter.Option
-	key     string
+	scopes  []Scope
+	// the tokens taken but not written by the partial write, they are used by the next write.
+	wcredit int
 }
 
 func WrapReadWriter(limiter traffic.TrafficLimiter, rw io.ReadWriter, key string, opts ...limiter.Option) io.ReadWriter {
-	if limiter == nil {
+	return WrapReadWriterScopes(limiter, rw, Scope{Key: key, Opts: opts})
+}
+
+// WrapReadWriterScopes is like WrapReadWriter, but the limiters of all the scopes apply together,
+// such as the limiters of the client and the service, the most restrictive of them wins.
+func WrapReadWriterScopes(limiter traffic.TrafficLimiter, rw io.ReadWriter, scopes ...Scope) io.ReadWriter {
+	if limiter == nil || len(scopes) == 0 {
 		return rw
 	}
 
 	return &readWriter{
 		ReadWriter: rw,
 		limiter:    limiter,
-		opts:       opts,
-		key:        key,
+		scopes:     scopes,
 	}
 }
 
 func (p *readWriter) Read(b []byte) (n int, err error) {
-	limiter := p.limiter.In(context.Background(), p.key, p.opts...)
+	limiter := in(p.limiter, p.scopes)
 	if limiter == nil || limiter.Limit() <= 0 {
 		return p.ReadWriter.Read(b)
 	}
@@ -62,14 +68,18 @@ func (p *readWriter) Read(b []byte) (n int, err error) {
 }
 
 func (p *readWriter) Write(b []byte) (n int, err error) {
-	limiter := p.limiter.Out(context.Background(), p.key, p.opts...)
+	limiter := out(p.limiter, p.scopes)
 	if limiter == nil || limiter.Limit() <= 0 {
 		return p.ReadWriter.Write(b)
 	}
 
 	nn := 0
 	for len(b) > 0 {
-		nn, err = p.ReadWriter.Write(b[:limiter.Wait(context.Background(), len(b))])
+		if p.wcredit <= 0 {
+			p.wcredit = limiter.Wait(context.Background(), len(b))
+		}
+		nn, err = p.ReadWriter.Write(b[:min(p.wcredit, len(b))])
+		p.wcredit -= nn
 		n += nn
 		if err != nil {
 			return
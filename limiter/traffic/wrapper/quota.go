@@ -0,0 +1,45 @@
+package wrapper
+
+import (
+	"io"
+)
+
+// QuotaCounter counts the traffic against the quotas.
+type QuotaCounter interface {
+	// Count counts n bytes, an error is returned once a quota is exceeded.
+	Count(n int) error
+}
+
+// quotaReadWriter is an io.ReadWriter failing once the quota is exceeded.
+type quotaReadWriter struct {
+	io.ReadWriter
+	counter QuotaCounter
+}
+
+func WrapQuotaReadWriter(rw io.ReadWriter, counter QuotaCounter) io.ReadWriter {
+	if counter == nil {
+		return rw
+	}
+
+	return &quotaReadWriter{
+		ReadWriter: rw,
+		counter:    counter,
+	}
+}
+
+func (p *quotaReadWriter) Read(b []byte) (n int, err error) {
+	n, err = p.ReadWriter.Read(b)
+	if n > 0 {
+		if e := p.counter.Count(n); e != nil {
+			return n, e
+		}
+	}
+	return
+}
+
+func (p *quotaReadWriter) Write(b []byte) (n int, err error) {
+	if err = p.counter.Count(len(b)); err != nil {
+		return
+	}
+	return p.ReadWriter.Write(b)
+}
@@ -0,0 +1,41 @@
+package wrapper
+
+import (
+	"context"
+
+	"github.com/go-gost/core/limiter"
+	"github.com/go-gost/core/limiter/traffic"
+	xtraffic "github.com/go-gost/x/limiter/traffic"
+)
+
+// Scope is the key of the limiters in a scope with the options, such as the client ID in the client scope.
+type Scope struct {
+	Key  string
+	Opts []limiter.Option
+}
+
+// in returns the input limiters of the scopes chained, nil if none of them is limited.
+func in(lim traffic.TrafficLimiter, scopes []Scope) traffic.Limiter {
+	if len(scopes) == 1 {
+		return lim.In(context.Background(), scopes[0].Key, scopes[0].Opts...)
+	}
+
+	var lims []traffic.Limiter
+	for _, scope := range scopes {
+		lims = append(lims, lim.In(context.Background(), scope.Key, scope.Opts...))
+	}
+	return xtraffic.Chain(lims...)
+}
+
+// out returns the output limiters of the scopes chained, nil if none of them is limited.
+func out(lim traffic.TrafficLimiter, scopes []Scope) traffic.Limiter {
+	if len(scopes) == 1 {
+		return lim.Out(context.Background(), scopes[0].Key, scopes[0].Opts...)
+	}
+
+	var lims []traffic.Limiter
+	for _, scope := range scopes {
+		lims = append(lims, lim.Out(context.Background(), scope.Key, scope.Opts...))
+	}
+	return xtraffic.Chain(lims...)
+}
@@ -20,6 +20,7 @@ import (
 	xnet "github.com/go-gost/x/internal/net"
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -28,6 +29,7 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("dns", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "dns", schema...)
 }
 
 type dnsListener struct {
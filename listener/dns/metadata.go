@@ -42,3 +42,13 @@ func (l *dnsListener) parseMetadata(md mdata.Metadata) (err error) {
 
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"backlog",
+	"mode",
+	"mptcp",
+	"readBufferSize",
+	"readTimeout",
+	"writeTimeout",
+}
@@ -17,6 +17,7 @@ import (
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	climiter "github.com/go-gost/x/limiter/conn/wrapper"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -25,6 +26,7 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("dtls", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "dtls", schema...)
 }
 
 type dtlsListener struct {
@@ -28,3 +28,13 @@ func (l *dtlsListener) parseMetadata(md mdata.Metadata) (err error) {
 
 	return nil
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"bufferSize",
+	"dtls.bufferSize",
+	"dtls.flightInterval",
+	"dtls.mtu",
+	"flightInterval",
+	"mtu",
+}
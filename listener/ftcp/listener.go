@@ -13,6 +13,7 @@ import (
 	"github.com/go-gost/x/internal/net/udp"
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -21,6 +22,7 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("ftcp", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "ftcp", schema...)
 }
 
 type ftcpListener struct {
@@ -51,3 +51,11 @@ func (l *ftcpListener) parseMetadata(md mdata.Metadata) (err error) {
 
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"backlog",
+	"readBufferSize",
+	"readQueueSize",
+	"ttl",
+}
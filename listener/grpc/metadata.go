@@ -55,3 +55,27 @@ func (l *grpcListener) parseMetadata(md mdata.Metadata) (err error) {
 
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"backlog",
+	"grpc.backlog",
+	"grpc.insecure",
+	"grpc.keepalive",
+	"grpc.keepalive.maxConnectionIdle",
+	"grpc.keepalive.minTime",
+	"grpc.keepalive.permitWithoutStream",
+	"grpc.keepalive.time",
+	"grpc.keepalive.timeout",
+	"grpc.path",
+	"grpcInsecure",
+	"insecure",
+	"keepalive",
+	"keepalive.maxConnectionIdle",
+	"keepalive.minTime",
+	"keepalive.permitWithoutStream",
+	"keepalive.time",
+	"keepalive.timeout",
+	"mptcp",
+	"path",
+}
@@ -4,8 +4,12 @@ import (
 	"errors"
 	"io"
 	"net"
-	"net/http"
+	"sync"
 	"time"
+
+	mdata "github.com/go-gost/core/metadata"
+	"github.com/go-gost/x/internal/util/forward"
+	mdx "github.com/go-gost/x/metadata"
 )
 
 // HTTP2 connection, wrapped up just like a net.Conn
@@ -15,6 +19,7 @@ type conn struct {
 	remoteAddr net.Addr
 	localAddr  net.Addr
 	closed     chan struct{}
+	closeOnce  sync.Once
 }
 
 func (c *conn) Read(b []byte) (n int, err error) {
@@ -26,18 +31,16 @@ func (c *conn) Write(b []byte) (n int, err error) {
 }
 
 func (c *conn) Close() (err error) {
-	select {
-	case <-c.closed:
-		return
-	default:
+	c.closeOnce.Do(func() {
+		if rc, ok := c.r.(io.Closer); ok {
+			err = rc.Close()
+		}
+		// the pending data of the writer is flushed before the handler of the stream returns.
+		if w, ok := c.w.(io.Closer); ok {
+			err = w.Close()
+		}
 		close(c.closed)
-	}
-	if rc, ok := c.r.(io.Closer); ok {
-		err = rc.Close()
-	}
-	if w, ok := c.w.(io.Closer); ok {
-		err = w.Close()
-	}
+	})
 	return
 }
 
@@ -61,29 +64,59 @@ func (c *conn) SetWriteDeadline(t time.Time) error {
 	return &net.OpError{Op: "set", Net: "http2", Source: nil, Addr: nil, Err: errors.New("deadline not supported")}
 }
 
-type flushWriter struct {
-	w io.Writer
+// connectConn is the hijacked connection of the HTTP/1.1 CONNECT request.
+// The request is answered by the handler by the forward.Replier in the metadata once the target is dialed,
+// or with 200 at the first read or write of the handler not answering it.
+type connectConn struct {
+	net.Conn
+	md   mdata.Metadata
+	once sync.Once
+	err  error
+}
+
+func newConnectConn(c net.Conn, target string) *connectConn {
+	cc := &connectConn{
+		Conn: c,
+	}
+	cc.md = mdx.NewMetadata(map[string]any{
+		forward.MetadataKeyTarget: target,
+		forward.MetadataKeyReply:  forward.Replier(cc.reply),
+	})
+	return cc
 }
 
-func (fw flushWriter) Write(p []byte) (n int, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			if s, ok := r.(string); ok {
-				err = errors.New(s)
-				// log.Log("[http2]", err)
-				return
-			}
-			err = r.(error)
+func (c *connectConn) reply(err error) error {
+	c.once.Do(func() {
+		status := "200 Connection established"
+		switch {
+		case err == nil:
+		case errors.Is(err, forward.ErrTargetNotAllowed):
+			status = "403 Forbidden"
+		default:
+			status = "502 Bad Gateway"
+		}
+		if _, c.err = c.Conn.Write([]byte("HTTP/1.1 " + status + "\r\n\r\n")); c.err == nil && err != nil {
+			c.err = err
 		}
-	}()
+	})
+	return c.err
+}
 
-	n, err = fw.w.Write(p)
-	if err != nil {
-		// log.Log("flush writer:", err)
+func (c *connectConn) Read(b []byte) (n int, err error) {
+	if err = c.reply(nil); err != nil {
 		return
 	}
-	if f, ok := fw.w.(http.Flusher); ok {
-		f.Flush()
+	return c.Conn.Read(b)
+}
+
+func (c *connectConn) Write(b []byte) (n int, err error) {
+	if err = c.reply(nil); err != nil {
+		return
 	}
-	return
+	return c.Conn.Write(b)
+}
+
+// Metadata implements metadata.Metadatable interface.
+func (c *connectConn) Metadata() mdata.Metadata {
+	return c.md
 }
@@ -4,9 +4,11 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"log"
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"strings"
 	"time"
 
 	"github.com/go-gost/core/limiter"
@@ -15,10 +17,14 @@ import (
 	md "github.com/go-gost/core/metadata"
 	admission "github.com/go-gost/x/admission/wrapper"
 	xnet "github.com/go-gost/x/internal/net"
+	"github.com/go-gost/x/internal/net/acceptlimit"
 	"github.com/go-gost/x/internal/net/proxyproto"
+	http_util "github.com/go-gost/x/internal/util/http"
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	climiter "github.com/go-gost/x/limiter/conn/wrapper"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
+	xmetrics "github.com/go-gost/x/metrics"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -28,7 +34,9 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("h2c", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "h2c", schema...)
 	registry.ListenerRegistry().Register("h2", NewTLSListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "h2", schema...)
 }
 
 type h2Listener struct {
@@ -40,6 +48,7 @@ type h2Listener struct {
 	md      metadata
 	h2c     bool
 	options listener.Options
+	stats   *stats.ListenerStats
 }
 
 func NewListener(opts ...listener.Option) listener.Listener {
@@ -70,15 +79,33 @@ func (l *h2Listener) Init(md md.Metadata) (err error) {
 		return
 	}
 
+	l.stats = stats.NewListenerStats(l.options.Service)
 	l.server = &http.Server{
-		Addr: l.options.Addr,
+		Addr:           l.options.Addr,
+		MaxHeaderBytes: l.md.maxHeaderBytes,
+		ConnState:      l.connState,
+		// the TLS handshakes are performed by the server, the failures of them are only reported in the error log.
+		ErrorLog: log.New(&serverErrorLog{logger: l.logger, stats: l.stats}, "", 0),
+	}
+	// the header limit of the h2 streams is taken from the MaxHeaderBytes of the http.Server.
+	h2s := &http2.Server{
+		MaxDecoderHeaderTableSize:    l.md.maxDecoderHeaderTableSize,
+		MaxEncoderHeaderTableSize:    l.md.maxEncoderHeaderTableSize,
+		MaxReadFrameSize:             l.md.maxReadFrameSize,
+		MaxUploadBufferPerConnection: l.md.initialConnWindowSize,
+		MaxUploadBufferPerStream:     l.md.initialStreamWindowSize,
 	}
 
 	network := "tcp"
 	if xnet.IsIPv4(l.options.Addr) {
 		network = "tcp4"
 	}
-	lc := net.ListenConfig{}
+	lc := xnet.ListenConfig{
+		Netns: l.md.netns,
+		ListenConfig: net.ListenConfig{
+			Control: xnet.BindDeviceControl(l.md.device),
+		},
+	}
 	if l.md.mptcp {
 		lc.SetMultipathTCP(true)
 		l.logger.Debugf("mptcp enabled: %v", lc.MultipathTCP())
@@ -88,6 +115,8 @@ func (l *h2Listener) Init(md md.Metadata) (err error) {
 		return err
 	}
 	l.addr = ln.Addr()
+	ln = acceptlimit.WrapListener(ln, l.md.acceptLimit)
+
 	ln = proxyproto.WrapListener(l.options.ProxyProtocol, ln, 10*time.Second)
 	ln = metrics.WrapListener(l.options.Service, ln)
 	ln = stats.WrapListener(ln, l.options.Stats)
@@ -101,15 +130,16 @@ func (l *h2Listener) Init(md md.Metadata) (err error) {
 
 	if l.h2c {
 		l.server.Handler = h2c.NewHandler(
-			http.HandlerFunc(l.handleFunc), &http2.Server{})
+			http.HandlerFunc(l.handleFunc), h2s)
 	} else {
+		tlsConfig := l.tlsConfig()
 		l.server.Handler = http.HandlerFunc(l.handleFunc)
-		l.server.TLSConfig = l.options.TLSConfig
-		if err := http2.ConfigureServer(l.server, nil); err != nil {
+		l.server.TLSConfig = tlsConfig
+		if err := http2.ConfigureServer(l.server, h2s); err != nil {
 			ln.Close()
 			return err
 		}
-		ln = tls.NewListener(ln, l.options.TLSConfig)
+		ln = tls.NewListener(ln, tlsConfig)
 	}
 
 	l.cqueue = make(chan net.Conn, l.md.backlog)
@@ -124,10 +154,35 @@ func (l *h2Listener) Init(md md.Metadata) (err error) {
 	return
 }
 
+// tlsConfig applies the TLS overrides of the metadata on a copy of the TLS config of the service,
+// the config shared with the other services is not modified.
+func (l *h2Listener) tlsConfig() *tls.Config {
+	if l.md.tlsMinVersion == 0 && l.md.tlsMaxVersion == 0 && len(l.md.tlsCipherSuites) == 0 {
+		return l.md.revocation.Config(l.md.ocsp.Config(l.options.TLSConfig))
+	}
+
+	cfg := &tls.Config{}
+	if l.options.TLSConfig != nil {
+		cfg = l.options.TLSConfig.Clone()
+	}
+	if l.md.tlsMinVersion > 0 {
+		cfg.MinVersion = l.md.tlsMinVersion
+	}
+	if l.md.tlsMaxVersion > 0 {
+		cfg.MaxVersion = l.md.tlsMaxVersion
+	}
+	if len(l.md.tlsCipherSuites) > 0 {
+		// the cipher suites of TLS 1.3 are not configurable, they are used as is.
+		cfg.CipherSuites = l.md.tlsCipherSuites
+	}
+	return l.md.revocation.Config(l.md.ocsp.Config(cfg))
+}
+
 func (l *h2Listener) Accept() (conn net.Conn, err error) {
 	var ok bool
 	select {
 	case conn = <-l.cqueue:
+		l.stats.Queued(-1)
 		conn = limiter_wrapper.WrapConn(
 			conn,
 			limiter_util.NewCachedTrafficLimiter(l.options.TrafficLimiter, 30*time.Second, 60*time.Second),
@@ -160,19 +215,39 @@ func (l *h2Listener) Close() (err error) {
 	return nil
 }
 
+func (l *h2Listener) connState(c net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		l.stats.Accepted()
+		l.stats.Served(1)
+	case http.StateHijacked, http.StateClosed:
+		l.stats.Served(-1)
+	}
+}
+
 func (l *h2Listener) handleFunc(w http.ResponseWriter, r *http.Request) {
 	if l.logger.IsLevelEnabled(logger.TraceLevel) {
 		dump, _ := httputil.DumpRequest(r, false)
 		l.logger.Trace(string(dump))
 	}
+	if r.Method == http.MethodConnect && r.ProtoMajor == 1 {
+		l.handleConnect(w, r)
+		return
+	}
+
+	span := xmetrics.StartSpan(xmetrics.MetricServiceHandshakeDurationObserver, l.options.Service)
 	conn, err := l.upgrade(w, r)
+	span.End(err)
 	if err != nil {
 		l.logger.Error(err)
 		return
 	}
+	l.stats.Queued(1)
 	select {
 	case l.cqueue <- conn:
 	default:
+		l.stats.Queued(-1)
+		l.stats.Dropped()
 		conn.Close()
 		l.logger.Warnf("connection queue is full, client %s discarded", r.RemoteAddr)
 	}
@@ -180,6 +255,48 @@ func (l *h2Listener) handleFunc(w http.ResponseWriter, r *http.Request) {
 	<-conn.closed // NOTE: we need to wait for streaming end, or the connection will be closed
 }
 
+// handleConnect serves the HTTP/1.1 CONNECT request of the client not speaking h2,
+// the connection is hijacked and queued as a raw connection with the target of the request in the metadata,
+// the request is answered after the handler dials the target.
+func (l *h2Listener) handleConnect(w http.ResponseWriter, r *http.Request) {
+	span := xmetrics.StartSpan(xmetrics.MetricServiceHandshakeDurationObserver, l.options.Service)
+	conn, err := l.hijack(w, r)
+	span.End(err)
+	if err != nil {
+		l.logger.Error(err)
+		return
+	}
+
+	l.stats.Queued(1)
+	select {
+	case l.cqueue <- conn:
+	default:
+		l.stats.Queued(-1)
+		l.stats.Dropped()
+		conn.Close()
+		l.logger.Warnf("connection queue is full, client %s discarded", r.RemoteAddr)
+	}
+}
+
+func (l *h2Listener) hijack(w http.ResponseWriter, r *http.Request) (net.Conn, error) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, errors.New("hijack not supported")
+	}
+	c, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn = c
+	// the data sent by the client right after the request may be buffered.
+	if brw.Reader.Buffered() > 0 {
+		conn = xnet.NewBufferReaderConn(c, brw.Reader)
+	}
+	return newConnectConn(conn, r.Host), nil
+}
+
 func (l *h2Listener) upgrade(w http.ResponseWriter, r *http.Request) (*conn, error) {
 	if l.md.path == "" && r.Method != http.MethodConnect {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -205,9 +322,31 @@ func (l *h2Listener) upgrade(w http.ResponseWriter, r *http.Request) (*conn, err
 	}
 	return &conn{
 		r:          r.Body,
-		w:          flushWriter{w},
+		w:          http_util.NewFlushWriter(w, l.md.flush),
 		localAddr:  l.addr,
 		remoteAddr: remoteAddr,
 		closed:     make(chan struct{}),
 	}, nil
 }
+
+// serverErrorLog routes the error log of the http.Server to the logger of the listener,
+// and counts the failed TLS handshakes.
+type serverErrorLog struct {
+	logger logger.Logger
+	stats  *stats.ListenerStats
+}
+
+func (w *serverErrorLog) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	if strings.HasPrefix(msg, "http: TLS handshake error") {
+		reason := stats.HandshakeTLS
+		if strings.Contains(msg, "proxyproto:") {
+			reason = stats.HandshakeProxyProto
+		}
+		w.stats.HandshakeFailed(reason, nil)
+		w.logger.Debug(msg)
+	} else {
+		w.logger.Error(msg)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,328 @@
+package h2
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gost/core/listener"
+	mdata "github.com/go-gost/core/metadata"
+	"github.com/go-gost/x/internal/util/forward"
+	xlogger "github.com/go-gost/x/logger"
+	xmd "github.com/go-gost/x/metadata"
+	"golang.org/x/net/http2"
+)
+
+func newTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+}
+
+func newTestListener(t *testing.T, tlsConfig *tls.Config) listener.Listener {
+	t.Helper()
+
+	opts := []listener.Option{
+		listener.AddrOption("127.0.0.1:0"),
+		listener.LoggerOption(xlogger.Nop()),
+		listener.ServiceOption("test"),
+	}
+	var ln listener.Listener
+	if tlsConfig != nil {
+		ln = NewTLSListener(append(opts, listener.TLSConfigOption(tlsConfig))...)
+	} else {
+		ln = NewListener(opts...)
+	}
+	if err := ln.Init(xmd.NewMetadata(nil)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln
+}
+
+func accept(t *testing.T, ln listener.Listener) net.Conn {
+	t.Helper()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		c, err := ln.Accept()
+		ch <- result{c, err}
+	}()
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		t.Cleanup(func() { r.conn.Close() })
+		return r.conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("accept timeout")
+	}
+	return nil
+}
+
+func connMetadata(c net.Conn) mdata.Metadata {
+	if v, ok := c.(mdata.Metadatable); ok {
+		return v.Metadata()
+	}
+	return nil
+}
+
+// echo reads the message from the client on the accepted conn and writes the reply back.
+func echo(t *testing.T, conn net.Conn, msg, reply string) {
+	t.Helper()
+
+	b := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != msg {
+		t.Errorf("server got %q, want %q", b, msg)
+	}
+	if _, err := conn.Write([]byte(reply)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testConnect runs an HTTP/1.1 CONNECT over the client conn c,
+// the accepted conn is answered with replyErr.
+func testConnect(t *testing.T, ln listener.Listener, c net.Conn, replyErr error, wantStatus int) {
+	t.Helper()
+
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	// the data sent right after the request is buffered by the server.
+	if _, err := io.WriteString(c, "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\nping"); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := accept(t, ln)
+	md := connMetadata(conn)
+	if md == nil {
+		t.Fatal("no metadata on the accepted conn")
+	}
+	if target, _ := md.Get(forward.MetadataKeyTarget).(string); target != "example.com:443" {
+		t.Errorf("target: got %q, want %q", target, "example.com:443")
+	}
+	reply := forward.GetReplier(md)
+	if reply == nil {
+		t.Fatal("no replier on the accepted conn")
+	}
+
+	// nothing is answered before the handler replies.
+	c.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := c.Read(make([]byte, 1)); !isTimeout(err) {
+		t.Fatalf("read before reply: got %v, want timeout", err)
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	reply(replyErr)
+
+	br := bufio.NewReader(c)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != wantStatus {
+		t.Fatalf("status: got %d, want %d", resp.StatusCode, wantStatus)
+	}
+	if replyErr != nil {
+		return
+	}
+
+	echo(t, conn, "ping", "pong")
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(br, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "pong" {
+		t.Errorf("client got %q, want %q", b, "pong")
+	}
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// testH2 runs a CONNECT stream over the h2 connection of the transport.
+func testH2(t *testing.T, ln listener.Listener, tr *http2.Transport, scheme string) {
+	t.Helper()
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	req, err := http.NewRequest(http.MethodConnect, scheme+"://"+ln.Addr().String(), pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "example.com:443"
+
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		resp, err := tr.RoundTrip(req)
+		ch <- result{resp, err}
+	}()
+
+	conn := accept(t, ln)
+	if md := connMetadata(conn); md != nil && md.Get(forward.MetadataKeyTarget) != nil {
+		t.Error("h2 stream carries the target of the HTTP/1.1 CONNECT")
+	}
+
+	var r result
+	select {
+	case r = <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("round trip timeout")
+	}
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	defer r.resp.Body.Close()
+	if r.resp.StatusCode != http.StatusOK {
+		t.Fatalf("status: got %d, want %d", r.resp.StatusCode, http.StatusOK)
+	}
+
+	go io.WriteString(pw, "ping")
+	echo(t, conn, "ping", "pong")
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(r.resp.Body, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "pong" {
+		t.Errorf("client got %q, want %q", b, "pong")
+	}
+}
+
+func TestH2CListenerClients(t *testing.T) {
+	ln := newTestListener(t, nil)
+
+	t.Run("h2c", func(t *testing.T) {
+		tr := &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+		defer tr.CloseIdleConnections()
+		testH2(t, ln, tr, "http")
+	})
+
+	t.Run("connect", func(t *testing.T) {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		testConnect(t, ln, c, nil, http.StatusOK)
+	})
+
+	t.Run("connect failed", func(t *testing.T) {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		testConnect(t, ln, c, errors.New("connection refused"), http.StatusBadGateway)
+	})
+
+	t.Run("connect not allowed", func(t *testing.T) {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		testConnect(t, ln, c, forward.ErrTargetNotAllowed, http.StatusForbidden)
+	})
+}
+
+func TestH2ListenerClients(t *testing.T) {
+	ln := newTestListener(t, newTLSConfig(t))
+
+	t.Run("h2", func(t *testing.T) {
+		tr := &http2.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+		defer tr.CloseIdleConnections()
+		testH2(t, ln, tr, "https")
+	})
+
+	t.Run("connect", func(t *testing.T) {
+		c, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"http/1.1"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		testConnect(t, ln, c, nil, http.StatusOK)
+	})
+}
+
+func TestConnectConnReplyOnFirstIO(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	conn := newConnectConn(server, "example.com:443")
+	defer conn.Close()
+
+	// the handler not answering the request writes first, the 200 goes before its data.
+	go conn.Write([]byte("data"))
+
+	br := bufio.NewReader(client)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status: got %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	b, _ := br.Peek(4)
+	if !strings.HasPrefix(string(b), "data") {
+		t.Errorf("got %q, want %q", b, "data")
+	}
+
+	// the request is answered once.
+	if err := forward.GetReplier(conn.Metadata())(errors.New("late")); err != nil {
+		t.Errorf("late reply: %v", err)
+	}
+}
@@ -1,18 +1,60 @@
 package h2
 
 import (
+	"crypto/tls"
+	"fmt"
+
 	mdata "github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/core/metadata/util"
+	"github.com/go-gost/x/internal/net/acceptlimit"
+	http_util "github.com/go-gost/x/internal/util/http"
+	tls_util "github.com/go-gost/x/internal/util/tls"
 )
 
 const (
 	defaultBacklog = 128
+
+	// the bounds of the flow control settings of the HTTP/2 spec (RFC 9113 6.5.2).
+	minReadFrameSize  = 1 << 14
+	maxReadFrameSize  = 1<<24 - 1
+	minConnWindowSize = 65535
+	maxWindowSize     = 1<<31 - 1
 )
 
 type metadata struct {
 	path    string
 	backlog int
 	mptcp   bool
+	// the overrides of the TLS config of the h2 listener, zero means not overridden.
+	tlsMinVersion   uint16
+	tlsMaxVersion   uint16
+	tlsCipherSuites []uint16
+	// the OCSP stapling of the server certificates, nil if disabled.
+	ocsp *tls_util.OCSPStapler
+	// the revocation checking of the client certificates, nil if disabled.
+	revocation *tls_util.RevocationChecker
+	// the rate limit of the accepted connections.
+	acceptLimit acceptlimit.Options
+	// the network interface the listener binds to, any if empty.
+	device string
+	// the network namespace the listener binds in, the namespace of the process if empty.
+	netns string
+	// the limits of the request header, zero means the defaults of net/http (1MB of the header and 4KB of the header tables).
+	maxHeaderBytes            int
+	maxDecoderHeaderTableSize uint32
+	maxEncoderHeaderTableSize uint32
+	// the flow control of the h2 connections, zero means the defaults of http2.Server
+	// (16KB of the read frames, 1MB of the connection and the stream windows).
+	// The windows bound the bytes uploaded by the client not yet read by the handler:
+	// each tunneled conn is one stream, so the stream window caps the in-flight upload of a conn,
+	// and the connection window is shared by all the conns multiplexed on the h2 connection.
+	// The download is bound by the windows of the client, not by these.
+	maxReadFrameSize        uint32
+	initialConnWindowSize   int32
+	initialStreamWindowSize int32
+	// the coalescing of the flushes of the data written to the tunneled conns,
+	// the data is flushed on every write by default.
+	flush http_util.FlushOptions
 }
 
 func (l *h2Listener) parseMetadata(md mdata.Metadata) (err error) {
@@ -21,6 +63,12 @@ func (l *h2Listener) parseMetadata(md mdata.Metadata) (err error) {
 		backlog = "backlog"
 	)
 
+	l.md.acceptLimit = acceptlimit.Options{
+		Rate:    mdutil.GetFloat(md, "accept.rate"),
+		Burst:   mdutil.GetInt(md, "accept.burst"),
+		Service: l.options.Service,
+	}
+
 	l.md.backlog = mdutil.GetInt(md, backlog)
 	if l.md.backlog <= 0 {
 		l.md.backlog = defaultBacklog
@@ -28,6 +76,91 @@ func (l *h2Listener) parseMetadata(md mdata.Metadata) (err error) {
 
 	l.md.path = mdutil.GetString(md, path)
 	l.md.mptcp = mdutil.GetBool(md, "mptcp")
+	l.md.maxHeaderBytes = max(mdutil.GetInt(md, "maxHeaderBytes"), 0)
+	l.md.maxDecoderHeaderTableSize = uint32(max(mdutil.GetInt(md, "maxDecoderHeaderTableSize"), 0))
+	l.md.maxEncoderHeaderTableSize = uint32(max(mdutil.GetInt(md, "maxEncoderHeaderTableSize"), 0))
+	l.md.flush = http_util.FlushOptions{
+		Threshold: mdutil.GetInt(md, "flush.threshold"),
+		Delay:     mdutil.GetDuration(md, "flush.delay"),
+	}
+	l.md.device = mdutil.GetString(md, "device")
+	if l.md.netns = mdutil.GetString(md, "netns"); l.md.netns == "" {
+		l.md.netns = l.options.Netns
+	}
+
+	if v := mdutil.GetInt(md, "maxReadFrameSize"); v != 0 {
+		if v < minReadFrameSize || v > maxReadFrameSize {
+			return fmt.Errorf("maxReadFrameSize %d out of range [%d, %d]", v, minReadFrameSize, maxReadFrameSize)
+		}
+		l.md.maxReadFrameSize = uint32(v)
+	}
+	if v := mdutil.GetInt(md, "initialConnWindowSize"); v != 0 {
+		if v < minConnWindowSize || v > maxWindowSize {
+			return fmt.Errorf("initialConnWindowSize %d out of range [%d, %d]", v, minConnWindowSize, maxWindowSize)
+		}
+		l.md.initialConnWindowSize = int32(v)
+	}
+	if v := mdutil.GetInt(md, "initialStreamWindowSize"); v != 0 {
+		if v < 1 || v > maxWindowSize {
+			return fmt.Errorf("initialStreamWindowSize %d out of range [1, %d]", v, maxWindowSize)
+		}
+		l.md.initialStreamWindowSize = int32(v)
+	}
+
+	if mdutil.GetBool(md, "tls.ocsp") {
+		l.md.ocsp = tls_util.NewOCSPStapler(mdutil.GetDuration(md, "tls.ocsp.ttl"), l.logger)
+	}
+	ocspMode, err := tls_util.ParseOCSPMode(mdutil.GetString(md, "tls.clientOCSP"))
+	if err != nil {
+		return err
+	}
+	if l.md.revocation, err = tls_util.NewRevocationChecker(l.options.Service, mdutil.GetStrings(md, "tls.clientCRL"), ocspMode, l.logger); err != nil {
+		return err
+	}
+
+	if v := mdutil.GetString(md, "tls.minVersion"); v != "" {
+		if l.md.tlsMinVersion, err = tls_util.ParseVersion(v); err != nil {
+			return
+		}
+	}
+	if v := mdutil.GetString(md, "tls.maxVersion"); v != "" {
+		if l.md.tlsMaxVersion, err = tls_util.ParseVersion(v); err != nil {
+			return
+		}
+	}
+	if l.md.tlsMinVersion > 0 && l.md.tlsMaxVersion > 0 && l.md.tlsMinVersion > l.md.tlsMaxVersion {
+		return fmt.Errorf("tls.minVersion %s is greater than tls.maxVersion %s",
+			tls.VersionName(l.md.tlsMinVersion), tls.VersionName(l.md.tlsMaxVersion))
+	}
+	if l.md.tlsCipherSuites, err = tls_util.ParseCipherSuites(mdutil.GetStrings(md, "tls.cipherSuites")); err != nil {
+		return
+	}
 
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"accept.burst",
+	"accept.rate",
+	"backlog",
+	"device",
+	"flush.delay",
+	"flush.threshold",
+	"initialConnWindowSize",
+	"initialStreamWindowSize",
+	"maxDecoderHeaderTableSize",
+	"maxEncoderHeaderTableSize",
+	"maxHeaderBytes",
+	"maxReadFrameSize",
+	"mptcp",
+	"netns",
+	"path",
+	"tls.cipherSuites",
+	"tls.clientCRL",
+	"tls.clientOCSP",
+	"tls.maxVersion",
+	"tls.minVersion",
+	"tls.ocsp",
+	"tls.ocsp.ttl",
+}
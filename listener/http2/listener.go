@@ -26,6 +26,7 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("http2", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "http2", schema...)
 }
 
 type http2Listener struct {
@@ -54,10 +55,11 @@ func (l *http2Listener) Init(md md.Metadata) (err error) {
 		return
 	}
 
+	tlsConfig := l.md.revocation.Config(l.md.ocsp.Config(l.options.TLSConfig))
 	l.server = &http.Server{
 		Addr:      l.options.Addr,
 		Handler:   http.HandlerFunc(l.handleFunc),
-		TLSConfig: l.options.TLSConfig,
+		TLSConfig: tlsConfig,
 	}
 	if err := http2.ConfigureServer(l.server, nil); err != nil {
 		return err
@@ -90,7 +92,7 @@ func (l *http2Listener) Init(md md.Metadata) (err error) {
 
 	ln = tls.NewListener(
 		ln,
-		l.options.TLSConfig,
+		tlsConfig,
 	)
 
 	l.cqueue = make(chan net.Conn, l.md.backlog)
@@ -160,4 +162,9 @@ func (l *http2Listener) handleFunc(w http.ResponseWriter, r *http.Request) {
 	}
 
 	<-conn.Done()
+
+	// the handler drops the request without any response.
+	if v, _ := conn.md.Get("abort").(bool); v {
+		panic(http.ErrAbortHandler)
+	}
 }
@@ -3,6 +3,7 @@ package http2
 import (
 	mdata "github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/core/metadata/util"
+	tls_util "github.com/go-gost/x/internal/util/tls"
 )
 
 const (
@@ -12,6 +13,10 @@ const (
 type metadata struct {
 	backlog int
 	mptcp   bool
+	// the OCSP stapling of the server certificates, nil if disabled.
+	ocsp *tls_util.OCSPStapler
+	// the revocation checking of the client certificates, nil if disabled.
+	revocation *tls_util.RevocationChecker
 }
 
 func (l *http2Listener) parseMetadata(md mdata.Metadata) (err error) {
@@ -24,6 +29,26 @@ func (l *http2Listener) parseMetadata(md mdata.Metadata) (err error) {
 		l.md.backlog = defaultBacklog
 	}
 	l.md.mptcp = mdutil.GetBool(md, "mptcp")
+	if mdutil.GetBool(md, "tls.ocsp") {
+		l.md.ocsp = tls_util.NewOCSPStapler(mdutil.GetDuration(md, "tls.ocsp.ttl"), l.logger)
+	}
+	ocspMode, err := tls_util.ParseOCSPMode(mdutil.GetString(md, "tls.clientOCSP"))
+	if err != nil {
+		return err
+	}
+	if l.md.revocation, err = tls_util.NewRevocationChecker(l.options.Service, mdutil.GetStrings(md, "tls.clientCRL"), ocspMode, l.logger); err != nil {
+		return err
+	}
 
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"backlog",
+	"mptcp",
+	"tls.clientCRL",
+	"tls.clientOCSP",
+	"tls.ocsp",
+	"tls.ocsp.ttl",
+}
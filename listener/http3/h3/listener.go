@@ -13,6 +13,7 @@ import (
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	pht_util "github.com/go-gost/x/internal/util/pht"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -21,6 +22,7 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("h3", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "h3", schema...)
 }
 
 type http3Listener struct {
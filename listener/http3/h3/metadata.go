@@ -69,3 +69,19 @@ func (l *http3Listener) parseMetadata(md mdata.Metadata) (err error) {
 
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"authorizePath",
+	"backlog",
+	"handshakeTimeout",
+	"keepalive",
+	"maxIdleTimeout",
+	"maxStreams",
+	"pht.authorizePath",
+	"pht.pullPath",
+	"pht.pushPath",
+	"pullPath",
+	"pushPath",
+	"ttl",
+}
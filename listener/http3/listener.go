@@ -17,6 +17,7 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("http3", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "http3", schema...)
 }
 
 type http3Listener struct {
@@ -49,3 +49,13 @@ func (l *http3Listener) parseMetadata(md mdata.Metadata) (err error) {
 
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"backlog",
+	"handshakeTimeout",
+	"keepAlive",
+	"maxIdleTimeout",
+	"maxStreams",
+	"ttl",
+}
@@ -56,3 +56,15 @@ func (l *wtListener) parseMetadata(md mdata.Metadata) (err error) {
 
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"backlog",
+	"handshakeTimeout",
+	"keepalive",
+	"maxIdleTimeout",
+	"maxStreams",
+	"path",
+	"ttl",
+	"wt.path",
+}
@@ -13,6 +13,7 @@ import (
 	icmp_pkg "github.com/go-gost/x/internal/util/icmp"
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -22,7 +23,9 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("icmp", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "icmp", schema...)
 	registry.ListenerRegistry().Register("icmp6", NewListener6)
+	mdx.RegisterSchema(mdx.SchemaListener, "icmp6", schema...)
 }
 
 type icmpListener struct {
@@ -36,3 +36,12 @@ func (l *icmpListener) parseMetadata(md mdata.Metadata) (err error) {
 
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"backlog",
+	"handshakeTimeout",
+	"keepalive",
+	"maxIdleTimeout",
+	"ttl",
+}
@@ -13,6 +13,7 @@ import (
 	kcp_util "github.com/go-gost/x/internal/util/kcp"
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -23,6 +24,7 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("kcp", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "kcp", schema...)
 }
 
 type kcpListener struct {
@@ -66,3 +66,27 @@ func (l *kcpListener) parseMetadata(md mdata.Metadata) (err error) {
 
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"backlog",
+	"c",
+	"config",
+	"configFile",
+	"kcp.config",
+	"kcp.configFile",
+	"kcp.crypt",
+	"kcp.interval",
+	"kcp.keepalive",
+	"kcp.key",
+	"kcp.mode",
+	"kcp.mtu",
+	"kcp.nocomp",
+	"kcp.rcvwnd",
+	"kcp.smuxbuf",
+	"kcp.smuxver",
+	"kcp.sndwnd",
+	"kcp.streambuf",
+	"kcp.tcp",
+	"tcp",
+}
@@ -2,6 +2,8 @@ package mtcp
 
 import (
 	"context"
+	"errors"
+	"io"
 	"net"
 	"time"
 
@@ -11,11 +13,14 @@ import (
 	md "github.com/go-gost/core/metadata"
 	admission "github.com/go-gost/x/admission/wrapper"
 	xnet "github.com/go-gost/x/internal/net"
+	"github.com/go-gost/x/internal/net/acceptlimit"
+	"github.com/go-gost/x/internal/net/fingerprint"
 	"github.com/go-gost/x/internal/net/proxyproto"
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	"github.com/go-gost/x/internal/util/mux"
 	climiter "github.com/go-gost/x/limiter/conn/wrapper"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -23,6 +28,7 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("mtcp", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "mtcp", schema...)
 }
 
 type mtcpListener struct {
@@ -32,6 +38,7 @@ type mtcpListener struct {
 	logger  logger.Logger
 	md      metadata
 	options listener.Options
+	stats   *stats.ListenerStats
 }
 
 func NewListener(opts ...listener.Option) listener.Listener {
@@ -55,7 +62,12 @@ func (l *mtcpListener) Init(md md.Metadata) (err error) {
 		network = "tcp4"
 	}
 
-	lc := net.ListenConfig{}
+	lc := xnet.ListenConfig{
+		Netns: l.md.netns,
+		ListenConfig: net.ListenConfig{
+			Control: xnet.BindDeviceControl(l.md.device),
+		},
+	}
 	if l.md.mptcp {
 		lc.SetMultipathTCP(true)
 		l.logger.Debugf("mptcp enabled: %v", lc.MultipathTCP())
@@ -65,9 +77,15 @@ func (l *mtcpListener) Init(md md.Metadata) (err error) {
 		return
 	}
 
+	ln = acceptlimit.WrapListener(ln, l.md.acceptLimit)
+
 	l.logger.Debugf("pp: %d", l.options.ProxyProtocol)
 
 	ln = proxyproto.WrapListener(l.options.ProxyProtocol, ln, 10*time.Second)
+	// the fingerprints are captured after the PROXY protocol header.
+	opts := l.md.fingerprint
+	opts.Logger = l.logger
+	ln = fingerprint.WrapListener(ln, opts)
 	ln = metrics.WrapListener(l.options.Service, ln)
 	ln = stats.WrapListener(ln, l.options.Stats)
 	ln = admission.WrapListener(l.options.Admission, ln)
@@ -79,6 +97,7 @@ func (l *mtcpListener) Init(md md.Metadata) (err error) {
 	ln = climiter.WrapListener(l.options.ConnLimiter, ln)
 	l.ln = ln
 
+	l.stats = stats.NewListenerStats(l.options.Service)
 	l.cqueue = make(chan net.Conn, l.md.backlog)
 	l.errChan = make(chan error, 1)
 
@@ -99,6 +118,7 @@ func (l *mtcpListener) Accept() (conn net.Conn, err error) {
 	var ok bool
 	select {
 	case conn = <-l.cqueue:
+		l.stats.Queued(-1)
 		conn = limiter_wrapper.WrapConn(
 			conn,
 			limiter_util.NewCachedTrafficLimiter(l.options.TrafficLimiter, 30*time.Second, 60*time.Second),
@@ -124,6 +144,7 @@ func (l *mtcpListener) listenLoop() {
 			close(l.errChan)
 			return
 		}
+		l.stats.Accepted()
 		go l.mux(conn)
 	}
 }
@@ -133,21 +154,33 @@ func (l *mtcpListener) mux(conn net.Conn) {
 
 	session, err := mux.ServerSession(conn, l.md.muxCfg)
 	if err != nil {
+		l.stats.HandshakeFailed(stats.HandshakeMux, err)
 		l.logger.Error(err)
 		return
 	}
 	defer session.Close()
 
-	for {
+	l.stats.Served(1)
+	defer l.stats.Served(-1)
+
+	for accepted := false; ; accepted = true {
 		stream, err := session.Accept()
 		if err != nil {
+			// the session is not read until the first stream, so the malformed frames fail the first accept,
+			// while the client closing the connection without any stream is not a failure.
+			if !accepted && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrClosedPipe) {
+				l.stats.HandshakeFailed(stats.HandshakeMux, err)
+			}
 			l.logger.Error("accept stream: ", err)
 			return
 		}
 
+		l.stats.Queued(1)
 		select {
 		case l.cqueue <- stream:
 		default:
+			l.stats.Queued(-1)
+			l.stats.Dropped()
 			stream.Close()
 			l.logger.Warnf("connection queue is full, client %s discarded", stream.RemoteAddr())
 		}
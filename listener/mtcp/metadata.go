@@ -3,6 +3,8 @@ package mtcp
 import (
 	md "github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/core/metadata/util"
+	"github.com/go-gost/x/internal/net/acceptlimit"
+	"github.com/go-gost/x/internal/net/fingerprint"
 	"github.com/go-gost/x/internal/util/mux"
 )
 
@@ -11,13 +13,38 @@ const (
 )
 
 type metadata struct {
-	mptcp   bool
-	muxCfg  *mux.Config
-	backlog int
+	mptcp       bool
+	muxCfg      *mux.Config
+	backlog     int
+	fingerprint fingerprint.Options
+	// the rate limit of the accepted connections.
+	acceptLimit acceptlimit.Options
+	// the network interface the listener binds to, any if empty.
+	device string
+	// the network namespace the listener binds in, the namespace of the process if empty.
+	netns string
 }
 
 func (l *mtcpListener) parseMetadata(md md.Metadata) (err error) {
+	l.md.acceptLimit = acceptlimit.Options{
+		Rate:    mdutil.GetFloat(md, "accept.rate"),
+		Burst:   mdutil.GetInt(md, "accept.burst"),
+		Service: l.options.Service,
+	}
+
 	l.md.mptcp = mdutil.GetBool(md, "mptcp")
+	l.md.device = mdutil.GetString(md, "device")
+	if l.md.netns = mdutil.GetString(md, "netns"); l.md.netns == "" {
+		l.md.netns = l.options.Netns
+	}
+
+	l.md.fingerprint = fingerprint.Options{
+		TCP: mdutil.GetBool(md, "fingerprint.tcp"),
+		TCPRules: fingerprint.NewRules(
+			mdutil.GetStrings(md, "fingerprint.tcp.allow"),
+			mdutil.GetStrings(md, "fingerprint.tcp.deny"),
+		),
+	}
 
 	l.md.muxCfg = &mux.Config{
 		Version:           mdutil.GetInt(md, "mux.version"),
@@ -27,6 +54,7 @@ func (l *mtcpListener) parseMetadata(md md.Metadata) (err error) {
 		MaxFrameSize:      mdutil.GetInt(md, "mux.maxFrameSize"),
 		MaxReceiveBuffer:  mdutil.GetInt(md, "mux.maxReceiveBuffer"),
 		MaxStreamBuffer:   mdutil.GetInt(md, "mux.maxStreamBuffer"),
+		Compression:       mdutil.GetBool(md, "mux.compression"),
 	}
 	if l.md.muxCfg.Version == 0 {
 		l.md.muxCfg.Version = 2
@@ -38,3 +66,24 @@ func (l *mtcpListener) parseMetadata(md md.Metadata) (err error) {
 	}
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"accept.burst",
+	"accept.rate",
+	"backlog",
+	"device",
+	"fingerprint.tcp",
+	"fingerprint.tcp.allow",
+	"fingerprint.tcp.deny",
+	"mptcp",
+	"mux.compression",
+	"mux.keepaliveDisabled",
+	"mux.keepaliveInterval",
+	"mux.keepaliveTimeout",
+	"mux.maxFrameSize",
+	"mux.maxReceiveBuffer",
+	"mux.maxStreamBuffer",
+	"mux.version",
+	"netns",
+}
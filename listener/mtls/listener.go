@@ -15,8 +15,10 @@ import (
 	"github.com/go-gost/x/internal/net/proxyproto"
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	"github.com/go-gost/x/internal/util/mux"
+	tls_util "github.com/go-gost/x/internal/util/tls"
 	climiter "github.com/go-gost/x/limiter/conn/wrapper"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -24,6 +26,7 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("mtls", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "mtls", schema...)
 }
 
 type mtlsListener struct {
@@ -76,7 +79,7 @@ func (l *mtlsListener) Init(md md.Metadata) (err error) {
 		limiter_util.NewCachedTrafficLimiter(l.options.TrafficLimiter, 30*time.Second, 60*time.Second),
 	)
 	ln = climiter.WrapListener(l.options.ConnLimiter, ln)
-	l.Listener = tls.NewListener(ln, l.options.TLSConfig)
+	l.Listener = tls.NewListener(ln, l.md.revocation.Config(l.md.ocsp.Config(l.options.TLSConfig)))
 
 	l.cqueue = make(chan net.Conn, l.md.backlog)
 	l.errChan = make(chan error, 1)
@@ -129,6 +132,16 @@ func (l *mtlsListener) mux(conn net.Conn) {
 	}
 	defer session.Close()
 
+	var clientID string
+	if tc, ok := conn.(*tls.Conn); ok && l.md.clientID != tls_util.ClientIDNone {
+		if err := tc.Handshake(); err != nil {
+			l.logger.Error(err)
+			return
+		}
+		cs := tc.ConnectionState()
+		clientID = l.md.clientID.ClientID(&cs)
+	}
+
 	for {
 		stream, err := session.Accept()
 		if err != nil {
@@ -136,6 +149,8 @@ func (l *mtlsListener) mux(conn net.Conn) {
 			return
 		}
 
+		stream = tls_util.WithClientID(stream, clientID)
+
 		select {
 		case l.cqueue <- stream:
 		default:
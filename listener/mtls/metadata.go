@@ -4,6 +4,7 @@ import (
 	mdata "github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/core/metadata/util"
 	"github.com/go-gost/x/internal/util/mux"
+	tls_util "github.com/go-gost/x/internal/util/tls"
 )
 
 const (
@@ -14,6 +15,12 @@ type metadata struct {
 	muxCfg  *mux.Config
 	backlog int
 	mptcp   bool
+	// the OCSP stapling of the server certificates, nil if disabled.
+	ocsp *tls_util.OCSPStapler
+	// the revocation checking of the client certificates, nil if disabled.
+	revocation *tls_util.RevocationChecker
+	// the field of the verified client certificate attached to the connections as the client ID.
+	clientID tls_util.ClientIDMode
 }
 
 func (l *mtlsListener) parseMetadata(md mdata.Metadata) (err error) {
@@ -32,6 +39,37 @@ func (l *mtlsListener) parseMetadata(md mdata.Metadata) (err error) {
 		MaxStreamBuffer:   mdutil.GetInt(md, "mux.maxStreamBuffer"),
 	}
 	l.md.mptcp = mdutil.GetBool(md, "mptcp")
+	if mdutil.GetBool(md, "tls.ocsp") {
+		l.md.ocsp = tls_util.NewOCSPStapler(mdutil.GetDuration(md, "tls.ocsp.ttl"), l.logger)
+	}
+	ocspMode, err := tls_util.ParseOCSPMode(mdutil.GetString(md, "tls.clientOCSP"))
+	if err != nil {
+		return err
+	}
+	if l.md.revocation, err = tls_util.NewRevocationChecker(l.options.Service, mdutil.GetStrings(md, "tls.clientCRL"), ocspMode, l.logger); err != nil {
+		return err
+	}
+	if l.md.clientID, err = tls_util.ParseClientIDMode(mdutil.GetString(md, "tls.clientID")); err != nil {
+		return err
+	}
 
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"backlog",
+	"mptcp",
+	"mux.keepaliveDisabled",
+	"mux.keepaliveInterval",
+	"mux.keepaliveTimeout",
+	"mux.maxFrameSize",
+	"mux.maxReceiveBuffer",
+	"mux.maxStreamBuffer",
+	"mux.version",
+	"tls.clientCRL",
+	"tls.clientID",
+	"tls.clientOCSP",
+	"tls.ocsp",
+	"tls.ocsp.ttl",
+}
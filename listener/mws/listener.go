@@ -20,6 +20,7 @@ import (
 	ws_util "github.com/go-gost/x/internal/util/ws"
 	climiter "github.com/go-gost/x/limiter/conn/wrapper"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -28,7 +29,9 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("mws", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "mws", schema...)
 	registry.ListenerRegistry().Register("mwss", NewTLSListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "mwss", schema...)
 }
 
 type mwsListener struct {
@@ -120,7 +123,7 @@ func (l *mwsListener) Init(md md.Metadata) (err error) {
 	ln = climiter.WrapListener(l.options.ConnLimiter, ln)
 
 	if l.tlsEnabled {
-		ln = tls.NewListener(ln, l.options.TLSConfig)
+		ln = tls.NewListener(ln, l.md.revocation.Config(l.options.TLSConfig))
 	}
 
 	l.addr = ln.Addr()
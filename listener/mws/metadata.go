@@ -7,6 +7,7 @@ import (
 	mdata "github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/core/metadata/util"
 	"github.com/go-gost/x/internal/util/mux"
+	tls_util "github.com/go-gost/x/internal/util/tls"
 )
 
 const (
@@ -28,6 +29,9 @@ type metadata struct {
 	muxCfg *mux.Config
 
 	mptcp bool
+
+	// the revocation checking of the client certificates of wss, nil if disabled.
+	revocation *tls_util.RevocationChecker
 }
 
 func (l *mwsListener) parseMetadata(md mdata.Metadata) (err error) {
@@ -67,5 +71,45 @@ func (l *mwsListener) parseMetadata(md mdata.Metadata) (err error) {
 
 	l.md.mptcp = mdutil.GetBool(md, "mptcp")
 
+	if l.tlsEnabled {
+		ocspMode, err := tls_util.ParseOCSPMode(mdutil.GetString(md, "tls.clientOCSP"))
+		if err != nil {
+			return err
+		}
+		if l.md.revocation, err = tls_util.NewRevocationChecker(l.options.Service, mdutil.GetStrings(md, "tls.clientCRL"), ocspMode, l.logger); err != nil {
+			return err
+		}
+	}
+
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"backlog",
+	"enableCompression",
+	"handshakeTimeout",
+	"header",
+	"mptcp",
+	"mux.keepaliveDisabled",
+	"mux.keepaliveInterval",
+	"mux.keepaliveTimeout",
+	"mux.maxFrameSize",
+	"mux.maxReceiveBuffer",
+	"mux.maxStreamBuffer",
+	"mux.version",
+	"path",
+	"readBufferSize",
+	"readHeaderTimeout",
+	"tls.clientCRL",
+	"tls.clientOCSP",
+	"writeBufferSize",
+	"ws.backlog",
+	"ws.enableCompression",
+	"ws.handshakeTimeout",
+	"ws.header",
+	"ws.path",
+	"ws.readBufferSize",
+	"ws.readHeaderTimeout",
+	"ws.writeBufferSize",
+}
@@ -28,3 +28,9 @@ func (l *obfsListener) parseMetadata(md mdata.Metadata) (err error) {
 	l.md.mptcp = mdutil.GetBool(md, "mptcp")
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"header",
+	"mptcp",
+}
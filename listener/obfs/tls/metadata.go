@@ -13,3 +13,8 @@ func (l *obfsListener) parseMetadata(md md.Metadata) (err error) {
 	l.md.mptcp = mdutil.GetBool(md, "mptcp")
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"mptcp",
+}
@@ -15,6 +15,7 @@ import (
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	pht_util "github.com/go-gost/x/internal/util/pht"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -22,7 +23,9 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("pht", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "pht", schema...)
 	registry.ListenerRegistry().Register("phts", NewTLSListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "phts", schema...)
 }
 
 type phtListener struct {
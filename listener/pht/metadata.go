@@ -52,3 +52,12 @@ func (l *phtListener) parseMetadata(md mdata.Metadata) (err error) {
 	l.md.mptcp = mdutil.GetBool(md, "mptcp")
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"authorizePath",
+	"backlog",
+	"mptcp",
+	"pullPath",
+	"pushPath",
+}
@@ -3,6 +3,7 @@ package quic
 import (
 	"net"
 
+	mdata "github.com/go-gost/core/metadata"
 	"github.com/quic-go/quic-go"
 )
 
@@ -10,6 +11,7 @@ type quicConn struct {
 	quic.Stream
 	laddr net.Addr
 	raddr net.Addr
+	md    mdata.Metadata
 }
 
 func (c *quicConn) LocalAddr() net.Addr {
@@ -19,3 +21,8 @@ func (c *quicConn) LocalAddr() net.Addr {
 func (c *quicConn) RemoteAddr() net.Addr {
 	return c.raddr
 }
+
+// Metadata implements metadata.Metadatable interface.
+func (c *quicConn) Metadata() mdata.Metadata {
+	return c.md
+}
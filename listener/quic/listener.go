@@ -15,6 +15,7 @@ import (
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	quic_util "github.com/go-gost/x/internal/util/quic"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -23,6 +24,7 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("quic", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "quic", schema...)
 }
 
 type quicListener struct {
@@ -94,6 +96,7 @@ func (l *quicListener) Init(md md.Metadata) (err error) {
 			quic.Version2,
 		},
 		MaxIncomingStreams: int64(l.md.maxStreams),
+		EnableDatagrams:    l.md.datagram,
 	}
 
 	tlsCfg := l.options.TLSConfig
@@ -159,6 +162,11 @@ func (l *quicListener) listenLoop() {
 func (l *quicListener) mux(ctx context.Context, session quic.Connection) {
 	defer session.CloseWithError(0, "closed")
 
+	// the datagrams of the session are shared by all the streams.
+	smd := mdx.NewMetadata(map[string]any{
+		quic_util.MetadataKeyDatagramSession: quic_util.NewDatagramSession(session),
+	})
+
 	for {
 		stream, err := session.AcceptStream(ctx)
 		if err != nil {
@@ -170,6 +178,7 @@ func (l *quicListener) mux(ctx context.Context, session quic.Connection) {
 			Stream: stream,
 			laddr:  session.LocalAddr(),
 			raddr:  session.RemoteAddr(),
+			md:     smd,
 		}
 		select {
 		case l.cqueue <- conn:
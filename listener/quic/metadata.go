@@ -17,6 +17,8 @@ type metadata struct {
 	handshakeTimeout time.Duration
 	maxIdleTimeout   time.Duration
 	maxStreams       int
+	// datagram enables the QUIC datagrams for relaying the UDP datagrams of the tunnel.
+	datagram bool
 
 	cipherKey []byte
 	backlog   int
@@ -29,6 +31,7 @@ func (l *quicListener) parseMetadata(md mdata.Metadata) (err error) {
 		handshakeTimeout = "handshakeTimeout"
 		maxIdleTimeout   = "maxIdleTimeout"
 		maxStreams       = "maxStreams"
+		datagram         = "tunnel.udp.datagram"
 
 		backlog   = "backlog"
 		cipherKey = "cipherKey"
@@ -52,6 +55,19 @@ func (l *quicListener) parseMetadata(md mdata.Metadata) (err error) {
 	l.md.handshakeTimeout = mdutil.GetDuration(md, handshakeTimeout)
 	l.md.maxIdleTimeout = mdutil.GetDuration(md, maxIdleTimeout)
 	l.md.maxStreams = mdutil.GetInt(md, maxStreams)
+	l.md.datagram = mdutil.GetBool(md, datagram)
 
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"backlog",
+	"cipherKey",
+	"handshakeTimeout",
+	"keepAlive",
+	"maxIdleTimeout",
+	"maxStreams",
+	"ttl",
+	"tunnel.udp.datagram",
+}
@@ -15,6 +15,7 @@ import (
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	climiter "github.com/go-gost/x/limiter/conn/wrapper"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -22,8 +23,11 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("red", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "red", schema...)
 	registry.ListenerRegistry().Register("redir", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "redir", schema...)
 	registry.ListenerRegistry().Register("redirect", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "redirect", schema...)
 }
 
 type redirectListener struct {
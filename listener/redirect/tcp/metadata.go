@@ -15,3 +15,9 @@ func (l *redirectListener) parseMetadata(md mdata.Metadata) (err error) {
 	l.md.mptcp = mdutil.GetBool(md, "mptcp")
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"mptcp",
+	"tproxy",
+}
@@ -11,6 +11,7 @@ import (
 	admission "github.com/go-gost/x/admission/wrapper"
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -18,6 +19,7 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("redu", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "redu", schema...)
 }
 
 type redirectListener struct {
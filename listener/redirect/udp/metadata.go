@@ -35,3 +35,9 @@ func (l *redirectListener) parseMetadata(md mdata.Metadata) (err error) {
 
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"readBufferSize",
+	"ttl",
+}
@@ -50,3 +50,11 @@ func (l *rudpListener) parseMetadata(md mdata.Metadata) (err error) {
 
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"backlog",
+	"readBufferSize",
+	"readQueueSize",
+	"ttl",
+}
@@ -12,6 +12,7 @@ import (
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	serial "github.com/go-gost/x/internal/util/serial"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -19,6 +20,7 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("serial", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "serial", schema...)
 }
 
 type serialListener struct {
@@ -15,3 +15,10 @@ func (l *serialListener) parseMetadata(md md.Metadata) (err error) {
 	l.md.timeout = mdutil.GetDuration(md, "timeout", "serial.timeout", "listener.serial.timeout")
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"listener.serial.timeout",
+	"serial.timeout",
+	"timeout",
+}
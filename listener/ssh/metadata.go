@@ -73,3 +73,12 @@ func (l *sshListener) parseMetadata(md mdata.Metadata) (err error) {
 	l.md.mptcp = mdutil.GetBool(md, "mptcp")
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"authorizedKeys",
+	"backlog",
+	"mptcp",
+	"passphrase",
+	"privateKeyFile",
+}
@@ -13,12 +13,14 @@ import (
 	md "github.com/go-gost/core/metadata"
 	admission "github.com/go-gost/x/admission/wrapper"
 	xnet "github.com/go-gost/x/internal/net"
+	"github.com/go-gost/x/internal/net/acceptlimit"
 	"github.com/go-gost/x/internal/net/proxyproto"
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	ssh_util "github.com/go-gost/x/internal/util/ssh"
 	sshd_util "github.com/go-gost/x/internal/util/sshd"
 	climiter "github.com/go-gost/x/limiter/conn/wrapper"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -31,8 +33,14 @@ const (
 	RemoteForwardRequest = "tcpip-forward" // RFC 4254 7.1
 )
 
+const (
+	// KeepaliveRequest is the global request sent by the server to check the client liveness.
+	KeepaliveRequest = "keepalive@openssh.com"
+)
+
 func init() {
 	registry.ListenerRegistry().Register("sshd", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "sshd", schema...)
 }
 
 type sshdListener struct {
@@ -43,6 +51,7 @@ type sshdListener struct {
 	logger  logger.Logger
 	md      metadata
 	options listener.Options
+	stats   *stats.ListenerStats
 }
 
 func NewListener(opts ...listener.Option) listener.Listener {
@@ -66,7 +75,12 @@ func (l *sshdListener) Init(md md.Metadata) (err error) {
 		network = "tcp4"
 	}
 
-	lc := net.ListenConfig{}
+	lc := xnet.ListenConfig{
+		Netns: l.md.netns,
+		ListenConfig: net.ListenConfig{
+			Control: xnet.BindDeviceControl(l.md.device),
+		},
+	}
 	if l.md.mptcp {
 		lc.SetMultipathTCP(true)
 		l.logger.Debugf("mptcp enabled: %v", lc.MultipathTCP())
@@ -76,6 +90,8 @@ func (l *sshdListener) Init(md md.Metadata) (err error) {
 		return err
 	}
 
+	ln = acceptlimit.WrapListener(ln, l.md.acceptLimit)
+
 	ln = proxyproto.WrapListener(l.options.ProxyProtocol, ln, 10*time.Second)
 	ln = metrics.WrapListener(l.options.Service, ln)
 	ln = stats.WrapListener(ln, l.options.Stats)
@@ -98,6 +114,7 @@ func (l *sshdListener) Init(md md.Metadata) (err error) {
 	}
 
 	l.config = config
+	l.stats = stats.NewListenerStats(l.options.Service)
 	l.cqueue = make(chan net.Conn, l.md.backlog)
 	l.errChan = make(chan error, 1)
 
@@ -110,6 +127,7 @@ func (l *sshdListener) Accept() (conn net.Conn, err error) {
 	var ok bool
 	select {
 	case conn = <-l.cqueue:
+		l.stats.Queued(-1)
 		conn = limiter_wrapper.WrapConn(
 			conn,
 			limiter_util.NewCachedTrafficLimiter(l.options.TrafficLimiter, 30*time.Second, 60*time.Second),
@@ -136,6 +154,7 @@ func (l *sshdListener) listenLoop() {
 			close(l.errChan)
 			return
 		}
+		l.stats.Accepted()
 		go l.serveConn(conn)
 	}
 }
@@ -151,23 +170,22 @@ func (l *sshdListener) serveConn(conn net.Conn) {
 
 	sc, chans, reqs, err := ssh.NewServerConn(conn, l.config)
 	if err != nil {
+		l.stats.HandshakeFailed(stats.HandshakeSSH, err)
 		l.logger.Error(err)
 		conn.Close()
 		return
 	}
 	defer sc.Close()
 
+	l.stats.Served(1)
+	defer l.stats.Served(-1)
+
 	go func() {
 		for newChannel := range chans {
 			// Check the type of channel
 			t := newChannel.ChannelType()
 			switch t {
 			case DirectForwardRequest:
-				channel, requests, err := newChannel.Accept()
-				if err != nil {
-					l.logger.Warnf("could not accept channel: %s", err.Error())
-					continue
-				}
 				p := directForward{}
 				ssh.Unmarshal(newChannel.ExtraData(), &p)
 
@@ -177,12 +195,33 @@ func (l *sshdListener) serveConn(conn net.Conn) {
 					p.Host1 = ""
 				}
 
+				addr := net.JoinHostPort(p.Host1, strconv.Itoa(int(p.Port1)))
+				target, err := l.md.rewriter.Rewrite(p.Host1, int(p.Port1))
+				if err != nil {
+					l.logger.Warnf("direct forward %s from %s: %v", addr, conn.RemoteAddr(), err)
+					newChannel.Reject(ssh.Prohibited, fmt.Sprintf("%s: %v", addr, err))
+					continue
+				}
+				if target != addr {
+					l.logger.Debugf("direct forward: rewrite %s to %s", addr, target)
+				}
+
+				channel, requests, err := newChannel.Accept()
+				if err != nil {
+					l.logger.Warnf("could not accept channel: %s", err.Error())
+					continue
+				}
+
 				go ssh.DiscardRequests(requests)
-				cc := sshd_util.NewDirectForwardConn(sc, channel, net.JoinHostPort(p.Host1, strconv.Itoa(int(p.Port1))))
+				cc := sshd_util.NewDirectForwardConn(sc, channel, target, l.md.idleTimeout)
 
+				// counted ahead of the send, as the conn can be accepted before the send returns.
+				l.stats.Queued(1)
 				select {
 				case l.cqueue <- cc:
 				default:
+					l.stats.Queued(-1)
+					l.stats.Dropped()
 					l.logger.Warnf("connection queue is full, client %s discarded", conn.RemoteAddr())
 					newChannel.Reject(ssh.ResourceShortage, "connection queue is full")
 					cc.Close()
@@ -198,15 +237,22 @@ func (l *sshdListener) serveConn(conn net.Conn) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	if l.md.keepalive {
+		go l.keepalive(ctx, sc)
+	}
+
 	go func() {
 		for req := range reqs {
 			switch req.Type {
 			case RemoteForwardRequest:
-				cc := sshd_util.NewRemoteForwardConn(ctx, sc, req)
+				cc := sshd_util.NewRemoteForwardConn(ctx, sc, req, l.md.idleTimeout)
 
+				l.stats.Queued(1)
 				select {
 				case l.cqueue <- cc:
 				default:
+					l.stats.Queued(-1)
+					l.stats.Dropped()
 					l.logger.Warnf("connection queue is full, client %s discarded", conn.RemoteAddr())
 					req.Reply(false, []byte("connection queue is full"))
 					cc.Close()
@@ -222,6 +268,48 @@ func (l *sshdListener) serveConn(conn net.Conn) {
 	sc.Wait()
 }
 
+// keepalive sends the keepalive requests to the client periodically,
+// so that the half-open connections (e.g. the clients behind NAT) are detected.
+// The connection is closed if keepaliveMaxMissed requests in a row are not answered.
+func (l *sshdListener) keepalive(ctx context.Context, sc *ssh.ServerConn) {
+	ticker := time.NewTicker(l.md.keepaliveInterval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		// any reply, including the failure for the unknown request, means the client is alive.
+		errc := make(chan error, 1)
+		go func() {
+			_, _, err := sc.SendRequest(KeepaliveRequest, true, nil)
+			errc <- err
+		}()
+
+		select {
+		case err := <-errc:
+			if err != nil {
+				return
+			}
+			missed = 0
+		case <-time.After(l.md.keepaliveInterval):
+			missed++
+			l.logger.Debugf("keepalive: %s missed %d/%d", sc.RemoteAddr(), missed, l.md.keepaliveMaxMissed)
+			if missed >= l.md.keepaliveMaxMissed {
+				l.logger.Warnf("keepalive: %s is not responding, close the connection", sc.RemoteAddr())
+				sc.Close()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 // directForward is structure for RFC 4254 7.2 - can be used for "forwarded-tcpip" and "direct-tcpip"
 type directForward struct {
 	Host1 string
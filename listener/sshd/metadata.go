@@ -3,17 +3,22 @@ package ssh
 import (
 	"fmt"
 	"os"
+	"time"
 
 	mdata "github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/core/metadata/util"
+	"github.com/go-gost/x/internal/net/acceptlimit"
 	ssh_util "github.com/go-gost/x/internal/util/ssh"
+	sshd_util "github.com/go-gost/x/internal/util/sshd"
 	"github.com/mitchellh/go-homedir"
 	"github.com/zalando/go-keyring"
 	"golang.org/x/crypto/ssh"
 )
 
 const (
-	defaultBacklog = 128
+	defaultBacklog            = 128
+	defaultKeepaliveInterval  = 30 * time.Second
+	defaultKeepaliveMaxMissed = 3
 )
 
 type metadata struct {
@@ -21,6 +26,21 @@ type metadata struct {
 	authorizedKeys map[string]bool
 	backlog        int
 	mptcp          bool
+	// idle timeout of the forwarded connections.
+	idleTimeout time.Duration
+	// the server sends the keepalive requests every keepaliveInterval,
+	// the connection is closed if keepaliveMaxMissed requests in a row are not answered.
+	keepalive          bool
+	keepaliveInterval  time.Duration
+	keepaliveMaxMissed int
+	// the rate limit of the accepted connections.
+	acceptLimit acceptlimit.Options
+	// the network interface the listener binds to, any if empty.
+	device string
+	// the network namespace the listener binds in, the namespace of the process if empty.
+	netns string
+	// rewrites the targets of the direct forwarding, nil if disabled.
+	rewriter *sshd_util.Rewriter
 }
 
 func (l *sshdListener) parseMetadata(md mdata.Metadata) (err error) {
@@ -31,6 +51,12 @@ func (l *sshdListener) parseMetadata(md mdata.Metadata) (err error) {
 		backlog        = "backlog"
 	)
 
+	l.md.acceptLimit = acceptlimit.Options{
+		Rate:    mdutil.GetFloat(md, "accept.rate"),
+		Burst:   mdutil.GetInt(md, "accept.burst"),
+		Service: l.options.Service,
+	}
+
 	if key := mdutil.GetString(md, privateKeyFile); key != "" {
 		key, err = homedir.Expand(key)
 		if err != nil {
@@ -81,5 +107,45 @@ func (l *sshdListener) parseMetadata(md mdata.Metadata) (err error) {
 	}
 
 	l.md.mptcp = mdutil.GetBool(md, "mptcp")
+	l.md.device = mdutil.GetString(md, "device")
+	if l.md.netns = mdutil.GetString(md, "netns"); l.md.netns == "" {
+		l.md.netns = l.options.Netns
+	}
+	l.md.idleTimeout = mdutil.GetDuration(md, "idleTimeout")
+	if l.md.rewriter, err = sshd_util.NewRewriter(mdutil.GetStringMapString(md, "rewrite"), mdutil.GetBool(md, "rewrite.strict")); err != nil {
+		return
+	}
+
+	if l.md.keepalive = mdutil.GetBool(md, "keepalive"); l.md.keepalive {
+		l.md.keepaliveInterval = mdutil.GetDuration(md, "keepalive.interval")
+		if l.md.keepaliveInterval <= 0 {
+			l.md.keepaliveInterval = defaultKeepaliveInterval
+		}
+		l.md.keepaliveMaxMissed = mdutil.GetInt(md, "keepalive.maxMissed", "keepalive.retries")
+		if l.md.keepaliveMaxMissed <= 0 {
+			l.md.keepaliveMaxMissed = defaultKeepaliveMaxMissed
+		}
+	}
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"accept.burst",
+	"accept.rate",
+	"authorizedKeys",
+	"backlog",
+	"device",
+	"idleTimeout",
+	"keepalive",
+	"keepalive.interval",
+	"keepalive.maxMissed",
+	"keepalive.retries",
+	"mptcp",
+	"netns",
+	"passphrase",
+	"passphraseFromKeyring",
+	"privateKeyFile",
+	"rewrite",
+	"rewrite.strict",
+}
@@ -20,6 +20,7 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("tap", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "tap", schema...)
 }
 
 type tapListener struct {
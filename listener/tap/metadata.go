@@ -73,3 +73,13 @@ func (l *tapListener) parseMetadata(md mdata.Metadata) (err error) {
 
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"gw",
+	"mtu",
+	"name",
+	"net",
+	"route",
+	"routes",
+}
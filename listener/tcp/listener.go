@@ -11,10 +11,13 @@ import (
 	md "github.com/go-gost/core/metadata"
 	admission "github.com/go-gost/x/admission/wrapper"
 	xnet "github.com/go-gost/x/internal/net"
+	"github.com/go-gost/x/internal/net/acceptlimit"
+	"github.com/go-gost/x/internal/net/fingerprint"
 	"github.com/go-gost/x/internal/net/proxyproto"
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
 	climiter "github.com/go-gost/x/limiter/conn/wrapper"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -22,6 +25,7 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("tcp", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "tcp", schema...)
 }
 
 type tcpListener struct {
@@ -52,7 +56,12 @@ func (l *tcpListener) Init(md md.Metadata) (err error) {
 		network = "tcp4"
 	}
 
-	lc := net.ListenConfig{}
+	lc := xnet.ListenConfig{
+		Netns: l.md.netns,
+		ListenConfig: net.ListenConfig{
+			Control: xnet.BindDeviceControl(l.md.device),
+		},
+	}
 	if l.md.mptcp {
 		lc.SetMultipathTCP(true)
 		l.logger.Debugf("mptcp enabled: %v", lc.MultipathTCP())
@@ -62,9 +71,15 @@ func (l *tcpListener) Init(md md.Metadata) (err error) {
 		return
 	}
 
+	ln = acceptlimit.WrapListener(ln, l.md.acceptLimit)
+
 	l.logger.Debugf("pp: %d", l.options.ProxyProtocol)
 
 	ln = proxyproto.WrapListener(l.options.ProxyProtocol, ln, 10*time.Second)
+	// the fingerprints are captured after the PROXY protocol header.
+	opts := l.md.fingerprint
+	opts.Logger = l.logger
+	ln = fingerprint.WrapListener(ln, opts)
 	ln = metrics.WrapListener(l.options.Service, ln)
 	ln = stats.WrapListener(ln, l.options.Stats)
 	ln = admission.WrapListener(l.options.Admission, ln)
@@ -3,13 +3,52 @@ package tcp
 import (
 	md "github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/core/metadata/util"
+	"github.com/go-gost/x/internal/net/acceptlimit"
+	"github.com/go-gost/x/internal/net/fingerprint"
 )
 
 type metadata struct {
-	mptcp bool
+	mptcp       bool
+	fingerprint fingerprint.Options
+	// the rate limit of the accepted connections.
+	acceptLimit acceptlimit.Options
+	// the network interface the listener binds to, any if empty.
+	device string
+	// the network namespace the listener binds in, the namespace of the process if empty.
+	netns string
 }
 
 func (l *tcpListener) parseMetadata(md md.Metadata) (err error) {
+	l.md.acceptLimit = acceptlimit.Options{
+		Rate:    mdutil.GetFloat(md, "accept.rate"),
+		Burst:   mdutil.GetInt(md, "accept.burst"),
+		Service: l.options.Service,
+	}
+
 	l.md.mptcp = mdutil.GetBool(md, "mptcp")
+	l.md.device = mdutil.GetString(md, "device")
+	if l.md.netns = mdutil.GetString(md, "netns"); l.md.netns == "" {
+		l.md.netns = l.options.Netns
+	}
+
+	l.md.fingerprint = fingerprint.Options{
+		TCP: mdutil.GetBool(md, "fingerprint.tcp"),
+		TCPRules: fingerprint.NewRules(
+			mdutil.GetStrings(md, "fingerprint.tcp.allow"),
+			mdutil.GetStrings(md, "fingerprint.tcp.deny"),
+		),
+	}
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"accept.burst",
+	"accept.rate",
+	"device",
+	"fingerprint.tcp",
+	"fingerprint.tcp.allow",
+	"fingerprint.tcp.deny",
+	"mptcp",
+	"netns",
+}
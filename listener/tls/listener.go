@@ -12,10 +12,13 @@ import (
 	md "github.com/go-gost/core/metadata"
 	admission "github.com/go-gost/x/admission/wrapper"
 	xnet "github.com/go-gost/x/internal/net"
+	"github.com/go-gost/x/internal/net/fingerprint"
 	"github.com/go-gost/x/internal/net/proxyproto"
 	limiter_util "github.com/go-gost/x/internal/util/limiter"
+	tls_util "github.com/go-gost/x/internal/util/tls"
 	climiter "github.com/go-gost/x/limiter/conn/wrapper"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -23,6 +26,7 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("tls", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "tls", schema...)
 }
 
 type tlsListener struct {
@@ -62,7 +66,12 @@ func (l *tlsListener) Init(md md.Metadata) (err error) {
 	if err != nil {
 		return
 	}
+
 	ln = proxyproto.WrapListener(l.options.ProxyProtocol, ln, 10*time.Second)
+	// the fingerprints are captured after the PROXY protocol header.
+	opts := l.md.fingerprint
+	opts.Logger = l.logger
+	ln = fingerprint.WrapListener(ln, opts)
 	ln = metrics.WrapListener(l.options.Service, ln)
 	ln = stats.WrapListener(ln, l.options.Stats)
 	ln = admission.WrapListener(l.options.Admission, ln)
@@ -73,7 +82,7 @@ func (l *tlsListener) Init(md md.Metadata) (err error) {
 	)
 	ln = climiter.WrapListener(l.options.ConnLimiter, ln)
 
-	l.ln = tls.NewListener(ln, l.options.TLSConfig)
+	l.ln = tls.NewListener(ln, fingerprint.TLSConfig(l.md.revocation.Config(l.md.ocsp.Config(l.options.TLSConfig)), l.md.fingerprintTLSRules))
 
 	return
 }
@@ -83,6 +92,10 @@ func (l *tlsListener) Accept() (conn net.Conn, err error) {
 	if err != nil {
 		return
 	}
+	if l.md.fingerprint.TLS {
+		conn = fingerprint.WrapTLSConn(conn)
+	}
+	conn = tls_util.WrapClientIDConn(conn, l.md.clientID)
 
 	conn = limiter_wrapper.WrapConn(
 		conn,
@@ -3,13 +3,67 @@ package tls
 import (
 	mdata "github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/core/metadata/util"
+	"github.com/go-gost/x/internal/net/fingerprint"
+	tls_util "github.com/go-gost/x/internal/util/tls"
 )
 
 type metadata struct {
-	mptcp bool
+	mptcp               bool
+	fingerprint         fingerprint.Options
+	fingerprintTLSRules *fingerprint.Rules
+	// the OCSP stapling of the server certificates, nil if disabled.
+	ocsp *tls_util.OCSPStapler
+	// the revocation checking of the client certificates, nil if disabled.
+	revocation *tls_util.RevocationChecker
+	// the field of the verified client certificate attached to the connections as the client ID.
+	clientID tls_util.ClientIDMode
 }
 
 func (l *tlsListener) parseMetadata(md mdata.Metadata) (err error) {
 	l.md.mptcp = mdutil.GetBool(md, "mptcp")
+	if mdutil.GetBool(md, "tls.ocsp") {
+		l.md.ocsp = tls_util.NewOCSPStapler(mdutil.GetDuration(md, "tls.ocsp.ttl"), l.logger)
+	}
+	ocspMode, err := tls_util.ParseOCSPMode(mdutil.GetString(md, "tls.clientOCSP"))
+	if err != nil {
+		return err
+	}
+	if l.md.revocation, err = tls_util.NewRevocationChecker(l.options.Service, mdutil.GetStrings(md, "tls.clientCRL"), ocspMode, l.logger); err != nil {
+		return err
+	}
+	if l.md.clientID, err = tls_util.ParseClientIDMode(mdutil.GetString(md, "tls.clientID")); err != nil {
+		return err
+	}
+
+	l.md.fingerprint = fingerprint.Options{
+		TCP: mdutil.GetBool(md, "fingerprint.tcp"),
+		TCPRules: fingerprint.NewRules(
+			mdutil.GetStrings(md, "fingerprint.tcp.allow"),
+			mdutil.GetStrings(md, "fingerprint.tcp.deny"),
+		),
+		TLS: mdutil.GetBool(md, "fingerprint.tls"),
+	}
+	if l.md.fingerprint.TLS {
+		l.md.fingerprintTLSRules = fingerprint.NewRules(
+			mdutil.GetStrings(md, "fingerprint.tls.allow"),
+			mdutil.GetStrings(md, "fingerprint.tls.deny"),
+		)
+	}
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"fingerprint.tcp",
+	"fingerprint.tcp.allow",
+	"fingerprint.tcp.deny",
+	"fingerprint.tls",
+	"fingerprint.tls.allow",
+	"fingerprint.tls.deny",
+	"mptcp",
+	"tls.clientCRL",
+	"tls.clientID",
+	"tls.clientOCSP",
+	"tls.ocsp",
+	"tls.ocsp.ttl",
+}
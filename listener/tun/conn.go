@@ -15,13 +15,34 @@ type conn struct {
 	laddr  net.Addr
 	raddr  net.Addr
 	cancel context.CancelFunc
+	// the MSS clamping of the TCP SYN segments in both directions, nil if disabled.
+	mss *mssClamp
+	// the packet filter of both directions, nil if disabled.
+	filter *packetFilter
 }
 
 func (c *conn) Read(b []byte) (n int, err error) {
-	return c.ifce.Read(b)
+	for {
+		n, err = c.ifce.Read(b)
+		if n > 0 && !c.filter.allow(directionOut, b[:n]) {
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if n > 0 {
+			c.mss.clamp(b[:n])
+		}
+		return
+	}
 }
 
 func (c *conn) Write(b []byte) (n int, err error) {
+	if !c.filter.allow(directionIn, b) {
+		// the dropped packet is consumed silently, as by a firewall.
+		return len(b), nil
+	}
+	c.mss.clamp(b)
 	return c.ifce.Write(b)
 }
 
@@ -0,0 +1,283 @@
+package tun
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/go-gost/core/metrics"
+	xmetrics "github.com/go-gost/x/metrics"
+)
+
+const (
+	// the packets read from the interface, sent by the local host to the tunnel.
+	directionOut = "out"
+	// the packets written to the interface, received from the tunnel.
+	directionIn = "in"
+)
+
+type portRange struct {
+	min, max uint16
+}
+
+func (r *portRange) contains(port int) bool {
+	return r == nil || (port >= int(r.min) && port <= int(r.max))
+}
+
+// packetRule matches the packets by the protocol, the addresses and the ports,
+// the unset fields match all the packets.
+type packetRule struct {
+	allow bool
+	proto int
+	src   *net.IPNet
+	dst   *net.IPNet
+	sport *portRange
+	dport *portRange
+	// either of the ports.
+	port *portRange
+}
+
+var protocols = map[string]int{
+	// icmp matches both ICMP and ICMPv6.
+	"icmp":  1,
+	"tcp":   6,
+	"udp":   17,
+	"icmp6": 58,
+}
+
+// parsePacketRule parses the rule such as "deny tcp dst=10.0.0.0/8 dport=22",
+// it is the action (allow or deny) followed by the optional protocol (tcp, udp, icmp, icmp6 or proto=N)
+// and the matches of src, dst, sport, dport and port, the ports are single or a range such as 8000-8080.
+func parsePacketRule(s string) (*packetRule, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty filter rule")
+	}
+
+	r := &packetRule{}
+	switch strings.ToLower(fields[0]) {
+	case "allow":
+		r.allow = true
+	case "deny":
+	default:
+		return nil, fmt.Errorf("filter rule %q: unknown action %s", s, fields[0])
+	}
+
+	for _, field := range fields[1:] {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			if k = strings.ToLower(k); k == "any" {
+				continue
+			}
+			proto, ok := protocols[k]
+			if !ok {
+				return nil, fmt.Errorf("filter rule %q: unknown protocol %s", s, field)
+			}
+			r.proto = proto
+			continue
+		}
+
+		var err error
+		switch strings.ToLower(k) {
+		case "proto":
+			if proto, ok := protocols[strings.ToLower(v)]; ok {
+				r.proto = proto
+			} else if r.proto, err = strconv.Atoi(v); err == nil && (r.proto <= 0 || r.proto > 255) {
+				err = fmt.Errorf("invalid protocol %s", v)
+			}
+		case "src":
+			r.src, err = parseNet(v)
+		case "dst":
+			r.dst, err = parseNet(v)
+		case "sport":
+			r.sport, err = parsePortRange(v)
+		case "dport":
+			r.dport, err = parsePortRange(v)
+		case "port":
+			r.port, err = parsePortRange(v)
+		default:
+			err = fmt.Errorf("unknown match %s", k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("filter rule %q: %w", s, err)
+		}
+	}
+	return r, nil
+}
+
+// parseNet parses the CIDR or the single IP address.
+func parseNet(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address %s", s)
+		}
+		bits := 128
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	return ipNet, err
+}
+
+func parsePortRange(s string) (*portRange, error) {
+	from, to, ok := strings.Cut(s, "-")
+	lo, err := strconv.ParseUint(from, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %s", s)
+	}
+	hi := lo
+	if ok {
+		if hi, err = strconv.ParseUint(to, 10, 16); err != nil || hi < lo {
+			return nil, fmt.Errorf("invalid port range %s", s)
+		}
+	}
+	return &portRange{min: uint16(lo), max: uint16(hi)}, nil
+}
+
+// packetInfo is the fields of the IP packet the rules match on,
+// the ports are -1 if the packet has no ports, such as ICMP or the non-first fragments.
+type packetInfo struct {
+	proto int
+	src   net.IP
+	dst   net.IP
+	sport int
+	dport int
+}
+
+func parsePacket(b []byte) (p packetInfo, ok bool) {
+	if len(b) == 0 {
+		return
+	}
+
+	var payload []byte
+	switch b[0] >> 4 {
+	case 4:
+		ihl := int(b[0]&0x0f) * 4
+		if ihl < 20 || len(b) < ihl {
+			return
+		}
+		p.proto = int(b[9])
+		p.src, p.dst = net.IP(b[12:16]), net.IP(b[16:20])
+		if b[6]&0x1f == 0 && b[7] == 0 {
+			payload = b[ihl:]
+		}
+	case 6:
+		if len(b) < 40 {
+			return
+		}
+		p.src, p.dst = net.IP(b[8:24]), net.IP(b[24:40])
+		var first bool
+		if p.proto, payload, first = skipIPv6ExtHeaders(int(b[6]), b[40:]); p.proto < 0 {
+			return
+		}
+		if !first {
+			payload = nil
+		}
+	default:
+		return
+	}
+
+	p.sport, p.dport = -1, -1
+	if (p.proto == 6 || p.proto == 17) && len(payload) >= 4 {
+		p.sport = int(payload[0])<<8 | int(payload[1])
+		p.dport = int(payload[2])<<8 | int(payload[3])
+	}
+	return p, true
+}
+
+// skipIPv6ExtHeaders walks the extension headers of the IPv6 packet from the next header proto,
+// it returns the upper-layer protocol and the payload of it, or -1 if the headers are truncated.
+// first is false for the non-first fragment, which has no upper-layer header, so the ports are not matched.
+func skipIPv6ExtHeaders(proto int, b []byte) (int, []byte, bool) {
+	first := true
+	for {
+		switch proto {
+		case 0, 43, 60: // hop-by-hop options, routing, destination options
+			if len(b) < 8 || len(b) < (int(b[1])+1)*8 {
+				return -1, nil, false
+			}
+			proto, b = int(b[0]), b[(int(b[1])+1)*8:]
+		case 44: // fragment
+			if len(b) < 8 {
+				return -1, nil, false
+			}
+			if (int(b[2])<<8|int(b[3]))>>3 != 0 {
+				first = false
+			}
+			proto, b = int(b[0]), b[8:]
+			if !first {
+				return proto, b, false
+			}
+		default:
+			return proto, b, first
+		}
+	}
+}
+
+func (r *packetRule) match(p *packetInfo) bool {
+	if r.proto != 0 && r.proto != p.proto && !(r.proto == 1 && p.proto == 58) {
+		return false
+	}
+	if r.src != nil && !r.src.Contains(p.src) {
+		return false
+	}
+	if r.dst != nil && !r.dst.Contains(p.dst) {
+		return false
+	}
+	if r.sport != nil || r.dport != nil || r.port != nil {
+		if p.sport < 0 {
+			return false
+		}
+		if !r.sport.contains(p.sport) || !r.dport.contains(p.dport) {
+			return false
+		}
+		if r.port != nil && !r.port.contains(p.sport) && !r.port.contains(p.dport) {
+			return false
+		}
+	}
+	return true
+}
+
+// packetFilter filters the packets through the interface by the rules of each direction,
+// the first matched rule takes effect, and the packets matching no rule are allowed unless deny is set.
+type packetFilter struct {
+	in      []*packetRule
+	out     []*packetRule
+	deny    bool
+	service string
+}
+
+// allow reports whether the packet b in the direction is allowed,
+// the dropped packets are counted. The nil filter allows all the packets.
+func (f *packetFilter) allow(direction string, b []byte) bool {
+	if f == nil {
+		return true
+	}
+
+	rules := f.out
+	if direction == directionIn {
+		rules = f.in
+	}
+
+	allowed := !f.deny
+	if p, ok := parsePacket(b); ok {
+		for _, r := range rules {
+			if r.match(&p) {
+				allowed = r.allow
+				break
+			}
+		}
+	}
+
+	if !allowed {
+		if v := xmetrics.GetCounter(xmetrics.MetricServicePacketsFilteredCounter,
+			metrics.Labels{"service": f.service, "direction": direction}); v != nil {
+			v.Inc()
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,94 @@
+package tun
+
+import (
+	"net"
+	"testing"
+)
+
+// ipv6Packet builds the IPv6 packet with the extension headers and the UDP header of the ports 1234 -> 53.
+func ipv6Packet(next byte, ext ...[]byte) []byte {
+	b := make([]byte, 40)
+	b[0] = 6 << 4
+	b[6] = next
+	copy(b[8:24], net.ParseIP("2001:db8::1"))
+	copy(b[24:40], net.ParseIP("2001:db8::2"))
+	for _, e := range ext {
+		b = append(b, e...)
+	}
+	return append(b, 0x04, 0xd2, 0x00, 0x35, 0, 8, 0, 0)
+}
+
+func TestParsePacketIPv6ExtHeaders(t *testing.T) {
+	tests := []struct {
+		name  string
+		b     []byte
+		ok    bool
+		proto int
+		sport int
+		dport int
+	}{
+		{
+			name: "no extension header",
+			b:    ipv6Packet(17),
+			ok:   true, proto: 17, sport: 1234, dport: 53,
+		},
+		{
+			name: "hop-by-hop and destination options",
+			b: ipv6Packet(0,
+				[]byte{60, 0, 1, 4, 0, 0, 0, 0},
+				[]byte{17, 1, 1, 12, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+			),
+			ok: true, proto: 17, sport: 1234, dport: 53,
+		},
+		{
+			name: "routing",
+			b:    ipv6Packet(43, []byte{17, 0, 4, 0, 0, 0, 0, 0}),
+			ok:   true, proto: 17, sport: 1234, dport: 53,
+		},
+		{
+			name: "first fragment",
+			b:    ipv6Packet(44, []byte{17, 0, 0, 1, 0, 0, 0, 1}),
+			ok:   true, proto: 17, sport: 1234, dport: 53,
+		},
+		{
+			name: "non-first fragment",
+			b:    ipv6Packet(44, []byte{17, 0, 0, 0x10, 0, 0, 0, 1}),
+			ok:   true, proto: 17, sport: -1, dport: -1,
+		},
+		{
+			name: "truncated extension header",
+			b:    ipv6Packet(0, []byte{17, 4, 0, 0, 0, 0, 0, 0})[:52],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := parsePacket(tt.b)
+			if ok != tt.ok {
+				t.Fatalf("ok: got %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if p.proto != tt.proto || p.sport != tt.sport || p.dport != tt.dport {
+				t.Errorf("got proto %d ports %d/%d, want %d %d/%d", p.proto, p.sport, p.dport, tt.proto, tt.sport, tt.dport)
+			}
+		})
+	}
+}
+
+func TestPacketFilterNonFirstFragment(t *testing.T) {
+	rule, err := parsePacketRule("deny udp dport=53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &packetFilter{out: []*packetRule{rule}}
+
+	if f.allow(directionOut, ipv6Packet(44, []byte{17, 0, 0, 1, 0, 0, 0, 1})) {
+		t.Error("first fragment to port 53 is allowed")
+	}
+	// the ports of the non-first fragment are unknown, it matches no port rule.
+	if !f.allow(directionOut, ipv6Packet(44, []byte{17, 0, 0, 0x10, 0, 0, 0, 1})) {
+		t.Error("non-first fragment is denied")
+	}
+}
@@ -2,6 +2,7 @@ package tun
 
 import (
 	"context"
+	"io"
 	"net"
 	"time"
 
@@ -21,6 +22,7 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("tun", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "tun", schema...)
 }
 
 type tunListener struct {
@@ -31,6 +33,7 @@ type tunListener struct {
 	md      metadata
 	options listener.Options
 	routes  []*router.Route
+	prober  *prober
 }
 
 func NewListener(opts ...listener.Option) listener.Listener {
@@ -57,25 +60,60 @@ func (l *tunListener) Init(md mdata.Metadata) (err error) {
 	if err != nil {
 		return
 	}
+
+	// the ICMP socket of the probe is opened before the privileges are dropped,
+	// it is shared by the probes of the recreated interfaces.
+	if l.md.probeTarget != nil {
+		l.prober, err = newProber(l.md.probeTarget, l.md.probeInterval, l.md.probeTimeout, l.md.probeFailures, l.logger)
+		if err != nil {
+			return
+		}
+	}
+
 	l.cqueue = make(chan net.Conn)
 	l.closed = make(chan struct{})
 
-	go l.listenLoop()
+	// the first interface is created in Init, before the privileges are dropped after all the listeners are initialized,
+	// the interface recreated later requires CAP_NET_ADMIN to be retained. It is retried by the loop on failure.
+	t, err := l.openTun()
+	if err != nil {
+		l.logger.Error(err)
+	}
+	go l.listenLoop(t)
+
+	return nil
+}
+
+type tunIfce struct {
+	ifce io.ReadWriteCloser
+	name string
+	ip   net.IP
+}
 
-	return
+func (l *tunListener) openTun() (*tunIfce, error) {
+	ifce, name, ip, err := l.createTun()
+	if err != nil {
+		if ifce != nil {
+			ifce.Close()
+		}
+		return nil, err
+	}
+	return &tunIfce{ifce: ifce, name: name, ip: ip}, nil
 }
 
-func (l *tunListener) listenLoop() {
+// listenLoop serves the interface t opened in Init first, and recreates the interface once the conn of it is closed.
+func (l *tunListener) listenLoop(t *tunIfce) {
 	for {
 		ctx, cancel := context.WithCancel(context.Background())
 		err := func() error {
-			ifce, name, ip, err := l.createTun()
-			if err != nil {
-				if ifce != nil {
-					ifce.Close()
+			if t == nil {
+				var err error
+				if t, err = l.openTun(); err != nil {
+					return err
 				}
-				return err
 			}
+			ifce, name, ip := t.ifce, t.name, t.ip
+			t = nil
 
 			itf, err := net.InterfaceByName(name)
 			if err != nil {
@@ -86,12 +124,24 @@ func (l *tunListener) listenLoop() {
 			l.logger.Infof("name: %s, net: %s, mtu: %d, addrs: %s",
 				itf.Name, ip, itf.MTU, addrs)
 
+			var mss *mssClamp
+			if l.md.mssClamp {
+				// the MSS is derived from the MTU in effect on the interface.
+				mtu := itf.MTU
+				if mtu <= 0 {
+					mtu = l.md.config.MTU
+				}
+				mss = newMSSClamp(l.md.mss, mtu)
+			}
+
 			var c net.Conn
 			c = &conn{
 				ifce:   ifce,
 				laddr:  l.addr,
 				raddr:  &net.IPAddr{IP: ip},
 				cancel: cancel,
+				mss:    mss,
+				filter: l.md.filter,
 			}
 			c = metrics.WrapConn(l.options.Service, c)
 			c = stats.WrapConn(c, l.options.Stats)
@@ -107,6 +157,11 @@ func (l *tunListener) listenLoop() {
 				"config": l.md.config,
 			}), c)
 
+			if l.prober != nil {
+				// the interface is recreated once the conn is closed.
+				go l.prober.run(ctx, func() { c.Close() })
+			}
+
 			l.cqueue <- c
 
 			return nil
@@ -147,5 +202,5 @@ func (l *tunListener) Close() error {
 	default:
 		close(l.closed)
 	}
-	return nil
+	return l.prober.Close()
 }
@@ -1,8 +1,10 @@
 package tun
 
 import (
+	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/go-gost/core/logger"
 	mdata "github.com/go-gost/core/metadata"
@@ -21,6 +23,16 @@ const (
 type metadata struct {
 	config         *tun_util.Config
 	readBufferSize int
+	// the peer probed with the ICMP echo requests, nil if the probing is disabled.
+	probeTarget   net.IP
+	probeInterval time.Duration
+	probeTimeout  time.Duration
+	probeFailures int
+	// the MSS of the TCP SYN segments is clamped to mss, or derived from the MTU if mss is zero.
+	mssClamp bool
+	mss      int
+	// the packet filter of the interface, nil if disabled.
+	filter *packetFilter
 }
 
 func (l *tunListener) parseMetadata(md mdata.Metadata) (err error) {
@@ -39,10 +51,26 @@ func (l *tunListener) parseMetadata(md mdata.Metadata) (err error) {
 		l.md.readBufferSize = defaultReadBufferSize
 	}
 
+	if v := mdutil.GetString(md, "probe"); v != "" {
+		if l.md.probeTarget = net.ParseIP(v); l.md.probeTarget == nil {
+			return fmt.Errorf("invalid probe target %s", v)
+		}
+		l.md.probeInterval = mdutil.GetDuration(md, "probe.interval")
+		l.md.probeTimeout = mdutil.GetDuration(md, "probe.timeout")
+		l.md.probeFailures = mdutil.GetInt(md, "probe.failures")
+	}
+
+	l.md.mss = mdutil.GetInt(md, "tun.mss", "mss")
+	l.md.mssClamp = l.md.mss > 0 || mdutil.GetBool(md, "tun.mssClamp", "mssClamp")
+
+	if l.md.filter, err = l.parseFilter(md); err != nil {
+		return
+	}
+
 	config := &tun_util.Config{
 		Name:   mdutil.GetString(md, name),
 		Peer:   mdutil.GetString(md, peer),
-		MTU:    mdutil.GetInt(md, mtu),
+		MTU:    mdutil.GetInt(md, "tun.mtu", mtu),
 		Router: registry.RouterRegistry().Get(mdutil.GetString(md, "router")),
 	}
 	if config.MTU <= 0 {
@@ -113,3 +141,71 @@ func (l *tunListener) parseMetadata(md mdata.Metadata) (err error) {
 
 	return
 }
+
+// parseFilter parses the packet filter, for example:
+//
+//	filter.out: ["allow tcp dport=443", "deny dst=10.0.0.0/8"]
+//	filter.in: ["deny udp sport=53"]
+//	filter.default: deny
+func (l *tunListener) parseFilter(md mdata.Metadata) (*packetFilter, error) {
+	in := mdutil.GetStrings(md, "filter.in")
+	out := mdutil.GetStrings(md, "filter.out")
+	def := strings.ToLower(mdutil.GetString(md, "filter.default"))
+	if len(in) == 0 && len(out) == 0 && def == "" {
+		return nil, nil
+	}
+
+	f := &packetFilter{
+		service: l.options.Service,
+	}
+	switch def {
+	case "", "allow":
+	case "deny":
+		f.deny = true
+	default:
+		return nil, fmt.Errorf("unknown filter default action %s", def)
+	}
+
+	for _, s := range in {
+		r, err := parsePacketRule(s)
+		if err != nil {
+			return nil, err
+		}
+		f.in = append(f.in, r)
+	}
+	for _, s := range out {
+		r, err := parsePacketRule(s)
+		if err != nil {
+			return nil, err
+		}
+		f.out = append(f.out, r)
+	}
+	return f, nil
+}
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"filter.default",
+	"filter.in",
+	"filter.out",
+	"gw",
+	"mss",
+	"mssClamp",
+	"mtu",
+	"name",
+	"net",
+	"peer",
+	"probe",
+	"probe.failures",
+	"probe.interval",
+	"probe.timeout",
+	"rbuf",
+	"readBufferSize",
+	"route",
+	"router",
+	"routes",
+	"tun.mss",
+	"tun.mssClamp",
+	"tun.mtu",
+	"tun.rbuf",
+}
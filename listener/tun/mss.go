@@ -0,0 +1,107 @@
+package tun
+
+import "encoding/binary"
+
+const (
+	// the sizes of the IP and TCP headers without options subtracted from the MTU for the MSS.
+	ipv4TCPOverhead = 40
+	ipv6TCPOverhead = 60
+	minMSS          = 536
+)
+
+// mssClamp is the MSS the TCP SYN segments through the interface are clamped to,
+// the segments are rewritten in the packets, so it works the same on all platforms.
+type mssClamp struct {
+	mss4 int
+	mss6 int
+}
+
+// newMSSClamp creates a mssClamp with the mss, or derived from the mtu if mss is zero.
+func newMSSClamp(mss int, mtu int) *mssClamp {
+	c := &mssClamp{
+		mss4: mss,
+		mss6: mss,
+	}
+	if mss <= 0 {
+		c.mss4 = max(mtu-ipv4TCPOverhead, minMSS)
+		c.mss6 = max(mtu-ipv6TCPOverhead, minMSS)
+	}
+	return c
+}
+
+// clamp lowers the MSS option of the TCP SYN segment in the IP packet b,
+// the other packets are left untouched.
+func (c *mssClamp) clamp(b []byte) {
+	if c == nil || len(b) == 0 {
+		return
+	}
+
+	var tcp []byte
+	var mss int
+	switch b[0] >> 4 {
+	case 4:
+		ihl := int(b[0]&0x0f) * 4
+		// only the first fragment carries the TCP header.
+		if ihl < 20 || len(b) < ihl || b[9] != 6 || binary.BigEndian.Uint16(b[6:8])&0x1fff != 0 {
+			return
+		}
+		tcp, mss = b[ihl:], c.mss4
+	case 6:
+		// the extension headers are not followed.
+		if len(b) < 40 || b[6] != 6 {
+			return
+		}
+		tcp, mss = b[40:], c.mss6
+	default:
+		return
+	}
+
+	if len(tcp) < 20 || tcp[13]&0x02 == 0 {
+		return
+	}
+	doff := int(tcp[12]>>4) * 4
+	if doff < 20 || len(tcp) < doff {
+		return
+	}
+
+	for i := 20; i < doff; {
+		kind := tcp[i]
+		switch kind {
+		case 0:
+			return
+		case 1:
+			i++
+			continue
+		}
+		if i+1 >= doff {
+			return
+		}
+		n := int(tcp[i+1])
+		if n < 2 || i+n > doff {
+			return
+		}
+		if kind == 2 && n == 4 {
+			old := binary.BigEndian.Uint16(tcp[i+2:])
+			if int(old) <= mss {
+				return
+			}
+			binary.BigEndian.PutUint16(tcp[i+2:], uint16(mss))
+			updateChecksum(tcp[16:18], old, uint16(mss), (i+2)%2 == 1)
+			return
+		}
+		i += n
+	}
+}
+
+// updateChecksum updates the internet checksum incrementally (RFC 1624) for the 16-bit field
+// changed from old to new, the field at the odd offset is summed in the swapped byte order.
+func updateChecksum(sum []byte, old, new uint16, odd bool) {
+	if odd {
+		old, new = old>>8|old<<8, new>>8|new<<8
+	}
+	s := uint32(^binary.BigEndian.Uint16(sum)) + uint32(^old) + uint32(new)
+	for s>>16 != 0 {
+		s = s&0xffff + s>>16
+	}
+	binary.BigEndian.PutUint16(sum, ^uint16(s))
+}
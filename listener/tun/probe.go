@@ -0,0 +1,201 @@
+package tun
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/logger"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	defaultProbeInterval = 10 * time.Second
+	defaultProbeTimeout  = 3 * time.Second
+	defaultProbeFailures = 3
+	// the failures of the probes are logged at most once in the interval.
+	probeLogInterval = time.Minute
+)
+
+// prober probes the peer of the tunnel with the ICMP echo requests,
+// so the dead path is detected without waiting for the read error of the interface.
+//
+// The ICMP socket is opened once in the Init of the listener, before the privileges are dropped,
+// and shared by the probes of the recreated interfaces. The raw socket is preferred,
+// the unprivileged ICMP socket (net.ipv4.ping_group_range) is used if it is not permitted.
+type prober struct {
+	target   net.IP
+	interval time.Duration
+	timeout  time.Duration
+	// the number of the consecutive failures the path is considered dead after.
+	failures int
+	conn     *icmp.PacketConn
+	// the socket is the unprivileged one, the ID of the echo is set by the kernel.
+	dgram      bool
+	id         int
+	seq        int
+	lastLog    time.Time
+	suppressed int
+	// serializes the probes, the prober of the previous interface may still be waiting for the reply.
+	mu     sync.Mutex
+	logger logger.Logger
+}
+
+func newProber(target net.IP, interval, timeout time.Duration, failures int, log logger.Logger) (*prober, error) {
+	if interval <= 0 {
+		interval = defaultProbeInterval
+	}
+	if timeout <= 0 || timeout > interval {
+		timeout = min(defaultProbeTimeout, interval)
+	}
+	if failures <= 0 {
+		failures = defaultProbeFailures
+	}
+	p := &prober{
+		target:   target,
+		interval: interval,
+		timeout:  timeout,
+		failures: failures,
+		id:       rand.Intn(0xffff),
+		logger:   log,
+	}
+
+	network, address := "ip4:icmp", "0.0.0.0"
+	dgramNetwork := "udp4"
+	if target.To4() == nil {
+		network, address = "ip6:ipv6-icmp", "::"
+		dgramNetwork = "udp6"
+	}
+	c, err := icmp.ListenPacket(network, address)
+	if err != nil {
+		var e error
+		if c, e = icmp.ListenPacket(dgramNetwork, address); e != nil {
+			return nil, fmt.Errorf("probe: %w (unprivileged: %v)", err, e)
+		}
+		p.dgram = true
+		log.Debugf("probe %s: raw ICMP socket: %v, the unprivileged socket is used", target, err)
+	}
+	p.conn = c
+	return p, nil
+}
+
+// Close closes the ICMP socket of the prober.
+func (p *prober) Close() error {
+	if p == nil {
+		return nil
+	}
+	return p.conn.Close()
+}
+
+// run probes the target periodically until ctx is done,
+// dead is called once the probes fail consecutively.
+func (p *prober) run(ctx context.Context, dead func()) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if err := p.probe(); err != nil {
+			failures++
+			p.logFailure(err, failures)
+			if failures >= p.failures {
+				p.logger.Errorf("probe %s: %d consecutive failures, recreating the interface", p.target, failures)
+				dead()
+				return
+			}
+			continue
+		}
+
+		if failures > 0 {
+			p.logger.Infof("probe %s: recovered after %d failures", p.target, failures)
+		}
+		failures = 0
+	}
+}
+
+func (p *prober) logFailure(err error, failures int) {
+	if time.Since(p.lastLog) < probeLogInterval {
+		p.suppressed++
+		return
+	}
+	p.logger.Warnf("probe %s: %v (failures=%d, suppressed=%d)", p.target, err, failures, p.suppressed)
+	p.lastLog = time.Now()
+	p.suppressed = 0
+}
+
+// probe sends an echo request to the target, and waits for the reply until the timeout.
+func (p *prober) probe() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var typ, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	proto := 1
+	if p.target.To4() == nil {
+		typ, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+		proto = 58
+	}
+
+	p.seq = (p.seq + 1) & 0xffff
+	msg := icmp.Message{
+		Type: typ,
+		Body: &icmp.Echo{
+			ID:   p.id,
+			Seq:  p.seq,
+			Data: []byte("gost"),
+		},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+
+	var dst net.Addr = &net.IPAddr{IP: p.target}
+	if p.dgram {
+		dst = &net.UDPAddr{IP: p.target}
+	}
+	if _, err := p.conn.WriteTo(b, dst); err != nil {
+		return err
+	}
+
+	p.conn.SetReadDeadline(time.Now().Add(p.timeout))
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			return fmt.Errorf("no reply: %w", err)
+		}
+		if !p.fromTarget(peer) {
+			continue
+		}
+
+		m, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || m.Type != replyType {
+			continue
+		}
+		// the ID is replaced by the kernel for the unprivileged socket, only the replies to the socket are received.
+		if echo, ok := m.Body.(*icmp.Echo); ok && (p.dgram || echo.ID == p.id) && echo.Seq == p.seq {
+			return nil
+		}
+	}
+}
+
+func (p *prober) fromTarget(addr net.Addr) bool {
+	switch v := addr.(type) {
+	case *net.IPAddr:
+		return v.IP.Equal(p.target)
+	case *net.UDPAddr:
+		return v.IP.Equal(p.target)
+	}
+	return false
+}
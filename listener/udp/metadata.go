@@ -53,3 +53,12 @@ func (l *udpListener) parseMetadata(md mdata.Metadata) (err error) {
 
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"backlog",
+	"keepalive",
+	"readBufferSize",
+	"readQueueSize",
+	"ttl",
+}
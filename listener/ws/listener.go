@@ -19,6 +19,7 @@ import (
 	ws_util "github.com/go-gost/x/internal/util/ws"
 	climiter "github.com/go-gost/x/limiter/conn/wrapper"
 	limiter_wrapper "github.com/go-gost/x/limiter/traffic/wrapper"
+	mdx "github.com/go-gost/x/metadata"
 	metrics "github.com/go-gost/x/metrics/wrapper"
 	stats "github.com/go-gost/x/observer/stats/wrapper"
 	"github.com/go-gost/x/registry"
@@ -27,7 +28,9 @@ import (
 
 func init() {
 	registry.ListenerRegistry().Register("ws", NewListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "ws", schema...)
 	registry.ListenerRegistry().Register("wss", NewTLSListener)
+	mdx.RegisterSchema(mdx.SchemaListener, "wss", schema...)
 }
 
 type wsListener struct {
@@ -115,7 +118,7 @@ func (l *wsListener) Init(md md.Metadata) (err error) {
 	ln = climiter.WrapListener(l.options.ConnLimiter, ln)
 
 	if l.tlsEnabled {
-		ln = tls.NewListener(ln, l.options.TLSConfig)
+		ln = tls.NewListener(ln, l.md.revocation.Config(l.options.TLSConfig))
 	}
 
 	l.addr = ln.Addr()
@@ -6,6 +6,7 @@ import (
 
 	mdata "github.com/go-gost/core/metadata"
 	mdutil "github.com/go-gost/core/metadata/util"
+	tls_util "github.com/go-gost/x/internal/util/tls"
 )
 
 const (
@@ -25,6 +26,9 @@ type metadata struct {
 	header            http.Header
 
 	mptcp bool
+
+	// the revocation checking of the client certificates of wss, nil if disabled.
+	revocation *tls_util.RevocationChecker
 }
 
 func (l *wsListener) parseMetadata(md mdata.Metadata) (err error) {
@@ -53,5 +57,38 @@ func (l *wsListener) parseMetadata(md mdata.Metadata) (err error) {
 	}
 
 	l.md.mptcp = mdutil.GetBool(md, "mptcp")
+
+	if l.tlsEnabled {
+		ocspMode, err := tls_util.ParseOCSPMode(mdutil.GetString(md, "tls.clientOCSP"))
+		if err != nil {
+			return err
+		}
+		if l.md.revocation, err = tls_util.NewRevocationChecker(l.options.Service, mdutil.GetStrings(md, "tls.clientCRL"), ocspMode, l.logger); err != nil {
+			return err
+		}
+	}
 	return
 }
+
+// schema is the metadata keys of the listener.
+var schema = []string{
+	"backlog",
+	"enableCompression",
+	"handshakeTimeout",
+	"header",
+	"mptcp",
+	"path",
+	"readBufferSize",
+	"readHeaderTimeout",
+	"tls.clientCRL",
+	"tls.clientOCSP",
+	"writeBufferSize",
+	"ws.backlog",
+	"ws.enableCompression",
+	"ws.handshakeTimeout",
+	"ws.header",
+	"ws.path",
+	"ws.readBufferSize",
+	"ws.readHeaderTimeout",
+	"ws.writeBufferSize",
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/go-gost/core/logger"
 	"github.com/sirupsen/logrus"
@@ -45,6 +46,8 @@ func LevelOption(level logger.LogLevel) Option {
 
 type logrusLogger struct {
 	logger *logrus.Entry
+	// masker masks the client IP in the fields and the messages, see MaskIP.
+	masker *strings.Replacer
 }
 
 func NewLogger(opts ...Option) logger.Logger {
@@ -92,7 +95,8 @@ func NewLogger(opts ...Option) logger.Logger {
 // WithFields adds new fields to log.
 func (l *logrusLogger) WithFields(fields map[string]any) logger.Logger {
 	return &logrusLogger{
-		logger: l.logger.WithFields(logrus.Fields(fields)),
+		logger: l.logger.WithFields(logrus.Fields(maskFields(l.masker, fields))),
+		masker: l.masker,
 	}
 }
 
@@ -172,6 +176,10 @@ func (l *logrusLogger) log(level logrus.Level, args ...any) {
 	if l.logger.Logger.IsLevelEnabled(logrus.DebugLevel) {
 		lg = lg.WithField("caller", l.caller(3))
 	}
+	if l.masker != nil && lg.Logger.IsLevelEnabled(level) {
+		lg.Log(level, l.masker.Replace(fmt.Sprint(args...)))
+		return
+	}
 	lg.Log(level, args...)
 }
 
@@ -180,6 +188,10 @@ func (l *logrusLogger) logf(level logrus.Level, format string, args ...any) {
 	if l.logger.Logger.IsLevelEnabled(logrus.DebugLevel) {
 		lg = lg.WithField("caller", l.caller(3))
 	}
+	if l.masker != nil && lg.Logger.IsLevelEnabled(level) {
+		lg.Log(level, l.masker.Replace(fmt.Sprintf(format, args...)))
+		return
+	}
 	lg.Logf(level, format, args...)
 }
 
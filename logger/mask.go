@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/go-gost/core/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// MaskIP returns the logger which masks the IP of the address addr in the fields and the messages,
+// the last octet of the IPv4 address and the last 80 bits of the IPv6 address are zeroed.
+// The logger is returned as is if addr has no IP.
+func MaskIP(log logger.Logger, addr net.Addr) logger.Logger {
+	host := addr.String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return log
+	}
+	masker := strings.NewReplacer(host, maskIP(ip).String())
+
+	if l, ok := log.(*logrusLogger); ok {
+		data := make(logrus.Fields, len(l.logger.Data))
+		for k, v := range l.logger.Data {
+			data[k] = maskValue(masker, v)
+		}
+		return &logrusLogger{
+			logger: logrus.NewEntry(l.logger.Logger).WithFields(data),
+			masker: masker,
+		}
+	}
+	return &maskLogger{Logger: log, masker: masker}
+}
+
+func maskIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32))
+	}
+	return ip.Mask(net.CIDRMask(48, 128))
+}
+
+func maskValue(masker *strings.Replacer, v any) any {
+	switch vv := v.(type) {
+	case string:
+		return masker.Replace(vv)
+	case fmt.Stringer, error:
+		s := fmt.Sprint(vv)
+		if ms := masker.Replace(s); ms != s {
+			return ms
+		}
+	}
+	return v
+}
+
+func maskFields(masker *strings.Replacer, fields map[string]any) map[string]any {
+	if masker == nil {
+		return fields
+	}
+	m := make(map[string]any, len(fields))
+	for k, v := range fields {
+		m[k] = maskValue(masker, v)
+	}
+	return m
+}
+
+// maskLogger masks the IP for the loggers other than the logrus logger, such as the logger group.
+type maskLogger struct {
+	logger.Logger
+	masker *strings.Replacer
+}
+
+func (l *maskLogger) WithFields(fields map[string]any) logger.Logger {
+	return &maskLogger{
+		Logger: l.Logger.WithFields(maskFields(l.masker, fields)),
+		masker: l.masker,
+	}
+}
+
+func (l *maskLogger) Trace(args ...any) {
+	l.Logger.Trace(l.masker.Replace(fmt.Sprint(args...)))
+}
+
+func (l *maskLogger) Tracef(format string, args ...any) {
+	l.Logger.Trace(l.masker.Replace(fmt.Sprintf(format, args...)))
+}
+
+func (l *maskLogger) Debug(args ...any) {
+	l.Logger.Debug(l.masker.Replace(fmt.Sprint(args...)))
+}
+
+func (l *maskLogger) Debugf(format string, args ...any) {
+	l.Logger.Debug(l.masker.Replace(fmt.Sprintf(format, args...)))
+}
+
+func (l *maskLogger) Info(args ...any) {
+	l.Logger.Info(l.masker.Replace(fmt.Sprint(args...)))
+}
+
+func (l *maskLogger) Infof(format string, args ...any) {
+	l.Logger.Info(l.masker.Replace(fmt.Sprintf(format, args...)))
+}
+
+func (l *maskLogger) Warn(args ...any) {
+	l.Logger.Warn(l.masker.Replace(fmt.Sprint(args...)))
+}
+
+func (l *maskLogger) Warnf(format string, args ...any) {
+	l.Logger.Warn(l.masker.Replace(fmt.Sprintf(format, args...)))
+}
+
+func (l *maskLogger) Error(args ...any) {
+	l.Logger.Error(l.masker.Replace(fmt.Sprint(args...)))
+}
+
+func (l *maskLogger) Errorf(format string, args ...any) {
+	l.Logger.Error(l.masker.Replace(fmt.Sprintf(format, args...)))
+}
+
+func (l *maskLogger) Fatal(args ...any) {
+	l.Logger.Fatal(l.masker.Replace(fmt.Sprint(args...)))
+}
+
+func (l *maskLogger) Fatalf(format string, args ...any) {
+	l.Logger.Fatal(l.masker.Replace(fmt.Sprintf(format, args...)))
+}
@@ -0,0 +1,155 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrUnknownKeys = errors.New("unknown metadata keys")
+)
+
+const (
+	// the max edit distance of the known keys suggested for the unknown key.
+	maxSuggestDistance = 2
+)
+
+const (
+	SchemaHandler  = "handler"
+	SchemaListener = "listener"
+)
+
+// Schema is the metadata keys declared by a component, the keys are matched case-insensitively.
+type Schema []string
+
+var schemas sync.Map
+
+// RegisterSchema declares the metadata keys of the component of the kind (SchemaHandler or SchemaListener) registered as name,
+// it is called by the init of the component along with the registration.
+// The keys set but not declared are unknown to the component (such as the typos), they fail the service in strict mode.
+func RegisterSchema(kind, name string, keys ...string) {
+	schema := Schema(append([]string{}, keys...))
+	RegisterSchemaFunc(kind, name, func() Schema {
+		return schema
+	})
+}
+
+// RegisterSchemaFunc declares the schema of the component resolved by f when it is looked up,
+// such as the schema composed of the schemas of the other components registered later.
+func RegisterSchemaFunc(kind, name string, f func() Schema) {
+	schemas.Store(kind+"/"+name, f)
+}
+
+// GetSchema returns the schema declared by the component, false if it declares none.
+func GetSchema(kind, name string) (Schema, bool) {
+	v, ok := schemas.Load(kind + "/" + name)
+	if !ok {
+		return nil, false
+	}
+	return v.(func() Schema)(), true
+}
+
+// Contains reports whether the key is declared by the schema.
+func (s Schema) Contains(key string) bool {
+	for _, k := range s {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unknown returns the keys set in m not declared by the schema, sorted,
+// each key is followed by the close matches of the schema if any.
+func (s Schema) Unknown(m map[string]any) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var unknown []string
+	for _, k := range keys {
+		if s.Contains(k) {
+			continue
+		}
+		if matches := closeMatches(strings.ToLower(k), s); len(matches) > 0 {
+			k = fmt.Sprintf("%s (did you mean %s?)", k, strings.Join(matches, ", "))
+		}
+		unknown = append(unknown, k)
+	}
+	return unknown
+}
+
+// Validate checks all the keys set in m are declared by the schema,
+// the error lists the unknown keys with the close matches of the schema.
+func (s Schema) Validate(m map[string]any) error {
+	unknown := s.Unknown(m)
+	if len(unknown) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownKeys, strings.Join(unknown, "; "))
+}
+
+// Effective returns the values of the keys of the schema set in m, keyed as declared.
+func (s Schema) Effective(m map[string]any) map[string]any {
+	md := NewMetadata(m)
+	if md == nil {
+		return nil
+	}
+
+	e := make(map[string]any)
+	for _, k := range s {
+		if md.IsExists(k) {
+			e[k] = md.Get(k)
+		}
+	}
+	return e
+}
+
+// closeMatches returns the keys of the schema within the max edit distance of key, the closest first.
+func closeMatches(key string, schema []string) []string {
+	type match struct {
+		key      string
+		distance int
+	}
+	var matches []match
+	for _, k := range schema {
+		if d := editDistance(key, strings.ToLower(k)); d <= maxSuggestDistance {
+			matches = append(matches, match{key: k, distance: d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].distance < matches[j].distance
+	})
+
+	var keys []string
+	for _, m := range matches {
+		keys = append(keys, m.key)
+	}
+	return keys
+}
+
+// editDistance is the Levenshtein distance of a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,71 @@
+package metadata
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	schema := Schema{"observePeriod", "udp.idleTimeout", "maskIP"}
+
+	tests := []struct {
+		name      string
+		md        map[string]any
+		unknown   []string
+		effective map[string]any
+	}{
+		{
+			name:      "declared",
+			md:        map[string]any{"observePeriod": "5s", "MASKIP": true},
+			effective: map[string]any{"observePeriod": "5s", "maskIP": true},
+		},
+		{
+			name:      "typo",
+			md:        map[string]any{"observerPeriod": "5s", "maskIP": true},
+			unknown:   []string{"observerPeriod (did you mean observePeriod?)"},
+			effective: map[string]any{"maskIP": true},
+		},
+		{
+			name:    "unknown",
+			md:      map[string]any{"foo": 1},
+			unknown: []string{"foo"},
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unknown := schema.Unknown(tt.md)
+			if !reflect.DeepEqual(unknown, tt.unknown) {
+				t.Errorf("unknown: got %q, want %q", unknown, tt.unknown)
+			}
+			err := schema.Validate(tt.md)
+			if (len(tt.unknown) > 0) != errors.Is(err, ErrUnknownKeys) {
+				t.Errorf("validate: got %v", err)
+			}
+			if e := schema.Effective(tt.md); len(e) > 0 || len(tt.effective) > 0 {
+				if !reflect.DeepEqual(e, tt.effective) {
+					t.Errorf("effective: got %v, want %v", e, tt.effective)
+				}
+			}
+		})
+	}
+}
+
+func TestGetSchema(t *testing.T) {
+	RegisterSchema(SchemaHandler, "test-schema", "a", "b")
+	RegisterSchemaFunc(SchemaHandler, "test-schema-composed", func() Schema {
+		s, _ := GetSchema(SchemaHandler, "test-schema")
+		return append(s[:len(s):len(s)], "c")
+	})
+
+	if s, ok := GetSchema(SchemaHandler, "test-schema-composed"); !ok || !reflect.DeepEqual(s, Schema{"a", "b", "c"}) {
+		t.Errorf("composed schema: got %v, %v", s, ok)
+	}
+	if _, ok := GetSchema(SchemaListener, "test-schema"); ok {
+		t.Error("the schema of the handler is found for the listener")
+	}
+}
@@ -21,6 +21,50 @@ const (
 	MetricServiceHandlerErrorsCounter metrics.MetricName = "gost_service_handler_errors_total"
 	// Total chain connect errors. Labels: host, chain, node.
 	MetricChainErrorsCounter metrics.MetricName = "gost_chain_errors_total"
+	// Total ingress rule access control matches. Labels: host, rule, action.
+	MetricIngressRuleAccessCounter metrics.MetricName = "gost_ingress_rule_access_total"
+	// Router dial duration histogram. Labels: host, service, outcome.
+	MetricServiceDialDurationObserver metrics.MetricName = "gost_service_dial_duration_seconds"
+	// Protocol handshake duration histogram. Labels: host, service, outcome.
+	MetricServiceHandshakeDurationObserver metrics.MetricName = "gost_service_handshake_duration_seconds"
+	// Total requests dialed by the routing rules of the service. Labels: host, service, route.
+	MetricServiceRouteRequestsCounter metrics.MetricName = "gost_service_route_requests_total"
+	// Total requests matched by the bypass of the service. Labels: host, service, action.
+	MetricServiceBypassCounter metrics.MetricName = "gost_service_bypass_total"
+	// Total relay requests rejected by the request limits or the bind rate of the tunnel. Labels: host, service, reason.
+	MetricRelayRequestsRejectedCounter metrics.MetricName = "gost_relay_requests_rejected_total"
+	// Total circuit breaker events of the service, the event is open, close or reject. Labels: host, service, event.
+	MetricServiceCircuitBreakerCounter metrics.MetricName = "gost_service_circuit_breaker_total"
+	// Total UDP datagrams dropped by the service. Labels: host, service, reason.
+	MetricServiceUDPDroppedCounter metrics.MetricName = "gost_service_udp_dropped_total"
+	// Total events of the upstream connection pool of the service, the event is hit, miss, put or evict. Labels: host, service, event.
+	MetricServiceConnPoolCounter metrics.MetricName = "gost_service_conn_pool_total"
+	// Total connections closed or rejected by the traffic quotas, the quota is conn or daily. Labels: host, service, quota.
+	MetricServiceQuotaExceededCounter metrics.MetricName = "gost_service_quota_exceeded_total"
+	// Total connections closed for the violations of the protocol in the handshake. Labels: host, service, reason.
+	MetricServiceProtocolErrorsCounter metrics.MetricName = "gost_service_protocol_errors_total"
+	// Total packets dropped by the packet filter of the tun service, the direction is in or out. Labels: host, service, direction.
+	MetricServicePacketsFilteredCounter metrics.MetricName = "gost_service_packets_filtered_total"
+	// Total connections closed by the accept rate limit of the listener. Labels: host, service.
+	MetricServiceAcceptThrottledCounter metrics.MetricName = "gost_service_accept_throttled_total"
+	// Total UDP associations closed by the ICMP errors of the target, the reason is port, host or network. Labels: host, service, reason.
+	MetricServiceUDPUnreachableCounter metrics.MetricName = "gost_service_udp_unreachable_total"
+	// Total client certificates rejected by the revocation checking, the reason is crl, ocsp or unavailable. Labels: host, service, reason.
+	MetricServiceTLSRevokedCounter metrics.MetricName = "gost_service_tls_revoked_total"
+	// Total lookups of the DNS cache of the handlers, the result is hit, stale or miss. Labels: host, service, result.
+	MetricServiceDNSCacheCounter metrics.MetricName = "gost_service_dns_cache_total"
+	// Total requests denied by the port policy of the target. Labels: host, service.
+	MetricServicePortDeniedCounter metrics.MetricName = "gost_service_port_denied_total"
+	// Total connections accepted by the listeners. Labels: host, service.
+	MetricServiceListenerAcceptsCounter metrics.MetricName = "gost_service_listener_accepts_total"
+	// Total failed handshakes of the listeners, the reason is tls, ssh, mux or proxyproto. Labels: host, service, reason.
+	MetricServiceListenerHandshakeFailuresCounter metrics.MetricName = "gost_service_listener_handshake_failures_total"
+	// Current connections of the listeners, the state is queued (waiting to be accepted by the service) or served. Labels: host, service, state.
+	MetricServiceListenerConnsGauge metrics.MetricName = "gost_service_listener_conns"
+	// Total connections dropped by the listeners as the accept queue is full. Labels: host, service.
+	MetricServiceListenerQueueDroppedCounter metrics.MetricName = "gost_service_listener_queue_dropped_total"
+	// Total tunnel connections retried on another connector after the stream failed immediately. Labels: host, service.
+	MetricServiceTunnelFailoversCounter metrics.MetricName = "gost_service_tunnel_failovers_total"
 )
 
 var (
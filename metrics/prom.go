@@ -14,7 +14,46 @@ type promMetrics struct {
 	histograms map[metrics.MetricName]*prometheus.HistogramVec
 }
 
-func NewMetrics() metrics.Metrics {
+var (
+	defaultDialBuckets = []float64{
+		.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 15, 30,
+	}
+	defaultHandshakeBuckets = []float64{
+		.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10,
+	}
+)
+
+type options struct {
+	buckets map[metrics.MetricName][]float64
+}
+
+type Option func(opts *options)
+
+// BucketsOption overrides the buckets of the histogram name.
+func BucketsOption(name metrics.MetricName, buckets []float64) Option {
+	return func(opts *options) {
+		if len(buckets) == 0 {
+			return
+		}
+		if opts.buckets == nil {
+			opts.buckets = make(map[metrics.MetricName][]float64)
+		}
+		opts.buckets[name] = buckets
+	}
+}
+
+func NewMetrics(opts ...Option) metrics.Metrics {
+	var options options
+	for _, opt := range opts {
+		opt(&options)
+	}
+	buckets := func(name metrics.MetricName, def []float64) []float64 {
+		if v := options.buckets[name]; len(v) > 0 {
+			return v
+		}
+		return def
+	}
+
 	host, _ := os.Hostname()
 	m := &promMetrics{
 		host: host,
@@ -31,6 +70,12 @@ func NewMetrics() metrics.Metrics {
 					Help: "Current in-flight requests",
 				},
 				[]string{"host", "service", "client"}),
+			MetricServiceListenerConnsGauge: prometheus.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Name: string(MetricServiceListenerConnsGauge),
+					Help: "Current connections of the listeners",
+				},
+				[]string{"host", "service", "state"}),
 		},
 		counters: map[metrics.MetricName]*prometheus.CounterVec{
 			MetricServiceRequestsCounter: prometheus.NewCounterVec(
@@ -63,6 +108,120 @@ func NewMetrics() metrics.Metrics {
 					Help: "Total chain errors",
 				},
 				[]string{"host", "chain", "node"}),
+			MetricIngressRuleAccessCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricIngressRuleAccessCounter),
+					Help: "Total ingress rule access control matches",
+				},
+				[]string{"host", "rule", "action"}),
+			MetricServiceRouteRequestsCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServiceRouteRequestsCounter),
+					Help: "Total requests dialed by the routing rules of the service",
+				},
+				[]string{"host", "service", "route"}),
+			MetricServiceBypassCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServiceBypassCounter),
+					Help: "Total requests matched by the bypass of the service",
+				},
+				[]string{"host", "service", "action"}),
+			MetricRelayRequestsRejectedCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricRelayRequestsRejectedCounter),
+					Help: "Total relay requests rejected by the request limits",
+				},
+				[]string{"host", "service", "reason"}),
+			MetricServiceCircuitBreakerCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServiceCircuitBreakerCounter),
+					Help: "Total circuit breaker events of the service",
+				},
+				[]string{"host", "service", "event"}),
+			MetricServiceUDPDroppedCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServiceUDPDroppedCounter),
+					Help: "Total UDP datagrams dropped by the service",
+				},
+				[]string{"host", "service", "reason"}),
+			MetricServiceConnPoolCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServiceConnPoolCounter),
+					Help: "Total events of the upstream connection pool of the service",
+				},
+				[]string{"host", "service", "event"}),
+			MetricServiceQuotaExceededCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServiceQuotaExceededCounter),
+					Help: "Total connections closed or rejected by the traffic quotas",
+				},
+				[]string{"host", "service", "quota"}),
+			MetricServiceProtocolErrorsCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServiceProtocolErrorsCounter),
+					Help: "Total connections closed for the protocol violations in the handshake",
+				},
+				[]string{"host", "service", "reason"}),
+			MetricServicePacketsFilteredCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServicePacketsFilteredCounter),
+					Help: "Total packets dropped by the packet filter of the tun service",
+				},
+				[]string{"host", "service", "direction"}),
+			MetricServiceAcceptThrottledCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServiceAcceptThrottledCounter),
+					Help: "Total connections closed by the accept rate limit of the listener",
+				},
+				[]string{"host", "service"}),
+			MetricServiceUDPUnreachableCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServiceUDPUnreachableCounter),
+					Help: "Total UDP associations closed by the ICMP errors of the target",
+				},
+				[]string{"host", "service", "reason"}),
+			MetricServiceTLSRevokedCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServiceTLSRevokedCounter),
+					Help: "Total client certificates rejected by the revocation checking",
+				},
+				[]string{"host", "service", "reason"}),
+			MetricServiceDNSCacheCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServiceDNSCacheCounter),
+					Help: "Total lookups of the DNS cache of the handlers",
+				},
+				[]string{"host", "service", "result"}),
+			MetricServicePortDeniedCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServicePortDeniedCounter),
+					Help: "Total requests denied by the port policy of the target",
+				},
+				[]string{"host", "service"}),
+			MetricServiceListenerAcceptsCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServiceListenerAcceptsCounter),
+					Help: "Total connections accepted by the listeners",
+				},
+				[]string{"host", "service"}),
+			MetricServiceListenerHandshakeFailuresCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServiceListenerHandshakeFailuresCounter),
+					Help: "Total failed handshakes of the listeners",
+				},
+				[]string{"host", "service", "reason"}),
+			MetricServiceListenerQueueDroppedCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServiceListenerQueueDroppedCounter),
+					Help: "Total connections dropped by the listeners as the accept queue is full",
+				},
+				[]string{"host", "service"}),
+			MetricServiceTunnelFailoversCounter: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: string(MetricServiceTunnelFailoversCounter),
+					Help: "Total tunnel connections retried on another connector after the stream failed immediately",
+				},
+				[]string{"host", "service"}),
 		},
 		histograms: map[metrics.MetricName]*prometheus.HistogramVec{
 			MetricServiceRequestsDurationObserver: prometheus.NewHistogramVec(
@@ -83,6 +242,20 @@ func NewMetrics() metrics.Metrics {
 					},
 				},
 				[]string{"host", "chain", "node"}),
+			MetricServiceDialDurationObserver: prometheus.NewHistogramVec(
+				prometheus.HistogramOpts{
+					Name:    string(MetricServiceDialDurationObserver),
+					Help:    "Distribution of router dial latencies",
+					Buckets: buckets(MetricServiceDialDurationObserver, defaultDialBuckets),
+				},
+				[]string{"host", "service", "outcome"}),
+			MetricServiceHandshakeDurationObserver: prometheus.NewHistogramVec(
+				prometheus.HistogramOpts{
+					Name:    string(MetricServiceHandshakeDurationObserver),
+					Help:    "Distribution of protocol handshake latencies",
+					Buckets: buckets(MetricServiceHandshakeDurationObserver, defaultHandshakeBuckets),
+				},
+				[]string{"host", "service", "outcome"}),
 		},
 	}
 	for k := range m.gauges {
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/go-gost/core/metrics"
+)
+
+const (
+	OutcomeOK    = "ok"
+	OutcomeError = "error"
+)
+
+// Span measures the duration of an operation of a service, such as dialing or the protocol handshake.
+type Span struct {
+	name    metrics.MetricName
+	service string
+	start   time.Time
+}
+
+// StartSpan starts a span for the histogram name.
+// It returns nil if the metrics are disabled, and the methods of the nil Span are no-ops.
+func StartSpan(name metrics.MetricName, service string) *Span {
+	if !IsEnabled() {
+		return nil
+	}
+	return &Span{
+		name:    name,
+		service: service,
+		start:   time.Now(),
+	}
+}
+
+// End records the duration of the span labeled with the outcome derived from err.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	outcome := OutcomeOK
+	if err != nil {
+		outcome = OutcomeError
+	}
+	if v := GetObserver(s.name, metrics.Labels{
+		"service": s.service,
+		"outcome": outcome,
+	}); v != nil {
+		v.Observe(time.Since(s.start).Seconds())
+	}
+}
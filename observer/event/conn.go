@@ -0,0 +1,331 @@
+package event
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-gost/core/observer"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// EventConn is the type of the connection lifecycle events.
+	EventConn observer.EventType = "conn"
+
+	// the events queued to the observer, the events beyond it are dropped.
+	connEventQueueSize = 1024
+	// the max number of the events observed at once.
+	connEventBatchSize = 128
+)
+
+type ConnAction string
+
+const (
+	ConnOpened        ConnAction = "opened"
+	ConnAuthenticated ConnAction = "authenticated"
+	ConnDenied        ConnAction = "denied"
+	ConnClosed        ConnAction = "closed"
+)
+
+// ConnEvent is emitted by the handlers at the lifecycle moments of a connection.
+type ConnEvent struct {
+	Kind    string
+	Service string
+	Action  ConnAction
+	// Seq is the sequence number of the events of the service, it increases by one for each event emitted,
+	// so a gap means the events are lost.
+	Seq    uint64
+	Conn   string
+	Src    string
+	Dst    string
+	Client string
+	// Reason is the reason of the denied connection.
+	Reason string
+	// InputBytes and OutputBytes are the bytes read from and written to the client, set for the closed connection.
+	InputBytes  uint64
+	OutputBytes uint64
+	Duration    time.Duration
+	Error       string
+	Time        time.Time
+}
+
+func (ConnEvent) Type() observer.EventType {
+	return EventConn
+}
+
+type ConnEmitterOptions struct {
+	// Sample is the ratio of the connections with the events emitted, in (0, 1], all the connections if not set.
+	Sample float64
+	// Rate is the max number of the connections with the events emitted per second, no limit if not set.
+	Rate int
+}
+
+// ConnEmitter emits the connection lifecycle events of a service through the observer asynchronously.
+// The connections are sampled when opened, all or none of the events of a connection are emitted,
+// so only the events dropped by the full queue leave the gaps in the sequence numbers.
+type ConnEmitter struct {
+	observer observer.Observer
+	service  string
+	sample   float64
+	limiter  *rate.Limiter
+	id       atomic.Uint64
+	events   chan observer.Event
+	closed   chan struct{}
+	once     sync.Once
+	// mu serializes the sequence numbers and the queueing, so the events are queued in order.
+	mu  sync.Mutex
+	seq uint64
+	r   *rand.Rand
+}
+
+// NewConnEmitter creates a ConnEmitter, nil is returned if the observer is not set,
+// and the nil ConnEmitter emits nothing.
+func NewConnEmitter(obs observer.Observer, service string, opts ConnEmitterOptions) *ConnEmitter {
+	if obs == nil {
+		return nil
+	}
+
+	e := &ConnEmitter{
+		observer: obs,
+		service:  service,
+		sample:   opts.Sample,
+		events:   make(chan observer.Event, connEventQueueSize),
+		closed:   make(chan struct{}),
+		r:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if e.sample <= 0 || e.sample > 1 {
+		e.sample = 1
+	}
+	if opts.Rate > 0 {
+		e.limiter = rate.NewLimiter(rate.Limit(opts.Rate), opts.Rate)
+	}
+	go e.run()
+
+	return e
+}
+
+// Trace starts the trace of the connection from src,
+// the returned trace is nil if the connection is not sampled.
+func (e *ConnEmitter) Trace(src string) *ConnTrace {
+	if e == nil {
+		return nil
+	}
+
+	if e.sample < 1 {
+		e.mu.Lock()
+		sampled := e.r.Float64() < e.sample
+		e.mu.Unlock()
+		if !sampled {
+			return nil
+		}
+	}
+	if e.limiter != nil && !e.limiter.Allow() {
+		return nil
+	}
+
+	return &ConnTrace{
+		e:     e,
+		id:    strconv.FormatUint(e.id.Add(1), 10),
+		src:   src,
+		start: time.Now(),
+	}
+}
+
+// Close stops the emitter, the queued events are discarded.
+func (e *ConnEmitter) Close() error {
+	if e == nil {
+		return nil
+	}
+	e.once.Do(func() {
+		close(e.closed)
+	})
+	return nil
+}
+
+func (e *ConnEmitter) emit(ev ConnEvent) {
+	ev.Kind = "service"
+	ev.Service = e.service
+	ev.Time = time.Now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.seq++
+	ev.Seq = e.seq
+	select {
+	case e.events <- ev:
+	default:
+	}
+}
+
+func (e *ConnEmitter) run() {
+	for {
+		select {
+		case ev := <-e.events:
+			events := []observer.Event{ev}
+		batch:
+			for len(events) < connEventBatchSize {
+				select {
+				case ev := <-e.events:
+					events = append(events, ev)
+				default:
+					break batch
+				}
+			}
+			e.observer.Observe(context.Background(), events)
+		case <-e.closed:
+			return
+		}
+	}
+}
+
+type connTraceKey struct{}
+
+// ContextWithConnTrace returns the context carrying the trace,
+// so the events can be emitted in the deeper handling of the connection.
+func ContextWithConnTrace(ctx context.Context, t *ConnTrace) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, connTraceKey{}, t)
+}
+
+// ConnTraceFromContext returns the trace carried by the context, it is nil if there is no trace.
+func ConnTraceFromContext(ctx context.Context) *ConnTrace {
+	v, _ := ctx.Value(connTraceKey{}).(*ConnTrace)
+	return v
+}
+
+// ConnTrace emits the events of a connection, the nil ConnTrace emits nothing.
+type ConnTrace struct {
+	e      *ConnEmitter
+	id     string
+	src    string
+	dst    string
+	client string
+	start  time.Time
+	opened atomic.Bool
+	closed atomic.Bool
+	input  atomic.Uint64
+	output atomic.Uint64
+}
+
+func (t *ConnTrace) event(action ConnAction) ConnEvent {
+	return ConnEvent{
+		Action: action,
+		Conn:   t.id,
+		Src:    t.src,
+		Dst:    t.dst,
+		Client: t.client,
+	}
+}
+
+// Authenticated emits the event of the client authenticated.
+func (t *ConnTrace) Authenticated(client string) {
+	if t == nil || client == "" {
+		return
+	}
+	t.client = client
+	t.e.emit(t.event(ConnAuthenticated))
+}
+
+// Opened emits the event of the connection to dst, only the first one is emitted.
+func (t *ConnTrace) Opened(dst string) {
+	if t == nil || !t.opened.CompareAndSwap(false, true) {
+		return
+	}
+	t.dst = dst
+	t.e.emit(t.event(ConnOpened))
+}
+
+// Denied emits the event of the connection denied for the reason.
+func (t *ConnTrace) Denied(reason string) {
+	if t == nil {
+		return
+	}
+	ev := t.event(ConnDenied)
+	ev.Reason = reason
+	t.e.emit(ev)
+}
+
+// Closed emits the event of the connection closed with the error, only the first one is emitted.
+func (t *ConnTrace) Closed(err error) {
+	if t == nil || !t.closed.CompareAndSwap(false, true) {
+		return
+	}
+	ev := t.event(ConnClosed)
+	ev.InputBytes = t.input.Load()
+	ev.OutputBytes = t.output.Load()
+	ev.Duration = time.Since(t.start)
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	t.e.emit(ev)
+}
+
+// WrapConn counts the bytes of the client connection for the closed event.
+func (t *ConnTrace) WrapConn(c net.Conn) net.Conn {
+	if t == nil {
+		return c
+	}
+	return &traceConn{Conn: c, input: &t.input, output: &t.output}
+}
+
+// WrapReadWriter counts the bytes of the client side rw for the closed event.
+func (t *ConnTrace) WrapReadWriter(rw io.ReadWriter) io.ReadWriter {
+	if t == nil {
+		return rw
+	}
+	return &traceReadWriter{ReadWriter: rw, input: &t.input, output: &t.output}
+}
+
+// WrapUpstream counts the bytes of the upstream side rw for the closed event,
+// the bytes written to the upstream are the input of the client.
+func (t *ConnTrace) WrapUpstream(rw io.ReadWriter) io.ReadWriter {
+	if t == nil {
+		return rw
+	}
+	return &traceReadWriter{ReadWriter: rw, input: &t.output, output: &t.input}
+}
+
+type traceReadWriter struct {
+	io.ReadWriter
+	input  *atomic.Uint64
+	output *atomic.Uint64
+}
+
+func (rw *traceReadWriter) Read(p []byte) (n int, err error) {
+	n, err = rw.ReadWriter.Read(p)
+	rw.input.Add(uint64(n))
+	return
+}
+
+func (rw *traceReadWriter) Write(p []byte) (n int, err error) {
+	n, err = rw.ReadWriter.Write(p)
+	rw.output.Add(uint64(n))
+	return
+}
+
+type traceConn struct {
+	net.Conn
+	input  *atomic.Uint64
+	output *atomic.Uint64
+}
+
+func (c *traceConn) Read(p []byte) (n int, err error) {
+	n, err = c.Conn.Read(p)
+	c.input.Add(uint64(n))
+	return
+}
+
+func (c *traceConn) Write(p []byte) (n int, err error) {
+	n, err = c.Conn.Write(p)
+	c.output.Add(uint64(n))
+	return
+}
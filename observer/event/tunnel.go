@@ -0,0 +1,44 @@
+package event
+
+import (
+	"time"
+
+	"github.com/go-gost/core/observer"
+	"github.com/go-gost/x/internal/util/mux"
+)
+
+const (
+	// EventTunnel is the type of the tunnel lifecycle events.
+	EventTunnel observer.EventType = "tunnel"
+)
+
+type TunnelAction string
+
+const (
+	TunnelCreated    TunnelAction = "created"
+	TunnelRemoved    TunnelAction = "removed"
+	ConnectorAdded   TunnelAction = "connectorAdded"
+	ConnectorEvicted TunnelAction = "connectorEvicted"
+	// ConnectorFailover is emitted when a connection is retried on another connector,
+	// as the stream of the connector failed immediately.
+	ConnectorFailover TunnelAction = "connectorFailover"
+)
+
+// TunnelEvent is emitted by the tunnel handler when a tunnel or connector is registered or deregistered.
+type TunnelEvent struct {
+	Kind      string
+	Service   string
+	Action    TunnelAction
+	Tunnel    string
+	Connector string
+	Node      string
+	Time      time.Time
+	// Session is the parameters of the mux session of the connector, it is nil for the tunnel events.
+	Session *mux.SessionInfo
+	// Failovers is the number of the failovers of the tunnel, it is set for the failover events.
+	Failovers uint64
+}
+
+func (TunnelEvent) Type() observer.EventType {
+	return EventTunnel
+}
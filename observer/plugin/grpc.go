@@ -2,6 +2,8 @@ package observer
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 
 	"github.com/go-gost/core/logger"
@@ -9,6 +11,7 @@ import (
 	"github.com/go-gost/core/observer/stats"
 	"github.com/go-gost/plugin/observer/proto"
 	"github.com/go-gost/x/internal/plugin"
+	xevent "github.com/go-gost/x/observer/event"
 	"github.com/go-gost/x/service"
 	"google.golang.org/grpc"
 )
@@ -81,6 +84,32 @@ func (p *grpcPlugin) Observe(ctx context.Context, events []observer.Event, opts
 					TotalErrs:    ev.TotalErrs,
 				},
 			})
+		case xevent.EventTunnel:
+			// the tunnel events are carried as status, as the protocol has no dedicated field.
+			ev := event.(xevent.TunnelEvent)
+			req.Events = append(req.Events, &proto.Event{
+				Kind:    ev.Kind,
+				Service: ev.Service,
+				Type:    string(event.Type()),
+				Status: &proto.ServiceStatus{
+					State: string(ev.Action),
+					Msg:   fmt.Sprintf("tunnel=%s connector=%s node=%s time=%d", ev.Tunnel, ev.Connector, ev.Node, ev.Time.Unix()),
+				},
+			})
+		case xevent.EventConn:
+			// the connection events are carried as status in JSON.
+			ev := event.(xevent.ConnEvent)
+			msg, _ := json.Marshal(newConnEvent(ev))
+			req.Events = append(req.Events, &proto.Event{
+				Kind:    ev.Kind,
+				Service: ev.Service,
+				Client:  ev.Client,
+				Type:    string(event.Type()),
+				Status: &proto.ServiceStatus{
+					State: string(ev.Action),
+					Msg:   string(msg),
+				},
+			})
 		}
 	}
 	_, err := p.client.Observe(ctx, &req)
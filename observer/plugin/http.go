@@ -12,6 +12,7 @@ import (
 	"github.com/go-gost/core/observer"
 	"github.com/go-gost/core/observer/stats"
 	"github.com/go-gost/x/internal/plugin"
+	xevent "github.com/go-gost/x/observer/event"
 	"github.com/go-gost/x/service"
 )
 
@@ -26,6 +27,8 @@ type event struct {
 	Type    observer.EventType `json:"type"`
 	Stats   *statsEvent        `json:"stats,omitempty"`
 	Status  *statusEvent       `json:"status,omitempty"`
+	Tunnel  *tunnelEvent       `json:"tunnel,omitempty"`
+	Conn    *connEvent         `json:"conn,omitempty"`
 }
 
 type statsEvent struct {
@@ -41,6 +44,47 @@ type statusEvent struct {
 	Msg   string `json:"msg"`
 }
 
+type tunnelEvent struct {
+	Action    string `json:"action"`
+	Tunnel    string `json:"tunnel"`
+	Connector string `json:"connector,omitempty"`
+	Node      string `json:"node,omitempty"`
+	Time      int64  `json:"time"`
+}
+
+type connEvent struct {
+	Action      string `json:"action"`
+	Seq         uint64 `json:"seq"`
+	Conn        string `json:"conn"`
+	Src         string `json:"src,omitempty"`
+	Dst         string `json:"dst,omitempty"`
+	Client      string `json:"client,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	InputBytes  uint64 `json:"inputBytes,omitempty"`
+	OutputBytes uint64 `json:"outputBytes,omitempty"`
+	// Duration is the duration of the connection in milliseconds.
+	Duration int64  `json:"duration,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Time     int64  `json:"time"`
+}
+
+func newConnEvent(ev xevent.ConnEvent) *connEvent {
+	return &connEvent{
+		Action:      string(ev.Action),
+		Seq:         ev.Seq,
+		Conn:        ev.Conn,
+		Src:         ev.Src,
+		Dst:         ev.Dst,
+		Client:      ev.Client,
+		Reason:      ev.Reason,
+		InputBytes:  ev.InputBytes,
+		OutputBytes: ev.OutputBytes,
+		Duration:    ev.Duration.Milliseconds(),
+		Error:       ev.Error,
+		Time:        ev.Time.UnixMilli(),
+	}
+}
+
 type observeResponse struct {
 	OK bool `json:"ok"`
 }
@@ -108,6 +152,29 @@ func (p *httpPlugin) Observe(ctx context.Context, events []observer.Event, opts
 					TotalErrs:    ev.TotalErrs,
 				},
 			})
+		case xevent.EventTunnel:
+			ev := e.(xevent.TunnelEvent)
+			r.Events = append(r.Events, event{
+				Kind:    ev.Kind,
+				Service: ev.Service,
+				Type:    ev.Type(),
+				Tunnel: &tunnelEvent{
+					Action:    string(ev.Action),
+					Tunnel:    ev.Tunnel,
+					Connector: ev.Connector,
+					Node:      ev.Node,
+					Time:      ev.Time.Unix(),
+				},
+			})
+		case xevent.EventConn:
+			ev := e.(xevent.ConnEvent)
+			r.Events = append(r.Events, event{
+				Kind:    ev.Kind,
+				Service: ev.Service,
+				Client:  ev.Client,
+				Type:    ev.Type(),
+				Conn:    newConnEvent(ev),
+			})
 		}
 	}
 	v, err := json.Marshal(r)
@@ -0,0 +1,113 @@
+package wrapper
+
+import (
+	"github.com/go-gost/core/metrics"
+	"github.com/go-gost/x/internal/net/proxyproto"
+	xmetrics "github.com/go-gost/x/metrics"
+)
+
+// HandshakeReason is the handshake of the listener failed on the accepted connection.
+type HandshakeReason int
+
+const (
+	HandshakeTLS HandshakeReason = iota
+	HandshakeSSH
+	HandshakeMux
+	HandshakeProxyProto
+	numHandshakeReasons
+)
+
+var handshakeReasons = [numHandshakeReasons]string{
+	HandshakeTLS:        "tls",
+	HandshakeSSH:        "ssh",
+	HandshakeMux:        "mux",
+	HandshakeProxyProto: "proxyproto",
+}
+
+func (r HandshakeReason) String() string {
+	if r < 0 || r >= numHandshakeReasons {
+		return "unknown"
+	}
+	return handshakeReasons[r]
+}
+
+// ListenerStats counts the connections accepted by a listener, the failed handshakes of them
+// and the connections dropped as the accept queue is full, and gauges the depth of the accept queue
+// (the connections queued to be accepted by the service) and the connections being served by the listener.
+// The counters and the gauges are resolved once when it is created, so no labels are allocated per connection.
+type ListenerStats struct {
+	accepts  metrics.Counter
+	failures [numHandshakeReasons]metrics.Counter
+	dropped  metrics.Counter
+	queued   metrics.Gauge
+	served   metrics.Gauge
+}
+
+// NewListenerStats creates the stats of the listener of the service,
+// nil is returned if the metrics are disabled, and the nil ListenerStats counts nothing.
+func NewListenerStats(service string) *ListenerStats {
+	if !xmetrics.IsEnabled() {
+		return nil
+	}
+
+	s := &ListenerStats{
+		accepts: xmetrics.GetCounter(xmetrics.MetricServiceListenerAcceptsCounter,
+			metrics.Labels{"service": service}),
+		dropped: xmetrics.GetCounter(xmetrics.MetricServiceListenerQueueDroppedCounter,
+			metrics.Labels{"service": service}),
+		queued: xmetrics.GetGauge(xmetrics.MetricServiceListenerConnsGauge,
+			metrics.Labels{"service": service, "state": "queued"}),
+		served: xmetrics.GetGauge(xmetrics.MetricServiceListenerConnsGauge,
+			metrics.Labels{"service": service, "state": "served"}),
+	}
+	for i := range s.failures {
+		s.failures[i] = xmetrics.GetCounter(xmetrics.MetricServiceListenerHandshakeFailuresCounter,
+			metrics.Labels{"service": service, "reason": HandshakeReason(i).String()})
+	}
+	return s
+}
+
+// Accepted counts a connection accepted by the listener.
+func (s *ListenerStats) Accepted() {
+	if s != nil && s.accepts != nil {
+		s.accepts.Inc()
+	}
+}
+
+// HandshakeFailed counts a failed handshake of the listener,
+// it is counted as proxyproto if err is caused by the PROXY protocol header read ahead of the handshake.
+func (s *ListenerStats) HandshakeFailed(reason HandshakeReason, err error) {
+	if s == nil {
+		return
+	}
+	if proxyproto.IsHeaderError(err) {
+		reason = HandshakeProxyProto
+	}
+	if reason < 0 || reason >= numHandshakeReasons {
+		return
+	}
+	if c := s.failures[reason]; c != nil {
+		c.Inc()
+	}
+}
+
+// Dropped counts a connection dropped as the accept queue is full.
+func (s *ListenerStats) Dropped() {
+	if s != nil && s.dropped != nil {
+		s.dropped.Inc()
+	}
+}
+
+// Queued adds delta to the connections queued to be accepted by the service.
+func (s *ListenerStats) Queued(delta int) {
+	if s != nil && s.queued != nil {
+		s.queued.Add(float64(delta))
+	}
+}
+
+// Served adds delta to the connections being served by the listener.
+func (s *ListenerStats) Served(delta int) {
+	if s != nil && s.served != nil {
+		s.served.Add(float64(delta))
+	}
+}
@@ -0,0 +1,50 @@
+// Package privilege drops the privileges of the process once the services are initialized.
+//
+// The privileged operations, such as binding the low ports and creating the tun devices,
+// are performed by the listeners in Init, so Drop should be called after all the listeners finish Init
+// and before the services are served. The operations performed later with the privileges dropped fail,
+// including the services created by the web API, and the tun devices recreated by the tun listener
+// (e.g. by the probe failures) which require CAP_NET_ADMIN to be retained for the user, such as by the ambient capabilities.
+// The ICMP socket of the tun probe is opened in Init as well, so the probing keeps working without the privileges.
+//
+// Nothing in this module calls Drop, the program running the services (e.g. gost) calls it
+// with the options of the privilege section of the config:
+//
+//	// parse and Init all the services, then
+//	if err := privilege.Drop(parsing_privilege.ParsePrivilege(cfg.Privilege)); err != nil {
+//		log.Fatal(err)
+//	}
+//	// serve the services
+package privilege
+
+import (
+	"errors"
+)
+
+var (
+	ErrNotSupported = errors.New("privilege: not supported on this platform")
+)
+
+type Options struct {
+	// User is the name or the uid of the user the process switches to, the user is not changed if empty.
+	User string
+	// Group is the name or the gid of the group the process switches to,
+	// the primary group of the User is used if empty.
+	Group string
+	// NoNewPrivs sets the no_new_privs bit, so the privileges can not be regained by executing the setuid binaries.
+	NoNewPrivs bool
+	// Seccomp applies the minimal seccomp profile denying the syscalls the proxy never needs,
+	// such as ptrace, mount and the kernel module loading, it implies NoNewPrivs.
+	// The profile does not deny landlock, so a landlock ruleset can be applied on top of it.
+	Seccomp bool
+}
+
+// Drop drops the privileges of the process by the options, the nil options drop nothing.
+// The error is returned if any of the privileges can not be dropped, the startup should fail on it
+// rather than serving with the privileges retained.
+func Drop(opts *Options) error {
+	if opts == nil || (opts.User == "" && opts.Group == "" && !opts.NoNewPrivs && !opts.Seccomp) {
+		return nil
+	}
+	return drop(opts)
+}
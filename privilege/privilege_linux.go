@@ -0,0 +1,97 @@
+package privilege
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func drop(opts *Options) error {
+	if opts.User != "" || opts.Group != "" {
+		uid, gid, err := lookup(opts.User, opts.Group)
+		if err != nil {
+			return err
+		}
+		if err := setid(uid, gid); err != nil {
+			return err
+		}
+	}
+
+	if opts.NoNewPrivs || opts.Seccomp {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("privilege: set no_new_privs: %w", err)
+		}
+	}
+	if opts.Seccomp {
+		if err := applySeccomp(); err != nil {
+			return fmt.Errorf("privilege: seccomp: %w", err)
+		}
+	}
+	return nil
+}
+
+// lookup resolves the user and the group, -1 is returned for the one not changed.
+func lookup(username, groupname string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+
+	if username != "" {
+		u, err := user.Lookup(username)
+		if err != nil {
+			if u, err = user.LookupId(username); err != nil {
+				return -1, -1, fmt.Errorf("privilege: user %s: %w", username, err)
+			}
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return -1, -1, fmt.Errorf("privilege: user %s: %w", username, err)
+		}
+		if groupname == "" {
+			if gid, err = strconv.Atoi(u.Gid); err != nil {
+				return -1, -1, fmt.Errorf("privilege: user %s: %w", username, err)
+			}
+		}
+	}
+
+	if groupname != "" {
+		g, err := user.LookupGroup(groupname)
+		if err != nil {
+			if g, err = user.LookupGroupId(groupname); err != nil {
+				return -1, -1, fmt.Errorf("privilege: group %s: %w", groupname, err)
+			}
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return -1, -1, fmt.Errorf("privilege: group %s: %w", groupname, err)
+		}
+	}
+	return
+}
+
+// setid switches the group and then the user, as the group can not be changed once the user is not root.
+// The syscall package applies them to all the threads of the process.
+func setid(uid, gid int) error {
+	if gid >= 0 {
+		if err := syscall.Setgroups([]int{gid}); err != nil {
+			return fmt.Errorf("privilege: setgroups %d: %w", gid, err)
+		}
+		if err := syscall.Setgid(gid); err != nil {
+			return fmt.Errorf("privilege: setgid %d: %w", gid, err)
+		}
+	}
+	if uid >= 0 {
+		if err := syscall.Setuid(uid); err != nil {
+			return fmt.Errorf("privilege: setuid %d: %w", uid, err)
+		}
+		// make sure the root can not be regained.
+		if uid != 0 && syscall.Setuid(0) == nil {
+			return fmt.Errorf("privilege: setuid %d: root is regained", uid)
+		}
+	}
+
+	if (uid >= 0 && os.Geteuid() != uid) || (gid >= 0 && os.Getegid() != gid) {
+		return fmt.Errorf("privilege: uid %d gid %d not in effect", os.Geteuid(), os.Getegid())
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package privilege
+
+func drop(opts *Options) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,103 @@
+package privilege
+
+import (
+	"errors"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// the syscalls of the x32 ABI have this bit set, they are denied as they bypass the syscall numbers of amd64.
+	x32SyscallBit = 0x40000000
+	// the offsets of the fields of struct seccomp_data.
+	seccompDataNR   = 0
+	seccompDataArch = 4
+)
+
+var auditArches = map[string]uint32{
+	"386":     unix.AUDIT_ARCH_I386,
+	"amd64":   unix.AUDIT_ARCH_X86_64,
+	"arm":     unix.AUDIT_ARCH_ARM,
+	"arm64":   unix.AUDIT_ARCH_AARCH64,
+	"riscv64": unix.AUDIT_ARCH_RISCV64,
+	"s390x":   unix.AUDIT_ARCH_S390X,
+	"ppc64le": unix.AUDIT_ARCH_PPC64LE,
+}
+
+// deniedSyscalls are the syscalls a proxy never needs, they fail with EPERM.
+// setns is not denied, as the listeners and the dialers switch the network namespaces.
+var deniedSyscalls = []uint32{
+	unix.SYS_PTRACE,
+	unix.SYS_PROCESS_VM_READV,
+	unix.SYS_PROCESS_VM_WRITEV,
+	unix.SYS_MOUNT,
+	unix.SYS_UMOUNT2,
+	unix.SYS_PIVOT_ROOT,
+	unix.SYS_CHROOT,
+	unix.SYS_SWAPON,
+	unix.SYS_SWAPOFF,
+	unix.SYS_REBOOT,
+	unix.SYS_KEXEC_LOAD,
+	unix.SYS_INIT_MODULE,
+	unix.SYS_FINIT_MODULE,
+	unix.SYS_DELETE_MODULE,
+	unix.SYS_ACCT,
+	unix.SYS_SETTIMEOFDAY,
+	unix.SYS_CLOCK_SETTIME,
+	unix.SYS_ADJTIMEX,
+	unix.SYS_BPF,
+	unix.SYS_PERF_EVENT_OPEN,
+	unix.SYS_KEYCTL,
+	unix.SYS_ADD_KEY,
+	unix.SYS_REQUEST_KEY,
+}
+
+// applySeccomp applies the filter denying deniedSyscalls to all the threads of the process,
+// no_new_privs must be set before.
+func applySeccomp() error {
+	arch, ok := auditArches[runtime.GOARCH]
+	if !ok {
+		return errors.New("unsupported architecture " + runtime.GOARCH)
+	}
+
+	filter := []unix.SockFilter{
+		// the syscalls of the other architectures (e.g. the 32-bit syscalls on amd64) are denied.
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompDataArch),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, arch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ERRNO|uint32(unix.EPERM)),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompDataNR),
+	}
+	// each check jumps over the checks after it and the allow to the deny.
+	n := len(deniedSyscalls)
+	if runtime.GOARCH == "amd64" {
+		filter = append(filter, jump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, x32SyscallBit, uint8(n+1), 0))
+	}
+	for i, nr := range deniedSyscalls {
+		filter = append(filter, jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, nr, uint8(n-i), 0))
+	}
+	filter = append(filter,
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ERRNO|uint32(unix.EPERM)),
+	)
+
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	// TSYNC applies the filter to all the threads, as the goroutines run on any of them.
+	if _, _, errno := unix.Syscall(unix.SYS_SECCOMP,
+		unix.SECCOMP_SET_MODE_FILTER, unix.SECCOMP_FILTER_FLAG_TSYNC, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func stmt(code uint16, k uint32) unix.SockFilter {
+	return unix.SockFilter{Code: code, K: k}
+}
+
+func jump(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
@@ -3,4 +3,6 @@ package recorder
 const (
 	RecorderServiceHandlerSerial = "recorder.service.handler.serial"
 	RecorderServiceHandlerTunnel = "recorder.service.handler.tunnel"
+	// the billing records of the connections, see the billing.Record.
+	RecorderServiceHandlerBilling = "recorder.service.handler.billing"
 )
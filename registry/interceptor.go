@@ -0,0 +1,47 @@
+package registry
+
+import (
+	"context"
+
+	"github.com/go-gost/x/interceptor"
+)
+
+type interceptorRegistry struct {
+	registry[interceptor.Interceptor]
+}
+
+func (r *interceptorRegistry) Register(name string, v interceptor.Interceptor) error {
+	return r.registry.Register(name, v)
+}
+
+func (r *interceptorRegistry) Get(name string) interceptor.Interceptor {
+	if name != "" {
+		return &interceptorWrapper{name: name, r: r}
+	}
+	return nil
+}
+
+func (r *interceptorRegistry) get(name string) interceptor.Interceptor {
+	return r.registry.Get(name)
+}
+
+type interceptorWrapper struct {
+	name string
+	r    *interceptorRegistry
+}
+
+func (w *interceptorWrapper) Before(ctx context.Context, req *interceptor.Request) error {
+	v := w.r.get(w.name)
+	if v == nil {
+		return nil
+	}
+	return v.Before(ctx, req)
+}
+
+func (w *interceptorWrapper) After(ctx context.Context, req *interceptor.Request, err error) {
+	v := w.r.get(w.name)
+	if v == nil {
+		return
+	}
+	v.After(ctx, req, err)
+}
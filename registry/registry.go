@@ -23,6 +23,7 @@ import (
 	"github.com/go-gost/core/router"
 	"github.com/go-gost/core/sd"
 	"github.com/go-gost/core/service"
+	"github.com/go-gost/x/interceptor"
 )
 
 var (
@@ -54,6 +55,8 @@ var (
 	observerReg reg.Registry[observer.Observer] = new(observerRegistry)
 
 	loggerReg reg.Registry[logger.Logger] = new(loggerRegistry)
+
+	interceptorReg reg.Registry[interceptor.Interceptor] = new(interceptorRegistry)
 )
 
 type registry[T any] struct {
@@ -188,3 +191,7 @@ func ObserverRegistry() reg.Registry[observer.Observer] {
 func LoggerRegistry() reg.Registry[logger.Logger] {
 	return loggerReg
 }
+
+func InterceptorRegistry() reg.Registry[interceptor.Interceptor] {
+	return interceptorReg
+}
@@ -3,8 +3,10 @@ package registry
 import (
 	"context"
 	"net"
+	"time"
 
 	"github.com/go-gost/core/resolver"
+	resolver_util "github.com/go-gost/x/internal/util/resolver"
 )
 
 type resolverRegistry struct {
@@ -38,3 +40,15 @@ func (w *resolverWrapper) Resolve(ctx context.Context, network, host string, opt
 	}
 	return r.Resolve(ctx, network, host, opts...)
 }
+
+func (w *resolverWrapper) ResolveTTL(ctx context.Context, network, host string) ([]net.IP, time.Duration, error) {
+	r := w.r.get(w.name)
+	if r == nil {
+		return nil, 0, resolver.ErrInvalid
+	}
+	if v, ok := r.(resolver_util.TTLResolver); ok {
+		return v.ResolveTTL(ctx, network, host)
+	}
+	ips, err := r.Resolve(ctx, network, host)
+	return ips, 0, err
+}
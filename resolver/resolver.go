@@ -105,8 +105,14 @@ func NewResolver(nameservers []NameServer, opts ...Option) (resolver.Resolver, e
 }
 
 func (r *localResolver) Resolve(ctx context.Context, network, host string, opts ...resolver.Option) (ips []net.IP, err error) {
+	ips, _, err = r.ResolveTTL(ctx, network, host)
+	return
+}
+
+// ResolveTTL implements resolver_util.TTLResolver, the TTL is the remaining one of the records, 0 for the IP address.
+func (r *localResolver) ResolveTTL(ctx context.Context, network, host string) (ips []net.IP, ttl time.Duration, err error) {
 	if ip := net.ParseIP(host); ip != nil {
-		return []net.IP{ip}, nil
+		return []net.IP{ip}, 0, nil
 	}
 
 	if r.options.domain != "" &&
@@ -116,9 +122,9 @@ func (r *localResolver) Resolve(ctx context.Context, network, host string, opts
 
 	for _, server := range r.servers {
 		if server.Async {
-			ips, err = r.resolveAsync(ctx, &server, host)
+			ips, ttl, err = r.resolveAsync(ctx, &server, host)
 		} else {
-			ips, err = r.resolve(ctx, &server, host)
+			ips, ttl, err = r.resolve(ctx, &server, host)
 		}
 		if err != nil {
 			r.options.logger.Error(err)
@@ -135,25 +141,25 @@ func (r *localResolver) Resolve(ctx context.Context, network, host string, opts
 	return
 }
 
-func (r *localResolver) resolve(ctx context.Context, server *NameServer, host string) (ips []net.IP, err error) {
+func (r *localResolver) resolve(ctx context.Context, server *NameServer, host string) (ips []net.IP, ttl time.Duration, err error) {
 	if server == nil {
 		return
 	}
 
 	if server.Prefer == "ipv6" { // prefer ipv6
-		if ips, err = r.resolve6(ctx, server, host); len(ips) > 0 || server.Only == "ipv6" {
+		if ips, ttl, err = r.resolve6(ctx, server, host); len(ips) > 0 || server.Only == "ipv6" {
 			return
 		}
 		return r.resolve4(ctx, server, host)
 	}
 
-	if ips, err = r.resolve4(ctx, server, host); len(ips) > 0 || server.Only == "ipv4" {
+	if ips, ttl, err = r.resolve4(ctx, server, host); len(ips) > 0 || server.Only == "ipv4" {
 		return
 	}
 	return r.resolve6(ctx, server, host)
 }
 
-func (r *localResolver) resolveAsync(ctx context.Context, server *NameServer, host string) (ips []net.IP, err error) {
+func (r *localResolver) resolveAsync(ctx context.Context, server *NameServer, host string) (ips []net.IP, ttl time.Duration, err error) {
 	ips, ttl, ok := r.lookupCache(ctx, server, host)
 	if !ok {
 		return r.resolve(ctx, server, host)
@@ -162,6 +168,8 @@ func (r *localResolver) resolveAsync(ctx context.Context, server *NameServer, ho
 	if ttl <= 0 {
 		r.options.logger.Debugf("async resolve %s via %s", host, server.exchanger.String())
 		go r.resolve(ctx, server, host)
+		// the stale answer is refreshed in background, it is fresh for a moment only.
+		ttl = time.Second
 	}
 	return
 }
@@ -205,26 +213,27 @@ func (r *localResolver) lookupCache(_ context.Context, server *NameServer, host
 	return lookup(dns.TypeAAAA, host)
 }
 
-func (r *localResolver) resolve4(ctx context.Context, server *NameServer, host string) (ips []net.IP, err error) {
+func (r *localResolver) resolve4(ctx context.Context, server *NameServer, host string) (ips []net.IP, ttl time.Duration, err error) {
 	mq := dns.Msg{}
 	mq.SetQuestion(dns.Fqdn(host), dns.TypeA)
 	return r.resolveIPs(ctx, server, &mq)
 }
 
-func (r *localResolver) resolve6(ctx context.Context, server *NameServer, host string) (ips []net.IP, err error) {
+func (r *localResolver) resolve6(ctx context.Context, server *NameServer, host string) (ips []net.IP, ttl time.Duration, err error) {
 	mq := dns.Msg{}
 	mq.SetQuestion(dns.Fqdn(host), dns.TypeAAAA)
 	return r.resolveIPs(ctx, server, &mq)
 }
 
-func (r *localResolver) resolveIPs(ctx context.Context, server *NameServer, mq *dns.Msg) (ips []net.IP, err error) {
+// resolveIPs returns the addresses of the answer and the min TTL of them.
+func (r *localResolver) resolveIPs(ctx context.Context, server *NameServer, mq *dns.Msg) (ips []net.IP, ttl time.Duration, err error) {
 	if r.options.logger.IsLevelEnabled(logger.TraceLevel) {
 		r.options.logger.Trace(mq.String())
 	}
 
 	key := resolver_util.NewCacheKey(&mq.Question[0])
-	mr, ttl := r.cache.Load(key)
-	if ttl <= 0 {
+	mr, cacheTTL := r.cache.Load(key)
+	if cacheTTL <= 0 {
 		resolver_util.AddSubnetOpt(mq, server.ClientIP)
 		mr, err = r.exchange(ctx, server.exchanger, mq)
 		if err != nil {
@@ -244,6 +253,9 @@ func (r *localResolver) resolveIPs(ctx context.Context, server *NameServer, mq *
 		if ar, _ := ans.(*dns.A); ar != nil {
 			ips = append(ips, ar.A)
 		}
+		if v := time.Duration(ans.Header().Ttl) * time.Second; ttl == 0 || v < ttl {
+			ttl = v
+		}
 	}
 
 	return
@@ -5,6 +5,11 @@ import (
 	"time"
 )
 
+const (
+	// the scale of the decayed weights to keep the resolution.
+	decayScale = 1000
+)
+
 type randomWeightedItem[T any] struct {
 	item   T
 	weight int
@@ -14,6 +19,11 @@ type RandomWeighted[T any] struct {
 	items []*randomWeightedItem[T]
 	sum   int
 	r     *rand.Rand
+	// the items are picked by the hash instead of r if hashed is set, see NewRandomWeightedWithHash.
+	hash   uint64
+	hashed bool
+	// the decay factor of the weights by the loads, see WithDecay.
+	decay float64
 }
 
 func NewRandomWeighted[T any]() *RandomWeighted[T] {
@@ -22,7 +32,42 @@ func NewRandomWeighted[T any]() *RandomWeighted[T] {
 	}
 }
 
+// NewRandomWeightedWithSource creates a RandomWeighted drawing from the source,
+// a source with a fixed seed makes the selection reproducible.
+func NewRandomWeightedWithSource[T any](src rand.Source) *RandomWeighted[T] {
+	return &RandomWeighted[T]{
+		r: rand.New(src),
+	}
+}
+
+// NewRandomWeightedWithHash creates a RandomWeighted picking by the hash instead of a random source,
+// the same hash always picks the same item of the same items.
+func NewRandomWeightedWithHash[T any](hash uint64) *RandomWeighted[T] {
+	return &RandomWeighted[T]{
+		hash:   hash,
+		hashed: true,
+	}
+}
+
+// WithDecay makes the weights decay as the loads of the items grow,
+// the weight of the item with the load n is weight / (1 + decay*n),
+// so the hot items receive fewer picks and recover as the loads drop.
+// Zero decay (the default) is the static weighting.
+func (rw *RandomWeighted[T]) WithDecay(decay float64) *RandomWeighted[T] {
+	rw.decay = max(decay, 0)
+	return rw
+}
+
 func (rw *RandomWeighted[T]) Add(item T, weight int) {
+	rw.AddWithLoad(item, weight, 0)
+}
+
+// AddWithLoad adds the item with the load, such as the number of the active connections,
+// the load is ignored if the decay is not set.
+func (rw *RandomWeighted[T]) AddWithLoad(item T, weight int, load int) {
+	if rw.decay > 0 && weight > 0 {
+		weight = max(int(float64(weight*decayScale)/(1+rw.decay*float64(max(load, 0)))), 1)
+	}
 	ri := &randomWeightedItem[T]{item: item, weight: weight}
 	rw.items = append(rw.items, ri)
 	rw.sum += weight
@@ -35,7 +80,12 @@ func (rw *RandomWeighted[T]) Next() (v T) {
 	if rw.sum <= 0 {
 		return
 	}
-	weight := rw.r.Intn(rw.sum) + 1
+	var weight int
+	if rw.hashed {
+		weight = int(rw.hash%uint64(rw.sum)) + 1
+	} else {
+		weight = rw.r.Intn(rw.sum) + 1
+	}
 	for _, item := range rw.items {
 		weight -= item.weight
 		if weight <= 0 {
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -13,6 +14,7 @@ import (
 	"github.com/go-gost/core/handler"
 	"github.com/go-gost/core/listener"
 	"github.com/go-gost/core/logger"
+	"github.com/go-gost/core/metadata"
 	"github.com/go-gost/core/metrics"
 	"github.com/go-gost/core/observer"
 	"github.com/go-gost/core/observer/stats"
@@ -23,6 +25,10 @@ import (
 	"github.com/rs/xid"
 )
 
+var (
+	ErrUpdateNotSupported = errors.New("update not supported")
+)
+
 type options struct {
 	admission     admission.Admission
 	recorders     []recorder.RecorderObject
@@ -34,6 +40,7 @@ type options struct {
 	observer      observer.Observer
 	observePeriod time.Duration
 	logger        logger.Logger
+	drainTimeout  time.Duration
 }
 
 type Option func(opts *options)
@@ -98,6 +105,13 @@ func LoggerOption(logger logger.Logger) Option {
 	}
 }
 
+// DrainTimeoutOption makes Close drain the service in the background, the active connections are kept up to the timeout.
+func DrainTimeoutOption(timeout time.Duration) Option {
+	return func(opts *options) {
+		opts.drainTimeout = timeout
+	}
+}
+
 type defaultService struct {
 	name     string
 	listener listener.Listener
@@ -248,7 +262,23 @@ func (s *defaultService) Status() *Status {
 	return s.status
 }
 
+// Close closes the service. If the drain timeout is set, the listener is closed at once
+// and the handler is drained in the background, so Close does not wait for the active connections.
 func (s *defaultService) Close() error {
+	if s.options.drainTimeout > 0 {
+		s.execCmds("pre-down", s.options.preDown)
+		err := s.listener.Close()
+
+		go func() {
+			defer s.execCmds("post-down", s.options.postDown)
+
+			ctx, cancel := context.WithTimeout(context.Background(), s.options.drainTimeout)
+			defer cancel()
+			s.drain(ctx)
+		}()
+		return err
+	}
+
 	s.execCmds("pre-down", s.options.preDown)
 	defer s.execCmds("post-down", s.options.postDown)
 
@@ -258,6 +288,95 @@ func (s *defaultService) Close() error {
 	return s.listener.Close()
 }
 
+// Drainer is an optional interface of the handler and service for the graceful shutdown.
+type Drainer interface {
+	// Drain stops accepting new connections and waits for the active connections to finish until ctx is done,
+	// then closes the remaining connections and returns the number of them.
+	Drain(ctx context.Context) (forced int, err error)
+}
+
+// Drain closes the listener, drains the handler if it implements the Drainer interface, then closes the service.
+func (s *defaultService) Drain(ctx context.Context) (forced int, err error) {
+	s.execCmds("pre-down", s.options.preDown)
+	defer s.execCmds("post-down", s.options.postDown)
+
+	s.listener.Close()
+	return s.drain(ctx)
+}
+
+// drain drains the handler if it implements the Drainer interface, then closes the handler.
+func (s *defaultService) drain(ctx context.Context) (forced int, err error) {
+	if drainer, ok := s.handler.(Drainer); ok {
+		s.options.logger.Infof("draining service %s", s.name)
+		forced, err = drainer.Drain(ctx)
+		if forced > 0 {
+			s.options.logger.Warnf("service %s: %d connections are force-closed", s.name, forced)
+		}
+	}
+
+	if closer, ok := s.handler.(io.Closer); ok {
+		closer.Close()
+	}
+	return
+}
+
+// OptionsUpdater is an optional interface of the handler and service,
+// it updates the options of the running handler without dropping the established connections.
+type OptionsUpdater interface {
+	UpdateOptions(opts ...handler.Option) error
+}
+
+// UpdateOptions updates the options of the handler if it implements the OptionsUpdater interface.
+func (s *defaultService) UpdateOptions(opts ...handler.Option) error {
+	updater, ok := s.handler.(OptionsUpdater)
+	if !ok {
+		return ErrUpdateNotSupported
+	}
+	if err := updater.UpdateOptions(opts...); err != nil {
+		return err
+	}
+	s.options.logger.Infof("service %s: handler options updated", s.name)
+	return nil
+}
+
+// Reloader is an optional interface of the handler and service,
+// it applies the part of the handler metadata that can be changed without restarting the handler.
+type Reloader interface {
+	// Reload applies the metadata md to the running handler.
+	Reload(md metadata.Metadata) error
+	// ReloadableKeys returns the metadata keys applied by Reload.
+	ReloadableKeys() []string
+}
+
+// Reload reloads the metadata of the handler if it implements the Reloader interface.
+func (s *defaultService) Reload(md metadata.Metadata) error {
+	reloader, ok := s.handler.(Reloader)
+	if !ok {
+		return ErrUpdateNotSupported
+	}
+	if err := reloader.Reload(md); err != nil {
+		return err
+	}
+	s.options.logger.Infof("service %s: handler metadata reloaded", s.name)
+	return nil
+}
+
+// ReloadableKeys returns the metadata keys reloadable by the handler, none if it does not implement the Reloader interface.
+func (s *defaultService) ReloadableKeys() []string {
+	if reloader, ok := s.handler.(Reloader); ok {
+		return reloader.ReloadableKeys()
+	}
+	return nil
+}
+
+// Drain drains the service if it implements the Drainer interface, or closes it otherwise.
+func Drain(ctx context.Context, svc service.Service) (forced int, err error) {
+	if drainer, ok := svc.(Drainer); ok {
+		return drainer.Drain(ctx)
+	}
+	return 0, svc.Close()
+}
+
 func (s *defaultService) execCmds(phase string, cmds []string) {
 	for _, cmd := range cmds {
 		cmd := strings.TrimSpace(cmd)
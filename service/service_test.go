@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-gost/core/handler"
+	"github.com/go-gost/core/listener"
+	"github.com/go-gost/core/metadata"
+	"github.com/go-gost/x/internal/util/drain"
+	xlogger "github.com/go-gost/x/logger"
+)
+
+type testListener struct {
+	listener.Listener
+	closed bool
+}
+
+func (l *testListener) Close() error {
+	l.closed = true
+	return nil
+}
+
+type testHandler struct {
+	tracker drain.Tracker
+	forced  int
+	closed  chan struct{}
+}
+
+func (h *testHandler) Init(md metadata.Metadata) error { return nil }
+
+func (h *testHandler) Handle(ctx context.Context, conn net.Conn, opts ...handler.HandleOption) error {
+	return nil
+}
+
+func (h *testHandler) Drain(ctx context.Context) (forced int, err error) {
+	h.forced, err = h.tracker.Drain(ctx)
+	return h.forced, err
+}
+
+func (h *testHandler) Close() error {
+	close(h.closed)
+	return nil
+}
+
+func TestServiceCloseDrain(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+
+	tests := []struct {
+		name         string
+		drainTimeout time.Duration
+		forced       int
+	}{
+		{name: "close"},
+		{name: "drain", drainTimeout: timeout, forced: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln := &testListener{}
+			h := &testHandler{closed: make(chan struct{})}
+			client, server := net.Pipe()
+			defer client.Close()
+			h.tracker.Add(server)
+
+			s := NewService("test", ln, h,
+				LoggerOption(xlogger.Nop()),
+				DrainTimeoutOption(tt.drainTimeout),
+			)
+
+			start := time.Now()
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			// Close does not wait for the drain.
+			if d := time.Since(start); d >= timeout {
+				t.Errorf("Close returned after %v", d)
+			}
+			if !ln.closed {
+				t.Error("the listener is not closed")
+			}
+
+			select {
+			case <-h.closed:
+			case <-time.After(time.Second):
+				t.Fatal("the handler is not closed")
+			}
+			if d := time.Since(start); tt.drainTimeout > 0 && d < tt.drainTimeout {
+				t.Errorf("handler closed after %v, before the drain timeout %v", d, tt.drainTimeout)
+			}
+			if h.forced != tt.forced {
+				t.Errorf("forced: got %d, want %d", h.forced, tt.forced)
+			}
+			if tt.drainTimeout > 0 && h.tracker.Add(client) {
+				t.Error("the drained handler accepts the new connection")
+			}
+		})
+	}
+}
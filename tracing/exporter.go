@@ -0,0 +1,40 @@
+package tracing
+
+import (
+	"github.com/go-gost/core/logger"
+)
+
+type logExporter struct {
+	logger logger.Logger
+}
+
+// NewLogExporter creates an Exporter writing the finished spans to the logger at the debug level.
+func NewLogExporter(log logger.Logger) Exporter {
+	if log == nil {
+		log = logger.Default()
+	}
+	return &logExporter{
+		logger: log.WithFields(map[string]any{
+			"kind": "tracing",
+		}),
+	}
+}
+
+func (e *logExporter) Export(span *Span) {
+	if !e.logger.IsLevelEnabled(logger.DebugLevel) {
+		return
+	}
+
+	fields := span.Attributes()
+	fields["service"] = span.Service
+	fields["traceID"] = span.TraceID.String()
+	fields["spanID"] = span.SpanID.String()
+	if !span.ParentID.IsZero() {
+		fields["parentID"] = span.ParentID.String()
+	}
+	fields["duration"] = span.End.Sub(span.Start)
+	if span.Err != nil {
+		fields["error"] = span.Err.Error()
+	}
+	e.logger.WithFields(fields).Debugf("span %s", span.Name)
+}
@@ -0,0 +1,263 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/logger"
+)
+
+const (
+	defaultOTLPTimeout = 10 * time.Second
+	// the spans are exported in batches of the size, or every otlpExportInterval.
+	otlpBatchSize      = 512
+	otlpExportInterval = 5 * time.Second
+	// the spans finished while the queue is full are dropped.
+	otlpQueueSize = 4 * otlpBatchSize
+
+	otlpScope = "github.com/go-gost/x/tracing"
+	// the status code of the span with an error.
+	otlpStatusError = 2
+)
+
+type OTLPOptions struct {
+	// Header is the extra headers of the export requests.
+	Header  http.Header
+	Timeout time.Duration
+	Logger  logger.Logger
+}
+
+type otlpExporter struct {
+	endpoint string
+	header   http.Header
+	client   *http.Client
+	queue    chan *Span
+	done     chan struct{}
+	closed   chan struct{}
+	once     sync.Once
+	logger   logger.Logger
+}
+
+// NewOTLPExporter creates an Exporter sending the spans in the OTLP/HTTP JSON encoding to the endpoint,
+// e.g. http://localhost:4318/v1/traces of an OpenTelemetry collector.
+// The spans are sent in batches in the background, the exporter must be closed to flush the pending ones.
+func NewOTLPExporter(endpoint string, opts OTLPOptions) Exporter {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultOTLPTimeout
+	}
+	if opts.Logger == nil {
+		opts.Logger = logger.Default()
+	}
+
+	e := &otlpExporter{
+		endpoint: endpoint,
+		header:   opts.Header,
+		client:   &http.Client{Timeout: opts.Timeout},
+		queue:    make(chan *Span, otlpQueueSize),
+		done:     make(chan struct{}),
+		closed:   make(chan struct{}),
+		logger: opts.Logger.WithFields(map[string]any{
+			"kind": "tracing",
+		}),
+	}
+	go e.run()
+
+	return e
+}
+
+func (e *otlpExporter) Export(span *Span) {
+	select {
+	case <-e.done:
+		return
+	default:
+	}
+
+	select {
+	case e.queue <- span:
+	default:
+		e.logger.Warnf("tracing: queue is full, span %s %s is dropped", span.Name, span.SpanID)
+	}
+}
+
+// Close flushes the pending spans and stops the exporter.
+func (e *otlpExporter) Close() error {
+	e.once.Do(func() {
+		close(e.done)
+	})
+	<-e.closed
+	return nil
+}
+
+func (e *otlpExporter) run() {
+	defer close(e.closed)
+
+	ticker := time.NewTicker(otlpExportInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			e.logger.Errorf("tracing: export %d spans: %v", len(batch), err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= otlpBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.done:
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *otlpExporter) send(spans []*Span) error {
+	b, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.client.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for k, v := range e.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+type otlpKeyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// otlpRequest builds the ExportTraceServiceRequest of the spans, one resource per service.
+func otlpRequest(spans []*Span) map[string]any {
+	var services []string
+	grouped := map[string][]otlpSpan{}
+	for _, span := range spans {
+		if _, ok := grouped[span.Service]; !ok {
+			services = append(services, span.Service)
+		}
+		grouped[span.Service] = append(grouped[span.Service], toOTLPSpan(span))
+	}
+
+	var resourceSpans []any
+	for _, service := range services {
+		resourceSpans = append(resourceSpans, map[string]any{
+			"resource": map[string]any{
+				"attributes": []otlpKeyValue{otlpAttribute("service.name", service)},
+			},
+			"scopeSpans": []any{
+				map[string]any{
+					"scope": map[string]any{"name": otlpScope},
+					"spans": grouped[service],
+				},
+			},
+		})
+	}
+	return map[string]any{
+		"resourceSpans": resourceSpans,
+	}
+}
+
+func toOTLPSpan(span *Span) otlpSpan {
+	s := otlpSpan{
+		TraceID:           span.TraceID.String(),
+		SpanID:            span.SpanID.String(),
+		Name:              span.Name,
+		StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+	}
+	if !span.ParentID.IsZero() {
+		s.ParentSpanID = span.ParentID.String()
+	}
+	for k, v := range span.Attributes() {
+		s.Attributes = append(s.Attributes, otlpAttribute(k, v))
+	}
+	if span.Err != nil {
+		s.Status = &otlpStatus{
+			Code:    otlpStatusError,
+			Message: span.Err.Error(),
+		}
+	}
+	return s
+}
+
+// otlpAttribute encodes the attribute in the AnyValue of OTLP, the 64-bit integers are encoded as strings.
+func otlpAttribute(key string, value any) otlpKeyValue {
+	var v map[string]any
+	switch x := value.(type) {
+	case string:
+		v = map[string]any{"stringValue": x}
+	case bool:
+		v = map[string]any{"boolValue": x}
+	case int:
+		v = map[string]any{"intValue": strconv.FormatInt(int64(x), 10)}
+	case int64:
+		v = map[string]any{"intValue": strconv.FormatInt(x, 10)}
+	case uint64:
+		v = map[string]any{"intValue": strconv.FormatUint(x, 10)}
+	case float64:
+		v = map[string]any{"doubleValue": x}
+	default:
+		v = map[string]any{"stringValue": fmt.Sprint(x)}
+	}
+	return otlpKeyValue{Key: key, Value: v}
+}
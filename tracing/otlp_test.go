@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	xlogger "github.com/go-gost/x/logger"
+)
+
+type otlpTestRequest struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []otlpKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Spans []otlpSpan `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+func TestOTLPExporter(t *testing.T) {
+	requests := make(chan otlpTestRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req otlpTestRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requests <- req
+	}))
+	defer srv.Close()
+
+	e := NewOTLPExporter(srv.URL, OTLPOptions{
+		Header: http.Header{"Authorization": []string{"Bearer token"}},
+		Logger: xlogger.Nop(),
+	})
+	Init(e)
+	defer Init(nil)
+
+	tracer := NewTracer("socks5", xlogger.Nop())
+	ctx, conn := tracer.Start(context.Background(), "conn")
+	conn.SetAttribute("dst", "example.com:443")
+	_, dial := tracer.Start(ctx, "dial")
+	dial.Finish(errors.New("connection refused"))
+	conn.Finish(nil)
+
+	// the pending spans are flushed on close.
+	e.(*otlpExporter).Close()
+
+	var req otlpTestRequest
+	select {
+	case req = <-requests:
+	default:
+		t.Fatal("no spans are exported")
+	}
+
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("got %+v", req)
+	}
+	if attrs := req.ResourceSpans[0].Resource.Attributes; len(attrs) != 1 ||
+		attrs[0].Key != "service.name" || attrs[0].Value["stringValue"] != "socks5" {
+		t.Errorf("resource attributes: got %+v", attrs)
+	}
+
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("spans: got %d, want 2", len(spans))
+	}
+	tests := []struct {
+		span   otlpSpan
+		want   *Span
+		parent string
+		status int
+	}{
+		{span: spans[0], want: dial, parent: conn.SpanID.String(), status: otlpStatusError},
+		{span: spans[1], want: conn},
+	}
+	for _, tt := range tests {
+		s := tt.span
+		if s.Name != tt.want.Name || s.TraceID != conn.TraceID.String() ||
+			s.SpanID != tt.want.SpanID.String() || s.ParentSpanID != tt.parent {
+			t.Errorf("%s: got %+v", tt.want.Name, s)
+		}
+		status := 0
+		if s.Status != nil {
+			status = s.Status.Code
+		}
+		if status != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.want.Name, status, tt.status)
+		}
+	}
+	if attrs := spans[1].Attributes; len(attrs) != 1 || attrs[0].Key != "dst" ||
+		attrs[0].Value["stringValue"] != "example.com:443" {
+		t.Errorf("conn attributes: got %+v", attrs)
+	}
+}
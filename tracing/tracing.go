@@ -0,0 +1,247 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/logger"
+)
+
+const (
+	// HeaderTraceParent is the W3C trace context header.
+	HeaderTraceParent = "traceparent"
+)
+
+type TraceID [16]byte
+
+func (id TraceID) IsZero() bool {
+	return id == TraceID{}
+}
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+type SpanID [8]byte
+
+func (id SpanID) IsZero() bool {
+	return id == SpanID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// Exporter exports the finished spans, e.g. to a tracing backend.
+type Exporter interface {
+	Export(span *Span)
+}
+
+var (
+	global   Exporter
+	globalMu sync.RWMutex
+)
+
+// Init sets the global exporter used by the tracers,
+// the previous exporter is closed if it is an io.Closer.
+func Init(exporter Exporter) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+
+	if c, ok := global.(io.Closer); ok && global != exporter {
+		c.Close()
+	}
+	global = exporter
+}
+
+func getExporter() Exporter {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+
+	return global
+}
+
+// Tracer starts the spans of a service.
+// A nil Tracer starts no span, so the handlers without tracing have no overhead.
+type Tracer struct {
+	service string
+	// exporter is used if the global exporter is not set.
+	exporter Exporter
+}
+
+// NewTracer creates a Tracer of the service,
+// the spans are written to the log if no global exporter is set by Init.
+func NewTracer(service string, log logger.Logger) *Tracer {
+	return &Tracer{
+		service:  service,
+		exporter: NewLogExporter(log),
+	}
+}
+
+// Start starts a span, it is the child of the span or the remote parent in ctx if any.
+// The returned context carries the new span.
+// It returns ctx and a nil span if t is nil, and the methods of the nil Span are no-ops.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		Service:  t.service,
+		Name:     name,
+		Start:    time.Now(),
+		exporter: t.exporter,
+	}
+	if exporter := getExporter(); exporter != nil {
+		span.exporter = exporter
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	} else if rp, ok := ctx.Value(remoteParentKey{}).(remoteParent); ok {
+		span.TraceID = rp.traceID
+		span.ParentID = rp.spanID
+	} else {
+		rand.Read(span.TraceID[:])
+	}
+	rand.Read(span.SpanID[:])
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Span is a traced operation, such as a connection, dialing or data transfer.
+type Span struct {
+	Service  string
+	Name     string
+	TraceID  TraceID
+	SpanID   SpanID
+	ParentID SpanID
+	Start    time.Time
+	End      time.Time
+	Err      error
+	attrs    map[string]any
+	exporter Exporter
+	mu       sync.Mutex
+	once     sync.Once
+}
+
+// SetAttribute sets the attribute of the span.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.attrs == nil {
+		s.attrs = make(map[string]any)
+	}
+	s.attrs[key] = value
+}
+
+// Attributes returns a copy of the attributes of the span.
+func (s *Span) Attributes() map[string]any {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := make(map[string]any, len(s.attrs))
+	for k, v := range s.attrs {
+		m[k] = v
+	}
+	return m
+}
+
+// Finish ends the span with the err and exports it.
+// Only the first call takes effect.
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+
+	s.once.Do(func() {
+		s.End = time.Now()
+		s.Err = err
+		if s.exporter != nil {
+			s.exporter.Export(s)
+		}
+	})
+}
+
+// Fields returns the log fields correlating the logs to the span.
+func (s *Span) Fields() map[string]any {
+	if s == nil {
+		return nil
+	}
+	return map[string]any{
+		"traceID": s.TraceID.String(),
+		"spanID":  s.SpanID.String(),
+	}
+}
+
+// TraceParent returns the W3C traceparent header value of the span.
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", s.TraceID, s.SpanID)
+}
+
+type spanKey struct{}
+
+// SpanFromContext returns the span in ctx, or nil if ctx has no span.
+func SpanFromContext(ctx context.Context) *Span {
+	v, _ := ctx.Value(spanKey{}).(*Span)
+	return v
+}
+
+type remoteParentKey struct{}
+
+type remoteParent struct {
+	traceID TraceID
+	spanID  SpanID
+}
+
+// Extract extracts the remote parent span from the traceparent header,
+// the spans started with the returned context are the children of it.
+// The ctx is returned untouched if the header is absent or malformed.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	traceID, spanID, ok := ParseTraceParent(header.Get(HeaderTraceParent))
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteParentKey{}, remoteParent{
+		traceID: traceID,
+		spanID:  spanID,
+	})
+}
+
+// ParseTraceParent parses the W3C traceparent header value in the format of version-traceid-parentid-flags.
+func ParseTraceParent(s string) (traceID TraceID, spanID SpanID, ok bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return
+	}
+	if len(parts[1]) != 2*len(traceID) || len(parts[2]) != 2*len(spanID) {
+		return
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return
+	}
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil {
+		return
+	}
+	ok = !traceID.IsZero() && !spanID.IsZero()
+	return
+}